@@ -2,6 +2,7 @@ package common
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -354,3 +355,32 @@ func PlugnTrigger(triggerName string, args ...string) error {
 	}
 	return sh.Command("plugn", shellArgs...).Run()
 }
+
+//PlugnTriggerInput fires the given plugn trigger with the given args and input on stdin, returning
+// what the trigger printed to stdout and stderr
+func PlugnTriggerInput(input string, triggerName string, args ...string) (string, error) {
+	shellArgs := make([]interface{}, len(args)+2)
+	shellArgs[0] = "trigger"
+	shellArgs[1] = triggerName
+	for i, arg := range args {
+		shellArgs[i+2] = arg
+	}
+	output, err := sh.Command("plugn", shellArgs...).SetInput(input).CombinedOutput()
+	return string(output), err
+}
+
+//PlugnTriggerOutput fires the given plugn trigger with the given args, returning what the trigger
+// printed to stdout and to stderr separately
+func PlugnTriggerOutput(triggerName string, args ...string) (string, string, error) {
+	shellArgs := make([]interface{}, len(args)+2)
+	shellArgs[0] = "trigger"
+	shellArgs[1] = triggerName
+	for i, arg := range args {
+		shellArgs[i+2] = arg
+	}
+	var stderr bytes.Buffer
+	cmd := sh.Command("plugn", shellArgs...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	return string(output), stderr.String(), err
+}
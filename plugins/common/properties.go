@@ -65,6 +65,37 @@ func PropertyDestroy(pluginName string, appName string) error {
 	return os.RemoveAll(pluginAppConfigRoot)
 }
 
+// PropertyClone copies the plugin properties of an app to another app, replacing those it already has
+func PropertyClone(pluginName string, oldAppName string, newAppName string) error {
+	oldAppConfigRoot := getPluginAppPropertyPath(pluginName, oldAppName)
+	files, err := ioutil.ReadDir(oldAppConfigRoot)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read %s config directory for %s: %s", pluginName, oldAppName, err.Error())
+	}
+
+	if err := makePluginAppPropertyPath(pluginName, newAppName); err != nil {
+		return fmt.Errorf("Unable to create %s config directory for %s: %s", pluginName, newAppName, err.Error())
+	}
+	for _, file := range files {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		contents, err := ioutil.ReadFile(path.Join(oldAppConfigRoot, file.Name()))
+		if err != nil {
+			return fmt.Errorf("Unable to read %s config value %s.%s: %s", pluginName, oldAppName, file.Name(), err.Error())
+		}
+		propertyPath := getPropertyPath(pluginName, newAppName, file.Name())
+		if err := ioutil.WriteFile(propertyPath, contents, 0600); err != nil {
+			return fmt.Errorf("Unable to write %s config value %s.%s: %s", pluginName, newAppName, file.Name(), err.Error())
+		}
+		setPermissions(propertyPath, 0600)
+	}
+	return nil
+}
+
 // PropertyExists returns whether a property exists or not
 func PropertyExists(pluginName string, appName string, property string) bool {
 	propertyPath := getPropertyPath(pluginName, appName, property)
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"encoding/json"
+)
+
+//RedactedValue replaces the values of the keys exported for all apps at once, unless they are asked for
+const RedactedValue = "[redacted]"
+
+//appExport is the export of a single app in the listing of all apps. It holds the keys of the app
+// in the json format, and the error its env could not be loaded with or the first line of its ENV
+// file that could not be parsed, after which no key was read
+type appExport struct {
+	Env   map[string]jsonEntry `json:"env,omitempty"`
+	Error string               `json:"error,omitempty"`
+}
+
+//exportAllApps returns the env of every app as a json object keyed by app name, loading them in a
+// single process through the cache. An app whose env cannot be loaded is listed with the error
+// rather than failing the whole listing
+func exportAllApps(apps []string, merged bool, container bool, showValues bool) ([]byte, error) {
+	exports := make(map[string]appExport, len(apps))
+	for _, appName := range apps {
+		app, err := LoadAppCached(appName)
+		if err != nil {
+			exports[appName] = appExport{Error: err.Error()}
+			continue
+		}
+		env, err := exportedAppEnv(app, merged, container)
+		if err != nil {
+			exports[appName] = appExport{Error: err.Error()}
+			continue
+		}
+		exports[appName] = appExport{Env: env.jsonEntries(showValues), Error: unparsableLine(app)}
+	}
+	return json.Marshal(exports)
+}
+
+//exportedAppEnv returns the env of an app the way config:export does for the json format
+func exportedAppEnv(app *Env, merged bool, container bool) (*Env, error) {
+	env := app
+	if merged {
+		//the global env is parsed once for all apps
+		global, err := LoadGlobalCached()
+		if err != nil {
+			return nil, err
+		}
+		env = mergeLayers(app.name, []effectiveLayer{{name: LayerGlobal, env: global}, {name: LayerApp, env: app}}).Env
+	}
+	env, err := env.ResolveReferences()
+	if err != nil {
+		return nil, err
+	}
+	if container {
+		return withoutNoExportKeys(env, app.name)
+	}
+	return env, nil
+}
+
+//unparsableLine describes the first line of the ENV file of an Env that could not be parsed, if any
+func unparsableLine(env *Env) string {
+	for _, w := range env.Warnings() {
+		if w.Category == ParseWarningUnparsable {
+			return env.filename + " " + w.String()
+		}
+	}
+	return ""
+}
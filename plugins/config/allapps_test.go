@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestExportAllApps(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	brokenDir := dokkuRoot + "/broken-app"
+	Expect(os.MkdirAll(brokenDir, 0766)).To(Succeed())
+	defer os.RemoveAll(brokenDir)
+	Expect(ioutil.WriteFile(brokenDir+"/ENV", []byte("export KEPT=1\nnot a valid line\nexport DROPPED=2\n"), 0644)).To(Succeed())
+
+	var exports map[string]appExport
+	exported, err := exportAllApps([]string{testAppName, "broken-app", "missing/../.."}, false, false, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.Unmarshal(exported, &exports)).To(Succeed())
+	Expect(exports).To(HaveLen(3))
+	Expect(exports[testAppName].Error).To(BeEmpty())
+	Expect(exports[testAppName].Env["testKey"].Value).To(Equal(RedactedValue))
+	Expect(exports["broken-app"].Error).To(Equal(brokenDir + "/ENV line 2: the line cannot be parsed, it and the 1 line(s) after it are ignored"))
+	Expect(exports["missing/../.."].Error).To(HavePrefix("Refusing to use"))
+	Expect(exports["missing/../.."].Env).To(BeEmpty())
+
+	exported, err = exportAllApps([]string{testAppName}, true, false, true)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.Unmarshal(exported, &exports)).To(Succeed())
+	Expect(exports[testAppName].Env["testKey"].Value).To(Equal("TESTING"))
+	Expect(exports[testAppName].Env["globalKey"].Value).To(Equal("GLOBAL_VALUE"))
+}
@@ -0,0 +1,199 @@
+package config_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// These assignments fail to compile if the signature of any function listed as stable in the
+// package documentation changes. Extending the API is fine, changing it here needs a good reason
+var (
+	_ func(string, ...config.LoadOption) (*config.Env, error) = config.LoadAppEnv
+	_ func(string, ...config.LoadOption) (*config.Env, error) = config.LoadMergedAppEnv
+	_ func(...config.LoadOption) (*config.Env, error)         = config.LoadGlobalEnv
+	_ func() bool                                             = config.GlobalExists
+	_ func(string) config.LoadOption                          = config.WithRoot
+	_ func(string) config.LoadOption                          = config.WithFile
+	_ func(string, string) (string, bool)                     = config.Get
+	_ func(string, string, string) string                     = config.GetWithDefault
+	_ func(string, string, bool) bool                         = config.GetAppBool
+	_ func(string, string) (*config.Env, error)               = config.NewFromStringWithName
+	_ func(string, []byte) (*config.Env, error)               = config.NewFromJSON
+	_ func(io.Reader) (*config.Env, error)                    = config.NewFromDockerEnvFile
+	_ func(string, string, string) (*config.Env, error)       = config.ResolveSchedulerEnv
+	_ func(string, string) (*config.Env, error)               = config.ComputeContainerEnv
+	_ func(string, string) ([]config.ReferenceStep, error)    = config.ResolveReference
+
+	_ func(string, string, string, ...config.LoadOption) (*config.EffectiveEnv, error) = config.ResolveEffectiveEnv
+	_ func(*config.EffectiveEnv, string) []config.LayerValue                           = (*config.EffectiveEnv).Chain
+	_ func(*config.EffectiveEnv) []config.SourceFormat                                 = (*config.EffectiveEnv).Formats
+
+	_ func(config.InvalidUTF8Policy) config.LoadOption                         = config.WithInvalidUTF8
+	_ func(string) (config.InvalidUTF8Policy, error)                           = config.ParseInvalidUTF8Policy
+	_ func(string, string, config.InvalidUTF8Policy) (string, []string, error) = config.TranscodeEnvFile
+	_ func(*config.Env) []string                                               = (*config.Env).InvalidUTF8Keys
+
+	_ func(string, map[string]string, bool) error                                         = config.SetMany
+	_ func(string, []string, bool) error                                                  = config.UnsetMany
+	_ func(string, config.RestartPolicy, func(*config.Env) error) (config.EnvDiff, error) = config.Update
+	_ func(string, int) (string, error)                                                   = config.MigrateEnvFile
+	_ func([]string, func(map[string]*config.Env) error) error                            = config.WithLockedTargets
+	_ func(string, string, config.RestartPolicy) (string, bool, error)                    = config.GetAndUnset
+	_ func(string, map[string]string, bool) error                                         = config.SealMany
+	_ func(string, string) (string, error)                                                = config.Unseal
+
+	_ func(string, string, config.EnvFileFormat) (string, error) = config.ConvertEnvFile
+	_ func(string) (config.EnvFileFormat, error)                 = config.ParseEnvFileFormat
+	_ func(*config.Env, config.EnvFileFormat)                    = (*config.Env).SetFileFormat
+	_ func(*config.Env) config.EnvFileFormat                     = (*config.Env).FileFormat
+
+	_ func(string, string) (*config.Env, error)                             = config.LoadPluginConfig
+	_ func(string, string, func(*config.Env) error) (config.EnvDiff, error) = config.UpdatePluginConfig
+
+	_ func(*config.Env, *config.Env) config.EnvDiff                          = config.Diff
+	_ func(*config.Env, *config.Env, config.EnvDiff, bool) config.DiffReport = config.NewDiffReport
+	_ func(string) string                                                    = config.ValueChecksum
+	_ func(string) (map[string]bool, error)                                  = config.ParseDiffKinds
+	_ func(config.EnvDiff, map[string]bool) bool                             = config.EnvDiff.Has
+
+	_ func(string) (config.PendingRestart, error) = config.GetPendingRestart
+	_ func(config.PendingRestart) bool            = config.PendingRestart.Pending
+	_ func(config.PendingRestart) int             = config.PendingRestart.Count
+
+	_ func(string) (config.RedactedSnapshot, error) = config.LoadRedactedSnapshot
+
+	_ func(string) (config.ConfigIntrospection, error) = config.IntrospectConfig
+	_ func(config.ConfigIntrospection) (string, error) = config.ConfigIntrospection.JSON
+	_ int                                              = config.IntrospectionMaxSize
+
+	_ func(map[string]string) ([]config.GlobalImpact, error) = config.PreviewGlobalSet
+
+	_ func(*config.Env) string                                                      = (*config.Env).Name
+	_ func(*config.Env, string) (string, bool)                                      = (*config.Env).Get
+	_ func(*config.Env, string, string) string                                      = (*config.Env).GetDefault
+	_ func(*config.Env, ...string) (string, string, bool)                           = (*config.Env).GetFirst
+	_ func(*config.Env, string, bool) bool                                          = (*config.Env).GetBoolDefault
+	_ func(*config.Env, string, string) error                                       = (*config.Env).Set
+	_ func(*config.Env, string) error                                               = (*config.Env).Unset
+	_ func(*config.Env, []string) ([]string, []string, error)                       = (*config.Env).UnsetAll
+	_ func(*config.Env) []string                                                    = (*config.Env).Keys
+	_ func(*config.Env) []string                                                    = (*config.Env).OrderedKeys
+	_ func(*config.Env) int                                                         = (*config.Env).Len
+	_ func(*config.Env) map[string]string                                           = (*config.Env).Map
+	_ func(*config.Env) []config.Entry                                              = (*config.Env).EntriesSorted
+	_ func(*config.Env, bool) []string                                              = (*config.Env).Environ
+	_ func(*config.Env) int                                                         = (*config.Env).FormatVersion
+	_ func(*config.Env, []string, []string) *config.Env                             = (*config.Env).Filter
+	_ func(*config.Env) (*config.Env, error)                                        = (*config.Env).ResolveReferences
+	_ func(*config.Env) []config.ParseWarning                                       = (*config.Env).Warnings
+	_ func(*config.Env) config.Scope                                                = (*config.Env).Scope
+	_ func(*config.Env) string                                                      = (*config.Env).Checksum
+	_ func(*config.Env, string, string) (bool, error)                               = (*config.Env).CompareValue
+	_ func(*config.Env) error                                                       = (*config.Env).Write
+	_ func(*config.Env, config.ExportFormat) string                                 = (*config.Env).Export
+	_ func(*config.Env, config.ExportFormat, config.ExportOptions) (string, error)  = (*config.Env).ExportWithOptions
+	_ func(*config.Env, io.Writer) error                                            = (*config.Env).ExportBundle
+	_ func(*config.Env, io.Writer, config.ExportFormat, config.ExportOptions) error = (*config.Env).ExportTo
+	_ func(*config.Env, config.FormatOptions) (string, error)                       = (*config.Env).FormatWith
+	_ func(*config.Env) (string, []string)                                          = (*config.Env).DockerEnvFileString
+	_ func(*config.Env) error                                                       = (*config.Env).Reload
+	_ func(*config.Env) *config.SyncEnv                                             = (*config.Env).Synchronized
+	_ func(*config.SyncEnv) error                                                   = (*config.SyncEnv).Reload
+	_ func(*config.SyncEnv) *config.Env                                             = (*config.SyncEnv).Snapshot
+	_ func(*config.Env) *config.Env                                                 = (*config.Env).ReadOnly
+	_ func(*config.Env) bool                                                        = (*config.Env).IsReadOnly
+
+	_ func(*config.Env, *config.Env) []string                                          = (*config.Env).Conflicts
+	_ func(*config.Env, *config.Env, config.MergeStrategy) (config.MergeResult, error) = (*config.Env).MergeWith
+	_ func(*config.Env, io.Writer, config.BundleOptions) error                         = (*config.Env).ExportBundleWithOptions
+	_ func(*config.Env, string, string) (string, bool, error)                          = (*config.Env).Swap
+	_ func(*config.Env, string) (string, bool, error)                                  = (*config.Env).Take
+	_ func(*config.Env, string) *config.EnvView                                        = (*config.Env).WithPrefix
+	_ func(*config.Env, string, string) error                                          = (*config.Env).PromoteKey
+
+	_ func(*config.EnvView) string                 = (*config.EnvView).Prefix
+	_ func(*config.EnvView, string) (string, bool) = (*config.EnvView).Get
+	_ func(*config.EnvView, string, string) string = (*config.EnvView).GetDefault
+	_ func(*config.EnvView, string, string) error  = (*config.EnvView).Set
+	_ func(*config.EnvView, string) error          = (*config.EnvView).Unset
+	_ func(*config.EnvView) []string               = (*config.EnvView).Keys
+	_ func(*config.EnvView) map[string]string      = (*config.EnvView).Map
+
+	_ func(string, func(*config.Env), ...config.WatchOption) (func(), error) = config.WatchApp
+	_ func(func(error)) config.WatchOption                                   = config.WithErrorHandler
+
+	_ func(string) string                         = config.SingleQuoteEscape
+	_ func(string) string                         = config.DoubleQuoteEscape
+	_ func(string, map[string]string, bool) error = config.VerifyShellExport
+	_ func(string) string                         = config.GuardExport
+	_ func(string) (string, error)                = config.VerifyGuardedExport
+	_ int                                         = config.GuardedExportVersion
+
+	_ func(string) (config.KeyCase, error)              = config.ParseKeyCase
+	_ func(config.KeyTransform) func(key string) string = config.KeyTransform.Func
+
+	_ error = &config.AppNotFoundError{}
+	_ error = &config.InvalidKeyError{}
+	_ error = &config.UnsafePathError{}
+	_ error = config.ErrInvalidValue
+	_ error = config.ErrDokkuRootNotSet
+	_ error = config.ErrReadOnlyEnv
+	_ error = &config.MergeConflictError{}
+	_ error = &config.KeyExistsError{}
+	_ error = &config.ValidationError{}
+	_ error = &config.LockError{}
+	_ error = &config.ShellVerifyError{}
+	_ error = &config.ProviderError{}
+	_ error = &config.RestartError{}
+	_ error = &config.SealedError{}
+	_ error = &config.ErrScopeMismatch{}
+)
+
+func TestAPICompatibility(t *testing.T) {
+	//the export formats are persisted by callers, so their values must not change
+	formats := []config.ExportFormat{
+		config.ExportFormatExports,
+		config.ExportFormatEnvfile,
+		config.ExportFormatDockerArgs,
+		config.ExportFormatShell,
+		config.ExportFormatPretty,
+		config.ExportFormatJSON,
+		config.ExportFormatNul,
+		config.ExportFormatNetstring,
+		config.ExportFormatCompose,
+		config.ExportFormatDockerEnvfile,
+		config.ExportFormatJSONNested,
+	}
+	for i, format := range formats {
+		if int(format) != i {
+			t.Errorf("export format %d has changed value to %d", i, int(format))
+		}
+	}
+
+	diff := config.EnvDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	if !diff.Empty() {
+		t.Error("an EnvDiff without keys must be empty")
+	}
+	_ = config.ExportOptions{EscapeControlChars: true, Ordered: true, Quoting: config.QuoteMinimal, NestedSeparator: "__", NestedLowercase: true}
+	_ = config.ParseWarning{Line: 1, Category: config.ParseWarningDuplicateKey, Message: ""}
+
+	//files declare the format they were written in, so versions only ever go up
+	if config.EnvFormatVersion < 2 {
+		t.Error("the ENV format version must not go down")
+	}
+
+	//the default quoting must stay single quotes for existing consumers
+	if config.QuoteSingle != 0 || config.QuoteDouble != 1 || config.QuoteMinimal != 2 {
+		t.Error("quote styles have changed value")
+	}
+
+	//scripts check the exit status of the subcommands, so they must not change either
+	statuses := []int{config.ExitStatusKeyNotSet, config.ExitStatusInvalid, config.ExitStatusLocked, config.ExitStatusNotWritable, config.ExitStatusConflict, config.ExitStatusUnchanged, config.ExitStatusPending, config.ExitStatusRestartFailed, config.ExitStatusAppNotFound}
+	for i, status := range []int{1, 2, 3, 4, 5, 6, 7, 8, 20} {
+		if statuses[i] != status {
+			t.Errorf("exit status %d has changed value to %d", status, statuses[i])
+		}
+	}
+}
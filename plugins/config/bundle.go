@@ -0,0 +1,76 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+//bundleEnv returns the tarfile of the env of an app, or of the global env if appName is empty, that
+// config:bundle and the config-bundle trigger write, so that both always write the same bytes. The
+// bundle is built in full before it is returned, so that nothing is written if it fails
+func bundleEnv(appName string, merged bool, exclude []string, includeOnly []string, container bool, opts BundleOptions) ([]byte, error) {
+	for flagName, patterns := range map[string][]string{"exclude": exclude, "include-only": includeOnly} {
+		if err := validatePatterns(flagName, patterns); err != nil {
+			return nil, err
+		}
+	}
+	var env *Env
+	var err error
+	if appName != "" && merged {
+		env, err = LoadMergedAppEnv(appName)
+	} else {
+		env, err = loadAppOrGlobalEnv(appName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if env, err = env.ResolveReferences(); err != nil {
+		return nil, err
+	}
+	if container {
+		if env, err = withoutNoExportKeys(env, appName); err != nil {
+			return nil, err
+		}
+	}
+	var bundle bytes.Buffer
+	if err := env.Filter(includeOnly, exclude).ExportBundleWithOptions(&bundle, opts); err != nil {
+		return nil, err
+	}
+	return bundle.Bytes(), nil
+}
+
+//TriggerBundle implements the config-bundle trigger by writing the tarfile config:bundle writes of
+// the env of an app, or of the global env for --global, to output. args are the flags following the
+// app name: --gzip, and --exclude and --include-only, which may be given more than once. Nothing is
+// written if the bundle cannot be made, and an app that does not exist exits with ExitCodeAppNotFound
+func TriggerBundle(appName string, args []string, output io.Writer) error {
+	var exclude, includeOnly stringList
+	flags := flag.NewFlagSet("config-bundle", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	flags.Var(&exclude, "exclude", "")
+	flags.Var(&includeOnly, "include-only", "")
+	gzipped := flags.Bool("gzip", false, "")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return &ValidationError{Message: fmt.Sprintf("Trailing argument(s): %v", flags.Args())}
+	}
+	if appName == "--global" {
+		appName = ""
+	} else if _, err := NewPathResolver().AppFile(appName); err != nil {
+		if _, ok := err.(*AppNotFoundError); ok {
+			return &TriggerError{ExitCode: ExitCodeAppNotFound, Err: err}
+		}
+		return err
+	}
+	bundle, err := bundleEnv(appName, false, exclude, includeOnly, false, BundleOptions{Gzip: *gzipped})
+	if err != nil {
+		return err
+	}
+	_, err = output.Write(bundle)
+	return err
+}
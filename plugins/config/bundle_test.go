@@ -0,0 +1,79 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//readBundleModes returns the mode of each entry of a bundle, decompressing it first if gzipped
+func readBundleModes(bundle []byte, gzipped bool) map[string]int64 {
+	var reader io.Reader = bytes.NewReader(bundle)
+	if gzipped {
+		decompressed, err := gzip.NewReader(reader)
+		Expect(err).NotTo(HaveOccurred())
+		reader = decompressed
+	}
+	modes := map[string]int64{}
+	tarfile := tar.NewReader(reader)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			return modes
+		}
+		Expect(err).NotTo(HaveOccurred())
+		modes[header.Name] = header.Mode
+	}
+}
+
+func TestTriggerBundleMatchesCommand(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "web-app", "ENV"), []byte("export DATABASE_PASSWORD='hunter2'\nexport DOKKU_APP_TYPE='herokuish'\nexport PORT='5000'\n"), 0600)).To(Succeed())
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	for _, flags := range [][]string{
+		{},
+		{"--gzip"},
+		{"--exclude", "DOKKU_*"},
+		{"--gzip", "--exclude", "DOKKU_*", "--include-only", "DATABASE_*", "--include-only", "PORT"},
+	} {
+		output, err := runSubcommand(host, "bundle", append(flags, "web-app")...)
+		Expect(err).NotTo(HaveOccurred())
+		var triggered bytes.Buffer
+		Expect(TriggerBundle("web-app", flags, &triggered)).To(Succeed())
+		Expect(triggered.Bytes()).To(Equal([]byte(output)), "%v", flags)
+	}
+
+	var bundle bytes.Buffer
+	Expect(TriggerBundle("web-app", []string{"--gzip", "--exclude", "DOKKU_*"}, &bundle)).To(Succeed())
+	Expect(readBundleModes(bundle.Bytes(), true)).To(Equal(map[string]int64{"DATABASE_PASSWORD": 0400, "PORT": 0600}))
+	bundle.Reset()
+	Expect(TriggerBundle("--global", nil, &bundle)).To(Succeed())
+	Expect(readBundleModes(bundle.Bytes(), false)).To(Equal(map[string]int64{"KEY": 0400}))
+}
+
+func TestTriggerBundleFailures(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	var out bytes.Buffer
+	expectTriggerExitCode(TriggerBundle("missing-app", []string{"--gzip"}, &out), ExitCodeAppNotFound)
+	Expect(TriggerBundle("web-app", []string{"--exclude", "["}, &out)).To(MatchError("Invalid --exclude pattern: '['"))
+	Expect(TriggerBundle("web-app", []string{"--unknown"}, &out)).To(HaveOccurred())
+	Expect(TriggerBundle("web-app", []string{"--gzip", "extra"}, &out)).To(MatchError("Trailing argument(s): [extra]"))
+	Expect(out.Len()).To(Equal(0))
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+//fileVersion identifies the on-disk state of a parsed env file
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+	inode   uint64
+}
+
+type cacheEntry struct {
+	env     *Env
+	version fileVersion
+}
+
+//cacheKey identifies an env loaded from a file by a PathResolver, whose invalid-utf8 policy has been
+// resolved, as the same file is loaded differently depending on the options
+type cacheKey struct {
+	name     string
+	filename string
+	resolver PathResolver
+}
+
+var envCache = struct {
+	sync.Mutex
+	entries map[cacheKey]cacheEntry
+}{entries: map[cacheKey]cacheEntry{}}
+
+//LoadAppCached loads an environment for the given app, reusing a previously parsed copy
+// while the ENV file is unchanged. Each caller receives its own copy, so it is safe to
+// modify, but mutations meant to be persisted should load fresh via LoadAppEnv
+func LoadAppCached(appName string, opts ...LoadOption) (*Env, error) {
+	resolver := NewPathResolver(opts...)
+	appfile, err := resolver.AppFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	return resolver.loadCached(appName, appfile)
+}
+
+//LoadGlobalCached loads the global environment, reusing a previously parsed copy while
+// the ENV file is unchanged
+func LoadGlobalCached(opts ...LoadOption) (*Env, error) {
+	resolver := NewPathResolver(opts...)
+	globalfile, err := resolver.GlobalFile()
+	if err != nil {
+		return nil, err
+	}
+	return resolver.loadCached("<global>", globalfile)
+}
+
+//loadCached is load, reusing the env it returned for the same file and options while the file is
+// unchanged
+func (r *PathResolver) loadCached(name string, filename string) (*Env, error) {
+	before, ok := statFileVersion(filename)
+	if !ok {
+		return r.load(name, filename)
+	}
+	policy, err := r.invalidUTF8Policy(name)
+	if err != nil {
+		return nil, err
+	}
+	key := cacheKey{name: name, filename: filename, resolver: *r}
+	key.resolver.InvalidUTF8 = policy
+
+	envCache.Lock()
+	entry, hit := envCache.entries[key]
+	envCache.Unlock()
+	if hit && entry.version == before {
+		return entry.env.cachedCopy(), nil
+	}
+
+	env, err := key.resolver.load(name, filename)
+	if err != nil {
+		return env, err
+	}
+	//only cache if the file did not change while it was being parsed
+	if after, ok := statFileVersion(filename); ok && after == before {
+		envCache.Lock()
+		envCache.entries[key] = cacheEntry{env: env.cachedCopy(), version: after}
+		envCache.Unlock()
+	}
+	return env, nil
+}
+
+//cachedCopy is clone, keeping whether the env is read-only and public as load set them
+func (e *Env) cachedCopy() *Env {
+	env := e.clone()
+	env.readOnly, env.public = e.readOnly, e.public
+	return env
+}
+
+//statFileVersion returns the version of an ENV file in whichever form it is stored in
+func statFileVersion(filename string) (fileVersion, bool) {
+	path, _ := envFileOnDisk(filename)
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileVersion{}, false
+	}
+	version := fileVersion{modTime: fi.ModTime(), size: fi.Size()}
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		version.inode = uint64(stat.Ino)
+	}
+	return version, true
+}
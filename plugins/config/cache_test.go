@@ -0,0 +1,142 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupCacheTestRoot(keyCount int) (root string, err error) {
+	if root, err = ioutil.TempDir("", "dokku-config-cache"); err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Join(root, "cached-app"), 0755); err != nil {
+		return
+	}
+	lines := make([]string, keyCount)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("export KEY_%d='value %d'", i, i)
+	}
+	err = ioutil.WriteFile(filepath.Join(root, "cached-app", "ENV"), []byte(strings.Join(lines, "\n")), 0600)
+	return
+}
+
+func TestLoadAppCachedIsolation(t *testing.T) {
+	RegisterTestingT(t)
+	root, err := setupCacheTestRoot(3)
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+
+	first, err := LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	first.Set("KEY_0", "mutated")
+	first.Unset("KEY_1")
+
+	second, err := LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(second.GetDefault("KEY_0", "")).To(Equal("value 0"))
+	Expect(second.Keys()).To(Equal([]string{"KEY_0", "KEY_1", "KEY_2"}))
+	second.Set("KEY_2", "mutated")
+
+	third, err := LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(third.GetDefault("KEY_2", "")).To(Equal("value 2"))
+}
+
+func TestLoadAppCachedInvalidation(t *testing.T) {
+	RegisterTestingT(t)
+	root, err := setupCacheTestRoot(3)
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+
+	env, err := LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(3))
+
+	//written through Env.Write, which replaces the file
+	env.Set("KEY_3", "new")
+	Expect(env.Write()).To(Succeed())
+	env, err = LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("KEY_3", "")).To(Equal("new"))
+
+	//edited in place by an external tool
+	appfile := filepath.Join(root, "cached-app", "ENV")
+	Expect(ioutil.WriteFile(appfile, []byte("export EXTERNAL='edit'\n"), 0600)).To(Succeed())
+	env, err = LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("EXTERNAL", "edit")))
+
+	Expect(os.Remove(appfile)).To(Succeed())
+	env, err = LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(0))
+}
+
+func TestLoadAppCachedMatchesLoad(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupTestProperties()()
+	root, err := setupCacheTestRoot(0)
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+	appfile := filepath.Join(root, "cached-app", "ENV")
+	Expect(ioutil.WriteFile(appfile, []byte(testLatin1Env), 0600)).To(Succeed())
+
+	expectSameLoad := func(opts ...LoadOption) {
+		expected, expectedErr := LoadAppEnv("cached-app", opts...)
+		//the second load is served from the cache
+		for i := 0; i < 2; i++ {
+			env, err := LoadAppCached("cached-app", opts...)
+			if expectedErr != nil {
+				Expect(err).To(MatchError(expectedErr.Error()))
+				continue
+			}
+			Expect(err).NotTo(HaveOccurred())
+			Expect(env.Map()).To(Equal(expected.Map()))
+			Expect(env.readOnly).To(Equal(expected.readOnly))
+			Expect(env.public).To(Equal(expected.public))
+			Expect(env.Scope()).To(Equal(expected.Scope()))
+		}
+	}
+	expectSameLoad(WithRoot(root))
+	expectSameLoad(WithRoot(root), WithInvalidUTF8(InvalidUTF8Replace))
+	expectSameLoad(WithRoot(root), WithInvalidUTF8(InvalidUTF8Latin1))
+	expectSameLoad(WithRoot(root), WithInvalidUTF8(InvalidUTF8Error))
+	expectSameLoad(WithFile(appfile))
+
+	//the invalid-utf8 property applies to cached loads as soon as it is set
+	Expect(common.PropertyWrite("config", "cached-app", "invalid-utf8", "latin1")).To(Succeed())
+	expectSameLoad(WithRoot(root))
+	env, err := LoadAppCached("cached-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("NAME", "")).To(Equal("café"))
+}
+
+func benchmarkLoadApp(b *testing.B, load func(string, ...LoadOption) (*Env, error)) {
+	root, err := setupCacheTestRoot(500)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := load("cached-app", WithRoot(root)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadAppEnv(b *testing.B) {
+	benchmarkLoadApp(b, LoadAppEnv)
+}
+
+func BenchmarkLoadAppCached(b *testing.B) {
+	benchmarkLoadApp(b, LoadAppCached)
+}
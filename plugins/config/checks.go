@@ -0,0 +1,209 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+//Severity of a lint finding
+type Severity string
+
+const (
+	//SeverityError marks a finding that breaks or loses configuration
+	SeverityError Severity = "error"
+	//SeverityWarning marks a finding that is likely, but not certainly, a mistake
+	SeverityWarning Severity = "warning"
+)
+
+//Finding is a single issue reported by a check
+type Finding struct {
+	Check    string   `json:"check"`
+	Severity Severity `json:"severity"`
+	Key      string   `json:"key,omitempty"`
+	Line     int      `json:"line,omitempty"`
+	Message  string   `json:"message"`
+}
+
+var placeholderPattern = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}|\{\{[^{}]*\}\}`)
+
+//KeyCollision is a group of keys that differ only by case
+type KeyCollision struct {
+	Keys []string
+}
+
+func (c KeyCollision) String() string {
+	return fmt.Sprintf("Keys %s differ only by case", strings.Join(c.Keys, " and "))
+}
+
+//Includes reports whether the given key is part of the collision
+func (c KeyCollision) Includes(key string) bool {
+	for _, k := range c.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+//FindKeyCollisions returns every group of keys that differ only by case, with the keys of each
+// group sorted. Case-insensitive consumers of the environment will see only one of them
+func FindKeyCollisions(keys []string) []KeyCollision {
+	groups := make(map[string][]string)
+	for _, k := range keys {
+		folded := strings.ToLower(k)
+		groups[folded] = append(groups[folded], k)
+	}
+
+	collisions := []KeyCollision{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			sort.Strings(group)
+			collisions = append(collisions, KeyCollision{Keys: group})
+		}
+	}
+	sort.Slice(collisions, func(i, j int) bool {
+		return collisions[i].Keys[0] < collisions[j].Keys[0]
+	})
+	return collisions
+}
+
+//KeyCollisions returns the groups of keys in this environment that differ only by case
+func (e *Env) KeyCollisions() []KeyCollision {
+	return FindKeyCollisions(e.sortKeys())
+}
+
+//CheckKeyCollisions reports keys that differ only by case
+func CheckKeyCollisions(env *Env) []Finding {
+	findings := []Finding{}
+	for _, collision := range env.KeyCollisions() {
+		findings = append(findings, Finding{
+			Check:    "key-case-collision",
+			Severity: SeverityWarning,
+			Key:      collision.Keys[0],
+			Message:  collision.String(),
+		})
+	}
+	return findings
+}
+
+//CheckInvalidKeys reports keys that dokku deletes from the environment when it is loaded
+func CheckInvalidKeys(env *Env) []Finding {
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		if err := validateKey(k); err != nil {
+			findings = append(findings, Finding{
+				Check:    "invalid-key",
+				Severity: SeverityError,
+				Key:      k,
+				Message:  err.Error(),
+			})
+		}
+	}
+	return findings
+}
+
+//CheckValueWhitespace reports values with leading or trailing whitespace
+func CheckValueWhitespace(env *Env) []Finding {
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		v := env.values()[k]
+		if v != strings.TrimSpace(v) {
+			findings = append(findings, Finding{
+				Check:    "value-whitespace",
+				Severity: SeverityWarning,
+				Key:      k,
+				Message:  fmt.Sprintf("Value of %s has leading or trailing whitespace", k),
+			})
+		}
+	}
+	return findings
+}
+
+//CheckValueQuotes reports values that literally start and end with the same quote character,
+// which usually means the quotes were meant for a shell and were stored by accident
+func CheckValueQuotes(env *Env) []Finding {
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		v := env.values()[k]
+		if len(v) < 2 || v[0] != v[len(v)-1] || (v[0] != '"' && v[0] != '\'') {
+			continue
+		}
+		findings = append(findings, Finding{
+			Check:    "value-quotes",
+			Severity: SeverityWarning,
+			Key:      k,
+			Message:  fmt.Sprintf("Value of %s is wrapped in %c quotes", k, v[0]),
+		})
+	}
+	return findings
+}
+
+//CheckPlaceholders reports values that look like unresolved ${VAR} or {{var}} template placeholders
+func CheckPlaceholders(env *Env) []Finding {
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		if placeholder := placeholderPattern.FindString(env.values()[k]); placeholder != "" {
+			findings = append(findings, Finding{
+				Check:    "value-placeholder",
+				Severity: SeverityWarning,
+				Key:      k,
+				Message:  fmt.Sprintf("Value of %s contains the unresolved placeholder %s", k, placeholder),
+			})
+		}
+	}
+	return findings
+}
+
+//CheckInvalidUTF8 reports values that are not valid UTF-8, which are usually latin1 written by
+// older tools, see the invalid-utf8 property
+func CheckInvalidUTF8(env *Env) []Finding {
+	findings := []Finding{}
+	for _, k := range env.InvalidUTF8Keys() {
+		findings = append(findings, Finding{
+			Check:    "invalid-utf8",
+			Severity: SeverityWarning,
+			Key:      k,
+			Message:  fmt.Sprintf("Value of %s is not valid UTF-8 from byte %d, it may be latin1", k, firstInvalidUTF8(env.values()[k])),
+		})
+	}
+	return findings
+}
+
+//firstInvalidUTF8 returns the offset of the first byte of value that is not valid UTF-8, or -1
+func firstInvalidUTF8(value string) int {
+	for i, r := range value {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(value[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+//CheckSizeLimits reports values and environments exceeding the given limits.
+// If global is not nil, the total is that of env merged on top of it
+func CheckSizeLimits(env *Env, global *Env, limits Limits) []Finding {
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		if err := limits.CheckValue(k, env.values()[k]); err != nil {
+			findings = append(findings, Finding{
+				Check:    "value-size",
+				Severity: SeverityError,
+				Key:      k,
+				Message:  err.Error(),
+			})
+		}
+	}
+	if err := limits.CheckEnv(env.name, 0, containerEnvSize(global, env)); err != nil {
+		findings = append(findings, Finding{
+			Check:    "env-size",
+			Severity: SeverityError,
+			Message:  err.Error(),
+		})
+	}
+	return findings
+}
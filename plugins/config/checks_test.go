@@ -0,0 +1,19 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFindKeyCollisions(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(FindKeyCollisions([]string{"A", "B"})).To(BeEmpty())
+
+	collisions := FindKeyCollisions([]string{"Database_Url", "OTHER", "DATABASE_URL", "b", "B", "database_url"})
+	Expect(collisions).To(HaveLen(2))
+	Expect(collisions[0].Keys).To(Equal([]string{"B", "b"}))
+	Expect(collisions[1].String()).To(Equal("Keys DATABASE_URL and Database_Url and database_url differ only by case"))
+	Expect(collisions[1].Includes("database_url")).To(BeTrue())
+	Expect(collisions[1].Includes("OTHER")).To(BeFalse())
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+//defaultComposeService is the service the compose format puts the env under by default
+const defaultComposeService = "web"
+
+var composeServicePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+//validateComposeService returns an error if name can't be used as a docker compose service name
+func validateComposeService(name string) error {
+	if !composeServicePattern.MatchString(name) {
+		return &ValidationError{Message: fmt.Sprintf("Invalid compose service name: '%s'", name)}
+	}
+	return nil
+}
+
+//composeString returns a docker compose override setting the environment of a service to this
+// Env, as a list of KEY=value entries or, with ComposeMap, as a mapping of each key to its value
+func (e *Env) composeString(opts ExportOptions) (string, error) {
+	var b strings.Builder
+	if err := e.writeCompose(&b, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+//writeCompose writes the docker compose override returned by composeString to w
+func (e *Env) writeCompose(w textWriter, opts ExportOptions) error {
+	service := opts.ComposeService
+	if service == "" {
+		service = defaultComposeService
+	}
+	if err := validateComposeService(service); err != nil {
+		return err
+	}
+	keys := e.exportKeys(opts)
+
+	w.WriteString("services:\n  " + service + ":\n    environment:")
+	if len(keys) == 0 {
+		if opts.ComposeMap {
+			w.WriteString(" {}\n")
+		} else {
+			w.WriteString(" []\n")
+		}
+		return nil
+	}
+	w.WriteString("\n")
+	for _, k := range keys {
+		if opts.ComposeMap {
+			w.WriteString("      " + k + ": ")
+			writeComposeQuoted(w, e.values()[k])
+		} else {
+			//quoted in two parts, so that a large value is not copied to be prefixed with its key
+			w.WriteString("      - \"")
+			writeComposeEscaped(w, k+"=")
+			writeComposeEscaped(w, e.values()[k])
+			w.WriteByte('"')
+		}
+		w.WriteString("\n")
+	}
+	return nil
+}
+
+//writeComposeQuoted writes the value as a yaml double quoted scalar, which can hold any text
+// whatever its first character, with $ doubled so that compose does not interpolate it
+func writeComposeQuoted(b textWriter, value string) {
+	b.WriteByte('"')
+	writeComposeEscaped(b, value)
+	b.WriteByte('"')
+}
+
+//writeComposeEscaped writes the value escaped as in writeComposeQuoted, without the quotes
+func writeComposeEscaped(b textWriter, value string) {
+	for _, r := range value {
+		switch {
+		case r == '\\':
+			b.WriteString(`\\`)
+		case r == '"':
+			b.WriteString(`\"`)
+		case r == '$':
+			b.WriteString("$$")
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(b, `\x%02x`, r)
+		case (r >= 0x80 && r < 0xa0) || r == 0x2028 || r == 0x2029 || r == 0xfeff:
+			//C1 controls, line and paragraph separators and the byte order mark are not printable yaml
+			fmt.Fprintf(b, `\u%04x`, r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
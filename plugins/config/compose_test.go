@@ -0,0 +1,84 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//parseYAML parses a yaml document with python, returning it as decoded json
+func parseYAML(document string) interface{} {
+	cmd := exec.Command("python3", "-c", "import json, sys, yaml; json.dump(yaml.safe_load(sys.stdin), sys.stdout)")
+	cmd.Stdin = strings.NewReader(document)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	Expect(err).NotTo(HaveOccurred(), stderr.String())
+	var parsed interface{}
+	Expect(json.Unmarshal(out, &parsed)).To(Succeed())
+	return parsed
+}
+
+func TestComposeExport(t *testing.T) {
+	RegisterTestingT(t)
+	if err := exec.Command("python3", "-c", "import yaml").Run(); err != nil {
+		t.Skip("python3 with yaml is not available")
+	}
+	values := pairs(
+		"STAR", "*alias",
+		"BRACE", "{not: a map}",
+		"COLON", "key: value",
+		"COMMENT", "a #comment",
+		"QUOTES", `it's "quoted" \ here`,
+		"DOLLAR", "$HOME and ${PATH} cost $5",
+		"MULTILINE", "line one\nline two\r\n\ttabbed",
+		"CONTROL", "bell\x07 esc\x1b del\x7f",
+		"UNICODE", "caf\u00e9 \u2028 \ufeff \u0085 \u00a0",
+		"BOOL", "yes",
+		"NUMBER", "0123",
+		"EMPTY", "",
+		"DASH", "- item",
+	)
+	env := NewForTest(t, values)
+
+	//compose turns $$ into $ when it interpolates the file
+	unescape := func(v string) string { return strings.Replace(v, "$$", "$", -1) }
+
+	list, err := env.ExportWithOptions(ExportFormatCompose, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	entries := parseYAML(list).(map[string]interface{})["services"].(map[string]interface{})["web"].(map[string]interface{})["environment"].([]interface{})
+	Expect(entries).To(HaveLen(len(values)))
+	for _, entry := range entries {
+		parts := strings.SplitN(unescape(entry.(string)), "=", 2)
+		Expect(parts[1]).To(Equal(values[parts[0]]), parts[0])
+	}
+
+	mapped, err := env.ExportWithOptions(ExportFormatCompose, ExportOptions{ComposeService: "worker.1", ComposeMap: true})
+	Expect(err).NotTo(HaveOccurred())
+	environment := parseYAML(mapped).(map[string]interface{})["services"].(map[string]interface{})["worker.1"].(map[string]interface{})["environment"].(map[string]interface{})
+	Expect(environment).To(HaveLen(len(values)))
+	for k, v := range environment {
+		Expect(unescape(v.(string))).To(Equal(values[k]), k)
+	}
+}
+
+func TestComposeExportLayout(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("B", "2", "A", "$1"))
+	Expect(env.Export(ExportFormatCompose)).To(Equal("services:\n  web:\n    environment:\n      - \"A=$$1\"\n      - \"B=2\"\n"))
+	mapped, err := env.ExportWithOptions(ExportFormatCompose, ExportOptions{ComposeMap: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(mapped).To(Equal("services:\n  web:\n    environment:\n      A: \"$$1\"\n      B: \"2\"\n"))
+
+	empty := NewForTest(t, map[string]string{})
+	Expect(empty.Export(ExportFormatCompose)).To(Equal("services:\n  web:\n    environment: []\n"))
+
+	_, err = env.ExportWithOptions(ExportFormatCompose, ExportOptions{ComposeService: "bad service"})
+	Expect(err).To(MatchError("Invalid compose service name: 'bad service'"))
+	_, err = NewForTest(t, pairs("LATIN1", "caf\xe9")).ExportWithOptions(ExportFormatCompose, ExportOptions{})
+	Expect(err).To(HaveOccurred())
+}
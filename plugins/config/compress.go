@@ -0,0 +1,151 @@
+package config
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//gzipMagic starts every gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+//compressedFile returns where the gzip-compressed form of an ENV file is stored
+func compressedFile(filename string) string {
+	return filename + ".gz"
+}
+
+//envFileOnDisk returns the file holding the contents of an ENV file, which is either the file
+// itself or its compressed form. Should an interrupted migration have left both behind, the one
+// written last is used
+func envFileOnDisk(filename string) (path string, compressed bool) {
+	plain, plainErr := os.Stat(filename)
+	packed, packedErr := os.Stat(compressedFile(filename))
+	if packedErr == nil && (plainErr != nil || packed.ModTime().After(plain.ModTime())) {
+		return compressedFile(filename), true
+	}
+	return filename, false
+}
+
+//readEnvFile reads the contents of an ENV file in whichever form it is stored in
+func readEnvFile(filename string) (contents []byte, compressed bool, err error) {
+	path, _ := envFileOnDisk(filename)
+	return readMaybeCompressed(path)
+}
+
+//readMaybeCompressed reads a file, decompressing it if it holds gzip data whatever its name
+func readMaybeCompressed(path string) (contents []byte, compressed bool, err error) {
+	if contents, err = ioutil.ReadFile(path); err != nil {
+		return nil, false, err
+	}
+	if !bytes.HasPrefix(contents, gzipMagic) {
+		return contents, false, nil
+	}
+	if contents, err = gunzip(contents); err != nil {
+		return nil, false, fmt.Errorf("Unable to decompress %s: %s", path, err.Error())
+	}
+	return contents, true, nil
+}
+
+//writeEnvContents atomically replaces an ENV file with contents, stored compressed if compress is set.
+// The other form is removed once the new one is in place, so that only one of them is left
+func writeEnvContents(filename string, contents []byte, compress bool) error {
+	target, stale := filename, compressedFile(filename)
+	if compress {
+		if fi, err := os.Lstat(filename); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			return fmt.Errorf("Unable to compress %s, it is a symlink", filename)
+		}
+		var err error
+		if contents, err = gzipContents(contents); err != nil {
+			return err
+		}
+		target, stale = stale, target
+	}
+	if err := writeFileAtomic(target, contents, 0600); err != nil {
+		return err
+	}
+	if err := os.Remove(stale); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Unable to remove %s: %s", stale, err.Error())
+	}
+	return nil
+}
+
+//wantsCompression returns whether the env-compression property asks for the ENV file of an app
+// to be stored gzip-compressed
+func wantsCompression(appName string) bool {
+	return getConfigProperty(appName, "env-compression") == "gzip"
+}
+
+//applyEnvCompression stores the ENV file of an app in the form asked for by the env-compression
+// property, keeping its contents byte for byte. For --global the global ENV file and the ENV files
+// of all apps are converted, apps overriding the property keep their own form
+func applyEnvCompression(appName string) error {
+	targets := []string{appName}
+	if appName == "--global" {
+		//no apps is not an error here
+		apps, _ := activeHost.Apps()
+		targets = append(targets, apps...)
+	}
+	for _, target := range targets {
+		if err := convertEnvFile(target, wantsCompression(target)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func convertEnvFile(appName string, compress bool) error {
+	name, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return err
+	}
+	unlock, err := lockEnvFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	contents, compressed, err := readEnvFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if compressed == compress {
+		return nil
+	}
+	if compress {
+		common.LogVerboseQuiet(fmt.Sprintf("Compressing config for %s", name))
+	} else {
+		common.LogVerboseQuiet(fmt.Sprintf("Decompressing config for %s", name))
+	}
+	if err := writeEnvContents(filename, contents, compress); err != nil {
+		return fmt.Errorf("Unable to convert config for %s: %s", name, err.Error())
+	}
+	return nil
+}
+
+func gzipContents(contents []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w := gzip.NewWriter(&b)
+	if _, err := w.Write(contents); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func gunzip(contents []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(contents))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
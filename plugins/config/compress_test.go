@@ -0,0 +1,126 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCompressedEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-compress")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("export A='1'\n"), 0600)).To(Succeed())
+
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.compressed).To(BeFalse())
+	env.SetCompressed(true)
+	Expect(env.Set("B", "two words")).To(Succeed())
+	Expect(env.Write()).To(Succeed())
+
+	_, err = os.Stat(filename)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	packed, err := ioutil.ReadFile(filename + ".gz")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(bytes.HasPrefix(packed, gzipMagic)).To(BeTrue())
+
+	reloaded, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(reloaded.compressed).To(BeTrue())
+	Expect(reloaded.clone().compressed).To(BeTrue())
+	Expect(reloaded.Map()).To(Equal(pairs("A", "1", "B", "two words")))
+	Expect(reloaded.Export(ExportFormatExports)).To(Equal(env.Export(ExportFormatExports)))
+
+	//the form is kept until changed
+	Expect(reloaded.Set("C", "3")).To(Succeed())
+	Expect(reloaded.Write()).To(Succeed())
+	_, err = os.Stat(filename)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	reloaded.SetCompressed(false)
+	Expect(reloaded.Write()).To(Succeed())
+	_, err = os.Stat(filename + ".gz")
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("A=\"1\"\nB=\"two words\"\nC=\"3\"\n"))
+}
+
+func TestCompressedEnvFileDetection(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-compress")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+
+	//gzip data is detected by its magic bytes rather than by name
+	packed, err := gzipContents([]byte("export A='packed'\n"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(filename, packed, 0600)).To(Succeed())
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "packed")))
+	desired, err := LoadEnvFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(desired.Map()).To(Equal(pairs("A", "packed")))
+
+	//an interrupted migration leaves both forms, the one written last wins
+	Expect(ioutil.WriteFile(filename, []byte("export A='plain'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(filename+".gz", packed, 0600)).To(Succeed())
+	past := time.Now().Add(-time.Minute)
+	Expect(os.Chtimes(filename, past, past)).To(Succeed())
+	env, err = loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "packed")))
+	Expect(os.Chtimes(filename+".gz", past.Add(-time.Minute), past.Add(-time.Minute))).To(Succeed())
+	env, err = loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "plain")))
+
+	//a write leaves a single form behind
+	Expect(env.Write()).To(Succeed())
+	_, err = os.Stat(filename + ".gz")
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestEnvCompressionProperty(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	envFile := testAppDir + "/ENV"
+	original := "# keep me\nexport testKey=TESTING\n"
+	Expect(ioutil.WriteFile(envFile, []byte(original), 0600)).To(Succeed())
+
+	Expect(common.PropertyWrite("config", testAppName, "env-compression", "gzip")).To(Succeed())
+	Expect(applyEnvCompression(testAppName)).To(Succeed())
+	_, err := os.Stat(envFile)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	contents, compressed, err := readEnvFile(envFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(compressed).To(BeTrue())
+	Expect(string(contents)).To(Equal(original))
+
+	Expect(SetMany(testAppName, pairs("ADDED", "1"), false)).To(Succeed())
+	Expect(GetWithDefault(testAppName, "ADDED", "")).To(Equal("1"))
+	_, err = os.Stat(envFile)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	Expect(common.PropertyWrite("config", testAppName, "env-compression", "none")).To(Succeed())
+	Expect(applyEnvCompression(testAppName)).To(Succeed())
+	_, err = os.Stat(envFile + ".gz")
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("testKey", "TESTING", "ADDED", "1")))
+}
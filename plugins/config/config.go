@@ -1,16 +1,49 @@
 package config
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/dokku/dokku/plugins/common"
 )
 
+var (
+	// DefaultProperties is a map of all valid config properties with corresponding default property values
+	DefaultProperties = map[string]string{
+		"audit-secrets":         "",
+		"audit-secrets-allow":   "",
+		"config-audit-max-size": "",
+		"config-history-limit":  "",
+		"admin-ssh-names":       "",
+		"config-metadata":       "",
+		"config-reject-empty":   "",
+		"config-restart-policy": "",
+		"env-compression":       "",
+		"env-file-format":       "",
+		"env-file-path":         "",
+		"invalid-utf8":          "",
+		"max-env-size":          "",
+		"max-value-size":        "",
+		"preserve-order":        "",
+		"redacted-public-group": "",
+		"redaction":             "",
+		"release-retention":     "",
+		"strict-key-case":       "",
+		"strict-reserved-keys":  "",
+	}
+)
+
 //Get retrieves a value from a config. If appName is empty the global config is used.
 func Get(appName string, key string) (value string, ok bool) {
-	env, err := loadAppOrGlobalEnv(appName)
+	env, err := loadAppOrGlobalEnvCached(appName)
 	if err != nil {
 		return "", false
 	}
@@ -30,80 +63,418 @@ func GetWithDefault(appName string, key string, defaultValue string) (value stri
 }
 
 //SetMany variables in the environment. If appName is empty the global config is used. If restart is true the app is restarted.
+// Values and the resulting environment are checked against the size limits of the app. A RestartError
+// is returned if the change was written but the app failed to restart
 func SetMany(appName string, entries map[string]string, restart bool) (err error) {
+	return setMany(appName, entries, restartPolicyFor(restart))
+}
+
+//setMany is SetMany with the app restarted according to policy
+func setMany(appName string, entries map[string]string, policy RestartPolicy) (err error) {
 	global := appName == ""
-	env, err := loadAppOrGlobalEnv(appName)
-	if err != nil {
+	keys := make([]string, 0, len(entries))
+	changed := []string{}
+	limits := GetLimits(appName)
+	//sealed values copied from another app are sealed again for this one
+	if entries, err = rewrapSealedEntries(appName, entries); err != nil {
 		return
 	}
-	keys := make([]string, 0, len(entries))
-	for k := range entries {
+	for k, v := range entries {
 		if err = validateKey(k); err != nil {
 			return
 		}
+		if err = validateValue(k, v); err != nil {
+			return
+		}
+		if err = limits.CheckValue(k, v); err != nil {
+			return
+		}
 	}
-	for k, v := range entries {
-		env.Set(k, v)
-		keys = append(keys, k)
+	if err = checkRejectEmpty(appName, entries); err != nil {
+		return
 	}
-	if len(entries) != 0 {
+	var env *Env
+	err = withLockedEnv(appName, func(e *Env) error {
+		env = e
+		//apps receive the global env as well, so the limit applies to the merged size
+		var globalEnv *Env
+		if !global {
+			globalEnv, _ = LoadGlobalCached()
+		}
+		before := containerEnvSize(globalEnv, env)
+		for k, v := range entries {
+			if previous, ok := env.Get(k); !ok || previous != v {
+				changed = append(changed, k)
+			}
+			if err := env.Set(k, v); err != nil {
+				return &ValidationError{Message: fmt.Sprintf("Invalid value for key '%s': %s", k, err.Error())}
+			}
+			keys = append(keys, k)
+		}
+		//a value set for a key replaces its provider, which recordProvenance writes along with the rest
+		env.dropProviders(keys)
+		if len(entries) == 0 {
+			return nil
+		}
+		if err := limits.CheckEnv(env.name, before, containerEnvSize(globalEnv, env)); err != nil {
+			return err
+		}
+		if err := checkKeyCollisions(appName, env, keys); err != nil {
+			return err
+		}
 		common.LogInfo1Quiet("Setting config vars")
 		if os.Getenv("DOKKU_QUIET_OUTPUT") == "" {
 			fmt.Println(prettyPrintEnvEntries("       ", entries))
 		}
-		env.Write()
-		triggerUpdate(appName, "set", keys)
+		if err := env.checkScope(appName); err != nil {
+			return err
+		}
+		if err := env.Write(); err != nil {
+			return err
+		}
+		now := time.Now()
+		if err := recordProvenance(env, changed, now); err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to record who changed the keys: %s", err.Error()))
+		}
+		logAuditEntry(appName, env, changed, nil, skippedRestart(appName, env, policy), now)
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	if len(entries) != 0 {
+		//post-config-update is given the keys in the same order whatever order they were passed in
+		sort.Strings(keys)
+		//endpoints are only notified of the keys whose value changed
+		notified := append([]string{}, changed...)
+		sort.Strings(notified)
+		triggerUpdate(appName, "set", keys, notified)
 	}
-	if !global && restart && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
-		triggerRestart(appName)
+	if !global && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
+		//keys set on an app always take precedence over the global env
+		err = restartWithPolicy(appName, policy, changed, changed)
 	}
 	return
 }
 
-//UnsetMany a value in a config. If appName is empty the global config is used. If restart is true the app is restarted.
+//UnsetMany a value in a config. If appName is empty the global config is used. If restart is true the
+// app is restarted, unless none of the keys were set, and a RestartError returned if it fails to
 func UnsetMany(appName string, keys []string, restart bool) (err error) {
+	_, _, err = unsetMany(appName, keys, restartPolicyFor(restart))
+	return
+}
+
+//unsetMany is UnsetMany with the app restarted according to policy, returning the keys that were
+// removed and those that were not set
+func unsetMany(appName string, keys []string, policy RestartPolicy) (removed []string, absent []string, err error) {
 	global := appName == ""
-	env, err := loadAppOrGlobalEnv(appName)
-	if err != nil {
-		return
-	}
-	var changed = false
 	for _, k := range keys {
 		if err = validateKey(k); err != nil {
 			return
 		}
 	}
-	for _, k := range keys {
-		if _, hasKey := env.Map()[k]; hasKey {
+	//unsetting a key only changes what the app sees if the global env does not hold the same value
+	effective := []string{}
+	globalEnv := &Env{vars: map[string]string{}}
+	if !global {
+		if loaded, err := LoadGlobalCached(); err == nil {
+			globalEnv = loaded
+		}
+	}
+	var env *Env
+	err = withLockedEnv(appName, func(e *Env) error {
+		env = e
+		previous := map[string]string{}
+		for _, k := range keys {
+			if value, ok := env.Get(k); ok {
+				previous[k] = value
+			}
+		}
+		if removed, absent, err = env.UnsetAll(keys); err != nil {
+			return err
+		}
+		//keys given a provider are not set in the file, unsetting them removes their provider instead
+		provided, rest := env.dropProviders(absent)
+		removed, absent = append(removed, provided...), rest
+		for _, k := range removed {
 			common.LogInfo1Quiet(fmt.Sprintf("Unsetting %s", k))
-			env.Unset(k)
-			changed = true
-		} else {
+			if inherited, ok := globalEnv.Get(k); !ok || inherited != previous[k] {
+				effective = append(effective, k)
+			}
+		}
+		for _, k := range absent {
 			common.LogInfo1Quiet(fmt.Sprintf("Skipping %s, it is not set in the environment", k))
 		}
+		if len(removed) == 0 {
+			return nil
+		}
+		if err := env.checkScope(appName); err != nil {
+			return err
+		}
+		if err := env.Write(); err != nil {
+			return err
+		}
+		if err := pruneMetadata(env); err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to remove metadata of unset keys: %s", err.Error()))
+		}
+		logAuditEntry(appName, env, nil, removed, skippedRestart(appName, env, policy), time.Now())
+		return nil
+	})
+	if err != nil || len(removed) == 0 {
+		return
+	}
+	triggerUpdate(appName, "unset", removed, removed)
+	if !global && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
+		err = restartWithPolicy(appName, policy, removed, effective)
+	}
+	return
+}
+
+//GetAndUnset unsets a key of the app or global env, if appName is empty, and returns the value it
+// had, and whether it was set, reading and removing it while holding the lock of the ENV file so
+// that no other caller can read it as well. The post-config-update trigger is fired if the key was
+// set and the app is restarted according to policy. The value is returned along with a RestartError
+// if the key was unset but the restart failed
+func GetAndUnset(appName string, key string, policy RestartPolicy) (value string, existed bool, err error) {
+	if err = validateKey(key); err != nil {
+		return
+	}
+	_, err = Update(appName, policy, func(env *Env) error {
+		var err error
+		value, existed, err = env.Take(key)
+		return err
+	})
+	if _, ok := err.(*RestartError); ok {
+		return
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return
+}
+
+//Update calls fn with the app or global env while holding its lock and writes back whatever fn
+// changed as a single change, checked the same way as SetMany. If appName is empty the global config
+// is used. The post-config-update trigger is fired for the keys that changed and the app is restarted
+// according to policy, returning a RestartError if that fails after the change was written. Nothing
+// is written if fn returns an error or changes nothing
+func Update(appName string, policy RestartPolicy, fn func(env *Env) error) (diff EnvDiff, err error) {
+	global := appName == ""
+	var env, before *Env
+	err = withLockedEnv(appName, func(e *Env) error {
+		env = e
+		before = e.clone()
+		if err := fn(env); err != nil {
+			return err
+		}
+		if diff, err = checkUpdate(appName, before, env); err != nil || diff.Empty() {
+			return err
+		}
+		return writeUpdate(appName, env, diff, policy)
+	})
+	if err != nil || diff.Empty() {
+		return
+	}
+	fireUpdateTriggers(appName, diff)
+	if !global && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
+		err = restartWithPolicy(appName, policy, diff.Keys(), effectiveChanges(before, diff))
+	}
+	return
+}
+
+//effectiveChanges returns the keys of an app changed from before by diff whose change is visible to
+// the app, which are all of them apart from removed keys the global env holds the same value for
+func effectiveChanges(before *Env, diff EnvDiff) []string {
+	effective := diff.updated()
+	globalEnv, err := LoadGlobalCached()
+	for _, k := range diff.Removed {
+		if err == nil {
+			if inherited, ok := globalEnv.Get(k); ok && inherited == before.GetDefault(k, "") {
+				continue
+			}
+		}
+		effective = append(effective, k)
+	}
+	sort.Strings(effective)
+	return effective
+}
+
+//checkUpdate returns what changed from before to env, failing if any of the changed keys or the
+// resulting size of the env is invalid for the app or global env
+func checkUpdate(appName string, before *Env, env *Env) (diff EnvDiff, err error) {
+	diff = Diff(before, env)
+	if diff.Empty() {
+		return
+	}
+	limits := GetLimits(appName)
+	for _, k := range diff.updated() {
+		if err = validateKey(k); err != nil {
+			return
+		}
+		if err = validateValue(k, env.values()[k]); err != nil {
+			return
+		}
+		if err = limits.CheckValue(k, env.values()[k]); err != nil {
+			return
+		}
 	}
-	if changed {
-		env.Write()
-		triggerUpdate(appName, "unset", keys)
+	var globalEnv *Env
+	if appName != "" {
+		globalEnv, _ = LoadGlobalCached()
 	}
-	if !global && restart && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
-		triggerRestart(appName)
+	if err = limits.CheckEnv(env.name, containerEnvSize(globalEnv, before), containerEnvSize(globalEnv, env)); err != nil {
+		return
 	}
+	err = checkKeyCollisions(appName, env, diff.Added)
 	return
 }
 
-func triggerRestart(appName string) {
-	common.LogInfo1(fmt.Sprintf("Restarting app %s", appName))
-	if err := common.PlugnTrigger("app-restart", appName); err != nil {
-		common.LogWarn(fmt.Sprintf("Failure while restarting app: %s", err))
+//writeUpdate writes an env checked by checkUpdate along with the metadata of the keys in diff,
+// refusing one that was not loaded for appName. The audit log records whether the app is restarted
+// after it according to policy
+func writeUpdate(appName string, env *Env, diff EnvDiff, policy RestartPolicy) error {
+	if err := env.checkScope(appName); err != nil {
+		return err
+	}
+	if err := env.Write(); err != nil {
+		return err
+	}
+	now := time.Now()
+	env.dropProviders(diff.updated())
+	if err := recordProvenance(env, diff.updated(), now); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record who changed the keys: %s", err.Error()))
+	}
+	logAuditEntry(appName, env, diff.updated(), diff.Removed, skippedRestart(appName, env, policy), now)
+	if len(diff.Removed) > 0 {
+		if err := pruneMetadata(env); err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to remove metadata of unset keys: %s", err.Error()))
+		}
+	}
+	return nil
+}
+
+//logAuditEntry appends a change to the audit log of env, warning if it cannot be recorded
+func logAuditEntry(appName string, env *Env, set []string, unset []string, restart *AuditRestart, now time.Time) {
+	if err := appendAuditLog(appName, env.filename, set, unset, restart, now); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record the change in the audit log: %s", err.Error()))
+	}
+}
+
+//fireUpdateTriggers fires post-config-update for the keys set and unset by a change
+func fireUpdateTriggers(appName string, diff EnvDiff) {
+	if updated := diff.updated(); len(updated) > 0 {
+		triggerUpdate(appName, "set", updated, updated)
+	}
+	if len(diff.Removed) > 0 {
+		triggerUpdate(appName, "unset", diff.Removed, diff.Removed)
+	}
+}
+
+//MigrateAppEnvFile copies the current ENV file of an app to newPath, verifying the copy by checksum.
+// An empty newPath migrates back to the default location in the app directory
+func MigrateAppEnvFile(appName string, newPath string) error {
+	resolver := NewPathResolver()
+	oldPath, err := resolver.AppFile(appName)
+	if err != nil {
+		return err
+	}
+	if newPath == "" {
+		if newPath, err = resolver.DefaultAppFile(appName); err != nil {
+			return err
+		}
+	} else if err := validateEnvFilePath(newPath); err != nil {
+		return &UnsafePathError{AppName: appName, Path: newPath, Reason: err.Error()}
+	}
+	if filepath.Clean(oldPath) == filepath.Clean(newPath) {
+		return nil
+	}
+
+	//the copy is written uncompressed, and takes the form asked for by env-compression on the next write
+	contents, _, err := readEnvFile(oldPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to read %s: %s", oldPath, err.Error())
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("Refusing to overwrite existing file %s", newPath)
+	}
+
+	common.LogInfo1Quiet(fmt.Sprintf("Migrating %s to %s", oldPath, newPath))
+	if err := os.MkdirAll(filepath.Dir(newPath), 0700); err != nil {
+		return fmt.Errorf("Unable to create %s: %s", filepath.Dir(newPath), err.Error())
+	}
+	if err := writeFileSafe(newPath, contents, writeOptions{mode: 0600, noClobber: true}); os.IsExist(err) {
+		return fmt.Errorf("Refusing to overwrite existing file %s", newPath)
+	} else if err != nil {
+		return fmt.Errorf("Unable to write %s: %s", newPath, err.Error())
+	}
+	copied, err := ioutil.ReadFile(newPath)
+	if err != nil || !bytes.Equal(checksum(copied), checksum(contents)) {
+		os.Remove(newPath)
+		return fmt.Errorf("Checksum mismatch after copying %s to %s", oldPath, newPath)
+	}
+	common.LogVerboseQuiet(fmt.Sprintf("Checksum verified, %s has been left in place", oldPath))
+
+	for _, sidecar := range []func(string) string{metadataFile, provenanceSaltFile} {
+		if contents, err := ioutil.ReadFile(sidecar(oldPath)); err == nil {
+			if err := writeFileAtomic(sidecar(newPath), contents, 0600); err != nil {
+				common.LogWarn(fmt.Sprintf("Unable to copy key metadata: %s", err.Error()))
+			}
+		}
+	}
+	return nil
+}
+
+func checksum(contents []byte) []byte {
+	sum := sha256.Sum256(contents)
+	return sum[:]
+}
+
+//triggerRestart restarts the process types of an app that the changed keys are scoped to,
+// or the whole app if any of them is unscoped. The restart is recorded in the audit log of the app
+// and summed up once it is done, and a RestartError returned if it failed
+func triggerRestart(appName string, keys []string) error {
+	scopes, err := GetRestartScopes(appName)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to read restart scopes, restarting all process types: %s", err.Error()))
 	}
+	plan := PlanRestart(scopes, keys)
+	processTypes := []string{}
+	if plan.Full() {
+		common.LogInfo1Quiet(fmt.Sprintf("Restarting app %s", appName))
+		if len(scopes) > 0 && len(plan.Unscoped) > 0 {
+			common.LogVerboseQuiet(fmt.Sprintf("Not scoped to any process type: %s", strings.Join(plan.Unscoped, ", ")))
+		}
+	} else {
+		common.LogInfo1Quiet(fmt.Sprintf("Restarting process types %s of app %s", strings.Join(plan.ProcessTypes, ", "), appName))
+		sorted := append([]string{}, keys...)
+		sort.Strings(sorted)
+		for _, k := range sorted {
+			common.LogVerboseQuiet(fmt.Sprintf("%s: %s", k, strings.Join(plan.Scoped[k], ", ")))
+		}
+		processTypes = plan.ProcessTypes
+	}
+	startedAt := time.Now()
+	err = activeHost.Restart(appName, processTypes)
+	finishedAt := time.Now()
+	logRestartEntry(appName, newAuditRestart(processTypes, startedAt, finishedAt, err))
+	if err != nil {
+		return &RestartError{AppName: appName, ProcessTypes: processTypes, Duration: finishedAt.Sub(startedAt), Err: err}
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("Restarted %s in %s", restartLabel(appName, processTypes), formatRestartDuration(finishedAt.Sub(startedAt))))
+	return nil
 }
 
-func triggerUpdate(appName string, operation string, args []string) {
-	args = append([]string{appName, operation}, args...)
-	if err := common.PlugnTrigger("post-config-update", args...); err != nil {
+//triggerUpdate fires post-config-update for the keys a change set or unset, and notifies the
+// endpoints of the app of those among them whose value changed
+func triggerUpdate(appName string, operation string, keys []string, changed []string) {
+	args := append([]string{appName, operation}, keys...)
+	if err := activeHost.Trigger("post-config-update", args...); err != nil {
 		common.LogWarn(fmt.Sprintf("Failure while triggering post-config-update: %s", err))
 	}
+	notifyEndpoints(appName, operation, changed)
 }
 
 func loadAppOrGlobalEnv(appName string) (env *Env, err error) {
@@ -113,10 +484,63 @@ func loadAppOrGlobalEnv(appName string) (env *Env, err error) {
 	return LoadAppEnv(appName)
 }
 
+func loadAppOrGlobalEnvCached(appName string) (env *Env, err error) {
+	if appName == "" || appName == "--global" {
+		return LoadGlobalCached()
+	}
+	return LoadAppCached(appName)
+}
+
+//resolveAppOrGlobalFile returns the env name and ENV file path for the app or global env
+func resolveAppOrGlobalFile(appName string) (name string, filename string, err error) {
+	resolver := NewPathResolver()
+	if appName == "" || appName == "--global" {
+		filename, err = resolver.GlobalFile()
+		return "<global>", filename, err
+	}
+	filename, err = resolver.AppFile(appName)
+	return appName, filename, err
+}
+
+//checkKeyCollisions warns about keys that differ only by case from any of the given keys,
+// or fails if the strict-key-case property is enabled
+func checkKeyCollisions(appName string, env *Env, keys []string) error {
+	strict := getBoolProperty(appName, "strict-key-case")
+	for _, collision := range env.KeyCollisions() {
+		for _, k := range keys {
+			if !collision.Includes(k) {
+				continue
+			}
+			if strict {
+				return &ValidationError{Message: fmt.Sprintf("%s, refusing to set %s as strict-key-case is enabled", collision.String(), k)}
+			}
+			common.LogWarn(collision.String())
+			break
+		}
+	}
+	return nil
+}
+
+func validateValue(key string, value string) error {
+	if strings.IndexByte(value, 0) >= 0 {
+		return &ValidationError{Message: fmt.Sprintf("Invalid value for key '%s': %s", key, ErrInvalidValue.Error())}
+	}
+	return nil
+}
+
+//InvalidKeyError is returned for a key that cannot be used as an environment variable name
+type InvalidKeyError struct {
+	Key string
+}
+
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("Invalid key name: '%s'", e.Key)
+}
+
 func validateKey(key string) error {
 	r, _ := regexp.Compile("^[a-zA-Z_][a-zA-Z0-9_]*$")
 	if !r.MatchString(key) {
-		return fmt.Errorf("Invalid key name: '%s'", key)
+		return &InvalidKeyError{Key: key}
 	}
 	return nil
 }
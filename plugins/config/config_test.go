@@ -1,9 +1,11 @@
 package config
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/dokku/dokku/plugins/common"
@@ -34,6 +36,30 @@ func setupTestApp() (err error) {
 
 func teardownTestApp() {
 	os.RemoveAll(testAppDir)
+	removeSidecars(globalConfigFile)
+	templateFile, _ := NewPathResolver().TemplateFile()
+	os.Remove(lockFilePath(templateFile))
+}
+
+//removeSidecars removes the files kept next to an ENV file once it has been written or locked
+func removeSidecars(envFile string) {
+	for _, sidecar := range []string{lockFilePath(envFile), auditLogFile(envFile), metadataFile(envFile), provenanceSaltFile(envFile)} {
+		os.Remove(sidecar)
+	}
+}
+
+func setupTestProperties() (teardown func()) {
+	libRoot, err := ioutil.TempDir("", "dokku-lib-root")
+	Expect(err).NotTo(HaveOccurred())
+	os.Setenv("DOKKU_LIB_ROOT", libRoot)
+	os.Setenv("DOKKU_SYSTEM_USER", "root")
+	os.Setenv("DOKKU_SYSTEM_GROUP", "root")
+	return func() {
+		os.RemoveAll(libRoot)
+		os.Unsetenv("DOKKU_LIB_ROOT")
+		os.Unsetenv("DOKKU_SYSTEM_USER")
+		os.Unsetenv("DOKKU_SYSTEM_GROUP")
+	}
 }
 
 func TestConfigGetWithDefault(t *testing.T) {
@@ -80,6 +106,33 @@ func TestConfigSetMany(t *testing.T) {
 	Expect(SetMany(testAppName+"does_not_exist", vals, false)).ToNot(Succeed())
 }
 
+func TestConfigSetManyConcurrent(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	os.Setenv("DOKKU_QUIET_OUTPUT", "1")
+	defer os.Unsetenv("DOKKU_QUIET_OUTPUT")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- SetMany(testAppName, map[string]string{fmt.Sprintf("concurrentKey%d", i): "set"}, false)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(21))
+}
+
 func TestConfigUnsetMany(t *testing.T) {
 	RegisterTestingT(t)
 	Expect(setupTestApp()).To(Succeed())
@@ -100,6 +153,101 @@ func TestConfigUnsetMany(t *testing.T) {
 	Expect(UnsetMany(testAppName+"does-not-exist", keys, false)).ToNot(Succeed())
 }
 
+func TestUnsetManyReport(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("OTHER", "1"), false)).To(Succeed())
+
+	removed, absent, err := unsetMany(testAppName, []string{"testKey", "noKey", "OTHER"}, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(Equal([]string{"testKey", "OTHER"}))
+	Expect(absent).To(Equal([]string{"noKey"}))
+
+	info, err := os.Stat(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	removed, absent, err = unsetMany(testAppName, []string{"testKey", "OTHER"}, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(BeEmpty())
+	Expect(absent).To(Equal([]string{"testKey", "OTHER"}))
+	after, err := os.Stat(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.SameFile(info, after)).To(BeTrue())
+}
+
+func TestGetAndUnset(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	value, existed, err := GetAndUnset(testAppName, "testKey", RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(existed).To(BeTrue())
+	Expect(value).To(Equal("TESTING"))
+	expectNoValue(testAppName, "testKey")
+
+	//a value is only handed out once
+	value, existed, err = GetAndUnset(testAppName, "testKey", RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(existed).To(BeFalse())
+	Expect(value).To(BeEmpty())
+
+	value, existed, err = GetAndUnset("", "globalKey", RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("GLOBAL_VALUE"))
+	expectNoValue("", "globalKey")
+
+	_, _, err = GetAndUnset(testAppName, "MY KEY", RestartPolicyNever)
+	Expect(err).To(MatchError("Invalid key name: 'MY KEY'"))
+	_, _, err = GetAndUnset(testAppName+"-nonexistent", "testKey", RestartPolicyNever)
+	Expect(err).To(HaveOccurred())
+}
+
+func TestConfigUpdate(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	diff, err := Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		env.Unset("testKey")
+		env.Set("newKey", "NEW")
+		return nil
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(diff).To(Equal(EnvDiff{Added: []string{"newKey"}, Removed: []string{"testKey"}, Changed: []string{}}))
+	expectValue(testAppName, "newKey", "NEW")
+	expectNoValue(testAppName, "testKey")
+
+	//nothing is written if fn fails or sets an invalid key
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		env.Set("newKey", "CHANGED")
+		return fmt.Errorf("failed")
+	})
+	Expect(err).To(MatchError("failed"))
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		env.Set("newKey", "CHANGED")
+		env.Set("invalid-key", "value")
+		return nil
+	})
+	_, ok := err.(*InvalidKeyError)
+	Expect(ok).To(BeTrue())
+	expectValue(testAppName, "newKey", "NEW")
+
+	diff, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		return env.Set("newKey", "NEW")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(diff.Empty()).To(BeTrue())
+
+	//values swapped in are checked like those set
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		env.Swap("newKey", "a\x00b")
+		return nil
+	})
+	Expect(err).To(MatchError("Invalid value for key 'newKey': " + ErrInvalidValue.Error()))
+	expectValue(testAppName, "newKey", "NEW")
+}
+
 func TestEnvironmentLoading(t *testing.T) {
 	RegisterTestingT(t)
 	Expect(setupTestApp()).To(Succeed())
@@ -166,6 +314,114 @@ func TestInvalidEnvOnDisk(t *testing.T) {
 
 }
 
+func TestRelocatedAppEnv(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	secureDir, err := ioutil.TempDir("", "dokku-secure")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(secureDir)
+	relocatedFile := strings.Join([]string{secureDir, testAppName, "ENV"}, "/")
+
+	Expect(MigrateAppEnvFile(testAppName, relocatedFile)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "env-file-path", relocatedFile)).To(Succeed())
+	expectValue(testAppName, "testKey", "TESTING")
+
+	Expect(SetMany(testAppName, map[string]string{"testKey": "relocated"}, false)).To(Succeed())
+	expectValue(testAppName, "testKey", "relocated")
+	content, err := ioutil.ReadFile(relocatedFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(ContainSubstring("relocated"))
+	content, err = ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).NotTo(ContainSubstring("relocated"))
+
+	Expect(MigrateAppEnvFile(testAppName, relocatedFile)).To(Succeed())
+	Expect(MigrateAppEnvFile(testAppName, "")).NotTo(Succeed())
+}
+
+func TestAppFileTraversal(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	resolver := NewPathResolver(WithRoot(dokkuRoot))
+	for _, appName := range []string{"..", ".", "test-app-1/../..", "/etc", "a/b", "test-app-1\\..", "a\x00b"} {
+		_, err := resolver.AppFile(appName)
+		_, ok := err.(*UnsafePathError)
+		Expect(ok).To(BeTrue(), appName)
+		_, err = resolver.DefaultAppFile(appName)
+		_, ok = err.(*UnsafePathError)
+		Expect(ok).To(BeTrue(), appName)
+	}
+	_, err := LoadAppEnv("test-app-1/../..")
+	Expect(err).To(MatchError(HavePrefix("Refusing to use")))
+
+	//an app directory may be a symlink, as long as the name itself stays inside the root
+	outsideDir, err := ioutil.TempDir("", "dokku-outside")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(outsideDir)
+	linkedApp := dokkuRoot + "/linked-app"
+	Expect(os.Symlink(outsideDir, linkedApp)).To(Succeed())
+	defer os.Remove(linkedApp)
+	filename, err := resolver.AppFile("linked-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(filename).To(Equal(linkedApp + "/ENV"))
+
+	//a file where the directory of an app should be says so
+	Expect(ioutil.WriteFile(dokkuRoot+"/file-app", []byte{}, 0600)).To(Succeed())
+	defer os.Remove(dokkuRoot + "/file-app")
+	_, err = resolver.AppFile("file-app")
+	_, ok := err.(*AppNotFoundError)
+	Expect(ok).To(BeTrue())
+	Expect(err).To(MatchError(fmt.Sprintf("app file-app does not exist: %s/file-app is not a directory", dokkuRoot)))
+
+	for _, envFile := range []string{"relative/ENV", "/secure/../etc/ENV", "/secure/..", "/secure/a\x00b"} {
+		Expect(common.PropertyWrite("config", testAppName, "env-file-path", envFile)).To(Succeed())
+		_, err := NewPathResolver().AppFile(testAppName)
+		_, ok := err.(*UnsafePathError)
+		Expect(ok).To(BeTrue(), envFile)
+		Expect(MigrateAppEnvFile(testAppName, "")).NotTo(Succeed())
+	}
+	Expect(common.PropertyWrite("config", testAppName, "env-file-path", "")).To(Succeed())
+	Expect(MigrateAppEnvFile(testAppName, "/secure/../etc/ENV")).To(MatchError(HavePrefix("Refusing to use")))
+	Expect(MigrateAppEnvFile(testAppName, "relative/ENV")).To(MatchError(HavePrefix("Refusing to use")))
+}
+
+func TestRelocatedGlobalEnv(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	envDir, err := ioutil.TempDir("", "dokku-env-dir")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(envDir)
+	Expect(ioutil.WriteFile(envDir+"/ENV", []byte("export testKey=RELOCATED_GLOBAL\n"), 0600)).To(Succeed())
+	os.Setenv("DOKKU_ENV_DIR", envDir)
+	defer os.Unsetenv("DOKKU_ENV_DIR")
+
+	expectValue("", "testKey", "RELOCATED_GLOBAL")
+	expectNoValue("", "globalKey")
+
+	env, err := LoadGlobalEnv(WithRoot(dokkuRoot))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("testKey", "")).To(Equal("GLOBAL_TESTING"))
+
+	//a relative DOKKU_ENV_DIR would mean something else depending on where it is resolved from
+	for _, envDir := range []string{"relative", envDir + "/../..", "/secure/.."} {
+		os.Setenv("DOKKU_ENV_DIR", envDir)
+		_, err := NewPathResolver().GlobalFile()
+		_, ok := err.(*UnsafePathError)
+		Expect(ok).To(BeTrue(), envDir)
+		_, err = LoadGlobalEnv()
+		Expect(err).To(MatchError(HavePrefix("Refusing to use " + envDir + " for the global ENV file: DOKKU_ENV_DIR must")))
+	}
+	Expect(validateAbsolutePath("DOKKU_ENV_DIR", "/secure/a\x00b")).To(MatchError("DOKKU_ENV_DIR must not contain a NUL byte"))
+}
+
 func expectValue(appName string, key string, expected string) {
 	v, ok := Get(appName, key)
 	Expect(ok).To(Equal(true))
@@ -176,3 +432,92 @@ func expectNoValue(appName string, key string) {
 	_, ok := Get(appName, key)
 	Expect(ok).To(Equal(false))
 }
+
+func TestLoadWithRoot(t *testing.T) {
+	RegisterTestingT(t)
+	root, err := ioutil.TempDir("", "dokku-root")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+
+	Expect(os.MkdirAll(root+"/other-app", 0766)).To(Succeed())
+	Expect(ioutil.WriteFile(root+"/other-app/ENV", []byte("export otherKey=OTHER\n"), 0644)).To(Succeed())
+	Expect(ioutil.WriteFile(root+"/ENV", []byte("export globalKey=OTHER_GLOBAL\n"), 0644)).To(Succeed())
+
+	env, err := LoadMergedAppEnv("other-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("otherKey", "OTHER", "globalKey", "OTHER_GLOBAL")))
+
+	_, err = LoadAppEnv(testAppName, WithRoot(root))
+	Expect(err).To(HaveOccurred())
+}
+
+func TestLoadWithoutDokkuRoot(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(os.Unsetenv("DOKKU_ROOT")).To(Succeed())
+	defer os.Setenv("DOKKU_ROOT", dokkuRoot)
+
+	_, err := LoadAppEnv(testAppName)
+	Expect(err).To(Equal(ErrDokkuRootNotSet))
+	_, err = LoadGlobalEnv()
+	Expect(err).To(Equal(ErrDokkuRootNotSet))
+	_, err = LoadMergedAppEnv(testAppName)
+	Expect(err).To(Equal(ErrDokkuRootNotSet))
+	Expect(GetWithDefault(testAppName, "testKey", "default")).To(Equal("default"))
+}
+
+func TestConfigSetManyLimits(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(common.PropertyWrite("config", testAppName, "max-value-size", "8")).To(Succeed())
+	err := SetMany(testAppName, pairs("bigKey", "123456789"), false)
+	Expect(err).To(MatchError("Value of bigKey is 9 bytes, exceeding the maximum value size of 8 bytes"))
+	expectNoValue(testAppName, "bigKey")
+	Expect(SetMany(testAppName, pairs("smallKey", "12345678"), false)).To(Succeed())
+
+	//the merged env is testKey=TESTING, globalKey=GLOBAL_VALUE and smallKey=12345678
+	Expect(common.PropertyWrite("config", "--global", "max-env-size", "64")).To(Succeed())
+	Expect(GetLimits(testAppName)).To(Equal(Limits{MaxValueSize: 8, MaxEnvSize: 64}))
+	err = SetMany(testAppName, pairs("otherKey", "12345678"), false)
+	Expect(err).To(MatchError(ContainSubstring("exceeding the maximum env size of 64 bytes")))
+
+	//an env that is already over the limit still loads and can be shrunk
+	Expect(common.PropertyWrite("config", testAppName, "max-env-size", "16")).To(Succeed())
+	expectValue(testAppName, "smallKey", "12345678")
+	Expect(SetMany(testAppName, pairs("smallKey", "1"), false)).To(Succeed())
+	expectValue(testAppName, "smallKey", "1")
+}
+
+func TestConfigSetManyInvalidValues(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	err := SetMany(testAppName, pairs("nulKey", "a\x00b"), false)
+	Expect(err).To(MatchError("Invalid value for key 'nulKey': value contains a NUL byte"))
+	expectNoValue(testAppName, "nulKey")
+
+	//existing files with invalid UTF-8 still load with their bytes intact
+	Expect(ioutil.WriteFile(testAppDir+"/ENV", []byte("export latin1Key='caf\xe9'\n"), 0644)).To(Succeed())
+	expectValue(testAppName, "latin1Key", "caf\xe9")
+}
+
+func TestConfigSetManyKeyCollisions(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(SetMany(testAppName, pairs("TESTKEY", "upper"), false)).To(Succeed())
+	expectValue(testAppName, "TESTKEY", "upper")
+
+	Expect(common.PropertyWrite("config", testAppName, "strict-key-case", "true")).To(Succeed())
+	err := SetMany(testAppName, pairs("TestKey", "mixed"), false)
+	Expect(err).To(MatchError("Keys TESTKEY and TestKey and testKey differ only by case, refusing to set TestKey as strict-key-case is enabled"))
+	expectNoValue(testAppName, "TestKey")
+
+	//unrelated keys can still be set while a collision exists
+	Expect(SetMany(testAppName, pairs("otherKey", "value"), false)).To(Succeed())
+}
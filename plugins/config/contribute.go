@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//contributeEnvTrigger is fired in each plugin for the defaults it contributes to the env of an app
+const contributeEnvTrigger = "config-contribute-env"
+
+//contributedLayer fires the config-contribute-env trigger in each plugin implementing it, and puts
+// what they print, as envfiles, together into the layer of the lowest precedence of the env of an
+// app. The values are never written to an ENV file. A key contributed by more than one plugin takes
+// the value of the first of them in order of plugin name, with a warning if the others disagree
+func contributedLayer(appName string, procType string, phase string) (effectiveLayer, error) {
+	layer := effectiveLayer{name: LayerContributed, sources: map[string]string{}}
+	outputs, err := activeHost.TriggerEach(contributeEnvTrigger, appName, procType, phase)
+	if err != nil {
+		return layer, err
+	}
+	if layer.env, err = NewFromStringWithName(appName, ""); err != nil {
+		return layer, err
+	}
+	for _, output := range outputs {
+		contributed, err := NewFromStringWithName(fmt.Sprintf("the env contributed by %s", output.Plugin), output.Stdout)
+		if err != nil {
+			return layer, err
+		}
+		for _, k := range contributed.OrderedKeys() {
+			if err := validateKey(k); err != nil {
+				return layer, fmt.Errorf("Invalid key contributed by %s: %s", output.Plugin, err.Error())
+			}
+			value := contributed.values()[k]
+			if plugin, ok := layer.sources[k]; ok {
+				if layer.env.values()[k] != value {
+					common.LogWarn(fmt.Sprintf("%s is contributed by both %s and %s, the value of %s is used", k, plugin, output.Plugin, plugin))
+				}
+				continue
+			}
+			if err := layer.env.Set(k, value); err != nil {
+				return layer, err
+			}
+			layer.sources[k] = output.Plugin
+		}
+	}
+	layer.env.readOnly = true
+	return layer, nil
+}
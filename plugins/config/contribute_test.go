@@ -0,0 +1,68 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestContributedEnv(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	host.contributed = map[string]string{
+		"postgres":     "DATABASE_POOL=5\nSHARED=from-postgres\n",
+		"nginx-vhosts": "NGINX_PORT=8080\nSHARED=from-nginx\nKEY=contributed\n",
+	}
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	var effective *EffectiveEnv
+	var err error
+	stderr := captureStderr(func() {
+		effective, err = ResolveEffectiveEnv("web-app", "web", SchedulerPhaseDeploy)
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.triggers).To(Equal([]string{
+		"nginx-vhosts config-contribute-env web-app web deploy",
+		"postgres config-contribute-env web-app web deploy",
+	}))
+
+	//the first plugin in order of name wins, and every ENV file takes precedence over plugins
+	Expect(stderr).To(ContainSubstring("SHARED is contributed by both nginx-vhosts and postgres, the value of nginx-vhosts is used"))
+	Expect(effective.Env.Map()).To(Equal(pairs(
+		"KEY", "web-app",
+		"NGINX_PORT", "8080",
+		"SHARED", "from-nginx",
+		"DATABASE_POOL", "5",
+	)))
+	Expect(effective.Chain("SHARED")).To(Equal([]LayerValue{{Layer: LayerContributed, Plugin: "nginx-vhosts", Value: "from-nginx"}}))
+	chain := effective.Chain("KEY")
+	Expect(chain).To(HaveLen(3))
+	Expect(chain[0]).To(Equal(LayerValue{Layer: LayerContributed, Plugin: "nginx-vhosts", Value: "contributed"}))
+	Expect(chain[1].Layer).To(Equal(LayerGlobal))
+	Expect(storedChain(chain)).To(Equal(chain[1:]))
+
+	//contributions are never written, and setting a key globally overrides them
+	env, err := LoadAppEnv("web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("KEY", "web-app")))
+	var impacts []GlobalImpact
+	captureStderr(func() {
+		impacts, err = PreviewGlobalSet(pairs("NGINX_PORT", "80"))
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(impacts).To(Equal([]GlobalImpact{{App: "web-app", Key: "NGINX_PORT", Effect: GlobalEffectInherited}}))
+
+	//the global env alone gets no contributions
+	host.triggers = nil
+	global, err := ResolveEffectiveEnv("", "", SchedulerPhaseDeploy)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Env.Map()).To(Equal(pairs("KEY", "global")))
+	Expect(host.triggers).To(BeEmpty())
+
+	host.contributed = map[string]string{"broken": "not a key=1\n"}
+	_, err = ResolveEffectiveEnv("web-app", "web", SchedulerPhaseDeploy)
+	Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,145 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//EnvDiff lists the keys that differ between two environments
+type EnvDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+//Empty reports whether both environments have the same keys and values
+func (d EnvDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+//Keys returns every key that was added, removed or changed, sorted
+func (d EnvDiff) Keys() []string {
+	keys := append(d.updated(), d.Removed...)
+	sort.Strings(keys)
+	return keys
+}
+
+//updated returns the keys that were added or changed
+func (d EnvDiff) updated() []string {
+	keys := make([]string, 0, len(d.Added)+len(d.Changed))
+	keys = append(keys, d.Added...)
+	return append(keys, d.Changed...)
+}
+
+//Diff returns the keys added, removed and changed going from one environment to another
+func Diff(from *Env, to *Env) EnvDiff {
+	return diffMaps(from.values(), to.values())
+}
+
+//diffMaps compares two maps of keys to values, or to anything that changes with the value
+func diffMaps(from map[string]string, to map[string]string) EnvDiff {
+	diff := EnvDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}
+	for k, v := range to {
+		previous, ok := from[k]
+		if !ok {
+			diff.Added = append(diff.Added, k)
+		} else if previous != v {
+			diff.Changed = append(diff.Changed, k)
+		}
+	}
+	for k := range from {
+		if _, ok := to[k]; !ok {
+			diff.Removed = append(diff.Removed, k)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
+
+//Kinds of keys in an EnvDiff, as named in a DiffReport and selected with --fail-on
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+//DiffReport is an EnvDiff in the form config:diff and config:drift print with --format json. Its
+// fields are always present, and values are only included if asked for, see NewDiffReport
+type DiffReport struct {
+	Added   map[string]AddedValue   `json:"added"`
+	Removed []string                `json:"removed"`
+	Changed map[string]ChangedValue `json:"changed"`
+}
+
+//AddedValue is the value of a key in a DiffReport that only the second environment sets
+type AddedValue struct {
+	Checksum string  `json:"checksum"`
+	Value    *string `json:"value,omitempty"`
+}
+
+//ChangedValue is the value of a key in a DiffReport that the environments set to different values
+type ChangedValue struct {
+	OldChecksum string  `json:"old_checksum"`
+	NewChecksum string  `json:"new_checksum"`
+	OldValue    *string `json:"old_value,omitempty"`
+	NewValue    *string `json:"new_value,omitempty"`
+}
+
+//NewDiffReport describes diff, the keys that differ going from one environment to another. Each
+// value is given as its checksum, see ValueChecksum, and only as itself as well if showValues is set
+func NewDiffReport(from *Env, to *Env, diff EnvDiff, showValues bool) DiffReport {
+	report := DiffReport{
+		Added:   make(map[string]AddedValue, len(diff.Added)),
+		Removed: append([]string{}, diff.Removed...),
+		Changed: make(map[string]ChangedValue, len(diff.Changed)),
+	}
+	for _, k := range diff.Added {
+		added := AddedValue{Checksum: ValueChecksum(to.values()[k])}
+		if showValues {
+			value := to.values()[k]
+			added.Value = &value
+		}
+		report.Added[k] = added
+	}
+	for _, k := range diff.Changed {
+		changed := ChangedValue{OldChecksum: ValueChecksum(from.values()[k]), NewChecksum: ValueChecksum(to.values()[k])}
+		if showValues {
+			oldValue, newValue := from.values()[k], to.values()[k]
+			changed.OldValue, changed.NewValue = &oldValue, &newValue
+		}
+		report.Changed[k] = changed
+	}
+	return report
+}
+
+//ValueChecksum returns the sha256 of a value, which tells whether two values are the same without
+// showing either. It is not keyed, so a value that is easily guessed can be found from its checksum
+func ValueChecksum(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+//ParseDiffKinds parses a comma-separated list of the kinds of keys in an EnvDiff, see DiffAdded
+func ParseDiffKinds(value string) (map[string]bool, error) {
+	kinds := map[string]bool{}
+	for _, kind := range strings.Split(value, ",") {
+		kind = strings.TrimSpace(kind)
+		switch kind {
+		case DiffAdded, DiffRemoved, DiffChanged:
+			kinds[kind] = true
+		default:
+			return nil, &ValidationError{Message: fmt.Sprintf("Unknown kind of change '%s', expected a list of %s, %s and %s", kind, DiffAdded, DiffRemoved, DiffChanged)}
+		}
+	}
+	return kinds, nil
+}
+
+//Has reports whether any key was added, removed or changed, counting only the given kinds
+func (d EnvDiff) Has(kinds map[string]bool) bool {
+	return (kinds[DiffAdded] && len(d.Added) > 0) || (kinds[DiffRemoved] && len(d.Removed) > 0) || (kinds[DiffChanged] && len(d.Changed) > 0)
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseDiffKinds(t *testing.T) {
+	RegisterTestingT(t)
+	kinds, err := ParseDiffKinds("added, changed")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(kinds).To(Equal(map[string]bool{DiffAdded: true, DiffChanged: true}))
+
+	_, err = ParseDiffKinds("added,moved")
+	Expect(err).To(MatchError("Unknown kind of change 'moved', expected a list of added, removed and changed"))
+	_, err = ParseDiffKinds("")
+	Expect(err).To(HaveOccurred())
+
+	diff := EnvDiff{Added: []string{}, Removed: []string{"GONE"}, Changed: []string{}}
+	Expect(diff.Has(map[string]bool{DiffAdded: true, DiffChanged: true})).To(BeFalse())
+	Expect(diff.Has(map[string]bool{DiffRemoved: true})).To(BeTrue())
+}
+
+func TestRunSubcommandDiffFormats(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost()
+	defer teardown()
+	from := filepath.Join("testdata", "diff.from.env")
+	to := filepath.Join("testdata", "diff.to.env")
+
+	output, err := runSubcommand(host, "diff", "--format", "json", "--file", from, "--file", to)
+	Expect(err).To(Equal(&SubcommandError{Code: 1}))
+	Expect(output).To(HavePrefix(`{"added":{"DATABASE_POOL":{"checksum":"`))
+	Expect(output).To(ContainSubstring(`"removed":["GONE"]`))
+	Expect(output).NotTo(ContainSubstring("s3cret"))
+
+	output, err = runSubcommand(host, "diff", "--format", "json", "--show-values", "--file", from, "--file", to)
+	Expect(err).To(Equal(&SubcommandError{Code: 1}))
+	Expect(output).To(ContainSubstring(`"old_value":"s3cret","new_value":"rotated"`))
+
+	//only the kinds given with --fail-on set the exit status
+	output, err = runSubcommand(host, "diff", "--fail-on", "removed", "--file", from, "--file", to)
+	Expect(err).To(Equal(&SubcommandError{Code: 1}))
+	Expect(output).To(ContainSubstring("removed:  GONE"))
+	grown := filepath.Join(host.root, "grown.env")
+	Expect(ioutil.WriteFile(grown, []byte("KEPT=same\nGONE=old\nSECRET_KEY=s3cret\nEMPTY=\nEXTRA=1\n"), 0600)).To(Succeed())
+	output, err = runSubcommand(host, "diff", "--fail-on", "removed,changed", "--file", from, "--file", grown)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("added:  EXTRA"))
+
+	for _, tc := range []struct {
+		argv     []string
+		expected SubcommandError
+	}{
+		{[]string{"--format", "yaml", "--file", from, "--file", to}, SubcommandError{Code: 2, Message: "Unknown format: yaml"}},
+		{[]string{"--show-values", "--file", from, "--file", to}, SubcommandError{Code: 2, Message: "--show-values only applies to --format json"}},
+		{[]string{"--fail-on", "all", "--file", from, "--file", to}, SubcommandError{Code: 2, Message: "Unknown kind of change 'all', expected a list of added, removed and changed"}},
+	} {
+		_, err := runSubcommand(host, "diff", tc.argv...)
+		Expect(err).To(Equal(&tc.expected), tc.argv[1])
+	}
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+//displayValueMaxSize is the size in bytes above which a value is shown to people truncated, such
+// as by the listing of config:show. config:get and the exports always give whole values
+const displayValueMaxSize = 4096
+
+//displayValuePrefixSize is how much of the start of a truncated value is shown
+const displayValuePrefixSize = 64
+
+//truncateForDisplay returns the value as is if it is at most displayValueMaxSize bytes, or its
+// first line cut to displayValuePrefixSize bytes followed by a marker giving its size otherwise
+func truncateForDisplay(value string) string {
+	if len(value) <= displayValueMaxSize {
+		return value
+	}
+	end := displayValuePrefixSize
+	for end > 0 && !utf8.RuneStart(value[end]) {
+		end--
+	}
+	prefix := value[:end]
+	if i := strings.IndexByte(prefix, '\n'); i >= 0 {
+		prefix = prefix[:i]
+	}
+	return fmt.Sprintf("%s... (%s, truncated — use config:get --raw)", prefix, formatDisplaySize(len(value)))
+}
+
+//formatDisplaySize returns a size in bytes the way it is shown to people, such as 5.2MB
+func formatDisplaySize(size int) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1fMB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1fKB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%dB", size)
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTruncateForDisplay(t *testing.T) {
+	RegisterTestingT(t)
+	fits := strings.Repeat("x", displayValueMaxSize)
+	Expect(truncateForDisplay(fits)).To(Equal(fits))
+	Expect(displayValue(fits)).To(Equal(fits))
+
+	blob := `{"name": "` + strings.Repeat("é", 2600000) + `"}`
+	Expect(displayValue(blob)).To(Equal(`{"name": "` + strings.Repeat("é", 27) + `... (5.0MB, truncated — use config:get --raw)`))
+	Expect(truncateForDisplay("first line\n" + fits)).To(Equal("first line... (4.0KB, truncated — use config:get --raw)"))
+
+	Expect(formatDisplaySize(512)).To(Equal("512B"))
+	Expect(formatDisplaySize(5452595)).To(Equal("5.2MB"))
+
+	//the listing shows the value truncated, while config:get gives it whole
+	env := NewForTest(t, pairs("BLOB", blob, "SMALL", "value"))
+	pretty := env.Export(ExportFormatPretty)
+	Expect(pretty).To(ContainSubstring("(5.0MB, truncated — use config:get --raw)"))
+	Expect(len(pretty)).To(BeNumerically("<", 200))
+	Expect(env.GetDefault("BLOB", "")).To(Equal(blob))
+	Expect(prettyPrintWithMetadata(env, map[string]KeyMetadata{"BLOB": {Description: "large"}})).To(ContainSubstring("truncated"))
+}
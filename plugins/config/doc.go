@@ -0,0 +1,59 @@
+/*
+Package config reads and writes the global and app environments of dokku.
+
+It is imported by the config plugin itself as well as by other plugins, including third-party
+Go plugins, which may rely on the following API remaining compatible:
+
+	Loading:    LoadAppEnv, LoadMergedAppEnv, LoadGlobalEnv, GlobalExists, WithRoot, WithFile, Get, GetWithDefault,
+	            GetAppBool, NewFromStringWithName, NewFromJSON, NewFromDockerEnvFile, ResolveSchedulerEnv,
+	            ComputeContainerEnv, ResolveEffectiveEnv, EffectiveEnv, LayerValue, ResolveReference, ReferenceStep,
+	            EffectiveEnv.Formats, SourceFormat, WithInvalidUTF8, InvalidUTF8Policy, ParseInvalidUTF8Policy,
+	            TranscodeEnvFile
+	Reading:    Env.Name, Env.Get, Env.GetDefault, Env.GetFirst, Env.GetBoolDefault, Env.Keys, Env.OrderedKeys,
+	            Env.Len, Env.Map, Env.EntriesSorted, Env.Environ, Env.FormatVersion, Env.Filter, Env.InvalidUTF8Keys,
+	            Env.ResolveReferences, Env.Warnings, ParseWarning, Env.Scope, Scope, ScopeKind
+	Sharing:    Env.Synchronized, SyncEnv, Env.Reload, WatchApp, WatchOption, Env.ReadOnly,
+	            Env.IsReadOnly
+	Changing:   SetMany, UnsetMany, Update, GetAndUnset, SealMany, Unseal, WithLockedTargets, MigrateEnvFile,
+	            EnvFormatVersion, ConvertEnvFile, EnvFileFormat, ParseEnvFileFormat, Env.SetFileFormat, Env.FileFormat,
+	            LoadPluginConfig, UpdatePluginConfig,
+	            Env.Set, Env.Unset, Env.Swap, Env.Take,
+	            Env.MergeWith, MergeStrategy, MergeResult, MergeConflictError, Env.Conflicts,
+	            Env.WithPrefix, EnvView, Env.PromoteKey, KeyExistsError
+	Comparing:  Diff, EnvDiff, EnvDiff.Has, ParseDiffKinds, NewDiffReport, DiffReport, ValueChecksum,
+	            Env.Checksum, Env.CompareValue, GetPendingRestart, PendingRestart, LoadRedactedSnapshot,
+	            RedactedSnapshot, PreviewGlobalSet, GlobalImpact, GlobalEffect, IntrospectConfig,
+	            ConfigIntrospection, ConfigIntrospection.JSON, IntrospectionMaxSize
+	Formatting: Env.Export, Env.ExportWithOptions, Env.ExportTo, ExportFormat, ExportOptions,
+	            Env.ExportBundle, Env.ExportBundleWithOptions, BundleOptions, DefaultBundleEnvfileEntry,
+	            Env.FormatWith, FormatOptions, Env.DockerEnvFileString, NestedValueKey,
+	            StreamFormatter, QuoteStyle, SingleQuoteEscape, DoubleQuoteEscape, VerifyShellExport,
+	            KeyTransform, KeyCase, ParseKeyCase, GuardExport, VerifyGuardedExport, GuardedExportVersion
+	Errors:     AppNotFoundError, InvalidKeyError, UnsafePathError, ErrInvalidValue,
+	            ErrDokkuRootNotSet, ErrReadOnlyEnv, ValidationError, LockError, ShellVerifyError,
+	            ProviderError, RestartError, SealedError, ErrScopeMismatch
+	Exiting:    ExitStatusKeyNotSet, ExitStatusInvalid, ExitStatusLocked, ExitStatusNotWritable,
+	            ExitStatusConflict, ExitStatusUnchanged, ExitStatusPending, ExitStatusRestartFailed,
+	            ExitStatusAppNotFound
+
+Functions in this list return errors rather than exiting the process, and load from DOKKU_ROOT
+or from the root given with WithRoot. Envs loaded WithFile are read from that file alone, such as
+a copy restored from a backup, and are read-only. Changes made through SetMany, UnsetMany and Update hold
+the lock of the ENV file while it is read, modified and written, and fire the post-config-update
+trigger just like config:set and config:unset. WithLockedTargets does the same for several envs at
+once, always locking the global env before those of apps and the apps in order of their names.
+Env.Set and Env.Unset only change an Env in memory, and Env.Write replaces its file without
+locking or firing triggers.
+
+An Env is not safe for concurrent use, not even for reading, as it caches its sorted keys and
+metadata on first use. Plugins that share an Env between goroutines should wrap it with
+Env.Synchronized, whose methods, including Reload, may be called concurrently. Only the SyncEnv
+must be used from then on; the wrapped Env and any map returned by Env.Map are not protected.
+SyncEnv.Map and SyncEnv.Snapshot return copies that the caller owns.
+
+The Command and Trigger functions implement the config plugin and are not part of this API.
+Neither are RunSubcommand and Host, which run the show, keys, get, export, bundle, diff, set and
+unset subcommands against a dokku install other than the one the plugin runs on, so that they can
+be tested without one.
+*/
+package config
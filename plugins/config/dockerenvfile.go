@@ -0,0 +1,137 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Categories of the ParseWarnings found while reading a docker env-file
+const (
+	//ParseWarningPassthrough is a line holding a key without a value, which docker fills in from the
+	// environment of the docker client. That environment is not known to dokku, so the key is skipped
+	ParseWarningPassthrough = "passthrough"
+	//ParseWarningQuotedValue is a value wrapped in quotes, which docker keeps as part of the value
+	ParseWarningQuotedValue = "quoted-value"
+)
+
+//utf8BOM is stripped from the start of a docker env-file, as docker does
+const utf8BOM = "\xef\xbb\xbf"
+
+//dockerEnvFileWhitespace is the whitespace docker trims from keys and refuses inside them
+const dockerEnvFileWhitespace = " \t"
+
+//DockerEnvFileString returns the contents of this Env in the format read by docker run --env-file,
+// with its keys sorted. Unlike an ENVFILE, docker takes everything after the first = of a line as
+// the value, without unquoting or unescaping it, so values are written as they are. Values holding
+// a newline, ending with a carriage return or that are not valid UTF-8 cannot be written this way;
+// their keys are left out and returned as warnings
+func (e *Env) DockerEnvFileString() (string, []string) {
+	return e.dockerEnvFileString(e.sortKeys())
+}
+
+//dockerEnvFileString is DockerEnvFileString for the given keys, in the order given
+func (e *Env) dockerEnvFileString(keys []string) (string, []string) {
+	lines := make([]string, 0, len(keys))
+	warnings := []string{}
+	for _, k := range keys {
+		if reason := dockerEnvFileIncompatibility(e.values()[k]); reason != "" {
+			warnings = append(warnings, fmt.Sprintf("%s is left out, docker env-files cannot hold a value %s", k, reason))
+			continue
+		}
+		lines = append(lines, k+"="+e.values()[k])
+	}
+	return strings.Join(lines, "\n"), warnings
+}
+
+//dockerEnvFileIncompatibility returns why a value cannot be read back from a docker env-file, or
+// an empty string if it can. Docker reads the file line by line, dropping the \r of a \r\n line
+// ending, and refuses files that are not valid UTF-8
+func dockerEnvFileIncompatibility(value string) string {
+	switch {
+	case strings.Contains(value, "\n"):
+		return "with a newline"
+	case strings.HasSuffix(value, "\r"):
+		return "ending with a carriage return"
+	case !utf8.ValidString(value):
+		return "that is not valid UTF-8"
+	}
+	return ""
+}
+
+//NewFromDockerEnvFile creates an env from a file in the format read by docker run --env-file,
+// following the rules docker parses it with rather than those of an ENVFILE:
+//
+// - leading whitespace is trimmed from each line, and blank lines and lines starting with # are skipped
+// - everything after the first = is the value, including quotes, # and trailing whitespace
+// - a key may not hold whitespace, and the file must be valid UTF-8
+//
+// A key without an = is filled in by docker from the environment of the docker client, which dokku
+// does not know, so it is skipped. Such keys, values wrapped in quotes that docker keeps and keys set
+// more than once are reported as Warnings of the env. The env is not bound to a file, so it cannot
+// be written
+func NewFromDockerEnvFile(r io.Reader) (*Env, error) {
+	name := "docker env-file"
+	env := &Env{name: name, vars: map[string]string{}, warnings: []ParseWarning{}}
+	assigned := map[string]int{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		if line == 1 {
+			text = strings.TrimPrefix(text, utf8BOM)
+		}
+		if !utf8.ValidString(text) {
+			return nil, fmt.Errorf("Unable to parse %s: invalid UTF-8 on line %d", name, line)
+		}
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		key := strings.TrimLeft(parts[0], dockerEnvFileWhitespace)
+		if key == "" {
+			return nil, fmt.Errorf("Unable to parse %s: no key before the = on line %d", name, line)
+		}
+		if strings.ContainsAny(key, dockerEnvFileWhitespace) {
+			return nil, fmt.Errorf("Unable to parse %s: key '%s' holds whitespace on line %d", name, key, line)
+		}
+		if err := validateKey(key); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s on line %d", name, err.Error(), line)
+		}
+		if len(parts) == 1 {
+			env.warnings = append(env.warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningPassthrough,
+				Message:  fmt.Sprintf("%s has no value, docker would take it from the environment of the docker client, it is skipped", key),
+			})
+			continue
+		}
+		value := parts[1]
+		if isQuoted(value) {
+			env.warnings = append(env.warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningQuotedValue,
+				Message:  fmt.Sprintf("the value of %s is wrapped in quotes, which docker keeps as part of the value", key),
+			})
+		}
+		if previous, ok := assigned[key]; ok {
+			env.warnings = append(env.warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningDuplicateKey,
+				Message:  fmt.Sprintf("%s is also set on line %d, only this value is used", key, previous),
+			})
+		}
+		assigned[key] = line
+		if err := env.Set(key, value); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: invalid value of %s: %s", name, key, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %s", name, err.Error())
+	}
+	return env, nil
+}
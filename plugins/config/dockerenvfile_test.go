@@ -0,0 +1,100 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewFromDockerEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	//lines read differently by docker than as an ENVFILE, along with the value each of them gets
+	for _, tc := range []struct {
+		line     string
+		docker   string
+		envfile  string
+		warnings []string
+	}{
+		{line: `A="quoted"`, docker: `"quoted"`, envfile: "quoted", warnings: []string{ParseWarningQuotedValue}},
+		{line: `A='single'`, docker: `'single'`, envfile: "single", warnings: []string{ParseWarningQuotedValue}},
+		{line: `A=value # comment`, docker: "value # comment", envfile: "value"},
+		{line: `A=a=b`, docker: "a=b", envfile: "a=b"},
+		{line: `A=trailing  `, docker: "trailing  ", envfile: "trailing"},
+		{line: `A= leading`, docker: " leading", envfile: "leading"},
+		{line: `A="line\nbreak"`, docker: `"line\nbreak"`, envfile: "line\nbreak", warnings: []string{ParseWarningQuotedValue}},
+		{line: `A=$HOME`, docker: "$HOME", envfile: "$HOME"},
+		{line: `  A=indented`, docker: "indented", envfile: "indented"},
+		{line: "A=crlf\r", docker: "crlf", envfile: "crlf"},
+		{line: `A=`, docker: "", envfile: ""},
+	} {
+		env, err := NewFromDockerEnvFile(strings.NewReader(tc.line + "\n"))
+		Expect(err).NotTo(HaveOccurred(), tc.line)
+		Expect(env.Map()).To(Equal(pairs("A", tc.docker)), tc.line)
+		categories := []string{}
+		for _, w := range env.Warnings() {
+			categories = append(categories, w.Category)
+		}
+		if tc.warnings == nil {
+			tc.warnings = []string{}
+		}
+		Expect(categories).To(Equal(tc.warnings), tc.line)
+
+		envfile, err := NewFromStringWithName("envfile", tc.line+"\n")
+		Expect(err).NotTo(HaveOccurred(), tc.line)
+		Expect(envfile.Map()).To(Equal(pairs("A", tc.envfile)), tc.line)
+	}
+
+	env, err := NewFromDockerEnvFile(strings.NewReader(utf8BOM + "# comment\n\nA=1\nPASSED\n  # indented comment\nA=2\n"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "2")))
+	Expect(env.Warnings()).To(Equal([]ParseWarning{
+		{Line: 4, Category: ParseWarningPassthrough, Message: "PASSED has no value, docker would take it from the environment of the docker client, it is skipped"},
+		{Line: 6, Category: ParseWarningDuplicateKey, Message: "A is also set on line 3, only this value is used"},
+	}))
+	Expect(env.Write()).NotTo(Succeed())
+
+	for input, expected := range map[string]string{
+		"=value\n":       "Unable to parse docker env-file: no key before the = on line 1",
+		"MY KEY=value\n": "Unable to parse docker env-file: key 'MY KEY' holds whitespace on line 1",
+		"A=1\nB=\xff\n":  "Unable to parse docker env-file: invalid UTF-8 on line 2",
+		"-bad=value\n":   "Unable to parse docker env-file: Invalid key name: '-bad' on line 1",
+		"NUL=a\x00b\n":   "Unable to parse docker env-file: invalid value of NUL: value contains a NUL byte",
+	} {
+		_, err := NewFromDockerEnvFile(strings.NewReader(input))
+		Expect(err).To(MatchError(expected), input)
+	}
+}
+
+func TestDockerEnvFileString(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs(
+		"QUOTED", `"kept"`,
+		"COMMENT", "a # b",
+		"SPACES", " padded ",
+		"EMPTY", "",
+		"CERT", "line 1\nline 2",
+		"CR", "windows\r",
+		"LATIN1", "caf\xe9",
+		"INNER_CR", "a\rb",
+	))
+	rep, warnings := env.DockerEnvFileString()
+	Expect(rep).To(Equal("COMMENT=a # b\nEMPTY=\nINNER_CR=a\rb\nQUOTED=\"kept\"\nSPACES= padded "))
+	Expect(warnings).To(Equal([]string{
+		"CERT is left out, docker env-files cannot hold a value with a newline",
+		"CR is left out, docker env-files cannot hold a value ending with a carriage return",
+		"LATIN1 is left out, docker env-files cannot hold a value that is not valid UTF-8",
+	}))
+
+	//every value that is written is read back as it was
+	read, err := NewFromDockerEnvFile(strings.NewReader(rep + "\n"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(read.Map()).To(Equal(pairs("QUOTED", `"kept"`, "COMMENT", "a # b", "SPACES", " padded ", "EMPTY", "", "INNER_CR", "a\rb")))
+
+	Expect(env.Export(ExportFormatDockerEnvfile)).To(Equal(rep))
+	_, err = env.ExportWithOptions(ExportFormatDockerEnvfile, ExportOptions{})
+	Expect(err).To(MatchError("CERT is left out, docker env-files cannot hold a value with a newline"))
+	exported, err := NewForTest(t, pairs("A", "1")).ExportWithOptions(ExportFormatDockerEnvfile, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("A=1"))
+}
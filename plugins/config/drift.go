@@ -0,0 +1,65 @@
+package config
+
+import (
+	"fmt"
+)
+
+//LoadEnvFile parses a dotenv or exports file that is not managed by dokku, such as a reference
+// of the config an app should have. A gzip-compressed file is decompressed. The returned Env is
+// not bound to the file and cannot be written
+func LoadEnvFile(filename string) (*Env, error) {
+	contents, _, err := readMaybeCompressed(filename)
+	if err != nil {
+		return nil, err
+	}
+	env, err := NewFromStringWithName(filename, string(contents))
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range env.sortKeys() {
+		if err := validateKey(k); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", filename, err.Error())
+		}
+	}
+	return env, nil
+}
+
+//Drift compares a live env against the desired one, skipping keys that match any of the ignore
+// glob patterns. Added keys are missing from live, Removed keys are extra and Changed keys differ
+func Drift(live *Env, desired *Env, ignore []string) EnvDiff {
+	diff := Diff(live, desired)
+	return EnvDiff{
+		Added:   withoutIgnored(diff.Added, ignore),
+		Removed: withoutIgnored(diff.Removed, ignore),
+		Changed: withoutIgnored(diff.Changed, ignore),
+	}
+}
+
+//ReconcileDrift changes the env of an app to match the desired one, apart from ignored keys,
+// in a single Update and returns what was changed. Keys set only in the global env are left alone
+func ReconcileDrift(appName string, desired *Env, ignore []string, policy RestartPolicy) (EnvDiff, error) {
+	return Update(appName, policy, func(env *Env) error {
+		drift := Drift(env, desired, ignore)
+		for _, k := range drift.updated() {
+			if err := env.Set(k, desired.values()[k]); err != nil {
+				return &ValidationError{Message: fmt.Sprintf("Invalid value for key '%s': %s", k, err.Error())}
+			}
+		}
+		for _, k := range drift.Removed {
+			if err := env.Unset(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func withoutIgnored(keys []string, ignore []string) []string {
+	kept := []string{}
+	for _, k := range keys {
+		if !matchesAny(k, ignore) {
+			kept = append(kept, k)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func writeReferenceFile(contents string) string {
+	f, err := ioutil.TempFile("", "desired.env")
+	Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+	_, err = f.WriteString(contents)
+	Expect(err).NotTo(HaveOccurred())
+	return f.Name()
+}
+
+func TestLoadEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	filename := writeReferenceFile("# desired config\nA=1\nexport B='two words'\n")
+	defer os.Remove(filename)
+
+	env, err := LoadEnvFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "1", "B", "two words")))
+	Expect(env.Write()).NotTo(Succeed())
+
+	invalid := writeReferenceFile("1A=1\n")
+	defer os.Remove(invalid)
+	_, err = LoadEnvFile(invalid)
+	Expect(err).To(HaveOccurred())
+
+	_, err = LoadEnvFile(filename + ".missing")
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestDrift(t *testing.T) {
+	RegisterTestingT(t)
+	live := NewForTest(t, pairs("A", "1", "B", "2", "DOKKU_APP_TYPE", "herokuish", "EXTRA", "x"))
+	desired := NewForTest(t, pairs("A", "1", "B", "3", "MISSING", "y"))
+
+	Expect(Drift(live, desired, nil)).To(Equal(EnvDiff{
+		Added:   []string{"MISSING"},
+		Removed: []string{"DOKKU_APP_TYPE", "EXTRA"},
+		Changed: []string{"B"},
+	}))
+	Expect(Drift(live, desired, []string{"DOKKU_*", "B"})).To(Equal(EnvDiff{
+		Added:   []string{"MISSING"},
+		Removed: []string{"EXTRA"},
+		Changed: []string{},
+	}))
+	Expect(Drift(live, live, nil).Empty()).To(BeTrue())
+}
+
+func TestReconcileDrift(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("EXTRA", "x", "DOKKU_KEEP", "1"), false)).To(Succeed())
+
+	desired := NewForTest(t, pairs("testKey", "DESIRED", "NEW", "y"))
+	applied, err := ReconcileDrift(testAppName, desired, []string{"DOKKU_*"}, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(applied).To(Equal(EnvDiff{
+		Added:   []string{"NEW"},
+		Removed: []string{"EXTRA"},
+		Changed: []string{"testKey"},
+	}))
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("testKey", "DESIRED", "NEW", "y", "DOKKU_KEEP", "1")))
+	Expect(Drift(env, desired, []string{"DOKKU_*"}).Empty()).To(BeTrue())
+
+	applied, err = ReconcileDrift(testAppName, desired, []string{"DOKKU_*"}, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(applied.Empty()).To(BeTrue())
+}
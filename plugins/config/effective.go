@@ -0,0 +1,195 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//Layers an effective env is put together from, in order of precedence. A key set by more than one
+// layer takes the value of the last of them:
+//
+//	contributed  the defaults plugins print for the config-contribute-env trigger, see contributedLayer
+//	global       the global ENV file
+//	app          the ENV file of the app
+//	process      ENV.<proctype> next to the ENV file of the app, for containers of that process type
+//	build        ENV.build next to the ENV file of the app, in the build phase only
+const (
+	LayerContributed = "contributed"
+	LayerGlobal      = "global"
+	LayerApp         = "app"
+	LayerProcess     = "process"
+	LayerBuild       = "build"
+)
+
+//procTypePattern matches the process types whose ENV.<proctype> file can be read
+var procTypePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+//LayerValue is the value that one layer of an effective env sets a key to
+type LayerValue struct {
+	//Layer is one of LayerContributed, LayerGlobal, LayerApp, LayerProcess and LayerBuild
+	Layer string
+	//Filename is the ENV file of the layer, which the contributed layer has none of
+	Filename string
+	//Plugin is the plugin that contributed the value, for the contributed layer
+	Plugin string
+	Value  string
+}
+
+//EffectiveEnv is the env of an app as a container gets it, along with the layers it was put together from
+type EffectiveEnv struct {
+	//Env holds the value of each key from the layer with the highest precedence that sets it. It is
+	// read-only and not bound to a file
+	Env *Env
+	//layers are the envs of the layers, from the lowest precedence to the highest
+	layers []effectiveLayer
+}
+
+//SourceFormat is the format of an ENV file an effective env was put together from
+type SourceFormat struct {
+	//Layer is one of LayerGlobal, LayerApp, LayerProcess and LayerBuild
+	Layer    string
+	Filename string
+	//Version is the ENV format version the file declares, see EnvFormatVersion
+	Version int
+	//Compressed is set if the file is stored gzip-compressed
+	Compressed bool
+}
+
+type effectiveLayer struct {
+	name string
+	env  *Env
+	//sources are the plugins that contributed each key, for the contributed layer
+	sources map[string]string
+}
+
+//Chain returns the value of the key in every layer that sets it, from the lowest precedence to the
+// highest, so that the last one is the value of the key in Env. It is empty if no layer sets the key
+func (e *EffectiveEnv) Chain(key string) []LayerValue {
+	chain := []LayerValue{}
+	for _, layer := range e.layers {
+		if value, ok := layer.env.Get(key); ok {
+			chain = append(chain, LayerValue{Layer: layer.name, Filename: layer.env.filename, Plugin: layer.sources[key], Value: value})
+		}
+	}
+	return chain
+}
+
+//Formats returns the format of each ENV file the env was put together from, from the lowest
+// precedence to the highest. Files that do not exist are left out, as they hold no keys to read
+func (e *EffectiveEnv) Formats() []SourceFormat {
+	formats := []SourceFormat{}
+	for _, layer := range e.layers {
+		if layer.env.filename == "" {
+			continue
+		}
+		path, _ := envFileOnDisk(layer.env.filename)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		formats = append(formats, SourceFormat{
+			Layer:      layer.name,
+			Filename:   layer.env.filename,
+			Version:    layer.env.FormatVersion(),
+			Compressed: layer.env.compressed,
+		})
+	}
+	return formats
+}
+
+//storedChain returns the values of a chain set in ENV files, leaving out the one contributed by a
+// plugin, which any of them takes precedence over
+func storedChain(chain []LayerValue) []LayerValue {
+	if len(chain) > 0 && chain[0].Layer == LayerContributed {
+		return chain[1:]
+	}
+	return chain
+}
+
+//ResolveEffectiveEnv puts together the env of an app for containers of the given process type in the
+// given phase, from the layers it is made of in order of precedence, see LayerGlobal. The process
+// layer is left out if procType is empty, and only the global layer is used if appName is empty.
+// Missing layer files are empty. The contributed layer is what plugins print when the
+// config-contribute-env trigger is fired for the app, process type and phase. A warning is printed
+// if the global and app ENV files are of format versions that read lines differently, see
+// formatMismatch. References to other apps are not resolved and no keys are left out, see
+// ResolveSchedulerEnv for the env that is handed to containers
+func ResolveEffectiveEnv(appName string, procType string, phase string, opts ...LoadOption) (*EffectiveEnv, error) {
+	switch phase {
+	case SchedulerPhaseBuild, SchedulerPhaseDeploy, SchedulerPhaseRun:
+	default:
+		return nil, fmt.Errorf("Unknown phase %s, expected one of %s, %s or %s", phase, SchedulerPhaseBuild, SchedulerPhaseDeploy, SchedulerPhaseRun)
+	}
+	if procType != "" && !procTypePattern.MatchString(procType) {
+		return nil, fmt.Errorf("Invalid process type: '%s'", procType)
+	}
+	resolver := NewPathResolver(opts...)
+	if resolver.File != "" {
+		return nil, fmt.Errorf("Unable to merge %s with the global env, it is not part of a dokku install", resolver.File)
+	}
+
+	layers := []effectiveLayer{}
+	name := "<global>"
+	if appName != "" {
+		app, err := LoadAppEnv(appName, opts...)
+		if err != nil {
+			return nil, err
+		}
+		name = app.name
+		layers = append(layers, effectiveLayer{name: LayerApp, env: app})
+		//the files of the other layers live next to the ENV file of the app, wherever it was relocated
+		files := map[string]string{}
+		if procType != "" {
+			files[LayerProcess] = app.filename + "." + procType
+		}
+		if phase == SchedulerPhaseBuild {
+			files[LayerBuild] = app.filename + ".build"
+		}
+		for _, layerName := range []string{LayerProcess, LayerBuild} {
+			if files[layerName] == "" {
+				continue
+			}
+			env, err := loadFromFile(appName, files[layerName])
+			if err != nil {
+				return nil, err
+			}
+			env.scope = scopeFor(appName)
+			if err := resolver.decode(appName, env); err != nil {
+				return nil, err
+			}
+			layers = append(layers, effectiveLayer{name: layerName, env: env})
+		}
+	}
+	global, err := LoadGlobalEnv(opts...)
+	if err != nil {
+		return nil, err
+	}
+	layers = append([]effectiveLayer{{name: LayerGlobal, env: global}}, layers...)
+	if appName != "" {
+		contributed, err := contributedLayer(appName, procType, phase)
+		if err != nil {
+			return nil, err
+		}
+		if contributed.env.Len() > 0 {
+			layers = append([]effectiveLayer{contributed}, layers...)
+		}
+	}
+	effective := mergeLayers(name, layers)
+	if warning := formatMismatch(effective.Formats()); warning != "" {
+		common.LogWarn(warning)
+	}
+	return effective, nil
+}
+
+//mergeLayers merges the envs of the layers, given from the lowest precedence to the highest, into
+// an effective env of the given name. The merge is lazy, so that the keys of the global env are
+// not copied for a trigger that only reads a few of them, see lazyMerge
+func mergeLayers(name string, layers []effectiveLayer) *EffectiveEnv {
+	envs := make([]*Env, len(layers))
+	for i, layer := range layers {
+		envs[i] = layer.env
+	}
+	return &EffectiveEnv{Env: lazyMerge(name, envs), layers: layers}
+}
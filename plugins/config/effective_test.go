@@ -0,0 +1,104 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestResolveEffectiveEnvPrecedence(t *testing.T) {
+	RegisterTestingT(t)
+	root, err := ioutil.TempDir("", "dokku-config-effective")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(root)
+	Expect(os.MkdirAll(filepath.Join(root, "web-app"), 0755)).To(Succeed())
+
+	//every combination of layers sets a key named after the layers setting it, such as KEY_APP_BUILD,
+	// to the name of the layer
+	files := map[string]string{
+		LayerGlobal:  filepath.Join(root, "ENV"),
+		LayerApp:     filepath.Join(root, "web-app", "ENV"),
+		LayerProcess: filepath.Join(root, "web-app", "ENV.web"),
+		LayerBuild:   filepath.Join(root, "web-app", "ENV.build"),
+	}
+	order := []string{LayerGlobal, LayerApp, LayerProcess, LayerBuild}
+	contents := map[string]string{}
+	keys := map[string][]string{}
+	for combination := 1; combination < 1<<uint(len(order)); combination++ {
+		setBy := []string{}
+		for i, layer := range order {
+			if combination&(1<<uint(i)) != 0 {
+				setBy = append(setBy, layer)
+			}
+		}
+		key := "KEY_" + strings.ToUpper(strings.Join(setBy, "_"))
+		keys[key] = setBy
+		for _, layer := range setBy {
+			contents[layer] += fmt.Sprintf("%s=%s\n", key, layer)
+		}
+	}
+	for layer, filename := range files {
+		Expect(ioutil.WriteFile(filename, []byte(contents[layer]), 0600)).To(Succeed())
+	}
+
+	for _, c := range []struct {
+		procType string
+		phase    string
+		layers   []string
+	}{
+		{"web", SchedulerPhaseBuild, order},
+		{"web", SchedulerPhaseDeploy, []string{LayerGlobal, LayerApp, LayerProcess}},
+		{"web", SchedulerPhaseRun, []string{LayerGlobal, LayerApp, LayerProcess}},
+		{"", SchedulerPhaseBuild, []string{LayerGlobal, LayerApp, LayerBuild}},
+		{"", SchedulerPhaseDeploy, []string{LayerGlobal, LayerApp}},
+		//a process type without a file of its own adds an empty layer
+		{"worker", SchedulerPhaseDeploy, []string{LayerGlobal, LayerApp}},
+	} {
+		effective, err := ResolveEffectiveEnv("web-app", c.procType, c.phase, WithRoot(root))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(effective.Env.IsReadOnly()).To(BeTrue())
+		Expect(effective.Env.Name()).To(Equal("web-app"))
+		used := map[string]bool{}
+		for _, layer := range c.layers {
+			used[layer] = true
+		}
+		for key, setBy := range keys {
+			chain := []LayerValue{}
+			for _, layer := range setBy {
+				if used[layer] {
+					chain = append(chain, LayerValue{Layer: layer, Filename: files[layer], Value: layer})
+				}
+			}
+			description := fmt.Sprintf("%s of %s in %s", key, c.procType, c.phase)
+			Expect(effective.Chain(key)).To(Equal(chain), description)
+			value, ok := effective.Env.Get(key)
+			Expect(ok).To(Equal(len(chain) > 0), description)
+			if ok {
+				Expect(value).To(Equal(chain[len(chain)-1].Value), description)
+			}
+		}
+	}
+
+	//the global env has no other layers
+	effective, err := ResolveEffectiveEnv("", "web", SchedulerPhaseBuild, WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(effective.Env.Name()).To(Equal("<global>"))
+	Expect(effective.Chain("KEY_GLOBAL_APP")).To(Equal([]LayerValue{{Layer: LayerGlobal, Filename: files[LayerGlobal], Value: LayerGlobal}}))
+
+	//--merged is the global and app layers
+	merged, err := LoadMergedAppEnv("web-app", WithRoot(root))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(merged.GetDefault("KEY_GLOBAL_APP_PROCESS_BUILD", "")).To(Equal(LayerApp))
+	_, ok := merged.Get("KEY_PROCESS")
+	Expect(ok).To(BeFalse())
+
+	_, err = ResolveEffectiveEnv("web-app", "web", "release", WithRoot(root))
+	Expect(err).To(MatchError("Unknown phase release, expected one of build, deploy or run"))
+	_, err = ResolveEffectiveEnv("web-app", "../web", SchedulerPhaseDeploy, WithRoot(root))
+	Expect(err).To(MatchError("Invalid process type: '../web'"))
+}
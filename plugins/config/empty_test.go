@@ -0,0 +1,166 @@
+package config
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//setupEmptyTestHost returns a host holding a freshly created app, which has no ENV file, and no
+// global ENV file either
+func setupEmptyTestHost() (host *testHost, teardown func()) {
+	host, teardown = setupTestHost()
+	Expect(os.Remove(filepath.Join(host.root, "ENV"))).To(Succeed())
+	Expect(os.MkdirAll(filepath.Join(host.root, "new-app"), 0755)).To(Succeed())
+	return
+}
+
+func TestLoadMissingEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-empty")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "ENV")
+	env, err := loadFromFile("new-app", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(0))
+	Expect(env.IsReadOnly()).To(BeFalse())
+	_, err = os.Stat(filename)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	//the empty env is bound to the file, which is created once a key is set
+	env.Set("KEY", "value")
+	Expect(env.Write()).To(Succeed())
+	env, err = loadFromFile("new-app", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("KEY", "value")))
+
+	//a file that cannot be read is not mistaken for a missing one
+	Expect(ioutil.WriteFile(filename, append(append([]byte{}, gzipMagic...), "truncated"...), 0600)).To(Succeed())
+	_, err = loadFromFile("new-app", filename)
+	Expect(err).To(HaveOccurred())
+	Expect(err.Error()).To(HavePrefix("Unable to read config for new-app: "))
+}
+
+func TestExportEmptyEnv(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, map[string]string{})
+	for format, expected := range map[ExportFormat]string{
+		ExportFormatExports:       "",
+		ExportFormatEnvfile:       "",
+		ExportFormatDockerArgs:    "",
+		ExportFormatShell:         "",
+		ExportFormatPretty:        "",
+		ExportFormatJSON:          "{}",
+		ExportFormatNul:           "",
+		ExportFormatNetstring:     "",
+		ExportFormatCompose:       "services:\n  web:\n    environment: []\n",
+		ExportFormatDockerEnvfile: "",
+		ExportFormatJSONNested:    "{}",
+	} {
+		exported, err := env.ExportWithOptions(format, ExportOptions{Ordered: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exported).To(Equal(expected), fmt.Sprintf("format %d", format))
+		Expect(env.Export(format)).To(Equal(expected), fmt.Sprintf("format %d", format))
+	}
+	exported, err := env.ExportWithOptions(ExportFormatCompose, ExportOptions{ComposeMap: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("services:\n  web:\n    environment: {}\n"))
+
+	var bundle bytes.Buffer
+	Expect(env.ExportBundle(&bundle)).To(Succeed())
+	_, err = tar.NewReader(&bundle).Next()
+	Expect(err).To(Equal(io.EOF))
+}
+
+func TestRunSubcommandNewApp(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected string
+		err      *SubcommandError
+	}{
+		{"show", []string{"new-app"}, "=====> new-app env vars\n", nil},
+		{"show", []string{"--merged", "new-app"}, "=====> new-app env vars\n", nil},
+		{"show", []string{"--export", "new-app"}, "", nil},
+		{"show", []string{"--shell", "new-app"}, "", nil},
+		{"show", []string{"--global"}, "=====> global env vars\n", nil},
+		{"keys", []string{"new-app"}, "", nil},
+		{"keys", []string{"--merged", "new-app"}, "", nil},
+		{"export", []string{"new-app"}, "", nil},
+		{"export", []string{"--merged", "--container", "new-app"}, "", nil},
+		{"export", []string{"--format", "envfile", "--ordered", "new-app"}, "", nil},
+		{"export", []string{"--format", "docker-args", "new-app"}, "", nil},
+		{"export", []string{"--format", "shell", "new-app"}, "", nil},
+		{"export", []string{"--format", "pretty", "new-app"}, "", nil},
+		{"export", []string{"--format", "json", "new-app"}, "{}\n", nil},
+		{"export", []string{"--format", "nul", "new-app"}, "", nil},
+		{"export", []string{"--format", "netstring", "new-app"}, "", nil},
+		{"export", []string{"--format", "compose", "new-app"}, "services:\n  web:\n    environment: []\n", nil},
+		{"export", []string{"--format", "docker-envfile", "new-app"}, "", nil},
+		{"export", []string{"--format", "json-nested", "new-app"}, "{}\n", nil},
+		{"export", []string{"--global"}, "", nil},
+		{"export", []string{"--all-apps", "--format", "json"}, `{"new-app":{}}` + "\n", nil},
+		//only reading keys that must exist fails
+		{"get", []string{"new-app", "KEY"}, "", &SubcommandError{Code: 1}},
+		{"get", []string{"--global", "KEY"}, "", &SubcommandError{Code: 1}},
+		{"report", []string{"new-app", "--config-key-count"}, "0\n", nil},
+		{"unset", []string{"new-app", "KEY"}, "-----> Skipping KEY, it is not set in the environment\n=====> No keys removed\n", nil},
+		{"unset", []string{"--strict", "new-app", "KEY"}, "-----> Skipping KEY, it is not set in the environment\n=====> No keys removed\n", &SubcommandError{Code: 1, Message: "Not set: KEY"}},
+	} {
+		host, teardown := setupEmptyTestHost()
+		output, err := runSubcommand(host, tc.name, tc.argv...)
+		if tc.err == nil {
+			Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		} else {
+			Expect(err).To(Equal(tc.err), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		}
+		Expect(output).To(Equal(tc.expected), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		//reading an env never creates its file
+		if tc.name != "unset" {
+			_, statErr := os.Stat(filepath.Join(host.root, "new-app", "ENV"))
+			Expect(os.IsNotExist(statErr)).To(BeTrue(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		}
+		teardown()
+	}
+
+	host, teardown := setupEmptyTestHost()
+	defer teardown()
+	output, err := runSubcommand(host, "bundle", "new-app")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = tar.NewReader(bytes.NewBufferString(output)).Next()
+	Expect(err).To(Equal(io.EOF))
+	output, err = runSubcommand(host, "bundle", "--include-envfile", "new-app")
+	Expect(err).NotTo(HaveOccurred())
+	entries, _ := readBundle(bytes.NewBufferString(output))
+	Expect(entries).To(Equal(map[string]string{DefaultBundleEnvfileEntry: ""}))
+
+	output, err = runSubcommand(host, "diff", "--file", filepath.Join(host.root, "new-app", "ENV"), "--file", filepath.Join(host.root, "ENV"))
+	Expect(err).To(HaveOccurred())
+	Expect(output).To(BeEmpty())
+
+	_, err = runSubcommand(host, "set", "--no-restart", "new-app", "KEY=value")
+	Expect(err).NotTo(HaveOccurred())
+	output, err = runSubcommand(host, "get", "new-app", "KEY")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("value\n"))
+}
+
+func TestRunSubcommandNewAppCoversRunners(t *testing.T) {
+	RegisterTestingT(t)
+	//every subcommand that can be run through RunSubcommand must be exercised against a new app above
+	for _, name := range []string{"bundle", "diff", "export", "get", "keys", "report", "set", "show", "unset"} {
+		Expect(subcommandRunners).To(HaveKey(name))
+	}
+	Expect(subcommandRunners).To(HaveLen(9))
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//InvalidUTF8Policy decides what loading an env does with values that are not valid UTF-8, such
+// as those written in latin1 by older tools
+type InvalidUTF8Policy string
+
+const (
+	//InvalidUTF8Keep loads values as they are, byte for byte. It is the default
+	InvalidUTF8Keep InvalidUTF8Policy = "keep"
+	//InvalidUTF8Error fails to load an env holding such values
+	InvalidUTF8Error InvalidUTF8Policy = "error"
+	//InvalidUTF8Replace replaces each invalid byte with U+FFFD, warning about the keys affected
+	InvalidUTF8Replace InvalidUTF8Policy = "replace"
+	//InvalidUTF8Latin1 reads such values as latin1, transcoding them to UTF-8
+	InvalidUTF8Latin1 InvalidUTF8Policy = "latin1"
+)
+
+//ParseInvalidUTF8Policy returns the policy of the given name, the default if it is empty
+func ParseInvalidUTF8Policy(value string) (InvalidUTF8Policy, error) {
+	switch policy := InvalidUTF8Policy(value); policy {
+	case "":
+		return InvalidUTF8Keep, nil
+	case InvalidUTF8Keep, InvalidUTF8Error, InvalidUTF8Replace, InvalidUTF8Latin1:
+		return policy, nil
+	}
+	return "", &ValidationError{Message: fmt.Sprintf("Unknown invalid-utf8 policy '%s', expected one of %s, %s, %s or %s", value, InvalidUTF8Keep, InvalidUTF8Error, InvalidUTF8Replace, InvalidUTF8Latin1)}
+}
+
+//WithInvalidUTF8 loads values that are not valid UTF-8 according to policy, in place of the
+// invalid-utf8 property of the app or the global env
+func WithInvalidUTF8(policy InvalidUTF8Policy) LoadOption {
+	return func(r *PathResolver) {
+		r.InvalidUTF8 = policy
+	}
+}
+
+//invalidUTF8Policy returns the policy given with WithInvalidUTF8, or else that set by the
+// invalid-utf8 property of the app, or of the global env if appName is empty
+func (r *PathResolver) invalidUTF8Policy(appName string) (InvalidUTF8Policy, error) {
+	if r.InvalidUTF8 != "" {
+		return ParseInvalidUTF8Policy(string(r.InvalidUTF8))
+	}
+	if appName == "<global>" {
+		appName = ""
+	}
+	return ParseInvalidUTF8Policy(getConfigProperty(appName, "invalid-utf8"))
+}
+
+//InvalidUTF8Keys returns the keys whose values are not valid UTF-8, sorted
+func (e *Env) InvalidUTF8Keys() []string {
+	keys := []string{}
+	for _, k := range e.sortKeys() {
+		if !utf8.ValidString(e.values()[k]) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+//decodeInvalidUTF8 applies policy to the values of the env that are not valid UTF-8
+func (e *Env) decodeInvalidUTF8(policy InvalidUTF8Policy) error {
+	keys := e.InvalidUTF8Keys()
+	if len(keys) == 0 || policy == InvalidUTF8Keep {
+		return nil
+	}
+	switch policy {
+	case InvalidUTF8Error:
+		return fmt.Errorf("Config for %s holds values that are not valid UTF-8: %s. Set the invalid-utf8 property to replace or latin1 to load it", e.name, strings.Join(keys, ", "))
+	case InvalidUTF8Replace:
+		for _, k := range keys {
+			e.values()[k] = strings.ToValidUTF8(e.values()[k], "\uFFFD")
+		}
+		common.LogWarn(fmt.Sprintf("Replaced bytes that are not valid UTF-8 in the values of %s of %s with U+FFFD", strings.Join(keys, ", "), e.name))
+	case InvalidUTF8Latin1:
+		for _, k := range keys {
+			e.values()[k] = decodeLatin1(e.values()[k])
+		}
+	default:
+		return fmt.Errorf("Unknown invalid-utf8 policy '%s'", policy)
+	}
+	return nil
+}
+
+//decodeLatin1 transcodes a latin1 string to UTF-8, each byte being the code point of the same value
+func decodeLatin1(value string) string {
+	var b strings.Builder
+	b.Grow(len(value) * 2)
+	for i := 0; i < len(value); i++ {
+		b.WriteRune(rune(value[i]))
+	}
+	return b.String()
+}
+
+//TranscodeEnvFile rewrites the values of the ENV file at path that are not valid UTF-8 according
+// to policy, which must be InvalidUTF8Latin1 or InvalidUTF8Replace, after copying its current
+// contents to a backup file next to it. It returns the path of the backup and the keys that were
+// rewritten, or an empty path if there was nothing to rewrite
+func TranscodeEnvFile(name string, path string, policy InvalidUTF8Policy) (backup string, keys []string, err error) {
+	if policy != InvalidUTF8Latin1 && policy != InvalidUTF8Replace {
+		return "", nil, fmt.Errorf("Unable to transcode with the invalid-utf8 policy '%s', expected %s or %s", policy, InvalidUTF8Latin1, InvalidUTF8Replace)
+	}
+	unlock, err := lockEnvFile(path)
+	if err != nil {
+		return "", nil, err
+	}
+	defer unlock()
+
+	contents, _, err := readEnvFile(path)
+	if os.IsNotExist(err) {
+		return "", []string{}, nil
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("Unable to read %s: %s", path, err.Error())
+	}
+	env, err := loadFromFile(name, path)
+	if err != nil {
+		return "", nil, err
+	}
+	keys = env.InvalidUTF8Keys()
+	if len(keys) == 0 {
+		return "", keys, nil
+	}
+
+	backup = path + ".utf8.bak"
+	if err := writeFileSafe(backup, contents, writeOptions{mode: 0600, resetMode: true, noClobber: true, noFollow: true}); os.IsExist(err) {
+		return "", nil, fmt.Errorf("Refusing to overwrite existing backup %s", backup)
+	} else if err != nil {
+		return "", nil, fmt.Errorf("Unable to write backup %s: %s", backup, err.Error())
+	}
+	if err := env.decodeInvalidUTF8(policy); err != nil {
+		return "", nil, err
+	}
+	if err := env.Write(); err != nil {
+		return "", nil, fmt.Errorf("Unable to write %s: %s", path, err.Error())
+	}
+	return backup, keys, nil
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+const testLatin1Env = "export KEY='web-app'\nexport NAME='caf\xe9'\n"
+
+func TestParseInvalidUTF8Policy(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(ParseInvalidUTF8Policy("")).To(Equal(InvalidUTF8Keep))
+	for _, policy := range []InvalidUTF8Policy{InvalidUTF8Keep, InvalidUTF8Error, InvalidUTF8Replace, InvalidUTF8Latin1} {
+		Expect(ParseInvalidUTF8Policy(string(policy))).To(Equal(policy))
+	}
+	_, err := ParseInvalidUTF8Policy("ascii")
+	Expect(err).To(MatchError("Unknown invalid-utf8 policy 'ascii', expected one of keep, error, replace or latin1"))
+
+	Expect(decodeLatin1("caf\xe9 \xff")).To(Equal("café ÿ"))
+	Expect(decodeLatin1("plain")).To(Equal("plain"))
+}
+
+func TestLoadInvalidUTF8(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupTestProperties()()
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "web-app", "ENV"), []byte(testLatin1Env), 0600)).To(Succeed())
+
+	//values are kept byte for byte by default
+	env, err := LoadAppEnv("web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("NAME", "")).To(Equal("caf\xe9"))
+	Expect(env.InvalidUTF8Keys()).To(Equal([]string{"NAME"}))
+
+	_, err = LoadAppEnv("web-app", WithInvalidUTF8(InvalidUTF8Error))
+	Expect(err).To(MatchError("Config for web-app holds values that are not valid UTF-8: NAME. Set the invalid-utf8 property to replace or latin1 to load it"))
+
+	env, err = LoadAppEnv("web-app", WithInvalidUTF8(InvalidUTF8Replace))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("NAME", "")).To(Equal("caf�"))
+
+	//the property applies when no policy is given
+	Expect(common.PropertyWrite("config", "web-app", "invalid-utf8", "latin1")).To(Succeed())
+	env, err = LoadAppEnv("web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("NAME", "")).To(Equal("café"))
+	Expect(env.InvalidUTF8Keys()).To(BeEmpty())
+
+	//and to the process layers of the effective env
+	Expect(common.PropertyWrite("config", "web-app", "invalid-utf8", "error")).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "web-app", "ENV"), []byte("export KEY='web-app'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "web-app", "ENV.web"), []byte("export NAME='caf\xe9'\n"), 0600)).To(Succeed())
+	_, err = ResolveEffectiveEnv("web-app", "web", "deploy")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCheckInvalidUTF8(t *testing.T) {
+	RegisterTestingT(t)
+	findings := LintContents("web-app", testLatin1Env, nil, Limits{})
+	Expect(findings).To(Equal([]Finding{{
+		Check:    "invalid-utf8",
+		Severity: SeverityWarning,
+		Key:      "NAME",
+		Line:     2,
+		Message:  "Value of NAME is not valid UTF-8 from byte 3, it may be latin1",
+	}}))
+	Expect(firstInvalidUTF8("valid �")).To(Equal(-1))
+}
+
+func TestTranscodeEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-encoding")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte(testLatin1Env), 0600)).To(Succeed())
+
+	_, _, err = TranscodeEnvFile("test", filename, InvalidUTF8Error)
+	Expect(err).To(HaveOccurred())
+
+	backup, keys, err := TranscodeEnvFile("test", filename, InvalidUTF8Latin1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(Equal(filename + ".utf8.bak"))
+	Expect(keys).To(Equal([]string{"NAME"}))
+	contents, err := ioutil.ReadFile(backup)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal(testLatin1Env))
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("KEY", "web-app", "NAME", "café")))
+
+	//a file holding valid UTF-8 is left alone
+	backup, keys, err = TranscodeEnvFile("test", filename, InvalidUTF8Latin1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(BeEmpty())
+	Expect(keys).To(BeEmpty())
+
+	//an existing backup is never overwritten
+	Expect(ioutil.WriteFile(filename, []byte(testLatin1Env), 0600)).To(Succeed())
+	_, _, err = TranscodeEnvFile("test", filename, InvalidUTF8Replace)
+	Expect(err).To(MatchError("Refusing to overwrite existing backup " + filename + ".utf8.bak"))
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal(testLatin1Env))
+}
+
+func TestExportInvalidUTF8(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("NAME", "caf\xe9", "OTHER", "\xff\xfe"))
+	for _, format := range []ExportFormat{ExportFormatJSON, ExportFormatJSONNested, ExportFormatCompose} {
+		Expect(utf8.ValidString(env.Export(format))).To(BeTrue())
+	}
+}
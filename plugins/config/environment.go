@@ -1,14 +1,16 @@
 package config
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"path/filepath"
 	"sort"
 	"strings"
+	"unicode/utf8"
 
 	"archive/tar"
+	"compress/gzip"
 
 	"os"
 
@@ -31,71 +33,236 @@ const (
 	ExportFormatShell
 	//ExportFormatPretty format: pretty-printed in columns
 	ExportFormatPretty
+	//ExportFormatJSON format: json object of each key's value and metadata
+	ExportFormatJSON
+	//ExportFormatNul format: key\0value\0 records
+	ExportFormatNul
+	//ExportFormatNetstring format: a netstring of the key followed by a netstring of the value
+	ExportFormatNetstring
+	//ExportFormatCompose format: docker compose override setting the environment of a service
+	ExportFormatCompose
+	//ExportFormatDockerEnvfile format: file read by docker run --env-file, with values unquoted
+	ExportFormatDockerEnvfile
+	//ExportFormatJSONNested format: json object with keys split on a separator into nested objects
+	ExportFormatJSONNested
 )
 
+//ErrInvalidValue is returned by Set for a value that cannot be stored in an ENV file
+var ErrInvalidValue = errors.New("value contains a NUL byte")
+
+//ErrReadOnlyEnv is returned by Write and by the methods changing an Env made read-only, such as Set,
+// Unset and Merge, see Env.ReadOnly
+var ErrReadOnlyEnv = errors.New("env is read-only")
+
+//QuoteStyle types of quoting used for values by the exports, docker-args and shell formats
+type QuoteStyle int
+
+const (
+	//QuoteSingle style: 'value', with single quotes written as '\''
+	QuoteSingle QuoteStyle = iota
+	//QuoteDouble style: "value", with \, ", $ and ` escaped by a backslash
+	QuoteDouble
+	//QuoteMinimal style: unquoted if the value only holds characters that are never special to
+	// the shell, otherwise whichever of the single and double quoted forms is shorter
+	QuoteMinimal
+)
+
+//ExportOptions controls how values are quoted by the exports, docker-args and shell formats, and how
+// the compose format is laid out
+type ExportOptions struct {
+	//EscapeControlChars writes values containing newlines, tabs, carriage returns or other
+	// control characters as bash $'...' strings, so that every entry stays on a single line
+	EscapeControlChars bool
+	//Quoting of values not written as $'...' strings. The default is QuoteSingle
+	Quoting QuoteStyle
+	//Ordered lists keys in OrderedKeys order rather than sorted. It has no effect on the json format
+	Ordered bool
+	//ComposeService is the service whose environment the compose format sets. The default is web
+	ComposeService string
+	//ComposeMap writes the environment of the compose format as a mapping rather than a list
+	ComposeMap bool
+	//KeyTransform renames keys, see KeyTransform.Func. Keys of the exports, docker-args, shell,
+	// envfile and docker-envfile formats must be valid keys once renamed, see FormatOptions, and
+	// those of the other formats must not be empty or hold a = or NUL byte
+	KeyTransform func(key string) string
+	//NestedSeparator is what the json-nested format splits keys on. The default is _
+	NestedSeparator string
+	//NestedLowercase lowercases the keys of the json-nested format
+	NestedLowercase bool
+}
+
 //Env is a representation for global or app environment
 type Env struct {
 	name     string
 	filename string
-	env      map[string]string
+	//vars holds the keys and their values, read through values so that those of a lazily merged env
+	// are put together first
+	vars map[string]string
+	//layers are the envs a lazily merged env is put together from, or nil once it was, see lazyMerge
+	layers []*Env
+	//sortedKeys caches the result of Keys and is reset whenever a key is added or removed
+	sortedKeys []string
+	//meta is loaded from the metadata sidecar on first use
+	meta map[string]KeyMetadata
+	//order holds the keys in the order they were read and added, or nil if there is none
+	order []string
+	//ordered is set by PreserveOrder, layout is how the keys were written in the file
+	ordered bool
+	layout  *fileLayout
+	//compressed is set if the file is stored gzip-compressed, and is kept by Write
+	compressed bool
+	//fileFormat is the syntax Write uses for the lines of the file, see SetFileFormat
+	fileFormat EnvFileFormat
+	//format is the version declared by the header of the file, see EnvFormatVersion
+	format int
+	//warnings are what was found to be reinterpreted while reading the file
+	warnings []ParseWarning
+	//readOnly is set for the Envs returned by ReadOnly, and for merged and filtered results
+	readOnly bool
+	//public is set for the envs of apps and the global env, whose Write refreshes their redacted snapshot
+	public bool
+	//scope is the env of the dokku install this Env was loaded for, see Scope
+	scope Scope
 }
 
-//newEnvFromString creates an env from the given ENVFILE contents representation
+//newEnvFromString creates an env from the given ENVFILE contents representation.
+// The contents must be valid UTF-8
 func newEnvFromString(rep string) (env *Env, err error) {
-	envMap, err := godotenv.Unmarshal(rep)
+	if offset := invalidUTF8Offset(rep); offset >= 0 {
+		return nil, fmt.Errorf("Invalid UTF-8 at byte offset %d", offset)
+	}
+	format, rest := splitFormatHeader(rep)
+	envMap, err := godotenv.Unmarshal(rest)
+	order, layout := parseLayout(rest)
 	env = &Env{
 		name:     "<unknown>",
 		filename: "",
-		env:      envMap,
+		vars:     envMap,
+		order:    order,
+		layout:   layout,
+		format:   format,
+		warnings: findParseWarnings(rest, firstLineAfterHeader(rep, rest)),
 	}
 	return
 }
 
+//NewFromStringWithName creates an env from the given ENVFILE contents, such as a payload
+// received from another plugin. The name says where the contents came from, and is used in
+// errors and logs about the env. The env is not bound to a file, so it cannot be written
+func NewFromStringWithName(name string, rep string) (*Env, error) {
+	env, err := newEnvFromString(rep)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", name, err.Error())
+	}
+	env.name = name
+	return env, nil
+}
+
+//NewFromJSON creates an env from a json object mapping each key to its value as a string, such
+// as the output of `heroku config --json`. The name is used in errors about the env. The env is not
+// bound to a file, so it cannot be written
+func NewFromJSON(name string, rep []byte) (*Env, error) {
+	var values map[string]interface{}
+	if err := json.Unmarshal(rep, &values); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", name, err.Error())
+	}
+	env := &Env{name: name, vars: map[string]string{}}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s", name, err.Error())
+		}
+		value, ok := values[k].(string)
+		if !ok {
+			return nil, fmt.Errorf("Unable to parse %s: value of %s is not a string", name, k)
+		}
+		if err := env.Set(k, value); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: invalid value of %s: %s", name, k, err.Error())
+		}
+	}
+	return env, nil
+}
+
 //LoadAppEnv loads an environment for the given app
-func LoadAppEnv(appName string) (env *Env, err error) {
-	appfile, err := getAppFile(appName)
+func LoadAppEnv(appName string, opts ...LoadOption) (env *Env, err error) {
+	resolver := NewPathResolver(opts...)
+	appfile, err := resolver.AppFile(appName)
 	if err != nil {
 		return
 	}
-	return loadFromFile(appName, appfile)
+	return resolver.load(appName, appfile)
 }
 
-//LoadMergedAppEnv loads an app environment merged with the global environment
-func LoadMergedAppEnv(appName string) (env *Env, err error) {
-	env, err = LoadAppEnv(appName)
+//LoadMergedAppEnv loads an app environment merged with the global environment, as the app and
+// global layers of ResolveEffectiveEnv. The result is read-only, as it is not the env of either
+// file. A file given with WithFile has no global env to be merged with
+func LoadMergedAppEnv(appName string, opts ...LoadOption) (env *Env, err error) {
+	effective, err := ResolveEffectiveEnv(appName, "", SchedulerPhaseDeploy, opts...)
 	if err != nil {
-		return
+		return nil, err
 	}
-	global, err := LoadGlobalEnv()
+	return effective.Env, nil
+}
+
+//LoadGlobalEnv loads the global environment. A dokku install without a global ENV file has an
+// empty global env bound to where the file would be, which is only created once a key is set
+func LoadGlobalEnv(opts ...LoadOption) (*Env, error) {
+	resolver := NewPathResolver(opts...)
+	globalfile, err := resolver.GlobalFile()
 	if err != nil {
-		common.LogFail(err.Error())
+		return nil, err
 	}
-	global.Merge(env)
-	global.filename = ""
-	global.name = env.name
-	return global, err
+	return resolver.load("<global>", globalfile)
 }
 
-//LoadGlobalEnv loads the global environment
-func LoadGlobalEnv() (*Env, error) {
-	return loadFromFile("<global>", getGlobalFile())
+//GlobalExists reports whether the global ENV file exists, in either of the forms it is stored in,
+// for callers that must tell an empty global env from one that was never written
+func GlobalExists() bool {
+	globalfile, err := NewPathResolver().GlobalFile()
+	if err != nil {
+		return false
+	}
+	path, _ := envFileOnDisk(globalfile)
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+//Name returns the app this Env belongs to, <global> for the global env, or the name an
+// unbound Env was created with
+func (e *Env) Name() string {
+	return e.name
 }
 
 //Get an environment variable
 func (e *Env) Get(key string) (value string, ok bool) {
-	value, ok = e.env[key]
-	return
+	return e.lookup(key)
 }
 
 //GetDefault an environment variable or a default if it doesn't exist
 func (e *Env) GetDefault(key string, defaultValue string) string {
-	v, ok := e.env[key]
+	v, ok := e.lookup(key)
 	if !ok {
 		return defaultValue
 	}
 	return v
 }
 
+//GetFirst returns the value of the first of the given keys that is set, along with that key, for
+// keys being renamed that may be set under either name. Of a merged env, each key already has the
+// value that takes precedence
+func (e *Env) GetFirst(keys ...string) (value string, key string, ok bool) {
+	for _, k := range keys {
+		if value, ok = e.lookup(k); ok {
+			return value, k, true
+		}
+	}
+	return "", "", false
+}
+
 //GetBoolDefault gets the bool value of the given key with the given default
 //right now that is evaluated as `value != "0"`
 func (e *Env) GetBoolDefault(key string, defaultValue bool) bool {
@@ -106,56 +273,398 @@ func (e *Env) GetBoolDefault(key string, defaultValue bool) bool {
 	return v != "0"
 }
 
-//Set an environment variable
-func (e *Env) Set(key string, value string) {
-	e.env[key] = value
+//Set an environment variable. A value containing a NUL byte is rejected with ErrInvalidValue
+func (e *Env) Set(key string, value string) error {
+	if e.readOnly {
+		return ErrReadOnlyEnv
+	}
+	if strings.IndexByte(value, 0) >= 0 {
+		return ErrInvalidValue
+	}
+	if _, ok := e.values()[key]; !ok {
+		e.sortedKeys = nil
+		e.recordOrder(key)
+	}
+	e.values()[key] = value
+	return nil
+}
+
+//Unset an environment variable. Unsetting a key of a read-only Env fails with ErrReadOnlyEnv
+func (e *Env) Unset(key string) error {
+	if e.readOnly {
+		return ErrReadOnlyEnv
+	}
+	if _, ok := e.values()[key]; ok {
+		e.sortedKeys = nil
+		e.forgetOrder(key)
+	}
+	delete(e.values(), key)
+	return nil
+}
+
+//UnsetAll unsets the given keys, returning the keys that were removed and those that were not
+// set, each in the order given. A key given more than once is only reported once. A read-only Env
+// is left unchanged and fails with ErrReadOnlyEnv
+func (e *Env) UnsetAll(keys []string) (removed []string, absent []string, err error) {
+	if e.readOnly {
+		return nil, nil, ErrReadOnlyEnv
+	}
+	removed, absent = []string{}, []string{}
+	seen := map[string]bool{}
+	for _, k := range keys {
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if _, ok := e.values()[k]; ok {
+			e.Unset(k)
+			removed = append(removed, k)
+		} else {
+			absent = append(absent, k)
+		}
+	}
+	return removed, absent, nil
 }
 
-//Unset an environment variable
-func (e *Env) Unset(key string) {
-	delete(e.env, key)
+//Swap sets a key to newValue and returns the value it had before, and whether it was set.
+// Swapping a key of a read-only Env fails with ErrReadOnlyEnv
+func (e *Env) Swap(key string, newValue string) (old string, existed bool, err error) {
+	if e.readOnly {
+		return "", false, ErrReadOnlyEnv
+	}
+	old, existed = e.values()[key]
+	if !existed {
+		e.sortedKeys = nil
+		e.recordOrder(key)
+	}
+	e.values()[key] = newValue
+	return
+}
+
+//Take unsets a key and returns the value it had, and whether it was set. Taking a key of a
+// read-only Env fails with ErrReadOnlyEnv
+func (e *Env) Take(key string) (value string, existed bool, err error) {
+	if e.readOnly {
+		return "", false, ErrReadOnlyEnv
+	}
+	value, existed = e.values()[key]
+	e.Unset(key)
+	return
 }
 
 //Keys gets the keys in this environment
 func (e *Env) Keys() (keys []string) {
-	keys = make([]string, 0, len(e.env))
-	for k := range e.env {
+	sorted := e.sortKeys()
+	keys = make([]string, len(sorted))
+	copy(keys, sorted)
+	return
+}
+
+//sortKeys returns the cached sorted keys, sorting them first if needed.
+// The result is shared with the Env and must not be modified
+func (e *Env) sortKeys() []string {
+	if e.sortedKeys != nil {
+		return e.sortedKeys
+	}
+	values := e.values()
+	keys := make([]string, 0, len(values))
+	for k := range values {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
-	return
+	e.sortedKeys = keys
+	return keys
 }
 
 //Len returns the number of items in this environment
 func (e *Env) Len() int {
-	return len(e.env)
+	return len(e.values())
 }
 
-//Map returns the Env as a map
+//Map returns the Env as a map. The map must not be modified, use Set and Unset instead
 func (e *Env) Map() map[string]string {
-	return e.env
+	return e.values()
+}
+
+//Entry is a key of an Env along with its value
+type Entry struct {
+	Key   string
+	Value string
+}
+
+//EntriesSorted returns the entries of this Env sorted by key
+func (e *Env) EntriesSorted() []Entry {
+	keys := e.sortKeys()
+	entries := make([]Entry, len(keys))
+	for i, k := range keys {
+		entries[i] = Entry{Key: k, Value: e.vars[k]}
+	}
+	return entries
+}
+
+//Environ returns the entries of this Env as KEY=VALUE strings sorted by key, as used by
+// exec.Cmd.Env. If inheritParent is true they follow the environment of the current process,
+// from which any variable that this Env also sets is left out so that its value takes effect
+func (e *Env) Environ(inheritParent bool) []string {
+	environ := make([]string, 0, len(e.values()))
+	if inheritParent {
+		for _, entry := range os.Environ() {
+			key := entry
+			if i := strings.IndexByte(entry, '='); i >= 0 {
+				key = entry[:i]
+			}
+			if _, ok := e.values()[key]; !ok {
+				environ = append(environ, entry)
+			}
+		}
+	}
+	for _, k := range e.sortKeys() {
+		environ = append(environ, k+"="+e.values()[k])
+	}
+	return environ
+}
+
+//clone returns a copy of the Env that shares no state with the receiver. The copy is writable
+// even if the receiver is read-only, so that derived Envs can be built from it
+func (e *Env) clone() *Env {
+	//a lazily merged env stays so, as its layers are never modified
+	var envMap map[string]string
+	var order []string
+	if e.layers == nil {
+		envMap = make(map[string]string, len(e.vars))
+		for k, v := range e.vars {
+			envMap[k] = v
+		}
+	}
+	if e.order != nil {
+		order = make([]string, len(e.order))
+		copy(order, e.order)
+	}
+	//the layout is never modified once read, so it can be shared
+	return &Env{
+		name:       e.name,
+		filename:   e.filename,
+		vars:       envMap,
+		layers:     e.layers,
+		order:      order,
+		ordered:    e.ordered,
+		layout:     e.layout,
+		compressed: e.compressed,
+		fileFormat: e.fileFormat,
+		format:     e.format,
+		warnings:   e.warnings,
+		scope:      e.scope,
+	}
 }
 
 func (e *Env) String() string {
 	return e.EnvfileString()
 }
 
-//Merge merges the given environment on top of the receiver
-func (e *Env) Merge(other *Env) {
-	for _, k := range other.Keys() {
-		e.Set(k, other.GetDefault(k, ""))
+//GoString describes this Env for %#v without revealing any of its values
+func (e *Env) GoString() string {
+	return fmt.Sprintf("config.Env{name: %q, filename: %q, keys: %d}", e.name, e.filename, len(e.values()))
+}
+
+//Merge merges the given environment on top of the receiver. Keys new to the receiver are
+// appended to its order in the order of other. Merging into a read-only Env fails with ErrReadOnlyEnv
+func (e *Env) Merge(other *Env) error {
+	if e.readOnly {
+		return ErrReadOnlyEnv
+	}
+	e.mergeScope(other)
+	for _, k := range other.OrderedKeys() {
+		if _, ok := e.values()[k]; !ok {
+			e.sortedKeys = nil
+			e.recordOrder(k)
+		}
+		e.values()[k] = other.values()[k]
+	}
+	return nil
+}
+
+//MergeMissing sets the keys of other that are not set in this Env, leaving the values of those
+// that are unchanged, and returns the keys that were added sorted. Merging into a read-only Env
+// fails with ErrReadOnlyEnv
+func (e *Env) MergeMissing(other *Env) ([]string, error) {
+	if e.readOnly {
+		return nil, ErrReadOnlyEnv
+	}
+	e.mergeScope(other)
+	added := []string{}
+	for _, k := range other.sortKeys() {
+		if _, ok := e.values()[k]; ok {
+			continue
+		}
+		e.sortedKeys = nil
+		e.recordOrder(k)
+		e.values()[k] = other.values()[k]
+		added = append(added, k)
 	}
+	return added, nil
 }
 
-//Write an Env back to the file it was read from as an exportfile
+//MergeStrategy decides the value of a key that two envs set to different values when one is
+// merged into the other with MergeWith
+type MergeStrategy int
+
+const (
+	//MergeOverwrite takes the value of the env merged in, as Merge does
+	MergeOverwrite MergeStrategy = iota
+	//MergeKeep keeps the value of the env merged into
+	MergeKeep
+	//MergeFail changes nothing if there are any conflicts, returning a *MergeConflictError
+	MergeFail
+)
+
+//MergeResult lists what MergeWith did with each key of the env merged in that was not already set
+// to the same value, sorted
+type MergeResult struct {
+	Added       []string
+	Overwritten []string
+	Kept        []string
+}
+
+//MergeConflictError is returned by MergeWith with MergeFail, listing the conflicting keys sorted
+type MergeConflictError struct {
+	Keys []string
+}
+
+func (e *MergeConflictError) Error() string {
+	return fmt.Sprintf("%d key(s) are already set to another value: %s", len(e.Keys), strings.Join(e.Keys, ", "))
+}
+
+//Conflicts returns the keys that both this Env and other set, to different values, sorted
+func (e *Env) Conflicts(other *Env) []string {
+	conflicts := []string{}
+	for _, k := range other.sortKeys() {
+		if current, ok := e.values()[k]; ok && current != other.values()[k] {
+			conflicts = append(conflicts, k)
+		}
+	}
+	return conflicts
+}
+
+//MergeWith merges other into the receiver as Merge does, with the keys both set to different values
+// resolved by strategy. Merging into a read-only Env fails with ErrReadOnlyEnv
+func (e *Env) MergeWith(other *Env, strategy MergeStrategy) (MergeResult, error) {
+	result := MergeResult{Added: []string{}, Overwritten: []string{}, Kept: []string{}}
+	if e.readOnly {
+		return result, ErrReadOnlyEnv
+	}
+	conflicts := e.Conflicts(other)
+	switch strategy {
+	case MergeOverwrite:
+		result.Overwritten = conflicts
+	case MergeKeep:
+		result.Kept = conflicts
+	case MergeFail:
+		if len(conflicts) > 0 {
+			return result, &MergeConflictError{Keys: conflicts}
+		}
+	default:
+		return result, fmt.Errorf("Unknown merge strategy: %d", strategy)
+	}
+	kept := make(map[string]bool, len(result.Kept))
+	for _, k := range result.Kept {
+		kept[k] = true
+	}
+	e.mergeScope(other)
+	for _, k := range other.OrderedKeys() {
+		if _, ok := e.values()[k]; !ok {
+			e.sortedKeys = nil
+			e.recordOrder(k)
+			result.Added = append(result.Added, k)
+		} else if kept[k] {
+			continue
+		}
+		e.values()[k] = other.values()[k]
+	}
+	sort.Strings(result.Added)
+	return result, nil
+}
+
+//Write an Env back to the file it was read from, in the syntax set by SetFileFormat.
+// The file is replaced atomically, and a symlinked file is written through to its target.
+// Write neither locks the file nor fires triggers, use Update, SetMany or UnsetMany to change config.
+// The file is written sorted by key, unless PreserveOrder was called, and keeps its format header.
+// An Env another env of the dokku install was merged into fails with an ErrScopeMismatch, see Scope
 func (e *Env) Write() error {
+	if e.readOnly {
+		return ErrReadOnlyEnv
+	}
 	if e.filename == "" {
-		return errors.New("this Env was created unbound to a file")
+		return e.errNotBound()
 	}
-	return godotenv.Write(e.Map(), e.filename)
+	if e.scope.Kind == ScopeMerged {
+		return &ErrScopeMismatch{Expected: scopeForName(e.name), Actual: e.scope}
+	}
+	contents, err := e.fileContents()
+	if err != nil {
+		return err
+	}
+	if err := writeEnvContents(e.filename, []byte(contents), e.compressed); err != nil {
+		return err
+	}
+	if e.public {
+		refreshWrittenSnapshot(e)
+	}
+	return nil
+}
+
+//fileContents returns the contents Write writes to the file
+func (e *Env) fileContents() (string, error) {
+	if e.ordered {
+		return terminateLines(formatHeader(e.format) + e.orderedString()), nil
+	}
+	contents, err := godotenv.Marshal(e.values())
+	if err != nil {
+		return "", err
+	}
+	//values are escaped onto a single line, so every line assigns a key
+	if e.fileFormat == EnvFileFormatExportfile && contents != "" {
+		contents = "export " + strings.Replace(contents, "\n", "\nexport ", -1)
+	}
+	return terminateLines(formatHeader(e.format) + contents), nil
+}
+
+//terminateLines gives the contents of an ENV file \n line endings and ends them with exactly one
+// newline, as shell loops reading the file with read drop a last line without one. Empty contents
+// are left empty
+func terminateLines(contents string) string {
+	contents = strings.TrimRight(strings.Replace(contents, "\r\n", "\n", -1), "\n")
+	if contents == "" {
+		return ""
+	}
+	return contents + "\n"
+}
+
+//SetCompressed sets whether Write stores the file gzip-compressed, next to the file as <filename>.gz.
+// Envs keep the form their file was stored in, and loaders read either form
+func (e *Env) SetCompressed(compressed bool) {
+	e.compressed = compressed
 }
 
-//Export the Env in the given format
+//ReadOnly returns a copy of this Env that cannot be changed: Write and every method changing its
+// keys, such as Set, Unset and Merge, return ErrReadOnlyEnv. The copy keeps its file to read key
+// metadata from, and is meant to be handed to code that only has to read the config
+func (e *Env) ReadOnly() *Env {
+	frozen := e.clone()
+	frozen.readOnly = true
+	return frozen
+}
+
+//IsReadOnly reports whether this Env cannot be changed, see ReadOnly
+func (e *Env) IsReadOnly() bool {
+	return e.readOnly
+}
+
+func (e *Env) errNotBound() error {
+	return fmt.Errorf("env '%s' is not bound to a file", e.name)
+}
+
+//Export the Env in the given format. Values that the format cannot represent are
+// written as-is, use ExportWithOptions to have them reported instead. An unknown format exports nothing
 func (e *Env) Export(format ExportFormat) string {
 	switch format {
 	case ExportFormatExports:
@@ -167,19 +676,195 @@ func (e *Env) Export(format ExportFormat) string {
 	case ExportFormatShell:
 		return e.ShellString()
 	case ExportFormatPretty:
-		return prettyPrintEnvEntries("", e.Map())
+		return prettyPrintSortedEntries("", e.sortKeys(), e.values())
+	case ExportFormatJSON:
+		return e.JSONString()
+	case ExportFormatNul, ExportFormatNetstring:
+		var b strings.Builder
+		e.streamTo(&b, streamFormatter(format), ExportOptions{})
+		return b.String()
+	case ExportFormatCompose:
+		rep, _ := e.composeString(ExportOptions{})
+		return rep
+	case ExportFormatDockerEnvfile:
+		rep, _ := e.DockerEnvFileString()
+		return rep
+	case ExportFormatJSONNested:
+		rep, _ := e.nestedJSONString(ExportOptions{})
+		return rep
 	default:
-		common.LogFail(fmt.Sprintf("Unknown export format: %v", format))
 		return ""
 	}
 }
 
+//ExportWithOptions exports the Env in the given format, quoting values as specified by opts.
+// The shell formats keep arbitrary bytes but cannot represent a NUL byte, while the envfile,
+// pretty, compose and json-nested formats are text and also require valid UTF-8. The
+// docker-envfile format additionally cannot represent a newline. Any case is an error naming the key
+func (e *Env) ExportWithOptions(format ExportFormat, opts ExportOptions) (string, error) {
+	e, opts, err := e.applyKeyTransform(format, opts)
+	if err != nil {
+		return "", err
+	}
+	switch format {
+	case ExportFormatEnvfile, ExportFormatPretty, ExportFormatJSON:
+		if err := e.checkText(); err != nil {
+			return "", err
+		}
+		if !opts.Ordered || format == ExportFormatJSON {
+			return e.Export(format), nil
+		}
+		if format == ExportFormatPretty {
+			return prettyPrintSortedEntries("", e.exportKeys(opts), e.values()), nil
+		}
+		lines := make([]string, 0, len(e.values()))
+		for _, k := range e.exportKeys(opts) {
+			lines = append(lines, marshalEnvLine(k, e.values()[k]))
+		}
+		return strings.Join(lines, "\n"), nil
+	case ExportFormatExports:
+		return e.stringWithOptions("export ", "\n", opts)
+	case ExportFormatDockerArgs:
+		return e.stringWithOptions("--env=", " ", opts)
+	case ExportFormatShell:
+		return e.stringWithOptions("", " ", opts)
+	case ExportFormatNul, ExportFormatNetstring:
+		var b strings.Builder
+		err := e.streamTo(&b, streamFormatter(format), opts)
+		return b.String(), err
+	case ExportFormatCompose:
+		if err := e.checkText(); err != nil {
+			return "", err
+		}
+		return e.composeString(opts)
+	case ExportFormatDockerEnvfile:
+		rep, warnings := e.dockerEnvFileString(e.exportKeys(opts))
+		if len(warnings) > 0 {
+			return "", errors.New(warnings[0])
+		}
+		return rep, nil
+	case ExportFormatJSONNested:
+		if err := e.checkText(); err != nil {
+			return "", err
+		}
+		return e.nestedJSONString(opts)
+	default:
+		return "", &ValidationError{Message: fmt.Sprintf("Unknown export format: %v", format)}
+	}
+}
+
 //EnvfileString returns the contents of this Env in dotenv format
 func (e *Env) EnvfileString() string {
 	rep, _ := godotenv.Marshal(e.Map())
 	return rep
 }
 
+//JSONString returns the contents of this Env as a json object mapping each key to an
+// object holding its value, along with its description and tags if it has any
+func (e *Env) JSONString() string {
+	var b strings.Builder
+	if err := e.writeJSON(&b); err != nil {
+		return ""
+	}
+	return b.String()
+}
+
+//writeJSON writes the json object returned by JSONString to w one key at a time, with each value
+// written as it is escaped so that not even the largest of them is copied
+func (e *Env) writeJSON(w textWriter) error {
+	w.WriteByte('{')
+	for i, k := range e.sortKeys() {
+		name, err := json.Marshal(k)
+		if err != nil {
+			return err
+		}
+		//the entry is marshalled with an empty value, which is then written in its place
+		entry, err := json.Marshal(e.jsonEntry(k, ""))
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.Write(name)
+		w.WriteString(`:{"value":`)
+		writeJSONQuoted(w, e.values()[k])
+		w.Write(entry[len(`{"value":""`):])
+	}
+	w.WriteByte('}')
+	return nil
+}
+
+//jsonASCIIEscapes holds what json.Marshal writes in place of each of the ASCII characters it
+// escapes, taken from it so that writeJSONQuoted escapes them alike whatever the version of go
+var jsonASCIIEscapes = func() (escapes [utf8.RuneSelf]string) {
+	for c := range escapes {
+		quoted, _ := json.Marshal(string(rune(c)))
+		if escaped := string(quoted[1 : len(quoted)-1]); escaped != string(rune(c)) {
+			escapes[c] = escaped
+		}
+	}
+	return
+}()
+
+//writeJSONQuoted writes the value to w as a json string, escaped as json.Marshal escapes it
+func writeJSONQuoted(w textWriter, value string) {
+	w.WriteByte('"')
+	start := 0
+	for i := 0; i < len(value); {
+		c := value[i]
+		if c < utf8.RuneSelf {
+			if escaped := jsonASCIIEscapes[c]; escaped != "" {
+				w.WriteString(value[start:i])
+				w.WriteString(escaped)
+				start = i + 1
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(value[i:])
+		if r == utf8.RuneError && size == 1 || r == '\u2028' || r == '\u2029' {
+			w.WriteString(value[start:i])
+			if r == utf8.RuneError {
+				w.WriteString(`\ufffd`)
+			} else {
+				fmt.Fprintf(w, `\u%04x`, r)
+			}
+			start = i + size
+		}
+		i += size
+	}
+	w.WriteString(value[start:])
+	w.WriteByte('"')
+}
+
+//jsonEntry is how a key is exported in the json format
+type jsonEntry struct {
+	Value string `json:"value"`
+	KeyMetadata
+}
+
+//jsonEntries returns the keys of this Env as they are exported in the json format, with their
+// values replaced by RedactedValue unless showValues is set
+func (e *Env) jsonEntries(showValues bool) map[string]jsonEntry {
+	entries := make(map[string]jsonEntry, len(e.values()))
+	for k, v := range e.values() {
+		if !showValues {
+			v = RedactedValue
+		}
+		entries[k] = e.jsonEntry(k, v)
+	}
+	return entries
+}
+
+//jsonEntry returns a key as it is exported in the json format, with the given value
+func (e *Env) jsonEntry(key string, value string) jsonEntry {
+	//provenance describes changes to the file of this Env, which mean nothing once exported
+	m := e.KeyMetadata(key)
+	m.Provenance = nil
+	return jsonEntry{Value: value, KeyMetadata: m}
+}
+
 //ExportfileString returns the contents of this Env as bash exports
 func (e *Env) ExportfileString() string {
 	return e.stringWithPrefixAndSeparator("export ", "\n")
@@ -196,24 +881,197 @@ func (e *Env) ShellString() string {
 	return e.stringWithPrefixAndSeparator("", " ")
 }
 
+//DefaultBundleEnvfileEntry is the name of the entry holding the whole env that config:bundle
+// --include-envfile adds to the tarfile. Keys cannot start with a dot, so it never clashes with one
+const DefaultBundleEnvfileEntry = ".env"
+
+//BundleOptions describe what ExportBundleWithOptions writes besides the file of each key
+type BundleOptions struct {
+	//EnvfileEntry, if set, is the name of an entry appended to the tarfile holding the whole Env in
+	// the envfile format. It must not be the name of a key
+	EnvfileEntry string
+	//Gzip compresses the tarfile with gzip. The gzip header holds neither a name nor a time, so the
+	// same Env always gives the same bytes
+	Gzip bool
+}
+
 //ExportBundle writes a tarfile of the environment to the given io.Writer.
 // for every environment variable there is a file with the variable's key
-// with its content set to the variable's value
+// with its content set to the variable's value. Files of keys that are tagged secret or
+// whose name looks sensitive have mode 0400, the others 0600. An empty Env is a tarfile without entries
 func (e *Env) ExportBundle(dest io.Writer) error {
-	tarfile := tar.NewWriter(dest)
-	defer tarfile.Close()
+	return e.ExportBundleWithOptions(dest, BundleOptions{})
+}
 
-	for _, k := range e.Keys() {
-		val, _ := e.Get(k)
-		valbin := []byte(val)
+//ExportBundleWithOptions writes a tarfile of the environment as ExportBundle does, along with the
+// entries asked for by opts. Every entry is written from this Env, so they always agree
+func (e *Env) ExportBundleWithOptions(dest io.Writer, opts BundleOptions) error {
+	var envfile []byte
+	secret := false
+	for _, k := range e.sortKeys() {
+		secret = secret || IsSensitiveKey(k) || e.KeyMetadata(k).HasTag(TagSecret)
+	}
+	if opts.EnvfileEntry != "" {
+		if opts.EnvfileEntry == "." || opts.EnvfileEntry == ".." || strings.ContainsAny(opts.EnvfileEntry, "/\x00") {
+			return &ValidationError{Message: fmt.Sprintf("Invalid name for the envfile entry: '%s'", opts.EnvfileEntry)}
+		}
+		if _, ok := e.values()[opts.EnvfileEntry]; ok {
+			return &ValidationError{Message: fmt.Sprintf("The envfile entry %s has the name of a key, choose another name for it", opts.EnvfileEntry)}
+		}
+		rep, err := e.ExportWithOptions(ExportFormatEnvfile, ExportOptions{})
+		if err != nil {
+			return err
+		}
+		if rep != "" {
+			rep += "\n"
+		}
+		envfile = []byte(rep)
+	}
 
+	var compressed *gzip.Writer
+	if opts.Gzip {
+		compressed = gzip.NewWriter(dest)
+		dest = compressed
+	}
+	tarfile := tar.NewWriter(dest)
+	write := func(name string, mode int64, content []byte) error {
 		header := &tar.Header{
-			Name: k,
-			Mode: 0600,
-			Size: int64(len(valbin)),
+			Name: name,
+			Mode: mode,
+			Size: int64(len(content)),
+		}
+		if err := tarfile.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tarfile.Write(content)
+		return err
+	}
+	for _, k := range e.sortKeys() {
+		//secrets are made read-only for whoever extracts the bundle
+		mode := int64(0600)
+		if IsSensitiveKey(k) || e.KeyMetadata(k).HasTag(TagSecret) {
+			mode = 0400
 		}
-		tarfile.WriteHeader(header)
-		tarfile.Write(valbin)
+		if err := write(k, mode, []byte(e.values()[k])); err != nil {
+			return err
+		}
+	}
+	//the envfile holds every value, so it is as read-only as the most secret of them
+	if opts.EnvfileEntry != "" {
+		mode := int64(0600)
+		if secret {
+			mode = 0400
+		}
+		if err := write(opts.EnvfileEntry, mode, envfile); err != nil {
+			return err
+		}
+	}
+	//closing writes the end of the archive, which is all an empty bundle holds
+	if err := tarfile.Close(); err != nil {
+		return err
+	}
+	if compressed != nil {
+		return compressed.Close()
+	}
+	return nil
+}
+
+//FormatOptions describe how FormatWith writes the entries of an Env, each as
+// <Prefix><KEY>=<quoted value> with Separator between them
+type FormatOptions struct {
+	Prefix    string
+	Separator string
+	//Quote is the quoting of values not written as $'...' strings. The default is QuoteSingle
+	Quote QuoteStyle
+	//EscapeControlChars writes values holding control characters as bash $'...' strings
+	EscapeControlChars bool
+	//Ordered lists keys in OrderedKeys order rather than sorted
+	Ordered bool
+	//KeyTransform, if set, returns the name each key is written as, which must be a valid key and
+	// must not be the name of another key once transformed
+	KeyTransform func(key string) string
+	//SkipKeys are left out of the output
+	SkipKeys []string
+}
+
+//FormatWith writes the entries of this Env as described by opts. Values holding a NUL byte cannot
+// be written and are an error naming the key, as are keys that transform into an invalid or
+// duplicate name
+func (e *Env) FormatWith(opts FormatOptions) (string, error) {
+	keys, names, size, err := e.formatKeys(opts)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.Grow(size)
+	if err := e.writeFormatted(&b, keys, names, opts); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+//formatTo writes the entries of this Env to w as FormatWith returns them
+func (e *Env) formatTo(w textWriter, opts FormatOptions) error {
+	keys, names, _, err := e.formatKeys(opts)
+	if err != nil {
+		return err
+	}
+	return e.writeFormatted(w, keys, names, opts)
+}
+
+//formatKeys returns the keys FormatWith writes in order, the name each of them is written as and
+// about how many bytes they take
+func (e *Env) formatKeys(opts FormatOptions) (keys []string, names map[string]string, size int, err error) {
+	skip := make(map[string]bool, len(opts.SkipKeys))
+	for _, k := range opts.SkipKeys {
+		skip[k] = true
+	}
+	keys = make([]string, 0, len(e.values()))
+	names = make(map[string]string, len(e.values()))
+	transformed := map[string]string{}
+	for _, k := range e.exportKeys(ExportOptions{Ordered: opts.Ordered}) {
+		if skip[k] {
+			continue
+		}
+		name := k
+		if opts.KeyTransform != nil {
+			name = opts.KeyTransform(k)
+			if err := validateKey(name); err != nil {
+				return nil, nil, 0, fmt.Errorf("Key %s cannot be exported as %s: %s", k, name, err.Error())
+			}
+			if other, ok := transformed[name]; ok {
+				return nil, nil, 0, fmt.Errorf("Keys %s and %s would both be exported as %s", other, k, name)
+			}
+			transformed[name] = k
+		}
+		keys = append(keys, k)
+		names[k] = name
+		size += len(opts.Prefix) + len(name) + len(e.values()[k]) + len("=''") + len(opts.Separator)
+	}
+	return keys, names, size, nil
+}
+
+//writeFormatted writes the given keys to w under their names as FormatWith does. A value holding a
+// NUL byte is an error before anything is written
+func (e *Env) writeFormatted(w textWriter, keys []string, names map[string]string, opts FormatOptions) error {
+	for _, k := range keys {
+		if strings.IndexByte(e.values()[k], 0) >= 0 {
+			return fmt.Errorf("Value of %s contains a NUL byte and cannot be exported", k)
+		}
+	}
+	for i, k := range keys {
+		if i > 0 {
+			w.WriteString(opts.Separator)
+		}
+		w.WriteString(opts.Prefix)
+		w.WriteString(names[k])
+		w.WriteString("=")
+		v := e.values()[k]
+		if opts.EscapeControlChars && hasControlChars(v) {
+			writeANSICQuoted(w, v)
+			continue
+		}
+		writeQuoted(w, v, opts.Quote)
 	}
 	return nil
 }
@@ -221,76 +1079,244 @@ func (e *Env) ExportBundle(dest io.Writer) error {
 //stringWithPrefixAndSeparator makes a string of the environment
 // with the given prefix and separator for each entry
 func (e *Env) stringWithPrefixAndSeparator(prefix string, separator string) string {
-	keys := e.Keys()
-	entries := make([]string, len(keys))
-	for i, k := range keys {
-		v := singleQuoteEscape(e.env[k])
-		entries[i] = fmt.Sprintf("%s%s='%s'", prefix, k, v)
+	rep, _ := e.FormatWith(FormatOptions{Prefix: prefix, Separator: separator})
+	return rep
+}
+
+//stringWithOptions is stringWithPrefixAndSeparator with values quoted according to opts
+func (e *Env) stringWithOptions(prefix string, separator string, opts ExportOptions) (string, error) {
+	return e.FormatWith(opts.formatOptions(prefix, separator))
+}
+
+//formatOptions returns the FormatOptions writing entries with the given prefix and separator, quoted
+// according to these options
+func (o ExportOptions) formatOptions(prefix string, separator string) FormatOptions {
+	return FormatOptions{
+		Prefix:             prefix,
+		Separator:          separator,
+		Quote:              o.Quoting,
+		EscapeControlChars: o.EscapeControlChars,
+		Ordered:            o.Ordered,
+		KeyTransform:       o.KeyTransform,
 	}
-	return strings.Join(entries, separator)
 }
 
-//singleQuoteEscape escapes the value as if it were shell-quoted in single quotes
-func singleQuoteEscape(value string) string { // so that 'esc'aped' -> 'esc'\''aped'
+//SingleQuoteEscape escapes the value as if it were shell-quoted in single quotes
+func SingleQuoteEscape(value string) string { // so that 'esc'aped' -> 'esc'\''aped'
 	return strings.Replace(value, "'", "'\\''", -1)
 }
 
+//DoubleQuoteEscape escapes the value as if it were shell-quoted in double quotes, so that
+// "co$t" -> "co\$t". History expansion of ! is not escaped, as it only happens in interactive shells
+func DoubleQuoteEscape(value string) string {
+	var b strings.Builder
+	writeDoubleQuoteEscaped(&b, value)
+	return b.String()
+}
+
+//writeQuoted writes the value to b quoted in the given style
+func writeQuoted(b textWriter, value string, style QuoteStyle) {
+	if style == QuoteMinimal {
+		if isShellSafe(value) {
+			b.WriteString(value)
+			return
+		}
+		//each ' costs three more bytes single quoted, each of \ " $ ` one more byte double quoted
+		style = QuoteSingle
+		if strings.Count(value, "'")*3 > strings.Count(value, "\\")+strings.Count(value, "\"")+strings.Count(value, "$")+strings.Count(value, "`") {
+			style = QuoteDouble
+		}
+	}
+	if style == QuoteDouble {
+		b.WriteString("\"")
+		writeDoubleQuoteEscaped(b, value)
+		b.WriteString("\"")
+		return
+	}
+	b.WriteString("'")
+	writeSingleQuoteEscaped(b, value)
+	b.WriteString("'")
+}
+
+//writeDoubleQuoteEscaped writes the value to b escaped as in DoubleQuoteEscape
+func writeDoubleQuoteEscaped(b textWriter, value string) {
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '"', '$', '`':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+}
+
+//isShellSafe reports whether the value can be written unquoted, as it is not empty and holds
+// no character that the shell would split on, expand or otherwise treat specially
+func isShellSafe(value string) bool {
+	if value == "" {
+		return false
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.IndexByte("@%+=:,./_-", c) >= 0) {
+			return false
+		}
+	}
+	return true
+}
+
+//writeSingleQuoteEscaped writes the value to b escaped as in SingleQuoteEscape
+func writeSingleQuoteEscaped(b textWriter, value string) {
+	for {
+		i := strings.IndexByte(value, '\'')
+		if i < 0 {
+			b.WriteString(value)
+			return
+		}
+		b.WriteString(value[:i])
+		b.WriteString("'\\''")
+		value = value[i+1:]
+	}
+}
+
+//checkText returns an error naming the first key whose value is not NUL-free valid UTF-8
+func (e *Env) checkText() error {
+	for _, k := range e.sortKeys() {
+		v := e.values()[k]
+		if strings.IndexByte(v, 0) >= 0 {
+			return fmt.Errorf("Value of %s contains a NUL byte and cannot be exported", k)
+		}
+		if offset := invalidUTF8Offset(v); offset >= 0 {
+			return fmt.Errorf("Value of %s contains invalid UTF-8 at byte offset %d and cannot be exported", k, offset)
+		}
+	}
+	return nil
+}
+
+//invalidUTF8Offset returns the byte offset of the first invalid UTF-8 sequence, or -1
+func invalidUTF8Offset(s string) int {
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			return i
+		}
+		i += size
+	}
+	return -1
+}
+
+//hasControlChars reports whether the value contains a C0 control character or DEL
+func hasControlChars(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] < 0x20 || value[i] == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+//writeANSICQuoted writes the value to b as a bash $'...' string, escaping control characters
+func writeANSICQuoted(b textWriter, value string) {
+	b.WriteString("$'")
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\':
+			b.WriteString(`\\`)
+		case '\'':
+			b.WriteString(`\'`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if c < 0x20 || c == 0x7f {
+				fmt.Fprintf(b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteString("'")
+}
+
 //prettyPrintEnvEntries in columns
 func prettyPrintEnvEntries(prefix string, entries map[string]string) string {
-	colConfig := columnize.DefaultConfig()
-	colConfig.Prefix = prefix
-	colConfig.Delim = "\x00"
-
 	//some keys may be prefixes of each other so we need to sort them rather than the resulting lines
 	keys := make([]string, 0, len(entries))
 	for k := range entries {
 		keys = append(keys, k)
 	}
 	sort.Strings(keys)
+	return prettyPrintSortedEntries(prefix, keys, entries)
+}
+
+//prettyPrintSortedEntries in columns, in the order of the given keys, with sealed values shown as <sealed>
+func prettyPrintSortedEntries(prefix string, keys []string, entries map[string]string) string {
+	colConfig := columnize.DefaultConfig()
+	colConfig.Prefix = prefix
+	colConfig.Delim = "\x00"
 
 	lines := make([]string, 0, len(keys))
 	for _, k := range keys {
-		lines = append(lines, fmt.Sprintf("%s:\x00%s", k, entries[k]))
+		lines = append(lines, k+":\x00"+displayValue(entries[k]))
 	}
 	return columnize.Format(lines, colConfig)
 }
 
+//loadFromFile loads the Env of the given name bound to filename. A missing file is an empty Env that
+// is created once written, as for an app that never had a key set, while a file that cannot be read
+// is an error so that it is never replaced by what little was read of it
 func loadFromFile(name string, filename string) (env *Env, err error) {
 	envMap := make(map[string]string)
-	if _, err := os.Stat(filename); err == nil {
-		envMap, err = godotenv.Read(filename)
+	order, layout := []string{}, (*fileLayout)(nil)
+	format := 1
+	var warnings []ParseWarning
+	contents, compressed, readErr := readEnvFile(filename)
+	if readErr != nil && !os.IsNotExist(readErr) {
+		return nil, fmt.Errorf("Unable to read config for %s: %s", name, readErr.Error())
+	}
+	if readErr == nil {
+		//values keep their bytes so that a corrupted file can still be loaded and fixed
+		if offset := invalidUTF8Offset(string(contents)); offset >= 0 {
+			common.LogWarn(fmt.Sprintf("%s contains invalid UTF-8 at byte offset %d", filename, offset))
+		}
+		var rest string
+		if format, rest = splitFormatHeader(string(contents)); format > EnvFormatVersion {
+			common.LogWarn(fmt.Sprintf("%s uses ENV format version %d, which is newer than this version of dokku supports", filename, format))
+		}
+		//lines after one that cannot be parsed are dropped, the keys before it are kept
+		envMap, _ = godotenv.Unmarshal(rest)
+		order, layout = parseLayout(rest)
+		warnings = findFileParseWarnings(rest, firstLineAfterHeader(string(contents), rest))
 	}
 
+	env = &Env{
+		name:       name,
+		filename:   filename,
+		vars:       envMap,
+		order:      order,
+		layout:     layout,
+		compressed: compressed,
+		format:     format,
+		warnings:   warnings,
+	}
 	dirty := false
 	for k := range envMap {
 		if err := validateKey(k); err != nil {
-			common.LogInfo1(fmt.Sprintf("Deleting invalid key %s from config for %s", k, name))
+			common.LogInfo1Quiet(fmt.Sprintf("Deleting invalid key %s from config for %s", k, name))
 			delete(envMap, k)
 			dirty = true
 		}
 	}
 	if dirty {
-		if err := godotenv.Write(envMap, filename); err != nil {
-			common.LogFail(fmt.Sprintf("Error writing back config for %s after removing invalid keys", name))
+		//the file is rewritten sorted
+		env.order, env.layout = nil, nil
+		if err := env.Write(); err != nil {
+			return nil, fmt.Errorf("Error writing back config for %s after removing invalid keys: %s", name, err.Error())
 		}
 	}
-
-	env = &Env{
-		name:     name,
-		filename: filename,
-		env:      envMap,
-	}
 	return
 }
-
-func getAppFile(appName string) (string, error) {
-	err := common.VerifyAppName(appName)
-	if err != nil {
-		return "", err
-	}
-	return filepath.Join(common.MustGetEnv("DOKKU_ROOT"), appName, "ENV"), nil
-}
-
-func getGlobalFile() string {
-	return filepath.Join(common.MustGetEnv("DOKKU_ROOT"), "ENV")
-}
@@ -1,6 +1,14 @@
 package config
 
 import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -37,6 +45,21 @@ func TestExportfileErrors(t *testing.T) {
 	Expect(err).To(HaveOccurred())
 }
 
+func TestNewFromStringWithName(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := NewFromStringWithName("app.json defaults", "FOO='bar'")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Name()).To(Equal("app.json defaults"))
+	Expect(env.Write()).To(MatchError("env 'app.json defaults' is not bound to a file"))
+	Expect(env.Reload()).To(MatchError("env 'app.json defaults' is not bound to a file"))
+	Expect(fmt.Sprintf("%#v", env)).To(Equal(`config.Env{name: "app.json defaults", filename: "", keys: 1}`))
+
+	_, err = NewFromStringWithName("stdin of config-import", "A='caf\xe9'")
+	Expect(err).To(MatchError("Unable to parse stdin of config-import: Invalid UTF-8 at byte offset 6"))
+
+	Expect(NewForTest(t, nil).Name()).To(Equal("<test>"))
+}
+
 func TestMerge(t *testing.T) {
 	RegisterTestingT(t)
 	e, _ := newEnvFromString("FOO='bar'")
@@ -59,6 +82,278 @@ func TestExport(t *testing.T) {
 	Expect(e.Export(ExportFormatPretty)).To(Equal("BAR:  BAZ\nBAZ:  a\nb\nFOO:  b'ar"))
 }
 
+func TestExportWithOptions(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("CR", "a\rb", "PLAIN", "it's", "TAB", "a\tb", "NL", "a\nb", "BELL", "\a'\\\x7f"))
+	opts := ExportOptions{EscapeControlChars: true}
+
+	exported, err := e.ExportWithOptions(ExportFormatExports, opts)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal(`export BELL=$'\x07\'\\\x7f'` + "\n" +
+		`export CR=$'a\rb'` + "\n" +
+		`export NL=$'a\nb'` + "\n" +
+		`export PLAIN='it'\''s'` + "\n" +
+		`export TAB=$'a\tb'`))
+
+	exported, err = e.ExportWithOptions(ExportFormatDockerArgs, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal(e.DockerArgsString()))
+
+}
+
+func TestInvalidValues(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("LATIN1", "caf\xe9"))
+	Expect(e.Set("NUL", "a\x00b")).To(Equal(ErrInvalidValue))
+	_, ok := e.Get("NUL")
+	Expect(ok).To(BeFalse())
+
+	_, err := newEnvFromString("A='ok'\nB='caf\xe9'")
+	Expect(err).To(MatchError("Invalid UTF-8 at byte offset 13"))
+
+	//shell quoting keeps arbitrary bytes, the text formats refuse them
+	exported, err := e.ExportWithOptions(ExportFormatExports, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("export LATIN1='caf\xe9'"))
+	_, err = e.ExportWithOptions(ExportFormatEnvfile, ExportOptions{})
+	Expect(err).To(MatchError("Value of LATIN1 contains invalid UTF-8 at byte offset 3 and cannot be exported"))
+	_, err = e.ExportWithOptions(ExportFormatPretty, ExportOptions{})
+	Expect(err).To(HaveOccurred())
+
+	//a NUL can only get in through a corrupted file and is only kept by the bundle
+	e = NewForTest(t, pairs("NUL", "a\x00b"))
+	for _, format := range []ExportFormat{ExportFormatExports, ExportFormatShell, ExportFormatDockerArgs, ExportFormatEnvfile} {
+		_, err = e.ExportWithOptions(format, ExportOptions{EscapeControlChars: true})
+		Expect(err).To(MatchError("Value of NUL contains a NUL byte and cannot be exported"))
+	}
+	var bundle bytes.Buffer
+	Expect(e.ExportBundle(&bundle)).To(Succeed())
+	tarfile := tar.NewReader(&bundle)
+	_, err = tarfile.Next()
+	Expect(err).NotTo(HaveOccurred())
+	value, err := ioutil.ReadAll(tarfile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal([]byte("a\x00b")))
+}
+
+func TestExportBundleModes(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("PLAIN", "1", "DATABASE_PASSWORD", "2", "TAGGED", "3"))
+	e.meta = map[string]KeyMetadata{"TAGGED": {Tags: []string{TagSecret}}}
+	var bundle bytes.Buffer
+	Expect(e.ExportBundle(&bundle)).To(Succeed())
+
+	modes := map[string]int64{}
+	tarfile := tar.NewReader(&bundle)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			break
+		}
+		Expect(err).NotTo(HaveOccurred())
+		modes[header.Name] = header.Mode
+	}
+	Expect(modes).To(Equal(map[string]int64{"DATABASE_PASSWORD": 0400, "PLAIN": 0600, "TAGGED": 0400}))
+}
+
+//readBundle returns the content of each entry of a tarfile, along with the names of the entries in order
+func readBundle(bundle io.Reader) (map[string]string, []string) {
+	entries := map[string]string{}
+	names := []string{}
+	tarfile := tar.NewReader(bundle)
+	for {
+		header, err := tarfile.Next()
+		if err == io.EOF {
+			return entries, names
+		}
+		Expect(err).NotTo(HaveOccurred())
+		content, err := ioutil.ReadAll(tarfile)
+		Expect(err).NotTo(HaveOccurred())
+		entries[header.Name] = string(content)
+		names = append(names, header.Name)
+	}
+}
+
+func TestExportBundleWithEnvfile(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("B", "two words", "A", "1"))
+	var bundle bytes.Buffer
+	Expect(e.ExportBundleWithOptions(&bundle, BundleOptions{EnvfileEntry: DefaultBundleEnvfileEntry})).To(Succeed())
+	entries, names := readBundle(&bundle)
+	Expect(names).To(Equal([]string{"A", "B", ".env"}))
+	Expect(entries[".env"]).To(Equal(e.Export(ExportFormatEnvfile) + "\n"))
+
+	//the envfile entry reads back as the per-key entries
+	parsed, err := NewFromStringWithName("bundle", entries[".env"])
+	Expect(err).NotTo(HaveOccurred())
+	Expect(parsed.Map()).To(Equal(pairs("A", entries["A"], "B", entries["B"])))
+
+	//it is as read-only as the most secret key
+	bundle.Reset()
+	Expect(NewForTest(t, pairs("API_TOKEN", "x")).ExportBundleWithOptions(&bundle, BundleOptions{EnvfileEntry: "all.env"})).To(Succeed())
+	tarfile := tar.NewReader(&bundle)
+	_, err = tarfile.Next()
+	Expect(err).NotTo(HaveOccurred())
+	header, err := tarfile.Next()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(header.Name).To(Equal("all.env"))
+	Expect(header.Mode).To(Equal(int64(0400)))
+
+	bundle.Reset()
+	Expect(NewForTest(t, map[string]string{}).ExportBundleWithOptions(&bundle, BundleOptions{EnvfileEntry: ".env"})).To(Succeed())
+	entries, _ = readBundle(&bundle)
+	Expect(entries).To(Equal(map[string]string{".env": ""}))
+
+	Expect(e.ExportBundleWithOptions(ioutil.Discard, BundleOptions{EnvfileEntry: "A"})).To(MatchError("The envfile entry A has the name of a key, choose another name for it"))
+	Expect(e.ExportBundleWithOptions(ioutil.Discard, BundleOptions{EnvfileEntry: "../.env"})).To(MatchError("Invalid name for the envfile entry: '../.env'"))
+	Expect(NewForTest(t, pairs("NUL", "a\x00b")).ExportBundleWithOptions(ioutil.Discard, BundleOptions{EnvfileEntry: ".env"})).To(HaveOccurred())
+}
+
+func TestUnsetAll(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("A", "1", "B", "2", "C", "3"))
+	removed, absent, err := env.UnsetAll([]string{"C", "MISSING", "A", "C"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(Equal([]string{"C", "A"}))
+	Expect(absent).To(Equal([]string{"MISSING"}))
+	Expect(env.Keys()).To(Equal([]string{"B"}))
+
+	removed, absent, err = env.UnsetAll(nil)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(BeEmpty())
+	Expect(absent).To(BeEmpty())
+}
+
+func TestReadOnly(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("A", "1", "B", "2"))
+	frozen := env.ReadOnly()
+	Expect(frozen.IsReadOnly()).To(BeTrue())
+	Expect(env.IsReadOnly()).To(BeFalse())
+	Expect(frozen.Set("A", "changed")).To(MatchError(ErrReadOnlyEnv))
+	Expect(frozen.Write()).To(MatchError(ErrReadOnlyEnv))
+	for name, mutate := range map[string]func() error{
+		"Unset": func() error { return frozen.Unset("A") },
+		"UnsetAll": func() error {
+			_, _, err := frozen.UnsetAll([]string{"A"})
+			return err
+		},
+		"Merge": func() error { return frozen.Merge(env) },
+		"MergeMissing": func() error {
+			_, err := frozen.MergeMissing(env)
+			return err
+		},
+		"MergeWith": func() error {
+			_, err := frozen.MergeWith(env, MergeKeep)
+			return err
+		},
+		"Swap": func() error {
+			_, _, err := frozen.Swap("A", "changed")
+			return err
+		},
+		"Take": func() error {
+			_, _, err := frozen.Take("A")
+			return err
+		},
+		"SyncEnv.Unset": func() error { return frozen.Synchronized().Unset("A") },
+		"EnvView.Unset": func() error { return frozen.WithPrefix("").Unset("A") },
+	} {
+		var err error
+		Expect(recoverPanic(func() { err = mutate() })).To(BeNil(), name)
+		Expect(err).To(Equal(ErrReadOnlyEnv), name)
+	}
+	Expect(frozen.Map()).To(Equal(pairs("A", "1", "B", "2")))
+
+	//the env it was made from is left writable, and derived copies are read-only as well
+	Expect(env.Set("A", "changed")).To(Succeed())
+	Expect(frozen.GetDefault("A", "")).To(Equal("1"))
+	Expect(env.Filter(nil, []string{"B"}).IsReadOnly()).To(BeTrue())
+	resolved, err := env.ResolveReferences()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(resolved.IsReadOnly()).To(BeTrue())
+}
+
+func TestReadPathsWithReadOnlyEnvs(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	merged, err := LoadMergedAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(merged.IsReadOnly()).To(BeTrue())
+	Expect(merged.Set("testKey", "changed")).To(MatchError(ErrReadOnlyEnv))
+	//a stray change to a merged or filtered env is an error rather than a crash
+	Expect(merged.Unset("testKey")).To(Equal(ErrReadOnlyEnv))
+	Expect(merged.Merge(getEnvironment("", false))).To(Equal(ErrReadOnlyEnv))
+	_, _, err = merged.Filter(nil, []string{"globalKey"}).Take("testKey")
+	Expect(err).To(Equal(ErrReadOnlyEnv))
+	Expect(merged.Keys()).To(Equal([]string{"globalKey", "testKey"}))
+
+	//the paths that export, bundle, report and resolve config take only read from their env
+	Expect(recoverPanic(func() {
+		for _, env := range []*Env{getEnvironment(testAppName, true), getEnvironment(testAppName, false), getEnvironment("", false)} {
+			resolved, err := env.ResolveReferences()
+			Expect(err).NotTo(HaveOccurred())
+			for _, format := range []ExportFormat{ExportFormatExports, ExportFormatJSON, ExportFormatPretty, ExportFormatCompose} {
+				_, err := resolved.Filter(nil, []string{"globalKey"}).ExportWithOptions(format, ExportOptions{})
+				Expect(err).NotTo(HaveOccurred())
+			}
+			Expect(resolved.ExportBundle(ioutil.Discard)).To(Succeed())
+			Expect(blankKeys(env)).To(BeEmpty())
+		}
+		_, err := ResolveSchedulerEnv(testAppName, "web", SchedulerPhaseRun)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = ResolveReference(testAppName, "testKey")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = reportInfoFlags(testAppName)
+		Expect(err).NotTo(HaveOccurred())
+	})).To(BeNil())
+}
+
+//recoverPanic returns what fn panicked with, or nil
+func recoverPanic(fn func()) (recovered interface{}) {
+	defer func() {
+		recovered = recover()
+	}()
+	fn()
+	return nil
+}
+
+func TestFormatWith(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("lower", "1", "LOWER", "2", "B", "it's"))
+	_, err := env.FormatWith(FormatOptions{Separator: " ", KeyTransform: strings.ToUpper})
+	Expect(err).To(MatchError("Keys LOWER and lower would both be exported as LOWER"))
+	_, err = env.FormatWith(FormatOptions{Separator: " ", KeyTransform: func(key string) string { return "1" + key }})
+	Expect(err).To(MatchError("Key B cannot be exported as 1B: Invalid key name: '1B'"))
+
+	formatted, err := env.FormatWith(FormatOptions{Separator: " ", Quote: QuoteDouble, SkipKeys: []string{"lower"}, KeyTransform: strings.ToUpper})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(formatted).To(Equal(`B="it's" LOWER="2"`))
+
+	_, err = env.ExportWithOptions(ExportFormatJSON, ExportOptions{KeyTransform: strings.ToUpper})
+	Expect(err).To(MatchError("Keys LOWER and lower would both be exported as LOWER"))
+	Expect(env.ExportTo(ioutil.Discard, ExportFormatNul, ExportOptions{KeyTransform: strings.ToUpper})).NotTo(Succeed())
+}
+
+func TestKeysCache(t *testing.T) {
+	RegisterTestingT(t)
+	e, _ := newEnvFromString("FOO='bar'\nBAR='baz'")
+	Expect(e.Keys()).To(Equal([]string{"BAR", "FOO"}))
+
+	e.Set("AAA", "first")
+	Expect(e.Keys()).To(Equal([]string{"AAA", "BAR", "FOO"}))
+	Expect(e.ShellString()).To(Equal("AAA='first' BAR='baz' FOO='bar'"))
+
+	e.Unset("BAR")
+	Expect(e.Keys()).To(Equal([]string{"AAA", "FOO"}))
+	Expect(e.Export(ExportFormatPretty)).To(Equal("AAA:  first\nFOO:  bar"))
+
+	keys := e.Keys()
+	keys[0] = "MODIFIED"
+	Expect(e.Keys()).To(Equal([]string{"AAA", "FOO"}))
+}
+
 func TestGet(t *testing.T) {
 	RegisterTestingT(t)
 	e, err := newEnvFromString("BAR='BAZ'\nFOO='ba\\nr '\nGO='1'\nNOGO='0'")
@@ -74,6 +369,14 @@ func TestGet(t *testing.T) {
 	v = e.GetDefault("dne", "default")
 	Expect(v).To(Equal("default"))
 
+	v, key, ok := e.GetFirst("dne", "GO", "BAR")
+	Expect(ok).To(BeTrue())
+	Expect(key).To(Equal("GO"))
+	Expect(v).To(Equal("1"))
+	_, key, ok = e.GetFirst("dne", "other")
+	Expect(ok).To(BeFalse())
+	Expect(key).To(BeEmpty())
+
 	b := e.GetBoolDefault("dne", true)
 	Expect(b).To(Equal(true))
 
@@ -101,3 +404,119 @@ func pairs(vars ...string) map[string]string {
 	}
 	return res
 }
+
+func TestNewForTest(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("FOO", "bar", "BAZ", "b'oo"))
+	Expect(e.Keys()).To(Equal([]string{"BAZ", "FOO"}))
+	Expect(e.Export(ExportFormatShell)).To(Equal("BAZ='b'\\''oo' FOO='bar'"))
+	Expect(e.Write()).NotTo(Succeed())
+}
+
+func TestEntriesSorted(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("B", "2", "A", "1", "C", "x=y"))
+	Expect(e.EntriesSorted()).To(Equal([]Entry{{"A", "1"}, {"B", "2"}, {"C", "x=y"}}))
+	Expect(NewForTest(t, nil).EntriesSorted()).To(BeEmpty())
+}
+
+func TestEnviron(t *testing.T) {
+	RegisterTestingT(t)
+	os.Setenv("DOKKU_ENVIRON_PARENT", "parent")
+	os.Setenv("DOKKU_ENVIRON_SHARED", "parent")
+	defer os.Unsetenv("DOKKU_ENVIRON_PARENT")
+	defer os.Unsetenv("DOKKU_ENVIRON_SHARED")
+
+	e := NewForTest(t, pairs("DOKKU_ENVIRON_SHARED", "app", "B", "2", "A", "a=b"))
+	Expect(e.Environ(false)).To(Equal([]string{"A=a=b", "B=2", "DOKKU_ENVIRON_SHARED=app"}))
+
+	environ := e.Environ(true)
+	Expect(environ).To(ContainElement("DOKKU_ENVIRON_PARENT=parent"))
+	Expect(environ).NotTo(ContainElement("DOKKU_ENVIRON_SHARED=parent"))
+	//the app env comes last, in a stable order, and each key appears once
+	Expect(environ[len(environ)-3:]).To(Equal([]string{"A=a=b", "B=2", "DOKKU_ENVIRON_SHARED=app"}))
+	Expect(environ).To(Equal(e.Environ(true)))
+	Expect(environ).To(HaveLen(len(os.Environ()) + 2))
+
+	//a child sees the app value of a key set in both
+	if _, err := exec.LookPath("sh"); err == nil {
+		cmd := exec.Command("sh", "-c", "printf %s \"$DOKKU_ENVIRON_SHARED\"")
+		cmd.Env = environ
+		out, err := cmd.Output()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("app"))
+	}
+}
+
+func benchmarkExport(b *testing.B, keyCount int, format ExportFormat) {
+	e := NewForTest(b, nil)
+	for i := 0; i < keyCount; i++ {
+		e.Set(fmt.Sprintf("KEY_%d", i), fmt.Sprintf("it's value %d", i))
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Export(format)
+	}
+}
+
+func BenchmarkExportfileString100(b *testing.B)   { benchmarkExport(b, 100, ExportFormatExports) }
+func BenchmarkExportfileString1000(b *testing.B)  { benchmarkExport(b, 1000, ExportFormatExports) }
+func BenchmarkExportfileString10000(b *testing.B) { benchmarkExport(b, 10000, ExportFormatExports) }
+func BenchmarkDockerArgsString100(b *testing.B)   { benchmarkExport(b, 100, ExportFormatDockerArgs) }
+func BenchmarkDockerArgsString1000(b *testing.B)  { benchmarkExport(b, 1000, ExportFormatDockerArgs) }
+func BenchmarkDockerArgsString10000(b *testing.B) { benchmarkExport(b, 10000, ExportFormatDockerArgs) }
+
+func TestMergeWith(t *testing.T) {
+	RegisterTestingT(t)
+	other := NewForTest(t, pairs("B", "other", "C", "3", "D", "4", "A", "1"))
+	Expect(NewForTest(t, pairs("A", "1", "B", "2", "D", "")).Conflicts(other)).To(Equal([]string{"B", "D"}))
+
+	e := NewForTest(t, pairs("A", "1", "B", "2", "D", ""))
+	result, err := e.MergeWith(other, MergeOverwrite)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(Equal(MergeResult{Added: []string{"C"}, Overwritten: []string{"B", "D"}, Kept: []string{}}))
+	Expect(e.Map()).To(Equal(pairs("A", "1", "B", "other", "C", "3", "D", "4")))
+
+	e = NewForTest(t, pairs("A", "1", "B", "2", "D", ""))
+	result, err = e.MergeWith(other, MergeKeep)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(Equal(MergeResult{Added: []string{"C"}, Overwritten: []string{}, Kept: []string{"B", "D"}}))
+	Expect(e.Map()).To(Equal(pairs("A", "1", "B", "2", "C", "3", "D", "")))
+
+	//failing leaves the env untouched
+	e = NewForTest(t, pairs("A", "1", "B", "2", "D", ""))
+	_, err = e.MergeWith(other, MergeFail)
+	Expect(err).To(Equal(&MergeConflictError{Keys: []string{"B", "D"}}))
+	Expect(err).To(MatchError("2 key(s) are already set to another value: B, D"))
+	Expect(e.Map()).To(Equal(pairs("A", "1", "B", "2", "D", "")))
+
+	result, err = e.MergeWith(NewForTest(t, pairs("A", "1", "E", "5")), MergeFail)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result.Added).To(Equal([]string{"E"}))
+	Expect(e.Keys()).To(Equal([]string{"A", "B", "D", "E"}))
+}
+
+func TestSwapAndTake(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("A", "1", "B", "2"))
+	old, existed, err := e.Swap("A", "one")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(old).To(Equal("1"))
+	Expect(existed).To(BeTrue())
+	old, existed, _ = e.Swap("C", "3")
+	Expect(old).To(BeEmpty())
+	Expect(existed).To(BeFalse())
+	Expect(e.Map()).To(Equal(pairs("A", "one", "B", "2", "C", "3")))
+	Expect(e.Keys()).To(Equal([]string{"A", "B", "C"}))
+
+	value, existed, err := e.Take("B")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("2"))
+	Expect(existed).To(BeTrue())
+	value, existed, _ = e.Take("B")
+	Expect(value).To(BeEmpty())
+	Expect(existed).To(BeFalse())
+	Expect(e.Keys()).To(Equal([]string{"A", "C"}))
+	Expect(e.OrderedKeys()).To(Equal([]string{"A", "C"}))
+}
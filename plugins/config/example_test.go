@@ -0,0 +1,77 @@
+package config_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+//exampleRoot creates a dokku root holding a global ENV file and an app with its own ENV file
+func exampleRoot() string {
+	root, _ := ioutil.TempDir("", "dokku-root")
+	os.MkdirAll(filepath.Join(root, "node-js-app"), 0700)
+	ioutil.WriteFile(filepath.Join(root, "ENV"), []byte("export WEB_CONCURRENCY='2'\nexport TZ='UTC'\n"), 0600)
+	ioutil.WriteFile(filepath.Join(root, "node-js-app", "ENV"), []byte("export WEB_CONCURRENCY='4'\n"), 0600)
+	return root
+}
+
+func ExampleLoadMergedAppEnv() {
+	root := exampleRoot()
+	defer os.RemoveAll(root)
+
+	env, err := config.LoadMergedAppEnv("node-js-app", config.WithRoot(root))
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, k := range env.Keys() {
+		fmt.Printf("%s=%s\n", k, env.GetDefault(k, ""))
+	}
+	// Output:
+	// TZ=UTC
+	// WEB_CONCURRENCY=4
+}
+
+func ExampleLoadAppEnv_notFound() {
+	root := exampleRoot()
+	defer os.RemoveAll(root)
+
+	_, err := config.LoadAppEnv("missing-app", config.WithRoot(root))
+	if _, ok := err.(*config.AppNotFoundError); ok {
+		fmt.Println("missing-app does not exist")
+	}
+	// Output:
+	// missing-app does not exist
+}
+
+func ExampleDiff() {
+	root := exampleRoot()
+	defer os.RemoveAll(root)
+
+	global, _ := config.LoadGlobalEnv(config.WithRoot(root))
+	app, _ := config.LoadAppEnv("node-js-app", config.WithRoot(root))
+	diff := config.Diff(global, app)
+	fmt.Println("removed:", diff.Removed)
+	fmt.Println("changed:", diff.Changed)
+	// Output:
+	// removed: [TZ]
+	// changed: [WEB_CONCURRENCY]
+}
+
+func ExampleEnv_ExportWithOptions() {
+	root := exampleRoot()
+	defer os.RemoveAll(root)
+
+	env, _ := config.LoadGlobalEnv(config.WithRoot(root))
+	exported, err := env.ExportWithOptions(config.ExportFormatShell, config.ExportOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(exported)
+	// Output:
+	// TZ='UTC' WEB_CONCURRENCY='2'
+}
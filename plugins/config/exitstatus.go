@@ -0,0 +1,50 @@
+package config
+
+//Exit statuses of the config subcommands, which scripts may rely on. Any failure without a status
+// of its own exits with 1, as does reading a key that is not set. ExitStatusUnchanged and
+// ExitStatusPending are not failures, config:export --if-changed-since exits with the former when
+// there is nothing new to export, and config:pending with the latter when a restart is pending.
+// ExitStatusRestartFailed is a change that was written, but after which the app failed to restart
+const (
+	ExitStatusKeyNotSet     = 1
+	ExitStatusInvalid       = 2
+	ExitStatusLocked        = 3
+	ExitStatusNotWritable   = 4
+	ExitStatusConflict      = 5
+	ExitStatusUnchanged     = 6
+	ExitStatusPending       = 7
+	ExitStatusRestartFailed = 8
+	ExitStatusAppNotFound   = 20
+)
+
+//ValidationError is returned when a value, or the arguments of a command, are refused before
+// anything is changed
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+//exitStatus returns the exit status a subcommand failing with err exits with
+func exitStatus(err error) int {
+	switch err.(type) {
+	case *AppNotFoundError:
+		return ExitStatusAppNotFound
+	case *InvalidKeyError, *ValidationError, *UnsafePathError:
+		return ExitStatusInvalid
+	case *LockError:
+		return ExitStatusLocked
+	case *ErrEnvNotWritable:
+		return ExitStatusNotWritable
+	case *MergeConflictError, *KeyExistsError:
+		return ExitStatusConflict
+	case *RestartError:
+		return ExitStatusRestartFailed
+	}
+	if err == ErrInvalidValue {
+		return ExitStatusInvalid
+	}
+	return 1
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestExitStatus(t *testing.T) {
+	RegisterTestingT(t)
+	for err, expected := range map[error]int{
+		&AppNotFoundError{AppName: "missing-app"}:  ExitStatusAppNotFound,
+		&InvalidKeyError{Key: "not-valid"}:         ExitStatusInvalid,
+		&ValidationError{Message: "invalid"}:       ExitStatusInvalid,
+		&UnsafePathError{AppName: "../app"}:        ExitStatusInvalid,
+		ErrInvalidValue:                            ExitStatusInvalid,
+		&LockError{Path: "ENV", Err: os.ErrClosed}: ExitStatusLocked,
+		&ErrEnvNotWritable{Path: "ENV"}:            ExitStatusNotWritable,
+		&MergeConflictError{Keys: []string{"KEY"}}: ExitStatusConflict,
+		&KeyExistsError{Key: "KEY"}:                ExitStatusConflict,
+		errors.New("anything else"):                1,
+	} {
+		Expect(exitStatus(err)).To(Equal(expected), fmt.Sprintf("%T", err))
+	}
+}
+
+func TestRunSubcommandExitStatus(t *testing.T) {
+	RegisterTestingT(t)
+
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected int
+	}{
+		{"get", []string{"missing-app", "KEY"}, ExitStatusAppNotFound},
+		{"set", []string{"--no-restart", "missing-app", "KEY=1"}, ExitStatusAppNotFound},
+		{"unset", []string{"--no-restart", "missing-app", "KEY"}, ExitStatusAppNotFound},
+		{"export", []string{"missing-app"}, ExitStatusAppNotFound},
+
+		{"get", []string{"web-app", "not-valid"}, ExitStatusInvalid},
+		{"get", []string{"web-app"}, ExitStatusInvalid},
+		{"set", []string{"--no-restart", "web-app", "not-valid=1"}, ExitStatusInvalid},
+		{"set", []string{"--no-restart", "web-app", "KEY"}, ExitStatusInvalid},
+		{"set", []string{"--bogus", "web-app", "KEY=1"}, ExitStatusInvalid},
+		{"unset", []string{"--no-restart", "web-app", "not-valid"}, ExitStatusInvalid},
+		{"unset", []string{"--no-restart"}, ExitStatusInvalid},
+		{"export", []string{"--format", "yaml", "web-app"}, ExitStatusInvalid},
+		{"export", []string{"--global", "--app", "web-app"}, ExitStatusInvalid},
+
+		{"get", []string{"web-app", "MISSING"}, ExitStatusKeyNotSet},
+		{"get", []string{"--quoted", "web-app", "KEY", "MISSING"}, ExitStatusKeyNotSet},
+		{"unset", []string{"--strict", "--no-restart", "web-app", "MISSING"}, ExitStatusKeyNotSet},
+	} {
+		host, teardown := setupTestHost("web-app")
+		_, err := runSubcommand(host, tc.name, tc.argv...)
+		Expect(err).To(HaveOccurred(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		Expect(err.(*SubcommandError).Code).To(Equal(tc.expected), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		teardown()
+	}
+
+	//changes fail if the lock of the ENV file cannot be taken, reads do not take it
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	Expect(os.Mkdir(filepath.Join(host.root, "web-app", ".ENV.lock"), 0755)).To(Succeed())
+	for _, argv := range [][]string{{"set", "--no-restart", "web-app", "KEY=1"}, {"unset", "--no-restart", "web-app", "KEY"}} {
+		_, err := runSubcommand(host, argv[0], argv[1:]...)
+		Expect(err).To(HaveOccurred(), fmt.Sprintf("%v", argv))
+		Expect(err.(*SubcommandError).Code).To(Equal(ExitStatusLocked), fmt.Sprintf("%v", argv))
+	}
+	for _, argv := range [][]string{{"get", "web-app", "KEY"}, {"export", "web-app"}} {
+		_, err := runSubcommand(host, argv[0], argv[1:]...)
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("%v", argv))
+	}
+}
+
+func TestRunSubcommandQuiet(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+
+	output, err := runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "OTHER=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(BeEmpty())
+	output, err = runSubcommand(host, "unset", "--no-restart", "--quiet", "web-app", "OTHER")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(BeEmpty())
+	//only the data asked for is printed
+	output, err = runSubcommand(host, "get", "--quiet", "web-app", "KEY")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("web-app\n"))
+	output, err = runSubcommand(host, "show", "--quiet", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("KEY:  web-app\n"))
+
+	//the output of later subcommands is not silenced
+	_, isSet := os.LookupEnv("DOKKU_QUIET_OUTPUT")
+	Expect(isSet).To(BeFalse())
+	output, err = runSubcommand(host, "unset", "--no-restart", "web-app", "KEY")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("Removed 1 key(s): KEY"))
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+//EnvFileFormat is the syntax Write uses for the lines of an ENV file, set by the env-file-format
+// property. Loaders read either syntax, and files mixing both
+type EnvFileFormat string
+
+const (
+	//EnvFileFormatEnvfile writes KEY="value" lines, read by tools such as docker compose
+	EnvFileFormatEnvfile EnvFileFormat = "envfile"
+	//EnvFileFormatExportfile writes export KEY="value" lines, which a shell may source
+	EnvFileFormatExportfile EnvFileFormat = "exportfile"
+)
+
+//ParseEnvFileFormat parses the value of the env-file-format property. The empty string stands for
+// no format, in which Write keeps the export of each line it rewrites and writes new lines as
+// EnvFileFormatEnvfile
+func ParseEnvFileFormat(value string) (EnvFileFormat, error) {
+	switch format := EnvFileFormat(value); format {
+	case "", EnvFileFormatEnvfile, EnvFileFormatExportfile:
+		return format, nil
+	}
+	return "", &ValidationError{Message: fmt.Sprintf("Unknown env-file-format '%s', expected %s or %s", value, EnvFileFormatEnvfile, EnvFileFormatExportfile)}
+}
+
+//envFileFormat returns the env-file-format property of an app, or of the global env for "".
+// An unknown value is ignored, as set-property refuses to set one
+func envFileFormat(appName string) EnvFileFormat {
+	format, err := ParseEnvFileFormat(getConfigProperty(appName, "env-file-format"))
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+//SetFileFormat sets the syntax Write uses for the lines of the file. Every line Write writes takes
+// that syntax, including the unchanged lines an Env in ordered mode would otherwise keep as read
+func (e *Env) SetFileFormat(format EnvFileFormat) {
+	e.fileFormat = format
+}
+
+//FileFormat returns the syntax Write uses for the lines of the file, see SetFileFormat
+func (e *Env) FileFormat() EnvFileFormat {
+	return e.fileFormat
+}
+
+//fileLine returns the line Write writes key on. Without a file format, a key that was read from an
+// export line keeps it
+func (e *Env) fileLine(key string, value string, exported bool) string {
+	line := marshalEnvLine(key, value)
+	if e.fileFormat == EnvFileFormatExportfile || (e.fileFormat == "" && exported) {
+		return "export " + line
+	}
+	return line
+}
+
+//keepsLine reports whether a line read with or without export is in the file format
+func (e *Env) keepsLine(exported bool) bool {
+	return e.fileFormat == "" || exported == (e.fileFormat == EnvFileFormatExportfile)
+}
+
+//isExportLine reports whether a line of an ENV file assigns a key with export
+func isExportLine(text string) bool {
+	return strings.HasPrefix(strings.TrimSpace(text), "export ")
+}
+
+//ConvertEnvFile rewrites the ENV file at path in the given file format, after copying its current
+// contents to a backup file next to it. The order of the keys, comments and values are kept, only
+// the syntax of lines changes. The path of the backup is returned, or an empty string if the file
+// is already in that format or does not exist
+func ConvertEnvFile(name string, path string, to EnvFileFormat) (backup string, err error) {
+	if to != EnvFileFormatEnvfile && to != EnvFileFormatExportfile {
+		return "", &ValidationError{Message: fmt.Sprintf("Unable to convert to env-file-format '%s', expected %s or %s", to, EnvFileFormatEnvfile, EnvFileFormatExportfile)}
+	}
+	unlock, err := lockEnvFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	contents, _, err := readEnvFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Unable to read %s: %s", path, err.Error())
+	}
+	env, err := loadFromFile(name, path)
+	if err != nil {
+		return "", err
+	}
+	env.PreserveOrder()
+	env.SetFileFormat(to)
+	converted, err := env.fileContents()
+	if err != nil {
+		return "", err
+	}
+	if converted == string(contents) {
+		return "", nil
+	}
+
+	backup = path + ".convert.bak"
+	if err := writeFileSafe(backup, contents, writeOptions{mode: 0600, resetMode: true, noClobber: true, noFollow: true}); os.IsExist(err) {
+		return "", fmt.Errorf("Refusing to overwrite existing backup %s", backup)
+	} else if err != nil {
+		return "", fmt.Errorf("Unable to write backup %s: %s", backup, err.Error())
+	}
+	if err := env.Write(); err != nil {
+		return "", fmt.Errorf("Unable to write %s: %s", path, err.Error())
+	}
+	return backup, nil
+}
@@ -0,0 +1,160 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseEnvFileFormat(t *testing.T) {
+	RegisterTestingT(t)
+	for _, format := range []EnvFileFormat{"", EnvFileFormatEnvfile, EnvFileFormatExportfile} {
+		Expect(ParseEnvFileFormat(string(format))).To(Equal(format))
+	}
+	_, err := ParseEnvFileFormat("yaml")
+	Expect(err).To(MatchError("Unknown env-file-format 'yaml', expected envfile or exportfile"))
+}
+
+func TestEnvFileFormatRoundTrip(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-file-format")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	values := pairs(
+		"PLAIN", "value",
+		"EMPTY", "",
+		"SPACES", "two words ",
+		"QUOTES", `it's "quoted"`,
+		"SHELL", "$HOME `pwd` !x \\n",
+		"MULTI", "line one\nline two\r\n",
+		"HASH", "a # not a comment",
+		"UNICODE", "café ☕",
+	)
+
+	loaded := map[EnvFileFormat]*Env{}
+	for _, format := range []EnvFileFormat{EnvFileFormatEnvfile, EnvFileFormatExportfile} {
+		filename := filepath.Join(dir, string(format))
+		Expect(ioutil.WriteFile(filename, []byte{}, 0600)).To(Succeed())
+		env, err := loadFromFile("test", filename)
+		Expect(err).NotTo(HaveOccurred())
+		env.SetFileFormat(format)
+		for k, v := range values {
+			Expect(env.Set(k, v)).To(Succeed())
+		}
+		Expect(env.Write()).To(Succeed())
+		loaded[format], err = loadFromFile("test", filename)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(loaded[format].Map()).To(Equal(values), string(format))
+	}
+	Expect(loaded[EnvFileFormatEnvfile].Checksum()).To(Equal(loaded[EnvFileFormatExportfile].Checksum()))
+
+	contents, err := ioutil.ReadFile(filepath.Join(dir, "envfile"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(HavePrefix("EMPTY=\"\"\nHASH="))
+	contents, err = ioutil.ReadFile(filepath.Join(dir, "exportfile"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(HavePrefix("export EMPTY=\"\"\nexport HASH="))
+	Expect(string(contents)).To(ContainSubstring("\nexport UNICODE=\"café ☕\""))
+
+	//a file mixing both is read the same way
+	env, err := newEnvFromString("export A='1'\nB=\"2\"\nexport C=3\n")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "1", "B", "2", "C", "3")))
+}
+
+func TestEnvFileFormatOrdered(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-file-format")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("# database\nexport B='1'\nA=\"2\"\n"), 0600)).To(Succeed())
+
+	//without a format, lines keep their export
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	env.PreserveOrder()
+	Expect(env.Set("B", "changed")).To(Succeed())
+	Expect(env.Set("C", "3")).To(Succeed())
+	Expect(env.Write()).To(Succeed())
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# database\nexport B=\"changed\"\nA=\"2\"\nC=\"3\"\n"))
+
+	//with one, every line is written in it
+	env, err = loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	env.PreserveOrder()
+	env.SetFileFormat(EnvFileFormatEnvfile)
+	Expect(env.Write()).To(Succeed())
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# database\nB=\"changed\"\nA=\"2\"\nC=\"3\"\n"))
+}
+
+func TestConvertEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-file-format")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	original := "# dokku-env-format: 2\nexport ZED='1'\n# comment\nALPHA=\"two words\"\n"
+	Expect(ioutil.WriteFile(filename, []byte(original), 0600)).To(Succeed())
+
+	_, err = ConvertEnvFile("test", filename, "yaml")
+	Expect(err).To(HaveOccurred())
+
+	backup, err := ConvertEnvFile("test", filename, EnvFileFormatExportfile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(Equal(filename + ".convert.bak"))
+	contents, err := ioutil.ReadFile(backup)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal(original))
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# dokku-env-format: 2\nexport ZED='1'\n# comment\nexport ALPHA=\"two words\"\n"))
+
+	//a file already in the format is left alone
+	backup, err = ConvertEnvFile("test", filename, EnvFileFormatExportfile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(BeEmpty())
+	backup, err = ConvertEnvFile("test", filepath.Join(dir, "MISSING"), EnvFileFormatEnvfile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(BeEmpty())
+
+	//an existing backup is never overwritten
+	_, err = ConvertEnvFile("test", filename, EnvFileFormatEnvfile)
+	Expect(err).To(MatchError("Refusing to overwrite existing backup " + filename + ".convert.bak"))
+	Expect(os.Remove(filename + ".convert.bak")).To(Succeed())
+	_, err = ConvertEnvFile("test", filename, EnvFileFormatEnvfile)
+	Expect(err).NotTo(HaveOccurred())
+	converted, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(converted.Map()).To(Equal(pairs("ZED", "1", "ALPHA", "two words")))
+	Expect(converted.OrderedKeys()).To(Equal([]string{"ZED", "ALPHA"}))
+}
+
+func TestEnvFileFormatProperty(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	Expect(common.PropertyWrite("config", "--global", "env-file-format", "exportfile")).To(Succeed())
+
+	Expect(SetMany(testAppName, pairs("NEW", "1"), false)).To(Succeed())
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("export NEW=\"1\"\nexport testKey=\"TESTING\"\n"))
+
+	//an app may override the global format
+	Expect(common.PropertyWrite("config", testAppName, "env-file-format", "envfile")).To(Succeed())
+	Expect(UnsetMany(testAppName, []string{"NEW"}, false)).To(Succeed())
+	contents, err = ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("testKey=\"TESTING\"\n"))
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"fmt"
+	"path"
+)
+
+//Filter returns a copy of this Env holding only the keys that match one of the includeOnly glob
+// patterns, or all keys if there are none, and that match none of the exclude patterns.
+// The copy keeps the key metadata of this Env, but is read-only and not bound to its file
+func (e *Env) Filter(includeOnly []string, exclude []string) *Env {
+	filtered := e.clone()
+	filtered.filename = ""
+	filtered.meta, _ = e.Metadata()
+	for _, k := range e.sortKeys() {
+		if (len(includeOnly) > 0 && !matchesAny(k, includeOnly)) || matchesAny(k, exclude) {
+			//the clone is writable until it is made read-only below
+			filtered.Unset(k)
+		}
+	}
+	filtered.readOnly = true
+	return filtered
+}
+
+//matchesAny reports whether the key matches any of the glob patterns. Invalid patterns match nothing
+func matchesAny(key string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, key); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+//validatePatterns returns an error naming the first of the glob patterns given with a flag
+// that is malformed
+func validatePatterns(flagName string, patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return &ValidationError{Message: fmt.Sprintf("Invalid --%s pattern: '%s'", flagName, pattern)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvFilter(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("DOKKU_APP_TYPE", "herokuish", "FLAGS_BLOB", "x", "API_KEY", "y"), false)).To(Succeed())
+	Expect(Annotate(testAppName, "testKey", nil, []string{TagSecret}, nil)).To(Succeed())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+
+	filtered := env.Filter(nil, []string{"DOKKU_*", "FLAGS_*"})
+	Expect(filtered.Keys()).To(Equal([]string{"API_KEY", "testKey"}))
+	Expect(filtered.KeyMetadata("testKey").HasTag(TagSecret)).To(BeTrue())
+	Expect(filtered.Write()).To(HaveOccurred())
+	Expect(env.Len()).To(Equal(4))
+
+	Expect(env.Filter([]string{"*_KEY", "test*"}, []string{"API_*"}).Keys()).To(Equal([]string{"testKey"}))
+	Expect(env.Filter(nil, nil).Map()).To(Equal(env.Map()))
+
+	Expect(validatePatterns("exclude", []string{"DOKKU_*"})).To(Succeed())
+	Expect(validatePatterns("exclude", []string{"[A-"})).To(MatchError("Invalid --exclude pattern: '[A-'"))
+}
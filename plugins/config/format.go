@@ -0,0 +1,144 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+//EnvFormatVersion is the latest ENV file format. Files of version 2 and later start with a
+// "# dokku-env-format: <version>" header, files without one are version 1
+const EnvFormatVersion = 2
+
+const formatHeaderPrefix = "# dokku-env-format: "
+
+//splitFormatHeader returns the format version declared by the first line of ENV file contents,
+// along with the contents following the header. A missing or unreadable header is version 1
+func splitFormatHeader(contents string) (version int, rest string) {
+	if !strings.HasPrefix(contents, formatHeaderPrefix) {
+		return 1, contents
+	}
+	header, rest := contents, ""
+	if i := strings.IndexByte(contents, '\n'); i >= 0 {
+		header, rest = contents[:i], contents[i+1:]
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, formatHeaderPrefix)))
+	if err != nil || version < 1 {
+		return 1, contents
+	}
+	return version, rest
+}
+
+//firstLineAfterHeader returns the line of ENV file contents that the rest returned by
+// splitFormatHeader starts at
+func firstLineAfterHeader(contents string, rest string) int {
+	if len(rest) == len(contents) {
+		return 1
+	}
+	return 2
+}
+
+//formatHeader returns the header line written at the top of files of the given format version
+func formatHeader(version int) string {
+	if version < 2 {
+		return ""
+	}
+	return fmt.Sprintf("%s%d\n", formatHeaderPrefix, version)
+}
+
+//FormatVersion returns the format version of the file this Env was loaded from, which Write keeps
+func (e *Env) FormatVersion() int {
+	if e.format < 1 {
+		return 1
+	}
+	return e.format
+}
+
+//validateFormatVersion fails unless version is an ENV format version that files can be migrated to
+func validateFormatVersion(version int) error {
+	if version < 1 || version > EnvFormatVersion {
+		return &ValidationError{Message: fmt.Sprintf("Unknown ENV format version %d, the latest is %d", version, EnvFormatVersion)}
+	}
+	return nil
+}
+
+//MigrateEnvFile upgrades the ENV file at path to the given format version in place, after copying
+// its current contents to a backup file next to it. The path of the backup is returned, or an empty
+// string if the file is already at that version or does not exist. Downgrades are refused
+func MigrateEnvFile(path string, toVersion int) (backup string, err error) {
+	if err := validateFormatVersion(toVersion); err != nil {
+		return "", err
+	}
+	unlock, err := lockEnvFile(path)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+
+	contents, compressed, err := readEnvFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Unable to read %s: %s", path, err.Error())
+	}
+	version, rest := splitFormatHeader(string(contents))
+	if version > toVersion {
+		return "", fmt.Errorf("Refusing to downgrade %s from ENV format version %d to %d", path, version, toVersion)
+	}
+	if version == toVersion {
+		return "", nil
+	}
+
+	backup = fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := writeFileSafe(backup, contents, writeOptions{mode: 0600, resetMode: true, noClobber: true, noFollow: true}); os.IsExist(err) {
+		return "", fmt.Errorf("Refusing to overwrite existing backup %s", backup)
+	} else if err != nil {
+		return "", fmt.Errorf("Unable to write backup %s: %s", backup, err.Error())
+	}
+	if err := writeEnvContents(path, []byte(formatHeader(toVersion)+rest), compressed); err != nil {
+		return "", fmt.Errorf("Unable to write %s: %s", path, err.Error())
+	}
+	return backup, nil
+}
+
+//formatSemantics is how an ENV format version reads the parts of a file that versions may read
+// differently. Files whose versions have the same semantics merge as they were written
+type formatSemantics struct {
+	//inlineComments is whether a # in an unquoted value starts a comment
+	inlineComments bool
+	//multiline is whether a double quoted value may hold newlines written as \n
+	multiline bool
+}
+
+//knownFormatSemantics are the semantics of each ENV format version up to EnvFormatVersion. Version 2
+// only added the header, so both read lines alike
+var knownFormatSemantics = map[int]formatSemantics{
+	1: {inlineComments: true, multiline: true},
+	2: {inlineComments: true, multiline: true},
+}
+
+//formatMismatch returns a warning if the ENV files of the global env and of an app are of format
+// versions whose semantics differ, or which this version of dokku does not know the semantics of,
+// so that the merged env may not hold the values as written. It is empty if they can be merged
+func formatMismatch(formats []SourceFormat) string {
+	var global, app *SourceFormat
+	for i := range formats {
+		switch formats[i].Layer {
+		case LayerGlobal:
+			global = &formats[i]
+		case LayerApp:
+			app = &formats[i]
+		}
+	}
+	if global == nil || app == nil || global.Version == app.Version {
+		return ""
+	}
+	globalSemantics, globalKnown := knownFormatSemantics[global.Version]
+	appSemantics, appKnown := knownFormatSemantics[app.Version]
+	if globalKnown && appKnown && globalSemantics == appSemantics {
+		return ""
+	}
+	return fmt.Sprintf("%s uses ENV format version %d while %s uses version %d, which may handle comments and multiline values differently, run config:migrate-format --all to bring every ENV file to the same version", global.Filename, global.Version, app.Filename, app.Version)
+}
@@ -0,0 +1,139 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestFormatHeader(t *testing.T) {
+	RegisterTestingT(t)
+	version, rest := splitFormatHeader("# dokku-env-format: 2\nA='1'\n")
+	Expect(version).To(Equal(2))
+	Expect(rest).To(Equal("A='1'\n"))
+
+	for _, contents := range []string{"A='1'\n", "# dokku-env-format: two\nA='1'\n", "# a comment\n", ""} {
+		version, rest = splitFormatHeader(contents)
+		Expect(version).To(Equal(1))
+		Expect(rest).To(Equal(contents))
+	}
+
+	env, err := newEnvFromString("# dokku-env-format: 2\n# database\nA='1'\n")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.FormatVersion()).To(Equal(2))
+	Expect(env.Map()).To(Equal(pairs("A", "1")))
+	Expect(NewForTest(t, nil).FormatVersion()).To(Equal(1))
+}
+
+func TestMigrateEnvFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-format")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	original := "# database\nexport A='1'\n"
+	Expect(ioutil.WriteFile(filename, []byte(original), 0600)).To(Succeed())
+
+	backup, err := MigrateEnvFile(filename, 2)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(Equal(filename + ".v1.bak"))
+	contents, err := ioutil.ReadFile(backup)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal(original))
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# dokku-env-format: 2\n" + original))
+
+	//the header is kept by later writes, sorted or ordered
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.FormatVersion()).To(Equal(2))
+	Expect(env.Set("B", "2")).To(Succeed())
+	Expect(env.Write()).To(Succeed())
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# dokku-env-format: 2\nA=\"1\"\nB=\"2\"\n"))
+	env, err = loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	env.PreserveOrder()
+	Expect(env.Set("C", "3")).To(Succeed())
+	Expect(env.Write()).To(Succeed())
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# dokku-env-format: 2\nA=\"1\"\nB=\"2\"\nC=\"3\"\n"))
+
+	backup, err = MigrateEnvFile(filename, 2)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(Equal(""))
+	_, err = MigrateEnvFile(filename, 1)
+	Expect(err).To(MatchError("Refusing to downgrade " + filename + " from ENV format version 2 to 1"))
+	_, err = MigrateEnvFile(filename, EnvFormatVersion+1)
+	Expect(err).To(HaveOccurred())
+
+	backup, err = MigrateEnvFile(filepath.Join(dir, "missing"), 2)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(backup).To(Equal(""))
+}
+
+func TestFormatMismatch(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+	globalfile := filepath.Join(host.root, "ENV")
+	appfile := filepath.Join(host.root, "web-app", "ENV")
+
+	//versions 1 and 2 read lines alike
+	_, err := MigrateEnvFile(appfile, 2)
+	Expect(err).NotTo(HaveOccurred())
+	var effective *EffectiveEnv
+	stderr := captureStderr(func() {
+		effective, err = ResolveEffectiveEnv("web-app", "web", SchedulerPhaseDeploy)
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stderr).To(BeEmpty())
+	Expect(effective.Formats()).To(Equal([]SourceFormat{
+		{Layer: LayerGlobal, Filename: globalfile, Version: 1},
+		{Layer: LayerApp, Filename: appfile, Version: 2},
+	}))
+
+	Expect(ioutil.WriteFile(appfile, []byte("# dokku-env-format: 3\nexport KEY='web-app'\n"), 0600)).To(Succeed())
+	stderr = captureStderr(func() {
+		_, err = LoadMergedAppEnv("web-app")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stderr).To(ContainSubstring(globalfile + " uses ENV format version 1 while " + appfile + " uses version 3, which may handle comments and multiline values differently"))
+
+	Expect(formatMismatch([]SourceFormat{{Layer: LayerApp, Filename: appfile, Version: 3}})).To(BeEmpty())
+	Expect(formatMismatch([]SourceFormat{
+		{Layer: LayerGlobal, Filename: globalfile, Version: 3},
+		{Layer: LayerApp, Filename: appfile, Version: 3},
+	})).To(BeEmpty())
+}
+
+func TestMigrateFormatAll(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app", "worker-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	for _, appName := range []string{"", "web-app", "worker-app"} {
+		Expect(migrateFormat(appName, EnvFormatVersion, "")).To(Succeed())
+	}
+	for _, filename := range []string{"ENV", "web-app/ENV", "worker-app/ENV"} {
+		contents, err := ioutil.ReadFile(filepath.Join(host.root, filename))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(contents)).To(HavePrefix("# dokku-env-format: 2\n"))
+		_, err = os.Stat(filepath.Join(host.root, filename+".v1.bak"))
+		Expect(err).NotTo(HaveOccurred())
+	}
+	Expect(migrateFormat("web-app", EnvFormatVersion, "")).To(Succeed())
+	Expect(validateFormatVersion(EnvFormatVersion + 1)).To(HaveOccurred())
+}
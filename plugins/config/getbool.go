@@ -0,0 +1,107 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+//errScanFallback is returned by scanEnvValue for an ENV file it cannot be sure to read as loading
+// the env would, which must then be loaded in full
+var errScanFallback = errors.New("the ENV file must be loaded in full")
+
+//GetAppBool returns whether a key of an app, or of the global env if appName is empty, is set to
+// anything but 0, or def if the key is not set or the env cannot be read, exactly as
+// GetWithDefault and Env.GetBoolDefault would. It is meant for triggers checking a single flag,
+// such as DOKKU_DISABLE_PROXY, on hot paths: rather than loading the env, the ENV file is scanned
+// for the key and only the line setting it is parsed. Files the scan cannot read are loaded in full
+func GetAppBool(appName string, key string, def bool) bool {
+	value, ok, err := scanEnvValue(appName, key)
+	if err == errScanFallback {
+		value, ok = Get(appName, key)
+		err = nil
+	}
+	if err != nil || !ok {
+		return def
+	}
+	return value != "0"
+}
+
+//scanEnvValue returns the value of a key of an app, or of the global env if appName is empty, by
+// scanning its ENV file line by line the way the env is parsed when it is loaded, see loadFromFile.
+// Most keys checked this way are not set, which needs no parsing at all
+func scanEnvValue(appName string, key string) (value string, ok bool, err error) {
+	if err = validateKey(key); err != nil {
+		return
+	}
+	_, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return
+	}
+	contents, _, err := readEnvFile(filename)
+	if os.IsNotExist(err) || (err == nil && !bytes.Contains(contents, []byte(key))) {
+		return "", false, nil
+	}
+	if err != nil {
+		return
+	}
+
+	_, rest := splitFormatHeader(string(contents))
+	found := ""
+	for _, line := range strings.Split(rest, "\n") {
+		//lines are read with a bufio.Scanner, which drops a carriage return ending them and fails
+		// on lines longer than its buffer
+		line = strings.TrimSuffix(line, "\r")
+		if len(line)+1 >= bufio.MaxScanTokenSize {
+			return "", false, errScanFallback
+		}
+		if trimmed := strings.Trim(line, " \n\t"); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		lineKey, parsed := scanLineKey(line)
+		//the keys following a line that cannot be parsed are dropped
+		if !parsed {
+			break
+		}
+		if lineKey == key {
+			found, ok = line, true
+		}
+	}
+	if !ok {
+		return "", false, nil
+	}
+	envMap, err := godotenv.Unmarshal(found)
+	if err != nil {
+		return "", false, err
+	}
+	value, ok = envMap[key]
+	return value, ok, nil
+}
+
+//scanLineKey returns the key a line of an ENV file sets, as godotenv reads it, and whether the line
+// can be parsed at all. Lines holding a # may hold a comment, which only parsing the line tells
+func scanLineKey(line string) (key string, parsed bool) {
+	if strings.Contains(line, "#") {
+		envMap, err := godotenv.Unmarshal(line)
+		if err != nil {
+			return "", false
+		}
+		for k := range envMap {
+			key = k
+		}
+		return key, true
+	}
+	separator := strings.IndexByte(line, '=')
+	if colon := strings.IndexByte(line, ':'); colon != -1 && (colon < separator || separator == -1) {
+		separator = colon
+	}
+	if separator == -1 {
+		return "", false
+	}
+	key = strings.TrimPrefix(line[:separator], "export")
+	return strings.Trim(key, " "), true
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//getBoolFixtureKeys returns every word of a fixture, along with a key no fixture sets, as the keys
+// to compare GetAppBool on
+func getBoolFixtureKeys(contents string) []string {
+	words := regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]*`).FindAllString(contents, -1)
+	return append(words, "NOT_SET", "lowercase", "export")
+}
+
+//referenceGetAppBool is what GetAppBool must return, from the env loaded in full
+func referenceGetAppBool(appName string, key string, def bool) bool {
+	if validateKey(key) != nil {
+		return def
+	}
+	env, err := LoadAppEnv(appName)
+	if err != nil {
+		return def
+	}
+	return env.GetBoolDefault(key, def)
+}
+
+func TestGetAppBoolMatchesLoading(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("flag-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	fixtures, err := filepath.Glob(filepath.Join("testdata", "getbool", "*.env"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fixtures).NotTo(BeEmpty())
+	contents := make(map[string]string, len(fixtures)+1)
+	for _, fixture := range fixtures {
+		fixtureContents, err := ioutil.ReadFile(fixture)
+		Expect(err).NotTo(HaveOccurred())
+		contents[filepath.Base(fixture)] = string(fixtureContents)
+	}
+	//lines longer than the buffer of a bufio.Scanner are left to loading
+	long := strings.Repeat("x", bufio.MaxScanTokenSize)
+	contents["long-line"] = "export BEFORE='0'\nexport LONG='" + long + "'\nexport AFTER='0'\n"
+
+	appfile := filepath.Join(host.root, "flag-app", "ENV")
+	for name, fixture := range contents {
+		for _, key := range getBoolFixtureKeys(fixture) {
+			for _, def := range []bool{true, false} {
+				//loading rewrites ENV files holding invalid keys, so each is read as written
+				Expect(ioutil.WriteFile(appfile, []byte(fixture), 0600)).To(Succeed())
+				actual := GetAppBool("flag-app", key, def)
+				Expect(ioutil.WriteFile(appfile, []byte(fixture), 0600)).To(Succeed())
+				expected := referenceGetAppBool("flag-app", key, def)
+				Expect(actual).To(Equal(expected), "%s in %s with default %t", key, name, def)
+			}
+		}
+	}
+}
+
+func TestGetAppBool(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("flag-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "ENV"), []byte("export DOKKU_DISABLE_PROXY='1'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "flag-app", "ENV"), []byte("export DOKKU_DISABLE_PROXY='0'\n"), 0600)).To(Succeed())
+	Expect(GetAppBool("", "DOKKU_DISABLE_PROXY", false)).To(BeTrue())
+	Expect(GetAppBool("flag-app", "DOKKU_DISABLE_PROXY", true)).To(BeFalse())
+	Expect(GetAppBool("flag-app", "DOKKU_APP_RESTORE", true)).To(BeTrue())
+	Expect(GetAppBool("missing-app", "DOKKU_DISABLE_PROXY", true)).To(BeTrue())
+	Expect(GetAppBool("flag-app", "not a key", true)).To(BeTrue())
+
+	Expect(os.Remove(filepath.Join(host.root, "flag-app", "ENV"))).To(Succeed())
+	Expect(GetAppBool("flag-app", "DOKKU_DISABLE_PROXY", true)).To(BeTrue())
+}
+
+func benchmarkGetAppBool(b *testing.B, get func(string, string, bool) bool) {
+	root, err := setupCacheTestRoot(500)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	previousHost := activeHost
+	activeHost = &testHost{root: root}
+	defer func() { activeHost = previousHost }()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		get("cached-app", "DOKKU_DISABLE_PROXY", false)
+	}
+}
+
+func BenchmarkGetAppBool(b *testing.B) {
+	benchmarkGetAppBool(b, GetAppBool)
+}
+
+func BenchmarkGetAppBoolLoading(b *testing.B) {
+	benchmarkGetAppBool(b, referenceGetAppBool)
+}
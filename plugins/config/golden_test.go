@@ -0,0 +1,137 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+//expectGolden compares actual against testdata/<name>.golden, rewriting it when -update is passed
+func expectGolden(name string, actual string) {
+	goldenFile := filepath.Join("testdata", name+".golden")
+	if *updateGolden {
+		Expect(ioutil.WriteFile(goldenFile, []byte(actual), 0644)).To(Succeed())
+	}
+	expected, err := ioutil.ReadFile(goldenFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(actual).To(Equal(string(expected)))
+}
+
+func TestExportGolden(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := loadFromFile("golden", filepath.Join("testdata", "formats.env"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(9))
+
+	formats := map[string]ExportFormat{
+		"exports":     ExportFormatExports,
+		"envfile":     ExportFormatEnvfile,
+		"docker-args": ExportFormatDockerArgs,
+		"shell":       ExportFormatShell,
+		"pretty":      ExportFormatPretty,
+	}
+	for name, format := range formats {
+		expectGolden("formats."+name, env.Export(format))
+	}
+
+	//adding and removing a key must leave the output unchanged
+	env.Set("AAA", "added")
+	env.Unset("AAA")
+	for name, format := range formats {
+		expectGolden("formats."+name, env.Export(format))
+	}
+}
+
+func TestFormatWithGolden(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := loadFromFile("golden", filepath.Join("testdata", "formats.env"))
+	Expect(err).NotTo(HaveOccurred())
+
+	//the string methods are written with FormatWith and must not change
+	for name, opts := range map[string]FormatOptions{
+		"exports":     {Prefix: "export ", Separator: "\n"},
+		"docker-args": {Prefix: "--env=", Separator: " "},
+		"shell":       {Prefix: "", Separator: " "},
+	} {
+		formatted, err := env.FormatWith(opts)
+		Expect(err).NotTo(HaveOccurred())
+		expectGolden("formats."+name, formatted)
+	}
+
+	formatted, err := env.FormatWith(FormatOptions{
+		Prefix:       "export ",
+		Separator:    "\n",
+		KeyTransform: func(key string) string { return "APP_" + key },
+		SkipKeys:     []string{"EMPTY"},
+	})
+	Expect(err).NotTo(HaveOccurred())
+	expectGolden("formats.key-prefix", formatted)
+}
+
+func TestDiffReportGolden(t *testing.T) {
+	RegisterTestingT(t)
+	from, err := LoadEnvFile(filepath.Join("testdata", "diff.from.env"))
+	Expect(err).NotTo(HaveOccurred())
+	to, err := LoadEnvFile(filepath.Join("testdata", "diff.to.env"))
+	Expect(err).NotTo(HaveOccurred())
+	diff := Diff(from, to)
+
+	//the json format of config:diff and config:drift is read by scripts and must not change
+	for name, showValues := range map[string]bool{"diff.json": false, "diff.show-values.json": true} {
+		out, err := json.MarshalIndent(NewDiffReport(from, to, diff, showValues), "", "  ")
+		Expect(err).NotTo(HaveOccurred())
+		expectGolden(name, string(out)+"\n")
+	}
+
+	//nothing changed is still a document with every field
+	out, err := json.Marshal(NewDiffReport(from, from, Diff(from, from), false))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(out)).To(Equal(`{"added":{},"removed":[],"changed":{}}`))
+}
+
+func TestWriteGolden(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-golden")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	//the bytes Write produces are read by scripts and must not change: \n line endings and exactly
+	// one final newline, whatever the file was read with
+	for _, fixture := range []string{"formats", "lineendings"} {
+		contents, err := ioutil.ReadFile(filepath.Join("testdata", fixture+".env"))
+		Expect(err).NotTo(HaveOccurred())
+		for name, ordered := range map[string]bool{"write": false, "write-ordered": true} {
+			filename := filepath.Join(dir, fixture+"."+name)
+			Expect(ioutil.WriteFile(filename, contents, 0600)).To(Succeed())
+			env, err := loadFromFile("golden", filename)
+			Expect(err).NotTo(HaveOccurred())
+			if ordered {
+				env.PreserveOrder()
+			}
+			Expect(env.Write()).To(Succeed())
+			written, err := ioutil.ReadFile(filename)
+			Expect(err).NotTo(HaveOccurred())
+			expectGolden(fixture+"."+name, string(written))
+
+			//and writing it again changes nothing
+			reloaded, err := loadFromFile("golden", filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(reloaded.Warnings()).To(BeEmpty())
+			Expect(reloaded.Map()).To(Equal(env.Map()))
+			if ordered {
+				reloaded.PreserveOrder()
+			}
+			Expect(reloaded.Write()).To(Succeed())
+			rewritten, err := ioutil.ReadFile(filename)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(rewritten)).To(Equal(string(written)))
+		}
+	}
+}
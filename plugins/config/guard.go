@@ -0,0 +1,106 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//GuardedExportVersion is the version of the guarded export format config:export --guarded writes.
+// A guarded export of version 1 is, line by line:
+//
+//	# dokku-guarded-export 1 <bytes> <sha256>
+//	<guardedExportPreamble, which defines __dokku_guarded_eval>
+//	__dokku_guarded_eval <bytes> <sha256> "$(cat <<'DOKKU_GUARDED_EXPORT_<sha256 prefix>'
+//	<export>
+//	DOKKU_GUARDED_EXPORT_<sha256 prefix>
+//	)"
+//
+// where <bytes> and <sha256> are the length and the hex SHA-256 of the export, which ends without
+// a newline, and the heredoc delimiter ends with the first 16 digits of the checksum. Evaluating a
+// stream cut anywhere before its last line fails on the unterminated command substitution or
+// quote before anything runs, and the checksum catches the rest, so the export is only evaluated
+// whole. The last line is the sentinel VerifyGuardedExport requires
+const GuardedExportVersion = 1
+
+const guardedExportHeader = "# dokku-guarded-export "
+
+//guardedExportSentinel is the last line of a guarded export, which closes the call evaluating it
+const guardedExportSentinel = `)"`
+
+//guardedExportPreamble checks the length and checksum of the export it is given before evaluating
+// it, with whichever of sha256sum and shasum is installed. It removes itself once run, and keeps no
+// variables of its own, so that evaluating an export leaves nothing behind but its variables
+const guardedExportPreamble = `__dokku_guarded_eval() {
+  unset -f __dokku_guarded_eval
+  if [ "$(printf '%s' "$3" | wc -c | tr -d ' ')" != "$1" ] ||
+    [ "$(printf '%s' "$3" | { sha256sum 2>/dev/null || shasum -a 256; } | cut -d' ' -f1)" != "$2" ]; then
+    echo "dokku: the guarded export is truncated or corrupted, it was not evaluated" >&2
+    return 1
+  fi
+  eval "$3"
+}`
+
+//GuardExport wraps an export in the exports or shell format in the guarded export format, see
+// GuardedExportVersion. Trailing newlines are dropped, as the command substitution reading the
+// export back drops them too
+func GuardExport(exported string) string {
+	exported = strings.TrimRight(exported, "\n")
+	sum := sha256.Sum256([]byte(exported))
+	checksum := hex.EncodeToString(sum[:])
+	delimiter := "DOKKU_GUARDED_EXPORT_" + checksum[:16]
+	lines := []string{
+		fmt.Sprintf("%s%d %d %s", guardedExportHeader, GuardedExportVersion, len(exported), checksum),
+		guardedExportPreamble,
+		fmt.Sprintf(`__dokku_guarded_eval %d %s "$(cat <<'%s'`, len(exported), checksum, delimiter),
+	}
+	if exported != "" {
+		lines = append(lines, exported)
+	}
+	lines = append(lines, delimiter, guardedExportSentinel)
+	return strings.Join(lines, "\n") + "\n"
+}
+
+//VerifyGuardedExport returns the export a guarded export holds, failing if it is not in the guarded
+// export format, or was truncated or changed on the way, for consumers that check an export before
+// handing it to a shell rather than relying on its preamble
+func VerifyGuardedExport(guarded string) (string, error) {
+	lines := strings.Split(strings.TrimSuffix(guarded, "\n"), "\n")
+	fields := strings.Fields(strings.TrimPrefix(lines[0], guardedExportHeader))
+	if !strings.HasPrefix(lines[0], guardedExportHeader) || len(fields) != 3 {
+		return "", fmt.Errorf("The export is not guarded, it lacks the %s header", strings.TrimSpace(guardedExportHeader))
+	}
+	if fields[0] != strconv.Itoa(GuardedExportVersion) {
+		return "", fmt.Errorf("Unknown guarded export version %s, expected %d", fields[0], GuardedExportVersion)
+	}
+	length, err := strconv.Atoi(fields[1])
+	if err != nil || length < 0 || len(fields[2]) != sha256.Size*2 {
+		return "", errors.New("The guarded export header is malformed")
+	}
+	checksum := fields[2]
+	if lines[len(lines)-1] != guardedExportSentinel {
+		return "", errors.New("The guarded export is truncated, it does not end with the sentinel line")
+	}
+
+	delimiter := "DOKKU_GUARDED_EXPORT_" + checksum[:16]
+	opening := fmt.Sprintf(`"$(cat <<'%s'`, delimiter)
+	start := -1
+	for i, line := range lines {
+		if strings.HasSuffix(line, opening) {
+			start = i + 1
+			break
+		}
+	}
+	if start == -1 || start > len(lines)-2 || lines[len(lines)-2] != delimiter {
+		return "", errors.New("The guarded export is malformed, the export it holds cannot be found")
+	}
+	exported := strings.Join(lines[start:len(lines)-2], "\n")
+	sum := sha256.Sum256([]byte(exported))
+	if len(exported) != length || hex.EncodeToString(sum[:]) != checksum {
+		return "", fmt.Errorf("The guarded export is truncated or corrupted, it holds %d byte(s) of the %d expected, or they do not match the checksum", len(exported), length)
+	}
+	return exported, nil
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//evalGuarded evaluates a received export in bash as `eval "$(ssh ...)"` would, returning the values
+// of A and B afterwards, or unset for either that is not set
+func evalGuarded(received string) string {
+	cmd := exec.Command("bash", "--noprofile", "--norc", "-c", `eval "$(cat)" 2>/dev/null; printf '%s|%s' "${A-unset}" "${B-unset}"`)
+	cmd.Env = []string{"LC_ALL=C", "PATH=/usr/local/bin:/usr/bin:/bin"}
+	cmd.Stdin = strings.NewReader(received)
+	out, err := cmd.Output()
+	Expect(err).NotTo(HaveOccurred())
+	return string(out)
+}
+
+func TestGuardExport(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, map[string]string{
+		"A": "first line\nDOKKU_GUARDED_EXPORT_\n)\"",
+		"B": "it's $HOME `id`",
+	})
+	exported, err := e.ExportWithOptions(ExportFormatExports, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+
+	guarded := GuardExport(exported)
+	Expect(strings.HasPrefix(guarded, "# dokku-guarded-export 1 ")).To(BeTrue())
+	Expect(strings.HasSuffix(guarded, "\n)\"\n")).To(BeTrue())
+	Expect(GuardExport(exported + "\n")).To(Equal(guarded))
+	verified, err := VerifyGuardedExport(guarded)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(verified).To(Equal(exported))
+
+	empty, err := VerifyGuardedExport(GuardExport(""))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(empty).To(BeEmpty())
+
+	_, err = VerifyGuardedExport(exported)
+	Expect(err).To(MatchError("The export is not guarded, it lacks the # dokku-guarded-export header"))
+	_, err = VerifyGuardedExport(strings.Replace(guarded, "export 1 ", "export 2 ", 1))
+	Expect(err).To(MatchError("Unknown guarded export version 2, expected 1"))
+	_, err = VerifyGuardedExport(strings.Replace(guarded, "$HOME", "$HOMe", 1))
+	Expect(err).To(HaveOccurred())
+	Expect(err.Error()).To(ContainSubstring("truncated or corrupted"))
+}
+
+func TestGuardedExportTruncated(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	e := NewForTest(t, map[string]string{"A": "one\ntwo", "B": "three"})
+	for _, format := range []ExportFormat{ExportFormatExports, ExportFormatShell} {
+		exported, err := e.ExportWithOptions(format, ExportOptions{})
+		Expect(err).NotTo(HaveOccurred())
+		guarded := GuardExport(exported)
+		Expect(evalGuarded(guarded)).To(Equal("one\ntwo|three"))
+
+		//a stream cut at any line, or within one, sets nothing. Only the final newline may be lost
+		cuts := []int{}
+		for i := range guarded {
+			if guarded[i] == '\n' || i%9 == 0 {
+				cuts = append(cuts, i, i+1)
+			}
+		}
+		for _, cut := range cuts {
+			if cut >= len(guarded)-1 {
+				continue
+			}
+			received := guarded[:cut]
+			Expect(evalGuarded(received)).To(Equal("unset|unset"), "cut at byte %d of %d", cut, len(guarded))
+			_, err := VerifyGuardedExport(received)
+			Expect(err).To(HaveOccurred(), "cut at byte %d of %d", cut, len(guarded))
+		}
+
+		//as does one changed on the way
+		tampered := strings.Replace(guarded, "three", "thr3e", 1)
+		Expect(evalGuarded(tampered)).To(Equal("unset|unset"))
+	}
+}
+
+func TestExportGuarded(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+
+	output, err := runSubcommand(host, "export", "--guarded", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	exported, err := VerifyGuardedExport(output)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("export KEY='web-app'"))
+
+	_, err = runSubcommand(host, "export", "--guarded", "--format", "json", "web-app")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--guarded only applies to --format exports and shell"}))
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//DefaultAuditMaxSize is the size in bytes the audit log may reach when config-audit-max-size is unset
+const DefaultAuditMaxSize = 1 << 20
+
+//AuditEntry is a line of the audit log of an env, recording a change made through the config plugin.
+// Only the names of the keys are recorded, never their values
+type AuditEntry struct {
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	Set   []string  `json:"set,omitempty"`
+	Unset []string  `json:"unset,omitempty"`
+	//Restart is recorded on a change made without restarting the app, and on an entry of its own
+	// once the app restarted after a change
+	Restart *AuditRestart `json:"restart,omitempty"`
+}
+
+//AuditRestart records whether an app was restarted after a change, which of its process types
+// were and how long it took
+type AuditRestart struct {
+	//Status is one of RestartStatusRestarted, RestartStatusFailed or RestartStatusSkipped
+	Status string `json:"status"`
+	//ProcessTypes restarted, sorted. Empty means the whole app was
+	ProcessTypes []string   `json:"process_types,omitempty"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+//HistoryPruneResult is what PruneHistory removed from the history of an env
+type HistoryPruneResult struct {
+	//RemovedReleases are the numbers of the release snapshots removed, in ascending order
+	RemovedReleases []int
+	//RotatedAudit is set if the audit log was moved to its .1 file
+	RotatedAudit bool
+}
+
+//auditLogFile returns the audit log kept next to an ENV file, as ENV.audit.log. It is not kept under
+// ENV.d, as that of the global env would then be a directory of DOKKU_ROOT taken for an app
+func auditLogFile(envFile string) string {
+	return envFile + ".audit.log"
+}
+
+//historyLimit returns the number of release snapshots kept for an app, or 0 to keep all of them.
+// config-history-limit takes precedence over release-retention, which it replaces
+func historyLimit(appName string) int {
+	for _, property := range []string{"config-history-limit", "release-retention"} {
+		if value, err := strconv.Atoi(getConfigProperty(appName, property)); err == nil && value >= 0 {
+			return value
+		}
+	}
+	return DefaultReleaseRetention
+}
+
+//auditMaxSize returns the size in bytes the audit log of an app, or of the global env if appName is
+// empty, may reach before it is rotated, or 0 if it is never rotated
+func auditMaxSize(appName string) int64 {
+	if value, err := strconv.ParseInt(getConfigProperty(appName, "config-audit-max-size"), 10, 64); err == nil && value >= 0 {
+		return value
+	}
+	return DefaultAuditMaxSize
+}
+
+//appendAuditLog records a change to the env of an app, or of the global env if appName is empty, in
+// the audit log next to its ENV file. The log is first rotated if the entry would take it past
+// config-audit-max-size. The caller must hold the lock of the ENV file
+func appendAuditLog(appName string, envFile string, set []string, unset []string, restart *AuditRestart, now time.Time) error {
+	if envFile == "" || (len(set)+len(unset) == 0 && restart == nil) {
+		return nil
+	}
+	entry := AuditEntry{Time: now.UTC().Truncate(time.Second), Actor: currentActor(), Set: sortedCopy(set), Unset: sortedCopy(unset), Restart: restart}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	filename := auditLogFile(envFile)
+	if _, err := rotateAuditLog(filename, auditMaxSize(appName), int64(len(line))); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func sortedCopy(keys []string) []string {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+	return sorted
+}
+
+//rotateAuditLog moves the audit log to its .1 file, replacing any previous one, if appending
+// incoming bytes would take it past maxSize. A maxSize of 0 never rotates the log
+func rotateAuditLog(filename string, maxSize int64, incoming int64) (bool, error) {
+	if maxSize == 0 {
+		return false, nil
+	}
+	fi, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if fi.Size() == 0 || fi.Size()+incoming <= maxSize {
+		return false, nil
+	}
+	if err := os.Rename(filename, filename+".1"); err != nil {
+		return false, fmt.Errorf("Unable to rotate %s: %s", filename, err.Error())
+	}
+	return true, nil
+}
+
+//pruneReleases removes the oldest of the given release snapshots, in ascending order, so that at
+// most limit of them are left, and returns the removed ones. The newest snapshot, that of the
+// release currently deployed, is always kept. A limit of 0 keeps every snapshot
+func pruneReleases(dir string, releases []int, limit int) ([]int, error) {
+	removed := []int{}
+	if limit == 0 || len(releases) <= limit {
+		return removed, nil
+	}
+	for _, release := range releases[:len(releases)-limit] {
+		if err := os.Remove(releaseFile(dir, release)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed = append(removed, release)
+	}
+	return removed, nil
+}
+
+//PruneHistory removes the release snapshots of an app beyond config-history-limit and rotates its
+// audit log if it is larger than config-audit-max-size, as is otherwise done whenever they are
+// written. The global env, given by an empty appName, only has an audit log
+func PruneHistory(appName string) (result HistoryPruneResult, err error) {
+	result.RemovedReleases = []int{}
+	_, envFile, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return
+	}
+	if appName != "" {
+		if result.RemovedReleases, err = pruneReleaseHistory(appName); err != nil {
+			return
+		}
+	}
+	unlock, err := lockEnvFile(envFile)
+	if err != nil {
+		return
+	}
+	defer unlock()
+	result.RotatedAudit, err = rotateAuditLog(auditLogFile(envFile), auditMaxSize(appName), 0)
+	return
+}
+
+//pruneReleaseHistory removes the release snapshots of an app beyond config-history-limit
+func pruneReleaseHistory(appName string) ([]int, error) {
+	dir, err := releasesDir(appName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return []int{}, nil
+	}
+	unlock, err := lockEnvFile(filepath.Join(dir, "releases"))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	releases, err := listReleases(dir)
+	if err != nil {
+		return nil, err
+	}
+	return pruneReleases(dir, releases, historyLimit(appName))
+}
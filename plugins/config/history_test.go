@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestAuditLog(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	auditLog := testAppDir + "/ENV.audit.log"
+
+	Expect(SetMany(testAppName, pairs("A", "secret-value", "B", "2"), false)).To(Succeed())
+	Expect(UnsetMany(testAppName, []string{"B"}, false)).To(Succeed())
+	contents, err := ioutil.ReadFile(auditLog)
+	Expect(err).NotTo(HaveOccurred())
+	//only the names of the keys are recorded
+	Expect(string(contents)).NotTo(ContainSubstring("secret-value"))
+	lines := strings.Split(strings.TrimSpace(string(contents)), "\n")
+	Expect(lines).To(HaveLen(2))
+	var entry AuditEntry
+	Expect(json.Unmarshal([]byte(lines[0]), &entry)).To(Succeed())
+	Expect(entry.Set).To(Equal([]string{"A", "B"}))
+	entry = AuditEntry{}
+	Expect(json.Unmarshal([]byte(lines[1]), &entry)).To(Succeed())
+	Expect(entry.Set).To(BeEmpty())
+	Expect(entry.Unset).To(Equal([]string{"B"}))
+
+	//the log is rotated before an entry would take it past the limit
+	Expect(common.PropertyWrite("config", testAppName, "config-audit-max-size", "100")).To(Succeed())
+	Expect(SetMany(testAppName, pairs("C", "3"), false)).To(Succeed())
+	rotated, err := ioutil.ReadFile(auditLog + ".1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rotated).To(Equal(contents))
+	contents, err = ioutil.ReadFile(auditLog)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(strings.Count(string(contents), "\n")).To(Equal(1))
+
+	//a limit of 0 never rotates
+	Expect(common.PropertyWrite("config", testAppName, "config-audit-max-size", "0")).To(Succeed())
+	Expect(SetMany(testAppName, pairs("D", "4"), false)).To(Succeed())
+	Expect(SetMany(testAppName, pairs("E", "5"), false)).To(Succeed())
+	contents, err = ioutil.ReadFile(auditLog)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(strings.Count(string(contents), "\n")).To(Equal(3))
+	os.Remove(auditLog + ".1")
+	os.Remove(globalConfigFile + ".audit.log")
+}
+
+func TestPruneHistory(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(common.PropertyWrite("config", testAppName, "config-history-limit", "0")).To(Succeed())
+	for i := 0; i < 4; i++ {
+		_, err := RecordRelease(testAppName, "latest")
+		Expect(err).NotTo(HaveOccurred())
+	}
+	result, err := PruneHistory(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(Equal(HistoryPruneResult{RemovedReleases: []int{}}))
+
+	//config-history-limit replaces release-retention, which is still read if it is unset
+	Expect(common.PropertyWrite("config", testAppName, "release-retention", "3")).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "config-history-limit", "2")).To(Succeed())
+	Expect(ioutil.WriteFile(testAppDir+"/ENV.audit.log", []byte(strings.Repeat("x", 200)), 0600)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "config-audit-max-size", "100")).To(Succeed())
+	result, err = PruneHistory(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(result).To(Equal(HistoryPruneResult{RemovedReleases: []int{1, 2}, RotatedAudit: true}))
+	releases, err := listReleases(testAppDir + "/ENV.d/releases")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(releases).To(Equal([]int{3, 4}))
+
+	Expect(common.PropertyWrite("config", testAppName, "config-history-limit", "")).To(Succeed())
+	Expect(historyLimit(testAppName)).To(Equal(3))
+	Expect(common.PropertyWrite("config", testAppName, "release-retention", "")).To(Succeed())
+	Expect(historyLimit(testAppName)).To(Equal(DefaultReleaseRetention))
+
+	//the newest snapshot, that of the deployed release, is never removed
+	removed, err := pruneReleases(testAppDir+"/ENV.d/releases", releases, 1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(removed).To(Equal([]int{3}))
+	_, err = LoadRelease(testAppName, 4)
+	Expect(err).NotTo(HaveOccurred())
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//Host is what the config plugin needs from the dokku install it runs on. Subcommands run through
+// RunSubcommand use the Host given to it, everything else uses the one backed by the common plugin
+type Host interface {
+	//DokkuRoot returns the directory holding the global ENV file and the directories of the apps
+	DokkuRoot() (string, error)
+	//VerifyApp returns an error if there is no app by that name
+	VerifyApp(appName string) error
+	//Apps returns the names of all apps, or ErrNoApps if there are none
+	Apps() ([]string, error)
+	//Restart restarts an app, or only the given process types of it if there are any
+	Restart(appName string, processTypes []string) error
+	//Trigger fires a plugin trigger with the given arguments
+	Trigger(name string, args ...string) error
+	//TriggerInput fires a plugin trigger with the given arguments and input on stdin, returning what
+	// the trigger printed
+	TriggerInput(input string, name string, args ...string) (string, error)
+	//TriggerOutput fires a plugin trigger with the given arguments, returning what the trigger
+	// printed to stdout and to stderr
+	TriggerOutput(name string, args ...string) (stdout string, stderr string, err error)
+	//TriggerEach fires a plugin trigger with the given arguments in each enabled plugin implementing
+	// it, one at a time in order of plugin name, returning what each of them printed to stdout
+	TriggerEach(name string, args ...string) ([]PluginOutput, error)
+	//TriggerDetached fires a plugin trigger with the given arguments in a session of its own, without
+	// waiting for it to finish or keeping any of what it prints
+	TriggerDetached(name string, args ...string) error
+}
+
+//ErrNoApps is returned by Host.Apps when there are no apps, rather than the apps failing to be listed
+var ErrNoApps = errors.New("You haven't deployed any applications yet")
+
+//PluginOutput is what a plugin printed to stdout when a trigger was fired through Host.TriggerEach
+type PluginOutput struct {
+	Plugin string
+	Stdout string
+}
+
+//commonHost is the Host of a dokku install, backed by the common plugin
+type commonHost struct{}
+
+//CommonHost returns the Host of the dokku install the plugin runs on
+func CommonHost() Host {
+	return commonHost{}
+}
+
+func (commonHost) DokkuRoot() (string, error) {
+	if root := os.Getenv("DOKKU_ROOT"); root != "" {
+		return root, nil
+	}
+	return "", ErrDokkuRootNotSet
+}
+
+func (commonHost) VerifyApp(appName string) error {
+	return common.VerifyAppName(appName)
+}
+
+//Apps reads DOKKU_ROOT first, as common.DokkuApps fails the same way whether it cannot be read
+// or holds no apps
+func (h commonHost) Apps() ([]string, error) {
+	root, err := h.DokkuRoot()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := ioutil.ReadDir(root); err != nil {
+		return nil, err
+	}
+	apps, err := common.DokkuApps()
+	if err != nil {
+		return nil, ErrNoApps
+	}
+	return apps, nil
+}
+
+func (commonHost) Restart(appName string, processTypes []string) error {
+	return common.PlugnTrigger("app-restart", append([]string{appName}, processTypes...)...)
+}
+
+func (commonHost) Trigger(name string, args ...string) error {
+	return common.PlugnTrigger(name, args...)
+}
+
+func (commonHost) TriggerInput(input string, name string, args ...string) (string, error) {
+	return common.PlugnTriggerInput(input, name, args...)
+}
+
+func (commonHost) TriggerOutput(name string, args ...string) (string, string, error) {
+	return common.PlugnTriggerOutput(name, args...)
+}
+
+//TriggerDetached starts plugn in a new session with stdin, stdout and stderr bound to the null
+// device, so that neither dokku nor the ssh connection it was run over waits for it
+func (commonHost) TriggerDetached(name string, args ...string) error {
+	cmd := exec.Command("plugn", append([]string{"trigger", name}, args...)...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+//TriggerEach runs the trigger of each plugin in PLUGIN_ENABLED_PATH itself, as plugn would, so
+// that what each of them prints can be told apart. A plugin failing fails the trigger with what it
+// printed to stderr. No plugin is enabled outside of dokku, where PLUGIN_ENABLED_PATH is not set
+func (commonHost) TriggerEach(name string, args ...string) ([]PluginOutput, error) {
+	enabled := os.Getenv("PLUGIN_ENABLED_PATH")
+	if enabled == "" {
+		return []PluginOutput{}, nil
+	}
+	//ReadDir returns the plugins sorted by name
+	plugins, err := ioutil.ReadDir(enabled)
+	if err != nil {
+		return nil, err
+	}
+	outputs := []PluginOutput{}
+	for _, plugin := range plugins {
+		script := filepath.Join(enabled, plugin.Name(), name)
+		if info, err := os.Stat(script); err != nil || info.IsDir() || info.Mode()&0111 == 0 {
+			continue
+		}
+		var stdout, stderr bytes.Buffer
+		cmd := exec.Command(script, args...)
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			message := fmt.Sprintf("The %s trigger of %s failed: %s", name, plugin.Name(), err.Error())
+			if output := strings.TrimSpace(stderr.String()); output != "" {
+				message += ", " + output
+			}
+			return nil, errors.New(message)
+		}
+		outputs = append(outputs, PluginOutput{Plugin: plugin.Name(), Stdout: stdout.String()})
+	}
+	return outputs, nil
+}
+
+//activeHost is the Host used by the plugin, replaced while a subcommand runs through RunSubcommand
+var activeHost Host = commonHost{}
+
+//SubcommandError is the error a subcommand run through RunSubcommand fails with. Code is the exit
+// status it has when run by dokku, and Message what it prints, if anything
+type SubcommandError struct {
+	Code    int
+	Message string
+}
+
+func (e *SubcommandError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Message
+}
+
+//runningSubcommand is set while a subcommand runs through RunSubcommand
+var runningSubcommand bool
+
+//logFail fails the current subcommand with text. Outside of RunSubcommand it exits as common.LogFail does
+func logFail(text string) {
+	if runningSubcommand {
+		panic(&SubcommandError{Code: 1, Message: text})
+	}
+	common.LogFail(text)
+}
+
+//failWith fails the current subcommand with err, exiting with the status of its class of error
+func failWith(err error) {
+	failWithStatus(exitStatus(err), err.Error())
+}
+
+//failInvalid fails the current subcommand with text as a usage or validation error
+func failInvalid(text string) {
+	failWithStatus(ExitStatusInvalid, text)
+}
+
+//failWithStatus is logFail with an exit status other than 1
+func failWithStatus(code int, text string) {
+	if runningSubcommand {
+		panic(&SubcommandError{Code: code, Message: text})
+	}
+	fmt.Fprintf(os.Stderr, "FAILED: %s\n", text)
+	os.Exit(code)
+}
+
+//exitWithStatus ends the current subcommand with an exit status and without printing anything
+func exitWithStatus(code int) {
+	if runningSubcommand {
+		panic(&SubcommandError{Code: code})
+	}
+	os.Exit(code)
+}
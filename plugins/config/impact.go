@@ -0,0 +1,100 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//GlobalEffect is what setting a key globally does to the env of an app
+type GlobalEffect string
+
+const (
+	//GlobalEffectInherited is an app that does not set the key itself, and would get the new value
+	GlobalEffectInherited GlobalEffect = "inherited"
+	//GlobalEffectOverridden is an app that sets the key itself, whose value keeps taking effect
+	GlobalEffectOverridden GlobalEffect = "overridden"
+	//GlobalEffectUnchanged is an app that already inherits the same value
+	GlobalEffectUnchanged GlobalEffect = "unchanged"
+)
+
+//GlobalImpact is the effect setting a key globally would have on an app
+type GlobalImpact struct {
+	App    string       `json:"app"`
+	Key    string       `json:"key"`
+	Effect GlobalEffect `json:"effect"`
+}
+
+//PreviewGlobalSet returns the effect setting the given keys globally would have on the deploy env
+// of every app, sorted by key and then by app, without changing anything. A key an app sets
+// itself, for all of its processes, overrides the global value whatever it is, while the global
+// value overrides one contributed by a plugin
+func PreviewGlobalSet(entries map[string]string) ([]GlobalImpact, error) {
+	global, err := LoadGlobalEnv()
+	if err != nil {
+		return nil, err
+	}
+	//no apps is not an error here
+	apps, _ := activeHost.Apps()
+	sort.Strings(apps)
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	effective := make(map[string]*EffectiveEnv, len(apps))
+	for _, app := range apps {
+		if effective[app], err = ResolveEffectiveEnv(app, "", SchedulerPhaseDeploy); err != nil {
+			return nil, err
+		}
+	}
+	impacts := make([]GlobalImpact, 0, len(keys)*len(apps))
+	for _, k := range keys {
+		current, set := global.Get(k)
+		for _, app := range apps {
+			impact := GlobalImpact{App: app, Key: k, Effect: GlobalEffectInherited}
+			chain := storedChain(effective[app].Chain(k))
+			if len(chain) > 0 && chain[len(chain)-1].Layer != LayerGlobal {
+				impact.Effect = GlobalEffectOverridden
+			} else if set && current == entries[k] {
+				impact.Effect = GlobalEffectUnchanged
+			}
+			impacts = append(impacts, impact)
+		}
+	}
+	return impacts, nil
+}
+
+//countGlobalEffects returns the number of impacts of each effect, including those none have
+func countGlobalEffects(impacts []GlobalImpact) map[GlobalEffect]int {
+	counts := map[GlobalEffect]int{GlobalEffectInherited: 0, GlobalEffectOverridden: 0, GlobalEffectUnchanged: 0}
+	for _, impact := range impacts {
+		counts[impact.Effect]++
+	}
+	return counts
+}
+
+//describeGlobalEffect is how config:set --global --preview describes an effect on an app
+func describeGlobalEffect(impact GlobalImpact) string {
+	switch impact.Effect {
+	case GlobalEffectOverridden:
+		return fmt.Sprintf("overridden, the value set for %s takes effect", impact.App)
+	case GlobalEffectUnchanged:
+		return "unchanged, it already inherits this value"
+	}
+	return "inherited, the new value takes effect"
+}
+
+//confirmGlobalSet asks whether to set the previewed keys globally, writing the question to out
+// and reading the answer from in. Only an answer starting with y confirms
+func confirmGlobalSet(in io.Reader, out io.Writer, keys []string) (bool, error) {
+	fmt.Fprintf(out, "Set %s globally? [y/N] ", strings.Join(keys, ", "))
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && (err != io.EOF || answer == "") {
+		return false, fmt.Errorf("Unable to read the answer: %s", err.Error())
+	}
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y"), nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//testTerminal answers the questions asked on it from Reader
+type testTerminal struct {
+	io.Reader
+	asked bytes.Buffer
+}
+
+func (t *testTerminal) Write(p []byte) (int, error) {
+	return t.asked.Write(p)
+}
+
+func (t *testTerminal) Close() error {
+	return nil
+}
+
+//setupPreviewHost creates a host where one app overrides NODE_OPTIONS and every app inherits SHARED
+func setupPreviewHost() (*testHost, func()) {
+	host, teardown := setupTestHost("api-app", "web-app", "worker-app")
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "ENV"), []byte("export SHARED='1'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(filepath.Join(host.root, "web-app", "ENV"), []byte("export NODE_OPTIONS='--app'\n"), 0600)).To(Succeed())
+	return host, teardown
+}
+
+func TestPreviewGlobalSet(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupPreviewHost()
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	impacts, err := PreviewGlobalSet(pairs("NODE_OPTIONS", "--max-old-space-size=512", "SHARED", "1"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(impacts).To(Equal([]GlobalImpact{
+		{App: "api-app", Key: "NODE_OPTIONS", Effect: GlobalEffectInherited},
+		{App: "web-app", Key: "NODE_OPTIONS", Effect: GlobalEffectOverridden},
+		{App: "worker-app", Key: "NODE_OPTIONS", Effect: GlobalEffectInherited},
+		{App: "api-app", Key: "SHARED", Effect: GlobalEffectUnchanged},
+		{App: "web-app", Key: "SHARED", Effect: GlobalEffectUnchanged},
+		{App: "worker-app", Key: "SHARED", Effect: GlobalEffectUnchanged},
+	}))
+	Expect(countGlobalEffects(impacts)).To(Equal(map[GlobalEffect]int{GlobalEffectInherited: 2, GlobalEffectOverridden: 1, GlobalEffectUnchanged: 3}))
+
+	//a new value for a key every app inherits reaches all of them
+	impacts, err = PreviewGlobalSet(pairs("SHARED", "2"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(countGlobalEffects(impacts)).To(Equal(map[GlobalEffect]int{GlobalEffectInherited: 3, GlobalEffectOverridden: 0, GlobalEffectUnchanged: 0}))
+}
+
+func TestRunSubcommandSetPreview(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupPreviewHost()
+	defer teardown()
+	previousTerminal := openTerminal
+	defer func() { openTerminal = previousTerminal }()
+	openTerminal = func() (io.ReadWriteCloser, error) {
+		return nil, errors.New("no terminal")
+	}
+
+	output, err := runSubcommand(host, "set", "--global", "--preview", "--format", "json", "NODE_OPTIONS=--inspect")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal(`{"impacts":[{"app":"api-app","key":"NODE_OPTIONS","effect":"inherited"},{"app":"web-app","key":"NODE_OPTIONS","effect":"overridden"},{"app":"worker-app","key":"NODE_OPTIONS","effect":"inherited"}],"summary":{"inherited":2,"overridden":1,"unchanged":0}}` + "\n"))
+
+	output, err = runSubcommand(host, "set", "--global", "--preview", "NODE_OPTIONS=--inspect")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("=====> Preview of setting NODE_OPTIONS globally\n" +
+		"       api-app:     inherited, the new value takes effect\n" +
+		"       web-app:     overridden, the value set for web-app takes effect\n" +
+		"       worker-app:  inherited, the new value takes effect\n" +
+		"=====> 2 inherited, 1 overridden, 0 unchanged\n" +
+		"-----> Nothing was changed, run the command again without --preview to set the keys\n"))
+	Expect(host.triggers).To(BeEmpty())
+	global, err := loadFromFile("<global>", filepath.Join(host.root, "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Map()).To(Equal(pairs("SHARED", "1")))
+
+	//only an answer of yes on the terminal sets the keys
+	openTerminal = func() (io.ReadWriteCloser, error) {
+		return &testTerminal{Reader: strings.NewReader("n\n")}, nil
+	}
+	output, err = runSubcommand(host, "set", "--global", "--preview", "NODE_OPTIONS=--inspect")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("Nothing was changed"))
+	terminal := &testTerminal{Reader: strings.NewReader("y\n")}
+	openTerminal = func() (io.ReadWriteCloser, error) {
+		return terminal, nil
+	}
+	output, err = runSubcommand(host, "set", "--global", "--preview", "NODE_OPTIONS=--inspect")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(terminal.asked.String()).To(Equal("Set NODE_OPTIONS globally? [y/N] "))
+	Expect(output).To(ContainSubstring("-----> Setting config vars"))
+	global, err = loadFromFile("<global>", filepath.Join(host.root, "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Map()).To(Equal(pairs("SHARED", "1", "NODE_OPTIONS", "--inspect")))
+
+	_, err = runSubcommand(host, "set", "--preview", "web-app", "NODE_OPTIONS=--inspect")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--preview only applies to --global"}))
+	_, err = runSubcommand(host, "set", "--format", "json", "--global", "NODE_OPTIONS=--inspect")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--format only applies to --preview"}))
+	_, err = runSubcommand(host, "set", "--preview", "--format", "yaml", "--global", "NODE_OPTIONS=--inspect")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "Unknown format: yaml, expected text or json"}))
+}
@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//Formats accepted by config:import
+const (
+	importFormatHerokuJSON = "heroku-json"
+	importFormatHerokuText = "heroku-text"
+	//importFormatDockerEnvfile is the file read by docker run --env-file, see NewFromDockerEnvFile
+	importFormatDockerEnvfile = "docker-envfile"
+)
+
+//What config:import --on-conflict does with keys already set to another value
+const (
+	importConflictOverwrite   = "overwrite"
+	importConflictKeep        = "keep"
+	importConflictFail        = "fail"
+	importConflictInteractive = "interactive"
+)
+
+//importMergeStrategy returns the MergeStrategy of an --on-conflict mode. The interactive mode
+// overwrites the keys left in the imported env once those to keep were taken out of it
+func importMergeStrategy(mode string) (MergeStrategy, error) {
+	switch mode {
+	case importConflictOverwrite, importConflictInteractive:
+		return MergeOverwrite, nil
+	case importConflictKeep:
+		return MergeKeep, nil
+	case importConflictFail:
+		return MergeFail, nil
+	}
+	return MergeOverwrite, &ValidationError{Message: fmt.Sprintf("Unknown conflict mode '%s', expected --on-conflict %s, %s, %s or %s", mode, importConflictOverwrite, importConflictKeep, importConflictFail, importConflictInteractive)}
+}
+
+//promptConflicts asks whether to overwrite each of the conflicting keys, writing the question with
+// both values redacted to out and reading the answers from in, and returns the keys to keep. Only
+// an answer starting with y overwrites a key
+func promptConflicts(in io.Reader, out io.Writer, current *Env, imported *Env, conflicts []string) ([]string, error) {
+	kept := []string{}
+	reader := bufio.NewReader(in)
+	for _, k := range conflicts {
+		fmt.Fprintf(out, "%s is already set\n  current:  %s\n  imported: %s\nOverwrite %s? [y/N] ", k, describeRedacted(current.values()[k]), describeRedacted(imported.values()[k]), k)
+		answer, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || answer == "") {
+			return nil, fmt.Errorf("Unable to read the answer for %s: %s", k, err.Error())
+		}
+		if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+			kept = append(kept, k)
+		}
+	}
+	return kept, nil
+}
+
+//describeRedacted describes a value without showing it, by its length and the start of its checksum
+func describeRedacted(value string) string {
+	return fmt.Sprintf("%s (%d bytes, sha256 %s)", RedactedValue, len(value), ValueChecksum(value)[:12])
+}
+
+//defaultImportStrip matches the keys Heroku manages itself, which are meaningless to dokku
+var defaultImportStrip = []string{"HEROKU_*"}
+
+//newFromHerokuText creates an env from the output of `heroku config`, which lists each key
+// followed by a colon and its value, aligned with spaces, below a === header. The env is not
+// bound to a file, so it cannot be written
+func newFromHerokuText(name string, rep string) (*Env, error) {
+	env := &Env{name: name, vars: map[string]string{}}
+	scanner := bufio.NewScanner(strings.NewReader(rep))
+	scanner.Buffer(make([]byte, 64*1024), 1<<30)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "===") {
+			continue
+		}
+		parts := strings.SplitN(text, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Unable to parse %s: expected KEY: value on line %d", name, line)
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if err := validateKey(key); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: %s on line %d", name, err.Error(), line)
+		}
+		if err := env.Set(key, value); err != nil {
+			return nil, fmt.Errorf("Unable to parse %s: invalid value of %s: %s", name, key, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Unable to read %s: %s", name, err.Error())
+	}
+	return env, nil
+}
+
+//splitNulPairs splits the KEY=VALUE records read by config:set --stdin-pairs, each ended by a NUL
+// byte. The NUL after the last record may be left out. Records are identified by their position
+// in the errors returned, as they may hold secret values
+func splitNulPairs(input []byte) ([]string, error) {
+	rep := strings.TrimSuffix(string(input), "\x00")
+	if rep == "" {
+		return nil, fmt.Errorf("No KEY=VALUE records read from stdin")
+	}
+	records := strings.Split(rep, "\x00")
+	for i, record := range records {
+		if !strings.Contains(record, "=") {
+			return nil, &ValidationError{Message: fmt.Sprintf("Invalid env pair in record %d of stdin, expected KEY=VALUE", i+1)}
+		}
+	}
+	return records, nil
+}
+
+//stripKeys removes the keys of the env matching any of the glob patterns, returning them sorted
+func stripKeys(env *Env, patterns []string) []string {
+	stripped := []string{}
+	for _, k := range env.Keys() {
+		if matchesAny(k, patterns) {
+			//the env was just read from the import, so it is writable
+			env.Unset(k)
+			stripped = append(stripped, k)
+		}
+	}
+	sort.Strings(stripped)
+	return stripped
+}
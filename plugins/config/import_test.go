@@ -0,0 +1,106 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewFromJSON(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := NewFromJSON("heroku", []byte(`{
+  "DATABASE_URL": "postgres://u:p@host:5432/db",
+  "HEROKU_APP_NAME": "example",
+  "MULTILINE": "a\nb",
+  "EMPTY": ""
+}`))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Name()).To(Equal("heroku"))
+	Expect(env.Map()).To(Equal(pairs("DATABASE_URL", "postgres://u:p@host:5432/db", "HEROKU_APP_NAME", "example", "MULTILINE", "a\nb", "EMPTY", "")))
+	Expect(env.Write()).NotTo(Succeed())
+
+	_, err = NewFromJSON("heroku", []byte(`{"PORT": 5000}`))
+	Expect(err).To(MatchError("Unable to parse heroku: value of PORT is not a string"))
+	_, err = NewFromJSON("heroku", []byte(`{"-bad": "x"}`))
+	Expect(err).To(MatchError("Unable to parse heroku: Invalid key name: '-bad'"))
+	_, err = NewFromJSON("heroku", []byte(`{"NUL": "a\u0000b"}`))
+	Expect(err).To(MatchError("Unable to parse heroku: invalid value of NUL: value contains a NUL byte"))
+	_, err = NewFromJSON("heroku", []byte(`["A"]`))
+	Expect(err).To(HaveOccurred())
+}
+
+func TestNewFromHerokuText(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := newFromHerokuText("runbook", "=== example Config Vars\r\nDATABASE_URL:    postgres://u:p@host:5432/db\r\nHEROKU_APP_NAME: example\n\nTIME:            12:30\nEMPTY:\n")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("DATABASE_URL", "postgres://u:p@host:5432/db", "HEROKU_APP_NAME", "example", "TIME", "12:30", "EMPTY", "")))
+
+	Expect(stripKeys(env, defaultImportStrip)).To(Equal([]string{"HEROKU_APP_NAME"}))
+	Expect(env.Keys()).To(Equal([]string{"DATABASE_URL", "EMPTY", "TIME"}))
+	Expect(stripKeys(env, []string{""})).To(BeEmpty())
+
+	_, err = newFromHerokuText("runbook", "=== example Config Vars\nDATABASE_URL\n")
+	Expect(err).To(MatchError("Unable to parse runbook: expected KEY: value on line 2"))
+	_, err = newFromHerokuText("runbook", "MY KEY: value\n")
+	Expect(err).To(MatchError("Unable to parse runbook: Invalid key name: 'MY KEY' on line 1"))
+}
+
+func TestSplitNulPairs(t *testing.T) {
+	RegisterTestingT(t)
+	records, err := splitNulPairs([]byte("A=1\x00CERT=line 1\nline 2\x00EMPTY=\x00"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(records).To(Equal([]string{"A=1", "CERT=line 1\nline 2", "EMPTY="}))
+
+	//the last record does not need to be terminated
+	records, err = splitNulPairs([]byte("A=1\x00B=a=b"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(records).To(Equal([]string{"A=1", "B=a=b"}))
+
+	_, err = splitNulPairs([]byte(""))
+	Expect(err).To(MatchError("No KEY=VALUE records read from stdin"))
+	_, err = splitNulPairs([]byte("\x00"))
+	Expect(err).To(MatchError("No KEY=VALUE records read from stdin"))
+	_, err = splitNulPairs([]byte("A=1\x00s3cr3t\x00"))
+	Expect(err).To(MatchError("Invalid env pair in record 2 of stdin, expected KEY=VALUE"))
+	_, err = splitNulPairs([]byte("A=1\x00\x00B=2"))
+	Expect(err).To(MatchError("Invalid env pair in record 2 of stdin, expected KEY=VALUE"))
+}
+
+func TestImportMergeStrategy(t *testing.T) {
+	RegisterTestingT(t)
+	for mode, expected := range map[string]MergeStrategy{
+		"overwrite":   MergeOverwrite,
+		"interactive": MergeOverwrite,
+		"keep":        MergeKeep,
+		"fail":        MergeFail,
+	} {
+		strategy, err := importMergeStrategy(mode)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strategy).To(Equal(expected), mode)
+	}
+	_, err := importMergeStrategy("skip")
+	Expect(err).To(MatchError("Unknown conflict mode 'skip', expected --on-conflict overwrite, keep, fail or interactive"))
+}
+
+func TestPromptConflicts(t *testing.T) {
+	RegisterTestingT(t)
+	current := NewForTest(t, pairs("A", "s3cr3t", "B", "2", "C", "3"))
+	imported := NewForTest(t, pairs("A", "n3w", "B", "two", "C", "three"))
+	conflicts := current.Conflicts(imported)
+
+	var out bytes.Buffer
+	kept, err := promptConflicts(strings.NewReader("y\n\nYes"), &out, current, imported, conflicts)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(kept).To(Equal([]string{"B"}))
+	//values are never shown
+	Expect(out.String()).NotTo(ContainSubstring("s3cr3t"))
+	Expect(out.String()).NotTo(ContainSubstring("n3w"))
+	Expect(out.String()).To(HavePrefix("A is already set\n  current:  " + RedactedValue + " (6 bytes, sha256 " + ValueChecksum("s3cr3t")[:12] + ")\n"))
+	Expect(out.String()).To(ContainSubstring("Overwrite C? [y/N] "))
+
+	//running out of answers fails rather than choosing for the user
+	_, err = promptConflicts(strings.NewReader("n\n"), &out, current, imported, conflicts)
+	Expect(err).To(MatchError("Unable to read the answer for B: EOF"))
+}
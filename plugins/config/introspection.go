@@ -0,0 +1,158 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+//IntrospectionMaxSize is the size in bytes the json document of IntrospectConfig is capped at. Key
+// names beyond it are left out of the document, which is then marked as truncated
+const IntrospectionMaxSize = 8192
+
+//configMetadataKey is the key containers are given the introspection document in when the
+// config-metadata property is set
+const configMetadataKey = "DOKKU_CONFIG_METADATA"
+
+//ConfigIntrospection describes the config of an app for the app itself, without any of its values
+type ConfigIntrospection struct {
+	App string `json:"app"`
+	//Keys are the names of the keys of the env of the app merged with the global env, sorted.
+	// KeyCount is their number, which is larger than len(Keys) if the document was truncated
+	Keys      []string `json:"keys"`
+	KeyCount  int      `json:"key_count"`
+	Truncated bool     `json:"truncated"`
+	//Checksum is that of the merged env, as recorded by the release snapshots
+	Checksum string `json:"checksum"`
+	//LastModified is when the ENV file of the app or the global one was last written, or nil if
+	// neither exists
+	LastModified *time.Time `json:"last_modified"`
+	//RestartPending is whether the config changed since the app was last deployed or restarted, or
+	// nil if neither has been recorded, see GetPendingRestart
+	RestartPending *bool `json:"restart_pending"`
+}
+
+//IntrospectConfig describes the config of an app without its values, see ConfigIntrospection
+func IntrospectConfig(appName string) (introspection ConfigIntrospection, err error) {
+	resolver := NewPathResolver()
+	appfile, err := resolver.AppFile(appName)
+	if err != nil {
+		return
+	}
+	globalfile, err := resolver.GlobalFile()
+	if err != nil {
+		return
+	}
+	env, err := LoadMergedAppEnv(appName)
+	if err != nil {
+		return
+	}
+	pending, err := GetPendingRestart(appName)
+	if err != nil {
+		return
+	}
+
+	introspection = ConfigIntrospection{
+		App:      appName,
+		Keys:     env.Keys(),
+		KeyCount: env.Len(),
+		Checksum: env.Checksum(),
+	}
+	for _, filename := range []string{globalfile, appfile} {
+		if version, ok := statFileVersion(filename); ok {
+			modified := version.modTime.UTC()
+			if introspection.LastModified == nil || modified.After(*introspection.LastModified) {
+				introspection.LastModified = &modified
+			}
+		}
+	}
+	if pending.Recorded {
+		restartPending := pending.Pending()
+		introspection.RestartPending = &restartPending
+	}
+	return
+}
+
+//JSON returns the introspection document, leaving out as many key names as needed, from the end,
+// for it to fit in IntrospectionMaxSize
+func (c ConfigIntrospection) JSON() (string, error) {
+	keys := c.Keys
+	c.Keys = []string{}
+	c.Truncated = true
+	empty, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	size := len(empty)
+	fitting := 0
+	for _, k := range keys {
+		name, err := json.Marshal(k)
+		if err != nil {
+			return "", err
+		}
+		//every key but the first is preceded by a comma
+		size += len(name)
+		if fitting > 0 {
+			size++
+		}
+		if size > IntrospectionMaxSize {
+			break
+		}
+		fitting++
+	}
+	c.Keys = keys[:fitting]
+	c.Truncated = fitting < len(keys)
+	document, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	if len(document) > IntrospectionMaxSize {
+		return "", fmt.Errorf("The config metadata of %s does not fit in %d bytes", c.App, IntrospectionMaxSize)
+	}
+	return string(document), nil
+}
+
+//withConfigMetadata returns the env of a container with the introspection document of the app in
+// DOKKU_CONFIG_METADATA if the config-metadata property is set for it, or the env unchanged
+func withConfigMetadata(env *Env, appName string) (*Env, error) {
+	if appName == "" || !getBoolProperty(appName, "config-metadata") {
+		return env, nil
+	}
+	introspection, err := IntrospectConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	document, err := introspection.JSON()
+	if err != nil {
+		return nil, err
+	}
+	withMetadata := env.clone()
+	if err := withMetadata.Set(configMetadataKey, document); err != nil {
+		return nil, err
+	}
+	withMetadata.readOnly = true
+	return withMetadata, nil
+}
+
+//TriggerIntrospection implements the config-introspection trigger by writing the introspection
+// document of an app to output, followed by a newline. An app that does not exist exits with
+// ExitCodeAppNotFound
+func TriggerIntrospection(appName string, output io.Writer) error {
+	if _, err := NewPathResolver().AppFile(appName); err != nil {
+		if _, ok := err.(*AppNotFoundError); ok {
+			return &TriggerError{ExitCode: ExitCodeAppNotFound, Err: err}
+		}
+		return err
+	}
+	introspection, err := IntrospectConfig(appName)
+	if err != nil {
+		return err
+	}
+	document, err := introspection.JSON()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(output, document)
+	return err
+}
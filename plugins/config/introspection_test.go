@@ -0,0 +1,118 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+	. "github.com/onsi/gomega"
+)
+
+//expectIntrospectionInSync checks that the introspection document of the test app describes the
+// config it has now, and returns it
+func expectIntrospectionInSync() ConfigIntrospection {
+	var out bytes.Buffer
+	Expect(TriggerIntrospection(testAppName, &out)).To(Succeed())
+	var introspection ConfigIntrospection
+	Expect(json.Unmarshal(out.Bytes(), &introspection)).To(Succeed())
+
+	env, err := LoadMergedAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(introspection.App).To(Equal(testAppName))
+	Expect(introspection.Keys).To(Equal(env.Keys()))
+	Expect(introspection.KeyCount).To(Equal(env.Len()))
+	Expect(introspection.Truncated).To(BeFalse())
+	Expect(introspection.Checksum).To(Equal(env.Checksum()))
+	Expect(introspection.LastModified).NotTo(BeNil())
+	for _, v := range env.Map() {
+		Expect(out.String()).NotTo(ContainSubstring(v))
+	}
+	return introspection
+}
+
+func TestIntrospectConfig(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	introspection := expectIntrospectionInSync()
+	Expect(introspection.Keys).To(Equal([]string{"globalKey", "testKey"}))
+	Expect(introspection.RestartPending).To(BeNil())
+
+	_, err := RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	introspection = expectIntrospectionInSync()
+	Expect(*introspection.RestartPending).To(BeFalse())
+
+	Expect(SetMany(testAppName, pairs("SECRET", "s3cr3t", "testKey", "CHANGED"), false)).To(Succeed())
+	introspection = expectIntrospectionInSync()
+	Expect(introspection.Keys).To(Equal([]string{"SECRET", "globalKey", "testKey"}))
+	Expect(*introspection.RestartPending).To(BeTrue())
+
+	Expect(UnsetMany("", []string{"globalKey"}, false)).To(Succeed())
+	Expect(UnsetMany(testAppName, []string{"SECRET"}, false)).To(Succeed())
+	introspection = expectIntrospectionInSync()
+	Expect(introspection.Keys).To(Equal([]string{"testKey"}))
+
+	var out bytes.Buffer
+	expectTriggerExitCode(TriggerIntrospection("missing-app", &out), ExitCodeAppNotFound)
+	Expect(out.Len()).To(Equal(0))
+}
+
+func TestIntrospectionTruncated(t *testing.T) {
+	RegisterTestingT(t)
+	introspection := ConfigIntrospection{App: testAppName, Checksum: strings.Repeat("0", 64)}
+	for i := 0; i < 1000; i++ {
+		introspection.Keys = append(introspection.Keys, fmt.Sprintf("SOME_RATHER_LONG_KEY_%04d", i))
+	}
+	introspection.KeyCount = len(introspection.Keys)
+
+	document, err := introspection.JSON()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(len(document)).To(BeNumerically("<=", IntrospectionMaxSize))
+	Expect(len(document)).To(BeNumerically(">", IntrospectionMaxSize-30))
+	var truncated ConfigIntrospection
+	Expect(json.Unmarshal([]byte(document), &truncated)).To(Succeed())
+	Expect(truncated.Truncated).To(BeTrue())
+	Expect(truncated.KeyCount).To(Equal(1000))
+	Expect(truncated.Keys).To(Equal(introspection.Keys[:len(truncated.Keys)]))
+
+	//a document that fits is left whole
+	introspection.Keys = introspection.Keys[:10]
+	document, err = introspection.JSON()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(json.Unmarshal([]byte(document), &truncated)).To(Succeed())
+	Expect(truncated.Truncated).To(BeFalse())
+	Expect(truncated.Keys).To(HaveLen(10))
+}
+
+func TestContainerEnvConfigMetadata(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	container, err := ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()).NotTo(HaveKey(configMetadataKey))
+
+	Expect(common.PropertyWrite("config", testAppName, "config-metadata", "true")).To(Succeed())
+	Expect(SetMany(testAppName, pairs("SECRET", "s3cr3t"), false)).To(Succeed())
+	container, err = ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	document, ok := container.Get(configMetadataKey)
+	Expect(ok).To(BeTrue())
+	Expect(document).NotTo(ContainSubstring("s3cr3t"))
+	var introspection ConfigIntrospection
+	Expect(json.Unmarshal([]byte(document), &introspection)).To(Succeed())
+	Expect(introspection.Keys).To(Equal([]string{"SECRET", "globalKey", "testKey"}))
+
+	//the build does not get it
+	build, err := ResolveSchedulerEnv(testAppName, "", SchedulerPhaseBuild)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(build.Map()).NotTo(HaveKey(configMetadataKey))
+}
@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+)
+
+//KeyCase is a naming convention keys are renamed to on export
+type KeyCase string
+
+const (
+	//KeyCaseNone keeps keys as they are
+	KeyCaseNone KeyCase = ""
+	//KeyCaseUpper uppercases keys: database_url becomes DATABASE_URL
+	KeyCaseUpper KeyCase = "upper"
+	//KeyCaseLower lowercases keys: DATABASE_URL becomes database_url
+	KeyCaseLower KeyCase = "lower"
+	//KeyCaseKebab lowercases keys and joins their words with dashes: DATABASE_URL becomes database-url
+	KeyCaseKebab KeyCase = "kebab"
+	//KeyCaseCamel joins the words of keys in camel case: DATABASE_URL becomes databaseUrl
+	KeyCaseCamel KeyCase = "camel"
+)
+
+//ParseKeyCase returns the KeyCase of its name, one of upper, lower, kebab or camel
+func ParseKeyCase(value string) (KeyCase, error) {
+	switch KeyCase(value) {
+	case KeyCaseUpper, KeyCaseLower, KeyCaseKebab, KeyCaseCamel:
+		return KeyCase(value), nil
+	}
+	return KeyCaseNone, &ValidationError{Message: fmt.Sprintf("Unknown key transform: %s, expected one of upper, lower, kebab or camel", value)}
+}
+
+//KeyTransform describes how keys are renamed on export: StripPrefix is removed from the keys that
+// start with it, what is left is converted to Case, and Prefix is prepended as given
+type KeyTransform struct {
+	Case        KeyCase
+	Prefix      string
+	StripPrefix string
+}
+
+//Func returns the function renaming keys as described, for the KeyTransform of ExportOptions and
+// FormatOptions, or nil if keys are kept as they are
+func (t KeyTransform) Func() func(key string) string {
+	if t == (KeyTransform{}) {
+		return nil
+	}
+	return func(key string) string {
+		key = strings.TrimPrefix(key, t.StripPrefix)
+		return t.Prefix + convertKeyCase(key, t.Case)
+	}
+}
+
+//convertKeyCase converts a key to a naming convention, taking underscores to separate its words
+func convertKeyCase(key string, keyCase KeyCase) string {
+	switch keyCase {
+	case KeyCaseUpper:
+		return strings.ToUpper(key)
+	case KeyCaseLower:
+		return strings.ToLower(key)
+	}
+	words := strings.FieldsFunc(strings.ToLower(key), func(r rune) bool {
+		return r == '_'
+	})
+	switch keyCase {
+	case KeyCaseKebab:
+		return strings.Join(words, "-")
+	case KeyCaseCamel:
+		for i := 1; i < len(words); i++ {
+			words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+		}
+		return strings.Join(words, "")
+	}
+	return key
+}
+
+//keyTransformFormatted reports whether a format renames keys itself while formatting them
+func keyTransformFormatted(format ExportFormat) bool {
+	return format == ExportFormatExports || format == ExportFormatDockerArgs || format == ExportFormatShell
+}
+
+//withTransformedKeys returns a read-only copy of this Env with its keys, their order and their
+// metadata renamed by transform, for the formats that do not rename keys themselves. The envfile
+// and docker-envfile formats are read by shells and docker, so their keys must stay valid keys,
+// while the other formats only refuse names that are empty or hold a = or NUL byte
+func (e *Env) withTransformedKeys(format ExportFormat, transform func(key string) string) (*Env, error) {
+	meta, err := e.Metadata()
+	if err != nil {
+		return nil, err
+	}
+	renamed := &Env{
+		name:     e.name,
+		vars:     make(map[string]string, len(e.values())),
+		meta:     map[string]KeyMetadata{},
+		warnings: e.warnings,
+		readOnly: true,
+	}
+	names := make(map[string]string, len(e.values()))
+	transformed := make(map[string]string, len(e.values()))
+	for _, k := range e.sortKeys() {
+		name := transform(k)
+		if format == ExportFormatEnvfile || format == ExportFormatDockerEnvfile {
+			if err := validateKey(name); err != nil {
+				return nil, fmt.Errorf("Key %s cannot be exported as %s: %s", k, name, err.Error())
+			}
+		} else if name == "" || strings.ContainsAny(name, "=\x00") {
+			return nil, fmt.Errorf("Key %s cannot be exported as '%s'", k, name)
+		}
+		if other, ok := transformed[name]; ok {
+			return nil, fmt.Errorf("Keys %s and %s would both be exported as %s", other, k, name)
+		}
+		transformed[name] = k
+		names[k] = name
+		renamed.values()[name] = e.values()[k]
+		if m, ok := meta[k]; ok {
+			renamed.meta[name] = m
+		}
+	}
+	if e.order != nil {
+		renamed.order = make([]string, 0, len(e.order))
+		for _, k := range e.order {
+			renamed.order = append(renamed.order, names[k])
+		}
+	}
+	return renamed, nil
+}
+
+//applyKeyTransform returns the Env and options a format is exported with once the keys are renamed
+// by the KeyTransform of opts, which the formats that do not rename keys themselves get as a copy
+// of this Env with renamed keys
+func (e *Env) applyKeyTransform(format ExportFormat, opts ExportOptions) (*Env, ExportOptions, error) {
+	if opts.KeyTransform == nil || keyTransformFormatted(format) {
+		return e, opts, nil
+	}
+	renamed, err := e.withTransformedKeys(format, opts.KeyTransform)
+	if err != nil {
+		return nil, opts, err
+	}
+	opts.KeyTransform = nil
+	return renamed, opts, nil
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestKeyTransform(t *testing.T) {
+	RegisterTestingT(t)
+	for keyCase, expected := range map[KeyCase]string{
+		KeyCaseUpper: "APP_DATABASE__URL_V2",
+		KeyCaseLower: "app_database__url_v2",
+		KeyCaseKebab: "database-url-v2",
+		KeyCaseCamel: "databaseUrlV2",
+	} {
+		transform := KeyTransform{Case: keyCase}
+		if keyCase == KeyCaseKebab || keyCase == KeyCaseCamel {
+			transform.StripPrefix = "APP_"
+		}
+		Expect(transform.Func()("APP_Database__URL_v2")).To(Equal(expected))
+	}
+	Expect(KeyTransform{Case: KeyCaseKebab, Prefix: "web-", StripPrefix: "APP_"}.Func()("OTHER_KEY")).To(Equal("web-other-key"))
+	Expect(KeyTransform{}.Func()).To(BeNil())
+	_, err := ParseKeyCase("snake")
+	Expect(err).To(MatchError("Unknown key transform: snake, expected one of upper, lower, kebab or camel"))
+}
+
+func TestExportKeyTransform(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("DATABASE_URL", "postgres://db", "APP_NAME", "web"))
+	kebab := ExportOptions{KeyTransform: KeyTransform{Case: KeyCaseKebab}.Func()}
+
+	//the json, compose and streamed formats take any name
+	exported, err := env.ExportWithOptions(ExportFormatJSON, kebab)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal(`{"app-name":{"value":"web"},"database-url":{"value":"postgres://db"}}`))
+	exported, err = env.ExportWithOptions(ExportFormatCompose, ExportOptions{KeyTransform: kebab.KeyTransform, ComposeMap: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(ContainSubstring(`      app-name: "web"`))
+	var out bytes.Buffer
+	Expect(env.ExportTo(&out, ExportFormatNul, kebab)).To(Succeed())
+	Expect(out.String()).To(Equal("app-name\x00web\x00database-url\x00postgres://db\x00"))
+
+	//the shell formats refuse names that are not valid keys
+	_, err = env.ExportWithOptions(ExportFormatEnvfile, kebab)
+	Expect(err).To(MatchError("Key APP_NAME cannot be exported as app-name: Invalid key name: 'app-name'"))
+	_, err = env.ExportWithOptions(ExportFormatExports, kebab)
+	Expect(err).To(MatchError("Key APP_NAME cannot be exported as app-name: Invalid key name: 'app-name'"))
+	exported, err = env.ExportWithOptions(ExportFormatEnvfile, ExportOptions{KeyTransform: KeyTransform{Case: KeyCaseLower}.Func()})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("app_name=\"web\"\ndatabase_url=\"postgres://db\""))
+
+	//two keys renamed to the same name are an error naming both
+	_, err = env.ExportWithOptions(ExportFormatJSON, ExportOptions{KeyTransform: KeyTransform{StripPrefix: "APP_", Case: KeyCaseUpper}.Func()})
+	Expect(err).NotTo(HaveOccurred())
+	collision := NewForTest(t, pairs("APP_NAME", "web", "NAME", "other"))
+	_, err = collision.ExportWithOptions(ExportFormatJSON, ExportOptions{KeyTransform: KeyTransform{StripPrefix: "APP_"}.Func()})
+	Expect(err).To(MatchError("Keys APP_NAME and NAME would both be exported as NAME"))
+}
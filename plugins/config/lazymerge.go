@@ -0,0 +1,58 @@
+package config
+
+//lazyMerge returns a read-only Env that is the given envs merged in order, as Merge would merge
+// each of them on top of a clone of the first, without copying any of their keys. Get reads the
+// value of a key through the layers, while anything that needs all of the keys, such as Keys or
+// an export, puts them together once. The layers must not be changed afterwards
+func lazyMerge(name string, layers []*Env) *Env {
+	first := layers[0]
+	return &Env{
+		name:       name,
+		layers:     layers,
+		ordered:    first.ordered,
+		layout:     first.layout,
+		compressed: first.compressed,
+		fileFormat: first.fileFormat,
+		format:     first.format,
+		warnings:   first.warnings,
+		readOnly:   true,
+		scope:      Scope{Kind: ScopeMerged},
+	}
+}
+
+//materialize puts together the keys and order of a lazily merged env from its layers, after which
+// it is like any other Env
+func (e *Env) materialize() {
+	if e.layers == nil {
+		return
+	}
+	layers := e.layers
+	e.layers = nil
+	merged := layers[0].clone()
+	//the clone is writable, so merging into it cannot fail
+	for _, layer := range layers[1:] {
+		merged.Merge(layer)
+	}
+	e.vars, e.order = merged.vars, merged.order
+}
+
+//values returns the keys of this Env along with their values, see Map
+func (e *Env) values() map[string]string {
+	e.materialize()
+	return e.vars
+}
+
+//lookup returns the value of a key, reading it from the topmost layer that sets it if this Env is
+// still lazily merged
+func (e *Env) lookup(key string) (value string, ok bool) {
+	if e.layers == nil {
+		value, ok = e.vars[key]
+		return
+	}
+	for i := len(e.layers) - 1; i >= 0; i-- {
+		if value, ok = e.layers[i].lookup(key); ok {
+			return
+		}
+	}
+	return
+}
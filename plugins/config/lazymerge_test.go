@@ -0,0 +1,168 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//layerContents returns the contents of an ENV file with count keys named prefix0000 and on, each
+// set to its name followed by the given suffix
+func layerContents(prefix string, count int, suffix string) string {
+	contents := ""
+	for i := 0; i < count; i++ {
+		key := fmt.Sprintf("%s%04d", prefix, i)
+		contents += fmt.Sprintf("export %s='%s-%s'\n", key, key, suffix)
+	}
+	return contents
+}
+
+//testMergeLayers returns the layers of a 300 key global env with a 200 key app env on top, half of
+// whose keys override global ones, and a small process env on top of that
+func testMergeLayers() ([]*Env, error) {
+	layers := []*Env{}
+	for _, layer := range []struct{ name, contents string }{
+		{"<global>", layerContents("KEY_", 300, "global") + "export ONLY_GLOBAL='global'\n"},
+		{testAppName, layerContents("KEY_", 100, "app") + layerContents("APP_", 100, "app")},
+		{testAppName, layerContents("APP_", 5, "web") + "export WEB_ONLY='web'\n"},
+	} {
+		env, err := NewFromStringWithName(layer.name, layer.contents)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, env)
+	}
+	return layers, nil
+}
+
+//eagerMerge merges the layers as mergeLayers did before it merged them lazily
+func eagerMerge(name string, layers []*Env) *Env {
+	merged := layers[0].clone()
+	for _, layer := range layers[1:] {
+		merged.Merge(layer)
+	}
+	merged.name = name
+	merged.readOnly = true
+	merged.scope = Scope{Kind: ScopeMerged}
+	return merged
+}
+
+func TestLazyMergeMatchesEager(t *testing.T) {
+	RegisterTestingT(t)
+	layers, err := testMergeLayers()
+	Expect(err).NotTo(HaveOccurred())
+	eager := eagerMerge(testAppName, layers)
+	//every check gets an env that was not put together yet
+	lazy := func() *Env {
+		env := lazyMerge(testAppName, layers)
+		Expect(env.layers).NotTo(BeNil())
+		return env
+	}
+
+	for _, k := range append(eager.Keys(), "MISSING") {
+		value, ok := lazy().Get(k)
+		expected, expectedOk := eager.Get(k)
+		Expect(value).To(Equal(expected), k)
+		Expect(ok).To(Equal(expectedOk), k)
+		Expect(lazy().GetDefault(k, "default")).To(Equal(eager.GetDefault(k, "default")), k)
+	}
+	value, key, ok := lazy().GetFirst("MISSING", "APP_0001", "KEY_0001")
+	Expect([]interface{}{value, key, ok}).To(Equal([]interface{}{"APP_0001-web", "APP_0001", true}))
+	Expect(lazy().Keys()).To(Equal(eager.Keys()))
+	Expect(lazy().OrderedKeys()).To(Equal(eager.OrderedKeys()))
+	Expect(lazy().Len()).To(Equal(eager.Len()))
+	Expect(lazy().Map()).To(Equal(eager.Map()))
+	Expect(lazy().EntriesSorted()).To(Equal(eager.EntriesSorted()))
+	Expect(lazy().Environ(false)).To(Equal(eager.Environ(false)))
+	Expect(lazy().Checksum()).To(Equal(eager.Checksum()))
+	Expect(lazy().Name()).To(Equal(eager.Name()))
+	Expect(lazy().Scope()).To(Equal(eager.Scope()))
+	for _, format := range []ExportFormat{ExportFormatExports, ExportFormatEnvfile, ExportFormatDockerArgs, ExportFormatShell, ExportFormatPretty, ExportFormatJSON, ExportFormatNul, ExportFormatNetstring, ExportFormatDockerEnvfile} {
+		Expect(lazy().Export(format)).To(Equal(eager.Export(format)), "%d", format)
+		ordered, err := lazy().ExportWithOptions(format, ExportOptions{Ordered: true})
+		Expect(err).NotTo(HaveOccurred())
+		expected, err := eager.ExportWithOptions(format, ExportOptions{Ordered: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ordered).To(Equal(expected), "%d", format)
+	}
+}
+
+func TestLazyMergeCopyOnWrite(t *testing.T) {
+	RegisterTestingT(t)
+	layers, err := testMergeLayers()
+	Expect(err).NotTo(HaveOccurred())
+	merged := lazyMerge(testAppName, layers)
+	Expect(merged.Set("KEY_0001", "changed")).To(Equal(ErrReadOnlyEnv))
+
+	//a clone stays lazy until it is changed, and changing it leaves the layers alone
+	derived := merged.clone()
+	Expect(derived.layers).NotTo(BeNil())
+	Expect(derived.Set("KEY_0001", "changed")).To(Succeed())
+	Expect(derived.Set("NEW_KEY", "new")).To(Succeed())
+	derived.Unset("WEB_ONLY")
+	Expect(derived.layers).To(BeNil())
+	Expect(derived.GetDefault("KEY_0001", "")).To(Equal("changed"))
+	Expect(derived.OrderedKeys()[derived.Len()-1]).To(Equal("NEW_KEY"))
+
+	Expect(merged.GetDefault("KEY_0001", "")).To(Equal("KEY_0001-app"))
+	Expect(merged.GetDefault("WEB_ONLY", "")).To(Equal("web"))
+	Expect(merged.Map()).NotTo(HaveKey("NEW_KEY"))
+	Expect(layers[1].GetDefault("KEY_0001", "")).To(Equal("KEY_0001-app"))
+	Expect(layers[2].Map()).To(HaveKey("WEB_ONLY"))
+	pristine, err := testMergeLayers()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(merged.Map()).To(Equal(eagerMerge(testAppName, pristine).Map()))
+}
+
+func TestResolveEffectiveEnvIsLazy(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	effective, err := ResolveEffectiveEnv(testAppName, "web", SchedulerPhaseDeploy)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(effective.Env.layers).NotTo(BeNil())
+	Expect(effective.Env.GetDefault("testKey", "")).To(Equal("TESTING"))
+	Expect(effective.Env.GetDefault("globalKey", "")).To(Equal("GLOBAL_VALUE"))
+	Expect(effective.Env.layers).NotTo(BeNil())
+	Expect(effective.Env.Keys()).To(Equal([]string{"globalKey", "testKey"}))
+	Expect(effective.Env.layers).To(BeNil())
+}
+
+//benchmarkMerge merges the layers of testMergeLayers and reads a few keys of the result, as most
+// triggers do
+func benchmarkMerge(b *testing.B, merge func(string, []*Env) *Env) {
+	layers, err := testMergeLayers()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		merged := merge(testAppName, layers)
+		merged.Get("KEY_0001")
+		merged.Get("APP_0001")
+		merged.Get("MISSING")
+	}
+}
+
+func BenchmarkMergeEager(b *testing.B) {
+	benchmarkMerge(b, eagerMerge)
+}
+
+func BenchmarkMergeLazy(b *testing.B) {
+	benchmarkMerge(b, lazyMerge)
+}
+
+//BenchmarkMergeLazyKeys is the worst case of a lazy merge, when all of its keys are needed
+func BenchmarkMergeLazyKeys(b *testing.B) {
+	layers, err := testMergeLayers()
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lazyMerge(testAppName, layers).Keys()
+	}
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	//DefaultMaxValueSize is the default maximum size in bytes of a single config value
+	DefaultMaxValueSize = 32 * 1024
+	//DefaultMaxEnvSize is the default maximum size in bytes of the environment passed to a container
+	DefaultMaxEnvSize = 512 * 1024
+)
+
+//Limits are the size limits enforced when config vars are set. A limit of 0 disables the check
+type Limits struct {
+	MaxValueSize int
+	MaxEnvSize   int
+}
+
+//GetLimits returns the size limits for an app from the max-value-size and max-env-size properties,
+// falling back to the properties set with --global and then to the defaults
+func GetLimits(appName string) Limits {
+	return Limits{
+		MaxValueSize: getSizeProperty(appName, "max-value-size", DefaultMaxValueSize),
+		MaxEnvSize:   getSizeProperty(appName, "max-env-size", DefaultMaxEnvSize),
+	}
+}
+
+//CheckValue returns an error if the value of key exceeds the per-value limit
+func (l Limits) CheckValue(key string, value string) error {
+	if l.MaxValueSize > 0 && len(value) > l.MaxValueSize {
+		return &ValidationError{Message: fmt.Sprintf("Value of %s is %d bytes, exceeding the maximum value size of %d bytes", key, len(value), l.MaxValueSize)}
+	}
+	return nil
+}
+
+//CheckEnv returns an error if an environment growing from before to after bytes exceeds the total limit.
+// An environment that shrinks is always accepted so that one which is already too large can be fixed
+func (l Limits) CheckEnv(name string, before int, after int) error {
+	if l.MaxEnvSize > 0 && after > l.MaxEnvSize && after > before {
+		return &ValidationError{Message: fmt.Sprintf("Environment of %s would be %d bytes, exceeding the maximum env size of %d bytes", name, after, l.MaxEnvSize)}
+	}
+	return nil
+}
+
+//Size returns the number of bytes this Env occupies in a process environment
+func (e *Env) Size() (size int) {
+	for k, v := range e.values() {
+		size += entrySize(k, v)
+	}
+	return
+}
+
+//mergedSize returns the size of app merged on top of global without building the merged Env
+func mergedSize(global *Env, app *Env) int {
+	size := app.Size()
+	for k, v := range global.values() {
+		if _, ok := app.values()[k]; !ok {
+			size += entrySize(k, v)
+		}
+	}
+	return size
+}
+
+//containerEnvSize returns the size of env as passed to a container, merged on top of global if given
+func containerEnvSize(global *Env, env *Env) int {
+	if global == nil {
+		return env.Size()
+	}
+	return mergedSize(global, env)
+}
+
+//entrySize is the length of KEY=VALUE plus its terminating NUL
+func entrySize(key string, value string) int {
+	return len(key) + len(value) + 2
+}
+
+//getSizeProperty reads a byte size property for an app, using the default if it is unset or invalid
+func getSizeProperty(appName string, property string, defaultValue int) int {
+	if size, err := strconv.Atoi(getConfigProperty(appName, property)); err == nil && size >= 0 {
+		return size
+	}
+	return defaultValue
+}
+
+//validateSizeProperty checks that a size property value is a non-negative number of bytes
+func validateSizeProperty(property string, value string) error {
+	if value == "" {
+		return nil
+	}
+	if size, err := strconv.Atoi(value); err != nil || size < 0 {
+		return fmt.Errorf("%s must be a non-negative number of bytes", property)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+//envLine is a single assignment read from an ENV file
+type envLine struct {
+	number int
+	key    string
+	value  string
+	err    error
+}
+
+//scanEnvLines parses every line of an ENV file on its own, the same way the loader does,
+// so that findings can point at line numbers and at keys the loader would drop or overwrite
+func scanEnvLines(contents string) []envLine {
+	lines := []envLine{}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		if trimmed := strings.Trim(text, " \n\t"); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		line := envLine{number: number}
+		envMap, err := godotenv.Unmarshal(text)
+		if err != nil {
+			line.err = err
+		}
+		for k, v := range envMap {
+			line.key, line.value = k, v
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+//CheckParseErrors reports lines of an ENV file that cannot be parsed
+func CheckParseErrors(contents string) []Finding {
+	findings := []Finding{}
+	for _, line := range scanEnvLines(contents) {
+		if line.err != nil {
+			findings = append(findings, Finding{
+				Check:    "parse-error",
+				Severity: SeverityError,
+				Line:     line.number,
+				Message:  fmt.Sprintf("Line %d cannot be parsed: %s", line.number, line.err.Error()),
+			})
+		}
+	}
+	return findings
+}
+
+//CheckDuplicateKeys reports keys that are assigned more than once in an ENV file.
+// Only the last assignment takes effect
+func CheckDuplicateKeys(contents string) []Finding {
+	findings := []Finding{}
+	first := make(map[string]int)
+	for _, line := range scanEnvLines(contents) {
+		if line.err != nil {
+			continue
+		}
+		if number, ok := first[line.key]; ok {
+			findings = append(findings, Finding{
+				Check:    "duplicate-key",
+				Severity: SeverityError,
+				Key:      line.key,
+				Line:     line.number,
+				Message:  fmt.Sprintf("Key %s is set on line %d and again on line %d", line.key, number, line.number),
+			})
+			continue
+		}
+		first[line.key] = line.number
+	}
+	return findings
+}
+
+//CheckLineEndings reports an ENV file with \r\n line endings, alone or mixed with \n ones, and one
+// whose last line does not end with a newline, which shell loops reading the file with read drop.
+// Both are read as usual, and Write leaves the file with \n line endings and a final newline
+func CheckLineEndings(contents string) []Finding {
+	findings := []Finding{}
+	if i := strings.Index(contents, "\r\n"); i >= 0 {
+		message := "The file has \\r\\n line endings, they are written back as \\n"
+		if strings.Count(contents, "\n") > strings.Count(contents, "\r\n") {
+			message = "The file mixes \\r\\n and \\n line endings, they are written back as \\n"
+		}
+		findings = append(findings, Finding{
+			Check:    "line-endings",
+			Severity: SeverityWarning,
+			Line:     strings.Count(contents[:i], "\n") + 1,
+			Message:  message,
+		})
+	}
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		line := strings.Count(contents, "\n") + 1
+		findings = append(findings, Finding{
+			Check:    "final-newline",
+			Severity: SeverityWarning,
+			Line:     line,
+			Message:  fmt.Sprintf("Line %d does not end with a newline, scripts reading the file line by line may drop it", line),
+		})
+	}
+	return findings
+}
+
+//LintContents runs every check against the contents of an ENV file. If global is not nil,
+// the env size is checked as merged on top of it
+func LintContents(name string, contents string, global *Env, limits Limits) []Finding {
+	envMap := make(map[string]string)
+	keyLines := make(map[string]int)
+	for _, line := range scanEnvLines(contents) {
+		if line.err == nil {
+			envMap[line.key] = line.value
+			keyLines[line.key] = line.number
+		}
+	}
+	env := &Env{name: name, vars: envMap}
+
+	findings := CheckParseErrors(contents)
+	findings = append(findings, CheckDuplicateKeys(contents)...)
+	findings = append(findings, CheckLineEndings(contents)...)
+	for _, check := range []func(*Env) []Finding{CheckInvalidKeys, CheckKeyCollisions, CheckValueWhitespace, CheckValueQuotes, CheckPlaceholders, CheckInvalidUTF8} {
+		findings = append(findings, check(env)...)
+	}
+	findings = append(findings, CheckSizeLimits(env, global, limits)...)
+
+	for i := range findings {
+		if findings[i].Line == 0 && findings[i].Key != "" {
+			findings[i].Line = keyLines[findings[i].Key]
+		}
+	}
+	return findings
+}
+
+//Lint checks the ENV file of an app, or of the global environment if appName is empty or --global
+func Lint(appName string) ([]Finding, error) {
+	name, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	contents, _, err := readEnvFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var global *Env
+	if appName != "" && appName != "--global" {
+		global, _ = LoadGlobalCached()
+	}
+	findings := LintContents(name, string(contents), global, GetLimits(appName))
+	findings = append(findings, lintReservedKeys(appName, string(contents))...)
+	if policy, _ := ParseInvalidUTF8Policy(getConfigProperty(appName, "invalid-utf8")); policy == InvalidUTF8Error {
+		for i := range findings {
+			if findings[i].Check == "invalid-utf8" {
+				findings[i].Severity = SeverityError
+			}
+		}
+	}
+	for check, property := range map[string]string{"key-case-collision": "strict-key-case", "reserved-runtime-key": "strict-reserved-keys"} {
+		if !getBoolProperty(appName, property) {
+			continue
+		}
+		for i := range findings {
+			if findings[i].Check == check {
+				findings[i].Severity = SeverityError
+			}
+		}
+	}
+	return findings, nil
+}
+
+//lintReservedKeys runs CheckReservedKeys against the contents of an ENV file, with the keys that
+// plugins set at run time for the app
+func lintReservedKeys(appName string, contents string) []Finding {
+	envMap := make(map[string]string)
+	keyLines := make(map[string]int)
+	for _, line := range scanEnvLines(contents) {
+		if line.err == nil {
+			envMap[line.key] = line.value
+			keyLines[line.key] = line.number
+		}
+	}
+	if len(envMap) == 0 {
+		return []Finding{}
+	}
+	if appName == "--global" {
+		appName = ""
+	}
+	findings := CheckReservedKeys(&Env{vars: envMap}, reservedRuntimeKeys(appName))
+	for i := range findings {
+		findings[i].Line = keyLines[findings[i].Key]
+	}
+	return findings
+}
@@ -0,0 +1,97 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const lintContents = `export GOOD='value'
+export DUP='first'
+# a comment
+export DUP='second'
+export dup='case'
+export -bad-key='x'
+export SPACED='trailing '
+export QUOTED='"wrapped"'
+export TEMPLATE='pg://${DB}/app'
+export MUSTACHE='{{ secret }}'
+export BIG='0123456789012345678901'
+this line is broken
+`
+
+func TestLintContents(t *testing.T) {
+	RegisterTestingT(t)
+	findings := LintContents("lint", lintContents, nil, Limits{MaxValueSize: 20})
+
+	summary := []string{}
+	for _, f := range findings {
+		summary = append(summary, string(f.Severity)+" "+f.Check+" "+f.Key)
+	}
+	Expect(summary).To(Equal([]string{
+		"error parse-error ",
+		"error duplicate-key DUP",
+		"error invalid-key -bad-key",
+		"warning key-case-collision DUP",
+		"warning value-whitespace SPACED",
+		"warning value-quotes QUOTED",
+		"warning value-placeholder MUSTACHE",
+		"warning value-placeholder TEMPLATE",
+		"error value-size BIG",
+	}))
+
+	Expect(findings[0].Line).To(Equal(12))
+	Expect(findings[1].Line).To(Equal(4))
+	Expect(findings[1].Message).To(Equal("Key DUP is set on line 2 and again on line 4"))
+	Expect(findings[3].Message).To(Equal("Keys DUP and dup differ only by case"))
+	Expect(findings[7].Message).To(Equal("Value of TEMPLATE contains the unresolved placeholder ${DB}"))
+	Expect(findings[8].Line).To(Equal(11))
+}
+
+func TestLintClean(t *testing.T) {
+	RegisterTestingT(t)
+	findings := LintContents("lint", "export A='1'\nexport B=\"two words\"\n", nil, GetLimits(""))
+	Expect(findings).To(BeEmpty())
+
+	out, err := json.Marshal(findings)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(out)).To(Equal("[]"))
+
+	out, err = json.Marshal(Finding{Check: "env-size", Severity: SeverityError, Message: "too big"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(out)).To(Equal(`{"check":"env-size","severity":"error","message":"too big"}`))
+}
+
+func TestLintApp(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	findings, err := Lint(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(findings).To(BeEmpty())
+
+	_, err = Lint(testAppName + "-nonexistent")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestCheckLineEndings(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(CheckLineEndings("")).To(BeEmpty())
+	Expect(CheckLineEndings("export A='1'\nexport B='2'\n")).To(BeEmpty())
+
+	Expect(CheckLineEndings("A=1\r\nB=2\r\n")).To(Equal([]Finding{
+		{Check: "line-endings", Severity: SeverityWarning, Line: 1, Message: "The file has \\r\\n line endings, they are written back as \\n"},
+	}))
+	Expect(CheckLineEndings("A=1\nB=2\r\nC=3")).To(Equal([]Finding{
+		{Check: "line-endings", Severity: SeverityWarning, Line: 2, Message: "The file mixes \\r\\n and \\n line endings, they are written back as \\n"},
+		{Check: "final-newline", Severity: SeverityWarning, Line: 3, Message: "Line 3 does not end with a newline, scripts reading the file line by line may drop it"},
+	}))
+
+	//both are found by config:lint, which only fails on them with --strict
+	findings := LintContents("lint", "A=1\nB=2", nil, GetLimits(""))
+	Expect(findings).To(HaveLen(1))
+	Expect(findings[0].Check).To(Equal("final-newline"))
+	Expect(findings[0].Line).To(Equal(2))
+}
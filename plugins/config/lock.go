@@ -0,0 +1,236 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//lockWaitReportThreshold is how long a command may wait for the lock of an ENV file before the
+// wait is shown in its output, to tell a slow command apart from one blocked by another
+const lockWaitReportThreshold = time.Second
+
+//withLockedEnv loads the app or global env fresh from disk and calls fn while holding an
+// exclusive lock on its ENV file, so that concurrent read-modify-write cycles can't lose updates.
+// The lock is released when fn returns, so fn must not fire triggers that may mutate config
+func withLockedEnv(appName string, fn func(env *Env) error) error {
+	return withLockedEnvs([]string{appName}, func(envs map[string]*Env) error {
+		return fn(envs[globalTarget(appName)])
+	})
+}
+
+//withLockedEnvs is withLockedEnv for several app or global envs, passed to fn keyed by app name
+// with the global env under the empty name. The locks are taken in lockOrder, so that commands
+// changing overlapping envs wait for each other rather than deadlock
+func withLockedEnvs(targets []string, fn func(envs map[string]*Env) error) error {
+	targets = lockOrder(targets)
+	names := make(map[string]string, len(targets))
+	filenames := make(map[string]string, len(targets))
+	lockedBy := make(map[string]string, len(targets))
+	for _, target := range targets {
+		name, filename, err := resolveAppOrGlobalFile(target)
+		if err != nil {
+			return err
+		}
+		resolved, err := resolveSymlinkTarget(filename)
+		if err != nil {
+			return err
+		}
+		//a second flock on the same file from this process would wait for the first forever
+		if other, ok := lockedBy[resolved]; ok {
+			return fmt.Errorf("The envs of %s and %s share the ENV file %s", targetName(other), targetName(target), resolved)
+		}
+		lockedBy[resolved] = target
+		unlock, err := lockEnvFile(filename)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		names[target], filenames[target] = name, filename
+	}
+
+	envs := make(map[string]*Env, len(targets))
+	for _, target := range targets {
+		env, err := loadFromFile(names[target], filenames[target])
+		if err != nil {
+			return err
+		}
+		if getBoolProperty(target, "preserve-order") {
+			env.PreserveOrder()
+		}
+		env.SetCompressed(wantsCompression(target))
+		env.SetFileFormat(envFileFormat(target))
+		env.public = true
+		env.scope = scopeFor(target)
+		envs[target] = env
+	}
+	return fn(envs)
+}
+
+//lockOrder returns the targets without duplicates in the order their locks are taken: the global
+// env first, as commands changing it may go on to change apps, followed by the apps sorted by name
+func lockOrder(targets []string) []string {
+	seen := make(map[string]bool, len(targets))
+	ordered := make([]string, 0, len(targets))
+	for _, target := range targets {
+		target = globalTarget(target)
+		if !seen[target] {
+			seen[target] = true
+			ordered = append(ordered, target)
+		}
+	}
+	//the global env is the empty name, which sorts first
+	sort.Strings(ordered)
+	return ordered
+}
+
+//globalTarget returns the name the global env is known by internally for either of the names it
+// is given by callers, and any other name unchanged
+func globalTarget(target string) string {
+	if target == "--global" {
+		return ""
+	}
+	return target
+}
+
+func targetName(target string) string {
+	if target == "" {
+		return "--global"
+	}
+	return target
+}
+
+//WithLockedTargets calls fn with the envs of several apps, keyed by app name, while holding the
+// locks of all of them, and writes back whatever fn changed once it returns. The global env is
+// included by passing an empty name or --global, under which it is then keyed. Locks are always
+// taken with the global env first and the apps sorted by name, so concurrent calls for
+// overlapping targets wait for each other rather than deadlock.
+//
+// Every changed env is checked the same way as by Update before any of them is written, and the
+// post-config-update trigger is fired for each once all locks are released. Apps are not restarted.
+// Nothing is written if fn returns an error or any of the changes is invalid
+func WithLockedTargets(targets []string, fn func(envs map[string]*Env) error) error {
+	ordered := lockOrder(targets)
+	diffs := make(map[string]EnvDiff, len(ordered))
+	err := withLockedEnvs(ordered, func(envs map[string]*Env) error {
+		before := make(map[string]*Env, len(envs))
+		given := make(map[string]*Env, len(targets))
+		for target, env := range envs {
+			before[target] = env.clone()
+		}
+		for _, target := range targets {
+			given[target] = envs[globalTarget(target)]
+		}
+		if err := fn(given); err != nil {
+			return err
+		}
+		for _, target := range ordered {
+			diff, err := checkUpdate(target, before[target], envs[target])
+			if err != nil {
+				return err
+			}
+			diffs[target] = diff
+		}
+		for _, target := range ordered {
+			if diffs[target].Empty() {
+				continue
+			}
+			if err := writeUpdate(target, envs[target], diffs[target], RestartPolicyNever); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, target := range ordered {
+		if !diffs[target].Empty() {
+			fireUpdateTriggers(target, diffs[target])
+		}
+	}
+	return nil
+}
+
+//LockError is returned when the lock of an ENV file cannot be taken
+type LockError struct {
+	Path string
+	Err  error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("Unable to lock %s: %s", e.Path, e.Err.Error())
+}
+
+//lockEnvFile takes an exclusive flock on a lock file next to the (symlink-resolved) ENV file.
+// The ENV file itself is replaced on every write, so it cannot carry the lock. A wait for another
+// process to release the lock is shown in the output if it is long, or always with DOKKU_TRACE set
+func lockEnvFile(filename string) (unlock func(), err error) {
+	target, err := resolveSymlinkTarget(filename)
+	if err != nil {
+		return nil, err
+	}
+	lockfile := lockFilePath(target)
+	file, err := os.OpenFile(lockfile, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		if notWritable, ok := notWritableError(lockfile, err).(*ErrEnvNotWritable); ok {
+			return nil, notWritable
+		}
+		return nil, &LockError{Path: lockfile, Err: err}
+	}
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err == syscall.EWOULDBLOCK {
+		start := time.Now()
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+		reportLockWait(target, time.Since(start))
+	}
+	if err != nil {
+		file.Close()
+		return nil, &LockError{Path: lockfile, Err: err}
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+//reportLockWait shows how long was waited for the lock of an ENV file, see lockEnvFile
+func reportLockWait(filename string, wait time.Duration) {
+	if wait < lockWaitReportThreshold && os.Getenv("DOKKU_TRACE") == "" {
+		return
+	}
+	common.LogVerboseQuiet(fmt.Sprintf("Waited %s for the lock of %s, held by another config change", wait.Round(time.Millisecond), filename))
+}
+
+//envFileLocked reports whether another process currently holds the lock of an ENV file
+func envFileLocked(filename string) (bool, error) {
+	target, err := resolveSymlinkTarget(filename)
+	if err != nil {
+		return false, err
+	}
+	lockfile := lockFilePath(target)
+	file, err := os.OpenFile(lockfile, os.O_RDWR, 0600)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("Unable to open lock file %s: %s", lockfile, err.Error())
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err == syscall.EWOULDBLOCK {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Unable to check lock %s: %s", lockfile, err.Error())
+	}
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	return false, nil
+}
+
+func lockFilePath(target string) string {
+	return filepath.Join(filepath.Dir(target), fmt.Sprintf(".%s.lock", filepath.Base(target)))
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+//setupStressRoot points DOKKU_ROOT at a new directory holding the given apps, with empty envs
+func setupStressRoot(apps ...string) (teardown func()) {
+	root, err := ioutil.TempDir("", "dokku-config-lock")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(root, "ENV"), []byte(""), 0600)).To(Succeed())
+	for _, app := range apps {
+		Expect(os.MkdirAll(filepath.Join(root, app), 0755)).To(Succeed())
+	}
+	Expect(os.Setenv("DOKKU_ROOT", root)).To(Succeed())
+	Expect(os.Setenv("DOKKU_QUIET_OUTPUT", "1")).To(Succeed())
+	return func() {
+		os.Unsetenv("DOKKU_QUIET_OUTPUT")
+		os.Setenv("DOKKU_ROOT", dokkuRoot)
+		os.RemoveAll(root)
+	}
+}
+
+//increment adds one to the numeric value of key, starting from zero
+func increment(env *Env, key string) error {
+	count, _ := strconv.Atoi(env.GetDefault(key, "0"))
+	return env.Set(key, strconv.Itoa(count+1))
+}
+
+func TestLockOrder(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(lockOrder([]string{"zebra", "--global", "app", "zebra", ""})).To(Equal([]string{"", "app", "zebra"}))
+	Expect(lockOrder([]string{"app"})).To(Equal([]string{"app"}))
+}
+
+func TestWithLockedTargets(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupStressRoot("app-a", "app-b")()
+
+	Expect(WithLockedTargets([]string{"app-b", "--global", "app-a"}, func(envs map[string]*Env) error {
+		Expect(envs).To(HaveLen(3))
+		Expect(envs).To(HaveKey("--global"))
+		if err := envs["--global"].Set("SHARED", "global"); err != nil {
+			return err
+		}
+		return envs["app-a"].Set("COPIED", "from-b")
+	})).To(Succeed())
+	expectValue("", "SHARED", "global")
+	expectValue("app-a", "COPIED", "from-b")
+	env, err := LoadAppEnv("app-b")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(0))
+
+	//nothing is written if fn fails or any of the changes is invalid
+	Expect(WithLockedTargets([]string{"app-a", "app-b"}, func(envs map[string]*Env) error {
+		envs["app-a"].Set("LOST", "1")
+		return errors.New("failed")
+	})).To(MatchError("failed"))
+	Expect(WithLockedTargets([]string{"app-a", "app-b"}, func(envs map[string]*Env) error {
+		envs["app-a"].Set("LOST", "1")
+		envs["app-b"].values()["-bad"] = "1"
+		return nil
+	})).To(HaveOccurred())
+	expectNoValue("app-a", "LOST")
+
+	_, err = LoadAppEnv("missing-app")
+	Expect(err).To(HaveOccurred())
+	Expect(WithLockedTargets([]string{"app-a", "missing-app"}, func(envs map[string]*Env) error {
+		return nil
+	})).To(HaveOccurred())
+
+	//apps sharing an ENV file through a symlink cannot be locked together
+	Expect(os.Symlink(filepath.Join(os.Getenv("DOKKU_ROOT"), "app-a", "ENV"), filepath.Join(os.Getenv("DOKKU_ROOT"), "app-b", "ENV"))).To(Succeed())
+	err = WithLockedTargets([]string{"app-a", "app-b"}, func(envs map[string]*Env) error {
+		return nil
+	})
+	Expect(err).To(MatchError(ContainSubstring("The envs of app-a and app-b share the ENV file")))
+}
+
+func TestConcurrentGlobalAndAppUpdates(t *testing.T) {
+	RegisterTestingT(t)
+	apps := []string{"stress-a", "stress-b", "stress-c"}
+	defer setupStressRoot(apps...)()
+
+	const workers = 48
+	errs := make(chan error, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			app := apps[i%len(apps)]
+			other := apps[(i+1)%len(apps)]
+			key := fmt.Sprintf("WORKER_%d", i)
+			var err error
+			switch i % 4 {
+			case 0:
+				_, err = Update("", RestartPolicyNever, func(env *Env) error {
+					env.Set(key, "1")
+					return increment(env, "COUNT")
+				})
+			case 1:
+				_, err = Update(app, RestartPolicyNever, func(env *Env) error {
+					env.Set(key, "1")
+					return increment(env, "COUNT")
+				})
+			default:
+				//in either order, so that a missing lock order would deadlock
+				targets := []string{app, "--global", other}
+				if i%4 == 3 {
+					targets = []string{other, app, ""}
+				}
+				err = WithLockedTargets(targets, func(envs map[string]*Env) error {
+					for _, env := range envs {
+						if err := increment(env, "COUNT"); err != nil {
+							return err
+						}
+					}
+					return envs[app].Set(key, "1")
+				})
+			}
+			errs <- err
+		}(i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Minute):
+		t.Fatal("concurrent updates did not finish, the envs are likely deadlocked")
+	}
+	close(errs)
+	for err := range errs {
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	//every worker incremented the global env and the envs it locked exactly once
+	expected := map[string]int{"": 0}
+	for i := 0; i < workers; i++ {
+		app, other := apps[i%len(apps)], apps[(i+1)%len(apps)]
+		switch i % 4 {
+		case 0:
+			expected[""]++
+		case 1:
+			expected[app]++
+		default:
+			expected[""]++
+			expected[app]++
+			expected[other]++
+		}
+	}
+	for target, count := range expected {
+		expectValue(target, "COUNT", strconv.Itoa(count))
+	}
+	for i := 0; i < workers; i++ {
+		target := apps[i%len(apps)]
+		if i%4 == 0 {
+			target = ""
+		}
+		expectValue(target, fmt.Sprintf("WORKER_%d", i), "1")
+	}
+}
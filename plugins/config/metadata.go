@@ -0,0 +1,248 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"time"
+)
+
+//Tags with a meaning to dokku
+const (
+	//TagSecret marks a key whose value is a secret
+	TagSecret = "secret"
+	//TagNoExport marks a key that dokku and its plugins read but that is kept out of the env of
+	// the containers of an app
+	TagNoExport = "no-export"
+)
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+//KeyMetadata describes a key. It never holds the value of the key
+type KeyMetadata struct {
+	Description string         `json:"description,omitempty"`
+	Tags        []string       `json:"tags,omitempty"`
+	ExpiresAt   *time.Time     `json:"expires_at,omitempty"`
+	Provenance  *KeyProvenance `json:"provenance,omitempty"`
+	//Provider computes the value of a key that is not set, see SetProvider
+	Provider string `json:"provider,omitempty"`
+}
+
+//HasTag reports whether the key is tagged with the given tag
+func (m KeyMetadata) HasTag(tag string) bool {
+	for _, t := range m.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+//Expired reports whether the key has an expiry that is not after now
+func (m KeyMetadata) Expired(now time.Time) bool {
+	return m.ExpiresAt != nil && !m.ExpiresAt.After(now)
+}
+
+//isEmpty reports whether there is anything worth storing
+func (m KeyMetadata) isEmpty() bool {
+	return m.Description == "" && len(m.Tags) == 0 && m.ExpiresAt == nil && m.Provenance == nil && m.Provider == ""
+}
+
+//Metadata returns the metadata of the keys in this environment, read from the ENV.meta.json
+// sidecar next to its file on first use. Envs not bound to a file have no metadata
+func (e *Env) Metadata() (map[string]KeyMetadata, error) {
+	if e.meta != nil {
+		return e.meta, nil
+	}
+	meta := map[string]KeyMetadata{}
+	if e.filename != "" {
+		var err error
+		if meta, err = readMetadataFile(metadataFile(e.filename)); err != nil {
+			return nil, err
+		}
+	}
+	e.meta = meta
+	return meta, nil
+}
+
+//KeyMetadata returns the metadata of a single key, which is empty if there is none
+func (e *Env) KeyMetadata(key string) KeyMetadata {
+	meta, err := e.Metadata()
+	if err != nil {
+		return KeyMetadata{}
+	}
+	return meta[key]
+}
+
+//Annotate sets the description of a key if description is not nil, adds and removes the
+// given tags, and writes the sidecar of the app or global env. The key must be set
+func Annotate(appName string, key string, description *string, addTags []string, removeTags []string) error {
+	for _, tags := range [][]string{addTags, removeTags} {
+		for _, tag := range tags {
+			if err := validateTag(tag); err != nil {
+				return err
+			}
+		}
+	}
+	return withLockedEnv(appName, func(env *Env) error {
+		if _, ok := env.Get(key); !ok {
+			return fmt.Errorf("Key %s is not set", key)
+		}
+		meta, err := env.Metadata()
+		if err != nil {
+			return err
+		}
+
+		m := meta[key]
+		if description != nil {
+			m.Description = *description
+		}
+		tags := map[string]bool{}
+		for _, t := range m.Tags {
+			tags[t] = true
+		}
+		for _, t := range addTags {
+			tags[t] = true
+		}
+		for _, t := range removeTags {
+			delete(tags, t)
+		}
+		m.Tags = make([]string, 0, len(tags))
+		for t := range tags {
+			m.Tags = append(m.Tags, t)
+		}
+		sort.Strings(m.Tags)
+
+		if m.isEmpty() {
+			delete(meta, key)
+		} else {
+			meta[key] = m
+		}
+		if err := writeMetadataFile(metadataFile(env.filename), meta); err != nil {
+			return err
+		}
+		//tagging a key secret changes what is redacted
+		invalidateRedactionPatterns(appName)
+		return nil
+	})
+}
+
+//SetExpiry sets the time after which the given keys are removed by ExpireKeys, replacing any
+// previous expiry. A nil expiresAt removes the expiry. The keys must be set
+func SetExpiry(appName string, keys []string, expiresAt *time.Time) error {
+	return withLockedEnv(appName, func(env *Env) error {
+		meta, err := env.Metadata()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if _, ok := env.Get(k); !ok {
+				return fmt.Errorf("Key %s is not set", k)
+			}
+			m := meta[k]
+			m.ExpiresAt = nil
+			if expiresAt != nil {
+				utc := expiresAt.UTC().Truncate(time.Second)
+				m.ExpiresAt = &utc
+			}
+			if m.isEmpty() {
+				delete(meta, k)
+			} else {
+				meta[k] = m
+			}
+		}
+		return writeMetadataFile(metadataFile(env.filename), meta)
+	})
+}
+
+//ExpireKeys unsets the keys of an app, or of the global env if appName is empty, whose expiry is
+// not after now. They are removed in a single Update, so the usual triggers fire and the app is
+// restarted according to policy. The expired keys are returned sorted
+func ExpireKeys(appName string, now time.Time, policy RestartPolicy) ([]string, error) {
+	if appName == "--global" {
+		appName = ""
+	}
+	diff, err := Update(appName, policy, func(env *Env) error {
+		meta, err := env.Metadata()
+		if err != nil {
+			return err
+		}
+		for k, m := range meta {
+			if m.Expired(now) {
+				if err := env.Unset(k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff.Removed, nil
+}
+
+//pruneMetadata drops the metadata of keys that are no longer set in env from its sidecar. Keys
+// given a provider are never set, and keep theirs
+func pruneMetadata(env *Env) error {
+	meta, err := env.Metadata()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for k, m := range meta {
+		if _, ok := env.Get(k); !ok && m.Provider == "" {
+			delete(meta, k)
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeMetadataFile(metadataFile(env.filename), meta)
+}
+
+func validateTag(tag string) error {
+	if !tagPattern.MatchString(tag) {
+		return &ValidationError{Message: fmt.Sprintf("Invalid tag: '%s'", tag)}
+	}
+	return nil
+}
+
+//metadataFile returns the path of the sidecar holding the metadata for an ENV file
+func metadataFile(envFile string) string {
+	return envFile + ".meta.json"
+}
+
+func readMetadataFile(filename string) (map[string]KeyMetadata, error) {
+	meta := map[string]KeyMetadata{}
+	contents, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(contents, &meta); err != nil {
+		return nil, fmt.Errorf("Unable to parse %s: %s", filename, err.Error())
+	}
+	return meta, nil
+}
+
+//writeMetadataFile atomically replaces the sidecar, removing it once no key has metadata
+func writeMetadataFile(filename string, meta map[string]KeyMetadata) error {
+	if len(meta) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	contents, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(contents, '\n'), 0600)
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestAnnotate(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	metaFile := testAppDir + "/ENV.meta.json"
+
+	description := "rotated quarterly"
+	Expect(Annotate(testAppName, "testKey", &description, []string{TagSecret, "billing"}, nil)).To(Succeed())
+	Expect(Annotate(testAppName, "unsetKey", &description, nil, nil)).To(MatchError("Key unsetKey is not set"))
+	Expect(Annotate(testAppName, "testKey", nil, []string{"not a tag"}, nil)).To(MatchError("Invalid tag: 'not a tag'"))
+
+	contents, err := ioutil.ReadFile(metaFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("TESTING"))
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.KeyMetadata("testKey")).To(Equal(KeyMetadata{Description: "rotated quarterly", Tags: []string{"billing", "secret"}}))
+	Expect(env.KeyMetadata("testKey").HasTag(TagSecret)).To(BeTrue())
+	Expect(env.Export(ExportFormatJSON)).To(Equal(`{"testKey":{"value":"TESTING","description":"rotated quarterly","tags":["billing","secret"]}}`))
+
+	//updating keeps what is not mentioned
+	Expect(Annotate(testAppName, "testKey", nil, nil, []string{"billing"})).To(Succeed())
+	env, _ = LoadAppEnv(testAppName)
+	Expect(env.KeyMetadata("testKey")).To(Equal(KeyMetadata{Description: "rotated quarterly", Tags: []string{"secret"}}))
+
+	//unsetting the key removes its metadata, and the sidecar once it is empty
+	Expect(UnsetMany(testAppName, []string{"testKey"}, false)).To(Succeed())
+	_, err = os.Stat(metaFile)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestMetadataUnboundEnv(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("A", "1"))
+	meta, err := e.Metadata()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(meta).To(BeEmpty())
+	Expect(e.Export(ExportFormatJSON)).To(Equal(`{"A":{"value":"1"}}`))
+}
+
+func TestAuditSecretsTagged(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	Expect(SetMany(testAppName, pairs("SIGNING_SEED", "wJalrXUtnFEMI/K7MDENG/bPxRfiCYEXAMPLEKEY"), false)).To(Succeed())
+	findings, err := AuditAppSecrets(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(findings).To(HaveLen(1))
+
+	Expect(Annotate(testAppName, "SIGNING_SEED", nil, []string{TagSecret}, nil)).To(Succeed())
+	findings, err = AuditAppSecrets(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(findings).To(BeEmpty())
+}
+
+func TestExpireKeys(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, map[string]string{"TEMP_TOKEN": "abc", "SIGNED_URL": "https://"}, false)).To(Succeed())
+
+	now := time.Date(2026, 10, 14, 12, 0, 0, 0, time.UTC)
+	soon, later := now.Add(time.Hour), now.Add(72*time.Hour)
+	Expect(SetExpiry(testAppName, []string{"TEMP_TOKEN"}, &soon)).To(Succeed())
+	Expect(SetExpiry(testAppName, []string{"SIGNED_URL"}, &soon)).To(Succeed())
+	Expect(SetExpiry(testAppName, []string{"MISSING"}, &soon)).To(MatchError("Key MISSING is not set"))
+
+	//setting a new expiry extends it, and nil removes it
+	Expect(SetExpiry(testAppName, []string{"SIGNED_URL"}, &later)).To(Succeed())
+	description := "kept"
+	Expect(Annotate(testAppName, "testKey", &description, nil, nil)).To(Succeed())
+	Expect(SetExpiry(testAppName, []string{"testKey"}, &soon)).To(Succeed())
+	Expect(SetExpiry(testAppName, []string{"testKey"}, nil)).To(Succeed())
+	env, _ := LoadAppEnv(testAppName)
+	Expect(env.KeyMetadata("testKey")).To(Equal(KeyMetadata{Description: "kept"}))
+	Expect(env.KeyMetadata("TEMP_TOKEN").Expired(soon)).To(BeTrue())
+	Expect(env.KeyMetadata("TEMP_TOKEN").Expired(now)).To(BeFalse())
+
+	expired, err := ExpireKeys(testAppName, now, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(expired).To(BeEmpty())
+
+	expired, err = ExpireKeys(testAppName, soon, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(expired).To(Equal([]string{"TEMP_TOKEN"}))
+	expectNoValue(testAppName, "TEMP_TOKEN")
+	expectValue(testAppName, "SIGNED_URL", "https://")
+	expectValue(testAppName, "testKey", "TESTING")
+
+	expired, err = ExpireKeys(testAppName, later.Add(time.Second), RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(expired).To(Equal([]string{"SIGNED_URL"}))
+	env, _ = LoadAppEnv(testAppName)
+	meta, _ := env.Metadata()
+	Expect(meta).To(HaveLen(1))
+}
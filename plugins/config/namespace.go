@@ -0,0 +1,173 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+//EnvView gives access to the keys of an Env that start with a prefix, as if the prefix was not
+// part of their names. It is how plugins linking several instances of a service to an app, such
+// as datastores, keep the keys of each instance apart
+type EnvView struct {
+	env    *Env
+	prefix string
+}
+
+//KeyExistsError is returned when a key would be replaced that must not be
+type KeyExistsError struct {
+	Key string
+}
+
+func (e *KeyExistsError) Error() string {
+	return fmt.Sprintf("Key %s is already set", e.Key)
+}
+
+//WithPrefix returns a view of the keys of the Env starting with prefix. Changes made through the
+// view are made to the Env, which still has to be written
+func (e *Env) WithPrefix(prefix string) *EnvView {
+	return &EnvView{env: e, prefix: prefix}
+}
+
+//Prefix returns the prefix of the keys of the view
+func (v *EnvView) Prefix() string {
+	return v.prefix
+}
+
+//Get the value of prefix+key
+func (v *EnvView) Get(key string) (value string, ok bool) {
+	return v.env.Get(v.prefix + key)
+}
+
+//GetDefault the value of prefix+key or a default if it doesn't exist
+func (v *EnvView) GetDefault(key string, defaultValue string) string {
+	return v.env.GetDefault(v.prefix+key, defaultValue)
+}
+
+//Set prefix+key to value, which must be a valid key name
+func (v *EnvView) Set(key string, value string) error {
+	if err := validatePrefixedKey(v.prefix, key); err != nil {
+		return err
+	}
+	return v.env.Set(v.prefix+key, value)
+}
+
+//validatePrefixedKey checks that key is not empty and that prefix+key is a valid key name
+func validatePrefixedKey(prefix string, key string) error {
+	if key == "" {
+		return &InvalidKeyError{Key: prefix}
+	}
+	return validateKey(prefix + key)
+}
+
+//Unset prefix+key. Unsetting a key of a read-only Env fails with ErrReadOnlyEnv
+func (v *EnvView) Unset(key string) error {
+	return v.env.Unset(v.prefix + key)
+}
+
+//Keys returns the keys of the Env starting with the prefix, sorted and without the prefix
+func (v *EnvView) Keys() []string {
+	keys := []string{}
+	for _, k := range v.env.sortKeys() {
+		if strings.HasPrefix(k, v.prefix) && len(k) > len(v.prefix) {
+			keys = append(keys, strings.TrimPrefix(k, v.prefix))
+		}
+	}
+	return keys
+}
+
+//Map returns the keys of the view, without the prefix, and their values
+func (v *EnvView) Map() map[string]string {
+	m := map[string]string{}
+	for _, k := range v.Keys() {
+		m[k] = v.env.values()[v.prefix+k]
+	}
+	return m
+}
+
+//PromoteKey sets the key to to the value of from, as when an instance of a service linked to an
+// app becomes its default one. from must be set, and to must not, a KeyExistsError is returned
+// rather than replacing it. from is left as it is
+func (e *Env) PromoteKey(from string, to string) error {
+	if e.readOnly {
+		return ErrReadOnlyEnv
+	}
+	if err := validateKey(to); err != nil {
+		return err
+	}
+	value, ok := e.values()[from]
+	if !ok {
+		return fmt.Errorf("Unable to promote %s as it is not set", from)
+	}
+	if _, ok := e.values()[to]; ok {
+		return &KeyExistsError{Key: to}
+	}
+	return e.Set(to, value)
+}
+
+//TriggerSetNamespaced implements the config-set-namespaced trigger by setting the pairs read from
+// input under prefix. Pairs are `key\tvalue\n` lines, the output of config-get-many, or
+// `key\0value\0` records if nullDelimited is true. They are set at once through SetMany, and the
+// app is restarted unless restart is false
+func TriggerSetNamespaced(appName string, prefix string, input io.Reader, nullDelimited bool, restart bool) error {
+	if prefix == "" {
+		return fmt.Errorf("A prefix is required")
+	}
+	if err := verifyRawTriggerArgs(appName, prefix); err != nil {
+		return err
+	}
+	pairs, err := readPairs(input, nullDelimited)
+	if err != nil {
+		return err
+	}
+	values := make(map[string]string, len(pairs))
+	for _, p := range pairs {
+		if err := validatePrefixedKey(prefix, p[0]); err != nil {
+			return &TriggerError{ExitCode: ExitCodeInvalidKey, Err: err}
+		}
+		values[prefix+p[0]] = p[1]
+	}
+	if appName == "--global" {
+		appName = ""
+	}
+	return SetMany(appName, values, restart)
+}
+
+//readPairs reads `key\tvalue\n` lines, or `key\0value\0` records if nullDelimited is true,
+// skipping empty lines
+func readPairs(input io.Reader, nullDelimited bool) ([][2]string, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	pairs := [][2]string{}
+	if nullDelimited {
+		fields := bytes.Split(b, []byte{0})
+		if len(fields[len(fields)-1]) == 0 {
+			fields = fields[:len(fields)-1]
+		}
+		if len(fields)%2 != 0 {
+			return nil, fmt.Errorf("Expected a value after key %s", fields[len(fields)-1])
+		}
+		for i := 0; i < len(fields); i += 2 {
+			pairs = append(pairs, [2]string{string(fields[i]), string(fields[i+1])})
+		}
+		return pairs, nil
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "\t", 2)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Expected a tab between key and value on line %d", number)
+		}
+		pairs = append(pairs, [2]string{fields[0], fields[1]})
+	}
+	return pairs, scanner.Err()
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvView(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("DATABASE_URL", "postgres://default", "DOKKU_POSTGRES_RED_URL", "postgres://red", "DOKKU_POSTGRES_RED_NAME", "red", "DOKKU_POSTGRES_BLUE_URL", "postgres://blue"))
+	red := env.WithPrefix("DOKKU_POSTGRES_RED_")
+	Expect(red.Prefix()).To(Equal("DOKKU_POSTGRES_RED_"))
+	Expect(red.Keys()).To(Equal([]string{"NAME", "URL"}))
+	Expect(red.Map()).To(Equal(pairs("NAME", "red", "URL", "postgres://red")))
+	Expect(red.GetDefault("URL", "")).To(Equal("postgres://red"))
+	Expect(red.GetDefault("PORT", "5432")).To(Equal("5432"))
+
+	Expect(red.Set("PORT", "5433")).To(Succeed())
+	Expect(env.GetDefault("DOKKU_POSTGRES_RED_PORT", "")).To(Equal("5433"))
+	red.Unset("NAME")
+	Expect(env.Get("DOKKU_POSTGRES_RED_NAME")).To(BeEmpty())
+	Expect(env.GetDefault("DOKKU_POSTGRES_BLUE_URL", "")).To(Equal("postgres://blue"))
+
+	Expect(red.Set("", "x")).To(MatchError("Invalid key name: 'DOKKU_POSTGRES_RED_'"))
+	Expect(red.Set("NOT-VALID", "x")).To(MatchError("Invalid key name: 'DOKKU_POSTGRES_RED_NOT-VALID'"))
+	Expect(env.WithPrefix("").Keys()).To(HaveLen(4))
+	Expect(env.ReadOnly().WithPrefix("DOKKU_POSTGRES_RED_").Set("URL", "x")).To(Equal(ErrReadOnlyEnv))
+}
+
+func TestPromoteKey(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("DATABASE_URL", "postgres://default", "DOKKU_POSTGRES_RED_URL", "postgres://red"))
+
+	err := env.PromoteKey("DOKKU_POSTGRES_RED_URL", "DATABASE_URL")
+	Expect(err).To(Equal(&KeyExistsError{Key: "DATABASE_URL"}))
+	Expect(err).To(MatchError("Key DATABASE_URL is already set"))
+	Expect(env.GetDefault("DATABASE_URL", "")).To(Equal("postgres://default"))
+
+	Expect(env.PromoteKey("DOKKU_POSTGRES_BLUE_URL", "OTHER_URL")).To(MatchError("Unable to promote DOKKU_POSTGRES_BLUE_URL as it is not set"))
+	Expect(env.PromoteKey("DOKKU_POSTGRES_RED_URL", "not-valid")).To(MatchError("Invalid key name: 'not-valid'"))
+
+	env.Unset("DATABASE_URL")
+	Expect(env.PromoteKey("DOKKU_POSTGRES_RED_URL", "DATABASE_URL")).To(Succeed())
+	Expect(env.Map()).To(Equal(pairs("DATABASE_URL", "postgres://red", "DOKKU_POSTGRES_RED_URL", "postgres://red")))
+	Expect(env.ReadOnly().PromoteKey("DOKKU_POSTGRES_RED_URL", "OTHER_URL")).To(Equal(ErrReadOnlyEnv))
+}
+
+func TestReadPairs(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(readPairs(strings.NewReader("URL\tpostgres://red\n\nNAME\tred\r\nEMPTY\t\n"), false)).To(Equal([][2]string{{"URL", "postgres://red"}, {"NAME", "red"}, {"EMPTY", ""}}))
+	_, err := readPairs(strings.NewReader("URL\tx\nURL=secret\n"), false)
+	Expect(err).To(MatchError("Expected a tab between key and value on line 2"))
+
+	Expect(readPairs(strings.NewReader("URL\x00a\tb\nc\x00EMPTY\x00\x00"), true)).To(Equal([][2]string{{"URL", "a\tb\nc"}, {"EMPTY", ""}}))
+	Expect(readPairs(strings.NewReader(""), true)).To(BeEmpty())
+	_, err = readPairs(strings.NewReader("URL\x00"), true)
+	Expect(err).To(MatchError("Expected a value after key URL"))
+}
+
+func TestTriggerSetNamespaced(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	Expect(TriggerSetNamespaced(testAppName, "DOKKU_REDIS_RED_", strings.NewReader("URL\tredis://red\nNAME\tred\n"), false, false)).To(Succeed())
+	Expect(TriggerSetNamespaced(testAppName, "DOKKU_REDIS_BLUE_", strings.NewReader("URL\x00redis://blue\x00"), true, false)).To(Succeed())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.WithPrefix("DOKKU_REDIS_RED_").Map()).To(Equal(pairs("NAME", "red", "URL", "redis://red")))
+	Expect(env.WithPrefix("DOKKU_REDIS_BLUE_").Map()).To(Equal(pairs("URL", "redis://blue")))
+
+	Expect(TriggerSetNamespaced(testAppName, "", strings.NewReader("URL\tx\n"), false, false)).To(MatchError("A prefix is required"))
+	expectTriggerExitCode(TriggerSetNamespaced(testAppName+"-missing", "DOKKU_REDIS_RED_", strings.NewReader("URL\tx\n"), false, false), ExitCodeAppNotFound)
+	expectTriggerExitCode(TriggerSetNamespaced(testAppName, "DOKKU-REDIS_", strings.NewReader("URL\tx\n"), false, false), ExitCodeInvalidKey)
+	expectTriggerExitCode(TriggerSetNamespaced(testAppName, "DOKKU_REDIS_RED_", strings.NewReader("URL\tx\nNOT-VALID\tx\n"), false, false), ExitCodeInvalidKey)
+	//nothing is set unless every pair is valid
+	Expect(GetWithDefault(testAppName, "DOKKU_REDIS_RED_URL", "")).To(Equal("redis://red"))
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//defaultNestedSeparator is what keys are split on by the json-nested format by default
+const defaultNestedSeparator = "_"
+
+//NestedValueKey is where the json-nested format puts the value of a key that is also the prefix of
+// other keys, next to the values nested under it
+const NestedValueKey = "_value"
+
+//nestedNode is an object or a value in the json-nested format, or both for a key that is the
+// prefix of other keys
+type nestedNode struct {
+	//key is the env key whose value the node holds, or empty if it has none
+	key      string
+	value    string
+	children map[string]*nestedNode
+}
+
+//nestedJSONString returns the contents of this Env as a json object in which each key is split on
+// opts.NestedSeparator, every part but the last naming an object nested in the one before it.
+// SMTP_HOST and SMTP_PORT become {"SMTP": {"HOST": ..., "PORT": ...}}. A key that is also the
+// prefix of other keys, such as SMTP next to SMTP_HOST, becomes an object as well, holding its
+// own value under NestedValueKey. Separators at either end of a key or next to each other make
+// parts with an empty name. Keys that would end up in the same place, such as SMTP_HOST and
+// smtp_host with opts.NestedLowercase, are an error naming both
+func (e *Env) nestedJSONString(opts ExportOptions) (string, error) {
+	separator := opts.NestedSeparator
+	if separator == "" {
+		separator = defaultNestedSeparator
+	}
+	root := &nestedNode{children: map[string]*nestedNode{}}
+	for _, k := range e.sortKeys() {
+		path := k
+		if opts.NestedLowercase {
+			path = strings.ToLower(path)
+		}
+		node := root
+		for _, part := range strings.Split(path, separator) {
+			child, ok := node.children[part]
+			if !ok {
+				child = &nestedNode{children: map[string]*nestedNode{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+		if node.key != "" {
+			return "", fmt.Errorf("%s and %s would both be exported as %s", node.key, k, strings.Join(strings.Split(path, separator), "."))
+		}
+		node.key, node.value = k, e.values()[k]
+	}
+	tree, err := root.object()
+	if err != nil {
+		return "", err
+	}
+	rep, err := json.Marshal(tree)
+	if err != nil {
+		return "", err
+	}
+	return string(rep), nil
+}
+
+//object returns the children of the node as a map to marshal, along with its own value if it has one
+func (n *nestedNode) object() (map[string]interface{}, error) {
+	object := make(map[string]interface{}, len(n.children)+1)
+	if n.key != "" {
+		if child, ok := n.children[NestedValueKey]; ok {
+			return nil, fmt.Errorf("%s would be exported in the place of %s, which is also the prefix of other keys", firstKey(child), n.key)
+		}
+		object[NestedValueKey] = n.value
+	}
+	for part, child := range n.children {
+		if len(child.children) == 0 {
+			object[part] = child.value
+			continue
+		}
+		nested, err := child.object()
+		if err != nil {
+			return nil, err
+		}
+		object[part] = nested
+	}
+	return object, nil
+}
+
+//firstKey returns the env key of a node or of the first of its children holding one, by name
+func firstKey(n *nestedNode) string {
+	if n.key != "" {
+		return n.key
+	}
+	first := ""
+	for _, child := range n.children {
+		if k := firstKey(child); k != "" && (first == "" || k < first) {
+			first = k
+		}
+	}
+	return first
+}
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNestedJSONString(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("SMTP_HOST", "mail.example.com", "SMTP_PORT", "587", "SMTP_AUTH_USER", "bob", "PORT", "5000"))
+	rep, err := env.ExportWithOptions(ExportFormatJSONNested, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rep).To(Equal(`{"PORT":"5000","SMTP":{"AUTH":{"USER":"bob"},"HOST":"mail.example.com","PORT":"587"}}`))
+	Expect(env.Export(ExportFormatJSONNested)).To(Equal(rep))
+
+	rep, err = env.ExportWithOptions(ExportFormatJSONNested, ExportOptions{NestedLowercase: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rep).To(Equal(`{"port":"5000","smtp":{"auth":{"user":"bob"},"host":"mail.example.com","port":"587"}}`))
+
+	rep, err = NewForTest(t, pairs("SMTP__HOST", "a", "SMTP_PORT", "b")).ExportWithOptions(ExportFormatJSONNested, ExportOptions{NestedSeparator: "__"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rep).To(Equal(`{"SMTP":{"HOST":"a"},"SMTP_PORT":"b"}`))
+
+	rep, err = NewForTest(t, nil).ExportWithOptions(ExportFormatJSONNested, ExportOptions{})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rep).To(Equal(`{}`))
+}
+
+func TestNestedJSONConflicts(t *testing.T) {
+	RegisterTestingT(t)
+	//a key that is both a leaf and the prefix of others keeps its value under _value, at any depth
+	for _, tc := range []struct {
+		values   map[string]string
+		opts     ExportOptions
+		expected string
+	}{
+		{pairs("SMTP", "on", "SMTP_HOST", "h"), ExportOptions{}, `{"SMTP":{"HOST":"h","_value":"on"}}`},
+		{pairs("A", "1", "A_B", "2", "A_B_C", "3"), ExportOptions{}, `{"A":{"B":{"C":"3","_value":"2"},"_value":"1"}}`},
+		{pairs("SMTP_HOST", "h", "SMTP", "on"), ExportOptions{NestedLowercase: true}, `{"smtp":{"_value":"on","host":"h"}}`},
+		//a _value part of a key without a value of its own is nested like any other
+		{pairs("SMTP___VALUE", "v"), ExportOptions{NestedSeparator: "__"}, `{"SMTP":{"_VALUE":"v"}}`},
+		//separators at either end or next to each other make parts with an empty name
+		{pairs("_A", "1", "B_", "2", "C__D", "3"), ExportOptions{}, `{"":{"A":"1"},"B":{"":"2"},"C":{"":{"D":"3"}}}`},
+	} {
+		rep, err := NewForTest(t, tc.values).ExportWithOptions(ExportFormatJSONNested, tc.opts)
+		Expect(err).NotTo(HaveOccurred(), tc.expected)
+		Expect(rep).To(Equal(tc.expected))
+	}
+
+	_, err := NewForTest(t, pairs("SMTP_HOST", "a", "smtp_host", "b")).ExportWithOptions(ExportFormatJSONNested, ExportOptions{NestedLowercase: true})
+	Expect(err).To(MatchError("SMTP_HOST and smtp_host would both be exported as smtp.host"))
+	_, err = NewForTest(t, pairs("smtp", "on", "SMTP___VALUE", "v")).ExportWithOptions(ExportFormatJSONNested, ExportOptions{NestedSeparator: "__", NestedLowercase: true})
+	Expect(err).To(MatchError("SMTP___VALUE would be exported in the place of smtp, which is also the prefix of other keys"))
+	_, err = NewForTest(t, pairs("LATIN1", "caf\xe9")).ExportWithOptions(ExportFormatJSONNested, ExportOptions{})
+	Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//NotificationSignatureHeader holds the HMAC-SHA256 of the body of a notification, keyed with the
+// secret of the endpoint, as sha256=<hex>
+const NotificationSignatureHeader = "X-Dokku-Signature"
+
+var (
+	//notificationTimeout bounds each delivery attempt, so that a slow endpoint cannot hold up a deploy
+	notificationTimeout = 3 * time.Second
+	//notificationAttempts is how many times a notification is sent before giving up on an endpoint
+	notificationAttempts = 3
+	//notificationBackoff is the wait before the first retry, doubled for each retry after it
+	notificationBackoff = 500 * time.Millisecond
+)
+
+//NotificationEndpoint is a url notified of the config changes of an app, along with the secret its
+// notifications are signed with
+type NotificationEndpoint struct {
+	URL    string
+	Secret string
+}
+
+func (n NotificationEndpoint) String() string {
+	return n.URL + " " + n.Secret
+}
+
+//Notification is the body POSTed to the endpoints of an app after its config changes. It names the
+// keys that changed, never their values
+type Notification struct {
+	App       string    `json:"app"`
+	Global    bool      `json:"global"`
+	Action    string    `json:"action"`
+	Keys      []string  `json:"keys"`
+	Actor     string    `json:"actor"`
+	Timestamp time.Time `json:"timestamp"`
+	//Checksum is that of the env after the change, see Env.Checksum
+	Checksum string `json:"checksum"`
+}
+
+//GetNotificationEndpoints returns the endpoints of an app, or of the global env if appName is
+// empty, in the order they were added
+func GetNotificationEndpoints(appName string) ([]NotificationEndpoint, error) {
+	endpoints := []NotificationEndpoint{}
+	if os.Getenv("DOKKU_LIB_ROOT") == "" {
+		return endpoints, nil
+	}
+	lines, err := common.PropertyListGet("config", notificationOwner(appName), "notification-endpoint")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		endpoints = append(endpoints, NotificationEndpoint{URL: parts[0], Secret: parts[1]})
+	}
+	return endpoints, nil
+}
+
+//AddNotificationEndpoint registers a url to be notified of config changes, returning the endpoint
+// with the secret generated to sign its notifications
+func AddNotificationEndpoint(appName string, rawURL string) (NotificationEndpoint, error) {
+	if err := validateNotificationURL(rawURL); err != nil {
+		return NotificationEndpoint{}, err
+	}
+	endpoints, err := GetNotificationEndpoints(appName)
+	if err != nil {
+		return NotificationEndpoint{}, err
+	}
+	for _, existing := range endpoints {
+		if existing.URL == rawURL {
+			return NotificationEndpoint{}, fmt.Errorf("%s is already notified, remove it first to change its secret", rawURL)
+		}
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return NotificationEndpoint{}, err
+	}
+	endpoint := NotificationEndpoint{URL: rawURL, Secret: hex.EncodeToString(secret)}
+	return endpoint, common.PropertyListAdd("config", notificationOwner(appName), "notification-endpoint", endpoint.String(), 0)
+}
+
+//RemoveNotificationEndpoint stops notifying a url of config changes
+func RemoveNotificationEndpoint(appName string, rawURL string) error {
+	endpoints, err := GetNotificationEndpoints(appName)
+	if err != nil {
+		return err
+	}
+	for _, existing := range endpoints {
+		if existing.URL == rawURL {
+			return common.PropertyListRemove("config", notificationOwner(appName), "notification-endpoint", existing.String())
+		}
+	}
+	return fmt.Errorf("%s is not notified", rawURL)
+}
+
+//notifyTrigger is the trigger of the config plugin that delivers the notification of a change
+const notifyTrigger = "config-notify"
+
+//notifyEndpoints has a notification of a config change sent to every endpoint of the app, or of the
+// global env if appName is empty, by the config-notify trigger fired detached, so that the change
+// never waits for the endpoints to answer. Nothing is sent if no key changed
+func notifyEndpoints(appName string, action string, keys []string) {
+	if len(keys) == 0 {
+		return
+	}
+	endpoints, err := GetNotificationEndpoints(appName)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to read the notification endpoints: %s", err.Error()))
+		return
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+	notification := Notification{
+		App:       appName,
+		Global:    appName == "",
+		Action:    action,
+		Keys:      keys,
+		Actor:     currentActor(),
+		Timestamp: time.Now().UTC().Truncate(time.Second),
+	}
+	if env, err := loadAppOrGlobalEnv(appName); err == nil {
+		notification.Checksum = env.Checksum()
+	}
+	body, err := json.Marshal(notification)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to encode the config change notification: %s", err.Error()))
+		return
+	}
+	if err := activeHost.TriggerDetached(notifyTrigger, appName, string(body)); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to send the config change notification: %s", err.Error()))
+	}
+}
+
+//TriggerNotify implements the config-notify trigger, sending the body of a notification to every
+// endpoint of an app, or of the global env if appName is empty. Endpoints are notified concurrently,
+// and failures are only warned about as the change has already been made
+func TriggerNotify(appName string, body string) {
+	endpoints, err := GetNotificationEndpoints(appName)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to read the notification endpoints: %s", err.Error()))
+		return
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(endpoints))
+	for i, endpoint := range endpoints {
+		wg.Add(1)
+		go func(i int, endpoint NotificationEndpoint) {
+			defer wg.Done()
+			errs[i] = deliverNotification(endpoint, []byte(body))
+		}(i, endpoint)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to notify %s of the config change: %s", endpoints[i].URL, err.Error()))
+		}
+	}
+}
+
+//deliverNotification POSTs a signed notification to an endpoint, retrying on errors and on
+// responses other than 2xx
+func deliverNotification(endpoint NotificationEndpoint, body []byte) error {
+	client := &http.Client{Timeout: notificationTimeout}
+	backoff := notificationBackoff
+	var err error
+	for attempt := 0; attempt < notificationAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		var req *http.Request
+		if req, err = http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body)); err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(NotificationSignatureHeader, SignNotification(endpoint.Secret, body))
+		var resp *http.Response
+		if resp, err = client.Do(req); err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		err = fmt.Errorf("the endpoint answered %s", resp.Status)
+	}
+	return err
+}
+
+//SignNotification returns the value of the signature header of a notification body, which
+// receivers compute the same way with the secret of their endpoint to verify it
+func SignNotification(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func validateNotificationURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.ContainsAny(rawURL, " \t\n") {
+		return &ValidationError{Message: fmt.Sprintf("Invalid notification url '%s', expected an http or https url", rawURL)}
+	}
+	return nil
+}
+
+//notificationOwner returns the name the endpoints of an app, or of the global env, are stored under
+func notificationOwner(appName string) string {
+	if appName == "" {
+		return "--global"
+	}
+	return appName
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNotificationEndpoints(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupTestProperties()()
+
+	endpoint, err := AddNotificationEndpoint(testAppName, "https://hooks.example.com/dokku")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(endpoint.Secret).To(HaveLen(64))
+	_, err = AddNotificationEndpoint(testAppName, "https://hooks.example.com/dokku")
+	Expect(err).To(MatchError(HavePrefix("https://hooks.example.com/dokku is already notified")))
+	for _, invalid := range []string{"ftp://hooks.example.com", "hooks.example.com/dokku", "https://", "https://a b"} {
+		_, err = AddNotificationEndpoint(testAppName, invalid)
+		Expect(err).To(MatchError(HavePrefix("Invalid notification url")), invalid)
+	}
+
+	endpoints, err := GetNotificationEndpoints(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(endpoints).To(Equal([]NotificationEndpoint{endpoint}))
+	endpoints, err = GetNotificationEndpoints("")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(endpoints).To(BeEmpty())
+
+	Expect(RemoveNotificationEndpoint(testAppName, endpoint.URL)).To(Succeed())
+	Expect(RemoveNotificationEndpoint(testAppName, endpoint.URL)).To(MatchError("https://hooks.example.com/dokku is not notified"))
+}
+
+func TestNotifyEndpoints(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	defer func(backoff time.Duration) { notificationBackoff = backoff }(notificationBackoff)
+	notificationBackoff = time.Millisecond
+	host := &testHost{root: os.Getenv("DOKKU_ROOT")}
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	var mu sync.Mutex
+	attempts := 0
+	bodies := [][]byte{}
+	signatures := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		//the first attempt fails, so that the notification has to be retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(NotificationSignatureHeader))
+	}))
+	defer server.Close()
+
+	endpoint, err := AddNotificationEndpoint(testAppName, server.URL)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(SetMany(testAppName, pairs("HOOKED", "s3cret-value"), false)).To(Succeed())
+
+	//the notification is left to the config-notify trigger, which the change does not wait for
+	Expect(attempts).To(Equal(0))
+	Expect(host.detached).To(HaveLen(1))
+	Expect(host.detached[0][:2]).To(Equal([]string{notifyTrigger, testAppName}))
+	body := host.detached[0][2]
+	Expect(body).NotTo(ContainSubstring("s3cret-value"))
+
+	TriggerNotify(testAppName, body)
+	Expect(attempts).To(Equal(2))
+	Expect(bodies).To(HaveLen(1))
+	Expect(string(bodies[0])).To(Equal(body))
+	Expect(signatures[0]).To(Equal(SignNotification(endpoint.Secret, bodies[0])))
+
+	var notification Notification
+	Expect(json.Unmarshal(bodies[0], &notification)).To(Succeed())
+	Expect(notification.App).To(Equal(testAppName))
+	Expect(notification.Global).To(BeFalse())
+	Expect(notification.Action).To(Equal("set"))
+	Expect(notification.Keys).To(Equal([]string{"HOOKED"}))
+	env, _ := LoadAppEnv(testAppName)
+	Expect(notification.Checksum).To(Equal(env.Checksum()))
+
+	//only the keys whose value changed are notified
+	Expect(SetMany(testAppName, pairs("HOOKED", "s3cret-value", "ADDED", "1"), false)).To(Succeed())
+	Expect(host.detached).To(HaveLen(2))
+	Expect(json.Unmarshal([]byte(host.detached[1][2]), &notification)).To(Succeed())
+	Expect(notification.Keys).To(Equal([]string{"ADDED"}))
+	Expect(SetMany(testAppName, pairs("HOOKED", "s3cret-value"), false)).To(Succeed())
+	Expect(host.detached).To(HaveLen(2))
+
+	//the global env has endpoints of its own
+	Expect(SetMany("", pairs("HOOKED", "global"), false)).To(Succeed())
+	Expect(host.detached).To(HaveLen(2))
+}
+
+func TestDeliverNotificationGivesUp(t *testing.T) {
+	RegisterTestingT(t)
+	defer func(backoff time.Duration) { notificationBackoff = backoff }(notificationBackoff)
+	notificationBackoff = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	err := deliverNotification(NotificationEndpoint{URL: server.URL, Secret: "secret"}, []byte("{}"))
+	Expect(err).To(MatchError("the endpoint answered 500 Internal Server Error"))
+	Expect(attempts).To(Equal(notificationAttempts))
+}
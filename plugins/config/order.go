@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+//fileLayout remembers how the keys of an ENV file were written, so that an Env in ordered mode
+// can write the file back changing only the lines of keys that were set or unset
+type fileLayout struct {
+	lines map[string]layoutLine
+	//trailer holds the comment and blank lines after the last key
+	trailer []string
+}
+
+//layoutLine is the line a key was read from along with the comment and blank lines above it
+type layoutLine struct {
+	comments []string
+	text     string
+	value    string
+}
+
+//OrderedKeys gets the keys in this environment in the order they appear in the file it was
+// loaded from, followed by keys set since in the order they were added. An Env that was not
+// read from a file, such as one created with NewForTest, returns its keys sorted
+func (e *Env) OrderedKeys() []string {
+	e.materialize()
+	if e.order == nil {
+		return e.Keys()
+	}
+	keys := make([]string, len(e.order))
+	copy(keys, e.order)
+	return keys
+}
+
+//PreserveOrder switches this Env to ordered mode, in which Write keeps its keys in OrderedKeys
+// order and leaves the lines of unchanged keys, as well as comments, as they were read
+func (e *Env) PreserveOrder() {
+	e.ordered = true
+	e.materialize()
+	if e.order == nil {
+		e.order = e.Keys()
+	}
+}
+
+//exportKeys returns the keys in the order an export with the given options lists them
+func (e *Env) exportKeys(opts ExportOptions) []string {
+	e.materialize()
+	if opts.Ordered && e.order != nil {
+		return e.order
+	}
+	return e.sortKeys()
+}
+
+//orderedString returns the contents of this Env as written by Write in ordered mode
+func (e *Env) orderedString() string {
+	e.materialize()
+	layout := e.layout
+	if layout == nil {
+		layout = &fileLayout{lines: map[string]layoutLine{}}
+	}
+	lines := make([]string, 0, len(e.order)+len(layout.trailer))
+	for _, k := range e.order {
+		line, ok := layout.lines[k]
+		if !ok {
+			lines = append(lines, e.fileLine(k, e.values()[k], false))
+			continue
+		}
+		lines = append(lines, line.comments...)
+		exported := isExportLine(line.text)
+		if line.value == e.values()[k] && e.keepsLine(exported) {
+			lines = append(lines, line.text)
+		} else {
+			lines = append(lines, e.fileLine(k, e.values()[k], exported))
+		}
+	}
+	lines = append(lines, layout.trailer...)
+	return strings.Join(lines, "\n")
+}
+
+//recordOrder appends a key added to this Env to its order
+func (e *Env) recordOrder(key string) {
+	if e.order != nil {
+		e.order = append(e.order, key)
+	}
+}
+
+//forgetOrder removes an unset key from the order of this Env
+func (e *Env) forgetOrder(key string) {
+	for i, k := range e.order {
+		if k == key {
+			e.order = append(e.order[:i:i], e.order[i+1:]...)
+			return
+		}
+	}
+}
+
+//marshalEnvLine formats a single entry the way Write does
+func marshalEnvLine(key string, value string) string {
+	rep, _ := godotenv.Marshal(map[string]string{key: value})
+	return rep
+}
+
+//parseLayout returns the keys of the ENV file contents in the order they appear, along with
+// the lines they were read from. A key assigned more than once takes the place of its last
+// assignment, which is the one that takes effect. Nil is returned if a line cannot be parsed
+func parseLayout(contents string) ([]string, *fileLayout) {
+	order := []string{}
+	layout := &fileLayout{lines: map[string]layoutLine{}}
+	comments := []string{}
+	scanner := bufio.NewScanner(strings.NewReader(contents))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(contents)+1)
+	for scanner.Scan() {
+		text := scanner.Text()
+		if trimmed := strings.Trim(text, " \n\t"); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			comments = append(comments, text)
+			continue
+		}
+		envMap, err := godotenv.Unmarshal(text)
+		if err != nil || len(envMap) != 1 {
+			return nil, nil
+		}
+		for k, v := range envMap {
+			if _, ok := layout.lines[k]; ok {
+				for i, existing := range order {
+					if existing == k {
+						order = append(order[:i:i], order[i+1:]...)
+						break
+					}
+				}
+			}
+			order = append(order, k)
+			layout.lines[k] = layoutLine{comments: comments, text: text, value: v}
+		}
+		comments = []string{}
+	}
+	if scanner.Err() != nil {
+		return nil, nil
+	}
+	layout.trailer = comments
+	return order, layout
+}
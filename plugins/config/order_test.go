@@ -0,0 +1,124 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+const orderedTestFile = `# database
+export ZED='first'
+export ALPHA='1'
+
+# overrides ALPHA for local runs
+MIDDLE="two words"
+REMOVED=gone
+export LAST='3'
+# end of file
+`
+
+func TestOrderedKeys(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := newEnvFromString(orderedTestFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.OrderedKeys()).To(Equal([]string{"ZED", "ALPHA", "MIDDLE", "REMOVED", "LAST"}))
+	Expect(env.Keys()).To(Equal([]string{"ALPHA", "LAST", "MIDDLE", "REMOVED", "ZED"}))
+
+	Expect(env.Set("NEW", "x")).To(Succeed())
+	Expect(env.Set("ALPHA", "changed")).To(Succeed())
+	env.Unset("REMOVED")
+	Expect(env.OrderedKeys()).To(Equal([]string{"ZED", "ALPHA", "MIDDLE", "LAST", "NEW"}))
+
+	//the last assignment of a key decides its place
+	env, err = newEnvFromString("A=1\nB=2\nA=3\n")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.OrderedKeys()).To(Equal([]string{"B", "A"}))
+
+	env = NewForTest(t, pairs("B", "2", "A", "1"))
+	Expect(env.OrderedKeys()).To(Equal([]string{"A", "B"}))
+}
+
+func TestOrderedExport(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := newEnvFromString("B=2\nA=1\n")
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(env.Export(ExportFormatExports)).To(Equal("export A='1'\nexport B='2'"))
+	exported, err := env.ExportWithOptions(ExportFormatExports, ExportOptions{Ordered: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("export B='2'\nexport A='1'"))
+	exported, err = env.ExportWithOptions(ExportFormatEnvfile, ExportOptions{Ordered: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("B=\"2\"\nA=\"1\""))
+	exported, err = env.ExportWithOptions(ExportFormatShell, ExportOptions{Ordered: true})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported).To(Equal("B='2' A='1'"))
+
+	merged := env.clone()
+	merged.Merge(NewForTest(t, pairs("C", "3", "A", "app")))
+	Expect(merged.OrderedKeys()).To(Equal([]string{"B", "A", "C"}))
+}
+
+func TestOrderedWriteTouchesOnlyChangedLines(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-order")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte(orderedTestFile), 0600)).To(Succeed())
+
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	env.PreserveOrder()
+	Expect(env.Set("ALPHA", "changed")).To(Succeed())
+	Expect(env.Set("MIDDLE", "two words")).To(Succeed())
+	Expect(env.Set("NEW", "x")).To(Succeed())
+	env.Unset("REMOVED")
+	Expect(env.Write()).To(Succeed())
+
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal(strings.Join([]string{
+		"# database",
+		"export ZED='first'",
+		"export ALPHA=\"changed\"",
+		"",
+		"# overrides ALPHA for local runs",
+		"MIDDLE=\"two words\"",
+		"export LAST='3'",
+		"NEW=\"x\"",
+		"# end of file",
+		"",
+	}, "\n")))
+
+	reloaded, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(reloaded.Map()).To(Equal(env.Map()))
+	Expect(reloaded.OrderedKeys()).To(Equal(env.OrderedKeys()))
+
+	//without PreserveOrder the file is rewritten sorted
+	Expect(reloaded.Write()).To(Succeed())
+	contents, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("ALPHA=\"changed\"\nLAST=\"3\"\nMIDDLE=\"two words\"\nNEW=\"x\"\nZED=\"first\"\n"))
+}
+
+func TestPreserveOrderProperty(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	Expect(ioutil.WriteFile(testAppDir+"/ENV", []byte("export testKey='TESTING'\nexport AFTER='1'\n"), 0600)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "preserve-order", "true")).To(Succeed())
+
+	Expect(SetMany(testAppName, pairs("AFTER", "2", "BEFORE", "3"), false)).To(Succeed())
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("export testKey='TESTING'\nexport AFTER=\"2\"\nBEFORE=\"3\"\n"))
+}
@@ -0,0 +1,152 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+
+	"github.com/joho/godotenv"
+)
+
+//Categories of the ParseWarnings found while reading an ENV file
+const (
+	//ParseWarningLineEnding is reported once for a file with \r\n line endings, whose carriage
+	// returns are dropped
+	ParseWarningLineEnding = "line-ending"
+	//ParseWarningUnparsable is a line that cannot be parsed. It and every line after it are ignored
+	ParseWarningUnparsable = "unparsable-line"
+	//ParseWarningExportPrefix is a key whose name starts with export, which is stripped
+	ParseWarningExportPrefix = "export-prefix"
+	//ParseWarningYAMLSeparator is a KEY: value line, which is read as KEY=value
+	ParseWarningYAMLSeparator = "yaml-separator"
+	//ParseWarningDuplicateKey is a key assigned more than once, of which only the last value is kept
+	ParseWarningDuplicateKey = "duplicate-key"
+	//ParseWarningInlineComment is an unquoted value holding a #, after which it is cut off
+	ParseWarningInlineComment = "inline-comment"
+	//ParseWarningFinalNewline is reported for a file whose last line does not end with a newline,
+	// which is read as usual but dropped by shell loops reading the file with read
+	ParseWarningFinalNewline = "final-newline"
+)
+
+//ParseWarning is something in an ENV file that was read differently than it is written, without
+// the file failing to load
+type ParseWarning struct {
+	//Line is the number of the line in the file, starting at 1
+	Line     int
+	Category string
+	Message  string
+}
+
+func (w ParseWarning) String() string {
+	return fmt.Sprintf("line %d: %s", w.Line, w.Message)
+}
+
+//Warnings returns what was found to be reinterpreted while reading the file of this Env, in the
+// order of the lines they were found on. An Env that was not read from a file has none
+func (e *Env) Warnings() []ParseWarning {
+	warnings := make([]ParseWarning, len(e.warnings))
+	copy(warnings, e.warnings)
+	return warnings
+}
+
+//findParseWarnings returns what godotenv reinterprets in ENV file contents, which start at line
+// firstLine of the file. It reads the contents line by line the same way godotenv does
+func findParseWarnings(contents string, firstLine int) []ParseWarning {
+	warnings := []ParseWarning{}
+	if i := strings.Index(contents, "\r\n"); i >= 0 {
+		warnings = append(warnings, ParseWarning{
+			Line:     firstLine + strings.Count(contents[:i], "\n"),
+			Category: ParseWarningLineEnding,
+			Message:  "the file has \\r\\n line endings, the carriage returns are dropped",
+		})
+	}
+
+	lines := strings.Split(strings.TrimSuffix(contents, "\n"), "\n")
+	assigned := map[string]int{}
+	for i, text := range lines {
+		line := firstLine + i
+		text = strings.TrimSuffix(text, "\r")
+		if len(text) >= bufio.MaxScanTokenSize {
+			warnings = append(warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningUnparsable,
+				Message:  fmt.Sprintf("the line is longer than %d bytes, no key of the file can be read", bufio.MaxScanTokenSize-1),
+			})
+			break
+		}
+		if trimmed := strings.Trim(text, " \n\t"); trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		key, value, ok := parseSingleLine(text)
+		if !ok {
+			warnings = append(warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningUnparsable,
+				Message:  fmt.Sprintf("the line cannot be parsed, it and the %d line(s) after it are ignored", len(lines)-i-1),
+			})
+			break
+		}
+
+		separator := strings.Index(text, "=")
+		if colon := strings.Index(text, ":"); colon != -1 && (separator == -1 || colon < separator) {
+			separator = colon
+			warnings = append(warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningYAMLSeparator,
+				Message:  fmt.Sprintf("%s is separated from its value by a colon, which is read as =", key),
+			})
+		}
+		if rawKey := text[:separator]; strings.HasPrefix(rawKey, "export") && !strings.HasPrefix(rawKey, "export ") {
+			warnings = append(warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningExportPrefix,
+				Message:  fmt.Sprintf("%s is read as %s, the export its name starts with is stripped", strings.Trim(rawKey, " "), key),
+			})
+		}
+		if strings.Contains(text, "#") {
+			//godotenv strips comments before parsing the value, a placeholder keeps them in
+			if _, full, ok := parseSingleLine(strings.Replace(text, "#", "\x01", -1)); ok && strings.Replace(full, "\x01", "#", -1) != value {
+				warnings = append(warnings, ParseWarning{
+					Line:     line,
+					Category: ParseWarningInlineComment,
+					Message:  fmt.Sprintf("the value of %s is cut off at a #, quote it to keep the rest", key),
+				})
+			}
+		}
+		if previous, ok := assigned[key]; ok {
+			warnings = append(warnings, ParseWarning{
+				Line:     line,
+				Category: ParseWarningDuplicateKey,
+				Message:  fmt.Sprintf("%s is also set on line %d, only this value is used", key, previous),
+			})
+		}
+		assigned[key] = line
+	}
+	return warnings
+}
+
+//findFileParseWarnings returns the warnings of findParseWarnings for the contents of an ENV file,
+// along with those that only apply to a file, such as it lacking a final newline
+func findFileParseWarnings(contents string, firstLine int) []ParseWarning {
+	warnings := findParseWarnings(contents, firstLine)
+	if contents != "" && !strings.HasSuffix(contents, "\n") {
+		warnings = append(warnings, ParseWarning{
+			Line:     firstLine + strings.Count(contents, "\n"),
+			Category: ParseWarningFinalNewline,
+			Message:  "the file does not end with a newline, the next write adds it",
+		})
+	}
+	return warnings
+}
+
+//parseSingleLine parses a line holding a single assignment the way godotenv does
+func parseSingleLine(text string) (key string, value string, ok bool) {
+	envMap, err := godotenv.Unmarshal(text)
+	if err != nil || len(envMap) != 1 {
+		return "", "", false
+	}
+	for k, v := range envMap {
+		key, value = k, v
+	}
+	return key, value, true
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParseWarningsGolden(t *testing.T) {
+	RegisterTestingT(t)
+	env, err := loadFromFile("messy", filepath.Join("testdata", "messy.env"))
+	Expect(err).NotTo(HaveOccurred())
+
+	var report strings.Builder
+	for _, w := range env.Warnings() {
+		fmt.Fprintf(&report, "%d\t%s\t%s\n", w.Line, w.Category, w.Message)
+	}
+	expectGolden("messy.warnings", report.String())
+	expectGolden("messy.exports", env.Export(ExportFormatExports))
+}
+
+func TestParseWarnings(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	//files written by dokku read back as they are written
+	values := pairs("A", "1", "HASH", "a#b", "URL", "postgres://u:p@host/db", "MULTILINE", "a\nb", "EXPORTER", "x", "YAML", "a: b")
+	Expect(SetMany(testAppName, values, false)).To(Succeed())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Warnings()).To(BeEmpty())
+	clean, err := NewFromStringWithName("clean", NewForTest(t, values).EnvfileString())
+	Expect(err).NotTo(HaveOccurred())
+	Expect(clean.Warnings()).To(BeEmpty())
+	Expect(NewForTest(t, values).Warnings()).To(BeEmpty())
+
+	//a line too long for godotenv loses the whole file
+	Expect(ioutil.WriteFile(testAppDir+"/ENV", []byte("A=1\nB="+strings.Repeat("x", 70000)+"\n"), 0600)).To(Succeed())
+	long, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(long.Len()).To(Equal(0))
+	Expect(long.Warnings()).To(Equal([]ParseWarning{{Line: 2, Category: ParseWarningUnparsable, Message: "the line is longer than 65535 bytes, no key of the file can be read"}}))
+	Expect(long.Warnings()[0].String()).To(Equal("line 2: the line is longer than 65535 bytes, no key of the file can be read"))
+}
+
+func TestParseWarningFinalNewline(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	//a file without a final newline is read whole, and the next write adds it
+	Expect(ioutil.WriteFile(testAppDir+"/ENV", []byte("# dokku-env-format: 2\nA=1\nB=2"), 0600)).To(Succeed())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("A", "1", "B", "2")))
+	Expect(env.Warnings()).To(Equal([]ParseWarning{{Line: 3, Category: ParseWarningFinalNewline, Message: "the file does not end with a newline, the next write adds it"}}))
+	Expect(env.Write()).To(Succeed())
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("# dokku-env-format: 2\nA=\"1\"\nB=\"2\"\n"))
+
+	//only files are expected to end with one
+	parsed, err := NewFromStringWithName("parsed", "A=1\nB=2")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(parsed.Warnings()).To(BeEmpty())
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//ErrDokkuRootNotSet is returned when no root was given and DOKKU_ROOT is not exported
+var ErrDokkuRootNotSet = errors.New("DOKKU_ROOT not set")
+
+//appNamePattern is what the names of apps must match, as checked by common.VerifyAppName
+var appNamePattern = regexp.MustCompile("^[a-z0-9].*")
+
+//PathResolver resolves the location of app and global ENV files
+type PathResolver struct {
+	//Root is the dokku root directory. If empty, DOKKU_ROOT is used
+	Root string
+	//File is an ENV file read in place of that of any app or the global env, see WithFile
+	File string
+	//InvalidUTF8 is what to do with values that are not valid UTF-8, see WithInvalidUTF8
+	InvalidUTF8 InvalidUTF8Policy
+}
+
+//LoadOption configures how an Env is located on disk
+type LoadOption func(*PathResolver)
+
+//WithRoot resolves env files relative to the given directory instead of DOKKU_ROOT.
+// Relocation overrides (DOKKU_ENV_DIR and the env-file-path property) are ignored
+func WithRoot(root string) LoadOption {
+	return func(r *PathResolver) {
+		r.Root = root
+	}
+}
+
+//WithFile reads the env from the given ENV file in place of that of the app or the global env, such
+// as a copy of one restored from a backup. DOKKU_ROOT is never used and the loaded Env is read-only
+func WithFile(filename string) LoadOption {
+	return func(r *PathResolver) {
+		r.File = filename
+	}
+}
+
+//NewPathResolver creates a PathResolver with the given options applied
+func NewPathResolver(opts ...LoadOption) *PathResolver {
+	r := &PathResolver{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+//DokkuRoot returns the root directory or ErrDokkuRootNotSet if it is unknown
+func (r *PathResolver) DokkuRoot() (string, error) {
+	if r.Root != "" {
+		return r.Root, nil
+	}
+	return activeHost.DokkuRoot()
+}
+
+//AppFile returns the path to the ENV file of the given app
+func (r *PathResolver) AppFile(appName string) (string, error) {
+	if r.File != "" {
+		return r.File, nil
+	}
+	root, err := r.DokkuRoot()
+	if err != nil {
+		return "", err
+	}
+	if err := verifyAppName(root, appName); err != nil {
+		return "", err
+	}
+	if r.Root == "" {
+		if envFile := getAppEnvFileProperty(appName); envFile != "" {
+			if err := validateEnvFilePath(envFile); err != nil {
+				return "", &UnsafePathError{AppName: appName, Path: envFile, Reason: err.Error()}
+			}
+			return envFile, nil
+		}
+	}
+	return appFileUnderRoot(root, appName)
+}
+
+//DefaultAppFile returns the path to the ENV file of the given app ignoring any relocation
+func (r *PathResolver) DefaultAppFile(appName string) (string, error) {
+	if r.File != "" {
+		return r.File, nil
+	}
+	root, err := r.DokkuRoot()
+	if err != nil {
+		return "", err
+	}
+	if err := verifyAppName(root, appName); err != nil {
+		return "", err
+	}
+	return appFileUnderRoot(root, appName)
+}
+
+//appFileUnderRoot returns the default path to the ENV file of an app, after checking that it is
+// inside the root. verifyAppName already refuses names that could escape it, this guards against
+// any that it lets through
+func appFileUnderRoot(root string, appName string) (string, error) {
+	filename := filepath.Join(root, appName, "ENV")
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(filename)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(absRoot, absFile); err != nil || rel != filepath.Join(appName, "ENV") {
+		return "", &UnsafePathError{AppName: appName, Path: filename, Reason: "it is not inside " + root}
+	}
+	return filename, nil
+}
+
+//validateEnvFilePath checks a value of the env-file-path property, which must be an absolute
+// path without any .. element, so that it means the same wherever it is resolved from
+func validateEnvFilePath(path string) error {
+	return validateAbsolutePath("env-file-path", path)
+}
+
+//validateAbsolutePath checks that the path given by setting is absolute, without any .. element
+// or NUL byte
+func validateAbsolutePath(setting string, path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%s must be an absolute path", setting)
+	}
+	for _, element := range strings.Split(filepath.ToSlash(path), "/") {
+		if element == ".." {
+			return fmt.Errorf("%s must not contain ..", setting)
+		}
+	}
+	if strings.ContainsRune(path, 0) {
+		return fmt.Errorf("%s must not contain a NUL byte", setting)
+	}
+	return nil
+}
+
+//GlobalFile returns the path to the global ENV file, which is in DOKKU_ENV_DIR if that is set.
+// DOKKU_ENV_DIR must be an absolute path without any .. element, as env-file-path must
+func (r *PathResolver) GlobalFile() (string, error) {
+	if r.File != "" {
+		return r.File, nil
+	}
+	root, err := r.DokkuRoot()
+	if err != nil {
+		return "", err
+	}
+	if r.Root == "" {
+		if envDir := os.Getenv("DOKKU_ENV_DIR"); envDir != "" {
+			if err := validateAbsolutePath("DOKKU_ENV_DIR", envDir); err != nil {
+				return "", &UnsafePathError{Path: envDir, Reason: err.Error()}
+			}
+			return filepath.Join(envDir, "ENV"), nil
+		}
+	}
+	return filepath.Join(root, "ENV"), nil
+}
+
+//load reads the env of the given ENV file, as a read-only snapshot if it was given with WithFile
+func (r *PathResolver) load(name string, filename string) (env *Env, err error) {
+	if r.File != "" {
+		env, err = loadSnapshot(filename)
+	} else if env, err = loadFromFile(name, filename); err == nil {
+		//the redacted snapshots are only kept for the envs of the dokku install
+		env.public = r.Root == ""
+		env.scope = scopeForName(name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return env, r.decode(name, env)
+}
+
+//decode applies the invalid-utf8 policy of the app, or of the global env, to an env loaded for it
+func (r *PathResolver) decode(name string, env *Env) error {
+	policy, err := r.invalidUTF8Policy(name)
+	if err != nil {
+		return err
+	}
+	return env.decodeInvalidUTF8(policy)
+}
+
+//getAppEnvFileProperty returns the relocated ENV file path for an app, if any.
+// Properties live under DOKKU_LIB_ROOT, so nothing is relocated when it is not set
+func getAppEnvFileProperty(appName string) string {
+	if os.Getenv("DOKKU_LIB_ROOT") == "" {
+		return ""
+	}
+	return strings.TrimSpace(common.PropertyGet("config", appName, "env-file-path"))
+}
+
+//AppNotFoundError is returned when the directory of an app does not exist
+type AppNotFoundError struct {
+	AppName string
+	Err     error
+}
+
+func (e *AppNotFoundError) Error() string {
+	return fmt.Sprintf("app %s does not exist: %v", e.AppName, e.Err)
+}
+
+//UnsafePathError is returned when an app name, the env-file-path property of an app or DOKKU_ENV_DIR
+// would have an ENV file read or written somewhere it must not be. AppName is empty for the global env
+type UnsafePathError struct {
+	AppName string
+	Path    string
+	Reason  string
+}
+
+func (e *UnsafePathError) Error() string {
+	if e.AppName == "" {
+		return fmt.Sprintf("Refusing to use %s for the global ENV file: %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("Refusing to use %s as the ENV file of %q: %s", e.Path, e.AppName, e.Reason)
+}
+
+//verifyAppName mirrors common.VerifyAppName against an explicit root. Names are also passed in by
+// triggers, so any that could point outside the root are refused before touching the filesystem
+func verifyAppName(root string, appName string) error {
+	if appName == "" {
+		return fmt.Errorf("App name must not be null")
+	}
+	if appName == "." || appName == ".." || strings.ContainsAny(appName, "/\\\x00") {
+		return &UnsafePathError{AppName: appName, Path: filepath.Join(root, appName, "ENV"), Reason: "app names cannot contain path separators"}
+	}
+	appRoot := filepath.Join(root, appName)
+	fi, err := os.Stat(appRoot)
+	if err != nil {
+		return &AppNotFoundError{AppName: appName, Err: err}
+	}
+	if !fi.IsDir() {
+		return &AppNotFoundError{AppName: appName, Err: fmt.Errorf("%s is not a directory", appRoot)}
+	}
+	if !appNamePattern.MatchString(appName) {
+		return fmt.Errorf("app name (%s) must begin with lowercase alphanumeric character", appName)
+	}
+	return nil
+}
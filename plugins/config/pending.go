@@ -0,0 +1,149 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//PendingRestart compares the merged env of an app with the one its running containers were
+// started with, as recorded by the post-deploy trigger on every deploy and restart
+type PendingRestart struct {
+	//Recorded is false if no deploy or restart of the app has been recorded, in which case whether
+	// the containers run with the current env is not known
+	Recorded bool
+	//Release is the snapshot of the last deploy or restart
+	Release int
+	//Changes are the keys added, removed and changed since
+	Changes EnvDiff
+}
+
+//Pending reports whether the env changed since the last deploy or restart
+func (p PendingRestart) Pending() bool {
+	return p.Recorded && !p.Changes.Empty()
+}
+
+//Count returns the number of keys changed since the last deploy or restart
+func (p PendingRestart) Count() int {
+	return len(p.Changes.Added) + len(p.Changes.Removed) + len(p.Changes.Changed)
+}
+
+//GetPendingRestart compares the merged env of an app with the snapshot recorded by its last
+// deploy or restart. Changes made with --no-restart are pending until the app is restarted or
+// deployed again, which records a new snapshot
+func GetPendingRestart(appName string) (pending PendingRestart, err error) {
+	dir, err := releasesDir(appName)
+	if err != nil {
+		return
+	}
+	releases, err := listReleases(dir)
+	if err != nil || len(releases) == 0 {
+		return
+	}
+	snapshot, err := LoadRelease(appName, releases[len(releases)-1])
+	if err != nil {
+		return
+	}
+	env, err := LoadMergedAppEnv(appName)
+	if err != nil {
+		return
+	}
+	pending = PendingRestart{Recorded: true, Release: snapshot.Release, Changes: EnvDiff{Added: []string{}, Removed: []string{}, Changed: []string{}}}
+	if env.Checksum() == snapshot.Checksum {
+		return
+	}
+	salt, err := releaseSalt(dir)
+	if err != nil {
+		return
+	}
+	current := make(map[string]string, env.Len())
+	for _, k := range env.sortKeys() {
+		current[k] = hashReleaseValue(salt, env.values()[k])
+	}
+	pending.Changes = diffMaps(snapshot.Keys, current)
+	return
+}
+
+//restartPendingReport returns the value config:report shows for --config-restart-pending
+func restartPendingReport(appName string) string {
+	pending, err := GetPendingRestart(appName)
+	if err != nil || !pending.Recorded {
+		return "unknown"
+	}
+	return strconv.FormatBool(pending.Pending())
+}
+
+//CommandPending implements config:pending, exiting with ExitStatusPending if the env of an app
+// changed since it was last deployed or restarted
+func CommandPending(args []string) {
+	if len(args) != 1 {
+		failInvalid("Expected: <app>")
+	}
+	appName := args[0]
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	pending, err := GetPendingRestart(appName)
+	if err != nil {
+		failWith(err)
+	}
+	if !pending.Recorded {
+		common.LogWarn(fmt.Sprintf("No deploy or restart of %s has been recorded", appName))
+		return
+	}
+	if !pending.Pending() {
+		common.LogInfo2Quiet(fmt.Sprintf("%s config unchanged since last restart", appName))
+		return
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s restart pending (%d keys changed since last restart)", appName, pending.Count()))
+	for _, k := range pending.Changes.Added {
+		common.LogVerboseQuiet(fmt.Sprintf("+ %s", k))
+	}
+	for _, k := range pending.Changes.Removed {
+		common.LogVerboseQuiet(fmt.Sprintf("- %s", k))
+	}
+	for _, k := range pending.Changes.Changed {
+		common.LogVerboseQuiet(fmt.Sprintf("~ %s", k))
+	}
+	exitWithStatus(ExitStatusPending)
+}
+
+//TriggerDeployDiff implements the config-deploy-diff trigger, with which the deploy path records
+// the keys whose config changed since the snapshot of the last deploy or restart. It writes a
+// `base <release>` line, or `base none` if no deploy or restart has been recorded, followed by an
+// `added`, `removed` or `changed` line for each key, such as `changed DATABASE_URL`. Values are
+// never written, and an app that does not exist exits with ExitCodeAppNotFound
+func TriggerDeployDiff(appName string, output io.Writer) error {
+	if _, err := NewPathResolver().AppFile(appName); err != nil {
+		if _, ok := err.(*AppNotFoundError); ok {
+			return &TriggerError{ExitCode: ExitCodeAppNotFound, Err: err}
+		}
+		return err
+	}
+	pending, err := GetPendingRestart(appName)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(output)
+	if !pending.Recorded {
+		fmt.Fprintln(w, "base none")
+		return w.Flush()
+	}
+	fmt.Fprintf(w, "base %d\n", pending.Release)
+	for _, change := range []struct {
+		kind string
+		keys []string
+	}{
+		{"added", pending.Changes.Added},
+		{"removed", pending.Changes.Removed},
+		{"changed", pending.Changes.Changed},
+	} {
+		for _, k := range change.keys {
+			fmt.Fprintf(w, "%s %s\n", change.kind, k)
+		}
+	}
+	return w.Flush()
+}
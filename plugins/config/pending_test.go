@@ -0,0 +1,81 @@
+package config
+
+import (
+	"bytes"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestGetPendingRestart(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	//nothing is known before the first deploy
+	pending, err := GetPendingRestart(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pending.Recorded).To(BeFalse())
+	Expect(pending.Pending()).To(BeFalse())
+	Expect(restartPendingReport(testAppName)).To(Equal("unknown"))
+
+	_, err = RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	pending, err = GetPendingRestart(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pending.Recorded).To(BeTrue())
+	Expect(pending.Release).To(Equal(1))
+	Expect(pending.Pending()).To(BeFalse())
+	Expect(restartPendingReport(testAppName)).To(Equal("false"))
+
+	Expect(SetMany(testAppName, pairs("testKey", "CHANGED", "newKey", "NEW"), false)).To(Succeed())
+	Expect(UnsetMany("", []string{"globalKey"}, false)).To(Succeed())
+	pending, err = GetPendingRestart(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pending.Pending()).To(BeTrue())
+	Expect(pending.Count()).To(Equal(3))
+	Expect(pending.Changes).To(Equal(EnvDiff{Added: []string{"newKey"}, Removed: []string{"globalKey"}, Changed: []string{"testKey"}}))
+	Expect(restartPendingReport(testAppName)).To(Equal("true"))
+
+	//setting a value back clears what is pending for it
+	Expect(SetMany(testAppName, pairs("testKey", "TESTING"), false)).To(Succeed())
+	pending, err = GetPendingRestart(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pending.Count()).To(Equal(2))
+
+	//the next deploy or restart records a snapshot, which clears the rest
+	_, err = RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	pending, err = GetPendingRestart(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pending.Release).To(Equal(2))
+	Expect(pending.Pending()).To(BeFalse())
+}
+
+func TestTriggerDeployDiff(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	//the first deploy has no snapshot to compare with
+	var out bytes.Buffer
+	Expect(TriggerDeployDiff(testAppName, &out)).To(Succeed())
+	Expect(out.String()).To(Equal("base none\n"))
+
+	_, err := RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	out.Reset()
+	Expect(TriggerDeployDiff(testAppName, &out)).To(Succeed())
+	Expect(out.String()).To(Equal("base 1\n"))
+
+	Expect(SetMany(testAppName, pairs("testKey", "s3cr3t", "newKey", "NEW"), false)).To(Succeed())
+	Expect(UnsetMany("", []string{"globalKey"}, false)).To(Succeed())
+	out.Reset()
+	Expect(TriggerDeployDiff(testAppName, &out)).To(Succeed())
+	Expect(out.String()).To(Equal("base 1\nadded newKey\nremoved globalKey\nchanged testKey\n"))
+	Expect(out.String()).NotTo(ContainSubstring("s3cr3t"))
+
+	out.Reset()
+	expectTriggerExitCode(TriggerDeployDiff("missing-app", &out), ExitCodeAppNotFound)
+	Expect(out.Len()).To(Equal(0))
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//pluginNamePattern matches the names of dokku plugins, which name the file of their config
+var pluginNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+//pluginConfigDir returns the ENV.d/plugins directory next to the ENV file of an app
+func pluginConfigDir(appName string) (string, error) {
+	filename, err := NewPathResolver().AppFile(appName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(filename), "ENV.d", "plugins"), nil
+}
+
+//pluginConfigFile returns the file holding the config a plugin keeps for an app
+func pluginConfigFile(appName string, pluginName string) (string, error) {
+	if !pluginNamePattern.MatchString(pluginName) {
+		return "", &ValidationError{Message: fmt.Sprintf("Invalid plugin name: '%s'", pluginName)}
+	}
+	dir, err := pluginConfigDir(appName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, pluginName), nil
+}
+
+//LoadPluginConfig loads the config a plugin keeps for an app, stored in ENV.d/plugins/<plugin>
+// next to the ENV file of the app. It holds the internal state of the plugin, which is kept out
+// of the env of the app, of its containers and of the config commands. A plugin that has not
+// stored anything yet gets an empty Env. The Env is read-only, use UpdatePluginConfig to change it
+func LoadPluginConfig(appName string, pluginName string) (*Env, error) {
+	filename, err := pluginConfigFile(appName, pluginName)
+	if err != nil {
+		return nil, err
+	}
+	env, err := loadFromFile(fmt.Sprintf("%s (%s)", appName, pluginName), filename)
+	if err != nil {
+		return nil, err
+	}
+	return env.ReadOnly(), nil
+}
+
+//UpdatePluginConfig calls fn with the config a plugin keeps for an app and writes the changes it
+// made, holding the lock of the file while it is read, modified and written. Changes are recorded
+// in the audit log next to the file, but fire no triggers and restart nothing
+func UpdatePluginConfig(appName string, pluginName string, fn func(env *Env) error) (diff EnvDiff, err error) {
+	filename, err := pluginConfigFile(appName, pluginName)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return diff, notWritableError(filepath.Dir(filename), err)
+	}
+	unlock, err := lockEnvFile(filename)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	env, err := loadFromFile(fmt.Sprintf("%s (%s)", appName, pluginName), filename)
+	if err != nil {
+		return
+	}
+	before := env.clone()
+	if err = fn(env); err != nil {
+		return
+	}
+	if diff = Diff(before, env); diff.Empty() {
+		return
+	}
+	for _, k := range diff.updated() {
+		if err = validateKey(k); err != nil {
+			return
+		}
+		if err = validateValue(k, env.values()[k]); err != nil {
+			return
+		}
+	}
+	if err = env.Write(); err != nil {
+		return
+	}
+	logAuditEntry(appName, env, diff.updated(), diff.Removed, nil, time.Now())
+	return
+}
+
+//propertyKey returns the key a config property is stored under in the plugin config of the config
+// plugin, such as ENV_COMPRESSION for env-compression
+func propertyKey(property string) string {
+	return strings.ToUpper(strings.Replace(property, "-", "_", -1))
+}
+
+//getAppProperty returns a property of an app stored in the plugin config of the config plugin
+func getAppProperty(appName string, property string) (string, bool) {
+	env, err := LoadPluginConfig(appName, "config")
+	if err != nil {
+		return "", false
+	}
+	value, ok := env.Get(propertyKey(property))
+	return strings.TrimSpace(value), ok
+}
+
+//CommandPlugin implements config:plugin, displaying the config a plugin keeps for an app
+func CommandPlugin(args []string) {
+	if len(args) < 2 {
+		failInvalid("Expected: plugin app")
+	}
+	if len(args) > 2 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", args[2:]))
+	}
+	pluginName, appName := args[0], args[1]
+	env, err := LoadPluginConfig(appName, pluginName)
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s %s config", appName, pluginName))
+	fmt.Print(terminateExport(exportOrFail(env, ExportFormatPretty, ExportOptions{}), "\n"))
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPluginConfig(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	env, err := LoadPluginConfig(testAppName, "letsencrypt")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(0))
+	Expect(env.IsReadOnly()).To(BeTrue())
+
+	diff, err := UpdatePluginConfig(testAppName, "letsencrypt", func(env *Env) error {
+		return env.Set("EMAIL", "ops@example.com")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(diff.Added).To(Equal([]string{"EMAIL"}))
+	env, err = LoadPluginConfig(testAppName, "letsencrypt")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("EMAIL", "ops@example.com")))
+	Expect(env.Set("EMAIL", "x")).To(Equal(ErrReadOnlyEnv))
+
+	//the state of the plugin is kept out of the env of the app
+	filename := filepath.Join(testAppDir, "ENV.d", "plugins", "letsencrypt")
+	_, err = os.Stat(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(GetWithDefault(testAppName, "EMAIL", "unset")).To(Equal("unset"))
+	audit, err := ioutil.ReadFile(auditLogFile(filename))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(audit)).To(ContainSubstring(`"set":["EMAIL"]`))
+
+	//each plugin has a file of its own
+	other, err := LoadPluginConfig(testAppName, "other-plugin")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(other.Len()).To(Equal(0))
+
+	_, err = UpdatePluginConfig(testAppName, "letsencrypt", func(env *Env) error {
+		env.Unset("EMAIL")
+		return env.Set("not-valid", "x")
+	})
+	Expect(err).To(MatchError("Invalid key name: 'not-valid'"))
+	Expect(GetWithDefault(testAppName, "EMAIL", "unset")).To(Equal("unset"))
+	env, err = LoadPluginConfig(testAppName, "letsencrypt")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("EMAIL", "ops@example.com")))
+
+	_, err = LoadPluginConfig(testAppName, "../config")
+	Expect(err).To(Equal(&ValidationError{Message: "Invalid plugin name: '../config'"}))
+	_, err = LoadPluginConfig(testAppName+"-missing", "letsencrypt")
+	Expect(exitStatus(err)).To(Equal(ExitStatusAppNotFound))
+}
+
+func TestAppPropertiesInPluginConfig(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	//properties set before are still read
+	Expect(common.PropertyWrite("config", testAppName, "preserve-order", "true")).To(Succeed())
+	Expect(common.PropertyWrite("config", "--global", "max-value-size", "100")).To(Succeed())
+	Expect(getConfigProperty(testAppName, "preserve-order")).To(Equal("true"))
+
+	Expect(writeAppProperty(testAppName, "preserve-order", "false")).To(Succeed())
+	Expect(getConfigProperty(testAppName, "preserve-order")).To(Equal("false"))
+	Expect(common.PropertyExists("config", testAppName, "preserve-order")).To(BeFalse())
+	env, err := LoadPluginConfig(testAppName, "config")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("PRESERVE_ORDER", "false")))
+
+	//global properties still apply to apps that don't set their own
+	Expect(getConfigProperty(testAppName, "max-value-size")).To(Equal("100"))
+	Expect(writeAppProperty(testAppName, "max-value-size", "200")).To(Succeed())
+	Expect(getConfigProperty(testAppName, "max-value-size")).To(Equal("200"))
+	Expect(writeAppProperty(testAppName, "max-value-size", "")).To(Succeed())
+	Expect(getConfigProperty(testAppName, "max-value-size")).To(Equal("100"))
+
+	//the properties are not part of the env of the app
+	Expect(GetWithDefault(testAppName, "PRESERVE_ORDER", "unset")).To(Equal("unset"))
+}
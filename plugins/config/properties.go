@@ -0,0 +1,62 @@
+package config
+
+import (
+	"os"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//getConfigProperty returns the value of a config property for an app, falling back to the
+// value set with --global. The properties of apps are kept in the plugin config of the config
+// plugin, except for env-file-path, which locates it. Those set before, as well as global ones,
+// live under DOKKU_LIB_ROOT, so only the plugin config is read when it is not set
+func getConfigProperty(appName string, property string) string {
+	if appName != "" && appName != "--global" && property != "env-file-path" {
+		if value, _ := getAppProperty(appName, property); value != "" {
+			return value
+		}
+	}
+	if os.Getenv("DOKKU_LIB_ROOT") == "" {
+		return ""
+	}
+	for _, name := range []string{appName, "--global"} {
+		if name == "" {
+			continue
+		}
+		if value := strings.TrimSpace(common.PropertyGet("config", name, property)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+//getBoolProperty returns whether a config property is set to true for an app or globally
+func getBoolProperty(appName string, property string) bool {
+	return getConfigProperty(appName, property) == "true"
+}
+
+//getListProperty returns the entries of a comma or whitespace separated config property
+func getListProperty(appName string, property string) []string {
+	return strings.FieldsFunc(getConfigProperty(appName, property), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
+
+//writeAppProperty sets a property of an app, or unsets it if value is empty, in the plugin config
+// of the config plugin, removing the value it may have had under DOKKU_LIB_ROOT
+func writeAppProperty(appName string, property string, value string) error {
+	_, err := UpdatePluginConfig(appName, "config", func(env *Env) error {
+		if value == "" {
+			return env.Unset(propertyKey(property))
+		}
+		return env.Set(propertyKey(property), value)
+	})
+	if err != nil {
+		return err
+	}
+	if common.PropertyExists("config", appName, property) {
+		return common.PropertyDelete("config", appName, property)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+//ProvenanceExternalEdit describes who changed a key whose value no longer matches the one
+// recorded when it was last set through the config plugin
+const ProvenanceExternalEdit = "unknown (external edit detected)"
+
+//KeyProvenance records the last change made to a key through the config plugin
+type KeyProvenance struct {
+	ModifiedAt time.Time `json:"modified_at"`
+	ModifiedBy string    `json:"modified_by"`
+	//Checksum is a keyed hash of the value that was set, so that edits made to the ENV file by
+	// hand can be detected without the sidecar holding the value
+	Checksum string `json:"checksum"`
+}
+
+//Provenance returns who last changed a key and when. ok is false if the key is not set, if it was
+// never changed through the config plugin, or if its value has been edited by hand since
+func (e *Env) Provenance(key string) (provenance KeyProvenance, ok bool) {
+	value, set := e.Get(key)
+	if !set {
+		return KeyProvenance{}, false
+	}
+	p := e.KeyMetadata(key).Provenance
+	if p == nil {
+		return KeyProvenance{}, false
+	}
+	salt, err := readProvenanceSalt(e.filename)
+	if err != nil || !hmac.Equal([]byte(p.Checksum), []byte(provenanceChecksum(salt, value))) {
+		return KeyProvenance{}, false
+	}
+	return *p, true
+}
+
+//describeProvenance returns the modification time and actor of a key for display
+func describeProvenance(env *Env, key string) (modifiedAt string, modifiedBy string) {
+	if p, ok := env.Provenance(key); ok {
+		return p.ModifiedAt.UTC().Format(time.RFC3339), p.ModifiedBy
+	}
+	if env.KeyMetadata(key).Provenance != nil {
+		return "-", ProvenanceExternalEdit
+	}
+	return "-", "unknown"
+}
+
+//recordProvenance stamps the given keys of env, which must hold the lock of its file, as changed
+// now by the current actor, writing the metadata sidecar
+func recordProvenance(env *Env, keys []string, now time.Time) error {
+	if env.filename == "" || len(keys) == 0 {
+		return nil
+	}
+	meta, err := env.Metadata()
+	if err != nil {
+		return err
+	}
+	salt, err := provenanceSalt(env.filename)
+	if err != nil {
+		return err
+	}
+	actor := currentActor()
+	at := now.UTC().Truncate(time.Second)
+	for _, k := range keys {
+		value, ok := env.Get(k)
+		if !ok {
+			continue
+		}
+		m := meta[k]
+		m.Provenance = &KeyProvenance{ModifiedAt: at, ModifiedBy: actor, Checksum: provenanceChecksum(salt, value)}
+		meta[k] = m
+	}
+	return writeMetadataFile(metadataFile(env.filename), meta)
+}
+
+//currentActor returns who is running the command: the name of the ssh key a remote user
+// connected with, falling back to the local user
+func currentActor() string {
+	if name := os.Getenv("SSH_NAME"); name != "" && name != "default" {
+		return name
+	}
+	for _, variable := range []string{"SSH_USER", "USER"} {
+		if user := os.Getenv(variable); user != "" {
+			return user
+		}
+	}
+	return "unknown"
+}
+
+func provenanceChecksum(salt []byte, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//provenanceSaltFile returns the path of the key used to hash the values of an ENV file
+func provenanceSaltFile(envFile string) string {
+	return envFile + ".meta.salt"
+}
+
+func readProvenanceSalt(envFile string) ([]byte, error) {
+	if envFile == "" {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.ReadFile(provenanceSaltFile(envFile))
+}
+
+//provenanceSalt returns the key used to hash the values of an ENV file, creating it on first use
+func provenanceSalt(envFile string) ([]byte, error) {
+	salt, err := readProvenanceSalt(envFile)
+	if err == nil {
+		return salt, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	salt = make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, writeFileAtomic(provenanceSaltFile(envFile), salt, 0600)
+}
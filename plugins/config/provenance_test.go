@@ -0,0 +1,84 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestProvenance(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer os.Setenv("SSH_NAME", os.Getenv("SSH_NAME"))
+	os.Setenv("SSH_NAME", "alice")
+
+	//keys written before provenance was tracked have none
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	_, ok := env.Provenance("testKey")
+	Expect(ok).To(BeFalse())
+	modifiedAt, modifiedBy := describeProvenance(env, "testKey")
+	Expect(modifiedAt).To(Equal("-"))
+	Expect(modifiedBy).To(Equal("unknown"))
+
+	start := time.Now().UTC().Truncate(time.Second)
+	Expect(SetMany(testAppName, pairs("TRACKED", "v1", "testKey", "TESTING"), false)).To(Succeed())
+	env, _ = LoadAppEnv(testAppName)
+	p, ok := env.Provenance("TRACKED")
+	Expect(ok).To(BeTrue())
+	Expect(p.ModifiedBy).To(Equal("alice"))
+	Expect(p.ModifiedAt.Before(start)).To(BeFalse())
+	//setting a key to the value it already has is not a change
+	_, ok = env.Provenance("testKey")
+	Expect(ok).To(BeFalse())
+
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV.meta.json")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("v1"))
+	Expect(env.Export(ExportFormatJSON)).NotTo(ContainSubstring("provenance"))
+
+	os.Setenv("SSH_NAME", "bob")
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		return env.Set("TRACKED", "v2")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	env, _ = LoadAppEnv(testAppName)
+	p, _ = env.Provenance("TRACKED")
+	Expect(p.ModifiedBy).To(Equal("bob"))
+
+	//a value edited by hand no longer matches the recorded checksum
+	Expect(ioutil.WriteFile(testAppDir+"/ENV", []byte("export TRACKED='edited'\nexport testKey='TESTING'\n"), 0600)).To(Succeed())
+	env, _ = LoadAppEnv(testAppName)
+	_, ok = env.Provenance("TRACKED")
+	Expect(ok).To(BeFalse())
+	modifiedAt, modifiedBy = describeProvenance(env, "TRACKED")
+	Expect(modifiedAt).To(Equal("-"))
+	Expect(modifiedBy).To(Equal(ProvenanceExternalEdit))
+
+	//unsetting the key drops its provenance
+	Expect(UnsetMany(testAppName, []string{"TRACKED"}, false)).To(Succeed())
+	env, _ = LoadAppEnv(testAppName)
+	Expect(env.KeyMetadata("TRACKED").Provenance).To(BeNil())
+}
+
+func TestCurrentActor(t *testing.T) {
+	RegisterTestingT(t)
+	for _, variable := range []string{"SSH_NAME", "SSH_USER", "USER"} {
+		defer os.Setenv(variable, os.Getenv(variable))
+	}
+	os.Setenv("SSH_NAME", "default")
+	os.Setenv("SSH_USER", "dokku")
+	os.Setenv("USER", "root")
+	Expect(currentActor()).To(Equal("dokku"))
+	os.Setenv("SSH_NAME", "alice")
+	Expect(currentActor()).To(Equal("alice"))
+	os.Setenv("SSH_NAME", "")
+	os.Setenv("SSH_USER", "")
+	Expect(currentActor()).To(Equal("root"))
+	os.Setenv("USER", "")
+	Expect(currentActor()).To(Equal("unknown"))
+}
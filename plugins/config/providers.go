@@ -0,0 +1,151 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//providerTriggerPrefix is followed by the name of a provider to make the name of the trigger that
+// computes the values of the keys given that provider
+const providerTriggerPrefix = "config-provider-"
+
+//ProviderError is returned when the trigger of a provider fails to compute the value of a key
+type ProviderError struct {
+	Provider string
+	Key      string
+	//Stderr is what the trigger printed to stderr
+	Stderr string
+}
+
+func (e *ProviderError) Error() string {
+	message := fmt.Sprintf("Provider %s failed to compute %s", e.Provider, e.Key)
+	if stderr := strings.TrimSpace(e.Stderr); stderr != "" {
+		message += ": " + stderr
+	}
+	return message
+}
+
+//SetProvider gives keys of an app, or of the global env if appName is empty, a provider computing
+// their value whenever the env of a container is resolved, rather than storing one. The keys are
+// recorded in the metadata of the env and never written to its file, so they must not be set.
+// Setting a value for a key later replaces its provider, and unsetting the key removes it
+func SetProvider(appName string, keys []string, provider string) error {
+	if !pluginNamePattern.MatchString(provider) {
+		return &ValidationError{Message: fmt.Sprintf("Invalid provider name: '%s'", provider)}
+	}
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return err
+		}
+	}
+	return withLockedEnv(appName, func(env *Env) error {
+		meta, err := env.Metadata()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if _, ok := env.Get(k); ok {
+				return &ValidationError{Message: fmt.Sprintf("%s is set, unset it before giving it a provider", k)}
+			}
+			m := meta[k]
+			m.Provider = provider
+			meta[k] = m
+		}
+		return writeMetadataFile(metadataFile(env.filename), meta)
+	})
+}
+
+//Providers returns the keys of this environment given a provider, along with the name of the
+// provider of each. Envs not bound to a file have none
+func (e *Env) Providers() map[string]string {
+	providers := map[string]string{}
+	meta, err := e.Metadata()
+	if err != nil {
+		return providers
+	}
+	for k, m := range meta {
+		if m.Provider != "" {
+			providers[k] = m.Provider
+		}
+	}
+	return providers
+}
+
+//dropProviders removes the provider of the given keys from the metadata of this env in memory,
+// returning the keys that had one and those that did not
+func (e *Env) dropProviders(keys []string) (dropped []string, rest []string) {
+	meta, err := e.Metadata()
+	if err != nil {
+		return []string{}, keys
+	}
+	dropped, rest = []string{}, []string{}
+	for _, k := range keys {
+		m, ok := meta[k]
+		if !ok || m.Provider == "" {
+			rest = append(rest, k)
+			continue
+		}
+		m.Provider = ""
+		meta[k] = m
+		dropped = append(dropped, k)
+	}
+	return dropped, rest
+}
+
+//withProvidedKeys returns a copy of the container env of an app with the values of the keys given a
+// provider, by the app or by the global env, computed by the trigger of their provider. A key set
+// by a layer taking precedence over the one that gave it a provider keeps its value
+func withProvidedKeys(env *Env, effective *EffectiveEnv, appName string, procType string) (*Env, error) {
+	providers := map[string]string{}
+	for _, layer := range effective.layers {
+		if layer.name != LayerGlobal && layer.name != LayerApp {
+			continue
+		}
+		for k, provider := range layer.env.Providers() {
+			chain := storedChain(effective.Chain(k))
+			if len(chain) > 0 && (layer.name == LayerGlobal || chain[len(chain)-1].Layer != LayerGlobal) {
+				continue
+			}
+			providers[k] = provider
+		}
+	}
+	if len(providers) == 0 {
+		return env, nil
+	}
+
+	keys := make([]string, 0, len(providers))
+	for k := range providers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	provided := env.clone()
+	for _, k := range keys {
+		value, err := computeProvidedValue(providers[k], appName, k, procType)
+		if err != nil {
+			return nil, err
+		}
+		if err := provided.Set(k, value); err != nil {
+			return nil, &ProviderError{Provider: providers[k], Key: k, Stderr: err.Error()}
+		}
+	}
+	provided.readOnly = true
+	return provided, nil
+}
+
+//computeProvidedValue fires the trigger of a provider to compute the value of a key, which is what
+// it prints to stdout without the trailing newline
+func computeProvidedValue(provider string, appName string, key string, procType string) (string, error) {
+	stdout, stderr, err := activeHost.TriggerOutput(providerTriggerPrefix+provider, appName, key, procType)
+	if err != nil {
+		return "", &ProviderError{Provider: provider, Key: key, Stderr: stderr}
+	}
+	value := strings.TrimSuffix(stdout, "\n")
+	if value == "" {
+		return "", &ProviderError{Provider: provider, Key: key, Stderr: fmt.Sprintf("no value was printed, is a plugin implementing the %s%s trigger installed?", providerTriggerPrefix, provider)}
+	}
+	if err := validateValue(key, value); err != nil {
+		return "", &ProviderError{Provider: provider, Key: key, Stderr: err.Error()}
+	}
+	return value, nil
+}
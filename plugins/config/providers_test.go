@@ -0,0 +1,108 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSetProvider(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	host := &testHost{root: dokkuRoot, provided: map[string]string{"git-rev": "abc123", "clock": "2020-01-01T00:00:00Z"}}
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	Expect(SetProvider(testAppName, []string{"RELEASE_SHA"}, "git-rev")).To(Succeed())
+	Expect(SetProvider(testAppName, []string{"testKey"}, "git-rev")).To(MatchError("testKey is set, unset it before giving it a provider"))
+	Expect(SetProvider(testAppName, []string{"OTHER"}, "Git Rev")).To(MatchError("Invalid provider name: 'Git Rev'"))
+
+	//the key is never written to the ENV file
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("RELEASE_SHA"))
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Providers()).To(Equal(pairs("RELEASE_SHA", "git-rev")))
+	_, ok := env.Get("RELEASE_SHA")
+	Expect(ok).To(BeFalse())
+
+	//its value is computed whenever the env of a container is resolved, and not for builds
+	container, err := ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()).To(Equal(pairs("testKey", "TESTING", "globalKey", "GLOBAL_VALUE", "RELEASE_SHA", "abc123")))
+	Expect(container.IsReadOnly()).To(BeTrue())
+	Expect(host.triggers).To(Equal([]string{"config-provider-git-rev " + testAppName + " RELEASE_SHA web"}))
+	build, err := ResolveSchedulerEnv(testAppName, "web", SchedulerPhaseBuild)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(build.Map()).NotTo(HaveKey("RELEASE_SHA"))
+
+	//unsetting the key removes its provider, and unsets nothing else
+	Expect(UnsetMany(testAppName, []string{"RELEASE_SHA"}, false)).To(Succeed())
+	env, err = LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Providers()).To(BeEmpty())
+	Expect(env.Map()).To(Equal(pairs("testKey", "TESTING")))
+
+	//setting a value replaces the provider
+	Expect(SetProvider(testAppName, []string{"RELEASE_SHA"}, "git-rev")).To(Succeed())
+	Expect(SetMany(testAppName, pairs("RELEASE_SHA", "pinned"), false)).To(Succeed())
+	env, err = LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Providers()).To(BeEmpty())
+	Expect(env.KeyMetadata("RELEASE_SHA").Provenance).NotTo(BeNil())
+}
+
+func TestProvidedKeysPrecedence(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	host := &testHost{root: dokkuRoot, provided: map[string]string{"clock": "2020-01-01T00:00:00Z", "git-rev": "abc123"}}
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	//a global provider applies to apps that don't set the key, an app provider to the global value
+	Expect(SetProvider("", []string{"DEPLOYED_AT", "REVISION"}, "clock")).To(Succeed())
+	defer UnsetMany("", []string{"DEPLOYED_AT", "REVISION"}, false)
+	Expect(SetMany(testAppName, pairs("DEPLOYED_AT", "stored"), false)).To(Succeed())
+	Expect(SetProvider(testAppName, []string{"globalKey"}, "git-rev")).To(Succeed())
+	container, err := ComputeContainerEnv(testAppName, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()).To(Equal(pairs(
+		"testKey", "TESTING",
+		"globalKey", "abc123",
+		"DEPLOYED_AT", "stored",
+		"REVISION", "2020-01-01T00:00:00Z",
+	)))
+
+	//a failing provider fails resolving the env with what it printed
+	Expect(SetProvider(testAppName, []string{"BROKEN"}, "missing")).To(Succeed())
+	_, err = ComputeContainerEnv(testAppName, "web")
+	Expect(err).To(Equal(&ProviderError{Provider: "missing", Key: "BROKEN", Stderr: "unknown provider\n"}))
+	Expect(err).To(MatchError("Provider missing failed to compute BROKEN: unknown provider"))
+	Expect(exitStatus(err)).To(Equal(1))
+}
+
+func TestShowProvidedKeys(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+
+	_, err := runSubcommand(host, "set", "--no-restart", "--provider", "git-rev", "web-app", "RELEASE_SHA")
+	Expect(err).NotTo(HaveOccurred())
+	output, err := runSubcommand(host, "show", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("=====> web-app env vars\nKEY:          web-app\nRELEASE_SHA:  <computed by git-rev>\n"))
+	Expect(host.triggers).To(BeEmpty())
+
+	_, err = runSubcommand(host, "set", "--provider", "git-rev", "web-app", "RELEASE_SHA=1")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--provider is given keys rather than KEY=VALUE pairs: RELEASE_SHA=1"}))
+	_, err = runSubcommand(host, "set", "--provider", "git-rev", "--ttl", "1h", "web-app", "RELEASE_SHA")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--provider cannot be combined with --stdin-pairs, --encoded, --ttl, --literal, --trim or --strip-quotes"}))
+	_, err = runSubcommand(host, "set", "--provider", "git-rev", "web-app", "KEY")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "KEY is set, unset it before giving it a provider"}))
+}
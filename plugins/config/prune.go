@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//isBlankValue reports whether a value is empty or only holds whitespace
+func isBlankValue(value string) bool {
+	return strings.TrimSpace(value) == ""
+}
+
+//blankKeys returns the sorted keys of env whose value is blank
+func blankKeys(env *Env) []string {
+	keys := []string{}
+	for _, k := range env.sortKeys() {
+		if isBlankValue(env.values()[k]) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+//PruneBlankKeys unsets the keys of an app, or of the global env if appName is empty, whose value
+// is empty or only holds whitespace. They are removed in a single Update, so the usual triggers
+// fire and the app is restarted according to policy. The removed keys are returned sorted
+func PruneBlankKeys(appName string, policy RestartPolicy) ([]string, error) {
+	diff, err := Update(appName, policy, func(env *Env) error {
+		for _, k := range blankKeys(env) {
+			if err := env.Unset(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff.Removed, nil
+}
+
+//checkRejectEmpty refuses blank values for apps with the config-reject-empty property enabled
+func checkRejectEmpty(appName string, entries map[string]string) error {
+	if !getBoolProperty(appName, "config-reject-empty") {
+		return nil
+	}
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if isBlankValue(entries[k]) {
+			return &ValidationError{Message: fmt.Sprintf("Refusing to set %s to an empty value as config-reject-empty is enabled, use config:unset to remove it", k)}
+		}
+	}
+	return nil
+}
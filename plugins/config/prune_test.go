@@ -0,0 +1,48 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+	. "github.com/onsi/gomega"
+)
+
+func TestPruneBlankKeys(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("EMPTY", "", "SPACES", " \t\n", "SET", " x "), false)).To(Succeed())
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(blankKeys(env)).To(Equal([]string{"EMPTY", "SPACES"}))
+
+	pruned, err := PruneBlankKeys(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pruned).To(Equal([]string{"EMPTY", "SPACES"}))
+	env, _ = LoadAppEnv(testAppName)
+	Expect(env.Keys()).To(Equal([]string{"SET", "testKey"}))
+
+	pruned, err = PruneBlankKeys(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(pruned).To(BeEmpty())
+}
+
+func TestRejectEmpty(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(SetMany(testAppName, pairs("EMPTY", ""), false)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "config-reject-empty", "true")).To(Succeed())
+	Expect(SetMany(testAppName, pairs("OK", "1", "EMPTY", ""), false)).To(MatchError("Refusing to set EMPTY to an empty value as config-reject-empty is enabled, use config:unset to remove it"))
+	Expect(SetMany(testAppName, pairs("SPACES", "  "), false)).To(HaveOccurred())
+	_, ok := Get(testAppName, "OK")
+	Expect(ok).To(BeFalse())
+	Expect(SetMany(testAppName, pairs("OK", "1"), false)).To(Succeed())
+
+	//the global env has its own setting
+	Expect(SetMany("", pairs("GLOBAL_EMPTY", ""), false)).To(Succeed())
+	Expect(UnsetMany("", []string{"GLOBAL_EMPTY"}, false)).To(Succeed())
+}
@@ -0,0 +1,181 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//redactedSnapshotSuffix is appended to the default path of the ENV file of an app, or of the global
+// env, to make the name of its redacted snapshot
+const redactedSnapshotSuffix = ".redacted"
+
+//RedactedSnapshot is what the ENV.redacted file of an app, or of the global env, holds while the
+// redacted-public-group property is set: the keys of the env and a checksum of each value, keyed
+// with the salt of the ENV file as provenance checksums are, so that values cannot be guessed from
+// them. It is readable by the members of the group, and has no field that could hold a value
+type RedactedSnapshot struct {
+	Name        string            `json:"name"`
+	Group       string            `json:"group"`
+	RefreshedAt time.Time         `json:"refreshed_at"`
+	Checksums   map[string]string `json:"checksums"`
+}
+
+//redactedSnapshotFile returns where the redacted snapshot of an app, or of the global env if
+// appName is empty, is kept. It is next to the default location of the ENV file even if the file
+// is relocated, as the env-file-path property is not readable by the users the snapshot is for
+func redactedSnapshotFile(appName string) (string, error) {
+	resolver := NewPathResolver()
+	if appName == "" {
+		filename, err := resolver.GlobalFile()
+		return filename + redactedSnapshotSuffix, err
+	}
+	filename, err := resolver.DefaultAppFile(appName)
+	return filename + redactedSnapshotSuffix, err
+}
+
+//refreshRedactedSnapshot rewrites the redacted snapshot of an app, or of the global env if appName
+// is empty, from env, which must have been loaded for it. Nothing is written unless the
+// redacted-public-group property is set
+func refreshRedactedSnapshot(appName string, env *Env) error {
+	if err := env.checkScope(appName); err != nil {
+		return err
+	}
+	group := getConfigProperty("--global", "redacted-public-group")
+	if group == "" {
+		return nil
+	}
+	found, err := user.LookupGroup(group)
+	if err != nil {
+		return err
+	}
+	gid, err := strconv.Atoi(found.Gid)
+	if err != nil {
+		return err
+	}
+	filename, err := redactedSnapshotFile(appName)
+	if err != nil {
+		return err
+	}
+	salt, err := provenanceSalt(env.filename)
+	if err != nil {
+		return err
+	}
+
+	snapshot := RedactedSnapshot{
+		Name:        env.name,
+		Group:       group,
+		RefreshedAt: time.Now().UTC(),
+		Checksums:   make(map[string]string, len(env.values())),
+	}
+	for k, v := range env.values() {
+		snapshot.Checksums[k] = provenanceChecksum(salt, v)
+	}
+	contents, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileSafe(filename, append(contents, '\n'), writeOptions{mode: 0640, resetMode: true, noFollow: true}); err != nil {
+		return err
+	}
+	return os.Chown(filename, -1, gid)
+}
+
+//refreshWrittenSnapshot refreshes the redacted snapshot of an env Write has just written, warning
+// if it cannot, as the snapshot must not keep an env from being changed
+func refreshWrittenSnapshot(env *Env) {
+	appName := env.name
+	if appName == "<global>" {
+		appName = ""
+	}
+	if err := refreshRedactedSnapshot(appName, env); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to refresh the redacted snapshot of %s: %s", env.name, err.Error()))
+	}
+}
+
+//applyRedactedPublicGroup writes the redacted snapshots of the global env and of every app after
+// the redacted-public-group property is set, or removes them once it is unset
+func applyRedactedPublicGroup() error {
+	//no apps is not an error here
+	apps, _ := activeHost.Apps()
+	for _, appName := range append([]string{""}, apps...) {
+		if getConfigProperty("--global", "redacted-public-group") == "" {
+			filename, err := redactedSnapshotFile(appName)
+			if err != nil {
+				return err
+			}
+			if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		env, err := loadAppOrGlobalEnv(appName)
+		if err != nil {
+			return err
+		}
+		if err := refreshRedactedSnapshot(appName, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//LoadRedactedSnapshot reads the redacted snapshot of an app, or of the global env if appName is
+// empty. It is meant for users who are not the dokku user, and reads neither the ENV file nor any
+// property. Only the owner of the snapshot, root and members of the group of the file may read it
+func LoadRedactedSnapshot(appName string) (snapshot RedactedSnapshot, err error) {
+	filename, err := redactedSnapshotFile(appName)
+	if err != nil {
+		return
+	}
+	info, err := os.Stat(filename)
+	if os.IsNotExist(err) {
+		return snapshot, fmt.Errorf("There is no redacted snapshot of %s, it is written once the redacted-public-group property is set", Target{AppName: appName}.Label())
+	}
+	if err != nil {
+		return
+	}
+	if err = checkRedactedReader(filename, info); err != nil {
+		return
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(contents, &snapshot)
+	return
+}
+
+//checkRedactedReader fails unless the current user is root, owns the snapshot or is a member of
+// its group, whatever the mode of the file allows
+func checkRedactedReader(filename string, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fmt.Errorf("Unable to read the owner of %s", filename)
+	}
+	uid := os.Getuid()
+	if uid == 0 || uint32(uid) == stat.Uid {
+		return nil
+	}
+	current, err := user.Current()
+	if err != nil {
+		return err
+	}
+	groups, err := current.GroupIds()
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if g == strconv.FormatUint(uint64(stat.Gid), 10) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not in the group allowed to read %s", current.Username, filename)
+}
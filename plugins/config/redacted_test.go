@@ -0,0 +1,95 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRedactedSnapshot(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	current, err := user.Current()
+	Expect(err).NotTo(HaveOccurred())
+	group, err := user.LookupGroupId(current.Gid)
+	Expect(err).NotTo(HaveOccurred())
+	filename := testAppDir + "/ENV.redacted"
+
+	//nothing is written until the group is set
+	Expect(SetMany(testAppName, pairs("SECRET", "hunter2"), false)).To(Succeed())
+	_, err = os.Stat(filename)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	_, err = LoadRedactedSnapshot(testAppName)
+	Expect(err).To(MatchError("There is no redacted snapshot of " + testAppName + ", it is written once the redacted-public-group property is set"))
+
+	Expect(common.PropertyWrite("config", "--global", "redacted-public-group", group.Name)).To(Succeed())
+	Expect(applyRedactedPublicGroup()).To(Succeed())
+	info, err := os.Stat(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(info.Mode().Perm()).To(Equal(os.FileMode(0640)))
+	snapshot, err := LoadRedactedSnapshot(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(snapshot.Name).To(Equal(testAppName))
+	Expect(snapshot.Group).To(Equal(group.Name))
+	Expect(snapshot.Checksums).To(HaveLen(2))
+	Expect(snapshot.Checksums).To(HaveKey("SECRET"))
+	global, err := LoadRedactedSnapshot("")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Checksums).To(HaveKey("globalKey"))
+
+	//the snapshot never holds a value, and follows every write
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("hunter2"))
+	Expect(string(contents)).NotTo(ContainSubstring("TESTING"))
+	previous := snapshot.Checksums["SECRET"]
+	Expect(SetMany(testAppName, pairs("SECRET", "hunter3"), false)).To(Succeed())
+	snapshot, err = LoadRedactedSnapshot(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(snapshot.Checksums["SECRET"]).NotTo(Equal(previous))
+	Expect(UnsetMany(testAppName, []string{"SECRET"}, false)).To(Succeed())
+	snapshot, err = LoadRedactedSnapshot(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(snapshot.Checksums).NotTo(HaveKey("SECRET"))
+
+	//unsetting the group removes the snapshots
+	Expect(common.PropertyDelete("config", "--global", "redacted-public-group")).To(Succeed())
+	Expect(applyRedactedPublicGroup()).To(Succeed())
+	_, err = os.Stat(filename)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestShowRedactedSnapshot(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	defer setupTestProperties()()
+	current, err := user.Current()
+	Expect(err).NotTo(HaveOccurred())
+	group, err := user.LookupGroupId(current.Gid)
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(common.PropertyWrite("config", "--global", "redacted-public-group", group.Name)).To(Succeed())
+	_, err = runSubcommand(host, "set", "--no-restart", "web-app", "KEY=rotated")
+	Expect(err).NotTo(HaveOccurred())
+
+	output, err := runSubcommand(host, "show", "--redacted-public", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	lines := strings.Split(output, "\n")
+	Expect(lines).To(HaveLen(3))
+	Expect(lines[0]).To(HavePrefix("=====> web-app redacted env vars as of "))
+	Expect(lines[1]).To(HavePrefix("KEY:  "))
+	Expect(strings.TrimPrefix(lines[1], "KEY:  ")).To(HaveLen(64))
+	Expect(output).NotTo(ContainSubstring("rotated"))
+
+	_, err = runSubcommand(host, "show", "--redacted-public", "--merged", "web-app")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--redacted-public cannot be combined with --shell, --export, --merged, --provenance, --warnings-as-errors or --file"}))
+}
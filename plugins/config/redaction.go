@@ -0,0 +1,156 @@
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+const (
+	//RedactionModeRaw delivers the secret values themselves
+	RedactionModeRaw = "raw"
+	//RedactionModeSHA256 delivers the hex encoded sha256 digest of each secret value
+	RedactionModeSHA256 = "sha256"
+)
+
+//minRedactedValueLength is the length below which values are not worth scrubbing, as they
+// would match all over the output of an app
+const minRedactedValueLength = 6
+
+//redactionCacheFile returns the path of the sidecar caching the redaction patterns of an ENV file
+func redactionCacheFile(envFile string) string {
+	return envFile + ".redaction"
+}
+
+//redactionValues returns the values an app sees for keys that are sensitive by name or tagged
+// secret, longest first so that consumers scrub values containing shorter ones first
+func redactionValues(appName string) ([]string, error) {
+	app, err := LoadAppEnv(appName)
+	if err != nil {
+		return nil, err
+	}
+	global, err := LoadGlobalEnv()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	unique := map[string]bool{}
+	for _, env := range []*Env{app, global} {
+		for _, k := range env.sortKeys() {
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			v := env.values()[k]
+			if len(v) >= minRedactedValueLength && (IsSensitiveKey(k) || env.KeyMetadata(k).HasTag(TagSecret)) {
+				unique[v] = true
+			}
+		}
+	}
+	values := make([]string, 0, len(unique))
+	for v := range unique {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		if len(values[i]) != len(values[j]) {
+			return len(values[i]) > len(values[j])
+		}
+		return values[i] < values[j]
+	})
+	return values, nil
+}
+
+//RedactionPatterns returns the values that consumers should scrub from the output of an app,
+// or nothing if redaction is not enabled for it. The values are cached next to the ENV file of
+// the app until the config changes
+func RedactionPatterns(appName string) ([]string, error) {
+	if !getBoolProperty(appName, "redaction") {
+		return []string{}, nil
+	}
+	filename, err := NewPathResolver().AppFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	cache := redactionCacheFile(filename)
+	if contents, err := ioutil.ReadFile(cache); err == nil {
+		values := []string{}
+		for _, v := range bytes.Split(contents, []byte{0}) {
+			if len(v) > 0 {
+				values = append(values, string(v))
+			}
+		}
+		return values, nil
+	}
+
+	values, err := redactionValues(appName)
+	if err != nil {
+		return nil, err
+	}
+	var contents bytes.Buffer
+	for _, v := range values {
+		contents.WriteString(v)
+		contents.WriteByte(0)
+	}
+	if err := writeFileAtomic(cache, contents.Bytes(), 0600); err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to cache redaction patterns: %s", err.Error()))
+	}
+	return values, nil
+}
+
+//invalidateRedactionPatterns removes the cached redaction patterns of an app, or of all apps if
+// appName is empty or --global
+func invalidateRedactionPatterns(appName string) {
+	apps := []string{appName}
+	if appName == "" || appName == "--global" {
+		apps, _ = activeHost.Apps()
+	}
+	for _, app := range apps {
+		filename, err := NewPathResolver().AppFile(app)
+		if err != nil {
+			continue
+		}
+		if err := os.Remove(redactionCacheFile(filename)); err != nil && !os.IsNotExist(err) {
+			common.LogWarn(fmt.Sprintf("Unable to remove cached redaction patterns of %s: %s", app, err.Error()))
+		}
+	}
+}
+
+//TriggerGetRedactionPatterns implements the config-get-redaction-patterns trigger by writing the
+// redaction patterns of an app to output as NUL terminated records, either raw or as sha256 digests
+func TriggerGetRedactionPatterns(appName string, mode string, output io.Writer) error {
+	if mode == "" {
+		mode = RedactionModeRaw
+	}
+	if mode != RedactionModeRaw && mode != RedactionModeSHA256 {
+		return fmt.Errorf("Unknown redaction mode %s, expected %s or %s", mode, RedactionModeRaw, RedactionModeSHA256)
+	}
+	if err := activeHost.VerifyApp(appName); err != nil {
+		return err
+	}
+	values, err := RedactionPatterns(appName)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		if mode == RedactionModeSHA256 {
+			sum := sha256.Sum256([]byte(v))
+			v = hex.EncodeToString(sum[:])
+		}
+		if _, err := fmt.Fprintf(output, "%s\x00", v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//TriggerPostConfigUpdate implements the post-config-update trigger of the config plugin itself
+func TriggerPostConfigUpdate(appName string) {
+	invalidateRedactionPatterns(appName)
+}
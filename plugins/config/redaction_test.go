@@ -0,0 +1,72 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+	. "github.com/onsi/gomega"
+)
+
+func TestRedactionPatterns(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	Expect(SetMany(testAppName, pairs("API_TOKEN", "token-value", "DATABASE_PASSWORD", "pw", "SIGNING_SEED", "a-much-longer-seed", "PLAIN", "not-a-secret"), false)).To(Succeed())
+	Expect(SetMany("", pairs("GLOBAL_SECRET", "global-secret-value"), false)).To(Succeed())
+	Expect(Annotate(testAppName, "SIGNING_SEED", nil, []string{TagSecret}, nil)).To(Succeed())
+
+	values, err := RedactionPatterns(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(values).To(BeEmpty())
+
+	Expect(common.PropertyWrite("config", testAppName, "redaction", "true")).To(Succeed())
+	values, err = RedactionPatterns(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(values).To(Equal([]string{"global-secret-value", "a-much-longer-seed", "token-value"}))
+	cache := redactionCacheFile(testAppDir + "/ENV")
+	info, err := os.Stat(cache)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+	//the cache is used until the config changes
+	Expect(SetMany(testAppName, pairs("API_TOKEN", "rotated-token"), false)).To(Succeed())
+	values, err = RedactionPatterns(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(values).To(ContainElement("token-value"))
+	TriggerPostConfigUpdate(testAppName)
+	values, err = RedactionPatterns(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(values).To(Equal([]string{"global-secret-value", "a-much-longer-seed", "rotated-token"}))
+
+	Expect(Annotate(testAppName, "SIGNING_SEED", nil, nil, []string{TagSecret})).To(Succeed())
+	values, err = RedactionPatterns(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(values).To(Equal([]string{"global-secret-value", "rotated-token"}))
+
+	TriggerPostConfigUpdate("--global")
+	_, err = os.Stat(cache)
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestTriggerGetRedactionPatterns(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	Expect(SetMany(testAppName, pairs("API_TOKEN", "token-value"), false)).To(Succeed())
+	Expect(common.PropertyWrite("config", "--global", "redaction", "true")).To(Succeed())
+
+	var out bytes.Buffer
+	Expect(TriggerGetRedactionPatterns(testAppName, "", &out)).To(Succeed())
+	Expect(out.String()).To(Equal("token-value\x00"))
+
+	out.Reset()
+	Expect(TriggerGetRedactionPatterns(testAppName, RedactionModeSHA256, &out)).To(Succeed())
+	Expect(out.String()).To(Equal("e6c02a5742ea9d4de588eb9b9de7bed43dc17011552186bed3e98b2c5958ff4a\x00"))
+
+	Expect(TriggerGetRedactionPatterns(testAppName, "md5", &out)).To(MatchError("Unknown redaction mode md5, expected raw or sha256"))
+	Expect(TriggerGetRedactionPatterns(testAppName+"-missing", "", &out)).NotTo(Succeed())
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//appReferencePrefix starts a value that links to the value of a key of another app,
+// written as @app:<app>:<KEY>
+const appReferencePrefix = "@app:"
+
+//ReferenceStep is a key followed while resolving a value that references another app
+type ReferenceStep struct {
+	App   string
+	Key   string
+	Value string
+}
+
+//parseAppReference returns the app and key a value of the form @app:<app>:<KEY> links to
+func parseAppReference(value string) (appName string, key string, ok bool) {
+	if !strings.HasPrefix(value, appReferencePrefix) {
+		return "", "", false
+	}
+	parts := strings.SplitN(strings.TrimPrefix(value, appReferencePrefix), ":", 2)
+	if len(parts) != 2 || parts[0] == "" || validateKey(parts[1]) != nil {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+//referenceResolver follows references, loading the env of each referenced app once
+type referenceResolver struct {
+	envs map[string]*Env
+}
+
+func newReferenceResolver() *referenceResolver {
+	return &referenceResolver{envs: map[string]*Env{}}
+}
+
+//chain follows the value of a key of an app through the references it links to, returning each
+// step with the last one holding the resolved value
+func (r *referenceResolver) chain(appName string, key string, value string) ([]ReferenceStep, error) {
+	steps := []ReferenceStep{{App: appName, Key: key, Value: value}}
+	seen := map[string]bool{appName + ":" + key: true}
+	for {
+		target, targetKey, ok := parseAppReference(value)
+		if !ok {
+			return steps, nil
+		}
+		if seen[target+":"+targetKey] {
+			links := make([]string, len(steps))
+			for i, step := range steps {
+				links[i] = step.App + ":" + step.Key
+			}
+			return nil, fmt.Errorf("Unable to resolve %s of %s, references form a cycle: %s -> %s:%s", key, appName, strings.Join(links, " -> "), target, targetKey)
+		}
+		seen[target+":"+targetKey] = true
+
+		env, err := r.load(target)
+		if err != nil {
+			if _, notFound := err.(*AppNotFoundError); notFound {
+				return nil, fmt.Errorf("Unable to resolve %s of %s, app %s does not exist", key, appName, target)
+			}
+			return nil, err
+		}
+		if value, ok = env.Get(targetKey); !ok {
+			return nil, fmt.Errorf("Unable to resolve %s of %s, %s is not set for %s", key, appName, targetKey, target)
+		}
+		steps = append(steps, ReferenceStep{App: target, Key: targetKey, Value: value})
+	}
+}
+
+func (r *referenceResolver) load(appName string) (*Env, error) {
+	if env, ok := r.envs[appName]; ok {
+		return env, nil
+	}
+	env, err := LoadMergedAppEnv(appName)
+	if err != nil {
+		return nil, err
+	}
+	r.envs[appName] = env
+	return env, nil
+}
+
+//ResolveReferences returns a copy of this Env in which every value that references another app,
+// written as @app:<app>:<KEY>, is replaced with the value it links to. The referenced key is
+// looked up in the env of that app merged with the global env, and may itself be a reference.
+// The copy is read-only and not bound to the file of this Env
+func (e *Env) ResolveReferences() (*Env, error) {
+	resolved := e.clone()
+	resolved.filename = ""
+	resolver := newReferenceResolver()
+	for _, k := range e.sortKeys() {
+		if _, _, ok := parseAppReference(e.values()[k]); !ok {
+			continue
+		}
+		steps, err := resolver.chain(e.name, k, e.values()[k])
+		if err != nil {
+			return nil, err
+		}
+		resolved.values()[k] = steps[len(steps)-1].Value
+	}
+	resolved.readOnly = true
+	return resolved, nil
+}
+
+//ResolveReference returns the steps followed to resolve the value of a key of an app, or of the
+// global env if appName is empty. A value that is not a reference is a single step
+func ResolveReference(appName string, key string) ([]ReferenceStep, error) {
+	var env *Env
+	var err error
+	if appName == "" {
+		env, err = LoadGlobalEnv()
+	} else {
+		env, err = LoadMergedAppEnv(appName)
+	}
+	if err != nil {
+		return nil, err
+	}
+	value, ok := env.Get(key)
+	if !ok {
+		return nil, fmt.Errorf("%s is not set for %s", key, env.name)
+	}
+	return newReferenceResolver().chain(env.name, key, value)
+}
+
+//validateReferences checks that the values that reference other apps can be resolved
+func validateReferences(appName string, values map[string]string) error {
+	name := appName
+	if name == "" {
+		name = "<global>"
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	resolver := newReferenceResolver()
+	for _, k := range keys {
+		if _, _, ok := parseAppReference(values[k]); !ok {
+			continue
+		}
+		if _, err := resolver.chain(name, k, values[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+const referencedAppName = "test-app-referenced"
+
+func setupReferencedApp(values map[string]string) {
+	Expect(os.MkdirAll(strings.Join([]string{dokkuRoot, referencedAppName}, "/"), 0766)).To(Succeed())
+	Expect(SetMany(referencedAppName, values, false)).To(Succeed())
+}
+
+func teardownReferencedApp() {
+	os.RemoveAll(strings.Join([]string{dokkuRoot, referencedAppName}, "/"))
+}
+
+func TestParseAppReference(t *testing.T) {
+	RegisterTestingT(t)
+	appName, key, ok := parseAppReference("@app:primary-app:DATABASE_URL")
+	Expect(ok).To(BeTrue())
+	Expect(appName).To(Equal("primary-app"))
+	Expect(key).To(Equal("DATABASE_URL"))
+
+	for _, value := range []string{"", "postgres://db", "@app:", "@app:primary-app", "@app::KEY", "@app:primary-app:-bad", "app:primary-app:KEY"} {
+		_, _, ok := parseAppReference(value)
+		Expect(ok).To(BeFalse(), value)
+	}
+}
+
+func TestResolveReferences(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	setupReferencedApp(map[string]string{"DATABASE_URL": "postgres://db", "ALIAS": "@app:test-app-1:testKey"})
+	defer teardownReferencedApp()
+	Expect(SetMany(testAppName, pairs("DATABASE_URL", "@app:test-app-referenced:DATABASE_URL", "GLOBAL", "@app:test-app-referenced:globalKey"), false)).To(Succeed())
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	resolved, err := env.ResolveReferences()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(resolved.Map()).To(Equal(pairs("DATABASE_URL", "postgres://db", "GLOBAL", "GLOBAL_VALUE", "testKey", "TESTING")))
+	Expect(env.GetDefault("DATABASE_URL", "")).To(Equal("@app:test-app-referenced:DATABASE_URL"))
+	Expect(resolved.Write()).NotTo(Succeed())
+
+	steps, err := ResolveReference(referencedAppName, "ALIAS")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(steps).To(Equal([]ReferenceStep{
+		{App: referencedAppName, Key: "ALIAS", Value: "@app:test-app-1:testKey"},
+		{App: testAppName, Key: "testKey", Value: "TESTING"},
+	}))
+
+	steps, err = ResolveReference(testAppName, "testKey")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(steps).To(HaveLen(1))
+	_, err = ResolveReference(testAppName, "MISSING")
+	Expect(err).To(MatchError("MISSING is not set for test-app-1"))
+}
+
+func TestResolveReferencesErrors(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	setupReferencedApp(map[string]string{"LOOP": "@app:test-app-1:LOOP"})
+	defer teardownReferencedApp()
+
+	Expect(SetMany(testAppName, pairs("LOOP", "@app:test-app-referenced:LOOP"), false)).To(Succeed())
+	_, err := ResolveReference(testAppName, "LOOP")
+	Expect(err).To(MatchError("Unable to resolve LOOP of test-app-1, references form a cycle: test-app-1:LOOP -> test-app-referenced:LOOP -> test-app-1:LOOP"))
+
+	Expect(SetMany(testAppName, pairs("SELF", "@app:test-app-1:SELF"), false)).To(Succeed())
+	_, err = ResolveReference(testAppName, "SELF")
+	Expect(err).To(MatchError("Unable to resolve SELF of test-app-1, references form a cycle: test-app-1:SELF -> test-app-1:SELF"))
+
+	Expect(validateReferences(testAppName, pairs("DB", "@app:test-app-missing:DATABASE_URL"))).To(MatchError("Unable to resolve DB of test-app-1, app test-app-missing does not exist"))
+	Expect(validateReferences("", pairs("DB", "@app:test-app-referenced:DATABASE_URL"))).To(MatchError("Unable to resolve DB of <global>, DATABASE_URL is not set for test-app-referenced"))
+	Expect(validateReferences(testAppName, pairs("DB", "postgres://db", "ALIAS", "@app:test-app-referenced:LOOP"))).NotTo(Succeed())
+	Expect(validateReferences(testAppName, pairs("DB", "postgres://db", "OTHER", "@app:test-app-1:testKey"))).To(Succeed())
+
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = env.ResolveReferences()
+	Expect(err).To(HaveOccurred())
+}
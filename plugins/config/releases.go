@@ -0,0 +1,184 @@
+package config
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//DefaultReleaseRetention is the number of release snapshots kept when config-history-limit is unset
+const DefaultReleaseRetention = 10
+
+//ReleaseSnapshot records the environment a release was deployed with. Values are not stored,
+// only a keyed hash of each of them, so that snapshots can be compared but not read back
+type ReleaseSnapshot struct {
+	Release   int               `json:"release"`
+	CreatedAt time.Time         `json:"created_at"`
+	ImageTag  string            `json:"image_tag,omitempty"`
+	Checksum  string            `json:"checksum"`
+	Keys      map[string]string `json:"keys"`
+}
+
+//Checksum returns a sha256 of the keys and values of this environment, independent of how
+// the environment is stored
+func (e *Env) Checksum() string {
+	h := sha256.New()
+	for _, k := range e.sortKeys() {
+		h.Write([]byte(k))
+		h.Write([]byte{0})
+		h.Write([]byte(e.values()[k]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+//RecordRelease snapshots the merged environment of an app as the next release and prunes
+// snapshots beyond the config-history-limit property
+func RecordRelease(appName string, imageTag string) (snapshot ReleaseSnapshot, err error) {
+	dir, err := releasesDir(appName)
+	if err != nil {
+		return
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	unlock, err := lockEnvFile(filepath.Join(dir, "releases"))
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	env, err := LoadMergedAppEnv(appName)
+	if err != nil {
+		return
+	}
+	salt, err := releaseSalt(dir)
+	if err != nil {
+		return
+	}
+	releases, err := listReleases(dir)
+	if err != nil {
+		return
+	}
+
+	snapshot = ReleaseSnapshot{
+		Release:   1,
+		CreatedAt: time.Now().UTC(),
+		ImageTag:  imageTag,
+		Checksum:  env.Checksum(),
+		Keys:      make(map[string]string, env.Len()),
+	}
+	if len(releases) > 0 {
+		snapshot.Release = releases[len(releases)-1] + 1
+	}
+	for _, k := range env.sortKeys() {
+		snapshot.Keys[k] = hashReleaseValue(salt, env.values()[k])
+	}
+
+	contents, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return
+	}
+	if err = writeFileAtomic(releaseFile(dir, snapshot.Release), append(contents, '\n'), 0600); err != nil {
+		return
+	}
+
+	_, err = pruneReleases(dir, append(releases, snapshot.Release), historyLimit(appName))
+	return
+}
+
+//LoadRelease reads the snapshot of a release of an app
+func LoadRelease(appName string, release int) (snapshot ReleaseSnapshot, err error) {
+	dir, err := releasesDir(appName)
+	if err != nil {
+		return
+	}
+	contents, err := ioutil.ReadFile(releaseFile(dir, release))
+	if os.IsNotExist(err) {
+		releases, _ := listReleases(dir)
+		available := make([]string, len(releases))
+		for i, r := range releases {
+			available[i] = strconv.Itoa(r)
+		}
+		if len(available) == 0 {
+			return snapshot, fmt.Errorf("Release %d not found, no releases of %s have been recorded", release, appName)
+		}
+		return snapshot, fmt.Errorf("Release %d not found, available releases: %s", release, strings.Join(available, ", "))
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(contents, &snapshot)
+	return
+}
+
+//DiffReleases returns the keys added, removed and changed going from one snapshot to another
+func DiffReleases(from ReleaseSnapshot, to ReleaseSnapshot) EnvDiff {
+	return diffMaps(from.Keys, to.Keys)
+}
+
+//hashReleaseValue returns the keyed hash a snapshot holds in place of a value
+func hashReleaseValue(salt []byte, value string) string {
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//releasesDir returns the ENV.d/releases directory next to the ENV file of an app
+func releasesDir(appName string) (string, error) {
+	filename, err := NewPathResolver().AppFile(appName)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(filename), "ENV.d", "releases"), nil
+}
+
+func releaseFile(dir string, release int) string {
+	return filepath.Join(dir, fmt.Sprintf("%d.json", release))
+}
+
+//listReleases returns the recorded release numbers in ascending order
+func listReleases(dir string) ([]int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	releases := []int{}
+	for _, f := range files {
+		if release, err := strconv.Atoi(strings.TrimSuffix(f.Name(), ".json")); err == nil && strings.HasSuffix(f.Name(), ".json") {
+			releases = append(releases, release)
+		}
+	}
+	sort.Ints(releases)
+	return releases, nil
+}
+
+//releaseSalt returns the per-app key used to hash values, creating it on first use
+func releaseSalt(dir string) ([]byte, error) {
+	filename := filepath.Join(dir, ".salt")
+	salt, err := ioutil.ReadFile(filename)
+	if err == nil {
+		return salt, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+	salt = make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, writeFileAtomic(filename, salt, 0600)
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestRecordRelease(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	first, err := RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(first.Release).To(Equal(1))
+	Expect(first.Keys).To(HaveLen(2))
+
+	Expect(SetMany(testAppName, pairs("testKey", "CHANGED", "newKey", "NEW"), false)).To(Succeed())
+	Expect(UnsetMany("", []string{"globalKey"}, false)).To(Succeed())
+	second, err := RecordRelease(testAppName, "latest")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(second.Release).To(Equal(2))
+	Expect(second.Checksum).NotTo(Equal(first.Checksum))
+
+	//snapshots never hold values
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV.d/releases/2.json")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("CHANGED"))
+
+	loaded, err := LoadRelease(testAppName, 1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(loaded.Keys).To(Equal(first.Keys))
+	diff := DiffReleases(loaded, second)
+	Expect(diff).To(Equal(EnvDiff{Added: []string{"newKey"}, Removed: []string{"globalKey"}, Changed: []string{"testKey"}}))
+	Expect(DiffReleases(second, second).Empty()).To(BeTrue())
+
+	_, err = LoadRelease(testAppName, 7)
+	Expect(err).To(MatchError("Release 7 not found, available releases: 1, 2"))
+
+	Expect(common.PropertyWrite("config", testAppName, "release-retention", "2")).To(Succeed())
+	third, err := RecordRelease(testAppName, "v3")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(third.Release).To(Equal(3))
+	Expect(DiffReleases(second, third).Empty()).To(BeTrue())
+	_, err = os.Stat(testAppDir + "/ENV.d/releases/1.json")
+	Expect(os.IsNotExist(err)).To(BeTrue())
+}
+
+func TestChecksum(t *testing.T) {
+	RegisterTestingT(t)
+	a := NewForTest(t, pairs("A", "1", "B", "2"))
+	b := NewForTest(t, pairs("B", "2", "A", "1"))
+	Expect(a.Checksum()).To(Equal(b.Checksum()))
+	Expect(a.Checksum()).To(HaveLen(64))
+
+	//the separator keeps keys and values from being ambiguous
+	c := NewForTest(t, pairs("A", "12"))
+	d := NewForTest(t, pairs("A1", "2"))
+	Expect(c.Checksum()).NotTo(Equal(d.Checksum()))
+}
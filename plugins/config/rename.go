@@ -0,0 +1,183 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//TriggerPostAppCloneSetup implements the post-app-clone-setup trigger. The apps plugin has copied
+// the app dir by then, this copies what the config plugin keeps outside of it, see CopyAppConfig
+func TriggerPostAppCloneSetup(oldAppName string, newAppName string) error {
+	return CopyAppConfig(oldAppName, newAppName, false)
+}
+
+//TriggerPostAppRenameSetup implements the post-app-rename-setup trigger, which runs before the old
+// app is destroyed along with its properties, see CopyAppConfig
+func TriggerPostAppRenameSetup(oldAppName string, newAppName string) error {
+	return CopyAppConfig(oldAppName, newAppName, true)
+}
+
+//CopyAppConfig gives an app copied from another one the config of the app it was copied from. The
+// ENV file and its sidecars under DOKKU_ROOT travel with the app dir, which the apps plugin copies
+// itself, so this copies the config properties and an ENV file relocated with env-file-path, which
+// is copied along with its sidecars and releases to the same path with the name of the app
+// replaced. A relocated file whose path does not hold the name of the app is kept as is when the
+// app is renamed, and copied back to the app dir when it is cloned. Finally, the values the app got
+// from the template env are rendered again for the new name, see rewriteTemplateValues, and sealed
+// values are sealed again for it, see rewrapSealedValues
+func CopyAppConfig(oldAppName string, newAppName string, rename bool) error {
+	resolver := NewPathResolver()
+	oldFile, err := resolver.AppFile(oldAppName)
+	if err != nil {
+		return err
+	}
+	if err := common.PropertyClone("config", oldAppName, newAppName); err != nil {
+		return err
+	}
+
+	if getAppEnvFileProperty(oldAppName) != "" {
+		newFile, moved := replaceAppNameInPath(oldFile, oldAppName, newAppName)
+		if !moved && !rename {
+			if newFile, err = resolver.DefaultAppFile(newAppName); err != nil {
+				return err
+			}
+		}
+		if newFile != oldFile {
+			if moved {
+				if err := validateEnvFilePath(newFile); err != nil {
+					return &UnsafePathError{AppName: newAppName, Path: newFile, Reason: err.Error()}
+				}
+			}
+			//the app dir holds a leftover copy of the file the old app had before it was relocated
+			if err := copyEnvFiles(oldFile, newFile, !moved); err != nil {
+				return err
+			}
+			if moved {
+				err = common.PropertyWrite("config", newAppName, "env-file-path", newFile)
+			} else {
+				err = common.PropertyDelete("config", newAppName, "env-file-path")
+			}
+			if err != nil {
+				return err
+			}
+			common.LogVerboseQuiet(fmt.Sprintf("Copied %s to %s, %s has been left in place", oldFile, newFile, oldFile))
+		}
+	}
+
+	rewritten, err := rewriteTemplateValues(oldAppName, newAppName)
+	if err != nil {
+		return err
+	}
+	if len(rewritten) > 0 {
+		common.LogVerboseQuiet(fmt.Sprintf("Rendered config template for %s: %s", newAppName, strings.Join(rewritten, ", ")))
+	}
+	diff, err := Update(newAppName, RestartPolicyNever, func(env *Env) error {
+		return rewrapSealedValues(newAppName, env)
+	})
+	if err != nil {
+		return err
+	}
+	if len(diff.Changed) > 0 {
+		common.LogVerboseQuiet(fmt.Sprintf("Sealed values again for %s: %s", newAppName, strings.Join(diff.Changed, ", ")))
+	}
+	return nil
+}
+
+//replaceAppNameInPath replaces every element of a path that is the name of an app with another,
+// reporting whether there was any
+func replaceAppNameInPath(path string, oldAppName string, newAppName string) (string, bool) {
+	elements := strings.Split(path, string(filepath.Separator))
+	replaced := false
+	for i, element := range elements {
+		if element == oldAppName {
+			elements[i] = newAppName
+			replaced = true
+		}
+	}
+	return strings.Join(elements, string(filepath.Separator)), replaced
+}
+
+//copyEnvFiles copies an ENV file in whichever form it is stored in, its key metadata, and the
+// release snapshots and plugin configs next to it. Existing files are only replaced if replace is set
+func copyEnvFiles(oldFile string, newFile string, replace bool) error {
+	copies := map[string]string{
+		metadataFile(oldFile):       metadataFile(newFile),
+		provenanceSaltFile(oldFile): provenanceSaltFile(newFile),
+	}
+	if path, compressed := envFileOnDisk(oldFile); compressed {
+		copies[path] = compressedFile(newFile)
+	} else {
+		copies[path] = newFile
+	}
+	if oldDir, newDir := filepath.Dir(oldFile), filepath.Dir(newFile); oldDir != newDir {
+		for _, sub := range []string{"releases", "plugins"} {
+			oldSub := filepath.Join(oldDir, "ENV.d", sub)
+			files, err := ioutil.ReadDir(oldSub)
+			if err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			for _, f := range files {
+				if f.Mode().IsRegular() {
+					copies[filepath.Join(oldSub, f.Name())] = filepath.Join(newDir, "ENV.d", sub, f.Name())
+				}
+			}
+		}
+	}
+
+	for from, to := range copies {
+		contents, err := ioutil.ReadFile(from)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to read %s: %s", from, err.Error())
+		}
+		if err := os.MkdirAll(filepath.Dir(to), 0700); err != nil {
+			return fmt.Errorf("Unable to create %s: %s", filepath.Dir(to), err.Error())
+		}
+		if err := writeFileSafe(to, contents, writeOptions{mode: 0600, noClobber: !replace}); os.IsExist(err) {
+			return fmt.Errorf("Refusing to overwrite existing file %s", to)
+		} else if err != nil {
+			return fmt.Errorf("Unable to write %s: %s", to, err.Error())
+		}
+	}
+	return nil
+}
+
+//rewriteTemplateValues renders the values of the template env holding {{ for a new app, in place
+// of those rendered for the app it was copied from. Values that were changed since they were
+// rendered are kept. The keys that were rewritten are returned sorted
+func rewriteTemplateValues(oldAppName string, newAppName string) ([]string, error) {
+	tmpl, err := LoadTemplateEnv()
+	if err != nil {
+		return nil, err
+	}
+	diff, err := Update(newAppName, RestartPolicyNever, func(env *Env) error {
+		for _, k := range tmpl.sortKeys() {
+			value, ok := env.Get(k)
+			if !ok || !strings.Contains(tmpl.values()[k], "{{") {
+				continue
+			}
+			rendered, err := renderTemplateValue(k, tmpl.values()[k], oldAppName)
+			if err != nil || rendered != value {
+				continue
+			}
+			if rendered, err = renderTemplateValue(k, tmpl.values()[k], newAppName); err != nil {
+				return err
+			}
+			if err := env.Set(k, rendered); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff.Changed, nil
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+	. "github.com/onsi/gomega"
+)
+
+const copiedAppName = "test-app-2"
+
+//setupCopiedApp creates the app dir of copiedAppName holding a copy of the ENV file of the test app,
+// as apps:rename and apps:clone do before their setup triggers run
+func setupCopiedApp() (teardown func()) {
+	copiedAppDir := filepath.Join(dokkuRoot, copiedAppName)
+	Expect(os.MkdirAll(copiedAppDir, 0766)).To(Succeed())
+	contents, err := ioutil.ReadFile(filepath.Join(testAppDir, "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(copiedAppDir, "ENV"), contents, 0644)).To(Succeed())
+	return func() {
+		os.RemoveAll(copiedAppDir)
+	}
+}
+
+//setupTemplatedApp applies a template to the test app and changes one of the keys it got from it
+func setupTemplatedApp() (teardown func()) {
+	templateFile, err := NewPathResolver().TemplateFile()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(UpdateTemplate(func(env *Env) error {
+		env.Set("SENTRY_ENVIRONMENT", "{{ .AppName }}")
+		env.Set("LOG_LEVEL", "info")
+		return env.Set("DATABASE_NAME", "{{ .AppName }}_production")
+	})).To(Succeed())
+	_, err = ApplyTemplate(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(SetMany(testAppName, pairs("DATABASE_NAME", "shared_production"), false)).To(Succeed())
+	return func() {
+		os.Remove(templateFile)
+	}
+}
+
+func TestCopyAppConfigRename(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	defer setupTemplatedApp()()
+	secureDir, err := ioutil.TempDir("", "dokku-secure")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(secureDir)
+
+	oldFile := filepath.Join(secureDir, testAppName, "ENV")
+	Expect(MigrateAppEnvFile(testAppName, oldFile)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "env-file-path", oldFile)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "release-retention", "5")).To(Succeed())
+	description := "the sentry environment"
+	Expect(Annotate(testAppName, "SENTRY_ENVIRONMENT", &description, nil, nil)).To(Succeed())
+	Expect(SetMany(testAppName, pairs("testKey", "relocated"), false)).To(Succeed())
+	_, err = RecordRelease(testAppName, "dokku/test-app-1:latest")
+	Expect(err).NotTo(HaveOccurred())
+	defer setupCopiedApp()()
+
+	Expect(TriggerPostAppRenameSetup(testAppName, copiedAppName)).To(Succeed())
+
+	newFile := filepath.Join(secureDir, copiedAppName, "ENV")
+	Expect(common.PropertyGet("config", copiedAppName, "env-file-path")).To(Equal(newFile))
+	Expect(common.PropertyGet("config", copiedAppName, "release-retention")).To(Equal("5"))
+	for _, copied := range []string{newFile, metadataFile(newFile), provenanceSaltFile(newFile), filepath.Join(secureDir, copiedAppName, "ENV.d", "releases", "1.json")} {
+		_, err := os.Stat(copied)
+		Expect(err).NotTo(HaveOccurred(), copied)
+	}
+
+	env, err := LoadAppEnv(copiedAppName)
+	Expect(err).NotTo(HaveOccurred())
+	//the value that was changed after the template was applied is kept
+	Expect(env.Map()).To(Equal(pairs("testKey", "relocated", "SENTRY_ENVIRONMENT", copiedAppName, "LOG_LEVEL", "info", "DATABASE_NAME", "shared_production")))
+	Expect(env.KeyMetadata("SENTRY_ENVIRONMENT").Description).To(Equal(description))
+	release, err := LoadRelease(copiedAppName, 1)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(release.ImageTag).To(Equal("dokku/test-app-1:latest"))
+
+	//the file of the old app is left in place
+	expectValue(testAppName, "SENTRY_ENVIRONMENT", testAppName)
+
+	//a file at a path without the app name is kept by the renamed app
+	Expect(common.PropertyWrite("config", testAppName, "env-file-path", filepath.Join(secureDir, "shared.env"))).To(Succeed())
+	Expect(TriggerPostAppRenameSetup(testAppName, copiedAppName)).To(Succeed())
+	Expect(common.PropertyGet("config", copiedAppName, "env-file-path")).To(Equal(filepath.Join(secureDir, "shared.env")))
+}
+
+func TestCopyAppConfigClone(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	defer setupTemplatedApp()()
+	secureDir, err := ioutil.TempDir("", "dokku-secure")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(secureDir)
+	defer setupCopiedApp()()
+
+	//the ENV file is relocated to a path without the app name after the app dir was copied, so that
+	// the copy is stale
+	oldFile := filepath.Join(secureDir, "origin.env")
+	Expect(MigrateAppEnvFile(testAppName, oldFile)).To(Succeed())
+	Expect(common.PropertyWrite("config", testAppName, "env-file-path", oldFile)).To(Succeed())
+	Expect(SetMany(testAppName, pairs("testKey", "relocated"), false)).To(Succeed())
+
+	Expect(TriggerPostAppCloneSetup(testAppName, copiedAppName)).To(Succeed())
+
+	//the clone is given its own file in its app dir
+	Expect(common.PropertyExists("config", copiedAppName, "env-file-path")).To(BeFalse())
+	newFile, err := NewPathResolver().AppFile(copiedAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(newFile).To(Equal(filepath.Join(dokkuRoot, copiedAppName, "ENV")))
+	expectValue(copiedAppName, "testKey", "relocated")
+	expectValue(copiedAppName, "SENTRY_ENVIRONMENT", copiedAppName)
+	expectValue(copiedAppName, "DATABASE_NAME", "shared_production")
+
+	//both apps are left with a file of their own
+	Expect(SetMany(copiedAppName, pairs("testKey", "cloned"), false)).To(Succeed())
+	expectValue(testAppName, "testKey", "relocated")
+	expectValue(testAppName, "SENTRY_ENVIRONMENT", testAppName)
+}
+
+func TestReplaceAppNameInPath(t *testing.T) {
+	RegisterTestingT(t)
+	for path, expected := range map[string]string{
+		"/secure/old/ENV":      "/secure/new/ENV",
+		"/old/apps/old/ENV":    "/new/apps/new/ENV",
+		"/secure/old-app/ENV":  "/secure/old-app/ENV",
+		"/secure/old.env":      "/secure/old.env",
+		"/secure/apps/ENV.old": "/secure/apps/ENV.old",
+	} {
+		replaced, ok := replaceAppNameInPath(path, "old", "new")
+		Expect(replaced).To(Equal(expected), path)
+		Expect(ok).To(Equal(path != expected), path)
+	}
+}
@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//Formats config:report can print a report in
+const (
+	reportFormatStdout = "stdout"
+	reportFormatJSON   = "json"
+)
+
+//reportInfoFlags returns the information config:report shows about the config of an app, keyed
+// by the flag that extracts it. Only figures about the config are reported, never its values
+func reportInfoFlags(appName string) (map[string]string, error) {
+	env, err := LoadAppEnv(appName)
+	if err != nil {
+		return nil, err
+	}
+	global, err := LoadGlobalEnv()
+	if err != nil {
+		return nil, err
+	}
+	_, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	locked, err := envFileLocked(filename)
+	if err != nil {
+		return nil, err
+	}
+	filename, _ = envFileOnDisk(filename)
+	return map[string]string{
+		"--config-checksum":              env.Checksum(),
+		"--config-env-file":              filename,
+		"--config-format-version":        strconv.Itoa(env.FormatVersion()),
+		"--config-global-format-version": strconv.Itoa(global.FormatVersion()),
+		"--config-key-count":             strconv.Itoa(env.Len()),
+		"--config-locked":                strconv.FormatBool(locked),
+		"--config-restart-pending":       restartPendingReport(appName),
+		"--config-restart-policy":        string(GetRestartPolicy(appName)),
+		"--config-size":                  strconv.Itoa(env.Size()),
+	}, nil
+}
+
+//reportJSON returns the info flags as a json object, with their names lacking the leading dashes
+func reportJSON(infoFlags map[string]string) ([]byte, error) {
+	values := make(map[string]string, len(infoFlags))
+	for k, v := range infoFlags {
+		values[strings.TrimPrefix(k, "--")] = v
+	}
+	return json.Marshal(values)
+}
+
+//ReportSingleApp displays the config report of an app, or only the value of infoFlag if set
+func ReportSingleApp(appName string, infoFlag string, format string) {
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	infoFlags, err := reportInfoFlags(appName)
+	if err != nil {
+		failWith(err)
+	}
+
+	flags := make([]string, 0, len(infoFlags))
+	for k := range infoFlags {
+		flags = append(flags, k)
+	}
+	sort.Strings(flags)
+
+	if infoFlag != "" {
+		value, ok := infoFlags[infoFlag]
+		if !ok {
+			failInvalid(fmt.Sprintf("Invalid flag passed, valid flags: %s", strings.Join(flags, ", ")))
+		}
+		fmt.Println(value)
+		return
+	}
+
+	if format == reportFormatJSON {
+		b, err := reportJSON(infoFlags)
+		if err != nil {
+			failWith(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+
+	common.LogInfo2Quiet(fmt.Sprintf("%s config information", appName))
+	for _, k := range flags {
+		key := common.UcFirst(strings.Replace(strings.TrimPrefix(k, "--"), "-", " ", -1))
+		common.LogVerbose(fmt.Sprintf("%-31s%s", key+":", infoFlags[k]))
+	}
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestReportInfoFlags(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("SECRET_KEY", "hunter2"), false)).To(Succeed())
+
+	infoFlags, err := reportInfoFlags(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(infoFlags).To(Equal(map[string]string{
+		"--config-checksum":              env.Checksum(),
+		"--config-env-file":              testAppDir + "/ENV",
+		"--config-format-version":        "1",
+		"--config-global-format-version": "1",
+		"--config-key-count":             "2",
+		"--config-locked":                "false",
+		"--config-restart-pending":       "unknown",
+		"--config-restart-policy":        "always",
+		"--config-size":                  strconv.Itoa(env.Size()),
+	}))
+	for _, value := range infoFlags {
+		Expect(value).NotTo(ContainSubstring("hunter2"))
+		Expect(value).NotTo(ContainSubstring("TESTING"))
+	}
+
+	b, err := reportJSON(infoFlags)
+	Expect(err).NotTo(HaveOccurred())
+	var decoded map[string]string
+	Expect(json.Unmarshal(b, &decoded)).To(Succeed())
+	Expect(decoded["config-key-count"]).To(Equal("2"))
+	Expect(decoded).To(HaveLen(len(infoFlags)))
+
+	_, err = reportInfoFlags(testAppName + "-missing")
+	Expect(err).To(HaveOccurred())
+}
+
+func TestEnvFileLocked(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	filename := strings.Join([]string{testAppDir, "ENV"}, "/")
+
+	locked, err := envFileLocked(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(locked).To(BeFalse())
+
+	unlock, err := lockEnvFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	locked, err = envFileLocked(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(locked).To(BeTrue())
+	infoFlags, err := reportInfoFlags(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(infoFlags["--config-locked"]).To(Equal("true"))
+
+	unlock()
+	locked, err = envFileLocked(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(locked).To(BeFalse())
+}
+
+func TestCommandReportWithoutApps(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost()
+	defer teardown()
+
+	output, err := runSubcommand(host, "report", "--format", "json")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("{}\n"))
+	output, err = runSubcommand(host, "report")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring(ErrNoApps.Error()))
+
+	//apps that cannot be listed are not reported as no apps
+	host.root = filepath.Join(host.root, "missing")
+	output, err = runSubcommand(host, "report", "--format", "json")
+	Expect(err).To(HaveOccurred())
+	Expect(err.(*SubcommandError).Code).To(Equal(1))
+	Expect(output).To(BeEmpty())
+}
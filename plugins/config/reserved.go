@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//reservedKeysTrigger is fired with the app as argument, or --global, to list the keys that plugins
+// set in the env of containers themselves. Each line printed is a key followed by an explanation of
+// which plugin sets it and whether a value from the config takes precedence
+const reservedKeysTrigger = "config-reserved-runtime-keys"
+
+//ReservedKey is a key that a plugin sets in the env of containers at run time
+type ReservedKey struct {
+	Key string
+	//Explanation names the plugin setting the key and which value containers end up with
+	Explanation string
+}
+
+func (r ReservedKey) String() string {
+	if r.Explanation == "" {
+		return fmt.Sprintf("%s is also set by dokku at run time", r.Key)
+	}
+	return fmt.Sprintf("%s is also set by dokku at run time: %s", r.Key, r.Explanation)
+}
+
+//parseReservedKeys reads the output of config-reserved-runtime-keys, taking the first word of each
+// line as the key and the rest as its explanation. A key listed more than once, by several plugins,
+// has their explanations joined. Blank lines and lines starting with # are skipped
+func parseReservedKeys(output string) []ReservedKey {
+	explanations := map[string][]string{}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if validateKey(fields[0]) != nil {
+			continue
+		}
+		explanation := ""
+		if len(fields) == 2 {
+			explanation = strings.TrimSpace(fields[1])
+		}
+		explanations[fields[0]] = append(explanations[fields[0]], explanation)
+	}
+	reserved := []ReservedKey{}
+	for k, parts := range explanations {
+		reserved = append(reserved, ReservedKey{Key: k, Explanation: strings.Join(nonEmpty(parts), "; ")})
+	}
+	sort.Slice(reserved, func(i, j int) bool {
+		return reserved[i].Key < reserved[j].Key
+	})
+	return reserved
+}
+
+func nonEmpty(values []string) []string {
+	kept := []string{}
+	for _, v := range values {
+		if v != "" {
+			kept = append(kept, v)
+		}
+	}
+	return kept
+}
+
+//reservedRuntimeKeys returns the keys that plugins set in the env of the containers of an app,
+// or of every app if appName is empty, warning and returning none if the trigger fails
+func reservedRuntimeKeys(appName string) []ReservedKey {
+	if appName == "" {
+		appName = "--global"
+	}
+	output, err := activeHost.TriggerInput("", reservedKeysTrigger, appName)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to list the keys set by plugins at run time: %s", err.Error()))
+		return []ReservedKey{}
+	}
+	return parseReservedKeys(output)
+}
+
+//FindReservedKeys returns the reserved keys among the given keys, sorted
+func FindReservedKeys(keys []string, reserved []ReservedKey) []ReservedKey {
+	given := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		given[k] = true
+	}
+	found := []ReservedKey{}
+	for _, r := range reserved {
+		if given[r.Key] {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+//checkReservedKeys warns about any of the given keys that plugins set at run time, or fails if the
+// strict-reserved-keys property is enabled
+func checkReservedKeys(appName string, keys []string, quiet bool) error {
+	found := FindReservedKeys(keys, reservedRuntimeKeys(appName))
+	if len(found) == 0 {
+		return nil
+	}
+	if getBoolProperty(appName, "strict-reserved-keys") {
+		for _, r := range found {
+			common.LogWarn(r.String())
+		}
+		names := make([]string, len(found))
+		for i, r := range found {
+			names[i] = r.Key
+		}
+		return &ValidationError{Message: fmt.Sprintf("Refusing to set %s as strict-reserved-keys is enabled", strings.Join(names, ", "))}
+	}
+	if !quiet {
+		for _, r := range found {
+			common.LogWarn(r.String())
+		}
+	}
+	return nil
+}
+
+//CheckReservedKeys reports keys that plugins also set in the env of containers at run time
+func CheckReservedKeys(env *Env, reserved []ReservedKey) []Finding {
+	findings := []Finding{}
+	for _, r := range FindReservedKeys(env.sortKeys(), reserved) {
+		findings = append(findings, Finding{
+			Check:    "reserved-runtime-key",
+			Severity: SeverityWarning,
+			Key:      r.Key,
+			Message:  r.String(),
+		})
+	}
+	return findings
+}
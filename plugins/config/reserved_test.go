@@ -0,0 +1,90 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+const testReservedOutput = "PORT set by scheduler-docker-local for web containers\n\n# comment\nDYNO set by scheduler-docker-local\nDYNO set by another-scheduler\nnot-a-key ignored\nTRACE\n"
+
+func TestParseReservedKeys(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(parseReservedKeys(testReservedOutput)).To(Equal([]ReservedKey{
+		{Key: "DYNO", Explanation: "set by scheduler-docker-local; set by another-scheduler"},
+		{Key: "PORT", Explanation: "set by scheduler-docker-local for web containers"},
+		{Key: "TRACE"},
+	}))
+	Expect(parseReservedKeys("")).To(BeEmpty())
+
+	Expect(ReservedKey{Key: "PORT", Explanation: "set by a scheduler"}.String()).To(Equal("PORT is also set by dokku at run time: set by a scheduler"))
+	Expect(ReservedKey{Key: "TRACE"}.String()).To(Equal("TRACE is also set by dokku at run time"))
+
+	found := FindReservedKeys([]string{"TRACE", "OTHER", "PORT"}, parseReservedKeys(testReservedOutput))
+	Expect(found).To(HaveLen(2))
+	Expect(found[0].Key).To(Equal("PORT"))
+	Expect(found[1].Key).To(Equal("TRACE"))
+
+	findings := CheckReservedKeys(NewForTest(t, pairs("PORT", "5000", "OTHER", "1")), parseReservedKeys(testReservedOutput))
+	Expect(findings).To(Equal([]Finding{{
+		Check:    "reserved-runtime-key",
+		Severity: SeverityWarning,
+		Key:      "PORT",
+		Message:  "PORT is also set by dokku at run time: set by scheduler-docker-local for web containers",
+	}}))
+}
+
+func TestRunSubcommandSetReservedKeys(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupTestProperties()()
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	host.reserved = testReservedOutput
+
+	//setting a reserved key only warns by default
+	_, err := runSubcommand(host, "set", "--no-restart", "web-app", "PORT=5000")
+	Expect(err).NotTo(HaveOccurred())
+
+	Expect(common.PropertyWrite("config", "web-app", "strict-reserved-keys", "true")).To(Succeed())
+	_, err = runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "DYNO=web.1", "TRACE=true", "OTHER=1")
+	Expect(err).To(MatchError("Refusing to set DYNO, TRACE as strict-reserved-keys is enabled"))
+	env, err := loadFromFile("web-app", filepath.Join(host.root, "web-app", "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("KEY", "web-app", "PORT", "5000")))
+
+	//the global env is checked against its own property
+	_, err = runSubcommand(host, "set", "--no-restart", "--global", "DYNO=web.1")
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func TestLintReservedKeys(t *testing.T) {
+	RegisterTestingT(t)
+	defer setupTestProperties()()
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	host.reserved = testReservedOutput
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	findings := lintReservedKeys("web-app", "export KEY='web-app'\nexport PORT='5000'\n")
+	Expect(findings).To(HaveLen(1))
+	Expect(findings[0].Key).To(Equal("PORT"))
+	Expect(findings[0].Line).To(Equal(2))
+	Expect(lintReservedKeys("--global", "")).To(BeEmpty())
+
+	//existing offenders are errors once strict-reserved-keys is enabled
+	_, err := runSubcommand(host, "set", "--no-restart", "web-app", "PORT=5000")
+	Expect(err).NotTo(HaveOccurred())
+	findings, err = Lint("web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(findings).To(HaveLen(1))
+	Expect(findings[0].Severity).To(Equal(SeverityWarning))
+	Expect(common.PropertyWrite("config", "web-app", "strict-reserved-keys", "true")).To(Succeed())
+	findings, err = Lint("web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(findings[0].Severity).To(Equal(SeverityError))
+}
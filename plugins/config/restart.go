@@ -0,0 +1,328 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+var (
+	scopePatternRegexp = regexp.MustCompile(`^[a-zA-Z_*?][a-zA-Z0-9_*?]*$`)
+	processTypeRegexp  = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+//RestartScope maps the keys matching a glob pattern to the process types that read them
+type RestartScope struct {
+	Pattern      string
+	ProcessTypes []string
+}
+
+func (s RestartScope) String() string {
+	return fmt.Sprintf("%s=%s", s.Pattern, strings.Join(s.ProcessTypes, ","))
+}
+
+//Matches reports whether a key falls under this scope
+func (s RestartScope) Matches(key string) bool {
+	matched, err := path.Match(s.Pattern, key)
+	return err == nil && matched
+}
+
+//RestartPlan is the outcome of resolving changed keys against the restart scopes of an app
+type RestartPlan struct {
+	//ProcessTypes to restart, sorted. Empty means the whole app is restarted
+	ProcessTypes []string
+	//Unscoped lists the changed keys that no scope matched
+	Unscoped []string
+	//Scoped maps each scoped key to the process types it resolved to
+	Scoped map[string][]string
+}
+
+//Full reports whether every process type of the app has to be restarted
+func (p RestartPlan) Full() bool {
+	return len(p.ProcessTypes) == 0
+}
+
+//PlanRestart resolves changed keys to the process types they are scoped to. The whole app is
+// restarted if no key changed, or if any changed key is not matched by a scope
+func PlanRestart(scopes []RestartScope, keys []string) RestartPlan {
+	plan := RestartPlan{Unscoped: []string{}, Scoped: map[string][]string{}}
+	types := map[string]bool{}
+	for _, k := range keys {
+		matched := false
+		for _, scope := range scopes {
+			if !scope.Matches(k) {
+				continue
+			}
+			matched = true
+			for _, processType := range scope.ProcessTypes {
+				types[processType] = true
+				plan.Scoped[k] = appendUnique(plan.Scoped[k], processType)
+			}
+		}
+		if !matched {
+			plan.Unscoped = append(plan.Unscoped, k)
+		}
+	}
+	sort.Strings(plan.Unscoped)
+	if len(keys) == 0 || len(plan.Unscoped) > 0 {
+		return plan
+	}
+	for processType := range types {
+		plan.ProcessTypes = append(plan.ProcessTypes, processType)
+	}
+	sort.Strings(plan.ProcessTypes)
+	return plan
+}
+
+//GetRestartScopes returns the restart scopes of an app in the order they were added
+func GetRestartScopes(appName string) ([]RestartScope, error) {
+	scopes := []RestartScope{}
+	if os.Getenv("DOKKU_LIB_ROOT") == "" {
+		return scopes, nil
+	}
+	lines, err := common.PropertyListGet("config", appName, "restart-scope")
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		scope, err := parseRestartScope(line)
+		if err != nil {
+			return nil, err
+		}
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+//SetRestartScope scopes the keys matching pattern to the given process types, replacing any
+// existing scope for the same pattern
+func SetRestartScope(appName string, pattern string, processTypes []string) error {
+	scope := RestartScope{Pattern: pattern, ProcessTypes: processTypes}
+	if err := validateRestartScope(scope); err != nil {
+		return err
+	}
+	scopes, err := GetRestartScopes(appName)
+	if err != nil {
+		return err
+	}
+	for i, existing := range scopes {
+		if existing.Pattern == pattern {
+			return common.PropertyListSet("config", appName, "restart-scope", scope.String(), i)
+		}
+	}
+	return common.PropertyListAdd("config", appName, "restart-scope", scope.String(), 0)
+}
+
+//UnsetRestartScope removes the scope for a pattern, after which its keys restart the whole app again
+func UnsetRestartScope(appName string, pattern string) error {
+	scopes, err := GetRestartScopes(appName)
+	if err != nil {
+		return err
+	}
+	for _, existing := range scopes {
+		if existing.Pattern == pattern {
+			return common.PropertyListRemove("config", appName, "restart-scope", existing.String())
+		}
+	}
+	return fmt.Errorf("No restart scope set for %s", pattern)
+}
+
+func parseRestartScope(line string) (RestartScope, error) {
+	parts := strings.SplitN(strings.TrimSpace(line), "=", 2)
+	if len(parts) != 2 {
+		return RestartScope{}, &ValidationError{Message: fmt.Sprintf("Invalid restart scope: '%s'", line)}
+	}
+	scope := RestartScope{Pattern: parts[0], ProcessTypes: strings.Split(parts[1], ",")}
+	return scope, validateRestartScope(scope)
+}
+
+func validateRestartScope(scope RestartScope) error {
+	if !scopePatternRegexp.MatchString(scope.Pattern) {
+		return &ValidationError{Message: fmt.Sprintf("Invalid key pattern: '%s'", scope.Pattern)}
+	}
+	if len(scope.ProcessTypes) == 0 {
+		return fmt.Errorf("No process types specified for %s", scope.Pattern)
+	}
+	for _, processType := range scope.ProcessTypes {
+		if !processTypeRegexp.MatchString(processType) {
+			return &ValidationError{Message: fmt.Sprintf("Invalid process type: '%s'", processType)}
+		}
+	}
+	return nil
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+//RestartPolicy decides whether changing the config of an app restarts it
+type RestartPolicy string
+
+const (
+	//RestartPolicyAlways restarts the app after every change, even one that sets a key to its current value
+	RestartPolicyAlways RestartPolicy = "always"
+	//RestartPolicyNever never restarts the app
+	RestartPolicyNever RestartPolicy = "never"
+	//RestartPolicyOnChange restarts the app only if the environment it sees has changed
+	RestartPolicyOnChange RestartPolicy = "on-change"
+)
+
+//GetRestartPolicy returns the config-restart-policy property of an app, falling back to the
+// global property and then to RestartPolicyAlways
+func GetRestartPolicy(appName string) RestartPolicy {
+	policy := RestartPolicy(getConfigProperty(appName, "config-restart-policy"))
+	if validateRestartPolicy(policy) != nil {
+		return RestartPolicyAlways
+	}
+	return policy
+}
+
+//resolveRestartPolicy returns the policy a command applies, where the --restart and --no-restart
+// flags override the config-restart-policy property, along with a description of the decision.
+// The description is empty when neither the flags nor the property are set
+func resolveRestartPolicy(appName string, restart bool, noRestart bool) (RestartPolicy, string, error) {
+	switch {
+	case restart && noRestart:
+		return "", "", errors.New("--restart and --no-restart cannot be combined")
+	case restart:
+		return RestartPolicyAlways, "Restarting as --restart was given", nil
+	case noRestart:
+		return RestartPolicyNever, "Not restarting as --no-restart was given", nil
+	}
+	if appName == "" || getConfigProperty(appName, "config-restart-policy") == "" {
+		return RestartPolicyAlways, "", nil
+	}
+	policy := GetRestartPolicy(appName)
+	switch policy {
+	case RestartPolicyNever:
+		return policy, "Not restarting as config-restart-policy is never", nil
+	case RestartPolicyOnChange:
+		return policy, "Restarting only if the environment changes as config-restart-policy is on-change", nil
+	default:
+		return policy, "Restarting as config-restart-policy is always", nil
+	}
+}
+
+//Statuses of the restart recorded in the audit log along with a change
+const (
+	RestartStatusRestarted = "restarted"
+	RestartStatusFailed    = "failed"
+	RestartStatusSkipped   = "skipped"
+)
+
+//RestartError is returned when an app fails to restart after its env changed. The change was
+// written before the restart, and is kept
+type RestartError struct {
+	AppName string
+	//ProcessTypes that were restarted, or empty if the whole app was
+	ProcessTypes []string
+	Duration     time.Duration
+	Err          error
+}
+
+func (e *RestartError) Error() string {
+	return fmt.Sprintf("Restarting %s failed after %s: %s", restartLabel(e.AppName, e.ProcessTypes), formatRestartDuration(e.Duration), e.Err.Error())
+}
+
+//restartLabel names what is restarted of an app in messages
+func restartLabel(appName string, processTypes []string) string {
+	if len(processTypes) == 0 {
+		return appName
+	}
+	return fmt.Sprintf("process types %s of %s", strings.Join(processTypes, ", "), appName)
+}
+
+//formatRestartDuration rounds how long a restart took to hundredths of a second
+func formatRestartDuration(d time.Duration) string {
+	return d.Round(10 * time.Millisecond).String()
+}
+
+//newAuditRestart returns the audit log record of a restart that ran from startedAt to finishedAt
+// and failed with err, if it is not nil
+func newAuditRestart(processTypes []string, startedAt time.Time, finishedAt time.Time, err error) AuditRestart {
+	startedAt, finishedAt = startedAt.UTC(), finishedAt.UTC()
+	restart := AuditRestart{Status: RestartStatusRestarted, ProcessTypes: processTypes, StartedAt: &startedAt, FinishedAt: &finishedAt}
+	if err != nil {
+		restart.Status, restart.Error = RestartStatusFailed, err.Error()
+	}
+	return restart
+}
+
+//skippedRestart returns the restart recorded along with a change of an app that is not restarted
+// after it, as policy is RestartPolicyNever or DOKKU_APP_RESTORE is off, or nil if it may be. The
+// global env is not restarted, so nothing is recorded for it
+func skippedRestart(appName string, env *Env, policy RestartPolicy) *AuditRestart {
+	if appName == "" || appName == "--global" {
+		return nil
+	}
+	if policy != RestartPolicyNever && env.GetBoolDefault("DOKKU_APP_RESTORE", true) {
+		return nil
+	}
+	return &AuditRestart{Status: RestartStatusSkipped}
+}
+
+//logRestartEntry appends a restart to the audit log of an app while holding the lock of its ENV
+// file, warning if it cannot be recorded
+func logRestartEntry(appName string, restart AuditRestart) {
+	err := func() error {
+		filename, err := NewPathResolver().AppFile(appName)
+		if err != nil {
+			return err
+		}
+		unlock, err := lockEnvFile(filename)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return appendAuditLog(appName, filename, nil, nil, &restart, time.Now())
+	}()
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record the restart in the audit log: %s", err.Error()))
+	}
+}
+
+func restartPolicyFor(restart bool) RestartPolicy {
+	if restart {
+		return RestartPolicyAlways
+	}
+	return RestartPolicyNever
+}
+
+//restartWithPolicy restarts an app after keys were changed. effective lists those of them
+// whose change is visible to the app, which decides whether RestartPolicyOnChange restarts
+func restartWithPolicy(appName string, policy RestartPolicy, keys []string, effective []string) error {
+	switch policy {
+	case RestartPolicyAlways:
+		return triggerRestart(appName, keys)
+	case RestartPolicyOnChange:
+		if len(effective) == 0 {
+			common.LogVerboseQuiet(fmt.Sprintf("Skipping restart, the environment of %s did not change", appName))
+			return nil
+		}
+		return triggerRestart(appName, effective)
+	}
+	return nil
+}
+
+func validateRestartPolicy(policy RestartPolicy) error {
+	switch policy {
+	case RestartPolicyAlways, RestartPolicyNever, RestartPolicyOnChange:
+		return nil
+	}
+	return fmt.Errorf("config-restart-policy must be one of always, never or on-change")
+}
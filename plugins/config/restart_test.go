@@ -0,0 +1,217 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestPlanRestart(t *testing.T) {
+	RegisterTestingT(t)
+	scopes := []RestartScope{
+		{Pattern: "WORKER_*", ProcessTypes: []string{"worker"}},
+		{Pattern: "QUEUE_?", ProcessTypes: []string{"worker", "clock"}},
+	}
+
+	plan := PlanRestart(scopes, []string{"WORKER_QUEUE", "QUEUE_A"})
+	Expect(plan.Full()).To(BeFalse())
+	Expect(plan.ProcessTypes).To(Equal([]string{"clock", "worker"}))
+	Expect(plan.Scoped["QUEUE_A"]).To(Equal([]string{"worker", "clock"}))
+	Expect(plan.Unscoped).To(BeEmpty())
+
+	plan = PlanRestart(scopes, []string{"WORKER_QUEUE", "DATABASE_URL"})
+	Expect(plan.Full()).To(BeTrue())
+	Expect(plan.Unscoped).To(Equal([]string{"DATABASE_URL"}))
+
+	Expect(PlanRestart(scopes, []string{}).Full()).To(BeTrue())
+	Expect(PlanRestart(nil, []string{"WORKER_QUEUE"}).Full()).To(BeTrue())
+	Expect(PlanRestart(scopes, []string{"QUEUE_AB"}).Full()).To(BeTrue())
+}
+
+func TestRestartScopes(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(SetRestartScope(testAppName, "WORKER_*", []string{"worker"})).To(Succeed())
+	Expect(SetRestartScope(testAppName, "CLOCK_*", []string{"clock"})).To(Succeed())
+	Expect(SetRestartScope(testAppName, "WORKER_*", []string{"worker", "clock"})).To(Succeed())
+	scopes, err := GetRestartScopes(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(scopes).To(Equal([]RestartScope{
+		{Pattern: "WORKER_*", ProcessTypes: []string{"worker", "clock"}},
+		{Pattern: "CLOCK_*", ProcessTypes: []string{"clock"}},
+	}))
+
+	Expect(UnsetRestartScope(testAppName, "WORKER_*")).To(Succeed())
+	Expect(UnsetRestartScope(testAppName, "WORKER_*")).To(MatchError("No restart scope set for WORKER_*"))
+	scopes, err = GetRestartScopes(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(scopes).To(HaveLen(1))
+
+	Expect(SetRestartScope(testAppName, "WORKER-*", []string{"worker"})).To(MatchError("Invalid key pattern: 'WORKER-*'"))
+	Expect(SetRestartScope(testAppName, "WORKER_*", []string{"web worker"})).To(MatchError("Invalid process type: 'web worker'"))
+	Expect(SetRestartScope(testAppName, "WORKER_*", []string{})).To(HaveOccurred())
+}
+
+func TestRestartPolicy(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	policy, decision, err := resolveRestartPolicy(testAppName, false, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy).To(Equal(RestartPolicyAlways))
+	Expect(decision).To(BeEmpty())
+
+	Expect(common.PropertyWrite("config", "--global", "config-restart-policy", "never")).To(Succeed())
+	Expect(GetRestartPolicy(testAppName)).To(Equal(RestartPolicyNever))
+	Expect(common.PropertyWrite("config", testAppName, "config-restart-policy", "on-change")).To(Succeed())
+	policy, decision, err = resolveRestartPolicy(testAppName, false, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy).To(Equal(RestartPolicyOnChange))
+	Expect(decision).To(ContainSubstring("on-change"))
+
+	//the flags always win over the property
+	policy, decision, err = resolveRestartPolicy(testAppName, true, false)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy).To(Equal(RestartPolicyAlways))
+	Expect(decision).To(ContainSubstring("--restart"))
+	policy, _, err = resolveRestartPolicy(testAppName, false, true)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(policy).To(Equal(RestartPolicyNever))
+	_, _, err = resolveRestartPolicy(testAppName, true, true)
+	Expect(err).To(HaveOccurred())
+
+	Expect(common.PropertyWrite("config", testAppName, "config-restart-policy", "sometimes")).To(Succeed())
+	Expect(GetRestartPolicy(testAppName)).To(Equal(RestartPolicyAlways))
+	Expect(validateRestartPolicy("sometimes")).NotTo(Succeed())
+}
+
+//readAuditLog returns the entries of the audit log next to an ENV file
+func readAuditLog(envFile string) []AuditEntry {
+	contents, err := ioutil.ReadFile(auditLogFile(envFile))
+	Expect(err).NotTo(HaveOccurred())
+	entries := []AuditEntry{}
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		var entry AuditEntry
+		Expect(json.Unmarshal([]byte(line), &entry)).To(Succeed())
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestRestartOutcome(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	defer setupTestProperties()()
+	envFile := filepath.Join(host.root, "web-app", "ENV")
+
+	//a restart is summed up and recorded right after the change it followed
+	output, err := runSubcommand(host, "set", "web-app", "A=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("=====> Restarted web-app in "))
+	entries := readAuditLog(envFile)
+	Expect(entries).To(HaveLen(2))
+	Expect(entries[0].Set).To(Equal([]string{"A"}))
+	Expect(entries[0].Restart).To(BeNil())
+	Expect(entries[1].Set).To(BeEmpty())
+	Expect(entries[1].Restart.Status).To(Equal(RestartStatusRestarted))
+	Expect(entries[1].Restart.ProcessTypes).To(BeEmpty())
+	Expect(entries[1].Restart.FinishedAt.Before(*entries[1].Restart.StartedAt)).To(BeFalse())
+
+	Expect(SetRestartScope("web-app", "WORKER_*", []string{"worker"})).To(Succeed())
+	output, err = runSubcommand(host, "unset", "web-app", "A")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("=====> Restarted web-app in "))
+	output, err = runSubcommand(host, "set", "web-app", "WORKER_QUEUE=high")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("=====> Restarted process types worker of web-app in "))
+	entries = readAuditLog(envFile)
+	Expect(entries).To(HaveLen(6))
+	Expect(entries[5].Restart.ProcessTypes).To(Equal([]string{"worker"}))
+
+	//changes made without restarting say so
+	_, err = runSubcommand(host, "set", "--no-restart", "web-app", "B=2")
+	Expect(err).NotTo(HaveOccurred())
+	entries = readAuditLog(envFile)
+	Expect(entries).To(HaveLen(7))
+	Expect(entries[6].Set).To(Equal([]string{"B"}))
+	Expect(entries[6].Restart).To(Equal(&AuditRestart{Status: RestartStatusSkipped}))
+
+	//a failed restart keeps the change, and fails with how to apply it
+	host.restartErr = errors.New("container exited")
+	_, err = runSubcommand(host, "set", "web-app", "C=3")
+	Expect(err).To(HaveOccurred())
+	failure := err.(*SubcommandError)
+	Expect(failure.Code).To(Equal(ExitStatusRestartFailed))
+	Expect(failure.Message).To(HavePrefix("Restarting web-app failed after "))
+	Expect(failure.Message).To(HaveSuffix(": container exited. The config change was kept, run dokku ps:restart web-app to apply it"))
+	env, err := loadFromFile("web-app", envFile)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(HaveKey("C"))
+	entries = readAuditLog(envFile)
+	Expect(entries).To(HaveLen(9))
+	Expect(entries[8].Restart.Status).To(Equal(RestartStatusFailed))
+	Expect(entries[8].Restart.Error).To(Equal("container exited"))
+
+	//the value taken from the env is returned along with the error
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+	value, existed, err := GetAndUnset("web-app", "C", RestartPolicyAlways)
+	_, ok := err.(*RestartError)
+	Expect(ok).To(BeTrue())
+	Expect(value).To(Equal("3"))
+	Expect(existed).To(BeTrue())
+}
+
+func TestUpdateRestartPolicy(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	defer setupTestProperties()()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+	set := func(key string, value string) func(env *Env) error {
+		return func(env *Env) error {
+			return env.Set(key, value)
+		}
+	}
+
+	_, err := Update("web-app", RestartPolicyNever, set("A", "1"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(BeEmpty())
+	_, err = Update("web-app", RestartPolicyOnChange, set("B", "2"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(Equal([]string{"web-app"}))
+	_, err = Update("web-app", RestartPolicyAlways, set("B", "2"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(HaveLen(1))
+
+	//removing a key the global env sets to the same value changes nothing the app sees
+	_, err = Update("web-app", RestartPolicyNever, set("KEY", "global"))
+	Expect(err).NotTo(HaveOccurred())
+	value, existed, err := GetAndUnset("web-app", "KEY", RestartPolicyOnChange)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("global"))
+	Expect(existed).To(BeTrue())
+	Expect(host.restarts).To(HaveLen(1))
+	_, _, err = GetAndUnset("web-app", "A", RestartPolicyOnChange)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(HaveLen(2))
+	_, err = PruneBlankKeys("web-app", RestartPolicyAlways)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(HaveLen(2))
+}
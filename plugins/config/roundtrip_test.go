@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//randomValue builds a value biased towards bytes that are hard to quote
+func randomValue(r *rand.Rand) string {
+	special := []byte("'\"\\$`!\n\r\t\x01\x1b\x7f =;#*?~")
+	b := make([]byte, r.Intn(24))
+	for i := range b {
+		switch r.Intn(4) {
+		case 0:
+			b[i] = special[r.Intn(len(special))]
+		case 1:
+			b[i] = byte(1 + r.Intn(0xff))
+		default:
+			b[i] = byte(0x20 + r.Intn(0x5f))
+		}
+	}
+	return string(b)
+}
+
+func TestExportBashRoundtrip(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		e := NewForTest(t, nil)
+		keys := make([]string, 0, 5)
+		for j := 0; j < 5; j++ {
+			key := fmt.Sprintf("KEY_%d", j)
+			keys = append(keys, key)
+			e.Set(key, randomValue(r))
+		}
+
+		for _, format := range []ExportFormat{ExportFormatExports, ExportFormatShell} {
+			for _, opts := range []ExportOptions{{}, {EscapeControlChars: true}, {Quoting: QuoteDouble}, {Quoting: QuoteMinimal, EscapeControlChars: true}} {
+				escape := opts.EscapeControlChars
+				exported, err := e.ExportWithOptions(format, opts)
+				Expect(err).NotTo(HaveOccurred())
+				if escape && format == ExportFormatExports {
+					Expect(strings.Count(exported, "\n")).To(Equal(len(keys) - 1))
+				}
+				Expect(VerifyShellExport(exported, e.Map(), true)).To(Succeed(), exported)
+			}
+		}
+	}
+}
+
+func TestQuoteEscapersBashRoundtrip(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	r := rand.New(rand.NewSource(2))
+	for i := 0; i < 50; i++ {
+		var script strings.Builder
+		values := map[string]string{}
+		for j := 0; j < 10; j++ {
+			value := randomValue(r)
+			single, double := fmt.Sprintf("SINGLE_%d", j), fmt.Sprintf("DOUBLE_%d", j)
+			fmt.Fprintf(&script, "%s='%s'\n%s=\"%s\"\n", single, SingleQuoteEscape(value), double, DoubleQuoteEscape(value))
+			values[single], values[double] = value, value
+		}
+		Expect(VerifyShellExport(script.String(), values, true)).To(Succeed(), script.String())
+	}
+}
+
+func TestQuoteStyles(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("PLAIN", "postgres://db:5432/app", "APOS", "it's Bob's", "COST", "$5", "EMPTY", ""))
+	expected := map[QuoteStyle]string{
+		QuoteSingle:  `APOS='it'\''s Bob'\''s' COST='$5' EMPTY='' PLAIN='postgres://db:5432/app'`,
+		QuoteDouble:  `APOS="it's Bob's" COST="\$5" EMPTY="" PLAIN="postgres://db:5432/app"`,
+		QuoteMinimal: `APOS="it's Bob's" COST='$5' EMPTY='' PLAIN=postgres://db:5432/app`,
+	}
+	for style, shell := range expected {
+		exported, err := e.ExportWithOptions(ExportFormatShell, ExportOptions{Quoting: style})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(exported).To(Equal(shell))
+	}
+	//the default is unchanged
+	Expect(e.ShellString()).To(Equal(expected[QuoteSingle]))
+}
+
+func TestVerifyShellExport(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+
+	expected := pairs("A", "1", "B", "two words")
+	Expect(VerifyShellExport("export A='1'\nexport B='two words'", expected, true)).To(Succeed())
+	Expect(VerifyShellExport("A=1 B='two words'", expected, true)).To(Succeed())
+
+	err := VerifyShellExport("export A='1\nexport B='x'", expected, false)
+	Expect(err).To(MatchError("The export is not valid shell syntax, as checked by bash -n"))
+
+	//the syntax may be valid and the values still wrong, which only evaluating the export shows
+	exported := "export A='secret'; export C=3; echo noise"
+	Expect(VerifyShellExport(exported, expected, false)).To(Succeed())
+	err = VerifyShellExport(exported, expected, true)
+	Expect(err).To(Equal(&ShellVerifyError{Mismatched: []string{"A"}, Unset: []string{"B"}, Unexpected: []string{"C"}}))
+	Expect(err).To(MatchError("Evaluating the export in bash sets A to another value and leaves B unset and sets C, which is not exported"))
+	Expect(err.Error()).NotTo(ContainSubstring("secret"))
+
+	err = VerifyShellExport("export A=1; false", expected, true)
+	Expect(err).To(MatchError("Evaluating the export in bash failed: exit status 97"))
+}
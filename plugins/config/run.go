@@ -0,0 +1,326 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//subcommandRunners parse the arguments of the subcommands that can be run through RunSubcommand
+var subcommandRunners = map[string]func(argv []string) error{
+	"bundle": runBundle,
+	"diff":   runDiff,
+	"export": runExport,
+	"get":    runGet,
+	"keys":   runKeys,
+	"report": runReport,
+	"set":    runSet,
+	"show":   runShow,
+	"unset":  runUnset,
+}
+
+//RunSubcommand runs config:<name> with the arguments following it on the command line, against
+// host rather than the dokku install the plugin runs on. Instead of exiting, a subcommand that
+// fails returns a SubcommandError holding its exit status and message. Output is written to
+// stdout as when the subcommand is run by dokku. Subcommands must not be run concurrently
+func RunSubcommand(host Host, name string, argv []string) (err error) {
+	run, ok := subcommandRunners[name]
+	if !ok {
+		return fmt.Errorf("Unknown subcommand: config:%s", name)
+	}
+	previousHost, previousRunning := activeHost, runningSubcommand
+	activeHost, runningSubcommand = host, true
+	//--quiet silences the output of the subcommand through DOKKU_QUIET_OUTPUT, which is restored after
+	previousQuiet, quietSet := os.LookupEnv("DOKKU_QUIET_OUTPUT")
+	defer func() {
+		activeHost, runningSubcommand = previousHost, previousRunning
+		if quietSet {
+			os.Setenv("DOKKU_QUIET_OUTPUT", previousQuiet)
+		} else {
+			os.Unsetenv("DOKKU_QUIET_OUTPUT")
+		}
+		if recovered := recover(); recovered != nil {
+			failure, ok := recovered.(*SubcommandError)
+			if !ok {
+				panic(recovered)
+			}
+			err = failure
+		}
+	}()
+	return run(argv)
+}
+
+//MainSubcommand runs config:<name> with the arguments of the process against the dokku install
+// it runs on, exiting with the status of the subcommand
+func MainSubcommand(name string) {
+	err := RunSubcommand(CommonHost(), name, os.Args[2:])
+	if err == nil {
+		return
+	}
+	if failure, ok := err.(*SubcommandError); ok {
+		if failure.Message != "" {
+			fmt.Fprintf(os.Stderr, "FAILED: %s\n", failure.Message)
+		}
+		os.Exit(failure.Code)
+	}
+	common.LogFail(err.Error())
+}
+
+//parseFlags parses the arguments of a subcommand, failing with the exit status of a usage error.
+// The flag package has printed what was wrong along with the usage by then
+func parseFlags(args *flag.FlagSet, argv []string) error {
+	if err := args.Parse(argv); err != nil {
+		return &SubcommandError{Code: 2}
+	}
+	return nil
+}
+
+func runSet(argv []string) error {
+	args := flag.NewFlagSet("config:set", flag.ContinueOnError)
+	target := AddTargetFlags(args)
+	encoded := args.Bool("encoded", false, "--encoded: interpret VALUEs as base64")
+	restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+	ttl := args.Duration("ttl", 0, "--ttl: remove the keys once this duration, such as 72h, has passed, or 0 to keep them")
+	skipValidation := args.Bool("skip-validation", false, "--skip-validation: set values referencing another app even if they can't be resolved, or that plugins refuse")
+	quiet := AddQuietFlag(args)
+	stdinPairs := args.Bool("stdin-pairs", false, "--stdin-pairs: read NUL-terminated KEY=VALUE records from stdin instead of the arguments")
+	literal := args.Bool("literal", false, "--literal: store values wrapped in quotes or with surrounding whitespace exactly as given")
+	trim := args.Bool("trim", false, "--trim: remove leading and trailing whitespace from the values")
+	stripQuotes := args.Bool("strip-quotes", false, "--strip-quotes: remove the matching quotes wrapping the values")
+	provider := args.String("provider", "", "--provider: compute the values of the given keys with this provider whenever a container starts, rather than storing them")
+	preview := args.Bool("preview", false, "--preview: with --global, show the effect the keys would have on every app instead of setting them")
+	format := args.String("format", "text", "--format: [ text | json ] how to print the preview")
+	sealed := args.Bool("sealed", false, "--sealed: seal the values with the host key, so that only the containers of the app get them as set")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+
+	ttlSet := false
+	args.Visit(func(f *flag.Flag) {
+		if f.Name == "ttl" {
+			ttlSet = true
+		}
+	})
+	if !ttlSet {
+		ttl = nil
+	}
+	CommandSet(args.Args(), *target, SetCommandOptions{
+		Restart:        *restart,
+		NoRestart:      *noRestart,
+		Encoded:        *encoded,
+		TTL:            ttl,
+		SkipValidation: *skipValidation,
+		Quiet:          *quiet,
+		StdinPairs:     *stdinPairs,
+		Literal:        *literal,
+		Trim:           *trim,
+		StripQuotes:    *stripQuotes,
+		Provider:       *provider,
+		Preview:        *preview,
+		Format:         *format,
+		Sealed:         *sealed,
+	})
+	return nil
+}
+
+func runUnset(argv []string) error {
+	args := flag.NewFlagSet("config:unset", flag.ContinueOnError)
+	target := AddTargetFlags(args)
+	AddQuietFlag(args)
+	restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+	strict := args.Bool("strict", false, "--strict: exit non-zero if any of the keys was not set")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandUnset(args.Args(), *target, *restart, *noRestart, *strict)
+	return nil
+}
+
+func runGet(argv []string) error {
+	args := flag.NewFlagSet("config:get", flag.ContinueOnError)
+	target := AddTargetFlags(args)
+	AddQuietFlag(args)
+	quoted := args.Bool("quoted", false, "--quoted: get the value quoted")
+	null := args.Bool("null", false, "--null: end each value with a NUL byte instead of a newline")
+	raw := args.Bool("raw", false, "--raw: write the value exactly as stored, without adding a newline")
+	first := args.Bool("first", false, "--first: get the value of the first of the given keys that is set")
+	verbose := args.Bool("verbose", false, "--verbose: with --first, write the key whose value is got to stderr")
+	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandGet(args.Args(), *target, GetCommandOptions{
+		Quoted:  *quoted,
+		Null:    *null,
+		Raw:     *raw,
+		First:   *first,
+		Verbose: *verbose,
+		Merged:  *merged,
+	})
+	return nil
+}
+
+func runExport(argv []string) error {
+	args := flag.NewFlagSet("config:export", flag.ContinueOnError)
+	target := AddReadOnlyTargetFlags(args)
+	AddQuietFlag(args)
+	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
+	format := args.String("format", "exports", "--format: [ exports | envfile | docker-args | shell | pretty | json | nul | netstring | compose | docker-envfile | json-nested ] which format to export as)")
+	escapeControlChars := args.Bool("escape-control-chars", false, "--escape-control-chars: write values holding control characters as $'...' strings")
+	ordered := args.Bool("ordered", false, "--ordered: list keys in the order they appear in the ENV file rather than sorted")
+	quoting := args.String("quoting", "single", "--quoting: [ single | double | minimal ] how to quote values in the exports, docker-args and shell formats")
+	service := args.String("service", "", "--service: the service whose environment the compose format sets, web by default")
+	composeMap := args.Bool("compose-map", false, "--compose-map: write the environment of the compose format as a mapping rather than a list")
+	output := args.String("output", "", "--output: write the export to a new file only readable by the dokku user, or - for stdout")
+	force := args.Bool("force", false, "--force: replace the --output file if it exists")
+	warningsAsErrors := args.Bool("warnings-as-errors", false, "--warnings-as-errors: fail if the ENV file holds lines that are not read as they are written")
+	container := args.Bool("container", false, "--container: leave out the keys tagged no-export, which are kept out of the containers of the app")
+	allApps := args.Bool("all-apps", false, "--all-apps: export every app as a single json object keyed by app name")
+	showValues := args.Bool("show-values", false, "--show-values: include the values in the --all-apps export, which are redacted otherwise")
+	keyTransform := args.String("key-transform", "", "--key-transform: rename every key to upper, lower, kebab or camel case")
+	keyPrefix := args.String("key-prefix", "", "--key-prefix: prepend a prefix to every key")
+	keyStripPrefix := args.String("key-strip-prefix", "", "--key-strip-prefix: remove a prefix from the keys starting with it")
+	keyUpper := args.Bool("key-upper", false, "--key-upper: uppercase every key, as --key-transform upper does")
+	separator := args.String("separator", "", "--separator: what keys are split on into nested objects in the json-nested format, _ by default")
+	lowercase := args.Bool("lowercase", false, "--lowercase: lowercase the keys of the json-nested format")
+	ifChangedSince := args.String("if-changed-since", "", "--if-changed-since: print nothing and exit with 6 if the checksum of the env is the given one, print the new checksum on stderr otherwise")
+	evalSafe := args.Bool("eval-safe", false, "--eval-safe: fail unless bash -n accepts the exports or shell format")
+	evalCompare := args.Bool("eval-compare", false, "--eval-compare: as --eval-safe, and fail unless evaluating the export in bash sets exactly the keys and values of the env")
+	guarded := args.Bool("guarded", false, "--guarded: wrap the exports or shell format in a guard that only evaluates it if it was received whole")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandExport(args.Args(), *target, ExportCommandOptions{
+		Merged:             *merged,
+		Format:             *format,
+		EscapeControlChars: *escapeControlChars,
+		Ordered:            *ordered,
+		Quoting:            *quoting,
+		ComposeService:     *service,
+		ComposeMap:         *composeMap,
+		Output:             *output,
+		Force:              *force,
+		WarningsAsErrors:   *warningsAsErrors,
+		Container:          *container,
+		AllApps:            *allApps,
+		ShowValues:         *showValues,
+		KeyTransform:       *keyTransform,
+		KeyPrefix:          *keyPrefix,
+		KeyStripPrefix:     *keyStripPrefix,
+		KeyUpper:           *keyUpper,
+		Separator:          *separator,
+		Lowercase:          *lowercase,
+		IfChangedSince:     *ifChangedSince,
+		EvalSafe:           *evalSafe,
+		EvalCompare:        *evalCompare,
+		Guarded:            *guarded,
+	})
+	return nil
+}
+
+func runShow(argv []string) error {
+	args := flag.NewFlagSet("config:show", flag.ContinueOnError)
+	target := AddReadOnlyTargetFlags(args)
+	AddQuietFlag(args)
+	shell := args.Bool("shell", false, "--shell: in a single-line for usage in command-line utilities [deprecated]")
+	export := args.Bool("export", false, "--export: print the env as eval-compatible exports [deprecated]")
+	merged := args.Bool("merged", false, "--merged: display the app's environment merged with the global environment")
+	provenance := args.Bool("provenance", false, "--provenance: display when and by whom each key was last changed")
+	warningsAsErrors := args.Bool("warnings-as-errors", false, "--warnings-as-errors: fail if the ENV file holds lines that are not read as they are written")
+	redactedPublic := args.Bool("redacted-public", false, "--redacted-public: display the keys and value checksums of the redacted snapshot, readable by the redacted-public-group group")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandShow(args.Args(), *target, ShowCommandOptions{
+		Shell:            *shell,
+		Export:           *export,
+		Merged:           *merged,
+		Provenance:       *provenance,
+		WarningsAsErrors: *warningsAsErrors,
+		RedactedPublic:   *redactedPublic,
+	})
+	return nil
+}
+
+//runReport passes the arguments as they are, as the info flags are not known beforehand
+func runReport(argv []string) error {
+	CommandReport(argv)
+	return nil
+}
+
+func runKeys(argv []string) error {
+	args := flag.NewFlagSet("config:keys", flag.ContinueOnError)
+	target := AddTargetFlags(args)
+	AddQuietFlag(args)
+	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandKeys(args.Args(), *target, *merged)
+	return nil
+}
+
+func runBundle(argv []string) error {
+	var exclude, includeOnly stringList
+	args := flag.NewFlagSet("config:bundle", flag.ContinueOnError)
+	target := AddTargetFlags(args)
+	AddQuietFlag(args)
+	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
+	args.Var(&exclude, "exclude", "--exclude: leave out keys matching a glob pattern such as 'DOKKU_*', may be given more than once")
+	args.Var(&includeOnly, "include-only", "--include-only: only bundle keys matching a glob pattern, may be given more than once")
+	output := args.String("output", "", "--output: write the tarfile to a new file only readable by the dokku user, or - for stdout")
+	force := args.Bool("force", false, "--force: replace the --output file if it exists")
+	container := args.Bool("container", false, "--container: leave out the keys tagged no-export, which are kept out of the containers of the app")
+	includeEnvfile := args.Bool("include-envfile", false, "--include-envfile: also add an entry holding the whole env in the envfile format")
+	envfileName := args.String("envfile-name", DefaultBundleEnvfileEntry, "--envfile-name: the name of the --include-envfile entry")
+	gzipped := args.Bool("gzip", false, "--gzip: compress the tarfile with gzip")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	options := BundleCommandOptions{
+		Merged:        *merged,
+		Exclude:       exclude,
+		IncludeOnly:   includeOnly,
+		Output:        *output,
+		Force:         *force,
+		Container:     *container,
+		BundleOptions: BundleOptions{Gzip: *gzipped},
+	}
+	if *includeEnvfile {
+		options.EnvfileEntry = *envfileName
+	}
+	CommandBundle(args.Args(), *target, options)
+	return nil
+}
+
+//stringList collects the values of a flag that may be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runDiff(argv []string) error {
+	var files stringList
+	args := flag.NewFlagSet("config:diff", flag.ContinueOnError)
+	args.Var(&files, "file", "--file: an ENV file to compare, given twice")
+	AddQuietFlag(args)
+	format := args.String("format", "text", "--format: [ text | json ] how to print the keys that differ")
+	showValues := args.Bool("show-values", false, "--show-values: include the values in the json format, which only holds their checksums otherwise")
+	failOn := args.String("fail-on", "added,removed,changed", "--fail-on: the kinds of differences that make the command exit non-zero, a list of added, removed and changed")
+	if err := parseFlags(args, argv); err != nil {
+		return err
+	}
+	CommandDiff(args.Args(), files, *format, *showValues, *failOn)
+	return nil
+}
@@ -0,0 +1,501 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//testHost is a Host of a temporary DOKKU_ROOT that records restarts and triggers instead of running them
+type testHost struct {
+	root     string
+	restarts []string
+	triggers []string
+	//vetoes are what a plugin prints when refusing the value of a key through config-validate-value
+	vetoes map[string]string
+	//reserved is what plugins print for config-reserved-runtime-keys
+	reserved string
+	//provided are the values printed by the config-provider-<name> triggers, keyed by name
+	provided map[string]string
+	//restartErr is what restarts fail with, if anything
+	restartErr error
+	//contributed are what plugins print for config-contribute-env, keyed by plugin name
+	contributed map[string]string
+	//detached are the arguments of the triggers fired through TriggerDetached, the name first
+	detached [][]string
+}
+
+func (h *testHost) DokkuRoot() (string, error) {
+	return h.root, nil
+}
+
+func (h *testHost) VerifyApp(appName string) error {
+	return verifyAppName(h.root, appName)
+}
+
+func (h *testHost) Apps() ([]string, error) {
+	files, err := ioutil.ReadDir(h.root)
+	if err != nil {
+		return nil, err
+	}
+	apps := []string{}
+	for _, f := range files {
+		if f.IsDir() {
+			apps = append(apps, f.Name())
+		}
+	}
+	sort.Strings(apps)
+	return apps, nil
+}
+
+func (h *testHost) Restart(appName string, processTypes []string) error {
+	h.restarts = append(h.restarts, strings.TrimSpace(appName+" "+strings.Join(processTypes, " ")))
+	return h.restartErr
+}
+
+func (h *testHost) Trigger(name string, args ...string) error {
+	h.triggers = append(h.triggers, name+" "+strings.Join(args, " "))
+	return nil
+}
+
+func (h *testHost) TriggerInput(input string, name string, args ...string) (string, error) {
+	if name == validateValueTrigger && len(args) == 2 {
+		if message, ok := h.vetoes[args[1]]; ok {
+			return message + "\n", fmt.Errorf("exit status 1")
+		}
+	}
+	if name == reservedKeysTrigger {
+		return h.reserved, nil
+	}
+	return "", nil
+}
+
+func (h *testHost) TriggerOutput(name string, args ...string) (string, string, error) {
+	h.triggers = append(h.triggers, name+" "+strings.Join(args, " "))
+	if value, ok := h.provided[strings.TrimPrefix(name, providerTriggerPrefix)]; ok {
+		return value + "\n", "", nil
+	}
+	return "", "unknown provider\n", fmt.Errorf("exit status 1")
+}
+
+func (h *testHost) TriggerDetached(name string, args ...string) error {
+	h.detached = append(h.detached, append([]string{name}, args...))
+	return nil
+}
+
+func (h *testHost) TriggerEach(name string, args ...string) ([]PluginOutput, error) {
+	plugins := make([]string, 0, len(h.contributed))
+	for plugin := range h.contributed {
+		plugins = append(plugins, plugin)
+	}
+	sort.Strings(plugins)
+	outputs := []PluginOutput{}
+	for _, plugin := range plugins {
+		h.triggers = append(h.triggers, plugin+" "+name+" "+strings.Join(args, " "))
+		outputs = append(outputs, PluginOutput{Plugin: plugin, Stdout: h.contributed[plugin]})
+	}
+	return outputs, nil
+}
+
+//setupTestHost creates a temporary DOKKU_ROOT holding the given apps, with the global env and that
+// of each app holding KEY set to the name of the env
+func setupTestHost(apps ...string) (host *testHost, teardown func()) {
+	root, err := ioutil.TempDir("", "dokku-config-host")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(ioutil.WriteFile(filepath.Join(root, "ENV"), []byte("export KEY='global'\n"), 0600)).To(Succeed())
+	for _, app := range apps {
+		Expect(os.MkdirAll(filepath.Join(root, app), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(root, app, "ENV"), []byte(fmt.Sprintf("export KEY='%s'\n", app)), 0600)).To(Succeed())
+	}
+	return &testHost{root: root}, func() {
+		os.RemoveAll(root)
+	}
+}
+
+//runSubcommand runs a subcommand against host, returning what it printed to stdout and the error
+// it failed with
+func runSubcommand(host Host, name string, argv ...string) (output string, err error) {
+	reader, writer, pipeErr := os.Pipe()
+	Expect(pipeErr).NotTo(HaveOccurred())
+	stdout := os.Stdout
+	os.Stdout = writer
+	captured := make(chan string)
+	go func() {
+		contents, _ := ioutil.ReadAll(reader)
+		captured <- string(contents)
+	}()
+	err = RunSubcommand(host, name, argv)
+	os.Stdout = stdout
+	writer.Close()
+	return <-captured, err
+}
+
+func TestRunSubcommandSet(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app", "other-app")
+	defer teardown()
+
+	output, err := runSubcommand(host, "set", "web-app", "DATABASE_URL=postgres://db", "KEY=changed")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("-----> Setting config vars"))
+	Expect(output).To(ContainSubstring("DATABASE_URL:  postgres://db"))
+	Expect(host.triggers).To(Equal([]string{"post-config-update web-app set DATABASE_URL KEY"}))
+	Expect(host.restarts).To(Equal([]string{"web-app"}))
+	env, err := loadFromFile("web-app", filepath.Join(host.root, "web-app", "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("DATABASE_URL", "postgres://db", "KEY", "changed")))
+
+	//the host is only used while the subcommand runs
+	Expect(activeHost).To(Equal(CommonHost()))
+	Expect(runningSubcommand).To(BeFalse())
+
+	host.restarts = nil
+	_, err = runSubcommand(host, "set", "--no-restart", "--global", "GLOBAL_KEY=1")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = runSubcommand(host, "set", "--no-restart", "--app", "other-app", "OTHER=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.restarts).To(BeEmpty())
+	global, err := loadFromFile("global", filepath.Join(host.root, "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Map()).To(Equal(pairs("KEY", "global", "GLOBAL_KEY", "1")))
+}
+
+func TestRunSubcommandErrors(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected SubcommandError
+	}{
+		{"set", []string{"missing-app", "A=1"}, SubcommandError{Code: 20, Message: "app missing-app does not exist: stat " + filepath.Join(host.root, "missing-app") + ": no such file or directory"}},
+		{"set", []string{"web-app", "A"}, SubcommandError{Code: 2, Message: "Invalid env pair: A"}},
+		{"set", []string{"--bogus", "web-app", "A=1"}, SubcommandError{Code: 2}},
+		//flags are only parsed before the app name
+		{"set", []string{"web-app", "-bad=1"}, SubcommandError{Code: 2, Message: "Invalid key name: '-bad'"}},
+		{"set", []string{"web-app", "1BAD=1"}, SubcommandError{Code: 2, Message: "Invalid key name: '1BAD'"}},
+		{"set", []string{"--ttl", "soon", "web-app", "A=1"}, SubcommandError{Code: 2}},
+		{"set", []string{"--ttl", "-1h", "web-app", "A=1"}, SubcommandError{Code: 2, Message: "--ttl must not be negative"}},
+		{"set", []string{"--literal", "--trim", "web-app", "A=1"}, SubcommandError{Code: 2, Message: "--literal cannot be combined with --trim or --strip-quotes"}},
+		{"set", []string{"--global", "--app", "web-app", "A=1"}, SubcommandError{Code: 2, Message: "--global and --app cannot be combined"}},
+		{"unset", []string{"--strict", "web-app", "KEY", "MISSING"}, SubcommandError{Code: 1, Message: "Not set: MISSING"}},
+		{"get", []string{"web-app"}, SubcommandError{Code: 2, Message: "Expected: key"}},
+		{"get", []string{"web-app", "MISSING"}, SubcommandError{Code: 1}},
+		{"get", []string{"web-app", "KEY", "OTHER"}, SubcommandError{Code: 2, Message: "Unexpected argument(s): [OTHER], use --quoted or --null to get several keys"}},
+		{"export", []string{"--format", "yaml", "web-app"}, SubcommandError{Code: 2, Message: "Unknown export format: yaml"}},
+		{"export", []string{"--lowercase", "web-app"}, SubcommandError{Code: 2, Message: "--separator and --lowercase only apply to --format json-nested"}},
+	} {
+		_, err := runSubcommand(host, tc.name, tc.argv...)
+		Expect(err).To(Equal(&tc.expected), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+	}
+	//the unset key was removed before failing on the one that was not set
+	env, err := loadFromFile("web-app", filepath.Join(host.root, "web-app", "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Len()).To(Equal(0))
+	Expect(host.triggers).To(Equal([]string{"post-config-update web-app unset KEY"}))
+
+	Expect(RunSubcommand(host, "lint", []string{"web-app"})).To(MatchError("Unknown subcommand: config:lint"))
+	Expect(new(SubcommandError).Error()).To(Equal("exit status 0"))
+}
+
+func TestRunSubcommandGetAndExport(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	_, err := runSubcommand(host, "set", "--no-restart", "web-app", "QUOTE=it's", "MULTI=a b")
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected string
+	}{
+		{"get", []string{"web-app", "KEY"}, "web-app\n"},
+		{"get", []string{"--global", "KEY"}, "global\n"},
+		{"get", []string{"--quoted", "web-app", "QUOTE"}, "'it'\\''s'\n"},
+		{"get", []string{"--quoted", "web-app", "KEY", "MULTI"}, "KEY='web-app'\nMULTI='a b'\n"},
+		{"get", []string{"--null", "web-app", "KEY", "MULTI"}, "KEY=web-app\x00MULTI=a b\x00"},
+		{"export", []string{"web-app"}, "export KEY='web-app'\nexport MULTI='a b'\nexport QUOTE='it'\\''s'\n"},
+		{"export", []string{"--merged", "--format", "shell", "web-app"}, "KEY='web-app' MULTI='a b' QUOTE='it'\\''s' "},
+		{"export", []string{"--format", "docker-envfile", "web-app"}, "KEY=web-app\nMULTI=a b\nQUOTE=it's\n"},
+		{"export", []string{"--format", "json-nested", "--lowercase", "web-app"}, `{"key":"web-app","multi":"a b","quote":"it's"}` + "\n"},
+		{"export", []string{"--format", "netstring", "--global"}, "3:KEY,6:global,"},
+	} {
+		output, err := runSubcommand(host, tc.name, tc.argv...)
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		Expect(output).To(Equal(tc.expected), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+	}
+
+	output, err := runSubcommand(host, "unset", "--no-restart", "web-app", "QUOTE", "MISSING")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("-----> Unsetting QUOTE"))
+	Expect(output).To(ContainSubstring("-----> Skipping MISSING, it is not set in the environment"))
+	Expect(output).To(ContainSubstring("=====> Removed 1 key(s): QUOTE"))
+}
+
+func TestRunSubcommandBundleWithEnvfile(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+
+	output, err := runSubcommand(host, "bundle", "--merged", "--include-envfile", "--envfile-name", "web-app.env", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	entries, names := readBundle(bytes.NewBufferString(output))
+	Expect(names).To(Equal([]string{"KEY", "web-app.env"}))
+	Expect(entries["web-app.env"]).To(Equal("KEY=\"web-app\"\n"))
+
+	//the name is only used along with --include-envfile
+	output, err = runSubcommand(host, "bundle", "--envfile-name", "web-app.env", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	_, names = readBundle(bytes.NewBufferString(output))
+	Expect(names).To(Equal([]string{"KEY"}))
+
+	_, err = runSubcommand(host, "bundle", "--include-envfile", "--envfile-name", "KEY", "web-app")
+	Expect(err).To(Equal(&SubcommandError{Code: 2, Message: "The envfile entry KEY has the name of a key, choose another name for it"}))
+}
+
+//captureStderr runs fn and returns what it wrote to stderr
+func captureStderr(fn func()) string {
+	reader, writer, err := os.Pipe()
+	Expect(err).NotTo(HaveOccurred())
+	stderr := os.Stderr
+	os.Stderr = writer
+	captured := make(chan string)
+	go func() {
+		contents, _ := ioutil.ReadAll(reader)
+		captured <- string(contents)
+	}()
+	fn()
+	os.Stderr = stderr
+	writer.Close()
+	return <-captured
+}
+
+func TestRunSubcommandExportIfChangedSince(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	env, err := loadFromFile("web-app", filepath.Join(host.root, "web-app", "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	checksum := env.Checksum()
+
+	//any value that is not the current checksum, such as none on the first poll, exports the env
+	var output string
+	stderr := captureStderr(func() {
+		output, err = runSubcommand(host, "export", "--if-changed-since", "none", "web-app")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("export KEY='web-app'\n"))
+	Expect(stderr).To(Equal(checksum + "\n"))
+
+	stderr = captureStderr(func() {
+		output, err = runSubcommand(host, "export", "--format", "json", "--if-changed-since", checksum, "web-app")
+	})
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusUnchanged}))
+	Expect(output).To(BeEmpty())
+	Expect(stderr).To(BeEmpty())
+
+	//the streamed formats print the checksum as well
+	_, err = runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "OTHER=1")
+	Expect(err).NotTo(HaveOccurred())
+	stderr = captureStderr(func() {
+		output, err = runSubcommand(host, "export", "--format", "nul", "--if-changed-since", checksum, "web-app")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("KEY\x00web-app\x00OTHER\x001\x00"))
+	Expect(stderr).NotTo(Equal(checksum + "\n"))
+	Expect(stderr).To(HaveLen(len(checksum) + 1))
+
+	//the checksum is of the env exported, so only a merged export changes with the global env
+	checksum = strings.TrimSpace(stderr)
+	_, err = runSubcommand(host, "set", "--no-restart", "--quiet", "--global", "GLOBAL=1")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = runSubcommand(host, "export", "--if-changed-since", checksum, "web-app")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusUnchanged}))
+	captureStderr(func() {
+		output, err = runSubcommand(host, "export", "--merged", "--if-changed-since", checksum, "web-app")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("export GLOBAL='1'"))
+
+	//exports without the flag are unchanged
+	stderr = captureStderr(func() {
+		_, err = runSubcommand(host, "export", "web-app")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(stderr).To(BeEmpty())
+
+	_, err = runSubcommand(host, "export", "--all-apps", "--format", "json", "--if-changed-since", checksum)
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--if-changed-since cannot be combined with --all-apps"}))
+}
+
+func TestRunSubcommandExportEvalSafe(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	_, err := runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "QUOTED=it's \"$HOME\"\n`pwd`")
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, argv := range [][]string{
+		{"--eval-safe", "web-app"},
+		{"--eval-compare", "web-app"},
+		{"--eval-compare", "--format", "shell", "--quoting", "minimal", "web-app"},
+		{"--eval-compare", "--escape-control-chars", "--key-prefix", "APP_", "web-app"},
+	} {
+		expected, err := runSubcommand(host, "export", argv[len(argv)-1])
+		Expect(err).NotTo(HaveOccurred())
+		output, err := runSubcommand(host, "export", argv...)
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprint(argv))
+		if len(argv) == 2 {
+			Expect(output).To(Equal(expected))
+		}
+	}
+
+	_, err = runSubcommand(host, "export", "--eval-safe", "--format", "json", "web-app")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--eval-safe and --eval-compare only apply to --format exports and shell"}))
+}
+
+func TestRunSubcommandsWithoutGlobalEnv(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	globalfile := filepath.Join(host.root, "ENV")
+	Expect(os.Remove(globalfile)).To(Succeed())
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+	Expect(GlobalExists()).To(BeFalse())
+
+	//the global env is empty, and reading it neither warns nor creates the file
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected string
+	}{
+		{"show", []string{"web-app"}, "=====> web-app env vars\nKEY:  web-app\n"},
+		{"show", []string{"--merged", "web-app"}, "=====> web-app env vars\nKEY:  web-app\n"},
+		{"show", []string{"--global"}, "=====> global env vars\n"},
+		{"keys", []string{"--merged", "web-app"}, "KEY\n"},
+		{"keys", []string{"--global"}, ""},
+		{"get", []string{"web-app", "KEY"}, "web-app\n"},
+		{"export", []string{"--global"}, ""},
+		{"export", []string{"--merged", "web-app"}, "export KEY='web-app'\n"},
+		{"export", []string{"--all-apps", "--format", "json"}, `{"web-app":{"env":{"KEY":{"value":"[redacted]"}}}}` + "\n"},
+	} {
+		var output string
+		var err error
+		stderr := captureStderr(func() {
+			output, err = runSubcommand(host, tc.name, tc.argv...)
+		})
+		Expect(err).NotTo(HaveOccurred(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		Expect(output).To(Equal(tc.expected), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+		Expect(stderr).To(BeEmpty(), fmt.Sprintf("config:%s %v", tc.name, tc.argv))
+	}
+	_, err := runSubcommand(host, "get", "--global", "KEY")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusKeyNotSet}))
+	output, err := runSubcommand(host, "bundle", "--merged", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	_, names := readBundle(bytes.NewBufferString(output))
+	Expect(names).To(Equal([]string{"KEY"}))
+
+	container, err := ComputeContainerEnv("web-app", "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()).To(Equal(pairs("KEY", "web-app")))
+	effective, err := ResolveEffectiveEnv("web-app", "", SchedulerPhaseBuild)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(effective.Chain("KEY")).To(HaveLen(1))
+	_, err = runSubcommand(host, "unset", "--no-restart", "--global", "KEY")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(GlobalExists()).To(BeFalse())
+
+	//the file is only created by the first write
+	_, err = runSubcommand(host, "set", "--no-restart", "--global", "GLOBAL=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(GlobalExists()).To(BeTrue())
+	output, err = runSubcommand(host, "keys", "--merged", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("GLOBAL\nKEY\n"))
+}
+
+func TestRunSubcommandGetRaw(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	//config:get --raw and config-get-raw print the same bytes, whatever newlines end the value
+	values := pairs("NONE", "-----END CERTIFICATE-----", "ONE", "-----END CERTIFICATE-----\n", "TWO", "-----END CERTIFICATE-----\n\n")
+	Expect(SetMany("web-app", values, false)).To(Succeed())
+	for _, k := range []string{"NONE", "ONE", "TWO"} {
+		output, err := runSubcommand(host, "get", "--raw", "web-app", k)
+		Expect(err).NotTo(HaveOccurred())
+		Expect([]byte(output)).To(Equal([]byte(values[k])), k)
+		var raw bytes.Buffer
+		Expect(TriggerGetRaw("web-app", k, &raw)).To(Succeed())
+		Expect(raw.Bytes()).To(Equal([]byte(values[k])), k)
+	}
+	output, err := runSubcommand(host, "get", "web-app", "ONE")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal(values["ONE"] + "\n"))
+
+	output, err = runSubcommand(host, "get", "--raw", "web-app", "MISSING")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusKeyNotSet}))
+	Expect(output).To(BeEmpty())
+	_, err = runSubcommand(host, "get", "--raw", "--null", "web-app", "ONE")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--raw cannot be combined with --quoted or --null"}))
+	_, err = runSubcommand(host, "get", "--raw", "web-app", "ONE", "TWO")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "Unexpected argument(s): [TWO], --raw gets a single key"}))
+}
+
+func TestRunSubcommandGetFirst(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	_, err := runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "DB_URL=postgres://legacy")
+	Expect(err).NotTo(HaveOccurred())
+
+	var output string
+	stderr := captureStderr(func() {
+		output, err = runSubcommand(host, "get", "--first", "--verbose", "web-app", "DATABASE_URL", "DB_URL")
+	})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("postgres://legacy\n"))
+	Expect(stderr).To(Equal("DB_URL\n"))
+
+	//a key set globally is found in the merged env before the next key of the chain
+	_, err = runSubcommand(host, "set", "--no-restart", "--quiet", "--global", "DATABASE_URL=postgres://shared")
+	Expect(err).NotTo(HaveOccurred())
+	output, err = runSubcommand(host, "get", "--first", "web-app", "DATABASE_URL", "DB_URL")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("postgres://legacy\n"))
+	output, err = runSubcommand(host, "get", "--first", "--merged", "--quoted", "web-app", "DATABASE_URL", "DB_URL")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("'postgres://shared'\n"))
+	//an app value takes precedence over the global one for the same key
+	_, err = runSubcommand(host, "set", "--no-restart", "--quiet", "web-app", "DATABASE_URL=postgres://own")
+	Expect(err).NotTo(HaveOccurred())
+	output, err = runSubcommand(host, "get", "--first", "--merged", "--raw", "web-app", "DATABASE_URL", "DB_URL")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("postgres://own"))
+
+	output, err = runSubcommand(host, "get", "--first", "web-app", "MISSING", "OTHER")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusKeyNotSet}))
+	Expect(output).To(BeEmpty())
+	_, err = runSubcommand(host, "get", "--verbose", "web-app", "DB_URL")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--verbose only applies to --first"}))
+}
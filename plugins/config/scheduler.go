@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+//Phases of the life of an app that a scheduler may resolve the env of a container for
+const (
+	SchedulerPhaseBuild  = "build"
+	SchedulerPhaseDeploy = "deploy"
+	SchedulerPhaseRun    = "run"
+)
+
+//ResolveSchedulerEnv returns the env that a container of the given process type should get in
+// the given phase, which is the env put together by ResolveEffectiveEnv with references to other
+// apps resolved and the keys tagged no-export left out. Schedulers should use it, or the
+// scheduler-env-vars trigger, rather than putting the env together themselves, so that any process
+// type or phase specific handling is done the same way for all of them. The deploy and run phases
+// always get the env returned by ComputeContainerEnv, which holds the keys given a provider as well
+func ResolveSchedulerEnv(appName string, procType string, phase string) (*Env, error) {
+	if phase == SchedulerPhaseDeploy || phase == SchedulerPhaseRun {
+		return ComputeContainerEnv(appName, procType)
+	}
+	return resolveContainerEnv(appName, procType, phase)
+}
+
+//ComputeContainerEnv returns the env that a container of the given process type runs with, the
+// same whether it is started by a deploy or by dokku run: the global env, the env of the app and
+// ENV.<proctype> merged in that order, without ENV.build, with references to other apps resolved,
+// the keys tagged no-export left out, sealed values opened and the values of the keys given a provider
+// computed by it, see SealMany and SetProvider. With the config-metadata property set, it also holds
+// the document of IntrospectConfig in DOKKU_CONFIG_METADATA. A container that runs no process type,
+// such as that of dokku run with a command that is not in the Procfile, is given an empty procType.
+// A provider failing is a ProviderError
+func ComputeContainerEnv(appName string, procType string) (*Env, error) {
+	return resolveContainerEnv(appName, procType, SchedulerPhaseDeploy)
+}
+
+func resolveContainerEnv(appName string, procType string, phase string) (*Env, error) {
+	effective, err := ResolveEffectiveEnv(appName, procType, phase)
+	if err != nil {
+		return nil, err
+	}
+	env, err := effective.Env.ResolveReferences()
+	if err != nil {
+		return nil, err
+	}
+	//this is the only place sealed values are opened, as nothing but containers gets them
+	if err := unsealContainerValues(env, effective.Env, appName); err != nil {
+		return nil, err
+	}
+	env, err = withoutNoExportKeys(env, appName)
+	//the values of keys given a provider are computed for the containers of the app, not its build
+	if err != nil || phase == SchedulerPhaseBuild {
+		return env, err
+	}
+	if env, err = withProvidedKeys(env, effective, appName, procType); err != nil {
+		return nil, err
+	}
+	return withConfigMetadata(env, appName)
+}
+
+//noExportKeys returns the keys of the env of an app merged with the global env, or of the global
+// env if appName is empty, that are tagged no-export. A key set by the app only counts as tagged if
+// the app tags it, as its value takes precedence over the global one
+func noExportKeys(appName string) (map[string]bool, error) {
+	excluded := map[string]bool{}
+	envs := []*Env{}
+	global, err := LoadGlobalEnv()
+	if err != nil {
+		return nil, err
+	}
+	envs = append(envs, global)
+	if appName != "" {
+		app, err := LoadAppEnv(appName)
+		if err != nil {
+			return nil, err
+		}
+		envs = append(envs, app)
+	}
+	for _, env := range envs {
+		if _, err := env.Metadata(); err != nil {
+			return nil, err
+		}
+		for _, k := range env.Keys() {
+			excluded[k] = env.KeyMetadata(k).HasTag(TagNoExport)
+		}
+	}
+	return excluded, nil
+}
+
+//withoutNoExportKeys returns a copy of the env of an app, or of the global env if appName is
+// empty, without the keys tagged no-export. Sealed values are left out as well, as only the env
+// resolved for a container opens them. The copy is read-only and not bound to a file
+func withoutNoExportKeys(env *Env, appName string) (*Env, error) {
+	excluded, err := noExportKeys(appName)
+	if err != nil {
+		return nil, err
+	}
+	filtered := env.clone()
+	filtered.filename = ""
+	for _, k := range env.Keys() {
+		if excluded[k] || isSealed(env.values()[k]) {
+			if err := filtered.Unset(k); err != nil {
+				return nil, err
+			}
+		}
+	}
+	filtered.readOnly = true
+	return filtered, nil
+}
+
+//TriggerSchedulerEnvVars implements the scheduler-env-vars trigger by writing the env resolved by
+// ResolveSchedulerEnv to output as `key\0value\0` records, sorted by key
+func TriggerSchedulerEnvVars(appName string, procType string, phase string, output io.Writer) error {
+	env, err := ResolveSchedulerEnv(appName, procType, phase)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(output)
+	for _, entry := range env.EntriesSorted() {
+		fmt.Fprintf(w, "%s\x00%s\x00", entry.Key, entry.Value)
+	}
+	return w.Flush()
+}
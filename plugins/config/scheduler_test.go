@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTriggerSchedulerEnvVars(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, pairs("MULTILINE", "a\nb"), false)).To(Succeed())
+
+	var out bytes.Buffer
+	Expect(TriggerSchedulerEnvVars(testAppName, "web", SchedulerPhaseDeploy, &out)).To(Succeed())
+	Expect(out.String()).To(Equal("MULTILINE\x00a\nb\x00globalKey\x00GLOBAL_VALUE\x00testKey\x00TESTING\x00"))
+
+	for _, phase := range []string{SchedulerPhaseBuild, SchedulerPhaseRun} {
+		var other bytes.Buffer
+		Expect(TriggerSchedulerEnvVars(testAppName, "", phase, &other)).To(Succeed())
+		Expect(other.String()).To(Equal(out.String()))
+	}
+
+	Expect(TriggerSchedulerEnvVars(testAppName, "web", "release", &out)).To(MatchError("Unknown phase release, expected one of build, deploy or run"))
+	Expect(TriggerSchedulerEnvVars(testAppName+"-missing", "web", SchedulerPhaseDeploy, &out)).NotTo(Succeed())
+}
+
+//dockerArgsInBash evaluates docker args the way scheduler-docker-local does, returning each arg
+func dockerArgsInBash(script string, records string) []string {
+	cmd := exec.Command("bash", "--noprofile", "--norc", "-c", script+`; eval "ARG_ARRAY=($DOCKER_ARGS)"; printf '%s\0' "${ARG_ARRAY[@]}"`)
+	cmd.Env = []string{"LC_ALL=C", "RECORDS=" + records}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	Expect(err).NotTo(HaveOccurred(), stderr.String())
+	return strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+}
+
+//TestSchedulerDockerArgsContract checks that docker-args-deploy hands the same env to containers
+// through the scheduler-env-vars trigger as it did by exporting the merged env as docker args
+func TestSchedulerDockerArgsContract(t *testing.T) {
+	RegisterTestingT(t)
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not available")
+	}
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	functions, err := ioutil.ReadFile("functions")
+	Expect(err).NotTo(HaveOccurred())
+	start := strings.Index(string(functions), "config_scheduler_docker_args() {")
+	Expect(start).To(BeNumerically(">=", 0))
+	end := strings.Index(string(functions)[start:], "\n}\n")
+	helper := string(functions)[start : start+end+2]
+
+	records, err := ioutil.TempFile("", "dokku-config-scheduler")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(records.Name())
+	records.Close()
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 20; i++ {
+		values := map[string]string{"testKey": randomValue(r)}
+		for j := 0; j < 4; j++ {
+			values[strings.Repeat("K", j+1)] = randomValue(r)
+		}
+		Expect(SetMany(testAppName, values, false)).To(Succeed())
+
+		merged, err := LoadMergedAppEnv(testAppName)
+		Expect(err).NotTo(HaveOccurred())
+		before := dockerArgsInBash("DOCKER_ARGS="+shellQuote(merged.Export(ExportFormatDockerArgs)), "")
+
+		var out bytes.Buffer
+		Expect(TriggerSchedulerEnvVars(testAppName, "web", SchedulerPhaseDeploy, &out)).To(Succeed())
+		Expect(ioutil.WriteFile(records.Name(), out.Bytes(), 0600)).To(Succeed())
+		after := dockerArgsInBash(helper+`; plugn() { cat "$RECORDS"; }; DOCKER_ARGS="$(config_scheduler_docker_args app web deploy)"`, records.Name())
+		Expect(after).To(Equal(before))
+	}
+}
+
+func shellQuote(value string) string {
+	return "'" + SingleQuoteEscape(value) + "'"
+}
+
+func TestResolveSchedulerEnvNoExport(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer os.Remove(globalConfigFile + ".meta.json")
+	Expect(SetMany(testAppName, pairs("HOOK_URL", "https://hooks.example.com", "globalKey", "APP_VALUE"), false)).To(Succeed())
+	Expect(Annotate(testAppName, "HOOK_URL", nil, []string{TagNoExport}, nil)).To(Succeed())
+	Expect(Annotate("", "globalKey", nil, []string{TagNoExport}, nil)).To(Succeed())
+	Expect(Annotate("", "testKey", nil, []string{TagNoExport}, nil)).To(Succeed())
+
+	env, err := ResolveSchedulerEnv(testAppName, "web", SchedulerPhaseDeploy)
+	Expect(err).NotTo(HaveOccurred())
+	//the tag of the global env does not apply to keys the app sets itself
+	Expect(env.Map()).To(Equal(pairs("globalKey", "APP_VALUE", "testKey", "TESTING")))
+
+	//tagged keys are still visible to everything else
+	value, ok := Get(testAppName, "HOOK_URL")
+	Expect(ok).To(BeTrue())
+	Expect(value).To(Equal("https://hooks.example.com"))
+
+	global, err := LoadGlobalEnv()
+	Expect(err).NotTo(HaveOccurred())
+	filtered, err := withoutNoExportKeys(global, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(filtered.Len()).To(Equal(0))
+}
+
+//TestComputeContainerEnv checks that containers started by dokku run get the env of a deployed
+// container of the same process type, which they once did not
+func TestComputeContainerEnv(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer os.Remove(globalConfigFile + ".meta.json")
+	Expect(ioutil.WriteFile(testAppDir+"/ENV.web", []byte("export WEB_CONCURRENCY='4'\nexport testKey='WEB'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(testAppDir+"/ENV.build", []byte("export BUILD_ONLY='1'\n"), 0600)).To(Succeed())
+	Expect(SetMany(testAppName, pairs("HOOK_URL", "https://hooks.example.com", "SELF", "@app:"+testAppName+":globalKey"), false)).To(Succeed())
+	Expect(Annotate(testAppName, "HOOK_URL", nil, []string{TagNoExport}, nil)).To(Succeed())
+
+	env, err := ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("SELF", "GLOBAL_VALUE", "WEB_CONCURRENCY", "4", "globalKey", "GLOBAL_VALUE", "testKey", "WEB")))
+	Expect(env.IsReadOnly()).To(BeTrue())
+
+	for _, phase := range []string{SchedulerPhaseDeploy, SchedulerPhaseRun} {
+		resolved, err := ResolveSchedulerEnv(testAppName, "web", phase)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Map()).To(Equal(env.Map()), phase)
+	}
+	var deployed, run bytes.Buffer
+	Expect(TriggerSchedulerEnvVars(testAppName, "web", SchedulerPhaseDeploy, &deployed)).To(Succeed())
+	Expect(TriggerSchedulerEnvVars(testAppName, "web", SchedulerPhaseRun, &run)).To(Succeed())
+	Expect(run.String()).To(Equal(deployed.String()))
+
+	//only the build sees ENV.build, and a container without a process type skips ENV.<proctype>
+	build, err := ResolveSchedulerEnv(testAppName, "web", SchedulerPhaseBuild)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(build.GetDefault("BUILD_ONLY", "")).To(Equal("1"))
+	env, err = ComputeContainerEnv(testAppName, "")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("SELF", "GLOBAL_VALUE", "globalKey", "GLOBAL_VALUE", "testKey", "TESTING")))
+
+	_, err = ComputeContainerEnv(testAppName, "../web")
+	Expect(err).To(MatchError("Invalid process type: '../web'"))
+}
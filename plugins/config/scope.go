@@ -0,0 +1,93 @@
+package config
+
+import (
+	"fmt"
+)
+
+//ScopeKind is the kind of env of the dokku install an Env belongs to, see Scope
+type ScopeKind int
+
+const (
+	//ScopeUnbound is an Env that belongs to no env of the dokku install, such as one parsed from a
+	// string, read from a file given with --file, or the template env. Its scope is never checked
+	ScopeUnbound ScopeKind = iota
+	//ScopeGlobal is the global env
+	ScopeGlobal
+	//ScopeApp is the env of an app, along with the ENV.<proctype> and ENV.build files next to it
+	ScopeApp
+	//ScopeMerged is an Env put together from envs of different scopes, such as the effective env of
+	// an app, which belongs to none of them and is never written
+	ScopeMerged
+)
+
+//Scope is the env of the dokku install an Env was loaded for. Writing an Env, or changing it on
+// behalf of an app or the global env, fails with an ErrScopeMismatch unless its scope is theirs
+type Scope struct {
+	Kind ScopeKind
+	//AppName is the app of an Env of ScopeApp
+	AppName string
+}
+
+func (s Scope) String() string {
+	switch s.Kind {
+	case ScopeGlobal:
+		return "the global env"
+	case ScopeApp:
+		return fmt.Sprintf("the env of %s", s.AppName)
+	case ScopeMerged:
+		return "a merged env"
+	}
+	return "an unbound env"
+}
+
+//scopeFor returns the scope of the env of an app, or of the global env if appName is empty
+func scopeFor(appName string) Scope {
+	if appName == "" || appName == "--global" {
+		return Scope{Kind: ScopeGlobal}
+	}
+	return Scope{Kind: ScopeApp, AppName: appName}
+}
+
+//scopeForName returns the scope of an env loaded under the given name, which is <global> for the
+// global env and the name of the app otherwise, see resolveAppOrGlobalFile
+func scopeForName(name string) Scope {
+	if name == "<global>" {
+		return scopeFor("")
+	}
+	return scopeFor(name)
+}
+
+//Scope returns the env of the dokku install this Env was loaded for
+func (e *Env) Scope() Scope {
+	return e.scope
+}
+
+//ErrScopeMismatch is returned instead of writing an Env, or changing it on behalf of an app or the
+// global env, that was loaded for another one or merged from several
+type ErrScopeMismatch struct {
+	//Expected is the scope of the operation, Actual that of the Env
+	Expected Scope
+	Actual   Scope
+}
+
+func (e *ErrScopeMismatch) Error() string {
+	return fmt.Sprintf("Refusing to use %s as %s", e.Actual, e.Expected)
+}
+
+//checkScope fails with an ErrScopeMismatch unless this Env was loaded for the app, or for the
+// global env if appName is empty
+func (e *Env) checkScope(appName string) error {
+	if expected := scopeFor(appName); e.scope != expected {
+		return &ErrScopeMismatch{Expected: expected, Actual: e.scope}
+	}
+	return nil
+}
+
+//mergeScope updates the scope of this Env once the keys of other were merged into it. Keys from an
+// unbound Env, such as one being imported, become part of this env, while an Env merged with one of
+// another scope belongs to neither of them
+func (e *Env) mergeScope(other *Env) {
+	if other.scope.Kind != ScopeUnbound && other.scope != e.scope {
+		e.scope = Scope{Kind: ScopeMerged}
+	}
+}
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"io/ioutil"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvScope(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	app, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(app.Scope()).To(Equal(Scope{Kind: ScopeApp, AppName: testAppName}))
+	global, err := LoadGlobalEnv()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(global.Scope()).To(Equal(Scope{Kind: ScopeGlobal}))
+	cached, err := LoadAppCached(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(cached.Scope()).To(Equal(app.Scope()))
+	Expect(app.Reload()).To(Succeed())
+	Expect(app.Scope()).To(Equal(Scope{Kind: ScopeApp, AppName: testAppName}))
+
+	parsed, err := NewFromStringWithName("imported", "A=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(parsed.Scope()).To(Equal(Scope{Kind: ScopeUnbound}))
+	snapshot, err := LoadAppEnv(testAppName, WithFile(testAppDir+"/ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(snapshot.Scope()).To(Equal(Scope{Kind: ScopeUnbound}))
+
+	effective, err := ResolveEffectiveEnv(testAppName, "web", SchedulerPhaseDeploy)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(effective.Env.Scope()).To(Equal(Scope{Kind: ScopeMerged}))
+}
+
+func TestEnvScopeMerge(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	//keys imported from an unbound env become part of the env of the app
+	app, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	imported, err := NewFromStringWithName("imported", "IMPORTED=1")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = app.MergeWith(imported, MergeOverwrite)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(app.Scope()).To(Equal(Scope{Kind: ScopeApp, AppName: testAppName}))
+	Expect(app.Write()).To(Succeed())
+
+	//while one merged with the global env belongs to neither, and is never written
+	global, err := LoadGlobalEnv()
+	Expect(err).NotTo(HaveOccurred())
+	app.Merge(global)
+	Expect(app.Scope()).To(Equal(Scope{Kind: ScopeMerged}))
+	err = app.Write()
+	Expect(err).To(Equal(&ErrScopeMismatch{Expected: Scope{Kind: ScopeApp, AppName: testAppName}, Actual: Scope{Kind: ScopeMerged}}))
+	Expect(err).To(MatchError("Refusing to use a merged env as the env of " + testAppName))
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("globalKey"))
+
+	//a failed merge leaves the scope alone
+	conflicting, err := LoadGlobalEnv()
+	Expect(err).NotTo(HaveOccurred())
+	app, err = LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = app.MergeWith(conflicting, MergeFail)
+	Expect(err).To(HaveOccurred())
+	Expect(app.Scope()).To(Equal(Scope{Kind: ScopeApp, AppName: testAppName}))
+}
+
+func TestEnvScopeMismatch(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	global, err := LoadGlobalEnv()
+	Expect(err).NotTo(HaveOccurred())
+	global.Set("testKey", "overwritten")
+	err = writeUpdate(testAppName, global, EnvDiff{Changed: []string{"testKey"}}, RestartPolicyNever)
+	Expect(err).To(MatchError("Refusing to use the global env as the env of " + testAppName))
+
+	app, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	err = writeUpdate("", app, EnvDiff{}, RestartPolicyNever)
+	Expect(err).To(Equal(&ErrScopeMismatch{Expected: Scope{Kind: ScopeGlobal}, Actual: Scope{Kind: ScopeApp, AppName: testAppName}}))
+	Expect(refreshRedactedSnapshot("--global", app)).To(MatchError("Refusing to use the env of " + testAppName + " as the global env"))
+	Expect(rewrapSealedValues("other-app", app)).To(MatchError("Refusing to use the env of " + testAppName + " as the env of other-app"))
+	parsed, err := NewFromStringWithName("imported", "A=1")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(rewrapSealedValues(testAppName, parsed)).To(MatchError("Refusing to use an unbound env as the env of " + testAppName))
+
+	//neither file was written
+	stored, ok := Get(testAppName, "testKey")
+	Expect(ok).To(BeTrue())
+	Expect(stored).To(Equal("TESTING"))
+	stored, ok = Get("--global", "testKey")
+	Expect(ok).To(BeTrue())
+	Expect(stored).To(Equal("GLOBAL_TESTING"))
+}
@@ -0,0 +1,308 @@
+package config
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+//sealedPrefix starts the stored form of a sealed value, which is followed by its ciphertext
+const sealedPrefix = "!sealed:"
+
+//sealedPlaceholder is shown in place of a sealed value wherever values are shown to people
+const sealedPlaceholder = "<sealed>"
+
+//SealedError is returned when a sealed value cannot be opened, because it was sealed with the key
+// of another host, was changed since, or is sealed for another app than it is read for
+type SealedError struct {
+	Key     string
+	Message string
+}
+
+func (e *SealedError) Error() string {
+	if e.Key == "" {
+		return e.Message
+	}
+	return fmt.Sprintf("Unable to unseal %s: %s", e.Key, e.Message)
+}
+
+//isSealed reports whether a value is stored sealed
+func isSealed(value string) bool {
+	return strings.HasPrefix(value, sealedPrefix)
+}
+
+//displayValue returns a value the way it is shown to people, which is as is unless it is sealed
+// or too large to be shown whole, see truncateForDisplay
+func displayValue(value string) string {
+	if isSealed(value) {
+		return sealedPlaceholder
+	}
+	return truncateForDisplay(value)
+}
+
+//sealingKeyFile returns where the host key values are sealed with is kept. It lives under
+// DOKKU_LIB_ROOT rather than next to the ENV files, so that a copy of an app dir or of a backup
+// of the ENV files does not hold the key to its sealed values
+func sealingKeyFile() (string, error) {
+	libRoot := os.Getenv("DOKKU_LIB_ROOT")
+	if libRoot == "" {
+		return "", errors.New("DOKKU_LIB_ROOT is not set, values cannot be sealed without the host key kept under it")
+	}
+	return filepath.Join(libRoot, "data", "config", "sealing.key"), nil
+}
+
+//sealingCipher returns the cipher values are sealed with, creating the host key on first use
+func sealingCipher() (cipher.AEAD, error) {
+	filename, err := sealingKeyFile()
+	if err != nil {
+		return nil, err
+	}
+	key, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+			return nil, err
+		}
+		err = writeFileSafe(filename, key, writeOptions{mode: 0600, noClobber: true, noFollow: true})
+		//another process created the key first, which is the one to use
+		if os.IsExist(err) {
+			key, err = ioutil.ReadFile(filename)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("%s does not hold a 32 byte key", filename)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+//sealValue returns the stored form of a value sealed for an app, or for the global env if appName
+// is empty. The name of the app is sealed along with the value, so that a value copied to another
+// app by hand is not opened for it, see rewrapSealedValue
+func sealValue(appName string, value string) (string, error) {
+	if len(appName) > 255 {
+		return "", fmt.Errorf("Unable to seal a value for %s, the name of the app is too long", appName)
+	}
+	gcm, err := sealingCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	payload := append([]byte{byte(len(appName))}, appName...)
+	payload = append(payload, nonce...)
+	payload = gcm.Seal(payload, nonce, []byte(value), []byte(appName))
+	return sealedPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+//openSealedValue returns the value a sealed value holds along with the app it was sealed for,
+// which is empty for the global env
+func openSealedValue(stored string) (appName string, value string, err error) {
+	gcm, err := sealingCipher()
+	if err != nil {
+		return "", "", err
+	}
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(stored, sealedPrefix))
+	if err != nil || len(payload) == 0 || len(payload) < 1+int(payload[0])+gcm.NonceSize() {
+		return "", "", &SealedError{Message: "the sealed value is malformed"}
+	}
+	appName = string(payload[1 : 1+payload[0]])
+	nonce := payload[1+len(appName) : 1+len(appName)+gcm.NonceSize()]
+	plain, err := gcm.Open(nil, nonce, payload[1+len(appName)+gcm.NonceSize():], []byte(appName))
+	if err != nil {
+		return "", "", &SealedError{Message: "the value was not sealed with the key of this host, or was changed since"}
+	}
+	return appName, string(plain), nil
+}
+
+//unsealValue returns the value a sealed value holds, failing unless it was sealed for one of the
+// given apps, where an empty name is the global env
+func unsealValue(key string, stored string, appNames ...string) (string, error) {
+	sealedFor, value, err := openSealedValue(stored)
+	if sealed, ok := err.(*SealedError); ok {
+		sealed.Key = key
+	}
+	if err != nil {
+		return "", err
+	}
+	for _, appName := range appNames {
+		if sealedFor == appName {
+			return value, nil
+		}
+	}
+	return "", &SealedError{Key: key, Message: fmt.Sprintf("it is sealed for %s, set it again with config:set to seal it for %s", Target{AppName: sealedFor}.Label(), Target{AppName: appNames[0]}.Label())}
+}
+
+//rewrapSealedValue returns a sealed value sealed again for an app, or for the global env if
+// appName is empty, if it was sealed for another one. Values that are not sealed are returned as is
+func rewrapSealedValue(appName string, key string, stored string) (string, error) {
+	if !isSealed(stored) {
+		return stored, nil
+	}
+	sealedFor, value, err := openSealedValue(stored)
+	if sealed, ok := err.(*SealedError); ok {
+		sealed.Key = key
+	}
+	if err != nil || sealedFor == appName {
+		return stored, err
+	}
+	return sealValue(appName, value)
+}
+
+//rewrapSealedEntries returns the entries to set for an app, or for the global env if appName is
+// empty, with the sealed values copied from another app sealed again for it
+func rewrapSealedEntries(appName string, entries map[string]string) (map[string]string, error) {
+	rewrapped := make(map[string]string, len(entries))
+	for k, v := range entries {
+		value, err := rewrapSealedValue(appName, k, v)
+		if err != nil {
+			return nil, err
+		}
+		rewrapped[k] = value
+	}
+	return rewrapped, nil
+}
+
+//rewrapSealedValues seals the sealed values of the env of an app, or of the global env if appName
+// is empty, again for it if they were sealed for another app, as they are once the ENV file of an
+// app is copied along with its app dir by a clone or a rename. env must have been loaded for it
+func rewrapSealedValues(appName string, env *Env) error {
+	if err := env.checkScope(appName); err != nil {
+		return err
+	}
+	for _, k := range env.sortKeys() {
+		value, err := rewrapSealedValue(appName, k, env.values()[k])
+		if err != nil {
+			return err
+		}
+		if value != env.values()[k] {
+			if err := env.Set(k, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+//unsealContainerValues opens the sealed values of the env of a container of an app, or of the
+// global env if appName is empty, in place. A value is only opened if it was sealed for the app or
+// the global env, or if it was reached through a reference, in which case it was sealed for the app
+// referenced. unresolved is the env before its references were resolved
+func unsealContainerValues(env *Env, unresolved *Env, appName string) error {
+	for _, k := range env.sortKeys() {
+		if !isSealed(env.values()[k]) {
+			continue
+		}
+		var value string
+		var err error
+		if _, _, ok := parseAppReference(unresolved.values()[k]); ok {
+			_, value, err = openSealedValue(env.values()[k])
+			if sealed, ok := err.(*SealedError); ok {
+				sealed.Key = k
+			}
+		} else {
+			value, err = unsealValue(k, env.values()[k], appName, "")
+		}
+		if err != nil {
+			return err
+		}
+		env.values()[k] = value
+	}
+	return nil
+}
+
+//SealMany sets the given values for an app, or for the global env if appName is empty, sealed with
+// the host key so that only the containers of the app get them as set, see ComputeContainerEnv.
+// Everything else, such as config:show and config:export, gets `!sealed:` followed by the
+// ciphertext, or <sealed> where values are shown to people. If restart is true the app is restarted
+func SealMany(appName string, entries map[string]string, restart bool) error {
+	sealed, err := sealEntries(appName, entries)
+	if err != nil {
+		return err
+	}
+	return SetMany(appName, sealed, restart)
+}
+
+//sealEntries returns the entries to set for an app, or for the global env if appName is empty, with
+// their values sealed for it
+func sealEntries(appName string, entries map[string]string) (map[string]string, error) {
+	sealed := make(map[string]string, len(entries))
+	for k, v := range entries {
+		if err := validateKey(k); err != nil {
+			return nil, err
+		}
+		value, err := sealValue(appName, v)
+		if err != nil {
+			return nil, err
+		}
+		sealed[k] = value
+	}
+	return sealed, nil
+}
+
+//Unseal returns the value a sealed key of an app, or of the global env if appName is empty, holds.
+// It is meant for the rare occasions a person needs to read it, which config:unseal only allows
+// root and dokku admins to, see checkAdmin. A key that is not sealed is a ValidationError
+func Unseal(appName string, key string) (string, error) {
+	if err := validateKey(key); err != nil {
+		return "", err
+	}
+	env, err := loadAppOrGlobalEnv(appName)
+	if err != nil {
+		return "", err
+	}
+	stored, ok := env.Get(key)
+	if !ok {
+		return "", fmt.Errorf("%s is not set for %s", key, env.name)
+	}
+	if !isSealed(stored) {
+		return "", &ValidationError{Message: fmt.Sprintf("%s is not sealed", key)}
+	}
+	return unsealValue(key, stored, appName)
+}
+
+//defaultAdminSSHNames are the names of the ssh keys allowed to run the commands reserved to admins
+// when the admin-ssh-names property is not set
+var defaultAdminSSHNames = []string{"admin"}
+
+//checkAdmin fails unless dokku is run by root, or over ssh with a key named exactly as one of the
+// names of the global admin-ssh-names property, admin by default
+func checkAdmin(action string) error {
+	sshUser := os.Getenv("SSH_USER")
+	if sshUser == "" {
+		sshUser = os.Getenv("USER")
+	}
+	if sshUser == "root" {
+		return nil
+	}
+	names := getListProperty("--global", "admin-ssh-names")
+	if len(names) == 0 {
+		names = defaultAdminSSHNames
+	}
+	if sshName := os.Getenv("SSH_NAME"); sshName != "" {
+		for _, name := range names {
+			if sshName == name {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("You must be root, or a dokku admin, to %s", action)
+}
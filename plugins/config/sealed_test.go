@@ -0,0 +1,161 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dokku/dokku/plugins/common"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestSealedValues(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+
+	Expect(SealMany(testAppName, pairs("SECRET", "hunter2"), false)).To(Succeed())
+	contents, err := ioutil.ReadFile(testAppDir + "/ENV")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).NotTo(ContainSubstring("hunter2"))
+	stored, ok := Get(testAppName, "SECRET")
+	Expect(ok).To(BeTrue())
+	Expect(stored).To(HavePrefix("!sealed:"))
+	info, err := os.Stat(filepath.Join(os.Getenv("DOKKU_LIB_ROOT"), "data", "config", "sealing.key"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(info.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+	//only the env of a container holds the value as set, and exports for containers leave it out
+	container, err := ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()).To(HaveKey("SECRET"))
+	Expect(container.Map()["SECRET"]).To(Equal("hunter2"))
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	exported, err := withoutNoExportKeys(env, testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(exported.Map()).NotTo(HaveKey("SECRET"))
+
+	value, err := Unseal(testAppName, "SECRET")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("hunter2"))
+	_, err = Unseal(testAppName, "testKey")
+	Expect(err).To(Equal(&ValidationError{Message: "testKey is not sealed"}))
+
+	//a sealed value set for another env is sealed again for it
+	Expect(SetMany("", pairs("COPIED", stored), false)).To(Succeed())
+	defer UnsetMany("", []string{"COPIED"}, false)
+	copied, _ := Get("", "COPIED")
+	Expect(copied).To(HavePrefix("!sealed:"))
+	Expect(copied).NotTo(Equal(stored))
+	value, err = Unseal("", "COPIED")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("hunter2"))
+
+	//one copied by hand is not opened for the app until it is
+	foreign, err := sealValue("other-app", "elsewhere")
+	Expect(err).NotTo(HaveOccurred())
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		return env.Set("FOREIGN", foreign)
+	})
+	Expect(err).NotTo(HaveOccurred())
+	_, err = ComputeContainerEnv(testAppName, "web")
+	Expect(err).To(MatchError("Unable to unseal FOREIGN: it is sealed for other-app, set it again with config:set to seal it for " + testAppName))
+	_, err = Update(testAppName, RestartPolicyNever, func(env *Env) error {
+		return rewrapSealedValues(testAppName, env)
+	})
+	Expect(err).NotTo(HaveOccurred())
+	container, err = ComputeContainerEnv(testAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()["FOREIGN"]).To(Equal("elsewhere"))
+
+	//a value that was changed is never opened
+	tampered := stored[:len(stored)-4] + "AAAA"
+	Expect(SetMany(testAppName, pairs("TAMPERED", tampered), false)).To(MatchError("Unable to unseal TAMPERED: the value was not sealed with the key of this host, or was changed since"))
+}
+
+func TestCopyAppConfigRewrapsSealedValues(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	defer setupTestProperties()()
+	Expect(SealMany(testAppName, pairs("SECRET", "hunter2"), false)).To(Succeed())
+	defer setupCopiedApp()()
+
+	_, err := ComputeContainerEnv(copiedAppName, "web")
+	Expect(err).To(HaveOccurred())
+	Expect(CopyAppConfig(testAppName, copiedAppName, false)).To(Succeed())
+	container, err := ComputeContainerEnv(copiedAppName, "web")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(container.Map()["SECRET"]).To(Equal("hunter2"))
+	value, err := Unseal(copiedAppName, "SECRET")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("hunter2"))
+}
+
+func TestShowSealedValues(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	defer setupTestProperties()()
+
+	output, err := runSubcommand(host, "set", "--no-restart", "--sealed", "web-app", "SECRET=hunter2")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("SECRET:  <sealed>"))
+	Expect(output).NotTo(ContainSubstring("hunter2"))
+
+	output, err = runSubcommand(host, "show", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("=====> web-app env vars\nKEY:     web-app\nSECRET:  <sealed>\n"))
+	output, err = runSubcommand(host, "export", "--format", "pretty", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("KEY:     web-app\nSECRET:  <sealed>\n"))
+	output, err = runSubcommand(host, "export", "--format", "envfile", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(ContainSubstring("SECRET=\"\\!sealed:"))
+	output, err = runSubcommand(host, "export", "--format", "envfile", "--container", "web-app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("KEY=\"web-app\"\n"))
+	output, err = runSubcommand(host, "get", "web-app", "SECRET")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(strings.HasPrefix(output, "!sealed:")).To(BeTrue())
+
+	_, err = runSubcommand(host, "set", "--sealed", "--provider", "git-rev", "web-app", "RELEASE_SHA")
+	Expect(err).To(Equal(&SubcommandError{Code: ExitStatusInvalid, Message: "--sealed cannot be combined with --provider or --preview"}))
+}
+
+func TestCheckAdmin(t *testing.T) {
+	RegisterTestingT(t)
+	for _, variable := range []string{"SSH_USER", "SSH_NAME"} {
+		defer os.Setenv(variable, os.Getenv(variable))
+	}
+
+	defer setupTestProperties()()
+
+	os.Setenv("SSH_USER", "dokku")
+	os.Setenv("SSH_NAME", "alice")
+	Expect(checkAdmin("unseal a value")).To(MatchError("You must be root, or a dokku admin, to unseal a value"))
+	os.Setenv("SSH_NAME", "admin")
+	Expect(checkAdmin("unseal a value")).To(Succeed())
+	//names merely holding admin are not admins
+	for _, name := range []string{"badminton", "alice-admin", "admins"} {
+		os.Setenv("SSH_NAME", name)
+		Expect(checkAdmin("unseal a value")).To(HaveOccurred(), name)
+	}
+
+	Expect(common.PropertyWrite("config", "--global", "admin-ssh-names", "alice, bob")).To(Succeed())
+	os.Setenv("SSH_NAME", "bob")
+	Expect(checkAdmin("unseal a value")).To(Succeed())
+	os.Setenv("SSH_NAME", "admin")
+	Expect(checkAdmin("unseal a value")).To(HaveOccurred())
+	os.Setenv("SSH_NAME", "")
+	Expect(checkAdmin("unseal a value")).To(HaveOccurred())
+
+	os.Setenv("SSH_USER", "root")
+	os.Setenv("SSH_NAME", "default")
+	Expect(checkAdmin("unseal a value")).To(Succeed())
+}
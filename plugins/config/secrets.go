@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+var (
+	privateKeyPattern   = regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY( BLOCK)?-----`)
+	awsAccessKeyPattern = regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)
+	sensitiveKeyPattern = regexp.MustCompile(`(?i)(SECRET|PASSWORD|PASSWD|TOKEN|PRIVATE|CREDENTIAL|API_?KEY|_KEY$|^KEY$)`)
+	tokenSeparator      = regexp.MustCompile(`[^A-Za-z0-9+/=_-]+`)
+
+	//auditIgnoredKeys are set by dokku itself and hold hashes rather than secrets
+	auditIgnoredKeys = map[string]bool{
+		"GIT_REV":        true,
+		"SOURCE_VERSION": true,
+	}
+)
+
+const (
+	//minEntropyTokenLength is the shortest token that is scored for entropy
+	minEntropyTokenLength = 20
+	//hexEntropyThreshold is the bits per character above which a hex token is reported
+	hexEntropyThreshold = 3.0
+	//base64EntropyThreshold is the bits per character above which any other token is reported
+	base64EntropyThreshold = 4.5
+)
+
+//IsSensitiveKey reports whether a key name suggests that its value is meant to be a secret
+func IsSensitiveKey(key string) bool {
+	return sensitiveKeyPattern.MatchString(key)
+}
+
+//DetectSecret returns the findings for a single value, none of which include the value itself
+func DetectSecret(key string, value string) []Finding {
+	findings := []Finding{}
+	if privateKeyPattern.MatchString(value) {
+		findings = append(findings, Finding{
+			Check:    "private-key",
+			Severity: SeverityWarning,
+			Key:      key,
+			Message:  fmt.Sprintf("Value of %s contains a PEM private key", key),
+		})
+	}
+	if awsAccessKeyPattern.MatchString(value) {
+		findings = append(findings, Finding{
+			Check:    "aws-access-key",
+			Severity: SeverityWarning,
+			Key:      key,
+			Message:  fmt.Sprintf("Value of %s contains an AWS access key id", key),
+		})
+	}
+	if len(findings) > 0 {
+		return findings
+	}
+	for _, token := range tokenSeparator.Split(value, -1) {
+		if len(token) < minEntropyTokenLength {
+			continue
+		}
+		entropy := shannonEntropy(token)
+		threshold := base64EntropyThreshold
+		if isHex(token) {
+			threshold = hexEntropyThreshold
+		}
+		if entropy > threshold {
+			findings = append(findings, Finding{
+				Check:    "high-entropy",
+				Severity: SeverityWarning,
+				Key:      key,
+				Message:  fmt.Sprintf("Value of %s contains a %d character string with %.1f bits of entropy per character", key, len(token), entropy),
+			})
+			break
+		}
+	}
+	return findings
+}
+
+//AuditSecrets scans the values of an Env for secrets. Keys tagged as secret, keys whose names
+// mark them as sensitive and keys in the allow list are skipped, as a secret is expected there
+func AuditSecrets(env *Env, allowed []string) []Finding {
+	skip := make(map[string]bool, len(allowed))
+	for _, k := range allowed {
+		skip[k] = true
+	}
+	findings := []Finding{}
+	for _, k := range env.sortKeys() {
+		if skip[k] || auditIgnoredKeys[k] || IsSensitiveKey(k) || env.KeyMetadata(k).HasTag(TagSecret) {
+			continue
+		}
+		findings = append(findings, DetectSecret(k, env.values()[k])...)
+	}
+	return findings
+}
+
+//AuditAppSecrets scans the env of an app, or the global env if appName is empty or --global,
+// skipping the keys listed in the audit-secrets-allow property
+func AuditAppSecrets(appName string) ([]Finding, error) {
+	env, err := loadAppOrGlobalEnv(appName)
+	if err != nil {
+		return nil, err
+	}
+	return AuditSecrets(env, getListProperty(appName, "audit-secrets-allow")), nil
+}
+
+//shannonEntropy returns the entropy of s in bits per character
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	total := 0
+	for _, r := range s {
+		counts[r]++
+		total++
+	}
+	entropy := 0.0
+	for _, count := range counts {
+		p := float64(count) / float64(total)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+func isHex(s string) bool {
+	return strings.Trim(s, "0123456789abcdefABCDEF") == ""
+}
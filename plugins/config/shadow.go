@@ -0,0 +1,60 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//maxShadowingApps is the number of apps named when warning that apps override a global key
+const maxShadowingApps = 5
+
+//shadowWarnings returns a warning for each of the keys being set whose value differs from the one
+// a container will see through the other env: for an app, the value set globally, and for the
+// global env, the values apps set themselves. Values are never included in the warnings
+func shadowWarnings(appName string, values map[string]string) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	warnings := []string{}
+	if appName != "" {
+		global, err := LoadGlobalEnv()
+		if err != nil {
+			return warnings
+		}
+		for _, k := range keys {
+			if value, ok := global.Get(k); ok && value != values[k] {
+				warnings = append(warnings, fmt.Sprintf("%s is also set globally to a different value, the value set for %s takes effect", k, appName))
+			}
+		}
+		return warnings
+	}
+
+	apps, _ := activeHost.Apps()
+	envs := make([]*Env, 0, len(apps))
+	for _, app := range apps {
+		if env, err := LoadAppEnv(app); err == nil {
+			envs = append(envs, env)
+		}
+	}
+	for _, k := range keys {
+		overriding := []string{}
+		for _, env := range envs {
+			if value, ok := env.Get(k); ok && value != values[k] {
+				overriding = append(overriding, env.Name())
+			}
+		}
+		if len(overriding) == 0 {
+			continue
+		}
+		names := strings.Join(overriding, ", ")
+		if len(overriding) > maxShadowingApps {
+			names = fmt.Sprintf("%s and %d more", strings.Join(overriding[:maxShadowingApps], ", "), len(overriding)-maxShadowingApps)
+		}
+		warnings = append(warnings, fmt.Sprintf("%s is set to a different value by %d app(s), which keep their own value: %s", k, len(overriding), names))
+	}
+	return warnings
+}
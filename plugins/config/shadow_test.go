@@ -0,0 +1,41 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestShadowWarnings(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	Expect(shadowWarnings(testAppName, pairs("globalKey", "other", "testKey", "GLOBAL_TESTING", "NEW_KEY", "value"))).To(Equal([]string{
+		"globalKey is also set globally to a different value, the value set for test-app-1 takes effect",
+	}))
+	Expect(shadowWarnings(testAppName, pairs("globalKey", "GLOBAL_VALUE"))).To(BeEmpty())
+
+	Expect(shadowWarnings("", pairs("testKey", "TESTING", "globalKey", "other"))).To(BeEmpty())
+	Expect(shadowWarnings("", pairs("testKey", "other"))).To(Equal([]string{
+		"testKey is set to a different value by 1 app(s), which keep their own value: test-app-1",
+	}))
+
+	for i := 0; i < maxShadowingApps+1; i++ {
+		dir := strings.Join([]string{dokkuRoot, fmt.Sprintf("test-app-shadow-%d", i)}, "/")
+		Expect(os.MkdirAll(dir, 0766)).To(Succeed())
+		defer os.RemoveAll(dir)
+		Expect(SetMany(fmt.Sprintf("test-app-shadow-%d", i), pairs("testKey", "SHADOW"), false)).To(Succeed())
+	}
+	warnings := shadowWarnings("", pairs("testKey", "SHADOW"))
+	Expect(warnings).To(Equal([]string{
+		"testKey is set to a different value by 1 app(s), which keep their own value: test-app-1",
+	}))
+	warnings = shadowWarnings("", pairs("testKey", "other"))
+	Expect(warnings).To(HaveLen(1))
+	Expect(warnings[0]).To(HavePrefix("testKey is set to a different value by 7 app(s), which keep their own value: "))
+	Expect(warnings[0]).To(HaveSuffix(" and 2 more"))
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+//shellVerifyTimeout bounds how long bash may take to check or evaluate an export
+const shellVerifyTimeout = 30 * time.Second
+
+//shellVerifyScript evals the export read on stdin in bash, then lists on stdout the variables the
+// eval defined as +NAME, and the value of each name given as argument as =VALUE, or - if unset.
+// Anything the export itself prints is discarded, and the variables of the script are left out.
+// The first command lets bash define PIPESTATUS before the variables are listed
+const shellVerifyScript = `:
+__dokku_before=$'\n'"$(compgen -v)"$'\n'
+eval "$(cat)" >/dev/null || exit 97
+for __dokku_k in $(compgen -v); do
+  case "$__dokku_before" in *$'\n'"$__dokku_k"$'\n'*) ;; *) printf '+%s\0' "$__dokku_k" ;; esac
+done
+for __dokku_k in "$@"; do
+  if [[ -v $__dokku_k ]]; then printf '=%s\0' "${!__dokku_k}"; else printf '%s\0' -; fi
+done`
+
+//ShellVerifyError is returned by VerifyShellExport when evaluating an export in bash does not
+// give back the values it was made from. It names keys, never values
+type ShellVerifyError struct {
+	//Mismatched are set to another value than expected
+	Mismatched []string
+	//Unset are expected but left unset
+	Unset []string
+	//Unexpected are set by the export but not expected
+	Unexpected []string
+}
+
+func (e *ShellVerifyError) Error() string {
+	problems := []string{}
+	if len(e.Mismatched) > 0 {
+		problems = append(problems, fmt.Sprintf("sets %s to another value", strings.Join(e.Mismatched, ", ")))
+	}
+	if len(e.Unset) > 0 {
+		problems = append(problems, fmt.Sprintf("leaves %s unset", strings.Join(e.Unset, ", ")))
+	}
+	if len(e.Unexpected) > 0 {
+		problems = append(problems, fmt.Sprintf("sets %s, which is not exported", strings.Join(e.Unexpected, ", ")))
+	}
+	return fmt.Sprintf("Evaluating the export in bash %s", strings.Join(problems, " and "))
+}
+
+//VerifyShellExport checks an export in the exports or shell format with bash -n, and with eval
+// also evaluates it in a clean bash, failing unless every variable it defines is one of expected
+// and set to its value. bash is run without a profile, rc files or the environment of the caller.
+// Errors name the keys at fault, but neither bash output nor values, which may be secrets
+func VerifyShellExport(exported string, expected map[string]string, eval bool) error {
+	if _, err := exec.LookPath("bash"); err != nil {
+		return errors.New("Verifying an export requires bash")
+	}
+	if _, err := runVerifyShell(exported, "-n"); err != nil {
+		return errors.New("The export is not valid shell syntax, as checked by bash -n")
+	}
+	if !eval {
+		return nil
+	}
+
+	keys := make([]string, 0, len(expected))
+	for k := range expected {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out, err := runVerifyShell(exported, append([]string{"-c", shellVerifyScript, "bash"}, keys...)...)
+	if err != nil {
+		return fmt.Errorf("Evaluating the export in bash failed: %s", err.Error())
+	}
+
+	failure := &ShellVerifyError{}
+	entries := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	i := 0
+	for ; i < len(entries) && strings.HasPrefix(entries[i], "+"); i++ {
+		name := entries[i][1:]
+		if _, ok := expected[name]; !ok && !strings.HasPrefix(name, "__dokku_") {
+			failure.Unexpected = append(failure.Unexpected, name)
+		}
+	}
+	values := entries[i:]
+	if len(values) != len(keys) {
+		return fmt.Errorf("Evaluating the export in bash failed: read %d value(s) for %d key(s)", len(values), len(keys))
+	}
+	for j, k := range keys {
+		switch {
+		case values[j] == "-":
+			failure.Unset = append(failure.Unset, k)
+		case values[j][1:] != expected[k]:
+			failure.Mismatched = append(failure.Mismatched, k)
+		}
+	}
+	if len(failure.Mismatched) > 0 || len(failure.Unset) > 0 || len(failure.Unexpected) > 0 {
+		sort.Strings(failure.Unexpected)
+		return failure
+	}
+	return nil
+}
+
+//runVerifyShell runs bash with args and the export on stdin, returning what it prints on stdout
+func runVerifyShell(exported string, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellVerifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "bash", append([]string{"--noprofile", "--norc"}, args...)...)
+	cmd.Env = []string{"LC_ALL=C"}
+	cmd.Stdin = strings.NewReader(exported)
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timed out after %s", shellVerifyTimeout)
+		}
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
+
+//shellExportValues returns the values the exports and shell formats set with opts, keyed by the
+// name each key is exported as
+func (e *Env) shellExportValues(opts ExportOptions) map[string]string {
+	values := make(map[string]string, len(e.values()))
+	for k, v := range e.values() {
+		if opts.KeyTransform != nil {
+			k = opts.KeyTransform(k)
+		}
+		values[k] = v
+	}
+	return values
+}
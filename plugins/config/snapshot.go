@@ -0,0 +1,14 @@
+package config
+
+//loadSnapshot reads a copy of an ENV file kept outside of any dokku install, as loaded with
+// WithFile. The Env is named after the file and keeps it to read key metadata from, but is
+// read-only so that nothing, not even dropping invalid keys, is ever written back
+func loadSnapshot(filename string) (*Env, error) {
+	env, err := LoadEnvFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	env.filename = filename
+	env.readOnly = true
+	return env, nil
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestLoadWithFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-snapshot")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("export B='2'\nexport A='1'\n"), 0600)).To(Succeed())
+
+	//DOKKU_ROOT is never used, so neither it nor the app has to exist
+	previous := os.Getenv("DOKKU_ROOT")
+	os.Unsetenv("DOKKU_ROOT")
+	defer os.Setenv("DOKKU_ROOT", previous)
+
+	for _, load := range []func() (*Env, error){
+		func() (*Env, error) { return LoadAppEnv("missing-app", WithFile(filename)) },
+		func() (*Env, error) { return LoadGlobalEnv(WithFile(filename)) },
+	} {
+		env, err := load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env.Name()).To(Equal(filename))
+		Expect(env.Map()).To(Equal(pairs("A", "1", "B", "2")))
+		Expect(env.OrderedKeys()).To(Equal([]string{"B", "A"}))
+		Expect(env.IsReadOnly()).To(BeTrue())
+		Expect(env.Set("C", "3")).To(MatchError(ErrReadOnlyEnv))
+		Expect(env.Write()).To(MatchError(ErrReadOnlyEnv))
+	}
+
+	_, err = LoadMergedAppEnv("missing-app", WithFile(filename))
+	Expect(err).To(MatchError("Unable to merge " + filename + " with the global env, it is not part of a dokku install"))
+	_, err = LoadGlobalEnv(WithFile(filepath.Join(dir, "missing")))
+	Expect(os.IsNotExist(err)).To(BeTrue())
+
+	//invalid keys are dropped from the env of an app, but a file given with WithFile is never written
+	Expect(ioutil.WriteFile(filename, []byte("export A='1'\nexport 1BAD='2'\n"), 0600)).To(Succeed())
+	_, err = LoadGlobalEnv(WithFile(filename))
+	Expect(err).To(MatchError("Unable to parse " + filename + ": Invalid key name: '1BAD'"))
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("export A='1'\nexport 1BAD='2'\n"))
+}
+
+func TestRunSubcommandWithFile(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	from := filepath.Join(host.root, "from.env")
+	to := filepath.Join(host.root, "to.env")
+	Expect(ioutil.WriteFile(from, []byte("export KEY='a'\nexport GONE='1'\nexport SAME='x'\n"), 0600)).To(Succeed())
+	Expect(ioutil.WriteFile(to, []byte("KEY=b\nNEW=1\nSAME=x\n"), 0600)).To(Succeed())
+
+	output, err := runSubcommand(host, "export", "--file", from, "--format", "envfile")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(output).To(Equal("GONE=\"1\"\nKEY=\"a\"\nSAME=\"x\"\n"))
+
+	output, err = runSubcommand(host, "diff", "--file", from, "--file", to)
+	Expect(err).To(Equal(&SubcommandError{Code: 1}))
+	Expect(output).To(ContainSubstring("added:    NEW"))
+	Expect(output).To(ContainSubstring("removed:  GONE"))
+	Expect(output).To(ContainSubstring("changed:  KEY"))
+	Expect(output).NotTo(ContainSubstring("SAME"))
+
+	_, err = runSubcommand(host, "diff", "--file", from, "--file", from)
+	Expect(err).NotTo(HaveOccurred())
+
+	for _, tc := range []struct {
+		name     string
+		argv     []string
+		expected SubcommandError
+	}{
+		{"diff", []string{"--file", from}, SubcommandError{Code: 2, Message: "Expected: --file <path> --file <path>"}},
+		{"export", []string{"--file", from, "--merged"}, SubcommandError{Code: 2, Message: "--merged cannot be combined with --file"}},
+		{"export", []string{"--file", from, "--container"}, SubcommandError{Code: 2, Message: "--container cannot be combined with --file"}},
+		{"export", []string{"--file", from, "--app", "web-app"}, SubcommandError{Code: 2, Message: "--file cannot be combined with --global or --app"}},
+		{"export", []string{"--file", from, "web-app"}, SubcommandError{Code: 2, Message: "Trailing argument(s): [web-app]"}},
+		//write subcommands do not read an env from a file
+		{"set", []string{"--file", from, "KEY=c"}, SubcommandError{Code: 2}},
+		{"unset", []string{"--file", from, "KEY"}, SubcommandError{Code: 2}},
+	} {
+		_, err := runSubcommand(host, tc.name, tc.argv...)
+		Expect(err).To(Equal(&tc.expected), tc.name)
+	}
+	contents, err := ioutil.ReadFile(from)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("export KEY='a'\nexport GONE='1'\nexport SAME='x'\n"))
+}
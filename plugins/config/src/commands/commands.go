@@ -20,13 +20,47 @@ Display all global or app-specific config vars
 Additional commands:`
 
 	helpContent = `
-    config (<app>|--global), Pretty-print an app or global environment
-    config:get (<app>|--global) KEY, Display a global or app-specific config value
-    config:set [--encoded] [--no-restart] (<app>|--global) KEY1=VALUE1 [KEY2=VALUE2 ...], Set one or more config vars
-    config:unset [--no-restart] (<app>|--global) KEY1 [KEY2 ...], Unset one or more config vars
-    config:export (<app>|--global) [--envfile], Export a global or app environment
+    config [--merged] [--provenance] [--warnings-as-errors] [--redacted-public] (<app>|--global|--file <path>) [KEY ...], Pretty-print an app or global environment, or who last changed its keys
+    config:get [--quoted|--null|--raw] [--first [--verbose]] [--merged] (<app>|--global) KEY [KEY ...], Display a global or app-specific config value
+    config:get-and-unset [--restart|--no-restart] (<app>|--global) KEY, Print a config value and unset it in one change
+    config:verify (<app>|--global) KEY, Exit zero if a config value matches the one read from stdin, without printing it
+    config:unseal (<app>|--global) KEY, Print the value of a sealed config var, for root and dokku admins only
+    config:set [--encoded] [--restart|--no-restart] [--ttl <duration>] [--provider <name>] [--sealed] [--skip-validation] [--quiet] [--stdin-pairs] [--literal|--trim|--strip-quotes] [--preview [--format text|json]] (<app>|--global) KEY1=VALUE1 [KEY2=VALUE2 ...], Set one or more config vars
+    config:unset [--restart|--no-restart] [--strict] (<app>|--global) KEY1 [KEY2 ...], Unset one or more config vars
+    config:export (<app>|--global|--file <path>|--all-apps [--show-values]) [--envfile] [--ordered] [--quoting <style>] [--key-transform <case>] [--key-prefix <prefix>] [--key-strip-prefix <prefix>] [--separator <sep>] [--lowercase] [--container] [--warnings-as-errors] [--if-changed-since <checksum>] [--eval-safe|--eval-compare] [--guarded] [--output <path> [--force]], Export a global or app environment
     config:keys (<app>|--global) [--merged], Show keys set in environment
-    config:bundle (<app>|--global) [--merged], Bundle environment into tarfile
+    config:diff --file <path> --file <path>, Show the keys that differ between two ENV files
+    config:bundle (<app>|--global) [--merged] [--container] [--exclude <pattern>]... [--include-only <pattern>]... [--gzip] [--output <path> [--force]], Bundle environment into tarfile
+    config:set-property [--migrate] (<app>|--global) <property> (<value>), Set or clear a config property for an app
+    config:size (<app>|--global), Show the size of an environment against its limits
+    config:lint [--format text|json] [--strict] (<app>|--global), Check an environment for common mistakes
+    config:audit-permissions (<app>|--global), Check that the files of an environment can be written
+    config:audit-secrets [--format text|json] (<app>|--global), Scan an environment for values that look like secrets
+    config:release-diff [--format text|json] <app> <release> <release>, Show the config keys that changed between two releases
+    config:pending <app>, Show the config keys changed since the app was last deployed or restarted
+    config:redaction:disable <app>, Stop handing the secret values of an app to plugins that scrub them from output
+    config:redaction:enable <app>, Hand the secret values of an app to plugins that scrub them from output
+    config:restart-scope <app>, Show the process types restarted when matching keys change
+    config:restart-scope:set <app> <pattern> <process-type> [<process-type> ...], Restart only the given process types when keys matching a pattern change
+    config:restart-scope:unset <app> <pattern>, Remove the restart scope for a key pattern
+    config:drift --file <path> [--ignore <pattern>]... [--merged] [--apply] [--restart|--no-restart] (<app>|--global), Compare the config with an env file, or change it to match
+    config:expire-check [--all] [--restart|--no-restart] (<app>|--global), Unset config vars whose --ttl has passed
+    config:history:prune (<app>|--global|--all), Remove release snapshots beyond config-history-limit and rotate audit logs past config-audit-max-size
+    config:annotate [--description <text>] [--tag <tag>] [--untag <tag>] [--clear] (<app>|--global) KEY, Describe and tag a config key
+    config:import --from heroku-json|heroku-text|docker-envfile [--strip <pattern>]... [--restart|--no-restart] [--warnings-as-errors] (<app>|--global), Set the config vars exported by heroku config or docker, read from stdin
+    config:migrate-format [--to <version>] [--transcode latin1|replace] (<app>|--global|--all), Upgrade ENV files to a newer format version, keeping backups
+    config:convert --to envfile|exportfile (<app>|--global), Rewrite an ENV file as an envfile or an exportfile, keeping a backup
+    config:plugin <plugin> <app>, Show the config a plugin keeps for an app, apart from its env
+    config:report [<app>] [--format stdout|json] [<flag>], Displays a config report for one or more apps
+    config:resolve [--process <type>] [--phase build|deploy|run] (<app>|--global) KEY, Show the layers and app references a value is resolved through
+    config:notifications:add (<app>|--global) <url>, POST the names of changed config vars to a url after every change
+    config:notifications:list (<app>|--global), List the urls notified of config changes
+    config:notifications:remove (<app>|--global) <url>, Stop notifying a url of config changes
+    config:template:apply [--restart|--no-restart] <app>, Add the keys of the config template that an app does not have yet
+    config:template:set KEY1=VALUE1 [KEY2=VALUE2 ...], Set config vars applied to every new app
+    config:template:show, Show the config vars applied to every new app
+    config:template:unset KEY1 [KEY2 ...], Remove config vars from the template applied to new apps
+    config:prune [--confirm] [--restart|--no-restart] (<app>|--global), List config vars with an empty value, or unset them with --confirm
 `
 )
 
@@ -37,13 +71,79 @@ func main() {
 	cmd := flag.Arg(0)
 	switch cmd {
 	case "config", "config:show":
-		args := flag.NewFlagSet("config:show", flag.ExitOnError)
-		global := args.Bool("global", false, "--global: use the global environment")
-		shell := args.Bool("shell", false, "--shell: in a single-line for usage in command-line utilities [deprecated]")
-		export := args.Bool("export", false, "--export: print the env as eval-compatible exports [deprecated]")
-		merged := args.Bool("merged", false, "--merged: display the app's environment merged with the global environment")
+		config.MainSubcommand("show")
+	case "config:redaction:enable":
+		args := flag.NewFlagSet("config:redaction:enable", flag.ExitOnError)
+		config.AddQuietFlag(args)
 		args.Parse(os.Args[2:])
-		config.CommandShow(args.Args(), *global, *shell, *export, *merged)
+		config.CommandRedactionEnable(args.Args())
+	case "config:redaction:disable":
+		args := flag.NewFlagSet("config:redaction:disable", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandRedactionDisable(args.Args())
+	case "config:restart-scope":
+		args := flag.NewFlagSet("config:restart-scope", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandRestartScope(args.Args())
+	case "config:restart-scope:set":
+		args := flag.NewFlagSet("config:restart-scope:set", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandRestartScopeSet(args.Args())
+	case "config:restart-scope:unset":
+		args := flag.NewFlagSet("config:restart-scope:unset", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandRestartScopeUnset(args.Args())
+	case "config:notifications:add":
+		args := flag.NewFlagSet("config:notifications:add", flag.ExitOnError)
+		target := config.AddTargetFlags(args)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandNotificationsAdd(args.Args(), *target)
+	case "config:notifications:list":
+		args := flag.NewFlagSet("config:notifications:list", flag.ExitOnError)
+		target := config.AddTargetFlags(args)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandNotificationsList(args.Args(), *target)
+	case "config:notifications:remove":
+		args := flag.NewFlagSet("config:notifications:remove", flag.ExitOnError)
+		target := config.AddTargetFlags(args)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandNotificationsRemove(args.Args(), *target)
+	case "config:history:prune":
+		args := flag.NewFlagSet("config:history:prune", flag.ExitOnError)
+		target := config.AddTargetFlags(args)
+		config.AddQuietFlag(args)
+		all := args.Bool("all", false, "--all: prune the history of the global env and of every app")
+		args.Parse(os.Args[2:])
+		config.CommandHistoryPrune(args.Args(), *target, *all)
+	case "config:template:apply":
+		args := flag.NewFlagSet("config:template:apply", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+		noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+		args.Parse(os.Args[2:])
+		config.CommandTemplateApply(args.Args(), *restart, *noRestart)
+	case "config:template:set":
+		args := flag.NewFlagSet("config:template:set", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandTemplateSet(args.Args())
+	case "config:template:show":
+		args := flag.NewFlagSet("config:template:show", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandTemplateShow(args.Args())
+	case "config:template:unset":
+		args := flag.NewFlagSet("config:template:unset", flag.ExitOnError)
+		config.AddQuietFlag(args)
+		args.Parse(os.Args[2:])
+		config.CommandTemplateUnset(args.Args())
 	case "config:help":
 		usage()
 	case "help":
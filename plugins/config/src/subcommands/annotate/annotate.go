@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+//tagList collects the values of a flag that may be given more than once
+type tagList []string
+
+func (t *tagList) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagList) Set(value string) error {
+	*t = append(*t, value)
+	return nil
+}
+
+// describe and tag a config key
+func main() {
+	var tags, untags tagList
+	args := flag.NewFlagSet("config:annotate", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	description := args.String("description", "", "--description: a short description of the key, empty to remove it")
+	args.Var(&tags, "tag", "--tag: add a tag such as secret to the key, may be given more than once")
+	args.Var(&untags, "untag", "--untag: remove a tag from the key, may be given more than once")
+	clear := args.Bool("clear", false, "--clear: remove the description and all tags of the key")
+	args.Parse(os.Args[2:])
+
+	descriptionSet := false
+	args.Visit(func(f *flag.Flag) {
+		if f.Name == "description" {
+			descriptionSet = true
+		}
+	})
+	if !descriptionSet {
+		description = nil
+	}
+	config.CommandAnnotate(args.Args(), *target, description, tags, untags, *clear)
+}
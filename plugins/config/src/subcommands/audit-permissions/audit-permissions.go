@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// check that the files of an environment can be written
+func main() {
+	args := flag.NewFlagSet("config:audit-permissions", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandAuditPermissions(args.Args(), *target)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// scan an environment for values that look like secrets
+func main() {
+	args := flag.NewFlagSet("config:audit-secrets", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	format := args.String("format", "text", "--format: [ text | json ] which format to report findings in")
+	args.Parse(os.Args[2:])
+	config.CommandAuditSecrets(args.Args(), *target, *format)
+}
@@ -1,16 +1,10 @@
 package main
 
 import (
-	"flag"
-	"os"
-
 	"github.com/dokku/dokku/plugins/config"
 )
 
+// write a tarfile of the environment to stdout
 func main() {
-	args := flag.NewFlagSet("config:bundle", flag.ExitOnError)
-	global := args.Bool("global", false, "--global: use the global environment")
-	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
-	args.Parse(os.Args[2:])
-	config.CommandBundle(args.Args(), *global, *merged)
+	config.MainSubcommand("bundle")
 }
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// rewrite an ENV file as an envfile or an exportfile
+func main() {
+	args := flag.NewFlagSet("config:convert", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	to := args.String("to", "", "--to: [ envfile | exportfile ] the file format to rewrite the ENV file in")
+	args.Parse(os.Args[2:])
+	config.CommandConvert(args.Args(), *target, *to)
+}
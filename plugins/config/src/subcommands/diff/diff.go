@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// compare two ENV files outside of any dokku install
+func main() {
+	config.MainSubcommand("diff")
+}
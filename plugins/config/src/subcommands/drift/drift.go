@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+//patternList collects the values of a flag that may be given more than once
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// compare an environment against a reference env file
+func main() {
+	var ignore patternList
+	args := flag.NewFlagSet("config:drift", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	file := args.String("file", "", "--file: the env file holding the desired config")
+	args.Var(&ignore, "ignore", "--ignore: skip keys matching a glob pattern such as 'DOKKU_*', may be given more than once")
+	merged := args.Bool("merged", false, "--merged: compare the app's environment merged with the global environment")
+	apply := args.Bool("apply", false, "--apply: change the environment to match the file")
+	restart := args.Bool("restart", false, "--restart: restart after --apply even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart after --apply")
+	format := args.String("format", "text", "--format: [ text | json ] how to print the keys that differ")
+	showValues := args.Bool("show-values", false, "--show-values: include the values in the json format, which only holds their checksums otherwise")
+	failOn := args.String("fail-on", "added,removed,changed", "--fail-on: the kinds of drift that make the command exit non-zero, a list of added (missing), removed (extra) and changed (different)")
+	args.Parse(os.Args[2:])
+	config.CommandDrift(args.Args(), *target, config.DriftCommandOptions{
+		File:       *file,
+		Ignore:     ignore,
+		Merged:     *merged,
+		Apply:      *apply,
+		Restart:    *restart,
+		NoRestart:  *noRestart,
+		Format:     *format,
+		ShowValues: *showValues,
+		FailOn:     *failOn,
+	})
+}
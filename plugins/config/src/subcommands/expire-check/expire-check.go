@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// unset the config keys that have expired
+func main() {
+	args := flag.NewFlagSet("config:expire-check", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	all := args.Bool("all", false, "--all: check the global environment and every app")
+	restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+	args.Parse(os.Args[2:])
+	config.CommandExpireCheck(args.Args(), *target, *all, *restart, *noRestart)
+}
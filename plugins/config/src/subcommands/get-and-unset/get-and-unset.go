@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// print a config value and unset it
+func main() {
+	args := flag.NewFlagSet("config:get-and-unset", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	restart := args.Bool("restart", false, "--restart: restart the app once the key is unset")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart, even if config-restart-policy says otherwise")
+	args.Parse(os.Args[2:])
+	config.CommandGetAndUnset(args.Args(), *target, *restart, *noRestart)
+}
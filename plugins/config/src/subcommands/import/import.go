@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+//patternList collects the values of a flag that may be given more than once
+type patternList []string
+
+func (p *patternList) String() string {
+	return strings.Join(*p, ",")
+}
+
+func (p *patternList) Set(value string) error {
+	*p = append(*p, value)
+	return nil
+}
+
+// import config vars exported by another platform from stdin
+func main() {
+	var strip patternList
+	args := flag.NewFlagSet("config:import", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	from := args.String("from", "", "--from: [ heroku-json | heroku-text | docker-envfile ] the format of stdin, the output of `heroku config --json` or `heroku config`, or a file for docker run --env-file")
+	args.Var(&strip, "strip", "--strip: skip keys matching a glob pattern instead of HEROKU_*, may be given more than once")
+	restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+	warningsAsErrors := args.Bool("warnings-as-errors", false, "--warnings-as-errors: fail if the ENV file or stdin holds lines that are not read as they are written")
+	skipValidation := args.Bool("skip-validation", false, "--skip-validation: import values that plugins refuse through the config-validate-value trigger")
+	onConflict := args.String("on-conflict", "overwrite", "--on-conflict: [ overwrite | keep | fail | interactive ] what to do with keys already set to another value")
+	args.Parse(os.Args[2:])
+	config.CommandImport(args.Args(), *target, config.ImportCommandOptions{
+		From:             *from,
+		Strip:            strip,
+		Restart:          *restart,
+		NoRestart:        *noRestart,
+		WarningsAsErrors: *warningsAsErrors,
+		SkipValidation:   *skipValidation,
+		OnConflict:       *onConflict,
+	})
+}
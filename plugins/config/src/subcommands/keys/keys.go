@@ -1,16 +1,10 @@
 package main
 
 import (
-	"flag"
-	"os"
-
 	"github.com/dokku/dokku/plugins/config"
 )
 
+// print the keys of the environment to stdout
 func main() {
-	args := flag.NewFlagSet("config:keys", flag.ExitOnError)
-	global := args.Bool("global", false, "--global: use the global environment")
-	merged := args.Bool("merged", false, "--merged: merge app environment and global environment")
-	args.Parse(os.Args[2:])
-	config.CommandKeys(args.Args(), *global, *merged)
+	config.MainSubcommand("keys")
 }
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// check an environment for common mistakes
+func main() {
+	args := flag.NewFlagSet("config:lint", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	format := args.String("format", "text", "--format: [ text | json ] which format to report findings in")
+	strict := args.Bool("strict", false, "--strict: exit non-zero on warnings as well as errors")
+	args.Parse(os.Args[2:])
+	config.CommandLint(args.Args(), *target, *format, *strict)
+}
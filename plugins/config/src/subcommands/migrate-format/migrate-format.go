@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// upgrade an ENV file to a newer format version
+func main() {
+	args := flag.NewFlagSet("config:migrate-format", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	to := args.Int("to", config.EnvFormatVersion, "--to: the ENV format version to upgrade to, defaults to the latest")
+	transcode := args.String("transcode", "", "--transcode: [ latin1 | replace ] rewrite values that are not valid UTF-8 as latin1, or replacing their invalid bytes, after backing up the file")
+	all := args.Bool("all", false, "--all: upgrade the global ENV file and those of every app")
+	args.Parse(os.Args[2:])
+	config.CommandMigrateFormat(args.Args(), *target, *to, *transcode, *all)
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// report whether the config of an app changed since it was last deployed or restarted
+func main() {
+	args := flag.NewFlagSet("config:pending", flag.ExitOnError)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandPending(args.Args())
+}
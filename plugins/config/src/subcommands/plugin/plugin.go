@@ -0,0 +1,16 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// display the config a plugin keeps for an app
+func main() {
+	args := flag.NewFlagSet("config:plugin", flag.ExitOnError)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandPlugin(args.Args())
+}
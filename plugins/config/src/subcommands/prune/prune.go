@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// list or unset the config keys whose value is empty
+func main() {
+	args := flag.NewFlagSet("config:prune", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	confirm := args.Bool("confirm", false, "--confirm: unset the empty keys instead of listing them")
+	restart := args.Bool("restart", false, "--restart: restart even if config-restart-policy says otherwise")
+	noRestart := args.Bool("no-restart", false, "--no-restart: no restart")
+	args.Parse(os.Args[2:])
+	config.CommandPrune(args.Args(), *target, *confirm, *restart, *noRestart)
+}
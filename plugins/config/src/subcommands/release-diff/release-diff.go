@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// show the config keys that changed between two releases
+func main() {
+	args := flag.NewFlagSet("config:release-diff", flag.ExitOnError)
+	config.AddQuietFlag(args)
+	format := args.String("format", "text", "--format: [ text | json ] which format to show the differences in")
+	args.Parse(os.Args[2:])
+	config.CommandReleaseDiff(args.Args(), *format)
+}
@@ -0,0 +1,10 @@
+package main
+
+import (
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// displays a config report for one or more apps
+func main() {
+	config.MainSubcommand("report")
+}
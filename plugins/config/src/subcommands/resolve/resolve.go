@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// show the layers and app references the value of a key is resolved through
+func main() {
+	args := flag.NewFlagSet("config:resolve", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	procType := args.String("process", "", "--process: include the ENV.<process> layer of this process type")
+	phase := args.String("phase", config.SchedulerPhaseDeploy, "--phase: [ build | deploy | run ] the phase to resolve the env for, build includes the ENV.build layer")
+	args.Parse(os.Args[2:])
+	config.CommandResolve(args.Args(), *target, *procType, *phase)
+}
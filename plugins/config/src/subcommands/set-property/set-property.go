@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// set or clear a config property for an app
+func main() {
+	args := flag.NewFlagSet("config:set-property", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	migrate := args.Bool("migrate", false, "--migrate: copy the existing ENV file to the new env-file-path")
+	args.Parse(os.Args[2:])
+	config.CommandSetProperty(args.Args(), *target, *migrate)
+}
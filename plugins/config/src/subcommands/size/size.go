@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// show the size of an environment against its limits
+func main() {
+	args := flag.NewFlagSet("config:size", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandSize(args.Args(), *target)
+}
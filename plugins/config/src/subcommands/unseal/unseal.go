@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// print the value of a sealed config var
+func main() {
+	args := flag.NewFlagSet("config:unseal", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandUnseal(args.Args(), *target)
+}
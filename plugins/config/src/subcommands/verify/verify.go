@@ -0,0 +1,17 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// exit zero if a config value matches the one given on stdin
+func main() {
+	args := flag.NewFlagSet("config:verify", flag.ExitOnError)
+	target := config.AddTargetFlags(args)
+	config.AddQuietFlag(args)
+	args.Parse(os.Args[2:])
+	config.CommandVerify(args.Args(), *target)
+}
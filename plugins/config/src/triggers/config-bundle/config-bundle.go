@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes a tarfile of the config of an app to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	if err := config.TriggerBundle(appName, flag.Args()[1:], os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %s\n", err.Error())
+		if triggerErr, ok := err.(*config.TriggerError); ok {
+			os.Exit(triggerErr.ExitCode)
+		}
+		os.Exit(1)
+	}
+}
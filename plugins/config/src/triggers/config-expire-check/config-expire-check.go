@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// unsets the expired config keys of an app
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	if err := config.TriggerExpireCheck(appName); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes the values of the config keys read from stdin to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	nullDelimited := flag.Arg(1) == "--null"
+
+	if err := config.TriggerGetMany(appName, os.Stdin, os.Stdout, nullDelimited); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes the exact value of a config key to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	key := flag.Arg(1)
+
+	if err := config.TriggerGetRaw(appName, key, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %s\n", err.Error())
+		if triggerErr, ok := err.(*config.TriggerError); ok {
+			os.Exit(triggerErr.ExitCode)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes the values to scrub from the output of an app to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	mode := flag.Arg(1)
+
+	if err := config.TriggerGetRedactionPatterns(appName, mode, os.Stdout); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes a json document describing the config of an app, without its values, to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	if err := config.TriggerIntrospection(appName, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %s\n", err.Error())
+		if triggerErr, ok := err.(*config.TriggerError); ok {
+			os.Exit(triggerErr.ExitCode)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,16 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// sends the notification of a config change to the endpoints of an app
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	body := flag.Arg(1)
+
+	config.TriggerNotify(appName, body)
+}
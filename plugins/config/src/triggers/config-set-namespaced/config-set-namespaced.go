@@ -0,0 +1,36 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// sets the key and value pairs read from stdin under a prefix
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	prefix := flag.Arg(1)
+	nullDelimited := false
+	restart := true
+	for _, arg := range flag.Args()[2:] {
+		switch arg {
+		case "--null":
+			nullDelimited = true
+		case "--no-restart":
+			restart = false
+		}
+	}
+
+	//values may be secrets, so they are not echoed back like config:set does
+	os.Setenv("DOKKU_QUIET_OUTPUT", "1")
+	if err := config.TriggerSetNamespaced(appName, prefix, os.Stdin, nullDelimited, restart); err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %s\n", err.Error())
+		if triggerErr, ok := err.(*config.TriggerError); ok {
+			os.Exit(triggerErr.ExitCode)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// sets a config key to the exact contents of stdin
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	key := flag.Arg(1)
+	restart := flag.Arg(2) != "--no-restart"
+
+	//the value may be a secret, so it is not echoed back like config:set does
+	os.Setenv("DOKKU_QUIET_OUTPUT", "1")
+	if err := config.TriggerSetRaw(appName, key, os.Stdin, restart); err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %s\n", err.Error())
+		if triggerErr, ok := err.(*config.TriggerError); ok {
+			os.Exit(triggerErr.ExitCode)
+		}
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+// runs the install step for the config plugin
+func main() {
+	if err := common.PropertySetup("config"); err != nil {
+		common.LogFail(fmt.Sprintf("Unable to install the config plugin: %s", err.Error()))
+	}
+}
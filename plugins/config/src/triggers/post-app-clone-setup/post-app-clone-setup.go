@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// copies the config of an app to the app it is cloned into
+func main() {
+	flag.Parse()
+	oldAppName := flag.Arg(0)
+	newAppName := flag.Arg(1)
+
+	if err := config.TriggerPostAppCloneSetup(oldAppName, newAppName); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// drops state derived from the config of an app once it changes
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	config.TriggerPostConfigUpdate(appName)
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// applies the config template to a new app
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	config.TriggerPostCreate(appName)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+// destroys the config properties for a given app
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	err := common.PropertyDestroy("config", appName)
+	if err != nil {
+		common.LogFail(err.Error())
+	}
+}
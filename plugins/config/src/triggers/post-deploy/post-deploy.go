@@ -0,0 +1,16 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// records a snapshot of the environment the app was deployed with
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	imageTag := flag.Arg(3)
+
+	config.TriggerPostDeploy(appName, imageTag)
+}
@@ -0,0 +1,18 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// warns about values in the app config that look like misplaced secrets
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	if err := config.TriggerPreDeploy(appName); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// displays a config report for an app
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+
+	config.ReportSingleApp(appName, "", "stdout")
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"flag"
+	"os"
+
+	"github.com/dokku/dokku/plugins/common"
+	"github.com/dokku/dokku/plugins/config"
+)
+
+// writes the env a container of an app should get to stdout
+func main() {
+	flag.Parse()
+	appName := flag.Arg(0)
+	procType := flag.Arg(1)
+	phase := flag.Arg(2)
+
+	if err := config.TriggerSchedulerEnvVars(appName, procType, phase, os.Stdout); err != nil {
+		common.LogFail(err.Error())
+	}
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//StreamFormatter writes the entries of an Env one at a time, so that exporting never builds a
+// copy of the whole Env in memory
+type StreamFormatter interface {
+	//WriteEntry writes a single key and its value to w
+	WriteEntry(w io.Writer, key string, value string) error
+}
+
+//nulFormatter writes each entry as key\0value\0. Values cannot contain a NUL byte, which Set
+// already refuses, so every other byte is kept as-is
+type nulFormatter struct{}
+
+func (nulFormatter) WriteEntry(w io.Writer, key string, value string) error {
+	for _, field := range []string{key, value} {
+		if _, err := io.WriteString(w, field); err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//netstringFormatter writes each entry as the netstring of the key followed by that of the value,
+// such as 3:KEY,5:value, which can hold any byte
+type netstringFormatter struct{}
+
+func (netstringFormatter) WriteEntry(w io.Writer, key string, value string) error {
+	for _, field := range []string{key, value} {
+		if _, err := io.WriteString(w, strconv.Itoa(len(field))+":"); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, field); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, ","); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//textWriter is what the formatters write to, a strings.Builder when the export is returned as a
+// string or a bufio.Writer when it is streamed. Write errors are left to the caller, as both keep
+// the first one, see ExportTo
+type textWriter interface {
+	io.Writer
+	io.ByteWriter
+	WriteString(s string) (int, error)
+	WriteRune(r rune) (int, error)
+}
+
+//streamFormatter returns the StreamFormatter of a format, or nil if it is not streamed
+func streamFormatter(format ExportFormat) StreamFormatter {
+	switch format {
+	case ExportFormatNul:
+		return nulFormatter{}
+	case ExportFormatNetstring:
+		return netstringFormatter{}
+	default:
+		return nil
+	}
+}
+
+//streamsExport reports whether ExportTo writes the given format as it goes rather than building it
+// first, so that exporting a large value never copies it
+func streamsExport(format ExportFormat) bool {
+	switch format {
+	case ExportFormatExports, ExportFormatDockerArgs, ExportFormatShell, ExportFormatJSON, ExportFormatCompose:
+		return true
+	}
+	return streamFormatter(format) != nil
+}
+
+//ExportTo writes the Env to w in the given format, as ExportWithOptions would return it. The
+// formats for which streamsExport is set are written as they go, once every value was checked to
+// be exportable, while the other formats are built first
+func (e *Env) ExportTo(w io.Writer, format ExportFormat, opts ExportOptions) error {
+	e, opts, err := e.applyKeyTransform(format, opts)
+	if err != nil {
+		return err
+	}
+	if formatter := streamFormatter(format); formatter != nil {
+		return e.streamTo(w, formatter, opts)
+	}
+	buffered := bufio.NewWriter(w)
+	switch format {
+	case ExportFormatExports:
+		err = e.formatTo(buffered, opts.formatOptions("export ", "\n"))
+	case ExportFormatDockerArgs:
+		err = e.formatTo(buffered, opts.formatOptions("--env=", " "))
+	case ExportFormatShell:
+		err = e.formatTo(buffered, opts.formatOptions("", " "))
+	case ExportFormatJSON:
+		if err = e.checkText(); err == nil {
+			err = e.writeJSON(buffered)
+		}
+	case ExportFormatCompose:
+		if err = e.checkText(); err == nil {
+			err = e.writeCompose(buffered, opts)
+		}
+	default:
+		exported, err := e.ExportWithOptions(format, opts)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, exported)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	return buffered.Flush()
+}
+
+func (e *Env) streamTo(w io.Writer, formatter StreamFormatter, opts ExportOptions) error {
+	buffered := bufio.NewWriter(w)
+	for _, k := range e.exportKeys(opts) {
+		if err := formatter.WriteEntry(buffered, k, e.values()[k]); err != nil {
+			return fmt.Errorf("Unable to export %s: %s", k, err.Error())
+		}
+	}
+	return buffered.Flush()
+}
+
+//writeTracker passes writes on to w, remembering whether anything was written
+type writeTracker struct {
+	w       io.Writer
+	written bool
+}
+
+func (t *writeTracker) Write(p []byte) (int, error) {
+	t.written = t.written || len(p) > 0
+	return t.w.Write(p)
+}
@@ -0,0 +1,170 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+//parseNul reads key\0value\0 records, the way a consumer of the nul format would
+func parseNul(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	reader := bufio.NewReader(r)
+	for {
+		key, err := reader.ReadString(0)
+		if err == io.EOF && key == "" {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		value, err := reader.ReadString(0)
+		if err != nil {
+			return nil, err
+		}
+		values[strings.TrimSuffix(key, "\x00")] = strings.TrimSuffix(value, "\x00")
+	}
+}
+
+//parseNetstrings reads pairs of netstrings, the way a consumer of the netstring format would
+func parseNetstrings(r io.Reader) (map[string]string, error) {
+	values := map[string]string{}
+	reader := bufio.NewReader(r)
+	next := func() (string, error) {
+		length, err := reader.ReadString(':')
+		if err != nil {
+			return "", err
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(length, ":"))
+		if err != nil {
+			return "", err
+		}
+		field := make([]byte, n+1)
+		if _, err := io.ReadFull(reader, field); err != nil {
+			return "", err
+		}
+		if field[n] != ',' {
+			return "", errors.New("netstring is not terminated by a comma")
+		}
+		return string(field[:n]), nil
+	}
+	for {
+		key, err := next()
+		if err == io.EOF {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if values[key], err = next(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func TestStreamedExport(t *testing.T) {
+	RegisterTestingT(t)
+	var every []byte
+	for b := 1; b < 256; b++ {
+		every = append(every, byte(b))
+	}
+	values := pairs("EVERY_BYTE", string(every), "EMPTY", "", "SEPARATORS", "3:a,\n:,,", "LARGE", strings.Repeat("x", 2<<20))
+	env := NewForTest(t, values)
+
+	for format, parse := range map[ExportFormat]func(io.Reader) (map[string]string, error){
+		ExportFormatNul:       parseNul,
+		ExportFormatNetstring: parseNetstrings,
+	} {
+		var out bytes.Buffer
+		Expect(env.ExportTo(&out, format, ExportOptions{})).To(Succeed())
+		Expect(env.Export(format)).To(Equal(out.String()))
+		parsed, err := parse(&out)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed).To(Equal(values))
+	}
+
+	Expect(NewForTest(t, pairs("B", "2", "A", "1")).Export(ExportFormatNul)).To(Equal("A\x001\x00B\x002\x00"))
+	Expect(NewForTest(t, pairs("B", "2", "A", "")).Export(ExportFormatNetstring)).To(Equal("1:A,0:,1:B,1:2,"))
+}
+
+func TestExportToFormats(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs("KEY", "it's"))
+	var out bytes.Buffer
+	Expect(env.ExportTo(&out, ExportFormatShell, ExportOptions{Quoting: QuoteDouble})).To(Succeed())
+	Expect(out.String()).To(Equal(`KEY="it's"`))
+
+	out.Reset()
+	Expect(env.Synchronized().ExportTo(&out, ExportFormatNul, ExportOptions{})).To(Succeed())
+	Expect(out.String()).To(Equal("KEY\x00it's\x00"))
+
+	Expect(env.ExportTo(&out, ExportFormat(-1), ExportOptions{})).NotTo(Succeed())
+}
+
+func TestExportToMatchesExportWithOptions(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, pairs(
+		"QUOTES", `it's "quoted" \ $HOME`,
+		"HTML", "<a href='x'>&amp;</a>",
+		"CONTROL", "tab\tnew\nline\r\x01\x08\x0c\x1b\x7f",
+		"UNICODE", "h\u00e9llo \u2028\u2029 \ufeff \U0001f600 \ufffd",
+		"EMPTY", "",
+		"PLAIN", "value",
+	))
+	env.meta = map[string]KeyMetadata{"PLAIN": {Description: "a <plain> value", Tags: []string{TagSecret}}}
+
+	for _, opts := range []ExportOptions{
+		{},
+		{Ordered: true, Quoting: QuoteDouble},
+		{Quoting: QuoteMinimal, EscapeControlChars: true},
+		{ComposeMap: true, ComposeService: "worker"},
+		{KeyTransform: KeyTransform{Prefix: "APP_"}.Func()},
+	} {
+		for _, format := range []ExportFormat{ExportFormatExports, ExportFormatDockerArgs, ExportFormatShell, ExportFormatJSON, ExportFormatCompose} {
+			Expect(streamsExport(format)).To(BeTrue())
+			expected, err := env.ExportWithOptions(format, opts)
+			Expect(err).NotTo(HaveOccurred())
+			var out bytes.Buffer
+			Expect(env.ExportTo(&out, format, opts)).To(Succeed())
+			Expect(out.String()).To(Equal(expected), "%d %+v", format, opts)
+		}
+	}
+
+	//the json format is escaped as json.Marshal escapes it
+	expected, err := json.Marshal(env.jsonEntries(true))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.JSONString()).To(Equal(string(expected)))
+
+	//nothing is written for a value that cannot be exported
+	invalid := NewForTest(t, pairs("A", "1", "B", "\xff"))
+	var out bytes.Buffer
+	Expect(invalid.ExportTo(&out, ExportFormatJSON, ExportOptions{})).To(MatchError("Value of B contains invalid UTF-8 at byte offset 0 and cannot be exported"))
+	Expect(invalid.ExportTo(&out, ExportFormatCompose, ExportOptions{ComposeService: "-"})).To(HaveOccurred())
+	Expect(out.Len()).To(Equal(0))
+}
+
+//TestExportToLargeValue guards against the streamed formats copying a value, which would make
+// exporting an env holding a value of several megabytes allocate several times its size
+func TestExportToLargeValue(t *testing.T) {
+	RegisterTestingT(t)
+	large := strings.Repeat(`{"key": "it's <a> value", "list": [1, 2, 3]}`+"\n", 128<<10)
+	Expect(len(large)).To(BeNumerically(">", 5<<20))
+	env := NewForTest(t, pairs("LARGE", large, "SMALL", "value"))
+
+	for _, format := range []ExportFormat{ExportFormatExports, ExportFormatDockerArgs, ExportFormatShell, ExportFormatJSON, ExportFormatCompose, ExportFormatNul, ExportFormatNetstring} {
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		Expect(env.ExportTo(ioutil.Discard, format, ExportOptions{})).To(Succeed())
+		runtime.ReadMemStats(&after)
+		Expect(after.TotalAlloc-before.TotalAlloc).To(BeNumerically("<", 256<<10), "%d", format)
+	}
+}
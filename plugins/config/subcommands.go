@@ -1,94 +1,577 @@
 package config
 
 import (
+	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"os/user"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dokku/dokku/plugins/common"
+	"github.com/ryanuber/columnize"
 )
 
+//ShowCommandOptions are the flags of config:show
+type ShowCommandOptions struct {
+	//Shell and Export print the env in the shell and exports formats, and are deprecated
+	Shell  bool
+	Export bool
+	Merged bool
+	//Provenance shows when and by whom each key was last changed instead of its value
+	Provenance       bool
+	WarningsAsErrors bool
+	//RedactedPublic shows the redacted snapshot, readable by the redacted-public-group group
+	RedactedPublic bool
+}
+
 //CommandShow implements config:show
-func CommandShow(args []string, global bool, shell bool, export bool, merged bool) {
-	appName, _ := getCommonArgs(global, args)
-	env := getEnvironment(appName, merged)
-	if shell && export {
-		common.LogFail("Only one of --shell and --export can be given")
+func CommandShow(args []string, target TargetFlags, options ShowCommandOptions) {
+	resolved, keys := resolveTargetOrFail(target, args)
+	if options.Shell && options.Export {
+		failInvalid("Only one of --shell and --export can be given")
+	}
+	if options.RedactedPublic {
+		if options.Shell || options.Export || options.Merged || options.Provenance || options.WarningsAsErrors || resolved.File != "" {
+			failInvalid("--redacted-public cannot be combined with --shell, --export, --merged, --provenance, --warnings-as-errors or --file")
+		}
+		showRedactedSnapshot(resolved)
+		return
+	}
+	if options.Provenance && resolved.File != "" {
+		failInvalid("--provenance cannot be combined with --file")
+	}
+	warnAboutParsing(resolved, options.Merged, options.WarningsAsErrors)
+	if options.Provenance {
+		if options.Shell || options.Export || options.Merged {
+			failInvalid("--provenance cannot be combined with --shell, --export or --merged")
+		}
+		showProvenance(resolved.AppName, keys)
+		return
 	}
-	if shell {
-		fmt.Print(env.Export(ExportFormatShell))
-	} else if export {
-		fmt.Println(env.Export(ExportFormatExports))
+	env := getTargetEnvironment(resolved, options.Merged)
+	if options.Shell {
+		streamExportOrFail(env, ExportFormatShell, ExportOptions{}, "")
+	} else if options.Export {
+		streamExportOrFail(env, ExportFormatExports, ExportOptions{}, "\n")
 	} else {
-		contextName := "global"
-		if appName != "" {
-			contextName = appName
+		common.LogInfo2Quiet(resolved.Label() + " env vars")
+		pretty := exportOrFail(env, ExportFormatPretty, ExportOptions{})
+		if meta := getMetadata(env); len(meta) > 0 {
+			pretty = prettyPrintWithMetadata(env, meta)
+		}
+		fmt.Print(terminateExport(pretty, "\n"))
+		for _, collision := range env.KeyCollisions() {
+			common.LogWarn(collision.String())
 		}
-		common.LogInfo2Quiet(contextName + " env vars")
-		fmt.Println(env.Export(ExportFormatPretty))
 	}
 }
 
-//CommandGet implements config:get
-func CommandGet(args []string, global bool, quoted bool) {
-	appName, keys := getCommonArgs(global, args)
-	if len(keys) > 1 {
-		common.LogFail(fmt.Sprintf("Unexpected argument(s): %v", keys[1:]))
+//showRedactedSnapshot prints the keys of an env and the checksums of their values from its redacted
+// snapshot, for users allowed to read the snapshot but not the ENV file
+func showRedactedSnapshot(resolved Target) {
+	snapshot, err := LoadRedactedSnapshot(resolved.AppName)
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s redacted env vars as of %s", resolved.Label(), snapshot.RefreshedAt.Format(time.RFC3339)))
+	fmt.Print(terminateExport(prettyPrintEnvEntries("", snapshot.Checksums), "\n"))
+}
+
+//showProvenance prints who last changed each of the given keys, or of all keys if there are none
+func showProvenance(appName string, keys []string) {
+	env := getEnvironment(appName, false)
+	if len(keys) == 0 {
+		keys = env.sortKeys()
+	}
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			failWith(err)
+		}
+		if _, ok := env.Get(k); !ok {
+			failWithStatus(ExitStatusKeyNotSet, fmt.Sprintf("%s is not set for %s", k, env.name))
+		}
 	}
+	contextName := Target{AppName: appName}.Label()
+	common.LogInfo2Quiet(contextName + " env var provenance")
+	colConfig := columnize.DefaultConfig()
+	colConfig.Delim = "\x00"
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		modifiedAt, modifiedBy := describeProvenance(env, k)
+		lines = append(lines, k+":\x00"+modifiedAt+"\x00"+modifiedBy)
+	}
+	fmt.Println(columnize.Format(lines, colConfig))
+}
+
+//GetCommandOptions are the flags of config:get
+type GetCommandOptions struct {
+	//Quoted and Null allow several keys to be got, as quoted values or NUL-terminated ones
+	Quoted bool
+	Null   bool
+	//Raw writes the value exactly as stored, without adding a newline
+	Raw bool
+	//First gets the first of the keys that is set, which Verbose writes to stderr
+	First   bool
+	Verbose bool
+	Merged  bool
+}
+
+//CommandGet implements config:get
+func CommandGet(args []string, target TargetFlags, options GetCommandOptions) {
+	appName, keys := getCommonArgs(target, args)
 	if len(keys) == 0 {
-		common.LogFail("Expected: key")
+		failInvalid("Expected: key")
+	}
+	if options.Raw && (options.Quoted || options.Null) {
+		failInvalid("--raw cannot be combined with --quoted or --null")
+	}
+	if options.Verbose && !options.First {
+		failInvalid("--verbose only applies to --first")
+	}
+	if options.Raw && len(keys) > 1 && !options.First {
+		failInvalid(fmt.Sprintf("Unexpected argument(s): %v, --raw gets a single key", keys[1:]))
+	}
+	if len(keys) > 1 && !options.Quoted && !options.Null && !options.First {
+		failInvalid(fmt.Sprintf("Unexpected argument(s): %v, use --quoted or --null to get several keys", keys[1:]))
+	}
+	for _, key := range keys {
+		if err := validateKey(key); err != nil {
+			failWith(err)
+		}
 	}
-	if value, ok := Get(appName, keys[0]); !ok {
-		os.Exit(1)
+	var env *Env
+	if options.Merged {
+		env = getEnvironment(appName, true)
 	} else {
-		if quoted {
-			fmt.Printf("'%s'\n", singleQuoteEscape(value))
-		} else {
-			fmt.Printf("%s\n", value)
+		var err error
+		if env, err = loadAppOrGlobalEnvCached(appName); err != nil {
+			failWith(err)
+		}
+	}
+	//with --first, the first of the keys that is set is got as if it was the only one given
+	if options.First {
+		_, key, ok := env.GetFirst(keys...)
+		if !ok {
+			exitWithStatus(ExitStatusKeyNotSet)
+		}
+		if options.Verbose {
+			fmt.Fprintln(os.Stderr, key)
+		}
+		keys = []string{key}
+	}
+	if options.Raw {
+		ok, err := writeRawValue(os.Stdout, env, keys[0])
+		if err != nil {
+			failWith(err)
+		}
+		if !ok {
+			exitWithStatus(ExitStatusKeyNotSet)
+		}
+		return
+	}
+	terminator := "\n"
+	if options.Null {
+		terminator = "\x00"
+	}
+	missing := false
+	for _, key := range keys {
+		value, ok := env.Get(key)
+		if !ok {
+			missing = true
+			continue
+		}
+		if options.Quoted {
+			value = "'" + SingleQuoteEscape(value) + "'"
+		}
+		//with several keys each record starts with its key. Values never hold a NUL byte, and a quoted
+		// value that spans lines still reads back as one word
+		if len(keys) > 1 {
+			value = key + "=" + value
 		}
+		fmt.Print(value + terminator)
+	}
+	if missing {
+		exitWithStatus(ExitStatusKeyNotSet)
 	}
 }
 
-//CommandUnset implements config:unset
-func CommandUnset(args []string, global bool, noRestart bool) {
-	appName, keys := getCommonArgs(global, args)
-	err := UnsetMany(appName, keys, !noRestart)
+//CommandGetAndUnset implements config:get-and-unset, printing the value of a key once it was removed,
+// so that a value is never printed without having been removed. It exits non-zero if the key is not set
+func CommandGetAndUnset(args []string, target TargetFlags, restart bool, noRestart bool) {
+	appName, keys := getCommonArgs(target, args)
+	if len(keys) != 1 {
+		failInvalid("Expected: key")
+	}
+	//the value is meant for whoever reads it, so the app is only restarted if asked to
+	policy := restartPolicyOrDefault(appName, restart, noRestart, RestartPolicyNever)
+	value, existed, err := GetAndUnset(appName, keys[0], policy)
+	if _, ok := err.(*RestartError); ok {
+		//the key was removed all the same, so its value must not be lost
+		fmt.Println(value)
+		failWrite(appName, err)
+	}
+	if err != nil {
+		failWrite(appName, err)
+	}
+	if !existed {
+		exitWithStatus(ExitStatusKeyNotSet)
+	}
+	fmt.Println(value)
+}
+
+//CommandUnseal implements config:unseal, printing the value a sealed key holds. Only root and
+// dokku admins may run it
+func CommandUnseal(args []string, target TargetFlags) {
+	appName, keys := getCommonArgs(target, args)
+	if len(keys) != 1 {
+		failInvalid("Expected: key")
+	}
+	if err := checkAdmin("unseal a value"); err != nil {
+		failWith(err)
+	}
+	value, err := Unseal(appName, keys[0])
+	if err != nil {
+		failWith(err)
+	}
+	fmt.Println(value)
+}
+
+//CommandVerify implements config:verify. The candidate value is read from stdin, and the answer
+// is given only by the exit code so that the stored value is never printed
+func CommandVerify(args []string, target TargetFlags) {
+	appName, keys := getCommonArgs(target, args)
+	if len(keys) != 1 {
+		failInvalid("Expected: key")
+	}
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		logFail(fmt.Sprintf("Unable to read stdin: %s", err.Error()))
+	}
+	env, err := loadAppOrGlobalEnv(appName)
+	if err != nil {
+		failWith(err)
+	}
+	equal, err := env.CompareValue(keys[0], strings.TrimSuffix(string(input), "\n"))
 	if err != nil {
-		common.LogFail(err.Error())
+		failWith(err)
+	}
+	if !equal {
+		exitWithStatus(1)
+	}
+}
+
+//CommandUnset implements config:unset
+func CommandUnset(args []string, target TargetFlags, restart bool, noRestart bool, strict bool) {
+	appName, keys := getCommonArgs(target, args)
+	policy := restartPolicyOrFail(appName, restart, noRestart)
+	removed, absent, err := unsetMany(appName, keys, policy)
+	if restartErr, ok := err.(*RestartError); ok {
+		defer failWrite(appName, restartErr)
+	} else if err != nil {
+		failWrite(appName, err)
+	}
+	if len(removed) == 0 {
+		common.LogInfo2Quiet("No keys removed")
+	} else {
+		common.LogInfo2Quiet(fmt.Sprintf("Removed %d key(s): %s", len(removed), strings.Join(removed, ", ")))
+	}
+	if strict && len(absent) > 0 {
+		failWithStatus(ExitStatusKeyNotSet, fmt.Sprintf("Not set: %s", strings.Join(absent, ", ")))
 	}
 }
 
-//CommandSet implements config:set
-func CommandSet(args []string, global bool, noRestart bool, encoded bool) {
-	appName, pairs := getCommonArgs(global, args)
+//SetCommandOptions are the flags of config:set
+type SetCommandOptions struct {
+	//Restart and NoRestart override the config-restart-policy property
+	Restart   bool
+	NoRestart bool
+	//Encoded values are base64 encoded
+	Encoded bool
+	//TTL is how long the keys are kept for, 0 to keep them for good, or nil to leave their expiry alone
+	TTL            *time.Duration
+	SkipValidation bool
+	Quiet          bool
+	//StdinPairs reads NUL-terminated KEY=VALUE records from stdin instead of the arguments
+	StdinPairs  bool
+	Literal     bool
+	Trim        bool
+	StripQuotes bool
+	//Provider computes the values of the keys whenever a container starts, rather than storing them
+	Provider string
+	//Preview shows the effect of global keys on every app, printed in Format, instead of setting them
+	Preview bool
+	Format  string
+	Sealed  bool
+}
+
+//CommandSet implements config:set. If the TTL option is not nil the keys expire after it, or no longer
+// expire if it is 0. A value given as an argument that is wrapped in quotes or has surrounding whitespace
+// is refused unless the Literal option is set, or the Trim or StripQuotes options clean it
+func CommandSet(args []string, target TargetFlags, options SetCommandOptions) {
+	appName, pairs := getCommonArgs(target, args)
+	if options.Sealed && (options.Provider != "" || options.Preview) {
+		failInvalid("--sealed cannot be combined with --provider or --preview")
+	}
+	if options.Preview {
+		if appName != "" {
+			failInvalid("--preview only applies to --global")
+		}
+		if options.Provider != "" || options.TTL != nil {
+			failInvalid("--preview cannot be combined with --provider or --ttl")
+		}
+		if options.Format != "text" && options.Format != "json" {
+			failInvalid(fmt.Sprintf("Unknown format: %s, expected text or json", options.Format))
+		}
+	} else if options.Format != "text" {
+		failInvalid("--format only applies to --preview")
+	}
+	if options.Provider != "" {
+		if options.StdinPairs || options.Encoded || options.TTL != nil || options.Literal || options.Trim || options.StripQuotes {
+			failInvalid("--provider cannot be combined with --stdin-pairs, --encoded, --ttl, --literal, --trim or --strip-quotes")
+		}
+		commandSetProvider(appName, pairs, options.Provider, restartPolicyOrFail(appName, options.Restart, options.NoRestart))
+		return
+	}
+	if options.StdinPairs {
+		if len(pairs) > 0 {
+			failInvalid("KEY=VALUE arguments cannot be combined with --stdin-pairs")
+		}
+		input, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			logFail(fmt.Sprintf("Unable to read stdin: %s", err.Error()))
+		}
+		if pairs, err = splitNulPairs(input); err != nil {
+			failWith(err)
+		}
+	}
 	updated := make(map[string]string)
 	for _, e := range pairs {
 		parts := strings.SplitN(e, "=", 2)
 		if len(parts) == 1 {
-			common.LogFail("Invalid env pair: " + e)
+			failInvalid("Invalid env pair: " + e)
 		}
 		key, value := parts[0], parts[1]
-		if encoded {
+		if options.Encoded {
 			decoded, err := base64.StdEncoding.DecodeString(value)
 			if err != nil {
-				common.LogFail(fmt.Sprintf("%s for key '%s'", err.Error(), key))
+				failInvalid(fmt.Sprintf("%s for key '%s'", err.Error(), key))
 			}
 			value = string(decoded)
 		}
 		updated[key] = value
 	}
-	err := SetMany(appName, updated, !noRestart)
+	if options.TTL != nil && *options.TTL < 0 {
+		failInvalid("--ttl must not be negative")
+	}
+	if options.Literal && (options.Trim || options.StripQuotes) {
+		failInvalid("--literal cannot be combined with --trim or --strip-quotes")
+	}
+	if options.Trim || options.StripQuotes {
+		for k, v := range updated {
+			updated[k] = cleanValue(v, options.Trim, options.StripQuotes)
+		}
+	}
+	//decoded values and those read from stdin are exactly what was meant to be set
+	if !options.Literal && !options.Encoded && !options.StdinPairs {
+		refuseSuspiciousValues(updated)
+	}
+	if !options.SkipValidation {
+		if err := validateReferences(appName, updated); err != nil {
+			failInvalid(fmt.Sprintf("%s, use --skip-validation to set it anyway", err.Error()))
+		}
+		refuseRejectedValues(appName, updated)
+	}
+	refuseReservedKeys(appName, updated, options.Quiet)
+	if options.Preview && !previewGlobalSet(updated, options.Format) {
+		return
+	}
+	if options.Sealed {
+		var err error
+		if updated, err = sealEntries(appName, updated); err != nil {
+			failWith(err)
+		}
+	}
+	policy := restartPolicyOrFail(appName, options.Restart, options.NoRestart)
+	//a failed restart leaves the keys set, so their expiry is still set before failing with it
+	err := setMany(appName, updated, policy)
+	if restartErr, ok := err.(*RestartError); ok {
+		defer failWrite(appName, restartErr)
+	} else if err != nil {
+		failWrite(appName, err)
+	}
+	if !options.Quiet {
+		for _, warning := range shadowWarnings(appName, updated) {
+			common.LogWarn(warning)
+		}
+	}
+	if options.TTL == nil {
+		return
+	}
+	keys := make([]string, 0, len(updated))
+	for k := range updated {
+		keys = append(keys, k)
+	}
+	var expiresAt *time.Time
+	if *options.TTL > 0 {
+		t := time.Now().Add(*options.TTL)
+		expiresAt = &t
+	}
+	if err := SetExpiry(appName, keys, expiresAt); err != nil {
+		failWrite(appName, err)
+	}
+	if expiresAt != nil {
+		common.LogVerboseQuiet(fmt.Sprintf("Expires at %s", expiresAt.UTC().Format(time.RFC3339)))
+	}
+}
+
+//previewGlobalSet implements config:set --global --preview, printing the effect setting the keys
+// globally would have on every app. It returns whether to set them after all, which is only asked
+// on a terminal, and never when printing json
+func previewGlobalSet(entries map[string]string, format string) bool {
+	impacts, err := PreviewGlobalSet(entries)
 	if err != nil {
-		common.LogFail(err.Error())
+		failWith(err)
+	}
+	counts := countGlobalEffects(impacts)
+	if format == "json" {
+		report := struct {
+			Impacts []GlobalImpact       `json:"impacts"`
+			Summary map[GlobalEffect]int `json:"summary"`
+		}{impacts, counts}
+		contents, err := json.Marshal(report)
+		if err != nil {
+			failWith(err)
+		}
+		fmt.Println(string(contents))
+		return false
+	}
+
+	keys := make([]string, 0, len(entries))
+	for k := range entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		common.LogInfo2Quiet(fmt.Sprintf("Preview of setting %s globally", k))
+		apps, effects := []string{}, map[string]string{}
+		for _, impact := range impacts {
+			if impact.Key == k {
+				apps = append(apps, impact.App)
+				effects[impact.App] = describeGlobalEffect(impact)
+			}
+		}
+		if len(apps) == 0 {
+			common.LogVerboseQuiet("No apps would be affected")
+		} else if os.Getenv("DOKKU_QUIET_OUTPUT") == "" {
+			fmt.Println(prettyPrintSortedEntries("       ", apps, effects))
+		}
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%d inherited, %d overridden, %d unchanged", counts[GlobalEffectInherited], counts[GlobalEffectOverridden], counts[GlobalEffectUnchanged]))
+
+	tty, err := openTerminal()
+	if err == nil {
+		defer tty.Close()
+		confirmed, err := confirmGlobalSet(tty, tty, keys)
+		if err != nil {
+			failWith(err)
+		}
+		if confirmed {
+			return true
+		}
+	}
+	common.LogInfo1Quiet("Nothing was changed, run the command again without --preview to set the keys")
+	return false
+}
+
+//commandSetProvider implements config:set --provider, giving keys a provider computing their value
+func commandSetProvider(appName string, keys []string, provider string, policy RestartPolicy) {
+	if len(keys) == 0 {
+		failInvalid("Expected: key")
+	}
+	for _, k := range keys {
+		if strings.Contains(k, "=") {
+			failInvalid(fmt.Sprintf("--provider is given keys rather than KEY=VALUE pairs: %s", k))
+		}
+	}
+	if err := SetProvider(appName, keys, provider); err != nil {
+		failWrite(appName, err)
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Setting provider %s for %s", provider, strings.Join(keys, ", ")))
+	if appName != "" {
+		if err := restartWithPolicy(appName, policy, keys, keys); err != nil {
+			failWrite(appName, err)
+		}
+	}
+}
+
+//refuseSuspiciousValues fails if any of the given values looks like it was not meant to be stored
+// as given, warning about each with its whitespace and quotes made visible
+func refuseSuspiciousValues(values map[string]string) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	suspicious := false
+	for _, k := range keys {
+		issues := ValueIssues(values[k])
+		if len(issues) == 0 {
+			continue
+		}
+		suspicious = true
+		descriptions := make([]string, 0, len(issues))
+		for _, issue := range issues {
+			switch issue {
+			case ValueIssueQuoted:
+				descriptions = append(descriptions, "is wrapped in quotes")
+			case ValueIssueWhitespace:
+				descriptions = append(descriptions, "has leading or trailing whitespace")
+			}
+		}
+		masked := IsSensitiveKey(k) || len(DetectSecret(k, values[k])) > 0
+		common.LogWarn(fmt.Sprintf("The value of %s %s: %s", k, strings.Join(descriptions, " and "), visualizeValue(values[k], masked)))
+	}
+	if suspicious {
+		failInvalid("Refusing to set the value(s) as given, use --literal to store them exactly, or --trim or --strip-quotes to clean them")
+	}
+}
+
+//refuseReservedKeys warns about the given keys that plugins set at run time, unless quiet is set,
+// and fails if the strict-reserved-keys property is enabled
+func refuseReservedKeys(appName string, values map[string]string, quiet bool) {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	if err := checkReservedKeys(appName, keys, quiet); err != nil {
+		failWith(err)
+	}
+}
+
+//refuseRejectedValues fails if plugins refuse any of the given values through the
+// config-validate-value trigger, after printing why each was refused
+func refuseRejectedValues(appName string, values map[string]string) {
+	rejections := validateValuesWithPlugins(appName, values)
+	for _, rejection := range rejections {
+		common.LogWarn(fmt.Sprintf("The value of %s was rejected: %s", rejection.Key, rejection.Message))
+	}
+	if len(rejections) > 0 {
+		failInvalid(fmt.Sprintf("Refusing to set %d value(s) rejected by plugins, use --skip-validation to set them anyway", len(rejections)))
 	}
 }
 
 //CommandKeys implements config:keys
-func CommandKeys(args []string, global bool, merged bool) {
-	appName, trailingArgs := getCommonArgs(global, args)
+func CommandKeys(args []string, target TargetFlags, merged bool) {
+	appName, trailingArgs := getCommonArgs(target, args)
 	if len(trailingArgs) > 0 {
-		common.LogFail(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
 	}
 	env := getEnvironment(appName, merged)
 	for _, k := range env.Keys() {
@@ -96,16 +579,81 @@ func CommandKeys(args []string, global bool, merged bool) {
 	}
 }
 
+//ExportCommandOptions are the flags of config:export
+type ExportCommandOptions struct {
+	Merged bool
+	//Format is the name of the export format, such as exports or json
+	Format             string
+	EscapeControlChars bool
+	Ordered            bool
+	//Quoting is the name of the quote style, single, double or minimal
+	Quoting        string
+	ComposeService string
+	ComposeMap     bool
+	//Output is the file the export is written to, or - or empty for stdout. Force replaces an existing one
+	Output           string
+	Force            bool
+	WarningsAsErrors bool
+	Container        bool
+	//AllApps exports every app, with their values redacted unless ShowValues is set
+	AllApps    bool
+	ShowValues bool
+	//KeyTransform, KeyPrefix, KeyStripPrefix and KeyUpper rename the keys, see parseKeyTransformOrFail
+	KeyTransform   string
+	KeyPrefix      string
+	KeyStripPrefix string
+	KeyUpper       bool
+	//Separator and Lowercase apply to the json-nested format
+	Separator string
+	Lowercase bool
+	//IfChangedSince is the checksum of the last export, which nothing is exported for
+	IfChangedSince string
+	EvalSafe       bool
+	EvalCompare    bool
+	Guarded        bool
+}
+
 //CommandExport implements config:export
-func CommandExport(args []string, global bool, merged bool, format string) {
-	appName, trailingArgs := getCommonArgs(global, args)
+func CommandExport(args []string, target TargetFlags, options ExportCommandOptions) {
+	if options.AllApps {
+		if options.IfChangedSince != "" {
+			failInvalid("--if-changed-since cannot be combined with --all-apps")
+		}
+		if len(args) > 0 || target.Global || target.App != "" || target.File != "" {
+			failInvalid("--all-apps cannot be combined with an app name, --app, --global or --file")
+		}
+		if options.Format != "json" {
+			failInvalid("--all-apps only supports --format json")
+		}
+		if options.KeyPrefix != "" || options.KeyUpper || options.KeyTransform != "" || options.KeyStripPrefix != "" {
+			failInvalid("--key-transform, --key-prefix, --key-strip-prefix and --key-upper cannot be combined with --all-apps")
+		}
+		apps, err := activeHost.Apps()
+		if err != nil {
+			apps = []string{}
+		}
+		exported, err := exportAllApps(apps, options.Merged, options.Container, options.ShowValues)
+		if err != nil {
+			failWith(err)
+		}
+		writeOutput(options.Output, append(exported, '\n'), options.Force)
+		return
+	}
+	if options.ShowValues {
+		failInvalid("--show-values only applies to --all-apps")
+	}
+	resolved, trailingArgs := resolveTargetOrFail(target, args)
 	if len(trailingArgs) > 0 {
-		common.LogFail(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
 	}
-	env := getEnvironment(appName, merged)
+	if options.Container && resolved.File != "" {
+		failInvalid("--container cannot be combined with --file")
+	}
+	warnAboutParsing(resolved, options.Merged, options.WarningsAsErrors)
+	env := getTargetEnvironment(resolved, options.Merged)
 	exportType := ExportFormatExports
 	suffix := "\n"
-	switch format {
+	switch options.Format {
 	case "exports":
 		exportType = ExportFormatExports
 	case "envfile":
@@ -117,49 +665,1604 @@ func CommandExport(args []string, global bool, merged bool, format string) {
 		suffix = " "
 	case "pretty":
 		exportType = ExportFormatPretty
+	case "json":
+		exportType = ExportFormatJSON
+	case "nul":
+		exportType = ExportFormatNul
+		suffix = ""
+	case "netstring":
+		exportType = ExportFormatNetstring
+		suffix = ""
+	case "compose":
+		exportType = ExportFormatCompose
+		suffix = ""
+	case "docker-envfile":
+		exportType = ExportFormatDockerEnvfile
+	case "json-nested":
+		exportType = ExportFormatJSONNested
 	default:
-		common.LogFail(fmt.Sprintf("Unknown export format: %v", format))
+		failInvalid(fmt.Sprintf("Unknown export format: %v", options.Format))
+	}
+	quoteStyle := QuoteSingle
+	switch options.Quoting {
+	case "single":
+		quoteStyle = QuoteSingle
+	case "double":
+		quoteStyle = QuoteDouble
+	case "minimal":
+		quoteStyle = QuoteMinimal
+	default:
+		failInvalid(fmt.Sprintf("Unknown quoting style: %v", options.Quoting))
+	}
+	//exports are consumed by the app, the pretty format is for people and shows references as set.
+	// The apps referenced by a file are not known, so its references are exported as set as well
+	if exportType != ExportFormatPretty && resolved.File == "" {
+		env = resolveReferencesOrFail(env)
+	}
+	if options.Container {
+		env = withoutNoExportKeysOrFail(env, resolved.AppName)
 	}
-	exported := env.Export(exportType)
-	fmt.Print(exported + suffix)
+	if (options.ComposeService != "" || options.ComposeMap) && exportType != ExportFormatCompose {
+		failInvalid("--service and --compose-map only apply to --format compose")
+	}
+	if (options.Separator != "" || options.Lowercase) && exportType != ExportFormatJSONNested {
+		failInvalid("--separator and --lowercase only apply to --format json-nested")
+	}
+	if (options.EvalSafe || options.EvalCompare) && exportType != ExportFormatExports && exportType != ExportFormatShell {
+		failInvalid("--eval-safe and --eval-compare only apply to --format exports and shell")
+	}
+	if options.Guarded && exportType != ExportFormatExports && exportType != ExportFormatShell {
+		failInvalid("--guarded only applies to --format exports and shell")
+	}
+	//agents polling an env pass the checksum printed with their last export, and get nothing back
+	// until the keys or values exported change
+	checksum := ""
+	if options.IfChangedSince != "" {
+		checksum = env.Checksum()
+		if checksum == options.IfChangedSince {
+			exitWithStatus(ExitStatusUnchanged)
+		}
+	}
+	opts := ExportOptions{EscapeControlChars: options.EscapeControlChars, Ordered: options.Ordered, Quoting: quoteStyle, ComposeService: options.ComposeService, ComposeMap: options.ComposeMap, NestedSeparator: options.Separator, NestedLowercase: options.Lowercase}
+	opts.KeyTransform = parseKeyTransformOrFail(options.KeyTransform, options.KeyUpper, options.KeyPrefix, options.KeyStripPrefix).Func()
+	//values may be too large to copy around, so the formats that can be streamed go straight to
+	// stdout unless the whole export is needed to check or guard it
+	if streamsExport(exportType) && (options.Output == "" || options.Output == "-") && !options.EvalSafe && !options.EvalCompare && !options.Guarded {
+		streamExportOrFail(env, exportType, opts, suffix)
+		writeChecksum(checksum)
+		return
+	}
+	//keys docker cannot read back are left out of a docker env-file rather than failing the export
+	if exportType == ExportFormatDockerEnvfile {
+		env, opts, err := env.applyKeyTransform(exportType, opts)
+		if err != nil {
+			failWith(err)
+		}
+		exported, warnings := env.dockerEnvFileString(env.exportKeys(opts))
+		for _, w := range warnings {
+			common.LogWarn(w)
+		}
+		if len(warnings) > 0 && options.WarningsAsErrors {
+			failInvalid(fmt.Sprintf("Left out %d key(s), failing as --warnings-as-errors was given", len(warnings)))
+		}
+		writeOutput(options.Output, []byte(terminateExport(exported, suffix)), options.Force)
+		writeChecksum(checksum)
+		return
+	}
+	exported := exportOrFail(env, exportType, opts)
+	//checking the export forks bash, so it is only done when asked for, and before anything is written
+	if options.EvalSafe || options.EvalCompare {
+		if err := VerifyShellExport(exported, env.shellExportValues(opts), options.EvalCompare); err != nil {
+			failWith(err)
+		}
+	}
+	if options.Guarded {
+		writeOutput(options.Output, []byte(GuardExport(exported)), options.Force)
+		writeChecksum(checksum)
+		return
+	}
+	writeOutput(options.Output, []byte(terminateExport(exported, suffix)), options.Force)
+	writeChecksum(checksum)
+}
+
+//parseKeyTransformOrFail returns the KeyTransform given by the --key-transform, --key-upper,
+// --key-prefix and --key-strip-prefix flags of config:export. --key-upper is --key-transform upper
+func parseKeyTransformOrFail(keyTransform string, keyUpper bool, keyPrefix string, keyStripPrefix string) KeyTransform {
+	transform := KeyTransform{Prefix: keyPrefix, StripPrefix: keyStripPrefix}
+	if keyUpper {
+		if keyTransform != "" && keyTransform != string(KeyCaseUpper) {
+			failInvalid("--key-upper cannot be combined with --key-transform")
+		}
+		keyTransform = string(KeyCaseUpper)
+	}
+	if keyTransform != "" {
+		keyCase, err := ParseKeyCase(keyTransform)
+		if err != nil {
+			failWith(err)
+		}
+		transform.Case = keyCase
+	}
+	return transform
+}
+
+//writeChecksum prints the checksum of an export on its own line to stderr, after any warning, so
+// that stdout holds the export alone. Nothing is printed for an empty checksum
+func writeChecksum(checksum string) {
+	if checksum != "" {
+		fmt.Fprintln(os.Stderr, checksum)
+	}
+}
+
+//terminateExport ends an export with suffix, unless the env had nothing to export in a format that
+// is empty then, so that an empty env is exported as an empty document rather than a lone newline
+func terminateExport(exported string, suffix string) string {
+	if exported == "" {
+		return ""
+	}
+	return exported + suffix
+}
+
+//BundleCommandOptions are the flags of config:bundle
+type BundleCommandOptions struct {
+	Merged bool
+	//Exclude and IncludeOnly are glob patterns of the keys left out of the bundle, or only bundled
+	Exclude     []string
+	IncludeOnly []string
+	//Output is the file the bundle is written to, or - or empty for stdout. Force replaces an existing one
+	Output string
+	Force  bool
+	//Container leaves out the keys tagged no-export
+	Container bool
+	BundleOptions
 }
 
 //CommandBundle implements config:bundle
-func CommandBundle(args []string, global bool, merged bool) {
-	appName, trailingArgs := getCommonArgs(global, args)
+func CommandBundle(args []string, target TargetFlags, options BundleCommandOptions) {
+	appName, trailingArgs := getCommonArgs(target, args)
 	if len(trailingArgs) > 0 {
-		common.LogFail(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
 	}
-	env := getEnvironment(appName, merged)
-	env.ExportBundle(os.Stdout)
+	bundle, err := bundleEnv(appName, options.Merged, options.Exclude, options.IncludeOnly, options.Container, options.BundleOptions)
+	if err != nil {
+		failWith(err)
+	}
+	writeOutput(options.Output, bundle, options.Force)
 }
 
-//getEnvironment for the given app (global config if appName is empty). Merge with global environment if merged is true.
-func getEnvironment(appName string, merged bool) (env *Env) {
-	var err error
-	if appName != "" && merged {
-		env, err = LoadMergedAppEnv(appName)
-	} else {
-		env, err = loadAppOrGlobalEnv(appName)
+//ImportCommandOptions are the flags of config:import
+type ImportCommandOptions struct {
+	//From is the format of stdin, heroku-json, heroku-text or docker-envfile
+	From string
+	//Strip are glob patterns of the keys that are not imported, HEROKU_* if there are none
+	Strip []string
+	//Restart and NoRestart override the config-restart-policy property
+	Restart          bool
+	NoRestart        bool
+	WarningsAsErrors bool
+	SkipValidation   bool
+	//OnConflict is what to do with keys already set to another value, see importMergeStrategy
+	OnConflict string
+}
+
+//CommandImport implements config:import, setting the keys read from stdin in the given format
+// in a single change, except those matching the strip patterns
+func CommandImport(args []string, target TargetFlags, options ImportCommandOptions) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
 	}
+	strategy, err := importMergeStrategy(options.OnConflict)
 	if err != nil {
-		common.LogFail(err.Error())
+		failWith(err)
+	}
+	warnAboutParsing(Target{AppName: appName}, false, options.WarningsAsErrors)
+	if len(options.Strip) == 0 {
+		options.Strip = defaultImportStrip
+	}
+	if err := validatePatterns("strip", options.Strip); err != nil {
+		failWith(err)
+	}
+	input, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		logFail(fmt.Sprintf("Unable to read stdin: %s", err.Error()))
+	}
+
+	var imported *Env
+	switch options.From {
+	case importFormatHerokuJSON:
+		imported, err = NewFromJSON("stdin", input)
+	case importFormatHerokuText:
+		imported, err = newFromHerokuText("stdin", string(input))
+	case importFormatDockerEnvfile:
+		imported, err = NewFromDockerEnvFile(bytes.NewReader(input))
+	default:
+		failInvalid(fmt.Sprintf("Unknown import format '%s', expected --from %s, %s or %s", options.From, importFormatHerokuJSON, importFormatHerokuText, importFormatDockerEnvfile))
+	}
+	if err != nil {
+		failWith(err)
+	}
+	for _, w := range imported.Warnings() {
+		common.LogWarn(fmt.Sprintf("stdin %s", w.String()))
+	}
+	if len(imported.Warnings()) > 0 && options.WarningsAsErrors {
+		failInvalid(fmt.Sprintf("Found %d parse warning(s), failing as --warnings-as-errors was given", len(imported.Warnings())))
+	}
+	stripped := stripKeys(imported, options.Strip)
+	if imported.Len() == 0 {
+		failInvalid("No config vars to import")
+	}
+
+	current, err := loadAppOrGlobalEnv(appName)
+	if err != nil {
+		failWith(err)
+	}
+	chosen := []string{}
+	if options.OnConflict == importConflictInteractive {
+		chosen = promptConflictsOrFail(current, imported)
+		for _, k := range chosen {
+			if err := imported.Unset(k); err != nil {
+				failWith(err)
+			}
+		}
+	}
+	result, err := current.MergeWith(imported, strategy)
+	if conflict, ok := err.(*MergeConflictError); ok {
+		for _, k := range conflict.Keys {
+			common.LogWarn(fmt.Sprintf("%s is already set to another value", k))
+		}
+		failWithStatus(ExitStatusConflict, fmt.Sprintf("Refusing to import, %d key(s) conflict with the config of %s, use --on-conflict keep or overwrite to import anyway", len(conflict.Keys), Target{AppName: appName}.Label()))
+	} else if err != nil {
+		failWith(err)
+	}
+	result.Kept = append(result.Kept, chosen...)
+	sort.Strings(result.Kept)
+
+	entries := make(map[string]string, len(result.Added)+len(result.Overwritten))
+	for _, k := range append(append([]string{}, result.Added...), result.Overwritten...) {
+		entries[k] = imported.values()[k]
+	}
+	if len(entries) > 0 {
+		if !options.SkipValidation {
+			refuseRejectedValues(appName, entries)
+		}
+		refuseReservedKeys(appName, entries, false)
+		policy := restartPolicyOrFail(appName, options.Restart, options.NoRestart)
+		if err := setMany(appName, entries, policy); err != nil {
+			failWrite(appName, err)
+		}
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("Imported %d config vars", len(entries)))
+	for _, summary := range []struct {
+		label string
+		keys  []string
+	}{{"Added", result.Added}, {"Overwrote", result.Overwritten}, {"Kept", result.Kept}, {"Skipped", stripped}} {
+		if len(summary.keys) > 0 {
+			common.LogVerboseQuiet(fmt.Sprintf("%s %d: %s", summary.label, len(summary.keys), strings.Join(summary.keys, ", ")))
+		}
 	}
-	return env
 }
 
-//getCommonArgs extracts common positional args (appName and keys)
-func getCommonArgs(global bool, args []string) (appName string, keys []string) {
-	keys = args
-	if !global {
-		if len(args) > 0 {
-			appName = args[0]
-		}
-		if appName == "" {
-			common.LogFail("Please specify an app or --global")
-		} else {
-			keys = args[1:]
+//openTerminal opens the terminal the questions of interactive commands are asked on
+var openTerminal = func() (io.ReadWriteCloser, error) {
+	return os.OpenFile("/dev/tty", os.O_RDWR, 0)
+}
+
+//promptConflictsOrFail asks on the terminal whether to overwrite each key the imported env sets to
+// another value, and returns the keys to keep. Stdin holds the imported env, so it cannot be used
+func promptConflictsOrFail(current *Env, imported *Env) []string {
+	conflicts := current.Conflicts(imported)
+	if len(conflicts) == 0 {
+		return []string{}
+	}
+	tty, err := openTerminal()
+	if err != nil {
+		failInvalid(fmt.Sprintf("--on-conflict interactive needs a terminal to ask about %d conflicting key(s): %s", len(conflicts), err.Error()))
+	}
+	defer tty.Close()
+	kept, err := promptConflicts(tty, tty, current, imported, conflicts)
+	if err != nil {
+		failWith(err)
+	}
+	return kept
+}
+
+//CommandSetProperty implements config:set-property
+func CommandSetProperty(args []string, target TargetFlags, migrate bool) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if appName == "" {
+		appName = "--global"
+	}
+	if len(trailingArgs) == 0 {
+		failInvalid("Expected: property")
+	}
+	if len(trailingArgs) > 2 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs[2:]))
+	}
+	value := ""
+	if len(trailingArgs) == 2 {
+		value = trailingArgs[1]
+	}
+	setProperty(appName, trailingArgs[0], value, migrate)
+}
+
+//setProperty validates and sets a property of an app, or the global one if appName is --global
+func setProperty(appName string, property string, value string, migrate bool) {
+	if property == "env-file-path" {
+		if value != "" {
+			if err := validateEnvFilePath(value); err != nil {
+				failWith(err)
+			}
+		}
+		if migrate {
+			if err := MigrateAppEnvFile(appName, value); err != nil {
+				failWith(err)
+			}
+		}
+	} else if migrate {
+		failInvalid("--migrate is only supported for the env-file-path property")
+	}
+	if property == "max-env-size" || property == "max-value-size" {
+		if err := validateSizeProperty(property, value); err != nil {
+			failWith(err)
+		}
+	}
+	if (property == "strict-key-case" || property == "strict-reserved-keys" || property == "preserve-order" || property == "redaction" || property == "config-reject-empty" || property == "config-metadata") && value != "" && value != "true" && value != "false" {
+		failInvalid(fmt.Sprintf("%s must be either true or false", property))
+	}
+	if property == "env-file-format" {
+		if _, err := ParseEnvFileFormat(value); err != nil {
+			failWith(err)
+		}
+	}
+	if property == "invalid-utf8" {
+		if _, err := ParseInvalidUTF8Policy(value); err != nil {
+			failWith(err)
 		}
 	}
-	return appName, keys
+	if property == "config-restart-policy" && value != "" {
+		if err := validateRestartPolicy(RestartPolicy(value)); err != nil {
+			failWith(err)
+		}
+	}
+	if (property == "release-retention" || property == "config-history-limit") && value != "" {
+		if retention, err := strconv.Atoi(value); err != nil || retention < 0 {
+			failInvalid(fmt.Sprintf("%s must be a non-negative number of releases", property))
+		}
+	}
+	if property == "config-audit-max-size" && value != "" {
+		if size, err := strconv.ParseInt(value, 10, 64); err != nil || size < 0 {
+			failInvalid(fmt.Sprintf("%s must be a non-negative number of bytes", property))
+		}
+	}
+	if property == "audit-secrets" && value != "" && value != "warn" && value != "fail" && value != "off" {
+		failInvalid(fmt.Sprintf("%s must be one of warn, fail or off", property))
+	}
+	if property == "env-compression" && value != "" && value != "gzip" && value != "none" {
+		failInvalid(fmt.Sprintf("%s must be either gzip or none", property))
+	}
+	if property == "admin-ssh-names" && appName != "--global" {
+		failInvalid(fmt.Sprintf("%s can only be set globally", property))
+	}
+	if property == "redacted-public-group" {
+		if appName != "--global" {
+			failInvalid(fmt.Sprintf("%s can only be set globally", property))
+		}
+		if value != "" {
+			if _, err := user.LookupGroup(value); err != nil {
+				failInvalid(fmt.Sprintf("Unknown group: %s", value))
+			}
+		}
+	}
+	if appName == "--global" {
+		setGlobalProperty(property, value)
+	} else if property == "env-file-path" {
+		common.CommandPropertySet("config", appName, property, value, DefaultProperties)
+	} else {
+		setAppProperty(appName, property, value)
+	}
+	if property == "env-compression" {
+		if err := applyEnvCompression(appName); err != nil {
+			failWith(err)
+		}
+	}
+	if property == "redaction" {
+		invalidateRedactionPatterns(appName)
+	}
+	if property == "redacted-public-group" {
+		if err := applyRedactedPublicGroup(); err != nil {
+			failWith(err)
+		}
+	}
+}
+
+//setAppProperty sets a property of an app, see writeAppProperty
+func setAppProperty(appName string, property string, value string) {
+	if _, ok := DefaultProperties[property]; !ok {
+		failInvalid(fmt.Sprintf("Invalid property specified: %s", property))
+	}
+	if value != "" {
+		common.LogInfo2Quiet(fmt.Sprintf("Setting %s to %s", property, value))
+	} else {
+		common.LogInfo2Quiet(fmt.Sprintf("Unsetting %s", property))
+	}
+	if err := writeAppProperty(appName, property, value); err != nil {
+		failWith(err)
+	}
+}
+
+//setGlobalProperty sets a property that applies to all apps which don't override it
+func setGlobalProperty(property string, value string) {
+	if property == "env-file-path" {
+		failInvalid("env-file-path cannot be set globally, use DOKKU_ENV_DIR to relocate the global ENV file")
+	}
+	if _, ok := DefaultProperties[property]; !ok {
+		failInvalid(fmt.Sprintf("Invalid property specified: %s", property))
+	}
+	if value != "" {
+		common.LogInfo2Quiet(fmt.Sprintf("Setting %s to %s", property, value))
+		if err := common.PropertyWrite("config", "--global", property, value); err != nil {
+			failWith(err)
+		}
+	} else {
+		common.LogInfo2Quiet(fmt.Sprintf("Unsetting %s", property))
+		if err := common.PropertyDelete("config", "--global", property); err != nil {
+			failWith(err)
+		}
+	}
+}
+
+//CommandSize implements config:size
+func CommandSize(args []string, target TargetFlags) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	env := getEnvironment(appName, false)
+	limits := GetLimits(appName)
+
+	contextName := "global"
+	size := env.Size()
+	if appName != "" {
+		contextName = appName
+		size = getEnvironment(appName, true).Size()
+	}
+
+	common.LogInfo2Quiet(contextName + " config size")
+	lines := []string{
+		fmt.Sprintf("Env size:\x00%d bytes", size),
+		fmt.Sprintf("Max env size:\x00%s", formatLimit(limits.MaxEnvSize)),
+		fmt.Sprintf("Max value size:\x00%s", formatLimit(limits.MaxValueSize)),
+	}
+	colConfig := columnize.DefaultConfig()
+	colConfig.Prefix = "       "
+	colConfig.Delim = "\x00"
+	fmt.Println(columnize.Format(lines, colConfig))
+
+	if env.Len() > 0 {
+		common.LogInfo2Quiet(contextName + " value sizes")
+		lines = make([]string, 0, env.Len())
+		for _, k := range env.sortKeys() {
+			lines = append(lines, fmt.Sprintf("%s:\x00%d bytes", k, len(env.values()[k])))
+		}
+		fmt.Println(columnize.Format(lines, colConfig))
+	}
+
+	if err := limits.CheckEnv(contextName, 0, size); err != nil {
+		common.LogWarn(err.Error())
+	}
+	for _, k := range env.sortKeys() {
+		if err := limits.CheckValue(k, env.values()[k]); err != nil {
+			common.LogWarn(err.Error())
+		}
+	}
+}
+
+//CommandAnnotate implements config:annotate
+func CommandAnnotate(args []string, target TargetFlags, description *string, tags []string, untags []string, clear bool) {
+	appName, keys := getCommonArgs(target, args)
+	if len(keys) == 0 {
+		failInvalid("Expected: key")
+	}
+	if len(keys) > 1 {
+		failInvalid(fmt.Sprintf("Unexpected argument(s): %v", keys[1:]))
+	}
+	key := keys[0]
+	if err := validateKey(key); err != nil {
+		failWith(err)
+	}
+	if clear {
+		empty := ""
+		description = &empty
+		untags = append(untags, getEnvironment(appName, false).KeyMetadata(key).Tags...)
+	}
+	if err := Annotate(appName, key, description, tags, untags); err != nil {
+		failWrite(appName, err)
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Updated metadata of %s", key))
+}
+
+//DriftCommandOptions are the flags of config:drift
+type DriftCommandOptions struct {
+	//File is the env file holding the desired config
+	File string
+	//Ignore are glob patterns of the keys left out of the comparison
+	Ignore []string
+	Merged bool
+	//Apply changes the env to match File, restarting the app according to Restart and NoRestart
+	Apply     bool
+	Restart   bool
+	NoRestart bool
+	//Format is text or json, which holds the checksums of the values unless ShowValues is set
+	Format     string
+	ShowValues bool
+	//FailOn are the kinds of drift that make the command exit non-zero
+	FailOn string
+}
+
+//CommandDrift implements config:drift
+func CommandDrift(args []string, target TargetFlags, options DriftCommandOptions) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	if options.File == "" {
+		failInvalid("Expected: --file <path>")
+	}
+	if err := validatePatterns("ignore", options.Ignore); err != nil {
+		failWith(err)
+	}
+	kinds := diffKindsOrFail(options.Format, options.ShowValues, options.FailOn)
+	if options.Apply && options.Format == "json" {
+		failInvalid("--format json cannot be combined with --apply")
+	}
+	desired, err := LoadEnvFile(options.File)
+	if err != nil {
+		failWith(err)
+	}
+
+	contextName := Target{AppName: appName}.Label()
+	if options.Apply {
+		policy := restartPolicyOrFail(appName, options.Restart, options.NoRestart)
+		applied, err := ReconcileDrift(appName, desired, options.Ignore, policy)
+		if err != nil {
+			failWrite(appName, err)
+		}
+		common.LogInfo1Quiet(fmt.Sprintf("Reconciled %s config with %s", contextName, options.File))
+		printEnvDiff(applied, "set", "unset", "updated")
+	}
+
+	live := getEnvironment(appName, options.Merged)
+	drift := Drift(live, desired, options.Ignore)
+	if options.Format == "json" {
+		printDiffReport(NewDiffReport(live, desired, drift, options.ShowValues))
+	} else {
+		common.LogInfo2Quiet(fmt.Sprintf("%s config drift from %s", contextName, options.File))
+		if drift.Empty() {
+			common.LogVerboseQuiet("No drift")
+		} else if options.Apply && options.Merged {
+			common.LogWarn("Keys set in the global environment were not changed")
+		}
+		printEnvDiff(drift, "missing", "extra", "different")
+	}
+	if drift.Has(kinds) {
+		exitWithStatus(1)
+	}
+}
+
+//CommandDiff implements config:diff, comparing two ENV files given with --file. Only the keys that
+// differ are printed, and the exit status is 1 if there are any of the kinds given with --fail-on
+func CommandDiff(args []string, files []string, format string, showValues bool, failOn string) {
+	if len(args) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", args))
+	}
+	if len(files) != 2 {
+		failInvalid("Expected: --file <path> --file <path>")
+	}
+	kinds := diffKindsOrFail(format, showValues, failOn)
+	from := getTargetEnvironment(Target{File: files[0]}, false)
+	to := getTargetEnvironment(Target{File: files[1]}, false)
+	diff := Diff(from, to)
+	if format == "json" {
+		printDiffReport(NewDiffReport(from, to, diff, showValues))
+	} else {
+		common.LogInfo2Quiet(fmt.Sprintf("Config changes from %s to %s", files[0], files[1]))
+		if diff.Empty() {
+			common.LogVerboseQuiet("No changes")
+		}
+		printEnvDiff(diff, "added", "removed", "changed")
+	}
+	if diff.Has(kinds) {
+		exitWithStatus(1)
+	}
+}
+
+//diffKindsOrFail checks the --format and --show-values flags of config:diff and config:drift, and
+// returns the kinds of keys given with --fail-on that make the command exit non-zero
+func diffKindsOrFail(format string, showValues bool, failOn string) map[string]bool {
+	switch format {
+	case "text":
+		if showValues {
+			failInvalid("--show-values only applies to --format json")
+		}
+	case "json":
+	default:
+		failInvalid(fmt.Sprintf("Unknown format: %v", format))
+	}
+	kinds, err := ParseDiffKinds(failOn)
+	if err != nil {
+		failWith(err)
+	}
+	return kinds
+}
+
+//printDiffReport prints a DiffReport as a single line of json
+func printDiffReport(report DiffReport) {
+	out, err := json.Marshal(report)
+	if err != nil {
+		failWith(err)
+	}
+	fmt.Println(string(out))
+}
+
+//printEnvDiff prints the keys of a diff, but never their values, labelling each kind of change
+func printEnvDiff(diff EnvDiff, added string, removed string, changed string) {
+	lines := []string{}
+	for _, k := range diff.Added {
+		lines = append(lines, added+":\x00"+k)
+	}
+	for _, k := range diff.Removed {
+		lines = append(lines, removed+":\x00"+k)
+	}
+	for _, k := range diff.Changed {
+		lines = append(lines, changed+":\x00"+k)
+	}
+	if len(lines) == 0 {
+		return
+	}
+	colConfig := columnize.DefaultConfig()
+	colConfig.Prefix = "       "
+	colConfig.Delim = "\x00"
+	fmt.Println(columnize.Format(lines, colConfig))
+}
+
+//CommandExpireCheck implements config:expire-check
+func CommandExpireCheck(args []string, target TargetFlags, all bool, restart bool, noRestart bool) {
+	appNames := []string{}
+	if all {
+		if len(args) > 0 || target.Global || target.App != "" {
+			failInvalid("--all cannot be combined with an app name, --app or --global")
+		}
+		//an install without apps still has a global env to check
+		apps, _ := activeHost.Apps()
+		appNames = append([]string{""}, apps...)
+	} else {
+		appName, trailingArgs := getCommonArgs(target, args)
+		if len(trailingArgs) > 0 {
+			failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		}
+		appNames = append(appNames, appName)
+	}
+
+	failed := false
+	for _, appName := range appNames {
+		if err := expireKeys(appName, restartPolicyOrFail(appName, restart, noRestart)); err != nil {
+			common.LogWarn(err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		exitWithStatus(1)
+	}
+}
+
+//CommandPrune implements config:prune
+func CommandPrune(args []string, target TargetFlags, confirm bool, restart bool, noRestart bool) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	contextName := Target{AppName: appName}.Label()
+	if !confirm {
+		keys := blankKeys(getEnvironment(appName, false))
+		if len(keys) == 0 {
+			common.LogInfo1Quiet(fmt.Sprintf("No empty keys in %s", contextName))
+			return
+		}
+		common.LogInfo1(fmt.Sprintf("Empty keys in %s: %s", contextName, strings.Join(keys, ", ")))
+		common.LogVerboseQuiet("Run again with --confirm to unset them")
+		return
+	}
+	policy := restartPolicyOrFail(appName, restart, noRestart)
+	pruned, err := PruneBlankKeys(appName, policy)
+	if err != nil {
+		failWrite(appName, err)
+	}
+	if len(pruned) == 0 {
+		common.LogInfo1Quiet(fmt.Sprintf("No empty keys in %s", contextName))
+		return
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Removed %d empty key(s) from %s: %s", len(pruned), contextName, strings.Join(pruned, ", ")))
+}
+
+//CommandHistoryPrune implements config:history:prune
+func CommandHistoryPrune(args []string, target TargetFlags, all bool) {
+	appNames := []string{}
+	if all {
+		if len(args) > 0 || target.Global || target.App != "" {
+			failInvalid("--all cannot be combined with an app name, --app or --global")
+		}
+		apps, _ := activeHost.Apps()
+		appNames = append([]string{""}, apps...)
+	} else {
+		appName, trailingArgs := getCommonArgs(target, args)
+		if len(trailingArgs) > 0 {
+			failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		}
+		appNames = append(appNames, appName)
+	}
+
+	failed := false
+	for _, appName := range appNames {
+		contextName := Target{AppName: appName}.Label()
+		result, err := PruneHistory(appName)
+		if err != nil {
+			common.LogWarn(fmt.Sprintf("Unable to prune the history of %s: %s", contextName, err.Error()))
+			failed = true
+			continue
+		}
+		if len(result.RemovedReleases) > 0 {
+			removed := make([]string, len(result.RemovedReleases))
+			for i, release := range result.RemovedReleases {
+				removed[i] = strconv.Itoa(release)
+			}
+			common.LogInfo1Quiet(fmt.Sprintf("Removed %d release snapshot(s) of %s: %s", len(removed), contextName, strings.Join(removed, ", ")))
+		}
+		if result.RotatedAudit {
+			common.LogInfo1Quiet(fmt.Sprintf("Rotated the audit log of %s", contextName))
+		}
+	}
+	if failed {
+		exitWithStatus(1)
+	}
+}
+
+//expireKeys unsets the expired keys of an app or the global env, restarting the app according to
+// policy, and logs each of them
+func expireKeys(appName string, policy RestartPolicy) error {
+	contextName := Target{AppName: appName}.Label()
+	expired, err := ExpireKeys(appName, time.Now(), policy)
+	if err != nil {
+		return fmt.Errorf("Unable to remove expired keys from %s: %s", contextName, err.Error())
+	}
+	for _, k := range expired {
+		common.LogInfo1Quiet(fmt.Sprintf("Removed expired key %s from %s", k, contextName))
+	}
+	return nil
+}
+
+//CommandReleaseDiff implements config:release-diff
+func CommandReleaseDiff(args []string, format string) {
+	if len(args) != 3 {
+		failInvalid("Expected: <app> <release> <release>")
+	}
+	appName := args[0]
+	snapshots := make([]ReleaseSnapshot, 2)
+	for i, arg := range args[1:] {
+		release, err := strconv.Atoi(arg)
+		if err != nil {
+			failInvalid(fmt.Sprintf("Invalid release: %s", arg))
+		}
+		if snapshots[i], err = LoadRelease(appName, release); err != nil {
+			failWith(err)
+		}
+	}
+	diff := DiffReleases(snapshots[0], snapshots[1])
+
+	switch format {
+	case "json":
+		out, err := json.Marshal(diff)
+		if err != nil {
+			failWith(err)
+		}
+		fmt.Println(string(out))
+	case "text":
+		common.LogInfo2Quiet(fmt.Sprintf("%s config changes from release %s to %s", appName, args[1], args[2]))
+		if diff.Empty() {
+			common.LogVerboseQuiet("No changes")
+			return
+		}
+		for _, k := range diff.Added {
+			fmt.Printf("       + %s\n", k)
+		}
+		for _, k := range diff.Removed {
+			fmt.Printf("       - %s\n", k)
+		}
+		for _, k := range diff.Changed {
+			fmt.Printf("       ~ %s\n", k)
+		}
+	default:
+		failInvalid(fmt.Sprintf("Unknown format: %v", format))
+	}
+}
+
+//CommandRedactionEnable implements config:redaction:enable
+func CommandRedactionEnable(args []string) {
+	appName := redactionArgs(args)
+	setProperty(appName, "redaction", "true", false)
+}
+
+//CommandRedactionDisable implements config:redaction:disable
+func CommandRedactionDisable(args []string) {
+	appName := redactionArgs(args)
+	setProperty(appName, "redaction", "", false)
+}
+
+func redactionArgs(args []string) string {
+	if len(args) != 1 {
+		failInvalid("Expected: <app>")
+	}
+	if err := activeHost.VerifyApp(args[0]); err != nil {
+		failWith(err)
+	}
+	return args[0]
+}
+
+//CommandRestartScope implements config:restart-scope
+func CommandRestartScope(args []string) {
+	if len(args) != 1 {
+		failInvalid("Expected: <app>")
+	}
+	appName := args[0]
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	scopes, err := GetRestartScopes(appName)
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s restart scopes", appName))
+	if len(scopes) == 0 {
+		common.LogVerbose("No restart scopes, all process types are restarted on change")
+		return
+	}
+	lines := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		lines = append(lines, fmt.Sprintf("%s:\x00%s", scope.Pattern, strings.Join(scope.ProcessTypes, ", ")))
+	}
+	colConfig := columnize.DefaultConfig()
+	colConfig.Delim = "\x00"
+	colConfig.Prefix = "       "
+	fmt.Println(columnize.Format(lines, colConfig))
+}
+
+//CommandRestartScopeSet implements config:restart-scope:set
+func CommandRestartScopeSet(args []string) {
+	if len(args) < 3 {
+		failInvalid("Expected: <app> <pattern> <process-type> [<process-type> ...]")
+	}
+	appName := args[0]
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	if err := SetRestartScope(appName, args[1], args[2:]); err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("Restarting only %s when keys matching %s change", strings.Join(args[2:], ", "), args[1]))
+}
+
+//CommandRestartScopeUnset implements config:restart-scope:unset
+func CommandRestartScopeUnset(args []string) {
+	if len(args) != 2 {
+		failInvalid("Expected: <app> <pattern>")
+	}
+	appName := args[0]
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	if err := UnsetRestartScope(appName, args[1]); err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("Removed restart scope for %s", args[1]))
+}
+
+//CommandNotificationsList implements config:notifications:list
+func CommandNotificationsList(args []string, target TargetFlags) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	endpoints, err := GetNotificationEndpoints(appName)
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s config notifications", Target{AppName: appName}.Label()))
+	if len(endpoints) == 0 {
+		common.LogVerbose("No endpoints are notified of config changes")
+		return
+	}
+	for _, endpoint := range endpoints {
+		common.LogVerbose(endpoint.URL)
+	}
+}
+
+//CommandNotificationsAdd implements config:notifications:add
+func CommandNotificationsAdd(args []string, target TargetFlags) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) != 1 {
+		failInvalid("Expected: <url>")
+	}
+	endpoint, err := AddNotificationEndpoint(appName, trailingArgs[0])
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Notifying %s of config changes", endpoint.URL))
+	common.LogVerbose(fmt.Sprintf("Notifications are signed in the %s header with the secret %s", NotificationSignatureHeader, endpoint.Secret))
+}
+
+//CommandNotificationsRemove implements config:notifications:remove
+func CommandNotificationsRemove(args []string, target TargetFlags) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) != 1 {
+		failInvalid("Expected: <url>")
+	}
+	if err := RemoveNotificationEndpoint(appName, trailingArgs[0]); err != nil {
+		failWith(err)
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("No longer notifying %s of config changes", trailingArgs[0]))
+}
+
+//CommandTemplateShow implements config:template:show
+func CommandTemplateShow(args []string) {
+	if len(args) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", args))
+	}
+	tmpl, err := LoadTemplateEnv()
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo2Quiet("config template")
+	if tmpl.Len() == 0 {
+		common.LogVerbose("No config template, new apps start with an empty environment")
+		return
+	}
+	fmt.Println(exportOrFail(tmpl, ExportFormatPretty, ExportOptions{}))
+}
+
+//CommandTemplateSet implements config:template:set
+func CommandTemplateSet(args []string) {
+	if len(args) == 0 {
+		failInvalid("Expected: KEY1=VALUE1 [KEY2=VALUE2 ...]")
+	}
+	entries := map[string]string{}
+	for _, e := range args {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 1 {
+			failInvalid("Invalid env pair: " + e)
+		}
+		if err := validateKey(parts[0]); err != nil {
+			failWith(err)
+		}
+		if err := validateValue(parts[0], parts[1]); err != nil {
+			failWith(err)
+		}
+		entries[parts[0]] = parts[1]
+	}
+	err := UpdateTemplate(func(env *Env) error {
+		for k, v := range entries {
+			if err := env.Set(k, v); err != nil {
+				return &ValidationError{Message: fmt.Sprintf("Invalid value for key '%s': %s", k, err.Error())}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo1Quiet("Setting config template vars")
+	if os.Getenv("DOKKU_QUIET_OUTPUT") == "" {
+		fmt.Println(prettyPrintEnvEntries("       ", entries))
+	}
+}
+
+//CommandTemplateUnset implements config:template:unset
+func CommandTemplateUnset(args []string) {
+	if len(args) == 0 {
+		failInvalid("Expected: KEY1 [KEY2 ...]")
+	}
+	for _, k := range args {
+		if err := validateKey(k); err != nil {
+			failWith(err)
+		}
+	}
+	err := UpdateTemplate(func(env *Env) error {
+		for _, k := range args {
+			if err := env.Unset(k); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		failWith(err)
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Removed %s from the config template", strings.Join(args, ", ")))
+}
+
+//CommandTemplateApply implements config:template:apply
+func CommandTemplateApply(args []string, restart bool, noRestart bool) {
+	if len(args) != 1 {
+		failInvalid("Expected: <app>")
+	}
+	appName := args[0]
+	if err := activeHost.VerifyApp(appName); err != nil {
+		failWith(err)
+	}
+	policy := restartPolicyOrFail(appName, restart, noRestart)
+	added, err := ApplyTemplate(appName, policy)
+	if err != nil {
+		failWrite(appName, err)
+	}
+	if len(added) == 0 {
+		common.LogInfo1Quiet(fmt.Sprintf("%s already has every key of the config template", appName))
+		return
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Added %d key(s) from the config template to %s: %s", len(added), appName, strings.Join(added, ", ")))
+}
+
+//CommandAuditSecrets implements config:audit-secrets
+func CommandAuditSecrets(args []string, target TargetFlags, format string) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	findings, err := AuditAppSecrets(appName)
+	if err != nil {
+		failWith(err)
+	}
+
+	contextName := Target{AppName: appName}.Label()
+	printFindings(contextName+" secrets audit", findings, format)
+	if len(findings) > 0 {
+		exitWithStatus(1)
+	}
+}
+
+//CommandAuditPermissions implements config:audit-permissions
+func CommandAuditPermissions(args []string, target TargetFlags) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	checks, err := AuditPermissions(appName)
+	if err != nil {
+		failWith(err)
+	}
+
+	failed := false
+	lines := []string{}
+	for _, check := range checks {
+		mode, owner := "missing", "-"
+		if check.Exists {
+			mode, owner = check.Mode.String(), check.Owner
+		}
+		status := "ok"
+		if check.ReadOnlyFilesystem {
+			status = "read-only filesystem"
+		} else if !check.Writable {
+			status = "not writable"
+		}
+		failed = failed || !check.OK()
+		lines = append(lines, strings.Join([]string{check.Path, mode, owner, status}, "\x00"))
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s permissions audit", Target{AppName: appName}.Label()))
+	colConfig := columnize.DefaultConfig()
+	colConfig.Prefix = "       "
+	colConfig.Delim = "\x00"
+	fmt.Println(columnize.Format(lines, colConfig))
+	if failed {
+		exitWithStatus(1)
+	}
+}
+
+//CommandLint implements config:lint
+func CommandLint(args []string, target TargetFlags, format string, strict bool) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	findings, err := Lint(appName)
+	if err != nil {
+		failWith(err)
+	}
+
+	contextName := Target{AppName: appName}.Label()
+	printFindings(contextName+" config lint", findings, format)
+
+	for _, f := range findings {
+		if f.Severity == SeverityError || strict {
+			exitWithStatus(1)
+		}
+	}
+}
+
+//printFindings prints the findings of a check as text under the given header, or as json
+func printFindings(header string, findings []Finding, format string) {
+	switch format {
+	case "json":
+		out, err := json.Marshal(findings)
+		if err != nil {
+			failWith(err)
+		}
+		fmt.Println(string(out))
+	case "text":
+		common.LogInfo2Quiet(header)
+		if len(findings) == 0 {
+			common.LogVerboseQuiet("No issues found")
+			break
+		}
+		lines := make([]string, 0, len(findings))
+		for _, f := range findings {
+			location := "-"
+			if f.Line > 0 {
+				location = fmt.Sprintf("line %d", f.Line)
+			}
+			lines = append(lines, fmt.Sprintf("%s\x00%s\x00%s\x00%s", f.Severity, f.Check, location, f.Message))
+		}
+		colConfig := columnize.DefaultConfig()
+		colConfig.Prefix = "       "
+		colConfig.Delim = "\x00"
+		fmt.Println(columnize.Format(lines, colConfig))
+	default:
+		failInvalid(fmt.Sprintf("Unknown format: %v", format))
+	}
+}
+
+func formatLimit(limit int) string {
+	if limit == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d bytes", limit)
+}
+
+//getMetadata returns the metadata of the keys in env that have a description or an expiry
+func getMetadata(env *Env) map[string]KeyMetadata {
+	shown := map[string]KeyMetadata{}
+	meta, err := env.Metadata()
+	if err != nil {
+		common.LogWarn(err.Error())
+		return shown
+	}
+	for k, m := range meta {
+		if m.Description != "" || m.ExpiresAt != nil || m.Provider != "" {
+			shown[k] = m
+		}
+	}
+	return shown
+}
+
+//prettyPrintWithMetadata prints the env in columns, followed by the expiry and the description of each key.
+// Keys given a provider are listed along with the others, with the provider in place of their value,
+// and sealed values are shown as <sealed>
+func prettyPrintWithMetadata(env *Env, meta map[string]KeyMetadata) string {
+	expiries := false
+	keys := append([]string{}, env.sortKeys()...)
+	for k, m := range meta {
+		expiries = expiries || m.ExpiresAt != nil
+		if _, ok := env.values()[k]; !ok && m.Provider != "" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	colConfig := columnize.DefaultConfig()
+	colConfig.Delim = "\x00"
+	lines := make([]string, 0, len(keys))
+	for _, k := range keys {
+		m := meta[k]
+		value, ok := env.values()[k]
+		if !ok {
+			value = fmt.Sprintf("<computed by %s>", m.Provider)
+		}
+		value = displayValue(value)
+		line := k + ":\x00" + value
+		if expiries {
+			line += "\x00"
+			if m.ExpiresAt != nil {
+				line += "expires " + m.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+		}
+		if m.Description != "" {
+			line += "\x00# " + m.Description
+		}
+		lines = append(lines, line)
+	}
+	return columnize.Format(lines, colConfig)
+}
+
+func exportOrFail(env *Env, format ExportFormat, opts ExportOptions) string {
+	exported, err := env.ExportWithOptions(format, opts)
+	if err != nil {
+		failWith(err)
+	}
+	return exported
+}
+
+//streamExportOrFail writes the env to stdout in the given format as ExportTo does, followed by
+// suffix unless nothing was written, as terminateExport would
+func streamExportOrFail(env *Env, format ExportFormat, opts ExportOptions, suffix string) {
+	tracked := &writeTracker{w: os.Stdout}
+	if err := env.ExportTo(tracked, format, opts); err != nil {
+		failWith(err)
+	}
+	if tracked.written {
+		fmt.Print(suffix)
+	}
+}
+
+//restartPolicyOrFail returns the restart policy of a command changing the config of an app,
+// printing the decision if the flags or the config-restart-policy property made one
+func restartPolicyOrFail(appName string, restart bool, noRestart bool) RestartPolicy {
+	return restartPolicyOrDefault(appName, restart, noRestart, RestartPolicyAlways)
+}
+
+//restartPolicyOrDefault is restartPolicyOrFail for a command that applies fallback rather than
+// restarting if neither the flags nor the config-restart-policy property decide
+func restartPolicyOrDefault(appName string, restart bool, noRestart bool, fallback RestartPolicy) RestartPolicy {
+	policy, decision, err := resolveRestartPolicy(appName, restart, noRestart)
+	if err != nil {
+		failWith(err)
+	}
+	if decision == "" {
+		return fallback
+	}
+	if appName != "" {
+		common.LogVerboseQuiet(decision)
+	}
+	return policy
+}
+
+//writeOutput prints contents to stdout, or writes them to a file only readable by the dokku user
+// if output is set to anything but -. An existing file is only replaced if force is set
+func writeOutput(output string, contents []byte, force bool) {
+	if output == "" || output == "-" {
+		os.Stdout.Write(contents)
+		return
+	}
+	if err := writeOutputFile(output, contents, force); os.IsExist(err) {
+		logFail(fmt.Sprintf("Refusing to overwrite existing file %s, use --force to replace it", output))
+	} else if err != nil {
+		logFail(fmt.Sprintf("Unable to write %s: %s", output, err.Error()))
+	}
+}
+
+//CommandReport implements config:report, displaying a report of the config of one or all apps.
+// The first argument starting with -- other than --format is the info flag to extract. The json
+// format of all apps is a single object keyed by app name
+func CommandReport(args []string) {
+	appName, infoFlag, format := "", "", reportFormatStdout
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--format" && i+1 < len(args):
+			format = args[i+1]
+			i++
+		case strings.HasPrefix(args[i], "--format="):
+			format = strings.TrimPrefix(args[i], "--format=")
+		case strings.HasPrefix(args[i], "--") && infoFlag == "":
+			infoFlag = args[i]
+		case appName == "" && !strings.HasPrefix(args[i], "--"):
+			appName = args[i]
+		default:
+			failInvalid(fmt.Sprintf("Trailing argument(s): %v", args[i:]))
+		}
+	}
+	if format != reportFormatStdout && format != reportFormatJSON {
+		failInvalid(fmt.Sprintf("Invalid --format value '%s', expected %s or %s", format, reportFormatStdout, reportFormatJSON))
+	}
+
+	if appName != "" {
+		ReportSingleApp(appName, infoFlag, format)
+		return
+	}
+	apps, err := activeHost.Apps()
+	if err != nil && err != ErrNoApps {
+		failWith(err)
+	}
+	//the json report of all apps is then an empty object
+	if len(apps) == 0 && format == reportFormatStdout {
+		common.LogInfo1(ErrNoApps.Error())
+		return
+	}
+	if format == reportFormatJSON && infoFlag == "" {
+		reports := make(map[string]json.RawMessage, len(apps))
+		for _, appName := range apps {
+			infoFlags, err := reportInfoFlags(appName)
+			if err != nil {
+				failWith(err)
+			}
+			if reports[appName], err = reportJSON(infoFlags); err != nil {
+				failWith(err)
+			}
+		}
+		b, err := json.Marshal(reports)
+		if err != nil {
+			failWith(err)
+		}
+		fmt.Println(string(b))
+		return
+	}
+	for _, appName := range apps {
+		ReportSingleApp(appName, infoFlag, format)
+	}
+}
+
+//CommandResolve implements config:resolve, showing the value of a key in every layer of the env of
+// a container of the given process type in the given phase, followed by the app references the
+// effective value is resolved through
+func CommandResolve(args []string, target TargetFlags, procType string, phase string) {
+	appName, keys := getCommonArgs(target, args)
+	if len(keys) != 1 {
+		failInvalid("Expected: key")
+	}
+	if err := validateKey(keys[0]); err != nil {
+		failWith(err)
+	}
+	effective, err := ResolveEffectiveEnv(appName, procType, phase)
+	if err != nil {
+		failWith(err)
+	}
+	chain := effective.Chain(keys[0])
+	if len(chain) == 0 {
+		failWithStatus(ExitStatusKeyNotSet, fmt.Sprintf("%s is not set for %s", keys[0], effective.Env.name))
+	}
+	steps, err := newReferenceResolver().chain(effective.Env.name, keys[0], chain[len(chain)-1].Value)
+	if err != nil {
+		failWith(err)
+	}
+	excluded, err := noExportKeys(appName)
+	if err != nil {
+		failWith(err)
+	}
+	lines := make([]string, 0, len(chain)+len(steps))
+	for i, layer := range chain {
+		source := layer.Filename
+		if layer.Plugin != "" {
+			source = "plugin " + layer.Plugin
+		}
+		line := fmt.Sprintf("%s:\x00%s\x00%s", layer.Layer, source, displayValue(layer.Value))
+		if i < len(chain)-1 {
+			line += "\x00(overridden)"
+		} else if excluded[keys[0]] {
+			//only the value of the app itself is handed to its containers
+			line += "\x00(no-export, kept out of containers)"
+		}
+		lines = append(lines, line)
+	}
+	for _, step := range steps[1:] {
+		lines = append(lines, fmt.Sprintf("reference:\x00%s:%s\x00%s", step.App, step.Key, displayValue(step.Value)))
+	}
+	common.LogInfo2Quiet(fmt.Sprintf("%s of %s", keys[0], steps[0].App))
+	colConfig := columnize.DefaultConfig()
+	colConfig.Delim = "\x00"
+	fmt.Println(columnize.Format(lines, colConfig))
+}
+
+//CommandMigrateFormat implements config:migrate-format. With all, the global ENV file and those of
+// every app are migrated, each with its own backup
+func CommandMigrateFormat(args []string, target TargetFlags, toVersion int, transcode string, all bool) {
+	appNames := []string{}
+	if all {
+		if len(args) > 0 || target.Global || target.App != "" {
+			failInvalid("--all cannot be combined with an app name, --app or --global")
+		}
+		apps, _ := activeHost.Apps()
+		sort.Strings(apps)
+		appNames = append([]string{""}, apps...)
+	} else {
+		appName, trailingArgs := getCommonArgs(target, args)
+		if len(trailingArgs) > 0 {
+			failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+		}
+		appNames = append(appNames, appName)
+	}
+	if err := validateFormatVersion(toVersion); err != nil {
+		failWith(err)
+	}
+	policy := InvalidUTF8Policy("")
+	if transcode != "" {
+		var err error
+		if policy, err = ParseInvalidUTF8Policy(transcode); err != nil {
+			failWith(err)
+		}
+	}
+
+	if !all {
+		if err := migrateFormat(appNames[0], toVersion, policy); err != nil {
+			failWith(err)
+		}
+		return
+	}
+	//every file is migrated even if one fails, as each is backed up on its own
+	failed := false
+	for _, appName := range appNames {
+		if err := migrateFormat(appName, toVersion, policy); err != nil {
+			common.LogWarn(err.Error())
+			failed = true
+		}
+	}
+	if failed {
+		exitWithStatus(1)
+	}
+}
+
+//migrateFormat upgrades the ENV file of an app, or the global one if appName is empty, to the given
+// format version, first transcoding its values with policy unless it is empty
+func migrateFormat(appName string, toVersion int, policy InvalidUTF8Policy) error {
+	name, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return err
+	}
+	if policy != "" {
+		backup, keys, err := TranscodeEnvFile(name, filename, policy)
+		if err != nil {
+			return err
+		}
+		if backup == "" {
+			common.LogInfo1Quiet(fmt.Sprintf("Config for %s holds no values that are not valid UTF-8", name))
+		} else {
+			common.LogInfo1Quiet(fmt.Sprintf("Rewrote %s of %s as UTF-8 with the %s policy", strings.Join(keys, ", "), name, policy))
+			common.LogVerboseQuiet(fmt.Sprintf("The previous file has been backed up to %s", backup))
+		}
+	}
+	backup, err := MigrateEnvFile(filename, toVersion)
+	if err != nil {
+		return err
+	}
+	if backup == "" {
+		common.LogInfo1Quiet(fmt.Sprintf("Config for %s is already at ENV format version %d", name, toVersion))
+		return nil
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Migrated config for %s to ENV format version %d", name, toVersion))
+	common.LogVerboseQuiet(fmt.Sprintf("The previous file has been backed up to %s", backup))
+	return nil
+}
+
+//CommandConvert implements config:convert, rewriting an ENV file in another file format and
+// setting the env-file-format property so that later changes keep it
+func CommandConvert(args []string, target TargetFlags, to string) {
+	appName, trailingArgs := getCommonArgs(target, args)
+	if len(trailingArgs) > 0 {
+		failInvalid(fmt.Sprintf("Trailing argument(s): %v", trailingArgs))
+	}
+	format, err := ParseEnvFileFormat(to)
+	if err != nil {
+		failWith(err)
+	}
+	if format == "" {
+		failInvalid(fmt.Sprintf("--to is required, expected %s or %s", EnvFileFormatEnvfile, EnvFileFormatExportfile))
+	}
+	name, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		failWith(err)
+	}
+	backup, err := ConvertEnvFile(name, filename, format)
+	if err != nil {
+		failWith(err)
+	}
+	if appName == "" {
+		err = common.PropertyWrite("config", "--global", "env-file-format", string(format))
+	} else {
+		err = writeAppProperty(appName, "env-file-format", string(format))
+	}
+	if err != nil {
+		failWith(err)
+	}
+	if backup == "" {
+		common.LogInfo1Quiet(fmt.Sprintf("Config for %s is already in the %s format", name, format))
+		return
+	}
+	common.LogInfo1Quiet(fmt.Sprintf("Converted config for %s to the %s format", name, format))
+	common.LogVerboseQuiet(fmt.Sprintf("The previous file has been backed up to %s", backup))
+}
+
+//getEnvironment for the given app (global config if appName is empty). Merge with global environment if merged is true.
+// The env is only read by the commands, so it is returned read-only
+func getEnvironment(appName string, merged bool) (env *Env) {
+	var err error
+	if appName != "" && merged {
+		env, err = LoadMergedAppEnv(appName)
+	} else {
+		env, err = loadAppOrGlobalEnv(appName)
+	}
+	if err != nil {
+		failWith(err)
+	}
+	if env.IsReadOnly() {
+		return env
+	}
+	return env.ReadOnly()
+}
+
+//getTargetEnvironment is getEnvironment for a target, which reads the file of a target given with
+// --file without ever using DOKKU_ROOT
+func getTargetEnvironment(t Target, merged bool) *Env {
+	if t.File == "" {
+		return getEnvironment(t.AppName, merged)
+	}
+	if merged {
+		failInvalid("--merged cannot be combined with --file")
+	}
+	env, err := LoadGlobalEnv(WithFile(t.File))
+	if err != nil {
+		failWith(err)
+	}
+	return env
+}
+
+//warnAboutParsing prints the parse warnings of the ENV file of the target, and of the global ENV
+// file as well if merged is set for an app, to stderr. The command fails if there were any and
+// warningsAsErrors is set
+func warnAboutParsing(t Target, merged bool, warningsAsErrors bool) {
+	envs := []*Env{getTargetEnvironment(t, false)}
+	if merged && t.AppName != "" {
+		envs = append(envs, getEnvironment("", false))
+	}
+	count := 0
+	for _, env := range envs {
+		for _, w := range env.Warnings() {
+			common.LogWarn(fmt.Sprintf("%s %s", env.filename, w.String()))
+			count++
+		}
+	}
+	if count > 0 && warningsAsErrors {
+		failInvalid(fmt.Sprintf("Found %d parse warning(s), failing as --warnings-as-errors was given", count))
+	}
+}
+
+//withoutNoExportKeysOrFail returns a copy of env without the keys tagged no-export
+func withoutNoExportKeysOrFail(env *Env, appName string) *Env {
+	filtered, err := withoutNoExportKeys(env, appName)
+	if err != nil {
+		failWith(err)
+	}
+	return filtered
+}
+
+//resolveReferencesOrFail returns a copy of env with references to other apps resolved
+func resolveReferencesOrFail(env *Env) *Env {
+	resolved, err := env.ResolveReferences()
+	if err != nil {
+		failWith(err)
+	}
+	return resolved
+}
+
+//failWrite fails a command whose change to an env could not be made, pointing to
+// config:audit-permissions when the files of the env are not writable, or whose change was made
+// but the app then failed to restart
+func failWrite(appName string, err error) {
+	if _, ok := err.(*ErrEnvNotWritable); ok {
+		arg := appName
+		if arg == "" {
+			arg = "--global"
+		}
+		failWithStatus(ExitStatusNotWritable, fmt.Sprintf("%s. Run dokku config:audit-permissions %s to check the files of the env", err.Error(), arg))
+	}
+	if _, ok := err.(*RestartError); ok {
+		failWithStatus(ExitStatusRestartFailed, fmt.Sprintf("%s. The config change was kept, run dokku ps:restart %s to apply it", err.Error(), appName))
+	}
+	failWith(err)
+}
+
+//getCommonArgs extracts common positional args (appName and keys)
+func getCommonArgs(target TargetFlags, args []string) (appName string, keys []string) {
+	resolved, keys := resolveTargetOrFail(target, args)
+	return resolved.AppName, keys
+}
+
+//resolveTargetOrFail is getCommonArgs for the commands that read the env, which may be given with --file
+func resolveTargetOrFail(target TargetFlags, args []string) (Target, []string) {
+	resolved, keys, err := ResolveTarget(target, args)
+	if err != nil {
+		failInvalid(err.Error())
+	}
+	return resolved, keys
 }
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"io"
+	"sync"
+)
+
+//SyncEnv wraps an Env so that it can be read and changed from several goroutines, such as by
+// a long-running plugin that keeps an Env around while another goroutine reloads it.
+// Every method takes a lock on the wrapped Env, which must not be used directly afterwards
+type SyncEnv struct {
+	mu  sync.RWMutex
+	env *Env
+}
+
+//Reload reads the file this Env was loaded from again, replacing its contents in place.
+// Ordered mode is kept. Reload is not safe for concurrent use, use SyncEnv.Reload for that
+func (e *Env) Reload() error {
+	if e.filename == "" {
+		return e.errNotBound()
+	}
+	fresh, err := loadFromFile(e.name, e.filename)
+	if err != nil {
+		return err
+	}
+	ordered, scope := e.ordered, e.scope
+	*e = *fresh
+	e.scope = scope
+	if ordered {
+		e.PreserveOrder()
+	}
+	return nil
+}
+
+//Synchronized returns a SyncEnv wrapping this Env
+func (e *Env) Synchronized() *SyncEnv {
+	//filling the key cache up front keeps readers from writing to it
+	e.sortKeys()
+	return &SyncEnv{env: e}
+}
+
+//Get an environment variable
+func (s *SyncEnv) Get(key string) (value string, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.Get(key)
+}
+
+//GetDefault an environment variable or a default if it doesn't exist
+func (s *SyncEnv) GetDefault(key string, defaultValue string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.GetDefault(key, defaultValue)
+}
+
+//GetBoolDefault gets the bool value of the given key with the given default
+func (s *SyncEnv) GetBoolDefault(key string, defaultValue bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.GetBoolDefault(key, defaultValue)
+}
+
+//Set an environment variable
+func (s *SyncEnv) Set(key string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.env.Set(key, value)
+	s.env.sortKeys()
+	return err
+}
+
+//Unset an environment variable
+func (s *SyncEnv) Unset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.env.Unset(key)
+	s.env.sortKeys()
+	return err
+}
+
+//Keys gets the keys in this environment
+func (s *SyncEnv) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.Keys()
+}
+
+//OrderedKeys gets the keys in this environment in the order of Env.OrderedKeys
+func (s *SyncEnv) OrderedKeys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.OrderedKeys()
+}
+
+//Len returns the number of items in this environment
+func (s *SyncEnv) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.Len()
+}
+
+//Map returns a copy of the environment as a map
+func (s *SyncEnv) Map() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	envMap := make(map[string]string, len(s.env.values()))
+	for k, v := range s.env.values() {
+		envMap[k] = v
+	}
+	return envMap
+}
+
+//Snapshot returns a copy of the wrapped Env, which the caller may use without locking
+func (s *SyncEnv) Snapshot() *Env {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.clone()
+}
+
+//Checksum returns a sha256 of the keys and values of this environment
+func (s *SyncEnv) Checksum() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.Checksum()
+}
+
+//Export the environment in the given format
+func (s *SyncEnv) Export(format ExportFormat) string {
+	//the json format reads key metadata on first use, which fills the Env
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.env.Export(format)
+}
+
+//ExportWithOptions exports the environment in the given format, quoting values as specified by opts
+func (s *SyncEnv) ExportWithOptions(format ExportFormat, opts ExportOptions) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.env.ExportWithOptions(format, opts)
+}
+
+//ExportTo writes the environment to w in the given format, see Env.ExportTo. The lock is held
+// until the whole environment has been written
+func (s *SyncEnv) ExportTo(w io.Writer, format ExportFormat, opts ExportOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.env.ExportTo(w, format, opts)
+}
+
+//Write the environment back to the file it was read from, see Env.Write
+func (s *SyncEnv) Write() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.env.Write()
+}
+
+//Reload reads the file the environment was loaded from again. Readers see either the old or
+// the new contents, never a mix of both. On error the contents are left unchanged
+func (s *SyncEnv) Reload() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.env.Reload(); err != nil {
+		return err
+	}
+	s.env.sortKeys()
+	return nil
+}
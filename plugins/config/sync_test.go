@@ -0,0 +1,102 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestEnvReload(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-reload")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("export A='1'\n"), 0600)).To(Succeed())
+
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	env.PreserveOrder()
+	Expect(env.Set("LOCAL", "dropped")).To(Succeed())
+	Expect(ioutil.WriteFile(filename, []byte("export B='2'\nexport A='changed'\n"), 0600)).To(Succeed())
+
+	Expect(env.Reload()).To(Succeed())
+	Expect(env.Map()).To(Equal(pairs("A", "changed", "B", "2")))
+	Expect(env.Keys()).To(Equal([]string{"A", "B"}))
+	Expect(env.OrderedKeys()).To(Equal([]string{"B", "A"}))
+	Expect(env.ordered).To(BeTrue())
+
+	//a removed file is an empty env, the same as when loading
+	Expect(os.Remove(filename)).To(Succeed())
+	Expect(env.Reload()).To(Succeed())
+	Expect(env.Len()).To(Equal(0))
+
+	Expect(NewForTest(t, pairs("A", "1")).Reload()).NotTo(Succeed())
+}
+
+func TestSyncEnvConcurrent(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-sync")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("export SHARED='1'\n"), 0600)).To(Succeed())
+
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	synced := env.Synchronized()
+
+	//run with -race to check that none of these conflict
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 4; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				key := fmt.Sprintf("KEY_%d_%d", i, j)
+				if err := synced.Set(key, "value"); err != nil {
+					errs <- err
+				}
+				synced.Unset(key)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if _, ok := synced.Get("SHARED"); !ok {
+					errs <- fmt.Errorf("SHARED missing")
+				}
+				synced.Keys()
+				synced.Len()
+				synced.Map()
+				synced.Checksum()
+				synced.Export(ExportFormatJSON)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if err := synced.Reload(); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	Expect(synced.Set("AFTER", "1")).To(Succeed())
+	snapshot := synced.Snapshot()
+	Expect(synced.Reload()).To(Succeed())
+	Expect(synced.Map()).To(Equal(pairs("SHARED", "1")))
+	Expect(snapshot.Map()).To(HaveKey("AFTER"))
+}
@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"strconv"
+)
+
+//Target is the env a config command works on: the global env, the env of an app, or an ENV file
+// outside of any dokku install that is only ever read
+type Target struct {
+	//AppName is empty for the global env
+	AppName string
+	//File is set to the ENV file given with --file, in which case AppName is empty
+	File string
+}
+
+//Global reports whether the target is the global env
+func (t Target) Global() bool {
+	return t.AppName == "" && t.File == ""
+}
+
+//Label names the target in output, as "global", the name of the app or the path of the file
+func (t Target) Label() string {
+	if t.File != "" {
+		return t.File
+	}
+	if t.Global() {
+		return "global"
+	}
+	return t.AppName
+}
+
+//TargetFlags are the flags that point a config subcommand at an env
+type TargetFlags struct {
+	Global bool
+	App    string
+	//File is only registered by AddReadOnlyTargetFlags
+	File string
+}
+
+//AddTargetFlags registers --global and --app on the flag set of a subcommand
+func AddTargetFlags(args *flag.FlagSet) *TargetFlags {
+	flags := &TargetFlags{}
+	args.BoolVar(&flags.Global, "global", false, "--global: use the global environment")
+	args.StringVar(&flags.App, "app", "", "--app: use the environment of this app")
+	return flags
+}
+
+//AddReadOnlyTargetFlags registers --global, --app and --file on the flag set of a subcommand that
+// only reads the env, so that it can also be pointed at a copy of an ENV file
+func AddReadOnlyTargetFlags(args *flag.FlagSet) *TargetFlags {
+	flags := AddTargetFlags(args)
+	args.StringVar(&flags.File, "file", "", "--file: read the env from an ENV file instead of a dokku install")
+	return flags
+}
+
+//quietFlag is a boolean flag that, once set, silences the informational output of a subcommand
+// as the --quiet flag of dokku itself does
+type quietFlag struct {
+	value *bool
+}
+
+func (f quietFlag) String() string {
+	if f.value == nil {
+		return "false"
+	}
+	return strconv.FormatBool(*f.value)
+}
+
+func (f quietFlag) Set(value string) error {
+	quiet, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*f.value = quiet
+	if quiet {
+		os.Setenv("DOKKU_QUIET_OUTPUT", "1")
+	}
+	return nil
+}
+
+func (f quietFlag) IsBoolFlag() bool {
+	return true
+}
+
+//AddQuietFlag registers --quiet on the flag set of a subcommand, which leaves only the data asked
+// for on stdout, and errors and warnings on stderr
+func AddQuietFlag(args *flag.FlagSet) *bool {
+	quiet := false
+	args.Var(quietFlag{value: &quiet}, "quiet", "--quiet: only print the data asked for, warnings and errors")
+	return &quiet
+}
+
+//ResolveTarget returns the target selected by --global, by --app <name>, or else by the app name
+// given as the first of args, along with the args that are left. A first arg of --global, as
+// passed by callers that build the command line themselves, selects the global env as well.
+// With --file all of args are left, as there is no app name to take from them
+func ResolveTarget(flags TargetFlags, args []string) (Target, []string, error) {
+	if flags.Global && flags.App != "" {
+		return Target{}, nil, errors.New("--global and --app cannot be combined")
+	}
+	if flags.File != "" {
+		if flags.Global || flags.App != "" {
+			return Target{}, nil, errors.New("--file cannot be combined with --global or --app")
+		}
+		return Target{File: flags.File}, args, nil
+	}
+	if flags.Global {
+		return Target{}, args, nil
+	}
+	if flags.App != "" {
+		return Target{AppName: flags.App}, args, nil
+	}
+	if len(args) == 0 || args[0] == "" {
+		return Target{}, nil, errors.New("Please specify an app or --global")
+	}
+	if args[0] == "--global" {
+		return Target{}, args[1:], nil
+	}
+	return Target{AppName: args[0]}, args[1:], nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestResolveTarget(t *testing.T) {
+	RegisterTestingT(t)
+	for _, c := range []struct {
+		flags   TargetFlags
+		args    []string
+		appName string
+		rest    []string
+	}{
+		{TargetFlags{Global: true}, []string{"KEY"}, "", []string{"KEY"}},
+		{TargetFlags{App: "test-app-1"}, []string{"KEY"}, "test-app-1", []string{"KEY"}},
+		{TargetFlags{}, []string{"test-app-1", "KEY"}, "test-app-1", []string{"KEY"}},
+		{TargetFlags{}, []string{"--global", "KEY"}, "", []string{"KEY"}},
+		{TargetFlags{}, []string{"test-app-1"}, "test-app-1", []string{}},
+	} {
+		target, rest, err := ResolveTarget(c.flags, c.args)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(target.AppName).To(Equal(c.appName))
+		Expect(rest).To(Equal(c.rest))
+	}
+
+	_, _, err := ResolveTarget(TargetFlags{Global: true, App: "test-app-1"}, []string{"KEY"})
+	Expect(err).To(MatchError("--global and --app cannot be combined"))
+	_, _, err = ResolveTarget(TargetFlags{}, []string{})
+	Expect(err).To(MatchError("Please specify an app or --global"))
+	_, _, err = ResolveTarget(TargetFlags{Global: true, File: "/backup/ENV"}, []string{})
+	Expect(err).To(MatchError("--file cannot be combined with --global or --app"))
+
+	//every arg is left with --file, as there is no app name to take from them
+	target, rest, err := ResolveTarget(TargetFlags{File: "/backup/ENV"}, []string{"KEY"})
+	Expect(err).NotTo(HaveOccurred())
+	Expect(target).To(Equal(Target{File: "/backup/ENV"}))
+	Expect(target.Global()).To(BeFalse())
+	Expect(target.Label()).To(Equal("/backup/ENV"))
+	Expect(rest).To(Equal([]string{"KEY"}))
+
+	Expect(Target{}.Label()).To(Equal("global"))
+	Expect(Target{AppName: "test-app-1"}.Label()).To(Equal("test-app-1"))
+}
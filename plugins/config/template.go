@@ -0,0 +1,129 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//templateData is what the values of the template env may refer to, such as {{ .AppName }}
+type templateData struct {
+	AppName string
+}
+
+//TemplateFile returns the path to the template env applied to new apps
+func (r *PathResolver) TemplateFile() (string, error) {
+	root, err := r.DokkuRoot()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, "ENV.template"), nil
+}
+
+//LoadTemplateEnv loads the template env applied to new apps, which is empty if there is none.
+// Its values are returned as stored, see ApplyTemplate for how they are rendered
+func LoadTemplateEnv() (*Env, error) {
+	filename, err := NewPathResolver().TemplateFile()
+	if err != nil {
+		return nil, err
+	}
+	return loadFromFile("template", filename)
+}
+
+//UpdateTemplate calls fn with the template env while holding its lock and writes it back if fn
+// succeeds. Every value must render for an app
+func UpdateTemplate(fn func(env *Env) error) error {
+	filename, err := NewPathResolver().TemplateFile()
+	if err != nil {
+		return err
+	}
+	unlock, err := lockEnvFile(filename)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	env, err := loadFromFile("template", filename)
+	if err != nil {
+		return err
+	}
+	if err := fn(env); err != nil {
+		return err
+	}
+	if _, err := renderTemplate(env, "example"); err != nil {
+		return err
+	}
+	return env.Write()
+}
+
+//ApplyTemplate sets the keys of the template env that an app does not have yet, with
+// {{ .AppName }} in their values replaced by the name of the app. Keys the app already has are
+// never changed. The keys are set in a single Update, so the usual triggers fire and the app is
+// restarted according to policy. The keys that were added are returned sorted
+func ApplyTemplate(appName string, policy RestartPolicy) ([]string, error) {
+	tmpl, err := LoadTemplateEnv()
+	if err != nil {
+		return nil, err
+	}
+	if tmpl.Len() == 0 {
+		return []string{}, nil
+	}
+	rendered, err := renderTemplate(tmpl, appName)
+	if err != nil {
+		return nil, err
+	}
+	diff, err := Update(appName, policy, func(env *Env) error {
+		_, err := env.MergeMissing(rendered)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diff.Added, nil
+}
+
+//renderTemplate returns a copy of the template env with its values rendered for an app. The copy
+// is not bound to the file of the template and cannot be written
+func renderTemplate(tmpl *Env, appName string) (*Env, error) {
+	rendered := tmpl.clone()
+	rendered.filename = ""
+	for _, k := range tmpl.sortKeys() {
+		value, err := renderTemplateValue(k, tmpl.values()[k], appName)
+		if err != nil {
+			return nil, err
+		}
+		rendered.values()[k] = value
+	}
+	return rendered, nil
+}
+
+func renderTemplateValue(key string, value string, appName string) (string, error) {
+	if !strings.Contains(value, "{{") {
+		return value, nil
+	}
+	t, err := template.New(key).Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("Invalid template for %s: %s", key, err.Error())
+	}
+	var rendered strings.Builder
+	if err := t.Execute(&rendered, templateData{AppName: appName}); err != nil {
+		return "", fmt.Errorf("Unable to render template for %s: %s", key, err.Error())
+	}
+	return rendered.String(), nil
+}
+
+//TriggerPostCreate implements the post-create trigger by applying the template env to the new
+// app. The app has been created by then, so failures are only warned about
+func TriggerPostCreate(appName string) {
+	added, err := ApplyTemplate(appName, RestartPolicyNever)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to apply config template: %s", err.Error()))
+		return
+	}
+	if len(added) > 0 {
+		common.LogVerboseQuiet(fmt.Sprintf("Applied config template: %s", strings.Join(added, ", ")))
+	}
+}
@@ -0,0 +1,75 @@
+package config
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestApplyTemplate(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	templateFile, err := NewPathResolver().TemplateFile()
+	Expect(err).NotTo(HaveOccurred())
+	defer os.Remove(templateFile)
+
+	//without a template nothing is applied
+	added, err := ApplyTemplate(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(added).To(BeEmpty())
+
+	Expect(UpdateTemplate(func(env *Env) error {
+		env.Set("SENTRY_ENVIRONMENT", "{{ .AppName }}")
+		env.Set("LOG_LEVEL", "info")
+		return env.Set("testKey", "FROM_TEMPLATE")
+	})).To(Succeed())
+	tmpl, err := LoadTemplateEnv()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tmpl.Map()).To(Equal(pairs("SENTRY_ENVIRONMENT", "{{ .AppName }}", "LOG_LEVEL", "info", "testKey", "FROM_TEMPLATE")))
+
+	added, err = ApplyTemplate(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(added).To(Equal([]string{"LOG_LEVEL", "SENTRY_ENVIRONMENT"}))
+	env, err := LoadAppEnv(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	//keys the app already has are kept
+	Expect(env.Map()).To(Equal(pairs("SENTRY_ENVIRONMENT", testAppName, "LOG_LEVEL", "info", "testKey", "TESTING")))
+
+	added, err = ApplyTemplate(testAppName, RestartPolicyNever)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(added).To(BeEmpty())
+}
+
+func TestUpdateTemplateInvalid(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost()
+	defer teardown()
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	Expect(UpdateTemplate(func(env *Env) error {
+		return env.Set("BROKEN", "{{ .AppName")
+	})).To(MatchError(HavePrefix("Invalid template for BROKEN: ")))
+	Expect(UpdateTemplate(func(env *Env) error {
+		return env.Set("UNKNOWN", "{{ .Unknown }}")
+	})).To(MatchError(HavePrefix("Unable to render template for UNKNOWN: ")))
+	tmpl, err := LoadTemplateEnv()
+	Expect(err).NotTo(HaveOccurred())
+	Expect(tmpl.Len()).To(Equal(0))
+
+	//values without an action are kept as they are
+	value, err := renderTemplateValue("A", "{ .AppName }", "app")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(value).To(Equal("{ .AppName }"))
+}
+
+func TestMergeMissing(t *testing.T) {
+	RegisterTestingT(t)
+	e := NewForTest(t, pairs("A", "1", "B", "2"))
+	Expect(e.MergeMissing(NewForTest(t, pairs("B", "other", "C", "3", "D", "")))).To(Equal([]string{"C", "D"}))
+	Expect(e.Map()).To(Equal(pairs("A", "1", "B", "2", "C", "3", "D", "")))
+	Expect(e.Keys()).To(Equal([]string{"A", "B", "C", "D"}))
+}
@@ -0,0 +1,26 @@
+package config
+
+//TestingT is the subset of testing.TB used by NewForTest
+type TestingT interface {
+	Helper()
+	Fatalf(format string, args ...interface{})
+}
+
+//NewForTest creates an Env holding a copy of the given values for use in tests.
+// The Env is not bound to a file, so neither DOKKU_ROOT nor a dokku tree is required.
+// Values are not validated so that tests can model the contents of a corrupted ENV file
+func NewForTest(t TestingT, values map[string]string) *Env {
+	t.Helper()
+	envMap := make(map[string]string, len(values))
+	for k, v := range values {
+		if err := validateKey(k); err != nil {
+			t.Fatalf("NewForTest: %s", err.Error())
+		}
+		envMap[k] = v
+	}
+	return &Env{
+		name:     "<test>",
+		filename: "",
+		vars:     envMap,
+	}
+}
@@ -0,0 +1,262 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/dokku/dokku/plugins/common"
+)
+
+//Exit codes of the config-get-raw and config-set-raw triggers, other failures exit with 1
+const (
+	ExitCodeAppNotFound = 2
+	ExitCodeKeyNotFound = 3
+	ExitCodeInvalidKey  = 4
+)
+
+//TriggerError is an error that a trigger reports with a specific exit code
+type TriggerError struct {
+	ExitCode int
+	Err      error
+}
+
+func (e *TriggerError) Error() string {
+	return e.Err.Error()
+}
+
+//TriggerGetMany implements the config-get-many trigger. Keys are read from input, one per
+// line (or NUL-separated), and the values of those that are set are written to output as
+// `key\tvalue\n` records, or as `key\0value\0` records if nullDelimited is true.
+// Keys that are not set are omitted. Tab-delimited output cannot represent values
+// containing tabs or newlines, so these are an error unless nullDelimited is true
+func TriggerGetMany(appName string, input io.Reader, output io.Writer, nullDelimited bool) error {
+	keys, err := readKeys(input)
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return err
+		}
+	}
+
+	env, err := loadAppOrGlobalEnvCached(appName)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(output)
+	for _, k := range keys {
+		value, ok := env.Get(k)
+		if !ok {
+			continue
+		}
+		if nullDelimited {
+			fmt.Fprintf(w, "%s\x00%s\x00", k, value)
+			continue
+		}
+		if strings.ContainsAny(value, "\t\n") {
+			w.Flush()
+			return fmt.Errorf("Value of %s contains a tab or newline, use --null to retrieve it", k)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", k, value)
+	}
+	return w.Flush()
+}
+
+//TriggerGetWithDefaults implements the config-get-with-defaults trigger. Keys are read from
+// input as `key\tdefault` lines, or as NUL-terminated records if nullDelimited is true, the key
+// ending at the first tab so that defaults may contain tabs. A key without a tab has an empty
+// default. The effective value of every key, from the app env merged with the global env or its
+// default if neither sets it, is written to output as `key\tvalue\n` records, or as
+// `key\0value\0` records if nullDelimited is true
+func TriggerGetWithDefaults(appName string, input io.Reader, output io.Writer, nullDelimited bool) error {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	separator := "\n"
+	if nullDelimited {
+		separator = "\x00"
+	}
+	keys := []string{}
+	defaults := map[string]string{}
+	for _, record := range strings.Split(string(b), separator) {
+		parts := strings.SplitN(record, "\t", 2)
+		k := strings.TrimSpace(parts[0])
+		if k == "" {
+			continue
+		}
+		if err := validateKey(k); err != nil {
+			return err
+		}
+		if len(parts) == 2 {
+			defaults[k] = parts[1]
+		}
+		keys = append(keys, k)
+	}
+
+	var env *Env
+	if appName == "" || appName == "--global" {
+		env, err = LoadGlobalEnv()
+	} else {
+		env, err = LoadMergedAppEnv(appName)
+	}
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(output)
+	for _, k := range keys {
+		value := env.GetDefault(k, defaults[k])
+		if nullDelimited {
+			fmt.Fprintf(w, "%s\x00%s\x00", k, value)
+			continue
+		}
+		if strings.ContainsAny(value, "\t\n") {
+			w.Flush()
+			return fmt.Errorf("Value of %s contains a tab or newline, use --null to retrieve it", k)
+		}
+		fmt.Fprintf(w, "%s\t%s\n", k, value)
+	}
+	return w.Flush()
+}
+
+//TriggerGetRaw implements the config-get-raw trigger by writing the value of a key to output
+// exactly as stored, without a trailing newline
+func TriggerGetRaw(appName string, key string, output io.Writer) error {
+	if err := verifyRawTriggerArgs(appName, key); err != nil {
+		return err
+	}
+	env, err := loadAppOrGlobalEnv(appName)
+	if err != nil {
+		return err
+	}
+	ok, err := writeRawValue(output, env, key)
+	if err == nil && !ok {
+		return &TriggerError{ExitCode: ExitCodeKeyNotFound, Err: fmt.Errorf("Key %s is not set", key)}
+	}
+	return err
+}
+
+//writeRawValue writes the value of a key of env to output byte for byte, without adding a newline,
+// for config:get --raw and the config-get-raw trigger. It returns whether the key is set
+func writeRawValue(output io.Writer, env *Env, key string) (bool, error) {
+	value, ok := env.Get(key)
+	if !ok {
+		return false, nil
+	}
+	_, err := io.WriteString(output, value)
+	return true, err
+}
+
+//TriggerSetRaw implements the config-set-raw trigger by setting a key to the contents of input,
+// byte for byte. It goes through SetMany, so the value is validated and the env locked as it is
+// for config:set, and the app is restarted unless restart is false
+func TriggerSetRaw(appName string, key string, input io.Reader, restart bool) error {
+	if err := verifyRawTriggerArgs(appName, key); err != nil {
+		return err
+	}
+	value, err := ioutil.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	if appName == "--global" {
+		appName = ""
+	}
+	return SetMany(appName, map[string]string{key: string(value)}, restart)
+}
+
+func verifyRawTriggerArgs(appName string, key string) error {
+	if appName != "--global" {
+		if _, err := NewPathResolver().AppFile(appName); err != nil {
+			if _, ok := err.(*AppNotFoundError); ok {
+				return &TriggerError{ExitCode: ExitCodeAppNotFound, Err: err}
+			}
+			return err
+		}
+	}
+	if err := validateKey(key); err != nil {
+		return &TriggerError{ExitCode: ExitCodeInvalidKey, Err: err}
+	}
+	return nil
+}
+
+//readKeys reads newline or NUL separated keys, skipping empty entries
+func readKeys(input io.Reader) ([]string, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.FieldsFunc(string(b), func(r rune) bool {
+		return r == '\n' || r == '\x00'
+	})
+	keys := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			keys = append(keys, f)
+		}
+	}
+	return keys, nil
+}
+
+//TriggerPostDeploy implements the post-deploy trigger by recording a snapshot of the app
+// environment. A deploy that got this far has succeeded, so failures are only warned about
+func TriggerPostDeploy(appName string, imageTag string) {
+	snapshot, err := RecordRelease(appName, imageTag)
+	if err != nil {
+		common.LogWarn(fmt.Sprintf("Unable to record config snapshot: %s", err.Error()))
+		return
+	}
+	common.LogVerboseQuiet(fmt.Sprintf("Recorded config snapshot for release %d", snapshot.Release))
+}
+
+//TriggerExpireCheck implements the config-expire-check trigger by unsetting the expired keys
+// of an app, or of the global env for --global, and restarting the app if any were removed
+func TriggerExpireCheck(appName string) error {
+	if appName == "--global" {
+		appName = ""
+	}
+	policy, _, err := resolveRestartPolicy(appName, false, false)
+	if err != nil {
+		return err
+	}
+	return expireKeys(appName, policy)
+}
+
+//TriggerPreDeploy implements the pre-deploy trigger by removing expired keys, which the
+// deploy would otherwise pick up, and warning about values that look like misplaced secrets.
+// The deploy is only failed if the audit-secrets property is set to fail
+func TriggerPreDeploy(appName string) error {
+	if err := expireKeys(appName, RestartPolicyNever); err != nil {
+		common.LogWarn(err.Error())
+	}
+	mode := getConfigProperty(appName, "audit-secrets")
+	if mode == "off" {
+		return nil
+	}
+	findings, err := AuditAppSecrets(appName)
+	if err != nil {
+		if mode == "fail" {
+			return err
+		}
+		common.LogWarn(fmt.Sprintf("Unable to audit config for secrets: %s", err.Error()))
+		return nil
+	}
+	if len(findings) == 0 {
+		return nil
+	}
+
+	common.LogWarn(fmt.Sprintf("Found values in the config of %s that look like secrets", appName))
+	for _, f := range findings {
+		common.LogWarn(f.Message)
+	}
+	common.LogWarn(fmt.Sprintf("Allow expected keys with: dokku config:set-property %s audit-secrets-allow KEY1,KEY2", appName))
+	if mode == "fail" {
+		return fmt.Errorf("Refusing to deploy %s as audit-secrets is set to fail", appName)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestTriggerGetMany(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+	Expect(SetMany(testAppName, map[string]string{"tabKey": "a\tb", "newlineKey": "a\nb\n"}, false)).To(Succeed())
+
+	var out bytes.Buffer
+	Expect(TriggerGetMany(testAppName, strings.NewReader("testKey\nmissingKey\n\n"), &out, false)).To(Succeed())
+	Expect(out.String()).To(Equal("testKey\tTESTING\n"))
+
+	out.Reset()
+	Expect(TriggerGetMany(testAppName, strings.NewReader("tabKey\nmissingKey\nnewlineKey"), &out, true)).To(Succeed())
+	Expect(out.String()).To(Equal("tabKey\x00a\tb\x00newlineKey\x00a\nb\n\x00"))
+
+	out.Reset()
+	Expect(TriggerGetMany("--global", strings.NewReader("globalKey\x00testKey"), &out, true)).To(Succeed())
+	Expect(out.String()).To(Equal("globalKey\x00GLOBAL_VALUE\x00testKey\x00GLOBAL_TESTING\x00"))
+
+	out.Reset()
+	Expect(TriggerGetMany(testAppName, strings.NewReader("tabKey"), &out, false)).NotTo(Succeed())
+	Expect(TriggerGetMany(testAppName, strings.NewReader("invalid-key"), &out, true)).NotTo(Succeed())
+	Expect(TriggerGetMany(testAppName+"-missing", strings.NewReader("testKey"), &out, true)).NotTo(Succeed())
+}
+
+func TestTriggerGetWithDefaults(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	//keys without a default get an empty one, and the app env is merged with the global env
+	var out bytes.Buffer
+	Expect(TriggerGetWithDefaults(testAppName, strings.NewReader("testKey\tfallback\nglobalKey\nmissingKey\tfallback\nnoDefault\n\n"), &out, false)).To(Succeed())
+	Expect(out.String()).To(Equal("testKey\tTESTING\nglobalKey\tGLOBAL_VALUE\nmissingKey\tfallback\nnoDefault\t\n"))
+
+	//a default ends at the end of its record, so may contain tabs, and newlines with --null
+	out.Reset()
+	Expect(TriggerGetWithDefaults(testAppName, strings.NewReader("missingKey\ta\tb\x00otherKey\tc\nd\x00noDefault\x00"), &out, true)).To(Succeed())
+	Expect(out.String()).To(Equal("missingKey\x00a\tb\x00otherKey\x00c\nd\x00noDefault\x00\x00"))
+	out.Reset()
+	Expect(TriggerGetWithDefaults(testAppName, strings.NewReader("missingKey\ta\tb\n"), &out, false)).To(MatchError("Value of missingKey contains a tab or newline, use --null to retrieve it"))
+
+	out.Reset()
+	Expect(TriggerGetWithDefaults("--global", strings.NewReader("testKey\tfallback\nmissingKey\tfallback\n"), &out, false)).To(Succeed())
+	Expect(out.String()).To(Equal("testKey\tGLOBAL_TESTING\nmissingKey\tfallback\n"))
+
+	Expect(TriggerGetWithDefaults(testAppName, strings.NewReader("invalid-key\tfallback\n"), &out, false)).NotTo(Succeed())
+	Expect(TriggerGetWithDefaults(testAppName+"-missing", strings.NewReader("testKey\n"), &out, false)).NotTo(Succeed())
+}
+
+func expectTriggerExitCode(err error, code int) {
+	Expect(err).To(HaveOccurred())
+	triggerErr, ok := err.(*TriggerError)
+	Expect(ok).To(BeTrue())
+	Expect(triggerErr.ExitCode).To(Equal(code))
+}
+
+func TestTriggerRawValues(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	certificate := "-----BEGIN CERTIFICATE-----\nMIIB'\"$(not run)`\\\t\r\n-----END CERTIFICATE-----\n\n"
+	Expect(TriggerSetRaw(testAppName, "CERT", strings.NewReader(certificate), false)).To(Succeed())
+	var out bytes.Buffer
+	Expect(TriggerGetRaw(testAppName, "CERT", &out)).To(Succeed())
+	Expect(out.String()).To(Equal(certificate))
+
+	out.Reset()
+	Expect(TriggerSetRaw("--global", "EMPTY", strings.NewReader(""), false)).To(Succeed())
+	Expect(TriggerGetRaw("--global", "EMPTY", &out)).To(Succeed())
+	Expect(out.String()).To(Equal(""))
+
+	expectTriggerExitCode(TriggerGetRaw(testAppName+"-missing", "CERT", &out), ExitCodeAppNotFound)
+	expectTriggerExitCode(TriggerGetRaw(testAppName, "MISSING", &out), ExitCodeKeyNotFound)
+	expectTriggerExitCode(TriggerGetRaw(testAppName, "invalid-key", &out), ExitCodeInvalidKey)
+	expectTriggerExitCode(TriggerSetRaw(testAppName+"-missing", "CERT", strings.NewReader("x"), false), ExitCodeAppNotFound)
+	expectTriggerExitCode(TriggerSetRaw(testAppName, "invalid-key", strings.NewReader("x"), false), ExitCodeInvalidKey)
+
+	//values are validated the same way as for config:set
+	err := TriggerSetRaw(testAppName, "NUL", strings.NewReader("a\x00b"), false)
+	Expect(err).To(HaveOccurred())
+	_, ok := err.(*TriggerError)
+	Expect(ok).To(BeFalse())
+	expectNoValue(testAppName, "NUL")
+}
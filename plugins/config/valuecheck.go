@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//Issues of a value given to config:set that suggest it was not meant to be stored as given
+const (
+	//ValueIssueQuoted is a value that starts and ends with the same quote character, as left behind
+	// when quotes meant for a local shell are passed through ssh
+	ValueIssueQuoted = "quoted"
+	//ValueIssueWhitespace is a value with leading or trailing whitespace, as copied along with a
+	// password from a password manager
+	ValueIssueWhitespace = "whitespace"
+)
+
+//ValueIssues returns the issues of a value, see ValueIssueQuoted and ValueIssueWhitespace
+func ValueIssues(value string) []string {
+	issues := []string{}
+	if isQuoted(value) {
+		issues = append(issues, ValueIssueQuoted)
+	}
+	if strings.TrimSpace(value) != value {
+		issues = append(issues, ValueIssueWhitespace)
+	}
+	return issues
+}
+
+//StripQuotes removes the quote characters a value starts and ends with, if they match
+func StripQuotes(value string) string {
+	if !isQuoted(value) {
+		return value
+	}
+	return value[1 : len(value)-1]
+}
+
+func isQuoted(value string) bool {
+	return len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0]
+}
+
+//visualizeValue renders a value between | delimiters with its whitespace and control characters
+// made visible: spaces as ·, and others escaped. A masked value only shows the whitespace and
+// quote characters at either end, with what is between them elided
+func visualizeValue(value string, masked bool) string {
+	if masked {
+		start := len(value) - len(strings.TrimLeftFunc(value, unicode.IsSpace))
+		end := len(strings.TrimRightFunc(value, unicode.IsSpace))
+		if start < end && (value[start] == '"' || value[start] == '\'') {
+			start++
+		}
+		if end > start && (value[end-1] == '"' || value[end-1] == '\'') {
+			end--
+		}
+		if start < end {
+			return "|" + visibleRunes(value[:start]) + "…" + visibleRunes(value[end:]) + "|"
+		}
+	}
+	return "|" + visibleRunes(value) + "|"
+}
+
+func visibleRunes(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch {
+		case r == ' ':
+			b.WriteString("·")
+		case r == '\t':
+			b.WriteString(`\t`)
+		case r == '\n':
+			b.WriteString(`\n`)
+		case r == '\r':
+			b.WriteString(`\r`)
+		case unicode.IsControl(r) || (unicode.IsSpace(r) && r > unicode.MaxASCII):
+			b.WriteString(fmt.Sprintf(`\u%04x`, r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+//cleanValue applies --trim and --strip-quotes to a value given to config:set, trimming it first
+// so that quotes inside whitespace are stripped as well
+func cleanValue(value string, trim bool, stripQuotes bool) string {
+	if trim {
+		value = strings.TrimSpace(value)
+	}
+	if stripQuotes {
+		value = StripQuotes(value)
+	}
+	return value
+}
+
+//validateValueTrigger is fired with the app and key as arguments and the value on stdin for each
+// value given to config:set and config:import, letting plugins refuse values they cannot pass
+// through by exiting non-zero with an explanation
+const validateValueTrigger = "config-validate-value"
+
+//ValueRejection is a value that a plugin refused through the config-validate-value trigger
+type ValueRejection struct {
+	Key string
+	//Message is what the plugin printed to explain why
+	Message string
+}
+
+//validateValuesWithPlugins fires config-validate-value for each of the given values, and returns
+// the values refused by a plugin sorted by key. The global env is given as --global
+func validateValuesWithPlugins(appName string, values map[string]string) []ValueRejection {
+	if appName == "" {
+		appName = "--global"
+	}
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	rejections := []ValueRejection{}
+	for _, k := range keys {
+		output, err := activeHost.TriggerInput(values[k], validateValueTrigger, appName, k)
+		if err == nil {
+			continue
+		}
+		message := strings.TrimSpace(output)
+		if message == "" {
+			message = err.Error()
+		}
+		rejections = append(rejections, ValueRejection{Key: k, Message: message})
+	}
+	return rejections
+}
@@ -0,0 +1,96 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestValueIssues(t *testing.T) {
+	RegisterTestingT(t)
+	for value, expected := range map[string][]string{
+		"plain":         {},
+		"two words":     {},
+		"":              {},
+		`"`:             {},
+		`double"quotes`: {},
+		`"mismatched'`:  {},
+		`"quoted"`:      {ValueIssueQuoted},
+		`'quoted'`:      {ValueIssueQuoted},
+		`""`:            {ValueIssueQuoted},
+		"trailing ":     {ValueIssueWhitespace},
+		"\tleading":     {ValueIssueWhitespace},
+		"newline\n":     {ValueIssueWhitespace},
+		"  ":            {ValueIssueWhitespace},
+		`"quoted" `:     {ValueIssueWhitespace},
+		`"with space "`: {ValueIssueQuoted},
+		"'both' end'":   {ValueIssueQuoted},
+	} {
+		Expect(ValueIssues(value)).To(Equal(expected), value)
+	}
+}
+
+func TestCleanValue(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(StripQuotes(`"quoted"`)).To(Equal("quoted"))
+	Expect(StripQuotes(`"mismatched'`)).To(Equal(`"mismatched'`))
+	Expect(StripQuotes(`''''`)).To(Equal(`''`))
+
+	Expect(cleanValue(" \"secret\"\n", true, false)).To(Equal(`"secret"`))
+	Expect(cleanValue(" \"secret\"\n", false, true)).To(Equal(" \"secret\"\n"))
+	//whitespace is trimmed before the quotes are stripped
+	Expect(cleanValue(" \"secret\"\n", true, true)).To(Equal("secret"))
+	Expect(cleanValue(`" padded "`, true, true)).To(Equal(" padded "))
+}
+
+func TestVisualizeValue(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(visualizeValue(`"hunter2"`, false)).To(Equal(`|"hunter2"|`))
+	Expect(visualizeValue("hunter2 \t\r\n", false)).To(Equal(`|hunter2·\t\r\n|`))
+	Expect(visualizeValue("a\x00b\u00a0", false)).To(Equal(`|a\u0000b\u00a0|`))
+
+	//masked values only show what is at either end
+	Expect(visualizeValue(`"hunter2"`, true)).To(Equal(`|"…"|`))
+	Expect(visualizeValue("  hunter2\n", true)).To(Equal(`|··…\n|`))
+	Expect(visualizeValue(`" hunter2 " `, true)).To(Equal(`|"…"·|`))
+	Expect(visualizeValue("   ", true)).To(Equal(`|···|`))
+	Expect(visualizeValue(`""`, true)).To(Equal(`|""|`))
+}
+
+func TestRunSubcommandSetRejectedByPlugins(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	host.vetoes = map[string]string{
+		"DOKKU_NGINX_PORT": "DOKKU_NGINX_PORT is written into nginx.conf and cannot hold ';', '{', '}' or a newline",
+		"CRON_SCHEDULE":    "refused",
+	}
+
+	_, err := runSubcommand(host, "set", "web-app", "DOKKU_NGINX_PORT=80;", "CRON_SCHEDULE=%", "OTHER=1")
+	Expect(err).To(MatchError("Refusing to set 2 value(s) rejected by plugins, use --skip-validation to set them anyway"))
+	Expect(host.triggers).To(BeEmpty())
+	env, err := loadFromFile("web-app", filepath.Join(host.root, "web-app", "ENV"))
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Map()).To(Equal(pairs("KEY", "web-app")))
+
+	_, err = runSubcommand(host, "set", "--no-restart", "--skip-validation", "web-app", "DOKKU_NGINX_PORT=80;")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(host.triggers).To(Equal([]string{"post-config-update web-app set DOKKU_NGINX_PORT"}))
+}
+
+func TestValidateValuesWithPlugins(t *testing.T) {
+	RegisterTestingT(t)
+	host, teardown := setupTestHost("web-app")
+	defer teardown()
+	host.vetoes = map[string]string{"B": "", "A": "  no percent signs\n"}
+	previousHost := activeHost
+	activeHost = host
+	defer func() { activeHost = previousHost }()
+
+	Expect(validateValuesWithPlugins("web-app", pairs("C", "3", "B", "2", "A", "1"))).To(Equal([]ValueRejection{
+		{Key: "A", Message: "no percent signs"},
+		{Key: "B", Message: "exit status 1"},
+	}))
+	Expect(validateValuesWithPlugins("", pairs("C", "3"))).To(BeEmpty())
+}
@@ -0,0 +1,20 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+)
+
+//CompareValue reports whether key is set to candidate. Both are hashed before being compared in
+// constant time, so that neither the contents nor the length of the stored value can be told from
+// how long the comparison takes. A key that is not set never matches, and takes as long to compare
+func (e *Env) CompareValue(key string, candidate string) (bool, error) {
+	if err := validateKey(key); err != nil {
+		return false, err
+	}
+	value, ok := e.Get(key)
+	stored := sha256.Sum256([]byte(value))
+	given := sha256.Sum256([]byte(candidate))
+	equal := subtle.ConstantTimeCompare(stored[:], given[:]) == 1
+	return ok && equal, nil
+}
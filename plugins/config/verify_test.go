@@ -0,0 +1,32 @@
+package config
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestCompareValue(t *testing.T) {
+	RegisterTestingT(t)
+	env := NewForTest(t, map[string]string{"HOOK_SECRET": "s3cret", "EMPTY": ""})
+
+	for _, c := range []struct {
+		key       string
+		candidate string
+		expected  bool
+	}{
+		{"HOOK_SECRET", "s3cret", true},
+		{"HOOK_SECRET", "s3cre", false},
+		{"HOOK_SECRET", "s3cret\n", false},
+		{"HOOK_SECRET", "", false},
+		{"EMPTY", "", true},
+		{"MISSING", "", false},
+	} {
+		equal, err := env.CompareValue(c.key, c.candidate)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(equal).To(Equal(c.expected), c.key+"="+c.candidate)
+	}
+
+	_, err := env.CompareValue("1BAD", "s3cret")
+	Expect(err).To(MatchError("Invalid key name: '1BAD'"))
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	//DefaultWatchInterval is how often WatchApp checks the ENV file of an app for changes
+	DefaultWatchInterval = 250 * time.Millisecond
+	//DefaultWatchDebounce is how long the ENV file must stay unchanged before a change is delivered
+	DefaultWatchDebounce = 500 * time.Millisecond
+)
+
+//WatchOption configures WatchApp
+type WatchOption func(*watcher)
+
+//watcher polls an ENV file, as the directories holding ENV files may be symlinked or relocated
+// and the file itself is replaced on every write
+type watcher struct {
+	name     string
+	filename string
+	interval time.Duration
+	debounce time.Duration
+	onChange func(*Env)
+	onError  func(error)
+}
+
+//WithErrorHandler calls onError when the changed ENV file cannot be read or parsed.
+// The watcher keeps running, and delivers the env again once the file is fixed
+func WithErrorHandler(onError func(error)) WatchOption {
+	return func(w *watcher) {
+		w.onError = onError
+	}
+}
+
+//WithPollInterval checks the ENV file for changes at the given interval instead of DefaultWatchInterval
+func WithPollInterval(interval time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.interval = interval
+	}
+}
+
+//WithDebounce waits for the ENV file to stay unchanged for the given duration instead of
+// DefaultWatchDebounce before delivering a change, so that a burst of writes is delivered once
+func WithDebounce(debounce time.Duration) WatchOption {
+	return func(w *watcher) {
+		w.debounce = debounce
+	}
+}
+
+//WatchApp calls onChange with the freshly parsed env of an app each time its ENV file changes,
+// until stop is called. An ENV file that is removed is delivered as an empty env. Callbacks are
+// called one at a time from a goroutine owned by the watcher, and stop waits for a running callback
+// to return, so it must not be called from one. Errors are ignored unless WithErrorHandler is given
+func WatchApp(appName string, onChange func(*Env), opts ...WatchOption) (stop func(), err error) {
+	filename, err := NewPathResolver().AppFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	w := &watcher{
+		name:     appName,
+		filename: filename,
+		interval: DefaultWatchInterval,
+		debounce: DefaultWatchDebounce,
+		onChange: onChange,
+		onError:  func(error) {},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.interval <= 0 {
+		return nil, fmt.Errorf("Invalid watch interval: %s", w.interval)
+	}
+
+	//changes made once WatchApp returns must be seen, so the file is looked at before it does
+	initial, _ := statFileVersion(w.filename)
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		w.run(initial, done)
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			<-finished
+		})
+	}, nil
+}
+
+func (w *watcher) run(delivered fileVersion, done chan struct{}) {
+	seen := delivered
+	changedAt := time.Time{}
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			version, _ := statFileVersion(w.filename)
+			if version != seen {
+				seen = version
+				changedAt = now
+				continue
+			}
+			if version == delivered || now.Sub(changedAt) < w.debounce {
+				continue
+			}
+			delivered = version
+			env, err := w.load()
+			if err != nil {
+				w.onError(err)
+				continue
+			}
+			w.onChange(env)
+		}
+	}
+}
+
+//load parses the ENV file, reporting rather than dropping lines the loader would not accept.
+// Unlike loadFromFile it never writes the file back
+func (w *watcher) load() (*Env, error) {
+	contents, _, err := readEnvFile(w.filename)
+	if os.IsNotExist(err) {
+		contents, err = []byte{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read config for %s: %s", w.name, err.Error())
+	}
+	env, err := newEnvFromString(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to parse config for %s: %s", w.name, err.Error())
+	}
+	for _, k := range env.sortKeys() {
+		if err := validateKey(k); err != nil {
+			return nil, fmt.Errorf("Unable to parse config for %s: %s", w.name, err.Error())
+		}
+	}
+	env.name = w.name
+	env.filename = w.filename
+	return env, nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func setupWatchRoot() (envFile string, teardown func()) {
+	root, err := ioutil.TempDir("", "dokku-config-watch")
+	Expect(err).NotTo(HaveOccurred())
+	Expect(os.MkdirAll(filepath.Join(root, testAppName), 0755)).To(Succeed())
+	envFile = filepath.Join(root, testAppName, "ENV")
+	Expect(ioutil.WriteFile(envFile, []byte("export A='1'\n"), 0600)).To(Succeed())
+	previous := os.Getenv("DOKKU_ROOT")
+	os.Setenv("DOKKU_ROOT", root)
+	return envFile, func() {
+		os.Setenv("DOKKU_ROOT", previous)
+		os.RemoveAll(root)
+	}
+}
+
+func watchForTest(onError func(error)) (changes chan *Env, stop func()) {
+	changes = make(chan *Env, 10)
+	stop, err := WatchApp(testAppName, func(env *Env) {
+		changes <- env
+	}, WithPollInterval(10*time.Millisecond), WithDebounce(50*time.Millisecond), WithErrorHandler(onError))
+	Expect(err).NotTo(HaveOccurred())
+	return changes, stop
+}
+
+//receiveEnv waits for the next change, returning nil if none is delivered in time
+func receiveEnv(changes chan *Env, timeout time.Duration) *Env {
+	select {
+	case env := <-changes:
+		return env
+	case <-time.After(timeout):
+		return nil
+	}
+}
+
+func TestWatchApp(t *testing.T) {
+	RegisterTestingT(t)
+	envFile, teardown := setupWatchRoot()
+	defer teardown()
+	changes, stop := watchForTest(func(err error) {
+		t.Errorf("unexpected error: %s", err.Error())
+	})
+	defer stop()
+
+	//an external edit in place
+	Expect(ioutil.WriteFile(envFile, []byte("export A='2'\n"), 0600)).To(Succeed())
+	env := receiveEnv(changes, time.Second)
+	Expect(env).NotTo(BeNil())
+	Expect(env.Map()).To(Equal(pairs("A", "2")))
+	Expect(env.name).To(Equal(testAppName))
+
+	//an atomic rename, as done by config:set
+	Expect(writeFileAtomic(envFile, []byte("export A='3'\nexport B='x'\n"), 0600)).To(Succeed())
+	env = receiveEnv(changes, time.Second)
+	Expect(env).NotTo(BeNil())
+	Expect(env.Map()).To(Equal(pairs("A", "3", "B", "x")))
+
+	//a burst of writes is delivered once, with the final contents
+	for _, value := range []string{"4", "5", "6"} {
+		Expect(ioutil.WriteFile(envFile, []byte("export A='"+value+"'\n"), 0600)).To(Succeed())
+		time.Sleep(5 * time.Millisecond)
+	}
+	env = receiveEnv(changes, time.Second)
+	Expect(env).NotTo(BeNil())
+	Expect(env.Map()).To(Equal(pairs("A", "6")))
+	Expect(receiveEnv(changes, 200*time.Millisecond)).To(BeNil())
+
+	Expect(os.Remove(envFile)).To(Succeed())
+	env = receiveEnv(changes, time.Second)
+	Expect(env).NotTo(BeNil())
+	Expect(env.Len()).To(Equal(0))
+
+	stop()
+	Expect(ioutil.WriteFile(envFile, []byte("export A='7'\n"), 0600)).To(Succeed())
+	Expect(receiveEnv(changes, 200*time.Millisecond)).To(BeNil())
+}
+
+func TestWatchAppErrors(t *testing.T) {
+	RegisterTestingT(t)
+	envFile, teardown := setupWatchRoot()
+	defer teardown()
+	errs := make(chan error, 10)
+	changes, stop := watchForTest(func(err error) {
+		errs <- err
+	})
+	defer stop()
+
+	Expect(ioutil.WriteFile(envFile, []byte("not an assignment\n"), 0600)).To(Succeed())
+	var err error
+	select {
+	case err = <-errs:
+	case <-time.After(time.Second):
+	}
+	Expect(err).To(HaveOccurred())
+	Expect(err.Error()).To(ContainSubstring("Unable to parse config for " + testAppName))
+	Expect(changes).To(BeEmpty())
+
+	//the watcher survives and delivers the fixed file
+	Expect(ioutil.WriteFile(envFile, []byte("export A='fixed'\n"), 0600)).To(Succeed())
+	env := receiveEnv(changes, time.Second)
+	Expect(env).NotTo(BeNil())
+	Expect(env.Map()).To(Equal(pairs("A", "fixed")))
+
+	_, err = WatchApp("missing-app", func(*Env) {})
+	_, ok := err.(*AppNotFoundError)
+	Expect(ok).To(BeTrue())
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+//stRdonly is the ST_RDONLY flag of statfs, set for filesystems mounted read-only
+const stRdonly = 0x1
+
+//accessWrite is the W_OK mode of access(2)
+const accessWrite = 0x2
+
+//ErrEnvNotWritable is returned when a file of the config plugin cannot be written because its
+// filesystem is mounted read-only or the dokku user is denied access to it
+type ErrEnvNotWritable struct {
+	Path string
+	//ReadOnlyFilesystem is whether the filesystem holding Path is mounted read-only, rather than
+	// the file or its directory denying write access
+	ReadOnlyFilesystem bool
+	Err                error
+}
+
+func (e *ErrEnvNotWritable) Error() string {
+	state := "permission to write to it is denied"
+	if e.ReadOnlyFilesystem {
+		state = "its filesystem is mounted read-only"
+	}
+	return fmt.Sprintf("Unable to write %s, %s: %s", e.Path, state, e.Err.Error())
+}
+
+//notWritableError returns an ErrEnvNotWritable for an error of writing to path that was caused by
+// EROFS or EACCES, and err unchanged otherwise
+func notWritableError(path string, err error) error {
+	errno, ok := underlyingErrno(err)
+	if !ok || (errno != syscall.EROFS && errno != syscall.EACCES) {
+		return err
+	}
+	return &ErrEnvNotWritable{Path: path, ReadOnlyFilesystem: errno == syscall.EROFS || mountedReadOnly(path), Err: errno}
+}
+
+func underlyingErrno(err error) (syscall.Errno, bool) {
+	switch e := err.(type) {
+	case syscall.Errno:
+		return e, true
+	case *os.PathError:
+		return underlyingErrno(e.Err)
+	case *os.LinkError:
+		return underlyingErrno(e.Err)
+	case *os.SyscallError:
+		return underlyingErrno(e.Err)
+	}
+	return 0, false
+}
+
+//mountedReadOnly reports whether the filesystem holding path, or the closest of its parents that
+// exists, is mounted read-only
+func mountedReadOnly(path string) bool {
+	for dir := path; ; dir = filepath.Dir(dir) {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(dir, &st); err == nil {
+			return st.Flags&stRdonly != 0
+		}
+		if dir == filepath.Dir(dir) {
+			return false
+		}
+	}
+}
+
+//PermissionCheck describes a file the config plugin writes for an env, as found by AuditPermissions
+type PermissionCheck struct {
+	Path   string
+	Exists bool
+	Mode   os.FileMode
+	Owner  string
+	//Writable is whether the current user may write to the file, or create it if it does not exist
+	Writable           bool
+	ReadOnlyFilesystem bool
+}
+
+//OK reports whether the file can be written
+func (c PermissionCheck) OK() bool {
+	return c.Writable && !c.ReadOnlyFilesystem
+}
+
+//AuditPermissions checks the files written when the env of an app, or the global env if appName is
+// empty, is changed: the directory holding the ENV file, the file itself, its lock and its key
+// metadata. Files that do not exist are checked for whether their directory allows creating them
+func AuditPermissions(appName string) ([]PermissionCheck, error) {
+	_, filename, err := resolveAppOrGlobalFile(appName)
+	if err != nil {
+		return nil, err
+	}
+	if filename, err = resolveSymlinkTarget(filename); err != nil {
+		return nil, err
+	}
+	envFile, _ := envFileOnDisk(filename)
+	paths := []string{filepath.Dir(filename), envFile, lockFilePath(filename), metadataFile(filename), provenanceSaltFile(filename)}
+	checks := make([]PermissionCheck, 0, len(paths))
+	for _, path := range paths {
+		checks = append(checks, checkPermissions(path))
+	}
+	return checks, nil
+}
+
+func checkPermissions(path string) PermissionCheck {
+	check := PermissionCheck{Path: path, ReadOnlyFilesystem: mountedReadOnly(path)}
+	fi, err := os.Stat(path)
+	if err != nil {
+		check.Writable = syscall.Access(filepath.Dir(path), accessWrite) == nil
+		return check
+	}
+	check.Exists = true
+	check.Mode = fi.Mode()
+	check.Writable = syscall.Access(path, accessWrite) == nil
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		check.Owner = ownerName(stat.Uid, stat.Gid)
+	}
+	return check
+}
+
+//ownerName returns user:group for a uid and gid, falling back to the ids without a name
+func ownerName(uid uint32, gid uint32) string {
+	owner, group := strconv.Itoa(int(uid)), strconv.Itoa(int(gid))
+	if u, err := user.LookupId(owner); err == nil {
+		owner = u.Username
+	}
+	if g, err := user.LookupGroupId(group); err == nil {
+		group = g.Name
+	}
+	return owner + ":" + group
+}
@@ -0,0 +1,102 @@
+package config
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNotWritableError(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-writable")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+
+	err = notWritableError(filename, &os.PathError{Op: "open", Path: filename, Err: syscall.EROFS})
+	Expect(err).To(MatchError("Unable to write " + filename + ", its filesystem is mounted read-only: read-only file system"))
+	notWritable, ok := err.(*ErrEnvNotWritable)
+	Expect(ok).To(BeTrue())
+	Expect(notWritable.Path).To(Equal(filename))
+	Expect(notWritable.ReadOnlyFilesystem).To(BeTrue())
+
+	err = notWritableError(filename, &os.LinkError{Op: "rename", Old: filename + ".tmp", New: filename, Err: syscall.EACCES})
+	Expect(err).To(MatchError("Unable to write " + filename + ", permission to write to it is denied: permission denied"))
+	Expect(err.(*ErrEnvNotWritable).ReadOnlyFilesystem).To(BeFalse())
+
+	//other failures are returned as they are
+	noSpace := &os.PathError{Op: "write", Path: filename, Err: syscall.ENOSPC}
+	Expect(notWritableError(filename, noSpace)).To(Equal(noSpace))
+	Expect(notWritableError(filename, errors.New("unrelated"))).To(MatchError("unrelated"))
+	Expect(notWritableError(filename, nil)).To(BeNil())
+}
+
+func TestWriteToReadOnlyDir(t *testing.T) {
+	RegisterTestingT(t)
+	if os.Geteuid() == 0 {
+		t.Skip("root is never denied access to a directory")
+	}
+	dir, err := ioutil.TempDir("", "dokku-config-writable")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(filename, []byte("A=\"1\"\n"), 0600)).To(Succeed())
+	Expect(os.Chmod(dir, 0500)).To(Succeed())
+	defer os.Chmod(dir, 0700)
+
+	env, err := loadFromFile("test", filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.Set("B", "2")).To(Succeed())
+	err = env.Write()
+	Expect(err).To(HaveOccurred())
+	notWritable, ok := err.(*ErrEnvNotWritable)
+	Expect(ok).To(BeTrue(), err.Error())
+	Expect(notWritable.Path).To(Equal(filename))
+	Expect(notWritable.ReadOnlyFilesystem).To(BeFalse())
+
+	_, err = lockEnvFile(filename)
+	_, ok = err.(*ErrEnvNotWritable)
+	Expect(ok).To(BeTrue())
+
+	//the file is left as it was, without temporary files next to it
+	contents, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(contents)).To(Equal("A=\"1\"\n"))
+	files, err := ioutil.ReadDir(dir)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(HaveLen(1))
+
+	checks := []PermissionCheck{checkPermissions(dir), checkPermissions(filename), checkPermissions(metadataFile(filename))}
+	Expect(checks[0].OK()).To(BeFalse())
+	Expect(checks[1].Exists).To(BeTrue())
+	Expect(checks[2].Exists).To(BeFalse())
+	Expect(checks[2].OK()).To(BeFalse())
+}
+
+func TestAuditPermissions(t *testing.T) {
+	RegisterTestingT(t)
+	Expect(setupTestApp()).To(Succeed())
+	defer teardownTestApp()
+
+	checks, err := AuditPermissions(testAppName)
+	Expect(err).NotTo(HaveOccurred())
+	paths := []string{}
+	for _, check := range checks {
+		paths = append(paths, check.Path)
+		Expect(check.OK()).To(BeTrue(), check.Path)
+	}
+	envFile := filepath.Join(testAppDir, "ENV")
+	Expect(paths).To(Equal([]string{testAppDir, envFile, lockFilePath(envFile), metadataFile(envFile), provenanceSaltFile(envFile)}))
+	Expect(checks[1].Exists).To(BeTrue())
+	Expect(checks[1].Mode.IsRegular()).To(BeTrue())
+	Expect(checks[1].Owner).NotTo(BeEmpty())
+	Expect(checks[3].Exists).To(BeFalse())
+
+	_, err = AuditPermissions("../" + testAppName)
+	Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+//writeOptions controls how writeFileSafe replaces a file
+type writeOptions struct {
+	//mode of a new file. A replaced file keeps its mode and ownership unless resetMode is set
+	mode      os.FileMode
+	resetMode bool
+	//noClobber fails with an os.IsExist error instead of replacing an existing file
+	noClobber bool
+	//noFollow replaces a symlink itself instead of its final target
+	noFollow bool
+}
+
+//writeFileAtomic writes contents to a temporary file next to the destination and renames it
+// into place. Symlinks are followed so that the link itself is kept and its final target
+// is replaced. An existing destination keeps its mode and ownership, new files get mode
+func writeFileAtomic(filename string, contents []byte, mode os.FileMode) error {
+	return writeFileSafe(filename, contents, writeOptions{mode: mode})
+}
+
+//writeOutputFile writes a file requested by the user, such as the --output of an export. The file
+// is private to the dokku user, and is only replaced if overwrite is set. Symlinks are not followed,
+// so that a link planted at the path cannot redirect the write
+func writeOutputFile(filename string, contents []byte, overwrite bool) error {
+	return writeFileSafe(filename, contents, writeOptions{mode: 0600, resetMode: true, noClobber: !overwrite, noFollow: true})
+}
+
+//writeFileSafe writes contents to a temporary file next to the destination and moves it into
+// place, so that readers see either the old or the new contents. The temporary file is removed
+// whichever step fails, and failures caused by a read-only filesystem or denied access are
+// returned as ErrEnvNotWritable
+func writeFileSafe(filename string, contents []byte, opts writeOptions) error {
+	target := filename
+	if !opts.noFollow {
+		var err error
+		if target, err = resolveSymlinkTarget(filename); err != nil {
+			return err
+		}
+	}
+
+	mode := opts.mode
+	uid, gid := -1, -1
+	if fi, err := os.Stat(target); err == nil && !opts.resetMode {
+		mode = fi.Mode().Perm()
+		if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+			uid, gid = int(stat.Uid), int(stat.Gid)
+		}
+	}
+
+	tmpfile, err := ioutil.TempFile(filepath.Dir(target), fmt.Sprintf(".%s.", filepath.Base(target)))
+	if err != nil {
+		return notWritableError(target, err)
+	}
+	tmpname := tmpfile.Name()
+	if err = writeAndSync(tmpfile, contents); err != nil {
+		os.Remove(tmpname)
+		return notWritableError(target, err)
+	}
+	if err = os.Chmod(tmpname, mode); err != nil {
+		os.Remove(tmpname)
+		return notWritableError(target, err)
+	}
+	if uid != -1 && (uid != os.Getuid() || gid != os.Getgid()) {
+		if err = os.Chown(tmpname, uid, gid); err != nil {
+			os.Remove(tmpname)
+			return notWritableError(target, err)
+		}
+	}
+	if opts.noClobber {
+		//unlike a rename, a hard link fails if the destination exists
+		err = os.Link(tmpname, target)
+		os.Remove(tmpname)
+		return notWritableError(target, err)
+	}
+	if err = os.Rename(tmpname, target); err != nil {
+		os.Remove(tmpname)
+		return notWritableError(target, err)
+	}
+	return nil
+}
+
+func writeAndSync(file *os.File, contents []byte) error {
+	if _, err := file.Write(contents); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+//resolveSymlinkTarget returns the file that a write to filename should replace.
+// A symlink whose final target does not exist is treated as an error rather than replaced
+func resolveSymlinkTarget(filename string) (string, error) {
+	fi, err := os.Lstat(filename)
+	if os.IsNotExist(err) {
+		return filename, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return filename, nil
+	}
+	target, err := filepath.EvalSymlinks(filename)
+	if err != nil {
+		return "", fmt.Errorf("%s is a dangling symlink: %s", filename, err.Error())
+	}
+	return target, nil
+}
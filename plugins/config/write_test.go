@@ -0,0 +1,127 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestWriteFollowsSymlinks(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-write")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	shared := filepath.Join(dir, "shared.env")
+	middle := filepath.Join(dir, "middle.env")
+	link := filepath.Join(dir, "ENV")
+	Expect(ioutil.WriteFile(shared, []byte("export FOO=bar\n"), 0640)).To(Succeed())
+	Expect(os.Symlink(shared, middle)).To(Succeed())
+	Expect(os.Symlink(middle, link)).To(Succeed())
+
+	env, err := loadFromFile("test", link)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(env.GetDefault("FOO", "")).To(Equal("bar"))
+	env.Set("FOO", "updated")
+	Expect(env.Write()).To(Succeed())
+
+	for _, l := range []string{link, middle} {
+		fi, err := os.Lstat(l)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(fi.Mode()&os.ModeSymlink != 0).To(BeTrue())
+	}
+	fi, err := os.Stat(shared)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0640)))
+	content, err := ioutil.ReadFile(shared)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(Equal("FOO=\"updated\"\n"))
+
+	files, err := ioutil.ReadDir(dir)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(HaveLen(3))
+}
+
+func TestWriteDanglingSymlink(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-write")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	link := filepath.Join(dir, "ENV")
+	Expect(os.Symlink(filepath.Join(dir, "missing.env"), link)).To(Succeed())
+
+	env, err := loadFromFile("test", link)
+	Expect(err).NotTo(HaveOccurred())
+	env.Set("FOO", "bar")
+	Expect(env.Write()).NotTo(Succeed())
+
+	_, err = os.Stat(filepath.Join(dir, "missing.env"))
+	Expect(os.IsNotExist(err)).To(BeTrue())
+	fi, err := os.Lstat(link)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode()&os.ModeSymlink != 0).To(BeTrue())
+}
+
+func TestWriteNewFileMode(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-write")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "ENV")
+	Expect(writeEnvContents(filename, []byte("FOO=\"bar\""), false)).To(Succeed())
+	fi, err := os.Stat(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+}
+
+func TestWriteOutputFile(t *testing.T) {
+	RegisterTestingT(t)
+	dir, err := ioutil.TempDir("", "dokku-config-write")
+	Expect(err).NotTo(HaveOccurred())
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "export.env")
+	Expect(writeOutputFile(filename, []byte("first"), false)).To(Succeed())
+	fi, err := os.Stat(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+	err = writeOutputFile(filename, []byte("second"), false)
+	Expect(os.IsExist(err)).To(BeTrue())
+	content, err := ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(Equal("first"))
+
+	//forcing resets the mode of a file that was made world-readable
+	Expect(os.Chmod(filename, 0644)).To(Succeed())
+	Expect(writeOutputFile(filename, []byte("second"), true)).To(Succeed())
+	content, err = ioutil.ReadFile(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(Equal("second"))
+	fi, err = os.Stat(filename)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode().Perm()).To(Equal(os.FileMode(0600)))
+
+	//a symlink is replaced rather than written through
+	target := filepath.Join(dir, "target")
+	Expect(ioutil.WriteFile(target, []byte("untouched"), 0644)).To(Succeed())
+	link := filepath.Join(dir, "link")
+	Expect(os.Symlink(target, link)).To(Succeed())
+	Expect(os.IsExist(writeOutputFile(link, []byte("export"), false))).To(BeTrue())
+	Expect(writeOutputFile(link, []byte("export"), true)).To(Succeed())
+	content, err = ioutil.ReadFile(target)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(content)).To(Equal("untouched"))
+	fi, err = os.Lstat(link)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(fi.Mode().IsRegular()).To(BeTrue())
+
+	files, err := ioutil.ReadDir(dir)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(files).To(HaveLen(3))
+}
@@ -12,8 +12,11 @@ setup() {
 teardown() {
   destroy_app
   ls -la ${DOKKU_ROOT}
+  # the global ENV is restored whether or not a test failed, dropping the global keys it set
   if [[ -f ${DOKKU_ROOT}/ENV.bak ]];then
     mv -f ${DOKKU_ROOT}/ENV.bak ${DOKKU_ROOT}/ENV
+  else
+    rm -f ${DOKKU_ROOT}/ENV
   fi
   global_teardown
 }
@@ -158,3 +161,2193 @@ teardown() {
 
   assert_output "=====> $TEST_APP env vars"$'\nBKEY:  true\naKey:  true\nbKey:  true\nzKey:  true'
 }
+
+@test "(config) config:set-property env-file-path" {
+  run /bin/bash -c "dokku config:set $TEST_APP test_var=relocated"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-file-path relative/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-file-path /tmp/../etc/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property --migrate $TEST_APP env-file-path /tmp/$TEST_APP-secure/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP test_var"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "relocated"
+
+  run /bin/bash -c "dokku config:set $TEST_APP test_var=moved"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "grep -q moved /tmp/$TEST_APP-secure/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-file-path"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP test_var"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "relocated"
+  sudo rm -rf /tmp/$TEST_APP-secure
+}
+
+@test "(config) config:set size limits" {
+  run /bin/bash -c "dokku config:set-property $TEST_APP max-value-size 16"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set $TEST_APP test_var=this-value-is-too-long"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Value of test_var is 22 bytes"
+
+  run /bin/bash -c "dokku config:set $TEST_APP test_var=short"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:size $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "16 bytes"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP max-value-size"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:lint" {
+  run /bin/bash -c "dokku config:lint $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set $TEST_APP TEMPLATE='\${UNRESOLVED}'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:lint $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "value-placeholder"
+
+  run /bin/bash -c "dokku config:lint --strict --format json $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains '"check":"value-placeholder"'
+}
+
+@test "(config) config:restart-scope" {
+  run /bin/bash -c "dokku config:restart-scope:set $TEST_APP 'WORKER_*' worker"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:restart-scope $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "WORKER_*:"
+
+  run /bin/bash -c "dokku config:restart-scope:set $TEST_APP 'WORKER-*' worker"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:restart-scope:unset $TEST_APP 'WORKER_*'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:restart-scope worker-only restart keeps the proxy on the web container" {
+  deploy_app
+  run /bin/bash -c "dokku ps:scale $TEST_APP web=1 worker=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku proxy:enable $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  WEB_CID="$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.web.1)"
+  WORKER_CID="$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.worker.1)"
+  WEB_LISTENER="$(< $DOKKU_ROOT/$TEST_APP/IP.web.1):$(< $DOKKU_ROOT/$TEST_APP/PORT.web.1)"
+
+  run /bin/bash -c "dokku config:restart-scope:set $TEST_APP 'WORKER_*' worker"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set $TEST_APP WORKER_QUEUE=high"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Restarting process types worker of $TEST_APP"
+
+  run /bin/bash -c "[[ \"\$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.web.1)\" == $WEB_CID ]] && [[ \"\$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.worker.1)\" != $WORKER_CID ]]"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "grep -F 'server $WEB_LISTENER;' $DOKKU_ROOT/$TEST_APP/nginx.conf"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_http_success "${TEST_APP}.dokku.me"
+}
+
+@test "(config) config:set --ttl" {
+  run /bin/bash -c "dokku config:set --no-restart --ttl 72h $TEST_APP TEMP_TOKEN=abc123"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "expires"
+
+  run /bin/bash -c "dokku config:expire-check $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP TEMP_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "abc123"
+}
+
+@test "(config) config:drift" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DRIFT_KEY=live"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "echo 'DRIFT_KEY=wanted' > /tmp/desired.env && dokku config:drift --ignore 'DOKKU_*' --file /tmp/desired.env $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "different:"
+  assert_output_contains "wanted" 0
+
+  run /bin/bash -c "dokku config:drift --ignore 'DOKKU_*' --apply --no-restart --file /tmp/desired.env $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "No drift"
+
+  run /bin/bash -c "dokku config:get $TEST_APP DRIFT_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "wanted"
+  rm -f /tmp/desired.env
+}
+
+@test "(config) config:export --output" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP OUTPUT_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "rm -f /tmp/config-export.env && dokku config:export --output /tmp/config-export.env $TEST_APP && stat -c %a /tmp/config-export.env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "600"
+
+  run /bin/bash -c "dokku config:export --output /tmp/config-export.env $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Refusing to overwrite"
+
+  run /bin/bash -c "dokku config:export --output /tmp/config-export.env --force $TEST_APP && grep OUTPUT_KEY /tmp/config-export.env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  rm -f /tmp/config-export.env
+}
+
+@test "(config) config-restart-policy" {
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-restart-policy sometimes"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-restart-policy never"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set $TEST_APP POLICY_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Not restarting as config-restart-policy is never"
+
+  run /bin/bash -c "dokku config:set --restart --no-restart $TEST_APP POLICY_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-restart-policy"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) env-compression" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP COMPRESSED_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-compression zip"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-compression gzip && test -f $DOKKU_ROOT/$TEST_APP/ENV.gz && test ! -f $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP COMPRESSED_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "value"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP env-compression none && test -f $DOKKU_ROOT/$TEST_APP/ENV && test ! -f $DOKKU_ROOT/$TEST_APP/ENV.gz"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:migrate-format" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP FORMAT_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:migrate-format $TEST_APP && head -n1 $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "# dokku-env-format: 2"
+
+  run /bin/bash -c "test -f $DOKKU_ROOT/$TEST_APP/ENV.v1.bak && dokku config:get $TEST_APP FORMAT_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "value"
+
+  run /bin/bash -c "dokku config:migrate-format --to 1 $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Refusing to downgrade"
+}
+
+@test "(config) config:get --quoted --null" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP GET_A='two words' GET_B=other"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get --quoted $TEST_APP GET_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "'two words'"
+
+  run /bin/bash -c "dokku config:get $TEST_APP GET_A GET_B"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:get --quoted $TEST_APP GET_A GET_B"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "GET_A='two words'"
+  assert_output_contains "GET_B='other'"
+
+  run /bin/bash -c "dokku config:get --null $TEST_APP GET_A GET_B | tr '\0' '|'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "GET_A=two words|GET_B=other|"
+
+  run /bin/bash -c "dokku config:get --null $TEST_APP GET_A GET_MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:bundle --exclude --include-only" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP BUNDLE_KEEP=1 BUNDLE_SKIP=2 BUNDLE_PASSWORD=3"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:bundle --include-only 'BUNDLE_*' --exclude '*_SKIP' $TEST_APP | tar -tvf -"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "BUNDLE_KEEP"
+  assert_output_contains "BUNDLE_SKIP" 0
+  assert_output_contains "r-------- " 1
+
+  run /bin/bash -c "dokku config:bundle --exclude '[A-' $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:resolve" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP REF_TARGET=resolved REF_LINK=@app:$TEST_APP:REF_TARGET"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP REF_LINK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "@app:$TEST_APP:REF_TARGET"
+
+  run /bin/bash -c "dokku config:export --format shell $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "REF_LINK='resolved'"
+
+  run /bin/bash -c "dokku config:resolve $TEST_APP REF_LINK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "$TEST_APP:REF_TARGET"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP REF_BROKEN=@app:$TEST_APP:REF_MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set --no-restart --skip-validation $TEST_APP REF_BROKEN=@app:$TEST_APP:REF_MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --format shell $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:report" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP REPORT_SECRET=hunter2"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:report $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Config key count:"
+  assert_output_contains "hunter2" 0
+
+  run /bin/bash -c "dokku config:report $TEST_APP --config-restart-policy"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "always"
+
+  run /bin/bash -c "dokku config:report $TEST_APP --format json"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"config-locked":"false"'
+
+  run /bin/bash -c "dokku config:report $TEST_APP --config-invalid"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:set warns about shadowed global keys" {
+  run /bin/bash -c "dokku config:set --global SHADOW_LEVEL=info"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP SHADOW_LEVEL=debug"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "SHADOW_LEVEL is also set globally to a different value"
+
+  run /bin/bash -c "dokku config:set --global SHADOW_LEVEL=warn"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "$TEST_APP"
+
+  run /bin/bash -c "dokku config:set --quiet --no-restart $TEST_APP SHADOW_LEVEL=trace"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "SHADOW_LEVEL is also set globally" 0
+
+  run /bin/bash -c "dokku config:unset --global SHADOW_LEVEL"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:export --format nul|netstring" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP STREAM_KEY='a b'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --format nul $TEST_APP | tr '\0' '|'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "STREAM_KEY|a b|"
+
+  run /bin/bash -c "dokku config:export --format netstring $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "10:STREAM_KEY,3:a b,"
+}
+
+@test "(config) config:redaction:enable|disable" {
+  run /bin/bash -c "dokku config:redaction:enable $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:redaction:disable $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:redaction:enable $TEST_APP-missing"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:import" {
+  run /bin/bash -c "echo '{\"IMPORTED_URL\": \"postgres://db\", \"HEROKU_APP_NAME\": \"old\"}' | dokku config:import --from heroku-json --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Skipped 1: HEROKU_APP_NAME"
+
+  run /bin/bash -c "dokku config:get $TEST_APP IMPORTED_URL"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "postgres://db"
+
+  run /bin/bash -c "dokku config:get $TEST_APP HEROKU_APP_NAME"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "printf '=== app Config Vars\nIMPORTED_TIME:  12:30\n' | dokku config:import --from heroku-text --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP IMPORTED_TIME"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "12:30"
+
+  run /bin/bash -c "echo '{\"PORT\": 5000}' | dokku config:import --from heroku-json --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:unset --strict" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP UNSET_A=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:unset --no-restart $TEST_APP UNSET_A UNSET_MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Removed 1 key(s): UNSET_A"
+
+  run /bin/bash -c "dokku config:unset --no-restart $TEST_APP UNSET_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "No keys removed"
+
+  run /bin/bash -c "dokku config:unset --strict --no-restart $TEST_APP UNSET_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Not set: UNSET_A"
+}
+
+@test "(config) config:export --format compose" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP COMPOSE_KEY='*a: \$b'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --format compose --service app $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "  app:"
+  assert_output_contains '- "COMPOSE_KEY=*a: $$b"'
+
+  run /bin/bash -c "dokku config:export --format compose --compose-map $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains 'COMPOSE_KEY: "*a: $$b"'
+
+  run /bin/bash -c "dokku config:export --compose-map $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config --provenance" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP PROVENANCE_KEY=one"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config --provenance $TEST_APP PROVENANCE_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PROVENANCE_KEY:"
+  assert_output_contains "Z "
+
+  run /bin/bash -c "sed -i 's/PROVENANCE_KEY=.*/PROVENANCE_KEY=\"two\"/' $DOKKU_ROOT/$TEST_APP/ENV && dokku config --provenance $TEST_APP PROVENANCE_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "unknown (external edit detected)"
+
+  run /bin/bash -c "dokku config --provenance $TEST_APP MISSING_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:set --stdin-pairs" {
+  run /bin/bash -c "printf 'STDIN_A=one two\0STDIN_B=line 1\nline 2' | dokku config:set --no-restart --stdin-pairs $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP STDIN_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "one two"
+
+  run /bin/bash -c "dokku config:get --null $TEST_APP STDIN_B | tr '\0' '|'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "$(printf 'line 1\nline 2|')"
+
+  run /bin/bash -c "printf 'STDIN_C=3\0secret\0' | dokku config:set --no-restart --stdin-pairs $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "record 2"
+
+  run /bin/bash -c "dokku config:get $TEST_APP STDIN_C"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set --no-restart --stdin-pairs $TEST_APP < /dev/null"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:prune" {
+  run /bin/bash -c "dokku config:set --no-restart --literal $TEST_APP PRUNE_EMPTY= PRUNE_SPACES='  ' PRUNE_SET=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:prune $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PRUNE_EMPTY, PRUNE_SPACES"
+
+  run /bin/bash -c "dokku config:prune --confirm --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Removed 2 empty key(s)"
+
+  run /bin/bash -c "dokku config:get $TEST_APP PRUNE_EMPTY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-reject-empty true && dokku config:set --no-restart $TEST_APP PRUNE_EMPTY="
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "config-reject-empty"
+}
+
+@test "(config) config:template" {
+  run /bin/bash -c "dokku config:template:set TEMPLATE_KEY=default 'TEMPLATE_APP={{ .AppName }}'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:template:show"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "TEMPLATE_APP:"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP TEMPLATE_KEY=mine"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:template:apply --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "TEMPLATE_APP"
+
+  run /bin/bash -c "dokku config:get $TEST_APP TEMPLATE_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "$TEST_APP"
+
+  run /bin/bash -c "dokku config:get $TEST_APP TEMPLATE_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "mine"
+
+  run /bin/bash -c "dokku config:template:set 'TEMPLATE_BROKEN={{ .AppName'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:template:unset TEMPLATE_KEY TEMPLATE_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config --warnings-as-errors" {
+  run /bin/bash -c "dokku config --warnings-as-errors $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "printf '\nPARSE_PASSWORD=abc#123\n' >> $DOKKU_ROOT/$TEST_APP/ENV && dokku config:export $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "the value of PARSE_PASSWORD is cut off at a #"
+
+  run /bin/bash -c "dokku config --warnings-as-errors $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Found 1 parse warning(s)"
+}
+
+@test "(config) no-export keys" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP NO_EXPORT_HOOK=https://hooks.example.com && dokku config:annotate --tag no-export $TEST_APP NO_EXPORT_HOOK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --container $TEST_APP | grep -c NO_EXPORT_HOOK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "0"
+
+  run /bin/bash -c "dokku config:get $TEST_APP NO_EXPORT_HOOK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "https://hooks.example.com"
+
+  run /bin/bash -c "dokku config:resolve $TEST_APP NO_EXPORT_HOOK"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "kept out of containers"
+}
+
+@test "(config) config:verify" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP VERIFY_SECRET=s3cret"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "echo s3cret | dokku config:verify $TEST_APP VERIFY_SECRET"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output ""
+
+  run /bin/bash -c "echo s3cre | dokku config:verify $TEST_APP VERIFY_SECRET"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output ""
+
+  run /bin/bash -c "echo s3cret | dokku config:verify $TEST_APP VERIFY_MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output ""
+}
+
+@test "(config) --global and --app across subcommands" {
+  run /bin/bash -c "dokku config:set --no-restart --app $TEST_APP TARGET_KEY=app && dokku config:set --no-restart --global TARGET_KEY=global"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  for cmd in "config:get --app $TEST_APP TARGET_KEY" "config:get $TEST_APP TARGET_KEY"; do
+    run /bin/bash -c "dokku $cmd"
+    echo "output: $output"
+    echo "status: $status"
+    assert_output "app"
+  done
+
+  run /bin/bash -c "dokku config:get --global TARGET_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "global"
+
+  for cmd in "config:export --format json" "config:keys" "config:size" "config" "config:bundle --output /tmp/target-bundle.tgz --force"; do
+    for target in "--global" "--app $TEST_APP" "$TEST_APP"; do
+      run /bin/bash -c "dokku $cmd $target"
+      echo "output: $output"
+      echo "status: $status"
+      assert_success
+    done
+  done
+
+  run /bin/bash -c "dokku config:get --global --app $TEST_APP TARGET_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "--global and --app cannot be combined"
+
+  run /bin/bash -c "dokku config:unset --no-restart --global TARGET_KEY && dokku config:unset --no-restart --app $TEST_APP TARGET_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:notifications" {
+  run /bin/bash -c "dokku config:notifications:add $TEST_APP https://hooks.example.invalid/dokku"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "X-Dokku-Signature"
+
+  run /bin/bash -c "dokku config:notifications:add $TEST_APP not-a-url"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:notifications:list $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "https://hooks.example.invalid/dokku"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP NOTIFIED_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Unable to notify https://hooks.example.invalid/dokku"
+
+  run /bin/bash -c "dokku config:notifications:remove $TEST_APP https://hooks.example.invalid/dokku"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:export --all-apps" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP ALL_APPS_KEY=listed"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --all-apps --format json"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"ALL_APPS_KEY":{"value":"[redacted]"}'
+
+  run /bin/bash -c "dokku config:export --all-apps --show-values --format json"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"ALL_APPS_KEY":{"value":"listed"}'
+
+  run /bin/bash -c "dokku config:export --all-apps $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:export --key-prefix --key-upper" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP renamed_key=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --key-prefix APP_ --key-upper $TEST_APP | grep -c \"^export APP_RENAMED_KEY='value'$\""
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "1"
+
+  run /bin/bash -c "dokku config:export --format json --key-upper $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"RENAMED_KEY":{"value":"value"}'
+}
+
+@test "(config) config:export --key-transform --key-strip-prefix" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP APP_DATABASE_URL=postgres://db APP_NAME=web NAME=other"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --format json --key-transform kebab $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"app-database-url":{"value":"postgres://db"}'
+
+  run /bin/bash -c "dokku config:export --format envfile --key-transform kebab $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "cannot be exported as"
+
+  run /bin/bash -c "dokku config:export --format json --key-strip-prefix APP_ $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Keys APP_NAME and NAME would both be exported as NAME"
+
+  run /bin/bash -c "dokku config:export --key-transform snake $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) apps:rename carries config over" {
+  run /bin/bash -c "dokku config:template:set 'TEMPLATE_APP={{ .AppName }}' && dokku config:template:apply --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set-property --migrate $TEST_APP env-file-path /tmp/config-rename/$TEST_APP/ENV && dokku config:set-property $TEST_APP release-retention 5"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:annotate --description 'the app name' $TEST_APP TEMPLATE_APP && dokku config:set --no-restart $TEST_APP renamed_key=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku apps:rename $TEST_APP great-config-name"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get great-config-name TEMPLATE_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "great-config-name"
+
+  run /bin/bash -c "dokku config:get great-config-name renamed_key && grep -q renamed_key /tmp/config-rename/great-config-name/ENV && test -f /tmp/config-rename/great-config-name/ENV.meta.json"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "value"
+
+  run /bin/bash -c "dokku config:report great-config-name"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "/tmp/config-rename/great-config-name/ENV"
+
+  run /bin/bash -c "dokku --force apps:destroy great-config-name && dokku config:template:unset TEMPLATE_APP && rm -rf /tmp/config-rename"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) apps:clone carries config over" {
+  run /bin/bash -c "dokku config:template:set 'TEMPLATE_APP={{ .AppName }}' 'TEMPLATE_CHANGED={{ .AppName }}' && dokku config:template:apply --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP TEMPLATE_CHANGED=kept cloned_key=value && dokku config:set-property --migrate $TEST_APP env-file-path /tmp/config-clone.env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku apps:clone --skip-deploy $TEST_APP great-config-clone"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get great-config-clone TEMPLATE_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "great-config-clone"
+
+  run /bin/bash -c "dokku config:get great-config-clone TEMPLATE_CHANGED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "kept"
+
+  run /bin/bash -c "dokku config:set --no-restart great-config-clone cloned_key=changed && dokku config:get $TEST_APP cloned_key"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "value"
+
+  run /bin/bash -c "dokku config:get $TEST_APP TEMPLATE_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "$TEST_APP"
+
+  run /bin/bash -c "dokku --force apps:destroy great-config-clone && dokku config:template:unset TEMPLATE_APP TEMPLATE_CHANGED && rm -f /tmp/config-clone.env*"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:audit-permissions" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP audited_key=value && dokku config:audit-permissions $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "$DOKKU_ROOT/$TEST_APP/ENV"
+
+  run /bin/bash -c "chmod 555 $DOKKU_ROOT/$TEST_APP && dokku config:set --no-restart $TEST_APP audited_key=changed"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "config:audit-permissions $TEST_APP"
+
+  run /bin/bash -c "dokku config:audit-permissions $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "not writable"
+
+  run /bin/bash -c "chmod 755 $DOKKU_ROOT/$TEST_APP && ls -a $DOKKU_ROOT/$TEST_APP | grep -c '^\.ENV\.[0-9]'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "0"
+
+  run /bin/bash -c "dokku config:get $TEST_APP audited_key"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "value"
+}
+
+@test "(config) config:set refuses quoted and padded values" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP 'QUOTED_KEY=\"value\"'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains 'The value of QUOTED_KEY is wrapped in quotes: |"value"|'
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP 'PADDED_PASSWORD=hunter2 '"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains 'The value of PADDED_PASSWORD has leading or trailing whitespace: |…·|'
+
+  run /bin/bash -c "dokku config:set --no-restart --strip-quotes $TEST_APP 'QUOTED_KEY=\"value\"' >/dev/null && dokku config:get $TEST_APP QUOTED_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "value"
+
+  run /bin/bash -c "dokku config:set --no-restart --trim $TEST_APP 'PADDED_PASSWORD=hunter2 ' >/dev/null && dokku config:get $TEST_APP PADDED_PASSWORD | grep -c '^hunter2$'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "1"
+
+  run /bin/bash -c "dokku config:set --no-restart --literal $TEST_APP 'QUOTED_KEY=\"value\"' >/dev/null && dokku config:get $TEST_APP QUOTED_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output '"value"'
+
+  run /bin/bash -c "dokku config:set --no-restart --literal --trim $TEST_APP QUOTED_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) docker env-files" {
+  run /bin/bash -c "printf 'DOCKER_QUOTED=\"kept\"\nDOCKER_COMMENT=a # b\nPASSED\n' | dokku config:import --from docker-envfile --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PASSED has no value"
+  assert_output_contains "the value of DOCKER_QUOTED is wrapped in quotes"
+
+  run /bin/bash -c "dokku config:get $TEST_APP DOCKER_QUOTED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output '"kept"'
+
+  run /bin/bash -c "dokku config:export --format docker-envfile $TEST_APP | grep DOCKER_"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "DOCKER_COMMENT=a # b"
+  assert_output_contains 'DOCKER_QUOTED="kept"'
+
+  run /bin/bash -c "dokku config:set --encoded --no-restart $TEST_APP DOCKER_CERT=$(printf 'a\nb' | base64) && dokku config:export --format docker-envfile --warnings-as-errors $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "DOCKER_CERT is left out"
+
+  run /bin/bash -c "printf 'MY KEY=value\n' | dokku config:import --from docker-envfile --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:export --format json-nested" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP NESTED=on NESTED_HOST=mail.example.com NESTED_PORT=587 >/dev/null && dokku config:export --format json-nested --lowercase $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"nested":{"_value":"on","host":"mail.example.com","port":"587"}'
+
+  run /bin/bash -c "dokku config:export --format json --lowercase $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "--separator and --lowercase only apply to --format json-nested"
+}
+
+@test "(config) config --file and config:diff" {
+  run /bin/bash -c "printf 'export SNAPSHOT=old\nexport GONE=1\n' > /tmp/snapshot-a.env && printf 'SNAPSHOT=new\n' > /tmp/snapshot-b.env && dokku config:export --file /tmp/snapshot-a.env --format envfile"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains 'SNAPSHOT="old"'
+
+  run /bin/bash -c "dokku config --file /tmp/snapshot-a.env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "/tmp/snapshot-a.env env vars"
+
+  run /bin/bash -c "dokku config:diff --file /tmp/snapshot-a.env --file /tmp/snapshot-b.env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "removed:  GONE"
+  assert_output_contains "changed:  SNAPSHOT"
+
+  run /bin/bash -c "dokku config:set --file /tmp/snapshot-a.env SNAPSHOT=changed"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:resolve --process" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP LAYERED=app && echo 'LAYERED=worker' > $DOKKU_ROOT/$TEST_APP/ENV.worker && dokku config:resolve --process worker $TEST_APP LAYERED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "(overridden)"
+  assert_output_contains "process:"
+
+  run /bin/bash -c "rm -f $DOKKU_ROOT/$TEST_APP/ENV.worker && dokku config:resolve --phase release $TEST_APP LAYERED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Unknown phase release"
+}
+
+@test "(config) config:history:prune" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP AUDITED=1 && dokku config:unset --no-restart $TEST_APP AUDITED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "cat $DOKKU_ROOT/$TEST_APP/ENV.audit.log"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"unset":["AUDITED"]'
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-audit-max-size 1 && dokku config:history:prune $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Rotated the audit log"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-history-limit -1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) new app without an ENV file" {
+  run /bin/bash -c "rm -f $DOKKU_ROOT/$TEST_APP/ENV && dokku config:export --format json $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "{}"
+
+  run /bin/bash -c "dokku config:bundle $TEST_APP | tar -tf - | wc -l"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "0"
+
+  run /bin/bash -c "dokku config:get $TEST_APP MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:set rejected by config-validate-value" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP 'DOKKU_NGINX_PORT=80;'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "cannot hold ';'"
+
+  run /bin/bash -c "dokku config:get $TEST_APP DOKKU_NGINX_PORT"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DOKKU_NGINX_PORT=8080"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:drift --format json" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DRIFT_JSON=live && echo 'DRIFT_JSON=desired' > /tmp/drift-json.env"
+  assert_success
+
+  run /bin/bash -c "dokku config:drift --format json --ignore 'DOKKU_*' --file /tmp/drift-json.env $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains '"DRIFT_JSON":{"old_checksum":'
+
+  run /bin/bash -c "dokku config:drift --format json --fail-on added --ignore 'DOKKU_*' --file /tmp/drift-json.env $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:import --on-conflict" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP CONFLICT_A=1 CONFLICT_B=2"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "echo '{\"CONFLICT_A\": \"changed\", \"CONFLICT_C\": \"3\"}' | dokku config:import --from heroku-json --on-conflict fail --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "CONFLICT_A is already set to another value"
+
+  run /bin/bash -c "dokku config:get $TEST_APP CONFLICT_C"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "echo '{\"CONFLICT_A\": \"changed\", \"CONFLICT_C\": \"3\"}' | dokku config:import --from heroku-json --on-conflict keep --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Added 1: CONFLICT_C"
+  assert_output_contains "Kept 1: CONFLICT_A"
+
+  run /bin/bash -c "dokku config:get $TEST_APP CONFLICT_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "1"
+
+  run /bin/bash -c "echo '{\"CONFLICT_A\": \"changed\", \"CONFLICT_B\": \"2\"}' | dokku config:import --from heroku-json --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Overwrote 1: CONFLICT_A"
+
+  run /bin/bash -c "dokku config:get $TEST_APP CONFLICT_A"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "changed"
+
+  run /bin/bash -c "echo '{}' | dokku config:import --from heroku-json --on-conflict skip --no-restart $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:bundle --include-envfile" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP BUNDLE_ENVFILE='a b'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:bundle --include-envfile --include-only 'BUNDLE_*' $TEST_APP | tar -xOf - .env"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output 'BUNDLE_ENVFILE="a b"'
+
+  run /bin/bash -c "dokku config:bundle --include-envfile --envfile-name app.env --include-only 'BUNDLE_*' $TEST_APP | tar -tf -"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "app.env"
+
+  run /bin/bash -c "dokku config:bundle --include-envfile --envfile-name BUNDLE_ENVFILE $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config:get-and-unset" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP ONE_TIME_TOKEN=abc123"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get-and-unset $TEST_APP ONE_TIME_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "abc123"
+
+  run /bin/bash -c "dokku config:get $TEST_APP ONE_TIME_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:get-and-unset $TEST_APP ONE_TIME_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output ""
+}
+
+@test "(config) config:set reserved runtime keys" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP PORT=5000"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PORT is also set by dokku at run time"
+
+  run /bin/bash -c "dokku config:lint $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "PORT"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP strict-reserved-keys true"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DYNO=web.1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "Refusing to set DYNO as strict-reserved-keys is enabled"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP strict-reserved-keys"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) dokku run gets the env of a deployed container" {
+  run /bin/bash -c "dokku config:set --global CONTAINER_ENV_GLOBAL=global CONTAINER_ENV_SHARED=global"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP CONTAINER_ENV_SHARED=app 'CONTAINER_ENV_SPACES=a b' CONTAINER_ENV_HIDDEN=1 CONTAINER_ENV_REF=@app:$TEST_APP:CONTAINER_ENV_SHARED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:annotate --tag no-export $TEST_APP CONTAINER_ENV_HIDDEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  deploy_app dockerfile
+  CID=$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.web.1)
+  deployed="$(docker exec "$CID" env | grep '^CONTAINER_ENV_' | sort)"
+  echo "deployed: $deployed"
+
+  run /bin/bash -c "dokku run $TEST_APP env | grep '^CONTAINER_ENV_' | sort"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "$deployed"
+  assert_output_contains "CONTAINER_ENV_REF=app"
+  assert_output_contains "CONTAINER_ENV_HIDDEN" 0
+
+  dokku config:unset --global CONTAINER_ENV_GLOBAL CONTAINER_ENV_SHARED
+}
+
+@test "(config) dokku run gets the env of a deployed container (herokuish)" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP CONTAINER_ENV_SHARED=app CONTAINER_ENV_REF=@app:$TEST_APP:CONTAINER_ENV_SHARED"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart --sealed $TEST_APP CONTAINER_ENV_SEALED=s3cr3t"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  echo "CONTAINER_ENV_PROC=web" >"$DOKKU_ROOT/$TEST_APP/ENV.web"
+  deploy_app
+  CID=$(< $DOKKU_ROOT/$TEST_APP/CONTAINER.web.1)
+  run /bin/bash -c "docker exec $CID /exec env | grep '^CONTAINER_ENV_PROC='"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "CONTAINER_ENV_PROC=web"
+
+  # the container of dokku run has no process type, so it does not get ENV.web
+  deployed="$(docker exec "$CID" /exec env | grep '^CONTAINER_ENV_' | grep -v '^CONTAINER_ENV_PROC=' | sort)"
+  echo "deployed: $deployed"
+
+  run /bin/bash -c "dokku run $TEST_APP env | grep '^CONTAINER_ENV_' | sort"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "$deployed"
+  assert_output_contains "CONTAINER_ENV_REF=app"
+  assert_output_contains "CONTAINER_ENV_SEALED=s3cr3t"
+
+  run /bin/bash -c "docker exec $CID ls /app/.profile.d"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "app-env.sh" 0
+}
+
+@test "(config) invalid-utf8" {
+  run /bin/bash -c "printf \"export NAME='caf\\351'\\n\" >> $DOKKU_ROOT/$TEST_APP/ENV && dokku config:lint $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "NAME is not valid UTF-8"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP invalid-utf8 error && dokku config:get $TEST_APP NAME"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "not valid UTF-8: NAME"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP invalid-utf8 latin1 && dokku config:get $TEST_APP NAME"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "café"
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP invalid-utf8 utf16"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:migrate-format --transcode latin1 $TEST_APP && test -f $DOKKU_ROOT/$TEST_APP/ENV.utf8.bak && dokku config:set-property $TEST_APP invalid-utf8 error && dokku config:get $TEST_APP NAME"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "café"
+}
+
+@test "(config) config-set-namespaced" {
+  run /bin/bash -c "printf 'URL\tpostgres://red\nNAME\tred\n' | plugn trigger config-set-namespaced $TEST_APP DOKKU_POSTGRES_RED_ --no-restart"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get $TEST_APP DOKKU_POSTGRES_RED_URL"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "postgres://red"
+
+  run /bin/bash -c "printf 'not-valid\tx\n' | plugn trigger config-set-namespaced $TEST_APP DOKKU_POSTGRES_RED_ --no-restart"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 4
+}
+
+@test "(config) exit codes and --quiet" {
+  run /bin/bash -c "dokku config:get $TEST_APP MISSING"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 1
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP not-valid=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+
+  run /bin/bash -c "dokku config:unset --no-restart missing-app KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 20
+
+  run /bin/bash -c "dokku config:set --no-restart --quiet $TEST_APP QUIET=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output ""
+
+  run /bin/bash -c "dokku config:get --quiet $TEST_APP QUIET"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "1"
+}
+
+@test "(config) config:export --if-changed-since" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP KEY=1 && dokku config:export --if-changed-since none $TEST_APP 2>&1 >/dev/null | tail -n 1 > /tmp/config-checksum"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --if-changed-since \$(cat /tmp/config-checksum) $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 6
+  assert_output ""
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP KEY=2 && dokku config:export --if-changed-since \$(cat /tmp/config-checksum) $TEST_APP 2>/dev/null"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "export KEY='2'"
+  rm -f /tmp/config-checksum
+}
+
+@test "(config) config:export --eval-safe" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP QUOTED=\"it's \\\$HOME\" && dokku config:export --eval-compare $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "export QUOTED="
+
+  run /bin/bash -c "dokku config:export --eval-safe --format shell $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:export --eval-safe --format json $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+  assert_output_contains "--eval-safe and --eval-compare only apply to --format exports and shell"
+}
+
+@test "(config) config:convert" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP KEY=1 && dokku config:convert --to exportfile $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Converted config for $TEST_APP to the exportfile format"
+
+  run /bin/bash -c "grep -c '^export ' $DOKKU_ROOT/$TEST_APP/ENV && test -f $DOKKU_ROOT/$TEST_APP/ENV.convert.bak"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP OTHER=2 && grep '^export OTHER=' $DOKKU_ROOT/$TEST_APP/ENV && dokku config:get $TEST_APP KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "1"
+
+  run /bin/bash -c "dokku config:convert --to yaml $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config:plugin" {
+  run /bin/bash -c "dokku config:set-property $TEST_APP preserve-order true"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:plugin config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PRESERVE_ORDER:  true"
+
+  run /bin/bash -c "dokku config:keys $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "PRESERVE_ORDER" 0
+
+  run /bin/bash -c "dokku config:plugin ../config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config:pending" {
+  run /bin/bash -c "dokku config:pending $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "No deploy or restart of $TEST_APP has been recorded"
+
+  deploy_app
+  run /bin/bash -c "dokku config:pending $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "$TEST_APP config unchanged since last restart"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP PENDING_KEY=1 && dokku config:pending $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 7
+  assert_output_contains "$TEST_APP restart pending (1 keys changed since last restart)"
+  assert_output_contains "+ PENDING_KEY"
+
+  run /bin/bash -c "dokku config:report $TEST_APP --config-restart-pending"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "true"
+
+  run /bin/bash -c "dokku ps:restart $TEST_APP && dokku config:pending --quiet $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:set --provider" {
+  run /bin/bash -c "dokku config:set --no-restart --provider git-rev $TEST_APP RELEASE_SHA"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Setting provider git-rev for RELEASE_SHA"
+
+  run /bin/bash -c "dokku config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "<computed by git-rev>"
+
+  run /bin/bash -c "grep RELEASE_SHA $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set --provider git-rev $TEST_APP RELEASE_SHA=1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+
+  run /bin/bash -c "dokku config:unset --no-restart $TEST_APP RELEASE_SHA"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Unsetting RELEASE_SHA"
+
+  run /bin/bash -c "dokku config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "RELEASE_SHA" 0
+}
+
+@test "(config) deploy fails when scheduler-env-vars fails" {
+  run /bin/bash -c "dokku config:set --no-restart --provider missing-provider $TEST_APP RELEASE_SHA"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "source $PLUGIN_CORE_AVAILABLE_PATH/config/functions; config_scheduler_docker_args $TEST_APP web deploy"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run deploy_app dockerfile
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config-get-with-defaults" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP SET_KEY=stored"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "printf 'SET_KEY\tfallback\nMISSING_KEY\tfallback\nNO_DEFAULT\n' | plugn trigger config-get-with-defaults $TEST_APP | tr '\t\n' ':|'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "SET_KEY:stored|MISSING_KEY:fallback|NO_DEFAULT:|"
+
+  run /bin/bash -c "printf 'SET_KEY\tfallback\0MISSING_KEY\tfall\tback\0NO_DEFAULT\0' | plugn trigger config-get-with-defaults $TEST_APP --null | tr '\0' '|'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "$(printf 'SET_KEY|stored|MISSING_KEY|fall\tback|NO_DEFAULT||')"
+
+  run /bin/bash -c "printf 'MISSING_KEY\tfall\tback\n' | plugn trigger config-get-with-defaults $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) config_read_many and config_read_with_defaults fail when the trigger fails" {
+  run /bin/bash -c "source $PLUGIN_CORE_AVAILABLE_PATH/config/functions; config_read_many $TEST_APP BAD-KEY || echo read-many-failed"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "read-many-failed"
+
+  run /bin/bash -c "source $PLUGIN_CORE_AVAILABLE_PATH/config/functions; config_read_with_defaults $TEST_APP BAD-KEY=fallback || echo read-with-defaults-failed"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "read-with-defaults-failed"
+
+  run /bin/bash -c "source $PLUGIN_CORE_AVAILABLE_PATH/config/functions; config_read_many $TEST_APP BAD-KEY; echo unreachable"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+  assert_output_contains "unreachable" 0
+}
+
+@test "(config) config_read_with_defaults app value overrides the global one" {
+  source "$PLUGIN_CORE_AVAILABLE_PATH/config/functions"
+  # app-json reads the shell of its scripts this way
+  read_app_shell() {
+    local DOKKU_APP_SHELL
+    config_read_with_defaults "$TEST_APP" DOKKU_APP_SHELL=/bin/bash
+    echo "$DOKKU_APP_SHELL"
+  }
+
+  run /bin/bash -c "dokku config:set --global DOKKU_APP_SHELL=/bin/sh"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run read_app_shell
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "/bin/sh"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DOKKU_APP_SHELL=/bin/zsh"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run read_app_shell
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "/bin/zsh"
+}
+
+@test "(config) config --redacted-public" {
+  run /bin/bash -c "dokku config:set-property $TEST_APP redacted-public-group dokku"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP SECRET_KEY=hunter2"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set-property --global redacted-public-group dokku"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "stat -c '%a %G' $DOKKU_ROOT/$TEST_APP/ENV.redacted && grep -c hunter2 $DOKKU_ROOT/$TEST_APP/ENV.redacted"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "640 dokku"
+  assert_output_contains "hunter2" 0
+
+  run /bin/bash -c "dokku config --redacted-public $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "SECRET_KEY"
+  assert_output_contains "hunter2" 0
+
+  run /bin/bash -c "dokku config:set-property --global redacted-public-group"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "test -f $DOKKU_ROOT/$TEST_APP/ENV.redacted"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+}
+
+@test "(config) restart outcome" {
+  run /bin/bash -c "dokku config:set $TEST_APP RESTART_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Restarted $TEST_APP in"
+
+  run /bin/bash -c "tail -n 1 $DOKKU_ROOT/$TEST_APP/ENV.audit.log"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains '"status":"restarted"'
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP RESTART_KEY=skipped"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Restarted $TEST_APP in" 0
+
+  run /bin/bash -c "tail -n 1 $DOKKU_ROOT/$TEST_APP/ENV.audit.log"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains '"set":["RESTART_KEY"],"restart":{"status":"skipped"}'
+}
+
+@test "(config) config:set --global --preview" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP PREVIEW_KEY=app"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:set --global --preview PREVIEW_KEY=global"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "$TEST_APP:"
+  assert_output_contains "overridden, the value set for $TEST_APP takes effect"
+  assert_output_contains "Nothing was changed"
+
+  run /bin/bash -c "dokku config:get --global PREVIEW_KEY"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:set --global --preview --format json PREVIEW_KEY=global"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"effect":"overridden"'
+
+  run /bin/bash -c "dokku config:set --preview $TEST_APP PREVIEW_KEY=global"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config:get --raw" {
+  run /bin/bash -c "dokku config:set --no-restart --encoded $TEST_APP RAW_NONE=$(printf 'cert' | base64) RAW_ONE=$(printf 'cert\n' | base64) RAW_TWO=$(printf 'cert\n\n' | base64)"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get --raw $TEST_APP RAW_NONE | od -An -c | tr -s ' '"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output " c e r t"
+
+  run /bin/bash -c "dokku config:get --raw $TEST_APP RAW_ONE | od -An -c | tr -s ' '"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output " c e r t \n"
+
+  run /bin/bash -c "dokku config:get --raw $TEST_APP RAW_TWO | od -An -c | tr -s ' '"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output " c e r t \n \n"
+
+  run /bin/bash -c "cmp <(dokku config:get --raw $TEST_APP RAW_TWO) <(plugn trigger config-get-raw $TEST_APP RAW_TWO)"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config:get --first" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DB_URL=postgres://legacy"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:get --first --verbose $TEST_APP DATABASE_URL DB_URL 2>&1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "postgres://legacy"
+  assert_output_contains "DB_URL"
+
+  run /bin/bash -c "dokku config:get --first $TEST_APP MISSING_URL OTHER_URL"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 1
+}
+
+@test "(config) config:set --sealed" {
+  run /bin/bash -c "dokku config:set --no-restart --sealed $TEST_APP API_TOKEN=s3cr3t"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "s3cr3t" 0
+
+  run /bin/bash -c "dokku config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "<sealed>"
+  assert_output_contains "s3cr3t" 0
+
+  run /bin/bash -c "dokku config:get $TEST_APP API_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "!sealed:"
+
+  run /bin/bash -c "plugn trigger scheduler-env-vars $TEST_APP web deploy | tr '\0' '\n'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "s3cr3t"
+
+  run /bin/bash -c "dokku config:unseal $TEST_APP API_TOKEN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "s3cr3t"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP PLAIN=value && dokku config:unseal $TEST_APP PLAIN"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config-contribute-env" {
+  local CONTRIBUTOR="$PLUGIN_ENABLED_PATH/config-contributor-test"
+  mkdir -p "$CONTRIBUTOR"
+  printf '#!/usr/bin/env bash\necho CONTRIBUTED_PORT=8080\n' >"$CONTRIBUTOR/config-contribute-env"
+  chmod +x "$CONTRIBUTOR/config-contribute-env"
+
+  run /bin/bash -c "plugn trigger scheduler-env-vars $TEST_APP web deploy | tr '\0' '\n'"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "8080"
+
+  run /bin/bash -c "dokku config:resolve $TEST_APP CONTRIBUTED_PORT"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "plugin config-contributor-test"
+
+  run /bin/bash -c "dokku config:keys $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "CONTRIBUTED_PORT" 0
+
+  rm -rf "$CONTRIBUTOR"
+}
+
+@test "(config) config:migrate-format --all" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP FORMAT_KEY=value"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:migrate-format --all $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+  assert_output_contains "--all cannot be combined"
+
+  run /bin/bash -c "dokku config:migrate-format --all && head -n1 $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "# dokku-env-format: 2"
+
+  run /bin/bash -c "dokku config:report $TEST_APP --config-global-format-version"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  if [[ -f "$DOKKU_ROOT/ENV.v1.bak" ]]; then
+    mv "$DOKKU_ROOT/ENV.v1.bak" "$DOKKU_ROOT/ENV"
+  fi
+}
+
+@test "(config) config:export --guarded" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP GUARDED=\"it's guarded\""
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "eval \"\$(dokku config:export --guarded $TEST_APP)\" && echo \"\$GUARDED\""
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "it's guarded"
+
+  run /bin/bash -c "eval \"\$(dokku config:export --guarded $TEST_APP | head -n -2)\"; echo \"\${GUARDED-unset}\""
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains "unset"
+  assert_output_contains "it's guarded" 0
+
+  run /bin/bash -c "dokku config:export --guarded --format json $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config-bundle" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP BUNDLE_PASSWORD=hunter2 BUNDLE_PORT=5000"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "cmp <(dokku config:bundle --gzip --exclude 'DOKKU_*' $TEST_APP) <(plugn trigger config-bundle $TEST_APP --gzip --exclude 'DOKKU_*')"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "plugn trigger config-bundle $TEST_APP --gzip --exclude 'DOKKU_*' | tar -tvzf -"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "-r--------"
+  assert_output_contains "BUNDLE_PASSWORD"
+  assert_output_contains "DOKKU_" 0
+
+  run /bin/bash -c "plugn trigger config-bundle $TEST_APP-missing | wc -c"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "0"
+}
+
+@test "(config) config-deploy-diff" {
+  run /bin/bash -c "plugn trigger config-deploy-diff $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "base none"
+
+  deploy_app
+  run /bin/bash -c "dokku ps:report $TEST_APP --deploy-config-changes"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "unknown"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP DEPLOY_DIFF_KEY=s3cr3t && plugn trigger config-deploy-diff $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "added DEPLOY_DIFF_KEY"
+  assert_output_contains "s3cr3t" 0
+
+  run /bin/bash -c "dokku ps:rebuild $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "Config changed since config release"
+  assert_output_contains "added:DEPLOY_DIFF_KEY"
+
+  run /bin/bash -c "dokku ps:report $TEST_APP --deploy-config-changes"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output "added:DEPLOY_DIFF_KEY"
+
+  run /bin/bash -c "plugn trigger config-deploy-diff $TEST_APP-missing"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config-introspection" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP INTROSPECTED_KEY=s3cr3t"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "plugn trigger config-introspection $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"INTROSPECTED_KEY"'
+  assert_output_contains '"restart_pending":null'
+  assert_output_contains "s3cr3t" 0
+
+  run /bin/bash -c "dokku config:unset --no-restart $TEST_APP INTROSPECTED_KEY && plugn trigger config-introspection $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "INTROSPECTED_KEY" 0
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-metadata true && dokku config:set --no-restart $TEST_APP INTROSPECTED_KEY=s3cr3t"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  deploy_app
+  run /bin/bash -c "dokku run $TEST_APP env | grep ^DOKKU_CONFIG_METADATA="
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains '"INTROSPECTED_KEY"'
+  assert_output_contains "s3cr3t" 0
+
+  run /bin/bash -c "dokku config:set-property $TEST_APP config-metadata maybe"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+
+  run /bin/bash -c "plugn trigger config-introspection $TEST_APP-missing"
+  echo "output: $output"
+  echo "status: $status"
+  assert_exit_status 2
+}
+
+@test "(config) config:lint line endings" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP LINTED_KEY=1 && printf 'export A=\"1\"\r\nexport B=\"2\"\nexport C=\"3\"' >> $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config:lint $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "line-endings"
+  assert_output_contains "final-newline"
+
+  run /bin/bash -c "dokku config:lint --strict $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_failure
+
+  run /bin/bash -c "dokku config:get $TEST_APP C"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "3"
+
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP LINTED_KEY=2 && tail -c 1 $DOKKU_ROOT/$TEST_APP/ENV | od -An -c && grep -c $'\r' $DOKKU_ROOT/$TEST_APP/ENV"
+  echo "output: $output"
+  echo "status: $status"
+  assert_output_contains '\n'
+  assert_output_contains "0"
+
+  run /bin/bash -c "dokku config:lint --strict $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+}
+
+@test "(config) config listing truncates large values" {
+  run /bin/bash -c "dokku config:set --no-restart $TEST_APP LARGE_VALUE=\$(head -c 6000 /dev/zero | tr '\\0' 'x')"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+
+  run /bin/bash -c "dokku config $TEST_APP"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output_contains "(5.9KB, truncated — use config:get --raw)"
+  assert_output_contains "xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx" 0
+
+  run /bin/bash -c "dokku config:get --raw $TEST_APP LARGE_VALUE | wc -c"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "6000"
+
+  run /bin/bash -c "dokku config:export --format json $TEST_APP | grep -o 'x*' | awk '{ print length }' | sort -n | tail -1"
+  echo "output: $output"
+  echo "status: $status"
+  assert_success
+  assert_output "6000"
+}